@@ -0,0 +1,491 @@
+// Package bitbucket provides a client for Bitbucket Server's API that
+// implements the same method set as github.Client so its pull requests can be
+// operated on like GitHub's.
+package bitbucket
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/hootsuite/atlantis/models"
+	"github.com/pkg/errors"
+)
+
+// Client is used to perform Bitbucket Server actions. Repos are identified by
+// their project's key and their slug, ex. PROJ/repo, which is their full name.
+type Client struct {
+	// baseURL is the URL of Bitbucket Server, ex. https://bitbucket.example.com/
+	baseURL *url.URL
+	user    string
+	token   string
+	client  *http.Client
+}
+
+// NewClient returns a client for the Bitbucket Server at baseURL, ex.
+// https://bitbucket.example.com, that authenticates as user with token, which
+// can be their password or a personal access token.
+func NewClient(baseURL string, user string, token string) (*Client, error) {
+	base, err := url.Parse(strings.TrimSuffix(baseURL, "/") + "/")
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid bitbucket URL trying to parse %s", baseURL)
+	}
+	if base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("Invalid bitbucket URL %s: must be ex. https://bitbucket.example.com", baseURL)
+	}
+	return &Client{
+		baseURL: base,
+		user:    strings.TrimSpace(user),
+		token:   strings.TrimSpace(token),
+		client:  http.DefaultClient,
+	}, nil
+}
+
+type user struct {
+	Name string `json:"name"`
+}
+
+type comment struct {
+	ID     int    `json:"id"`
+	Text   string `json:"text"`
+	Author user   `json:"author"`
+}
+
+type repository struct {
+	Slug    string `json:"slug"`
+	Project struct {
+		Key string `json:"key"`
+	} `json:"project"`
+	Archived bool `json:"archived"`
+	Links    struct {
+		Clone []link `json:"clone"`
+	} `json:"links"`
+}
+
+type link struct {
+	Href string `json:"href"`
+	Name string `json:"name"`
+}
+
+type ref struct {
+	DisplayID    string     `json:"displayId"`
+	LatestCommit string     `json:"latestCommit"`
+	Repository   repository `json:"repository"`
+}
+
+type pullRequest struct {
+	ID     int    `json:"id"`
+	State  string `json:"state"`
+	Author struct {
+		User user `json:"user"`
+	} `json:"author"`
+	Reviewers []struct {
+		User     user `json:"user"`
+		Approved bool `json:"approved"`
+	} `json:"reviewers"`
+	FromRef ref `json:"fromRef"`
+	ToRef   ref `json:"toRef"`
+	Links   struct {
+		Self []link `json:"self"`
+	} `json:"links"`
+}
+
+// page is a page of the results of a paged API.
+type page struct {
+	Values        json.RawMessage `json:"values"`
+	IsLastPage    bool            `json:"isLastPage"`
+	NextPageStart int             `json:"nextPageStart"`
+}
+
+// GetModifiedFiles returns the names of files that were modified in the pull
+// request. The names include the path to the file from the repo root, ex.
+// parent/child/file.txt.
+func (c *Client) GetModifiedFiles(repo models.Repo, pull models.PullRequest) ([]string, error) {
+	var files []string
+	err := c.getAll(c.pullRequestPath(repo, pull.Num, "changes"), func(values json.RawMessage) error {
+		var changes []struct {
+			Path struct {
+				ToString string `json:"toString"`
+			} `json:"path"`
+		}
+		if err := json.Unmarshal(values, &changes); err != nil {
+			return err
+		}
+		for _, change := range changes {
+			files = append(files, change.Path.ToString)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// CreateComment creates a comment on the pull request.
+func (c *Client) CreateComment(repo models.Repo, pull models.PullRequest, comment string) error {
+	_, err := c.CreateCommentWithID(repo, pull, comment)
+	return err
+}
+
+// CreateCommentWithID creates a comment on the pull request and returns its
+// id.
+func (c *Client) CreateCommentWithID(repo models.Repo, pull models.PullRequest, text string) (int, error) {
+	var created comment
+	if err := c.do("POST", c.pullRequestPath(repo, pull.Num, "comments"), map[string]string{"text": text}, &created); err != nil {
+		return 0, err
+	}
+	return created.ID, nil
+}
+
+// EditComment isn't supported since Bitbucket needs the pull request to edit
+// one of its comments.
+func (c *Client) EditComment(repo models.Repo, commentID int, comment string) error {
+	return errors.New("editing comments isn't supported on Bitbucket")
+}
+
+// PullIsApproved returns true if a reviewer approved the pull request.
+func (c *Client) PullIsApproved(repo models.Repo, pull models.PullRequest) (bool, error) {
+	approvers, err := c.GetApprovers(repo, pull)
+	if err != nil {
+		return false, err
+	}
+	return len(approvers) > 0, nil
+}
+
+// GetApprovers returns the usernames of the reviewers that approved the pull
+// request.
+func (c *Client) GetApprovers(repo models.Repo, pull models.PullRequest) ([]string, error) {
+	var pr pullRequest
+	if err := c.do("GET", c.pullRequestPath(repo, pull.Num, ""), nil, &pr); err != nil {
+		return nil, err
+	}
+	var approvers []string
+	for _, reviewer := range pr.Reviewers {
+		if reviewer.Approved {
+			approvers = append(approvers, reviewer.User.Name)
+		}
+	}
+	return approvers, nil
+}
+
+// GetTeamMembers isn't supported since Bitbucket doesn't have teams.
+func (c *Client) GetTeamMembers(org string, teamSlug string) ([]string, error) {
+	return nil, errors.New("teams aren't supported on Bitbucket")
+}
+
+// GetPullRequest returns the pull request with id num converted to a GitHub
+// pull request so it can be parsed like one.
+func (c *Client) GetPullRequest(repo models.Repo, num int) (*github.PullRequest, *github.Response, error) {
+	var pr pullRequest
+	if err := c.do("GET", c.pullRequestPath(repo, num, ""), nil, &pr); err != nil {
+		return nil, nil, err
+	}
+	// Bitbucket's states are OPEN, DECLINED and MERGED
+	var htmlURL string
+	if len(pr.Links.Self) > 0 {
+		htmlURL = pr.Links.Self[0].Href
+	}
+	source := pr.FromRef.Repository
+	return &github.PullRequest{
+		Number:  github.Int(pr.ID),
+		State:   github.String(strings.ToLower(pr.State)),
+		HTMLURL: github.String(htmlURL),
+		User:    &github.User{Login: github.String(pr.Author.User.Name)},
+		Head: &github.PullRequestBranch{
+			SHA: github.String(pr.FromRef.LatestCommit),
+			Ref: github.String(pr.FromRef.DisplayID),
+			Repo: &github.Repository{
+				FullName: github.String(source.Project.Key + "/" + source.Slug),
+				Owner:    &github.User{Login: github.String(source.Project.Key)},
+				Name:     github.String(source.Slug),
+				CloneURL: github.String(c.cloneURL(source)),
+			},
+		},
+		Base: &github.PullRequestBranch{
+			SHA: github.String(pr.ToRef.LatestCommit),
+			Ref: github.String(pr.ToRef.DisplayID),
+		},
+	}, nil, nil
+}
+
+// UpdateStatus sets the build status of the head commit of the pull request
+// with context as its key. state is a GitHub status state which is converted
+// to Bitbucket's. Bitbucket requires a URL so if targetURL isn't set, the
+// status links to the pull request.
+func (c *Client) UpdateStatus(repo models.Repo, pull models.PullRequest, state string, description string, targetURL string, context string) error {
+	switch state {
+	case "pending":
+		state = "INPROGRESS"
+	case "success":
+		state = "SUCCESSFUL"
+	default:
+		state = "FAILED"
+	}
+	if targetURL == "" {
+		targetURL = pull.URL
+	}
+	status := map[string]string{
+		"state":       state,
+		"key":         context,
+		"name":        context,
+		"url":         targetURL,
+		"description": description,
+	}
+	return c.do("POST", fmt.Sprintf("rest/build-status/1.0/commits/%s", pull.HeadCommit), status, nil)
+}
+
+// AddReaction isn't supported since Bitbucket doesn't have reactions.
+func (c *Client) AddReaction(repo models.Repo, commentID int, content string) (int, error) {
+	return 0, errors.New("reactions aren't supported on Bitbucket")
+}
+
+// DeleteReaction isn't supported, see AddReaction.
+func (c *Client) DeleteReaction(reactionID int) error {
+	return errors.New("reactions aren't supported on Bitbucket")
+}
+
+// GetComments returns the comments on the pull request, oldest first,
+// converted to GitHub comments. Replies to comments aren't included.
+func (c *Client) GetComments(repo models.Repo, pull models.PullRequest) ([]*github.IssueComment, error) {
+	var comments []*github.IssueComment
+	err := c.getAll(c.pullRequestPath(repo, pull.Num, "activities"), func(values json.RawMessage) error {
+		var activities []struct {
+			Action        string  `json:"action"`
+			CommentAction string  `json:"commentAction"`
+			Comment       comment `json:"comment"`
+		}
+		if err := json.Unmarshal(values, &activities); err != nil {
+			return err
+		}
+		for _, a := range activities {
+			if a.Action != "COMMENTED" || a.CommentAction != "ADDED" {
+				continue
+			}
+			comments = append(comments, &github.IssueComment{
+				ID:   github.Int(a.Comment.ID),
+				Body: github.String(a.Comment.Text),
+				User: &github.User{Login: github.String(a.Comment.Author.Name)},
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// activities are listed newest first
+	for i, j := 0, len(comments)-1; i < j; i, j = i+1, j-1 {
+		comments[i], comments[j] = comments[j], comments[i]
+	}
+	return comments, nil
+}
+
+// DeleteComment isn't supported since Bitbucket needs the pull request to
+// delete one of its comments.
+func (c *Client) DeleteComment(repo models.Repo, commentID int) error {
+	return errors.New("deleting comments isn't supported on Bitbucket")
+}
+
+// MinimizeComment isn't supported since Bitbucket can't hide comments.
+func (c *Client) MinimizeComment(repo models.Repo, commentID int) error {
+	return errors.New("minimizing comments isn't supported on Bitbucket")
+}
+
+// AddLabel isn't supported since Bitbucket doesn't have labels.
+func (c *Client) AddLabel(repo models.Repo, pull models.PullRequest, label string) error {
+	return errors.New("labels aren't supported on Bitbucket")
+}
+
+// RemoveLabel isn't supported, see AddLabel.
+func (c *Client) RemoveLabel(repo models.Repo, pull models.PullRequest, label string) error {
+	return errors.New("labels aren't supported on Bitbucket")
+}
+
+// IsCollaborator returns true if username has been granted permission to
+// repo, either directly or through its project. Listing the permissions needs
+// the API user to be an admin of the repo.
+func (c *Client) IsCollaborator(repo models.Repo, username string) (bool, error) {
+	for _, path := range []string{c.repoPath(repo, "permissions/users"), fmt.Sprintf("rest/api/1.0/projects/%s/permissions/users", url.PathEscape(repo.Owner))} {
+		found := false
+		err := c.getAll(path+"?filter="+url.QueryEscape(username), func(values json.RawMessage) error {
+			var permissions []struct {
+				User user `json:"user"`
+			}
+			if err := json.Unmarshal(values, &permissions); err != nil {
+				return err
+			}
+			for _, p := range permissions {
+				if p.User.Name == username {
+					found = true
+				}
+			}
+			return nil
+		})
+		if err != nil || found {
+			return found, err
+		}
+	}
+	return false, nil
+}
+
+// RepoIsArchived returns true if repo has been archived. Versions of
+// Bitbucket Server that can't archive repos always return false.
+func (c *Client) RepoIsArchived(repo models.Repo) (bool, error) {
+	var r repository
+	if err := c.do("GET", c.repoPath(repo, ""), nil, &r); err != nil {
+		return false, err
+	}
+	return r.Archived, nil
+}
+
+// GetFileContents returns the contents of the file at path in repo as of ref.
+// The bool returned is false if there's no file at path. Bitbucket returns
+// files as pages of lines so we join them back together.
+func (c *Client) GetFileContents(repo models.Repo, path string, ref string) (string, bool, error) {
+	var segments []string
+	for _, s := range strings.Split(path, "/") {
+		segments = append(segments, url.PathEscape(s))
+	}
+	filePath := c.repoPath(repo, "browse/"+strings.Join(segments, "/"))
+	var lines []string
+	for start := 0; ; {
+		var p struct {
+			Lines []struct {
+				Text string `json:"text"`
+			} `json:"lines"`
+			IsLastPage    bool `json:"isLastPage"`
+			NextPageStart int  `json:"nextPageStart"`
+		}
+		err := c.do("GET", fmt.Sprintf("%s?at=%s&start=%d&limit=1000", filePath, url.QueryEscape(ref), start), nil, &p)
+		if e, ok := err.(*github.ErrorResponse); ok && e.Response.StatusCode == http.StatusNotFound {
+			return "", false, nil
+		}
+		if err != nil {
+			return "", false, err
+		}
+		for _, l := range p.Lines {
+			lines = append(lines, l.Text)
+		}
+		if p.IsLastPage {
+			return strings.Join(lines, "\n"), true, nil
+		}
+		start = p.NextPageStart
+	}
+}
+
+// CreateGist isn't supported since gists are only on GitHub.
+func (c *Client) CreateGist(description string, filename string, content string) (string, error) {
+	return "", errors.New("gists aren't supported on Bitbucket")
+}
+
+// GetGists isn't supported, see CreateGist.
+func (c *Client) GetGists() ([]*github.Gist, error) {
+	return nil, errors.New("gists aren't supported on Bitbucket")
+}
+
+// DeleteGist isn't supported, see CreateGist.
+func (c *Client) DeleteGist(id string) error {
+	return errors.New("gists aren't supported on Bitbucket")
+}
+
+// repoPath returns the API path of repo, followed by sub if it's set, ex.
+// pull-requests.
+func (c *Client) repoPath(repo models.Repo, sub string) string {
+	path := fmt.Sprintf("rest/api/1.0/projects/%s/repos/%s", url.PathEscape(repo.Owner), url.PathEscape(repo.Name))
+	if sub != "" {
+		path += "/" + sub
+	}
+	return path
+}
+
+// pullRequestPath returns the API path of the pull request with id num in
+// repo, followed by sub if it's set, ex. comments.
+func (c *Client) pullRequestPath(repo models.Repo, num int, sub string) string {
+	path := c.repoPath(repo, fmt.Sprintf("pull-requests/%d", num))
+	if sub != "" {
+		path += "/" + sub
+	}
+	return path
+}
+
+// cloneURL returns the HTTP clone URL of repo. It's built from the repo's
+// project and slug if Bitbucket didn't include it.
+func (c *Client) cloneURL(repo repository) string {
+	for _, l := range repo.Links.Clone {
+		if l.Name == "http" || l.Name == "https" {
+			return l.Href
+		}
+	}
+	return CloneURL(c.baseURL.String(), repo.Project.Key, repo.Slug)
+}
+
+// CloneURL returns the HTTP clone URL of the repo with slug in the project
+// with key on the Bitbucket Server at baseURL.
+func CloneURL(baseURL string, key string, slug string) string {
+	return fmt.Sprintf("%s/scm/%s/%s.git", strings.TrimSuffix(baseURL, "/"), strings.ToLower(key), slug)
+}
+
+// getAll gets every page of the paged API at path and calls f with the
+// values of each.
+func (c *Client) getAll(path string, f func(values json.RawMessage) error) error {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	for start := 0; ; {
+		var p page
+		if err := c.do("GET", fmt.Sprintf("%s%sstart=%d&limit=100", path, sep, start), nil, &p); err != nil {
+			return err
+		}
+		if err := f(p.Values); err != nil {
+			return errors.Wrapf(err, "decoding response to GET %s", path)
+		}
+		if p.IsLastPage {
+			return nil
+		}
+		start = p.NextPageStart
+	}
+}
+
+// do sends a request for path, relative to the base URL, with body encoded as
+// JSON if it's set and decodes the response into v if it's set.
+func (c *Client) do(method string, path string, body interface{}, v interface{}) error {
+	u, err := c.baseURL.Parse(path)
+	if err != nil {
+		return err
+	}
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, u.String(), &reqBody)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.user, c.token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// the error is a GitHub error so github.IsTransientError can tell
+		// which requests to retry
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return &github.ErrorResponse{Response: resp, Message: strings.TrimSpace(string(msg))}
+	}
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			return errors.Wrapf(err, "decoding response to %s %s", method, path)
+		}
+	}
+	return nil
+}
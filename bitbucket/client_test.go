@@ -0,0 +1,181 @@
+package bitbucket
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/hootsuite/atlantis/models"
+	. "github.com/hootsuite/atlantis/testing_util"
+)
+
+var repo = models.Repo{FullName: "PROJ/repo", Owner: "PROJ", Name: "repo"}
+
+// newTestClient returns a client whose requests are handled by handler and
+// a func to stop the server handling them.
+func newTestClient(t *testing.T, handler http.HandlerFunc) (*Client, func()) {
+	server := httptest.NewServer(handler)
+	base, err := url.Parse(server.URL + "/")
+	Ok(t, err)
+	return &Client{baseURL: base, user: "user", token: "token", client: server.Client()}, server.Close
+}
+
+func TestGetPullRequest(t *testing.T) {
+	c, closeServer := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		Equals(t, "/rest/api/1.0/projects/PROJ/repos/repo/pull-requests/3", r.URL.Path)
+		user, token, ok := r.BasicAuth()
+		Assert(t, ok && user == "user" && token == "token", "expected basic auth as user")
+		fmt.Fprint(w, `{
+  "id": 3,
+  "state": "MERGED",
+  "author": {"user": {"name": "author"}},
+  "fromRef": {
+    "displayId": "feature",
+    "latestCommit": "headsha",
+    "repository": {"slug": "fork", "project": {"key": "~AUTHOR"}, "links": {"clone": [{"href": "ssh://git@bitbucket/~author/fork.git", "name": "ssh"}, {"href": "https://bitbucket/scm/~author/fork.git", "name": "http"}]}}
+  },
+  "toRef": {
+    "displayId": "master",
+    "latestCommit": "basesha",
+    "repository": {"slug": "repo", "project": {"key": "PROJ"}}
+  },
+  "links": {"self": [{"href": "https://bitbucket/projects/PROJ/repos/repo/pull-requests/3"}]}
+}`)
+	})
+	defer closeServer()
+
+	pull, _, err := c.GetPullRequest(repo, 3)
+	Ok(t, err)
+	t.Log("Bitbucket's states should be lowercased like GitHub's")
+	Equals(t, "merged", pull.GetState())
+	Equals(t, 3, pull.GetNumber())
+	Equals(t, "https://bitbucket/projects/PROJ/repos/repo/pull-requests/3", pull.GetHTMLURL())
+	Equals(t, "author", pull.User.GetLogin())
+	Equals(t, "headsha", pull.Head.GetSHA())
+	Equals(t, "feature", pull.Head.GetRef())
+	Equals(t, "basesha", pull.Base.GetSHA())
+	Equals(t, "master", pull.Base.GetRef())
+	t.Log("the head repo should be the pull request's source repo, cloned over http")
+	Equals(t, "~AUTHOR/fork", pull.Head.Repo.GetFullName())
+	Equals(t, "~AUTHOR", pull.Head.Repo.Owner.GetLogin())
+	Equals(t, "fork", pull.Head.Repo.GetName())
+	Equals(t, "https://bitbucket/scm/~author/fork.git", pull.Head.Repo.GetCloneURL())
+}
+
+func TestUpdateStatus(t *testing.T) {
+	var status map[string]string
+	c, closeServer := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		Equals(t, "POST", r.Method)
+		Equals(t, "/rest/build-status/1.0/commits/headsha", r.URL.Path)
+		Ok(t, json.NewDecoder(r.Body).Decode(&status))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	defer closeServer()
+	pull := models.PullRequest{Num: 3, HeadCommit: "headsha", URL: "https://bitbucket/pull/3"}
+
+	for state, expected := range map[string]string{
+		"pending": "INPROGRESS",
+		"success": "SUCCESSFUL",
+		"failure": "FAILED",
+		"error":   "FAILED",
+	} {
+		t.Logf("the %s state should be %s on Bitbucket", state, expected)
+		Ok(t, c.UpdateStatus(repo, pull, state, "Plan succeeded", "https://atlantis", "Atlantis"))
+		Equals(t, map[string]string{
+			"state":       expected,
+			"key":         "Atlantis",
+			"name":        "Atlantis",
+			"url":         "https://atlantis",
+			"description": "Plan succeeded",
+		}, status)
+	}
+
+	t.Log("without a target URL the status should link to the pull request")
+	Ok(t, c.UpdateStatus(repo, pull, "success", "Plan succeeded", "", "Atlantis"))
+	Equals(t, "https://bitbucket/pull/3", status["url"])
+}
+
+func TestGetModifiedFiles_Paged(t *testing.T) {
+	var starts []string
+	c, closeServer := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		Equals(t, "/rest/api/1.0/projects/PROJ/repos/repo/pull-requests/3/changes", r.URL.Path)
+		starts = append(starts, r.URL.Query().Get("start"))
+		switch r.URL.Query().Get("start") {
+		case "0":
+			fmt.Fprint(w, `{"values": [{"path": {"toString": "staging/main.tf"}}, {"path": {"toString": "README.md"}}], "isLastPage": false, "nextPageStart": 2}`)
+		case "2":
+			fmt.Fprint(w, `{"values": [{"path": {"toString": "production/main.tf"}}], "isLastPage": true}`)
+		default:
+			t.Errorf("unexpected request for start %q", r.URL.Query().Get("start"))
+		}
+	})
+	defer closeServer()
+
+	t.Log("every page should be read, starting each where the last left off")
+	files, err := c.GetModifiedFiles(repo, models.PullRequest{Num: 3})
+	Ok(t, err)
+	Equals(t, []string{"staging/main.tf", "README.md", "production/main.tf"}, files)
+	Equals(t, []string{"0", "2"}, starts)
+}
+
+func TestGetComments(t *testing.T) {
+	c, closeServer := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		Equals(t, "/rest/api/1.0/projects/PROJ/repos/repo/pull-requests/3/activities", r.URL.Path)
+		switch r.URL.Query().Get("start") {
+		case "0":
+			fmt.Fprint(w, `{"values": [
+  {"action": "COMMENTED", "commentAction": "ADDED", "comment": {"id": 3, "text": "atlantis apply", "author": {"name": "user"}}},
+  {"action": "APPROVED"}
+], "isLastPage": false, "nextPageStart": 2}`)
+		case "2":
+			fmt.Fprint(w, `{"values": [
+  {"action": "COMMENTED", "commentAction": "EDITED", "comment": {"id": 2, "text": "edited"}},
+  {"action": "COMMENTED", "commentAction": "ADDED", "comment": {"id": 1, "text": "atlantis plan", "author": {"name": "user"}}}
+], "isLastPage": true}`)
+		default:
+			t.Errorf("unexpected request for start %q", r.URL.Query().Get("start"))
+		}
+	})
+	defer closeServer()
+
+	t.Log("comments should be oldest first even though activities are newest first")
+	comments, err := c.GetComments(repo, models.PullRequest{Num: 3})
+	Ok(t, err)
+	Equals(t, 2, len(comments))
+	Equals(t, 1, comments[0].GetID())
+	Equals(t, "atlantis plan", comments[0].GetBody())
+	Equals(t, "user", comments[0].User.GetLogin())
+	Equals(t, 3, comments[1].GetID())
+	Equals(t, "atlantis apply", comments[1].GetBody())
+}
+
+func TestGetFileContents(t *testing.T) {
+	c, closeServer := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		Equals(t, "master", r.URL.Query().Get("at"))
+		if r.URL.Path != "/rest/api/1.0/projects/PROJ/repos/repo/browse/staging/atlantis.yaml" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch r.URL.Query().Get("start") {
+		case "0":
+			fmt.Fprint(w, `{"lines": [{"text": "apply_approvers:"}], "isLastPage": false, "nextPageStart": 1}`)
+		case "1":
+			fmt.Fprint(w, `{"lines": [{"text": "  - environment: production"}], "isLastPage": true}`)
+		}
+	})
+	defer closeServer()
+
+	t.Log("the pages of lines should be joined back together")
+	contents, found, err := c.GetFileContents(repo, "staging/atlantis.yaml", "master")
+	Ok(t, err)
+	Assert(t, found, "expected the file to be found")
+	Equals(t, "apply_approvers:\n  - environment: production", contents)
+
+	t.Log("a file that doesn't exist shouldn't be an error")
+	_, found, err = c.GetFileContents(repo, "production/atlantis.yaml", "master")
+	Ok(t, err)
+	Assert(t, !found, "expected the file not to be found")
+}
@@ -8,9 +8,22 @@ import (
 	"github.com/spf13/cobra"
 )
 
+const versionFlag = "version"
+
 var RootCmd = &cobra.Command{
 	Use:   "atlantis",
 	Short: "Manage your Terraform workflow from GitHub",
+	Run: func(cmd *cobra.Command, args []string) {
+		if v, _ := cmd.Flags().GetBool(versionFlag); v {
+			printVersion()
+			return
+		}
+		cmd.Help()
+	},
+}
+
+func init() {
+	RootCmd.Flags().Bool(versionFlag, false, "Print the current Atlantis version.")
 }
 
 func Execute() {
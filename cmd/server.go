@@ -2,11 +2,14 @@ package cmd
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 
 	"strings"
+	"time"
 
 	"github.com/hootsuite/atlantis/server"
+	"github.com/hootsuite/atlantis/terraform"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -17,23 +20,137 @@ import (
 // 2. Add a new field to server.ServerConfig and set the mapstructure tag equal to the flag name
 // 3. Add your flag's description etc. to the stringFlags, intFlags, or boolFlags slices
 const (
-	atlantisURLFlag     = "atlantis-url"
-	configFlag          = "config"
-	dataDirFlag         = "data-dir"
-	ghHostnameFlag      = "gh-hostname"
-	ghTokenFlag         = "gh-token"
-	ghUserFlag          = "gh-user"
-	ghWebHookSecret     = "gh-webhook-secret"
-	logLevelFlag        = "log-level"
-	portFlag            = "port"
-	requireApprovalFlag = "require-approval"
+	acknowledgeCommandsFlag       = "acknowledge-commands"
+	adminTeamFlag                 = "admin-team"
+	allowStateRmFlag              = "allow-state-rm"
+	apiTokenFlag                  = "api-token"
+	applyHintFlag                 = "apply-hint"
+	applyTimeoutFlag              = "apply-timeout"
+	archivedRepoCommentFlag       = "archived-repo-comment"
+	atlantisURLFlag               = "atlantis-url"
+	autoplanFlag                  = "autoplan"
+	autoplanCommentOnSkipFlag     = "autoplan-comment-on-skip"
+	autoplanReposFlag             = "autoplan-repos"
+	bitbucketTokenFlag            = "bitbucket-token"
+	bitbucketURLFlag              = "bitbucket-url"
+	bitbucketUserFlag             = "bitbucket-user"
+	bitbucketWebHookSecretFlag    = "bitbucket-webhook-secret"
+	cloneDepthFlag                = "clone-depth"
+	cloneSubmodulesFlag           = "clone-submodules"
+	commandQueueSizeFlag          = "command-queue-size"
+	commandWorkersFlag            = "command-workers"
+	commentTemplateFlag           = "comment-template"
+	configFlag                    = "config"
+	dataDirFlag                   = "data-dir"
+	defaultPlanScopeFlag          = "default-plan-scope"
+	defaultVerboseFlag            = "default-verbose"
+	deniedTerraformFlagsFlag      = "denied-terraform-flags"
+	disableMetricsEnvLabelFlag    = "disable-metrics-environment-label"
+	disableMetricsRepoLabelFlag   = "disable-metrics-repo-label"
+	disableReactionsFlag          = "disable-reactions"
+	drainTimeoutFlag              = "drain-timeout"
+	dryRunFlag                    = "dry-run"
+	fmtCheckFlag                  = "fmt-check"
+	ghHostnameFlag                = "gh-hostname"
+	ghRetriesFlag                 = "gh-retries"
+	ghTokenFlag                   = "gh-token"
+	ghUserFlag                    = "gh-user"
+	ghWebHookSecret               = "gh-webhook-secret"
+	gistOutputThresholdFlag       = "gist-output-threshold"
+	gitlabHostnameFlag            = "gitlab-hostname"
+	gitlabTokenFlag               = "gitlab-token"
+	gitlabWebHookSecretFlag       = "gitlab-webhook-secret"
+	labelApplyFailureFlag         = "label-apply-failure"
+	labelApplySuccessFlag         = "label-apply-success"
+	labelPlanFailureFlag          = "label-plan-failure"
+	labelPlanSuccessFlag          = "label-plan-success"
+	lockTimeoutFlag               = "lock-timeout"
+	logFormatFlag                 = "log-format"
+	logLevelFlag                  = "log-level"
+	maintenanceFlag               = "maintenance"
+	mergeConflictsFlag            = "merge-conflicts"
+	parallelAppliesFlag           = "parallel-applies"
+	parallelPlansFlag             = "parallel-plans"
+	planTimeoutFlag               = "plan-timeout"
+	portFlag                      = "port"
+	projectExcludesFlag           = "project-excludes"
+	projectPatternFlag            = "project-pattern"
+	pullDataErrorCommentFlag      = "pull-data-error-comment"
+	queueTimeoutFlag              = "queue-timeout"
+	reactionFailureFlag           = "reaction-failure"
+	reactionQueuedFlag            = "reaction-queued"
+	reactionRunningFlag           = "reaction-running"
+	reactionSuccessFlag           = "reaction-success"
+	redactKeysFlag                = "redact-keys"
+	repoAllowlistFlag             = "repo-allowlist"
+	repoSSHKeysFlag               = "repo-ssh-keys"
+	requireApprovalFlag           = "require-approval"
+	requireCodeOwnersApprovalFlag = "require-codeowners-approval"
+	requireConfiguredEnvsFlag     = "require-configured-envs"
+	slowCommandThresholdFlag      = "slow-command-threshold"
+	sshKeyFlag                    = "ssh-key"
+	stalePlanCommentFlag          = "stale-plan-comment"
+	statusContextFlag             = "status-context"
+	statusFailureCommentFlag      = "status-failure-comment"
+	statusRetriesFlag             = "status-retries"
+	statusesFlag                  = "statuses"
+	supersededCommentsFlag        = "superseded-comments"
+	tfBinariesFlag                = "tf-binaries"
+	tfDownloadURLFlag             = "tf-download-url"
+	untrustedForksFlag            = "untrusted-forks"
+	webPasswordFlag               = "web-password"
+	webUsernameFlag               = "web-username"
 )
 
 var stringFlags = []stringFlag{
+	{
+		name:        adminTeamFlag,
+		description: "GitHub team, in the form org/team, whose members can comment \"atlantis apply --override\" to bypass the apply requirements. If not set, no one can override.",
+	},
+	{
+		name:        apiTokenFlag,
+		description: "Token that API clients must send in an Authorization: Bearer header to access everything but the events endpoint. Can also be specified via the ATLANTIS_API_TOKEN environment variable.",
+		env:         "ATLANTIS_API_TOKEN",
+	},
+	{
+		name:        applyTimeoutFlag,
+		description: "How long terraform apply or destroy can run in a project before it's stopped and the project fails, ex. 2h. It's interrupted first so it can release the state lock. If not set, there's no timeout.",
+	},
+	{
+		name:        archivedRepoCommentFlag,
+		description: "Comment posted instead of running a command if the repository is archived.",
+		value:       server.DefaultArchivedRepoComment,
+	},
 	{
 		name:        atlantisURLFlag,
 		description: "URL that Atlantis can be reached at. Defaults to http://$(hostname):$port where $port is from --" + portFlag + ".",
 	},
+	{
+		name:        autoplanReposFlag,
+		description: "Comma-separated repos, ex. hootsuite/atlantis, whose pull requests are planned automatically with --" + autoplanFlag + ". Takes the same patterns as --" + repoAllowlistFlag + ". If not set, every repo's pull requests are.",
+	},
+	{
+		name:        bitbucketTokenFlag,
+		description: "Bitbucket Server personal access token or password of the API user. Setting it enables Bitbucket Server pull requests alongside GitHub. Can also be specified via the ATLANTIS_BITBUCKET_TOKEN environment variable.",
+		env:         "ATLANTIS_BITBUCKET_TOKEN",
+	},
+	{
+		name:        bitbucketURLFlag,
+		description: "URL of your Bitbucket Server, ex. https://bitbucket.example.com. Required with --" + bitbucketTokenFlag + ".",
+	},
+	{
+		name:        bitbucketUserFlag,
+		description: "Bitbucket Server username of the API user. Required with --" + bitbucketTokenFlag + ".",
+	},
+	{
+		name:        bitbucketWebHookSecretFlag,
+		description: "Optional secret used for Bitbucket Server webhooks. If not specified, Atlantis won't validate incoming Bitbucket webhooks. Can also be specified via the ATLANTIS_BITBUCKET_WEBHOOK_SECRET environment variable.",
+		env:         "ATLANTIS_BITBUCKET_WEBHOOK_SECRET",
+	},
+	{
+		name:        commentTemplateFlag,
+		description: "Path to a Go text/template file to render comments with instead of Atlantis's own format. It's checked when Atlantis starts.",
+	},
 	{
 		name:        configFlag,
 		description: "Path to config file.",
@@ -43,6 +160,20 @@ var stringFlags = []stringFlag{
 		description: "Path to directory to store Atlantis data.",
 		value:       "~/.atlantis",
 	},
+	{
+		name:        defaultPlanScopeFlag,
+		description: "Which projects atlantis plan runs in if the comment doesn't say. Either changed to plan the projects modified by the pull request, or all to plan every project in the repo. Repos can override this with plan_scope in the atlantis.yaml at their root.",
+		value:       server.ChangedProjectsScope,
+	},
+	{
+		name:        deniedTerraformFlagsFlag,
+		description: "Comma-separated terraform flags that can't be used in comments or in extra_arguments, ex. -backend=false,-lock. A flag without a value denies it with any value.",
+	},
+	{
+		name:        drainTimeoutFlag,
+		description: "How long Atlantis waits for running commands to complete when it receives SIGTERM or SIGINT before it exits anyway, ex. 10m. New commands are rejected while it waits.",
+		value:       "5m",
+	},
 	{
 		name:        ghHostnameFlag,
 		description: "Hostname of your Github Enterprise installation. If using github.com, no need to set.",
@@ -59,28 +190,299 @@ var stringFlags = []stringFlag{
 	},
 	{
 		name:        ghWebHookSecret,
-		description: "Optional secret used for GitHub webhooks (see https://developer.github.com/webhooks/securing/). If not specified, Atlantis won't validate the incoming webhook call.",
+		description: "Secret used to validate the X-Hub-Signature-256 of GitHub webhooks (see https://developer.github.com/webhooks/securing/). Webhooks that aren't signed with it are rejected. If not specified, Atlantis won't validate the incoming webhook call and warns when it starts.",
 		env:         "ATLANTIS_GH_WEBHOOK_SECRET",
 	},
+	{
+		name:        gitlabHostnameFlag,
+		description: "Hostname of your GitLab installation. If using gitlab.com, no need to set.",
+		value:       "gitlab.com",
+	},
+	{
+		name:        gitlabTokenFlag,
+		description: "GitLab personal access token of API user with the api scope. Setting it enables GitLab merge requests alongside GitHub. Can also be specified via the ATLANTIS_GITLAB_TOKEN environment variable.",
+		env:         "ATLANTIS_GITLAB_TOKEN",
+	},
+	{
+		name:        gitlabWebHookSecretFlag,
+		description: "Optional secret token used for GitLab webhooks. If not specified, Atlantis won't validate incoming GitLab webhooks. Can also be specified via the ATLANTIS_GITLAB_WEBHOOK_SECRET environment variable.",
+		env:         "ATLANTIS_GITLAB_WEBHOOK_SECRET",
+	},
+	{
+		name:        labelApplyFailureFlag,
+		description: "Label added to pull requests whose last apply failed, ex. atlantis/apply-failed. If not set, failed applies aren't labelled.",
+	},
+	{
+		name:        labelApplySuccessFlag,
+		description: "Label added to pull requests whose last apply succeeded, ex. atlantis/apply-ok. If not set, successful applies aren't labelled.",
+	},
+	{
+		name:        labelPlanFailureFlag,
+		description: "Label added to pull requests whose last plan failed, ex. atlantis/plan-failed. If not set, failed plans aren't labelled.",
+	},
+	{
+		name:        labelPlanSuccessFlag,
+		description: "Label added to pull requests whose last plan succeeded, ex. atlantis/plan-ok. If not set, successful plans aren't labelled.",
+	},
+	{
+		name:        lockTimeoutFlag,
+		description: "How long terraform plan and apply wait for the state lock, ex. 5m, if neither the comment nor the project's atlantis.yaml set -lock-timeout. If not set, terraform's default is used.",
+	},
+	{
+		name:        logFormatFlag,
+		description: "Log format. Either text for human-readable lines or json for one JSON object per line with ts, level, src and msg keys.",
+		value:       "text",
+	},
 	{
 		name:        logLevelFlag,
 		description: "Log level. Either debug, info, warn, or error.",
 		value:       "info",
 	},
+	{
+		name:        mergeConflictsFlag,
+		description: "What to do when a pull request conflicts with its base branch. Either ignore to plan the branch as is, fail to refuse to plan until the conflicts are resolved, merge to plan the result of merging the base branch into the pull request branch, or merge-ref to plan the merge commit GitHub or GitLab keeps for the pull request and fall back to the pull request branch if it has conflicts.",
+		value:       server.IgnoreMergeConflicts,
+	},
+	{
+		name:        planTimeoutFlag,
+		description: "How long terraform plan can run in a project before it's stopped and the project fails, ex. 30m. It's interrupted first so it can release the state lock. If not set, there's no timeout.",
+	},
+	{
+		name:        projectExcludesFlag,
+		description: "Comma-separated globs of files, or of directories if they end with a /, that are never part of a project, ex. modules/,**/*.tfstate. Set to an empty string to not exclude anything.",
+		value:       server.DefaultProjectExcludes,
+	},
+	{
+		name:        projectPatternFlag,
+		description: "Glob used to discover projects instead of treating every directory with modified .tf files as a project. If it ends with a / it matches project directories, ex. environments/*/, otherwise it matches files, ex. **/*.tf.",
+	},
+	{
+		name:        pullDataErrorCommentFlag,
+		description: "Comment posted instead of running a command if the pull request's details, ex. its branch or clone URL, couldn't be read from GitHub.",
+		value:       server.DefaultPullDataErrorComment,
+	},
+	{
+		name:        queueTimeoutFlag,
+		description: "How long a plan, apply, destroy or state rm waits for another command running in the same environment of the pull request to complete, ex. 30m. Waiting commands run in the order they were commented. If not set, they fail right away.",
+	},
+	{
+		name:        reactionFailureFlag,
+		description: "Reaction added to the comment that triggered a plan or apply if it fails. Set to an empty string to disable.",
+		value:       "-1",
+	},
+	{
+		name:        reactionQueuedFlag,
+		description: "Reaction added to the comment that triggered a plan or apply while it's waiting to run. Set to an empty string to disable.",
+		value:       "eyes",
+	},
+	{
+		name:        reactionRunningFlag,
+		description: "Reaction added to the comment that triggered a plan or apply while it's running. Set to an empty string to disable.",
+		value:       "eyes",
+	},
+	{
+		name:        reactionSuccessFlag,
+		description: "Reaction added to the comment that triggered a plan or apply if it succeeds. Set to an empty string to disable.",
+		value:       "+1",
+	},
+	{
+		name:        redactKeysFlag,
+		description: "Comma-separated regular expressions, ex. password,.*_token, matching the names of attributes and variables whose values are replaced with <redacted> in output and logs before they're commented. They must match the whole name and are case insensitive.",
+	},
+	{
+		name:        repoAllowlistFlag,
+		description: "Comma-separated repos, ex. hootsuite/atlantis, that Atlantis runs commands for. Patterns like hootsuite/* match every repo of an owner and github.com/hootsuite/* also matches the host. Commands for other repos are logged and ignored. " + server.AllowAllRepos + " allows every repo.",
+		value:       server.AllowAllRepos,
+	},
+	{
+		name:        repoSSHKeysFlag,
+		description: "Comma separated SSH private keys to use for specific repos instead of --" + sshKeyFlag + ", ex. github.com=/keys/github,owner/repo=/keys/repo,gitlab.com/owner/repo=/keys/mirror. Each repo is matched by host, full name, or both and the most specific match is used.",
+	},
+	{
+		name:        slowCommandThresholdFlag,
+		description: "How long a plan or apply can run before Atlantis comments that it's still running, ex. 10m. The comment is updated with the elapsed time every time this much longer passes and is replaced by the result. If not set, no progress comments are posted.",
+	},
+	{
+		name:        sshKeyFlag,
+		description: "Path of the SSH private key to clone repos over SSH with. If not set, the SSH config of the user Atlantis runs as is used.",
+	},
+	{
+		name:        stalePlanCommentFlag,
+		description: "Comment posted instead of applying if new commits were pushed to the pull request since it was planned.",
+		value:       server.DefaultStalePlanComment,
+	},
+	{
+		name:        statusContextFlag,
+		description: "Context of the commit statuses Atlantis sets, and the prefix of per-project statuses. Set it to tell apart the statuses of several Atlantis servers on the same repo, ex. Atlantis-staging and Atlantis-prod.",
+		value:       server.DefaultStatusContext,
+	},
+	{
+		name:        statusesFlag,
+		description: "Which commit statuses to set on pull requests. Either aggregate for one Atlantis status with the worst result of all projects, project for a status per project, ex. Atlantis/plan: path, or both.",
+		value:       server.AggregateStatuses,
+	},
+	{
+		name:        supersededCommentsFlag,
+		description: "What to do with previous plan and apply comments when a newer result for the same environment is posted. Either keep, delete, minimize, or edit to edit the latest one to be the new result instead of posting a new comment.",
+		value:       server.KeepSupersededComments,
+	},
+	{
+		name:        tfBinariesFlag,
+		description: "Comma-separated executables to run for versions of terraform, ex. 0.11.14=/opt/terraform/0.11.14/terraform. They're used for projects whose terraform_version is that version instead of looking for terraform{version} in $PATH.",
+	},
+	{
+		name:        tfDownloadURLFlag,
+		description: "Where to download versions of terraform from that are needed to satisfy a project's required_version when its terraform_version is auto. Set to an empty string to never download terraform.",
+		value:       terraform.DefaultDownloadURL,
+	},
+	{
+		name:        untrustedForksFlag,
+		description: "What to do with commands on pull requests from forks by users who aren't collaborators on the repo. Either allow, require-trust to only run them if a collaborator comments with --trust, or deny.",
+		value:       server.AllowUntrustedForks,
+	},
+	{
+		name:        webPasswordFlag,
+		description: "Password for basic auth on everything but the events endpoint. Requires --" + webUsernameFlag + ". Can also be specified via the ATLANTIS_WEB_PASSWORD environment variable.",
+		env:         "ATLANTIS_WEB_PASSWORD",
+	},
+	{
+		name:        webUsernameFlag,
+		description: "Username for basic auth on everything but the events endpoint. Requires --" + webPasswordFlag + ".",
+	},
 }
 var boolFlags = []boolFlag{
+	{
+		name:        acknowledgeCommandsFlag,
+		description: "Comment as soon as a plan or apply starts so users know it was received. The comment is replaced with the result once the command completes.",
+		value:       false,
+	},
+	{
+		name:        allowStateRmFlag,
+		description: "Allow atlantis state rm to remove resources from a project's state. It has the same approval requirements as apply. Without it, the command fails without running.",
+		value:       false,
+	},
+	{
+		name:        applyHintFlag,
+		description: "End the comment of a plan that succeeded in every project with the comment to apply it.",
+		value:       false,
+	},
+	{
+		name:        autoplanFlag,
+		description: "Plan pull requests automatically when they're opened, reopened or new commits are pushed to them, without a comment. Every environment of the modified projects is planned, like with --all-envs.",
+		value:       false,
+	},
+	{
+		name:        autoplanCommentOnSkipFlag,
+		description: "Comment on the pull request when an automatic plan is skipped because it didn't modify any Terraform files. By default these plans are skipped silently. Plans run with a comment always report this.",
+		value:       false,
+	},
+	{
+		name:        cloneSubmodulesFlag,
+		description: "Check out the git submodules of the pull request, and their submodules, after cloning it, ex. for modules vendored as submodules. Submodules are fetched with the pull request repo's SSH key, or with the --" + repoSSHKeysFlag + " key of their own repo if it has the same owner or is listed in --" + repoAllowlistFlag + ".",
+		value:       false,
+	},
+	{
+		name:        defaultVerboseFlag,
+		description: "Include the log of every command in its comment, as if it was commented with --verbose. A comment can leave it out with --verbose=false.",
+		value:       false,
+	},
+	{
+		name:        disableMetricsEnvLabelFlag,
+		description: "Leave the environment label off of metrics. Environments come from comments so anyone who can comment can add series.",
+		value:       false,
+	},
+	{
+		name:        disableMetricsRepoLabelFlag,
+		description: "Leave the repo label off of metrics so there aren't series for every repo, ex. when Atlantis runs for many repos.",
+		value:       false,
+	},
+	{
+		name:        disableReactionsFlag,
+		description: "Don't react to the comments that trigger commands, ex. for organizations that have turned off reactions. The --reaction-* flags are ignored.",
+		value:       false,
+	},
+	{
+		name:        dryRunFlag,
+		description: "Don't run commands. Instead comment what would have run and set a pending status, ex. to check that webhooks from a new repo reach Atlantis and their comments are parsed.",
+		value:       false,
+	},
+	{
+		name:        fmtCheckFlag,
+		description: "Run terraform fmt -check in each project before planning it and fail the project's plan with the diff if any files aren't formatted. Without it, a plan can run the check with atlantis plan --fmt-check.",
+		value:       false,
+	},
+	{
+		name:        maintenanceFlag,
+		description: "Start in maintenance mode where every command is rejected with a comment asking users to try again shortly. Can be toggled while running with PUT /api/maintenance if --" + apiTokenFlag + " is set.",
+		value:       false,
+	},
 	{
 		name:        requireApprovalFlag,
 		description: "Require pull requests to be \"Approved\" before allowing the apply command to be run.",
 		value:       false,
 	},
+	{
+		name:        requireCodeOwnersApprovalFlag,
+		description: "Require each project being applied to be \"Approved\" by at least one of the owners of its modified files, as defined in the repo's CODEOWNERS file.",
+		value:       false,
+	},
+	{
+		name:        requireConfiguredEnvsFlag,
+		description: "Require the environment being planned to have an env/{env}.tfvars file or an existing workspace instead of creating a new workspace for it.",
+		value:       false,
+	},
+	{
+		name:        statusFailureCommentFlag,
+		description: "Comment on the pull request if its status couldn't be updated, even after retrying, so users know it's out of date.",
+		value:       false,
+	},
 }
 var intFlags = []intFlag{
+	{
+		name:        cloneDepthFlag,
+		description: "How many commits of a pull request branch's history to clone. Speeds up cloning repos with a long history. 0 clones the full history.",
+		value:       0,
+	},
+	{
+		name:        commandQueueSizeFlag,
+		description: "How many commands can wait for one of the --" + commandWorkersFlag + ". Comments are rejected with a 503 while the queue is full.",
+		value:       100,
+	},
+	{
+		name:        commandWorkersFlag,
+		description: "How many commands can run at the same time. Commands start in the order they were commented and only commands for the same environment of a pull request wait for each other.",
+		value:       10,
+	},
+	{
+		name:        ghRetriesFlag,
+		description: "How many times to retry getting a pull request or commenting on it before running a command if GitHub returns a transient error, ex. a 5xx or rate limit. Retries back off exponentially starting at one second.",
+		value:       3,
+	},
+	{
+		name:        gistOutputThresholdFlag,
+		description: "Upload a project's plan, apply or destroy output as a secret gist if it's longer than this many characters and comment only its summary with a link. The gists are deleted when the pull request is closed. 0 never uploads output.",
+		value:       0,
+	},
+	{
+		name:        parallelAppliesFlag,
+		description: "How many projects can be applied at the same time by one apply. Projects are still applied after the projects in their depends_on.",
+		value:       1,
+	},
+	{
+		name:        parallelPlansFlag,
+		description: "How many projects can be planned at the same time by one plan.",
+		value:       4,
+	},
 	{
 		name:        portFlag,
 		description: "Port to bind to.",
 		value:       4141,
 	},
+	{
+		name:        statusRetriesFlag,
+		description: "How many times to retry updating a pull request's status if GitHub returns a transient error. Retries back off exponentially starting at one second.",
+		value:       3,
+	},
 }
 
 type stringFlag struct {
@@ -134,7 +536,7 @@ Config file values are overridden by environment variables which in turn are ove
 		sanitizeGithubUser(&config)
 
 		// config looks good, start the server
-		server, err := server.NewServer(config)
+		server, err := server.NewServer(config, buildInfo())
 		if err != nil {
 			return errors.Wrap(err, "initializing server")
 		}
@@ -178,15 +580,137 @@ func validate(config server.ServerConfig) error {
 	if logLevel != "debug" && logLevel != "info" && logLevel != "warn" && logLevel != "error" {
 		return errors.New("invalid log level: not one of debug, info, warn, error")
 	}
+	if config.LogFormat != "text" && config.LogFormat != "json" {
+		return fmt.Errorf("invalid --%s: not one of text, json", logFormatFlag)
+	}
 	if config.GithubUser == "" {
 		return fmt.Errorf("--%s must be set", ghUserFlag)
 	}
 	if config.GithubToken == "" {
 		return fmt.Errorf("--%s must be set", ghTokenFlag)
 	}
+	if config.BitbucketToken != "" {
+		if config.BitbucketUser == "" || config.BitbucketURL == "" {
+			return fmt.Errorf("--%s and --%s must be set with --%s", bitbucketUserFlag, bitbucketURLFlag, bitbucketTokenFlag)
+		}
+		if u, err := url.Parse(config.BitbucketURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid --%s: must be a URL, ex. https://bitbucket.example.com", bitbucketURLFlag)
+		}
+	}
+	if config.AdminTeam != "" && len(strings.SplitN(strings.TrimPrefix(config.AdminTeam, "@"), "/", 2)) != 2 {
+		return fmt.Errorf("invalid --%s: must be in the form org/team", adminTeamFlag)
+	}
+	if (config.WebUsername == "") != (config.WebPassword == "") {
+		return fmt.Errorf("--%s and --%s must be set together", webUsernameFlag, webPasswordFlag)
+	}
+	if _, err := server.NewOutputRedactor(config.RedactKeys); err != nil {
+		return fmt.Errorf("invalid --%s: %s", redactKeysFlag, err)
+	}
+	if _, err := server.NewAutoplan(config.Autoplan, config.AutoplanRepos); err != nil {
+		return fmt.Errorf("invalid --%s: %s", autoplanReposFlag, err)
+	}
+	if _, err := server.NewRepoAllowlist(config.RepoAllowlist); err != nil {
+		return fmt.Errorf("invalid --%s: %s", repoAllowlistFlag, err)
+	}
+	if _, err := server.ParseRepoSSHKeys(config.RepoSSHKeys); err != nil {
+		return fmt.Errorf("invalid --%s: %s", repoSSHKeysFlag, err)
+	}
+	if _, err := terraform.ParseBinaries(config.TFBinaries); err != nil {
+		return fmt.Errorf("invalid --%s: %s", tfBinariesFlag, err)
+	}
+	if config.SlowCommandThreshold != "" {
+		if d, err := time.ParseDuration(config.SlowCommandThreshold); err != nil || d <= 0 {
+			return fmt.Errorf("invalid --%s: must be a positive duration, ex. 10m", slowCommandThresholdFlag)
+		}
+	}
+	if config.LockTimeout != "" {
+		if d, err := time.ParseDuration(config.LockTimeout); err != nil || d < 0 {
+			return fmt.Errorf("invalid --%s: must be a duration, ex. 5m", lockTimeoutFlag)
+		}
+	}
+	if config.QueueTimeout != "" {
+		if d, err := time.ParseDuration(config.QueueTimeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid --%s: must be a positive duration, ex. 30m", queueTimeoutFlag)
+		}
+	}
+	if d, err := time.ParseDuration(config.DrainTimeout); err != nil || d <= 0 {
+		return fmt.Errorf("invalid --%s: must be a positive duration, ex. 10m", drainTimeoutFlag)
+	}
+	if config.PlanTimeout != "" {
+		if d, err := time.ParseDuration(config.PlanTimeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid --%s: must be a positive duration, ex. 30m", planTimeoutFlag)
+		}
+	}
+	if config.ApplyTimeout != "" {
+		if d, err := time.ParseDuration(config.ApplyTimeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid --%s: must be a positive duration, ex. 2h", applyTimeoutFlag)
+		}
+	}
+	if config.CloneDepth < 0 {
+		return fmt.Errorf("invalid --%s: can't be negative", cloneDepthFlag)
+	}
+	if config.CommandWorkers < 1 {
+		return fmt.Errorf("invalid --%s: must be a positive integer", commandWorkersFlag)
+	}
+	if config.CommandQueueSize < 0 {
+		return fmt.Errorf("invalid --%s: can't be negative", commandQueueSizeFlag)
+	}
+	if config.GistOutputThreshold < 0 {
+		return fmt.Errorf("invalid --%s: can't be negative", gistOutputThresholdFlag)
+	}
+	if config.ParallelApplies < 1 {
+		return fmt.Errorf("invalid --%s: must be a positive integer", parallelAppliesFlag)
+	}
+	if config.ParallelPlans < 1 {
+		return fmt.Errorf("invalid --%s: must be a positive integer", parallelPlansFlag)
+	}
+	if config.GithubRetries < 0 {
+		return fmt.Errorf("invalid --%s: can't be negative", ghRetriesFlag)
+	}
+	if config.StatusRetries < 0 {
+		return fmt.Errorf("invalid --%s: can't be negative", statusRetriesFlag)
+	}
+	if config.Statuses != server.AggregateStatuses && config.Statuses != server.ProjectStatuses && config.Statuses != server.AllStatuses {
+		return fmt.Errorf("invalid --%s: not one of %s, %s, %s", statusesFlag, server.AggregateStatuses, server.ProjectStatuses, server.AllStatuses)
+	}
+	mergeConflicts := config.MergeConflicts
+	if mergeConflicts != server.IgnoreMergeConflicts && mergeConflicts != server.FailOnMergeConflicts && mergeConflicts != server.MergeBaseBranch && mergeConflicts != server.UseMergeRef {
+		return fmt.Errorf("invalid --%s: not one of %s, %s, %s, %s", mergeConflictsFlag, server.IgnoreMergeConflicts, server.FailOnMergeConflicts, server.MergeBaseBranch, server.UseMergeRef)
+	}
+	untrustedForks := config.UntrustedForks
+	if untrustedForks != server.AllowUntrustedForks && untrustedForks != server.RequireTrustForUntrustedForks && untrustedForks != server.DenyUntrustedForks {
+		return fmt.Errorf("invalid --%s: not one of %s, %s, %s", untrustedForksFlag, server.AllowUntrustedForks, server.RequireTrustForUntrustedForks, server.DenyUntrustedForks)
+	}
+	if config.DefaultPlanScope != server.ChangedProjectsScope && config.DefaultPlanScope != server.AllProjectsScope {
+		return fmt.Errorf("invalid --%s: not one of %s, %s", defaultPlanScopeFlag, server.ChangedProjectsScope, server.AllProjectsScope)
+	}
+	superseded := config.SupersededComments
+	if superseded != server.KeepSupersededComments && superseded != server.DeleteSupersededComments && superseded != server.MinimizeSupersededComments && superseded != server.EditSupersededComments {
+		return fmt.Errorf("invalid --%s: not one of %s, %s, %s, %s", supersededCommentsFlag, server.KeepSupersededComments, server.DeleteSupersededComments, server.MinimizeSupersededComments, server.EditSupersededComments)
+	}
+	reactions := map[string]string{
+		reactionFailureFlag: config.ReactionFailure,
+		reactionQueuedFlag:  config.ReactionQueued,
+		reactionRunningFlag: config.ReactionRunning,
+		reactionSuccessFlag: config.ReactionSuccess,
+	}
+	for flag, reaction := range reactions {
+		if reaction != "" && !validReaction(reaction) {
+			return fmt.Errorf("invalid --%s: %q is not one of %s", flag, reaction, strings.Join(server.ValidReactions, ", "))
+		}
+	}
 	return nil
 }
 
+func validReaction(reaction string) bool {
+	for _, r := range server.ValidReactions {
+		if r == reaction {
+			return true
+		}
+	}
+	return false
+}
+
 // setAtlantisURL sets the externally accessible URL for atlantis.
 func setAtlantisURL(config *server.ServerConfig) error {
 	if config.AtlantisURL == "" {
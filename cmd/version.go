@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 
+	"github.com/hootsuite/atlantis/server"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -11,10 +12,24 @@ var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Print the current Atlantis version",
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Printf("atlantis %s\n", viper.Get("version"))
+		printVersion()
 	},
 }
 
+// buildInfo returns the version, commit and date that main set when this
+// binary was built.
+func buildInfo() server.BuildInfo {
+	return server.BuildInfo{
+		Version: viper.GetString("version"),
+		Commit:  viper.GetString("commit"),
+		Date:    viper.GetString("build-date"),
+	}
+}
+
+func printVersion() {
+	fmt.Printf("atlantis %s\n", buildInfo())
+}
+
 func init() {
 	RootCmd.AddCommand(versionCmd)
 }
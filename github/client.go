@@ -5,6 +5,7 @@ import (
 	"context"
 
 	"fmt"
+	"net/http"
 	"net/url"
 	"strings"
 
@@ -18,9 +19,40 @@ import (
 type Client interface {
 	GetModifiedFiles(repo models.Repo, pull models.PullRequest) ([]string, error)
 	CreateComment(repo models.Repo, pull models.PullRequest, comment string) error
+	CreateCommentWithID(repo models.Repo, pull models.PullRequest, comment string) (int, error)
+	EditComment(repo models.Repo, commentID int, comment string) error
 	PullIsApproved(repo models.Repo, pull models.PullRequest) (bool, error)
+	GetApprovers(repo models.Repo, pull models.PullRequest) ([]string, error)
+	GetTeamMembers(org string, teamSlug string) ([]string, error)
 	GetPullRequest(repo models.Repo, num int) (*github.PullRequest, *github.Response, error)
-	UpdateStatus(repo models.Repo, pull models.PullRequest, state string, description string, context string) error
+	UpdateStatus(repo models.Repo, pull models.PullRequest, state string, description string, targetURL string, context string) error
+	AddReaction(repo models.Repo, commentID int, content string) (int, error)
+	DeleteReaction(reactionID int) error
+	GetComments(repo models.Repo, pull models.PullRequest) ([]*github.IssueComment, error)
+	DeleteComment(repo models.Repo, commentID int) error
+	MinimizeComment(repo models.Repo, commentID int) error
+	AddLabel(repo models.Repo, pull models.PullRequest, label string) error
+	RemoveLabel(repo models.Repo, pull models.PullRequest, label string) error
+	IsCollaborator(repo models.Repo, user string) (bool, error)
+	RepoIsArchived(repo models.Repo) (bool, error)
+	GetFileContents(repo models.Repo, path string, ref string) (string, bool, error)
+	CreateGist(description string, filename string, content string) (string, error)
+	GetGists() ([]*github.Gist, error)
+	DeleteGist(id string) error
+}
+
+// IsTransientError returns true if err is likely to go away if the request is
+// retried, ex. because GitHub had an internal error or we were rate limited.
+// Other 4xx responses aren't transient since retrying won't change them.
+// Errors that aren't from the GitHub API, ex. timeouts, are also transient.
+func IsTransientError(err error) bool {
+	switch e := errors.Cause(err).(type) {
+	case *github.RateLimitError, *github.AbuseRateLimitError:
+		return true
+	case *github.ErrorResponse:
+		return e.Response != nil && (e.Response.StatusCode >= http.StatusInternalServerError || e.Response.StatusCode == http.StatusTooManyRequests)
+	}
+	return err != nil
 }
 
 // ConcreteClient is used to perform GitHub actions.
@@ -83,7 +115,23 @@ func (c *ConcreteClient) GetModifiedFiles(repo models.Repo, pull models.PullRequ
 
 // CreateComment creates a comment on the pull request.
 func (c *ConcreteClient) CreateComment(repo models.Repo, pull models.PullRequest, comment string) error {
-	_, _, err := c.client.Issues.CreateComment(c.ctx, repo.Owner, repo.Name, pull.Num, &github.IssueComment{Body: &comment})
+	_, err := c.CreateCommentWithID(repo, pull, comment)
+	return err
+}
+
+// CreateCommentWithID creates comment on the pull request and returns the
+// id of the new comment so it can be edited later.
+func (c *ConcreteClient) CreateCommentWithID(repo models.Repo, pull models.PullRequest, comment string) (int, error) {
+	created, _, err := c.client.Issues.CreateComment(c.ctx, repo.Owner, repo.Name, pull.Num, &github.IssueComment{Body: &comment})
+	if err != nil {
+		return 0, err
+	}
+	return created.GetID(), nil
+}
+
+// EditComment replaces the body of the comment with id commentID.
+func (c *ConcreteClient) EditComment(repo models.Repo, commentID int, comment string) error {
+	_, _, err := c.client.Issues.EditComment(c.ctx, repo.Owner, repo.Name, commentID, &github.IssueComment{Body: &comment})
 	return err
 }
 
@@ -101,6 +149,110 @@ func (c *ConcreteClient) PullIsApproved(repo models.Repo, pull models.PullReques
 	return false, nil
 }
 
+// GetApprovers returns the usernames of the users whose latest review of the
+// pull request is an approval.
+func (c *ConcreteClient) GetApprovers(repo models.Repo, pull models.PullRequest) ([]string, error) {
+	// reviews are returned in chronological order so a later review by the
+	// same user overrides their earlier one
+	latestStates := make(map[string]string)
+	var users []string
+	nextPage := 0
+	for {
+		opts := github.ListOptions{
+			PerPage: 100,
+		}
+		if nextPage != 0 {
+			opts.Page = nextPage
+		}
+		reviews, resp, err := c.client.PullRequests.ListReviews(c.ctx, repo.Owner, repo.Name, pull.Num, &opts)
+		if err != nil {
+			return nil, errors.Wrap(err, "getting reviews")
+		}
+		for _, review := range reviews {
+			// comments don't change whether a user has approved
+			if review == nil || review.GetState() == "COMMENTED" {
+				continue
+			}
+			login := review.User.GetLogin()
+			if _, ok := latestStates[login]; !ok {
+				users = append(users, login)
+			}
+			latestStates[login] = review.GetState()
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		nextPage = resp.NextPage
+	}
+
+	var approvers []string
+	for _, u := range users {
+		if latestStates[u] == "APPROVED" {
+			approvers = append(approvers, u)
+		}
+	}
+	return approvers, nil
+}
+
+// GetTeamMembers returns the usernames of the members of the team with slug
+// teamSlug in the org organization.
+func (c *ConcreteClient) GetTeamMembers(org string, teamSlug string) ([]string, error) {
+	// the API we have only supports looking up teams by id so first we need
+	// to find the team's id from its slug
+	var team *github.Team
+	nextPage := 0
+	for team == nil {
+		opts := github.ListOptions{
+			PerPage: 100,
+		}
+		if nextPage != 0 {
+			opts.Page = nextPage
+		}
+		teams, resp, err := c.client.Organizations.ListTeams(c.ctx, org, &opts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "listing teams in %s", org)
+		}
+		for _, t := range teams {
+			if strings.EqualFold(t.GetSlug(), teamSlug) {
+				team = t
+				break
+			}
+		}
+		if team != nil {
+			break
+		}
+		if resp.NextPage == 0 {
+			return nil, fmt.Errorf("team %s/%s not found", org, teamSlug)
+		}
+		nextPage = resp.NextPage
+	}
+
+	var members []string
+	nextPage = 0
+	for {
+		opts := github.OrganizationListTeamMembersOptions{
+			ListOptions: github.ListOptions{
+				PerPage: 100,
+			},
+		}
+		if nextPage != 0 {
+			opts.Page = nextPage
+		}
+		users, resp, err := c.client.Organizations.ListTeamMembers(c.ctx, team.GetID(), &opts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "listing members of team %s/%s", org, teamSlug)
+		}
+		for _, u := range users {
+			members = append(members, u.GetLogin())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		nextPage = resp.NextPage
+	}
+	return members, nil
+}
+
 // GetPullRequest returns the pull request.
 func (c *ConcreteClient) GetPullRequest(repo models.Repo, num int) (*github.PullRequest, *github.Response, error) {
 	return c.client.PullRequests.Get(c.ctx, repo.Owner, repo.Name, num)
@@ -108,11 +260,216 @@ func (c *ConcreteClient) GetPullRequest(repo models.Repo, num int) (*github.Pull
 
 // UpdateStatus updates the status badge on the pull request.
 // See https://github.com/blog/1227-commit-status-api.
-func (c *ConcreteClient) UpdateStatus(repo models.Repo, pull models.PullRequest, state string, description string, context string) error {
+// If targetURL is empty, the status doesn't link anywhere.
+func (c *ConcreteClient) UpdateStatus(repo models.Repo, pull models.PullRequest, state string, description string, targetURL string, context string) error {
 	status := &github.RepoStatus{
 		State:       github.String(state),
 		Description: github.String(description),
 		Context:     github.String(context)}
+	if targetURL != "" {
+		status.TargetURL = github.String(targetURL)
+	}
 	_, _, err := c.client.Repositories.CreateStatus(c.ctx, repo.Owner, repo.Name, pull.HeadCommit, status)
 	return err
 }
+
+// AddReaction reacts to the issue comment with id commentID using content,
+// ex. "+1" or "eyes". It returns the id of the new reaction.
+func (c *ConcreteClient) AddReaction(repo models.Repo, commentID int, content string) (int, error) {
+	reaction, _, err := c.client.Reactions.CreateIssueCommentReaction(c.ctx, repo.Owner, repo.Name, commentID, content)
+	if err != nil {
+		return 0, err
+	}
+	return reaction.GetID(), nil
+}
+
+// DeleteReaction deletes the reaction with id reactionID.
+func (c *ConcreteClient) DeleteReaction(reactionID int) error {
+	_, err := c.client.Reactions.DeleteReaction(c.ctx, reactionID)
+	return err
+}
+
+// GetComments returns all the comments on the pull request, oldest first.
+func (c *ConcreteClient) GetComments(repo models.Repo, pull models.PullRequest) ([]*github.IssueComment, error) {
+	var comments []*github.IssueComment
+	nextPage := 0
+	for {
+		opts := github.IssueListCommentsOptions{
+			ListOptions: github.ListOptions{
+				PerPage: 100,
+			},
+		}
+		if nextPage != 0 {
+			opts.Page = nextPage
+		}
+		pageComments, resp, err := c.client.Issues.ListComments(c.ctx, repo.Owner, repo.Name, pull.Num, &opts)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, pageComments...)
+		if resp.NextPage == 0 {
+			break
+		}
+		nextPage = resp.NextPage
+	}
+	return comments, nil
+}
+
+// DeleteComment deletes the issue comment with id commentID.
+func (c *ConcreteClient) DeleteComment(repo models.Repo, commentID int) error {
+	_, err := c.client.Issues.DeleteComment(c.ctx, repo.Owner, repo.Name, commentID)
+	return err
+}
+
+// MinimizeComment hides the issue comment with id commentID as outdated.
+// Hiding comments is only supported by the GraphQL API which identifies
+// comments by their node id so we first need to look that up.
+func (c *ConcreteClient) MinimizeComment(repo models.Repo, commentID int) error {
+	req, err := c.client.NewRequest("GET", fmt.Sprintf("repos/%s/%s/issues/comments/%d", repo.Owner, repo.Name, commentID), nil)
+	if err != nil {
+		return err
+	}
+	var comment struct {
+		NodeID string `json:"node_id"`
+	}
+	if _, err := c.client.Do(c.ctx, req, &comment); err != nil {
+		return errors.Wrap(err, "getting comment")
+	}
+	if comment.NodeID == "" {
+		return fmt.Errorf("comment %d has no node_id", commentID)
+	}
+
+	// the GraphQL endpoint is at /graphql on github.com and /api/graphql on
+	// GitHub Enterprise which are both one level up from the REST API's base
+	mutation := map[string]interface{}{
+		"query": `mutation($id: ID!) { minimizeComment(input: {subjectId: $id, classifier: OUTDATED}) { clientMutationId } }`,
+		"variables": map[string]string{
+			"id": comment.NodeID,
+		},
+	}
+	req, err = c.client.NewRequest("POST", "../graphql", mutation)
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if _, err := c.client.Do(c.ctx, req, &resp); err != nil {
+		return errors.Wrap(err, "minimizing comment")
+	}
+	if len(resp.Errors) > 0 {
+		return fmt.Errorf("minimizing comment: %s", resp.Errors[0].Message)
+	}
+	return nil
+}
+
+// AddLabel adds label to the pull request. The label is created if it doesn't
+// exist in the repo yet.
+func (c *ConcreteClient) AddLabel(repo models.Repo, pull models.PullRequest, label string) error {
+	_, _, err := c.client.Issues.AddLabelsToIssue(c.ctx, repo.Owner, repo.Name, pull.Num, []string{label})
+	return err
+}
+
+// RemoveLabel removes label from the pull request. It's not an error if the
+// pull request doesn't have the label.
+func (c *ConcreteClient) RemoveLabel(repo models.Repo, pull models.PullRequest, label string) error {
+	resp, err := c.client.Issues.RemoveLabelForIssue(c.ctx, repo.Owner, repo.Name, pull.Num, label)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+// IsCollaborator returns true if user is a collaborator on repo, which
+// includes members of the organization that can access the repo.
+func (c *ConcreteClient) IsCollaborator(repo models.Repo, user string) (bool, error) {
+	isCollaborator, _, err := c.client.Repositories.IsCollaborator(c.ctx, repo.Owner, repo.Name, user)
+	return isCollaborator, err
+}
+
+// CreateGist creates a secret gist with a single file named filename. It
+// returns the URL of the gist.
+func (c *ConcreteClient) CreateGist(description string, filename string, content string) (string, error) {
+	gist, _, err := c.client.Gists.Create(c.ctx, &github.Gist{
+		Description: github.String(description),
+		Public:      github.Bool(false),
+		Files: map[github.GistFilename]github.GistFile{
+			github.GistFilename(filename): {Content: github.String(content)},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return gist.GetHTMLURL(), nil
+}
+
+// GetGists returns all the gists of the user we're authenticated as,
+// including secret gists.
+func (c *ConcreteClient) GetGists() ([]*github.Gist, error) {
+	var gists []*github.Gist
+	nextPage := 0
+	for {
+		opts := github.GistListOptions{
+			ListOptions: github.ListOptions{
+				PerPage: 100,
+			},
+		}
+		if nextPage != 0 {
+			opts.Page = nextPage
+		}
+		pageGists, resp, err := c.client.Gists.List(c.ctx, "", &opts)
+		if err != nil {
+			return nil, err
+		}
+		gists = append(gists, pageGists...)
+		if resp.NextPage == 0 {
+			break
+		}
+		nextPage = resp.NextPage
+	}
+	return gists, nil
+}
+
+// DeleteGist deletes the gist with id.
+func (c *ConcreteClient) DeleteGist(id string) error {
+	_, err := c.client.Gists.Delete(c.ctx, id)
+	return err
+}
+
+// RepoIsArchived returns true if repo has been archived, which makes it read
+// only. The version of go-github we use doesn't decode the archived field so
+// we request the repo ourselves.
+func (c *ConcreteClient) RepoIsArchived(repo models.Repo) (bool, error) {
+	req, err := c.client.NewRequest("GET", fmt.Sprintf("repos/%s/%s", repo.Owner, repo.Name), nil)
+	if err != nil {
+		return false, err
+	}
+	var r struct {
+		Archived bool `json:"archived"`
+	}
+	if _, err := c.client.Do(c.ctx, req, &r); err != nil {
+		return false, err
+	}
+	return r.Archived, nil
+}
+
+// GetFileContents returns the contents of the file at path in repo as of ref,
+// which can be a branch, tag or commit. The bool returned is false if there's
+// no file at path.
+func (c *ConcreteClient) GetFileContents(repo models.Repo, path string, ref string) (string, bool, error) {
+	file, _, resp, err := c.client.Repositories.GetContents(c.ctx, repo.Owner, repo.Name, path, &github.RepositoryContentGetOptions{Ref: ref})
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if file == nil {
+		// path is a directory
+		return "", false, nil
+	}
+	contents, err := file.GetContent()
+	return contents, err == nil, err
+}
@@ -10,6 +10,7 @@ var Pull = github.PullRequest{
 	},
 	Base: &github.PullRequestBranch{
 		SHA: github.String("sha256"),
+		Ref: github.String("base-ref"),
 	},
 	HTMLURL: github.String("html-url"),
 	User: &github.User{
@@ -46,6 +46,34 @@ func (mock *MockClient) CreateComment(repo models.Repo, pull models.PullRequest,
 	return ret0
 }
 
+func (mock *MockClient) CreateCommentWithID(repo models.Repo, pull models.PullRequest, comment string) (int, error) {
+	params := []pegomock.Param{repo, pull, comment}
+	result := pegomock.GetGenericMockFrom(mock).Invoke("CreateCommentWithID", params, []reflect.Type{reflect.TypeOf((*int)(nil)).Elem(), reflect.TypeOf((*error)(nil)).Elem()})
+	var ret0 int
+	var ret1 error
+	if len(result) != 0 {
+		if result[0] != nil {
+			ret0 = result[0].(int)
+		}
+		if result[1] != nil {
+			ret1 = result[1].(error)
+		}
+	}
+	return ret0, ret1
+}
+
+func (mock *MockClient) EditComment(repo models.Repo, commentID int, comment string) error {
+	params := []pegomock.Param{repo, commentID, comment}
+	result := pegomock.GetGenericMockFrom(mock).Invoke("EditComment", params, []reflect.Type{reflect.TypeOf((*error)(nil)).Elem()})
+	var ret0 error
+	if len(result) != 0 {
+		if result[0] != nil {
+			ret0 = result[0].(error)
+		}
+	}
+	return ret0
+}
+
 func (mock *MockClient) PullIsApproved(repo models.Repo, pull models.PullRequest) (bool, error) {
 	params := []pegomock.Param{repo, pull}
 	result := pegomock.GetGenericMockFrom(mock).Invoke("PullIsApproved", params, []reflect.Type{reflect.TypeOf((*bool)(nil)).Elem(), reflect.TypeOf((*error)(nil)).Elem()})
@@ -62,6 +90,38 @@ func (mock *MockClient) PullIsApproved(repo models.Repo, pull models.PullRequest
 	return ret0, ret1
 }
 
+func (mock *MockClient) GetApprovers(repo models.Repo, pull models.PullRequest) ([]string, error) {
+	params := []pegomock.Param{repo, pull}
+	result := pegomock.GetGenericMockFrom(mock).Invoke("GetApprovers", params, []reflect.Type{reflect.TypeOf((*[]string)(nil)).Elem(), reflect.TypeOf((*error)(nil)).Elem()})
+	var ret0 []string
+	var ret1 error
+	if len(result) != 0 {
+		if result[0] != nil {
+			ret0 = result[0].([]string)
+		}
+		if result[1] != nil {
+			ret1 = result[1].(error)
+		}
+	}
+	return ret0, ret1
+}
+
+func (mock *MockClient) GetTeamMembers(org string, teamSlug string) ([]string, error) {
+	params := []pegomock.Param{org, teamSlug}
+	result := pegomock.GetGenericMockFrom(mock).Invoke("GetTeamMembers", params, []reflect.Type{reflect.TypeOf((*[]string)(nil)).Elem(), reflect.TypeOf((*error)(nil)).Elem()})
+	var ret0 []string
+	var ret1 error
+	if len(result) != 0 {
+		if result[0] != nil {
+			ret0 = result[0].([]string)
+		}
+		if result[1] != nil {
+			ret1 = result[1].(error)
+		}
+	}
+	return ret0, ret1
+}
+
 func (mock *MockClient) GetPullRequest(repo models.Repo, num int) (*github.PullRequest, *github.Response, error) {
 	params := []pegomock.Param{repo, num}
 	result := pegomock.GetGenericMockFrom(mock).Invoke("GetPullRequest", params, []reflect.Type{reflect.TypeOf((**github.PullRequest)(nil)).Elem(), reflect.TypeOf((**github.Response)(nil)).Elem(), reflect.TypeOf((*error)(nil)).Elem()})
@@ -82,8 +142,8 @@ func (mock *MockClient) GetPullRequest(repo models.Repo, num int) (*github.PullR
 	return ret0, ret1, ret2
 }
 
-func (mock *MockClient) UpdateStatus(repo models.Repo, pull models.PullRequest, state string, description string, context string) error {
-	params := []pegomock.Param{repo, pull, state, description, context}
+func (mock *MockClient) UpdateStatus(repo models.Repo, pull models.PullRequest, state string, description string, targetURL string, context string) error {
+	params := []pegomock.Param{repo, pull, state, description, targetURL, context}
 	result := pegomock.GetGenericMockFrom(mock).Invoke("UpdateStatus", params, []reflect.Type{reflect.TypeOf((*error)(nil)).Elem()})
 	var ret0 error
 	if len(result) != 0 {
@@ -94,6 +154,194 @@ func (mock *MockClient) UpdateStatus(repo models.Repo, pull models.PullRequest,
 	return ret0
 }
 
+func (mock *MockClient) AddReaction(repo models.Repo, commentID int, content string) (int, error) {
+	params := []pegomock.Param{repo, commentID, content}
+	result := pegomock.GetGenericMockFrom(mock).Invoke("AddReaction", params, []reflect.Type{reflect.TypeOf((*int)(nil)).Elem(), reflect.TypeOf((*error)(nil)).Elem()})
+	var ret0 int
+	var ret1 error
+	if len(result) != 0 {
+		if result[0] != nil {
+			ret0 = result[0].(int)
+		}
+		if result[1] != nil {
+			ret1 = result[1].(error)
+		}
+	}
+	return ret0, ret1
+}
+
+func (mock *MockClient) DeleteReaction(reactionID int) error {
+	params := []pegomock.Param{reactionID}
+	result := pegomock.GetGenericMockFrom(mock).Invoke("DeleteReaction", params, []reflect.Type{reflect.TypeOf((*error)(nil)).Elem()})
+	var ret0 error
+	if len(result) != 0 {
+		if result[0] != nil {
+			ret0 = result[0].(error)
+		}
+	}
+	return ret0
+}
+
+func (mock *MockClient) GetComments(repo models.Repo, pull models.PullRequest) ([]*github.IssueComment, error) {
+	params := []pegomock.Param{repo, pull}
+	result := pegomock.GetGenericMockFrom(mock).Invoke("GetComments", params, []reflect.Type{reflect.TypeOf((*[]*github.IssueComment)(nil)).Elem(), reflect.TypeOf((*error)(nil)).Elem()})
+	var ret0 []*github.IssueComment
+	var ret1 error
+	if len(result) != 0 {
+		if result[0] != nil {
+			ret0 = result[0].([]*github.IssueComment)
+		}
+		if result[1] != nil {
+			ret1 = result[1].(error)
+		}
+	}
+	return ret0, ret1
+}
+
+func (mock *MockClient) DeleteComment(repo models.Repo, commentID int) error {
+	params := []pegomock.Param{repo, commentID}
+	result := pegomock.GetGenericMockFrom(mock).Invoke("DeleteComment", params, []reflect.Type{reflect.TypeOf((*error)(nil)).Elem()})
+	var ret0 error
+	if len(result) != 0 {
+		if result[0] != nil {
+			ret0 = result[0].(error)
+		}
+	}
+	return ret0
+}
+
+func (mock *MockClient) MinimizeComment(repo models.Repo, commentID int) error {
+	params := []pegomock.Param{repo, commentID}
+	result := pegomock.GetGenericMockFrom(mock).Invoke("MinimizeComment", params, []reflect.Type{reflect.TypeOf((*error)(nil)).Elem()})
+	var ret0 error
+	if len(result) != 0 {
+		if result[0] != nil {
+			ret0 = result[0].(error)
+		}
+	}
+	return ret0
+}
+
+func (mock *MockClient) AddLabel(repo models.Repo, pull models.PullRequest, label string) error {
+	params := []pegomock.Param{repo, pull, label}
+	result := pegomock.GetGenericMockFrom(mock).Invoke("AddLabel", params, []reflect.Type{reflect.TypeOf((*error)(nil)).Elem()})
+	var ret0 error
+	if len(result) != 0 {
+		if result[0] != nil {
+			ret0 = result[0].(error)
+		}
+	}
+	return ret0
+}
+
+func (mock *MockClient) RemoveLabel(repo models.Repo, pull models.PullRequest, label string) error {
+	params := []pegomock.Param{repo, pull, label}
+	result := pegomock.GetGenericMockFrom(mock).Invoke("RemoveLabel", params, []reflect.Type{reflect.TypeOf((*error)(nil)).Elem()})
+	var ret0 error
+	if len(result) != 0 {
+		if result[0] != nil {
+			ret0 = result[0].(error)
+		}
+	}
+	return ret0
+}
+
+func (mock *MockClient) IsCollaborator(repo models.Repo, user string) (bool, error) {
+	params := []pegomock.Param{repo, user}
+	result := pegomock.GetGenericMockFrom(mock).Invoke("IsCollaborator", params, []reflect.Type{reflect.TypeOf((*bool)(nil)).Elem(), reflect.TypeOf((*error)(nil)).Elem()})
+	var ret0 bool
+	var ret1 error
+	if len(result) != 0 {
+		if result[0] != nil {
+			ret0 = result[0].(bool)
+		}
+		if result[1] != nil {
+			ret1 = result[1].(error)
+		}
+	}
+	return ret0, ret1
+}
+
+func (mock *MockClient) RepoIsArchived(repo models.Repo) (bool, error) {
+	params := []pegomock.Param{repo}
+	result := pegomock.GetGenericMockFrom(mock).Invoke("RepoIsArchived", params, []reflect.Type{reflect.TypeOf((*bool)(nil)).Elem(), reflect.TypeOf((*error)(nil)).Elem()})
+	var ret0 bool
+	var ret1 error
+	if len(result) != 0 {
+		if result[0] != nil {
+			ret0 = result[0].(bool)
+		}
+		if result[1] != nil {
+			ret1 = result[1].(error)
+		}
+	}
+	return ret0, ret1
+}
+
+func (mock *MockClient) GetFileContents(repo models.Repo, path string, ref string) (string, bool, error) {
+	params := []pegomock.Param{repo, path, ref}
+	result := pegomock.GetGenericMockFrom(mock).Invoke("GetFileContents", params, []reflect.Type{reflect.TypeOf((*string)(nil)).Elem(), reflect.TypeOf((*bool)(nil)).Elem(), reflect.TypeOf((*error)(nil)).Elem()})
+	var ret0 string
+	var ret1 bool
+	var ret2 error
+	if len(result) != 0 {
+		if result[0] != nil {
+			ret0 = result[0].(string)
+		}
+		if result[1] != nil {
+			ret1 = result[1].(bool)
+		}
+		if result[2] != nil {
+			ret2 = result[2].(error)
+		}
+	}
+	return ret0, ret1, ret2
+}
+
+func (mock *MockClient) CreateGist(description string, filename string, content string) (string, error) {
+	params := []pegomock.Param{description, filename, content}
+	result := pegomock.GetGenericMockFrom(mock).Invoke("CreateGist", params, []reflect.Type{reflect.TypeOf((*string)(nil)).Elem(), reflect.TypeOf((*error)(nil)).Elem()})
+	var ret0 string
+	var ret1 error
+	if len(result) != 0 {
+		if result[0] != nil {
+			ret0 = result[0].(string)
+		}
+		if result[1] != nil {
+			ret1 = result[1].(error)
+		}
+	}
+	return ret0, ret1
+}
+
+func (mock *MockClient) GetGists() ([]*github.Gist, error) {
+	params := []pegomock.Param{}
+	result := pegomock.GetGenericMockFrom(mock).Invoke("GetGists", params, []reflect.Type{reflect.TypeOf((*[]*github.Gist)(nil)).Elem(), reflect.TypeOf((*error)(nil)).Elem()})
+	var ret0 []*github.Gist
+	var ret1 error
+	if len(result) != 0 {
+		if result[0] != nil {
+			ret0 = result[0].([]*github.Gist)
+		}
+		if result[1] != nil {
+			ret1 = result[1].(error)
+		}
+	}
+	return ret0, ret1
+}
+
+func (mock *MockClient) DeleteGist(id string) error {
+	params := []pegomock.Param{id}
+	result := pegomock.GetGenericMockFrom(mock).Invoke("DeleteGist", params, []reflect.Type{reflect.TypeOf((*error)(nil)).Elem()})
+	var ret0 error
+	if len(result) != 0 {
+		if result[0] != nil {
+			ret0 = result[0].(error)
+		}
+	}
+	return ret0
+}
+
 func (mock *MockClient) VerifyWasCalledOnce() *VerifierClient {
 	return &VerifierClient{mock, pegomock.Times(1), nil}
 }
@@ -178,23 +426,23 @@ func (c *Client_CreateComment_OngoingVerification) GetAllCapturedArguments() (_p
 	return
 }
 
-func (verifier *VerifierClient) PullIsApproved(repo models.Repo, pull models.PullRequest) *Client_PullIsApproved_OngoingVerification {
-	params := []pegomock.Param{repo, pull}
-	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "PullIsApproved", params)
-	return &Client_PullIsApproved_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
+func (verifier *VerifierClient) CreateCommentWithID(repo models.Repo, pull models.PullRequest, comment string) *Client_CreateCommentWithID_OngoingVerification {
+	params := []pegomock.Param{repo, pull, comment}
+	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "CreateCommentWithID", params)
+	return &Client_CreateCommentWithID_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
 }
 
-type Client_PullIsApproved_OngoingVerification struct {
+type Client_CreateCommentWithID_OngoingVerification struct {
 	mock              *MockClient
 	methodInvocations []pegomock.MethodInvocation
 }
 
-func (c *Client_PullIsApproved_OngoingVerification) GetCapturedArguments() (models.Repo, models.PullRequest) {
-	repo, pull := c.GetAllCapturedArguments()
-	return repo[len(repo)-1], pull[len(pull)-1]
+func (c *Client_CreateCommentWithID_OngoingVerification) GetCapturedArguments() (models.Repo, models.PullRequest, string) {
+	repo, pull, comment := c.GetAllCapturedArguments()
+	return repo[len(repo)-1], pull[len(pull)-1], comment[len(comment)-1]
 }
 
-func (c *Client_PullIsApproved_OngoingVerification) GetAllCapturedArguments() (_param0 []models.Repo, _param1 []models.PullRequest) {
+func (c *Client_CreateCommentWithID_OngoingVerification) GetAllCapturedArguments() (_param0 []models.Repo, _param1 []models.PullRequest, _param2 []string) {
 	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
 	if len(params) > 0 {
 		_param0 = make([]models.Repo, len(params[0]))
@@ -205,27 +453,31 @@ func (c *Client_PullIsApproved_OngoingVerification) GetAllCapturedArguments() (_
 		for u, param := range params[1] {
 			_param1[u] = param.(models.PullRequest)
 		}
+		_param2 = make([]string, len(params[2]))
+		for u, param := range params[2] {
+			_param2[u] = param.(string)
+		}
 	}
 	return
 }
 
-func (verifier *VerifierClient) GetPullRequest(repo models.Repo, num int) *Client_GetPullRequest_OngoingVerification {
-	params := []pegomock.Param{repo, num}
-	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "GetPullRequest", params)
-	return &Client_GetPullRequest_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
+func (verifier *VerifierClient) EditComment(repo models.Repo, commentID int, comment string) *Client_EditComment_OngoingVerification {
+	params := []pegomock.Param{repo, commentID, comment}
+	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "EditComment", params)
+	return &Client_EditComment_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
 }
 
-type Client_GetPullRequest_OngoingVerification struct {
+type Client_EditComment_OngoingVerification struct {
 	mock              *MockClient
 	methodInvocations []pegomock.MethodInvocation
 }
 
-func (c *Client_GetPullRequest_OngoingVerification) GetCapturedArguments() (models.Repo, int) {
-	repo, num := c.GetAllCapturedArguments()
-	return repo[len(repo)-1], num[len(num)-1]
+func (c *Client_EditComment_OngoingVerification) GetCapturedArguments() (models.Repo, int, string) {
+	repo, commentID, comment := c.GetAllCapturedArguments()
+	return repo[len(repo)-1], commentID[len(commentID)-1], comment[len(comment)-1]
 }
 
-func (c *Client_GetPullRequest_OngoingVerification) GetAllCapturedArguments() (_param0 []models.Repo, _param1 []int) {
+func (c *Client_EditComment_OngoingVerification) GetAllCapturedArguments() (_param0 []models.Repo, _param1 []int, _param2 []string) {
 	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
 	if len(params) > 0 {
 		_param0 = make([]models.Repo, len(params[0]))
@@ -236,27 +488,31 @@ func (c *Client_GetPullRequest_OngoingVerification) GetAllCapturedArguments() (_
 		for u, param := range params[1] {
 			_param1[u] = param.(int)
 		}
+		_param2 = make([]string, len(params[2]))
+		for u, param := range params[2] {
+			_param2[u] = param.(string)
+		}
 	}
 	return
 }
 
-func (verifier *VerifierClient) UpdateStatus(repo models.Repo, pull models.PullRequest, state string, description string, context string) *Client_UpdateStatus_OngoingVerification {
-	params := []pegomock.Param{repo, pull, state, description, context}
-	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "UpdateStatus", params)
-	return &Client_UpdateStatus_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
+func (verifier *VerifierClient) PullIsApproved(repo models.Repo, pull models.PullRequest) *Client_PullIsApproved_OngoingVerification {
+	params := []pegomock.Param{repo, pull}
+	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "PullIsApproved", params)
+	return &Client_PullIsApproved_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
 }
 
-type Client_UpdateStatus_OngoingVerification struct {
+type Client_PullIsApproved_OngoingVerification struct {
 	mock              *MockClient
 	methodInvocations []pegomock.MethodInvocation
 }
 
-func (c *Client_UpdateStatus_OngoingVerification) GetCapturedArguments() (models.Repo, models.PullRequest, string, string, string) {
-	repo, pull, state, description, context := c.GetAllCapturedArguments()
-	return repo[len(repo)-1], pull[len(pull)-1], state[len(state)-1], description[len(description)-1], context[len(context)-1]
+func (c *Client_PullIsApproved_OngoingVerification) GetCapturedArguments() (models.Repo, models.PullRequest) {
+	repo, pull := c.GetAllCapturedArguments()
+	return repo[len(repo)-1], pull[len(pull)-1]
 }
 
-func (c *Client_UpdateStatus_OngoingVerification) GetAllCapturedArguments() (_param0 []models.Repo, _param1 []models.PullRequest, _param2 []string, _param3 []string, _param4 []string) {
+func (c *Client_PullIsApproved_OngoingVerification) GetAllCapturedArguments() (_param0 []models.Repo, _param1 []models.PullRequest) {
 	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
 	if len(params) > 0 {
 		_param0 = make([]models.Repo, len(params[0]))
@@ -267,18 +523,543 @@ func (c *Client_UpdateStatus_OngoingVerification) GetAllCapturedArguments() (_pa
 		for u, param := range params[1] {
 			_param1[u] = param.(models.PullRequest)
 		}
-		_param2 = make([]string, len(params[2]))
-		for u, param := range params[2] {
-			_param2[u] = param.(string)
+	}
+	return
+}
+
+func (verifier *VerifierClient) GetApprovers(repo models.Repo, pull models.PullRequest) *Client_GetApprovers_OngoingVerification {
+	params := []pegomock.Param{repo, pull}
+	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "GetApprovers", params)
+	return &Client_GetApprovers_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
+}
+
+type Client_GetApprovers_OngoingVerification struct {
+	mock              *MockClient
+	methodInvocations []pegomock.MethodInvocation
+}
+
+func (c *Client_GetApprovers_OngoingVerification) GetCapturedArguments() (models.Repo, models.PullRequest) {
+	repo, pull := c.GetAllCapturedArguments()
+	return repo[len(repo)-1], pull[len(pull)-1]
+}
+
+func (c *Client_GetApprovers_OngoingVerification) GetAllCapturedArguments() (_param0 []models.Repo, _param1 []models.PullRequest) {
+	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
+	if len(params) > 0 {
+		_param0 = make([]models.Repo, len(params[0]))
+		for u, param := range params[0] {
+			_param0[u] = param.(models.Repo)
 		}
-		_param3 = make([]string, len(params[3]))
-		for u, param := range params[3] {
-			_param3[u] = param.(string)
+		_param1 = make([]models.PullRequest, len(params[1]))
+		for u, param := range params[1] {
+			_param1[u] = param.(models.PullRequest)
+		}
+	}
+	return
+}
+
+func (verifier *VerifierClient) GetTeamMembers(org string, teamSlug string) *Client_GetTeamMembers_OngoingVerification {
+	params := []pegomock.Param{org, teamSlug}
+	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "GetTeamMembers", params)
+	return &Client_GetTeamMembers_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
+}
+
+type Client_GetTeamMembers_OngoingVerification struct {
+	mock              *MockClient
+	methodInvocations []pegomock.MethodInvocation
+}
+
+func (c *Client_GetTeamMembers_OngoingVerification) GetCapturedArguments() (string, string) {
+	org, teamSlug := c.GetAllCapturedArguments()
+	return org[len(org)-1], teamSlug[len(teamSlug)-1]
+}
+
+func (c *Client_GetTeamMembers_OngoingVerification) GetAllCapturedArguments() (_param0 []string, _param1 []string) {
+	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
+	if len(params) > 0 {
+		_param0 = make([]string, len(params[0]))
+		for u, param := range params[0] {
+			_param0[u] = param.(string)
+		}
+		_param1 = make([]string, len(params[1]))
+		for u, param := range params[1] {
+			_param1[u] = param.(string)
+		}
+	}
+	return
+}
+
+func (verifier *VerifierClient) GetPullRequest(repo models.Repo, num int) *Client_GetPullRequest_OngoingVerification {
+	params := []pegomock.Param{repo, num}
+	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "GetPullRequest", params)
+	return &Client_GetPullRequest_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
+}
+
+type Client_GetPullRequest_OngoingVerification struct {
+	mock              *MockClient
+	methodInvocations []pegomock.MethodInvocation
+}
+
+func (c *Client_GetPullRequest_OngoingVerification) GetCapturedArguments() (models.Repo, int) {
+	repo, num := c.GetAllCapturedArguments()
+	return repo[len(repo)-1], num[len(num)-1]
+}
+
+func (c *Client_GetPullRequest_OngoingVerification) GetAllCapturedArguments() (_param0 []models.Repo, _param1 []int) {
+	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
+	if len(params) > 0 {
+		_param0 = make([]models.Repo, len(params[0]))
+		for u, param := range params[0] {
+			_param0[u] = param.(models.Repo)
+		}
+		_param1 = make([]int, len(params[1]))
+		for u, param := range params[1] {
+			_param1[u] = param.(int)
+		}
+	}
+	return
+}
+
+func (verifier *VerifierClient) UpdateStatus(repo models.Repo, pull models.PullRequest, state string, description string, targetURL string, context string) *Client_UpdateStatus_OngoingVerification {
+	params := []pegomock.Param{repo, pull, state, description, targetURL, context}
+	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "UpdateStatus", params)
+	return &Client_UpdateStatus_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
+}
+
+type Client_UpdateStatus_OngoingVerification struct {
+	mock              *MockClient
+	methodInvocations []pegomock.MethodInvocation
+}
+
+func (c *Client_UpdateStatus_OngoingVerification) GetCapturedArguments() (models.Repo, models.PullRequest, string, string, string, string) {
+	repo, pull, state, description, targetURL, context := c.GetAllCapturedArguments()
+	return repo[len(repo)-1], pull[len(pull)-1], state[len(state)-1], description[len(description)-1], targetURL[len(targetURL)-1], context[len(context)-1]
+}
+
+func (c *Client_UpdateStatus_OngoingVerification) GetAllCapturedArguments() (_param0 []models.Repo, _param1 []models.PullRequest, _param2 []string, _param3 []string, _param4 []string, _param5 []string) {
+	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
+	if len(params) > 0 {
+		_param0 = make([]models.Repo, len(params[0]))
+		for u, param := range params[0] {
+			_param0[u] = param.(models.Repo)
+		}
+		_param1 = make([]models.PullRequest, len(params[1]))
+		for u, param := range params[1] {
+			_param1[u] = param.(models.PullRequest)
+		}
+		_param2 = make([]string, len(params[2]))
+		for u, param := range params[2] {
+			_param2[u] = param.(string)
+		}
+		_param3 = make([]string, len(params[3]))
+		for u, param := range params[3] {
+			_param3[u] = param.(string)
 		}
 		_param4 = make([]string, len(params[4]))
 		for u, param := range params[4] {
 			_param4[u] = param.(string)
 		}
+		_param5 = make([]string, len(params[5]))
+		for u, param := range params[5] {
+			_param5[u] = param.(string)
+		}
+	}
+	return
+}
+
+func (verifier *VerifierClient) AddReaction(repo models.Repo, commentID int, content string) *Client_AddReaction_OngoingVerification {
+	params := []pegomock.Param{repo, commentID, content}
+	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "AddReaction", params)
+	return &Client_AddReaction_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
+}
+
+type Client_AddReaction_OngoingVerification struct {
+	mock              *MockClient
+	methodInvocations []pegomock.MethodInvocation
+}
+
+func (c *Client_AddReaction_OngoingVerification) GetCapturedArguments() (models.Repo, int, string) {
+	repo, commentID, content := c.GetAllCapturedArguments()
+	return repo[len(repo)-1], commentID[len(commentID)-1], content[len(content)-1]
+}
+
+func (c *Client_AddReaction_OngoingVerification) GetAllCapturedArguments() (_param0 []models.Repo, _param1 []int, _param2 []string) {
+	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
+	if len(params) > 0 {
+		_param0 = make([]models.Repo, len(params[0]))
+		for u, param := range params[0] {
+			_param0[u] = param.(models.Repo)
+		}
+		_param1 = make([]int, len(params[1]))
+		for u, param := range params[1] {
+			_param1[u] = param.(int)
+		}
+		_param2 = make([]string, len(params[2]))
+		for u, param := range params[2] {
+			_param2[u] = param.(string)
+		}
+	}
+	return
+}
+
+func (verifier *VerifierClient) DeleteReaction(reactionID int) *Client_DeleteReaction_OngoingVerification {
+	params := []pegomock.Param{reactionID}
+	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "DeleteReaction", params)
+	return &Client_DeleteReaction_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
+}
+
+type Client_DeleteReaction_OngoingVerification struct {
+	mock              *MockClient
+	methodInvocations []pegomock.MethodInvocation
+}
+
+func (c *Client_DeleteReaction_OngoingVerification) GetCapturedArguments() int {
+	reactionID := c.GetAllCapturedArguments()
+	return reactionID[len(reactionID)-1]
+}
+
+func (c *Client_DeleteReaction_OngoingVerification) GetAllCapturedArguments() (_param0 []int) {
+	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
+	if len(params) > 0 {
+		_param0 = make([]int, len(params[0]))
+		for u, param := range params[0] {
+			_param0[u] = param.(int)
+		}
+	}
+	return
+}
+
+func (verifier *VerifierClient) GetComments(repo models.Repo, pull models.PullRequest) *Client_GetComments_OngoingVerification {
+	params := []pegomock.Param{repo, pull}
+	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "GetComments", params)
+	return &Client_GetComments_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
+}
+
+type Client_GetComments_OngoingVerification struct {
+	mock              *MockClient
+	methodInvocations []pegomock.MethodInvocation
+}
+
+func (c *Client_GetComments_OngoingVerification) GetCapturedArguments() (models.Repo, models.PullRequest) {
+	repo, pull := c.GetAllCapturedArguments()
+	return repo[len(repo)-1], pull[len(pull)-1]
+}
+
+func (c *Client_GetComments_OngoingVerification) GetAllCapturedArguments() (_param0 []models.Repo, _param1 []models.PullRequest) {
+	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
+	if len(params) > 0 {
+		_param0 = make([]models.Repo, len(params[0]))
+		for u, param := range params[0] {
+			_param0[u] = param.(models.Repo)
+		}
+		_param1 = make([]models.PullRequest, len(params[1]))
+		for u, param := range params[1] {
+			_param1[u] = param.(models.PullRequest)
+		}
+	}
+	return
+}
+
+func (verifier *VerifierClient) DeleteComment(repo models.Repo, commentID int) *Client_DeleteComment_OngoingVerification {
+	params := []pegomock.Param{repo, commentID}
+	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "DeleteComment", params)
+	return &Client_DeleteComment_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
+}
+
+type Client_DeleteComment_OngoingVerification struct {
+	mock              *MockClient
+	methodInvocations []pegomock.MethodInvocation
+}
+
+func (c *Client_DeleteComment_OngoingVerification) GetCapturedArguments() (models.Repo, int) {
+	repo, commentID := c.GetAllCapturedArguments()
+	return repo[len(repo)-1], commentID[len(commentID)-1]
+}
+
+func (c *Client_DeleteComment_OngoingVerification) GetAllCapturedArguments() (_param0 []models.Repo, _param1 []int) {
+	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
+	if len(params) > 0 {
+		_param0 = make([]models.Repo, len(params[0]))
+		for u, param := range params[0] {
+			_param0[u] = param.(models.Repo)
+		}
+		_param1 = make([]int, len(params[1]))
+		for u, param := range params[1] {
+			_param1[u] = param.(int)
+		}
+	}
+	return
+}
+
+func (verifier *VerifierClient) MinimizeComment(repo models.Repo, commentID int) *Client_MinimizeComment_OngoingVerification {
+	params := []pegomock.Param{repo, commentID}
+	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "MinimizeComment", params)
+	return &Client_MinimizeComment_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
+}
+
+type Client_MinimizeComment_OngoingVerification struct {
+	mock              *MockClient
+	methodInvocations []pegomock.MethodInvocation
+}
+
+func (c *Client_MinimizeComment_OngoingVerification) GetCapturedArguments() (models.Repo, int) {
+	repo, commentID := c.GetAllCapturedArguments()
+	return repo[len(repo)-1], commentID[len(commentID)-1]
+}
+
+func (c *Client_MinimizeComment_OngoingVerification) GetAllCapturedArguments() (_param0 []models.Repo, _param1 []int) {
+	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
+	if len(params) > 0 {
+		_param0 = make([]models.Repo, len(params[0]))
+		for u, param := range params[0] {
+			_param0[u] = param.(models.Repo)
+		}
+		_param1 = make([]int, len(params[1]))
+		for u, param := range params[1] {
+			_param1[u] = param.(int)
+		}
+	}
+	return
+}
+
+func (verifier *VerifierClient) AddLabel(repo models.Repo, pull models.PullRequest, label string) *Client_AddLabel_OngoingVerification {
+	params := []pegomock.Param{repo, pull, label}
+	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "AddLabel", params)
+	return &Client_AddLabel_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
+}
+
+type Client_AddLabel_OngoingVerification struct {
+	mock              *MockClient
+	methodInvocations []pegomock.MethodInvocation
+}
+
+func (c *Client_AddLabel_OngoingVerification) GetCapturedArguments() (models.Repo, models.PullRequest, string) {
+	repo, pull, label := c.GetAllCapturedArguments()
+	return repo[len(repo)-1], pull[len(pull)-1], label[len(label)-1]
+}
+
+func (c *Client_AddLabel_OngoingVerification) GetAllCapturedArguments() (_param0 []models.Repo, _param1 []models.PullRequest, _param2 []string) {
+	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
+	if len(params) > 0 {
+		_param0 = make([]models.Repo, len(params[0]))
+		for u, param := range params[0] {
+			_param0[u] = param.(models.Repo)
+		}
+		_param1 = make([]models.PullRequest, len(params[1]))
+		for u, param := range params[1] {
+			_param1[u] = param.(models.PullRequest)
+		}
+		_param2 = make([]string, len(params[2]))
+		for u, param := range params[2] {
+			_param2[u] = param.(string)
+		}
+	}
+	return
+}
+
+func (verifier *VerifierClient) RemoveLabel(repo models.Repo, pull models.PullRequest, label string) *Client_RemoveLabel_OngoingVerification {
+	params := []pegomock.Param{repo, pull, label}
+	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "RemoveLabel", params)
+	return &Client_RemoveLabel_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
+}
+
+type Client_RemoveLabel_OngoingVerification struct {
+	mock              *MockClient
+	methodInvocations []pegomock.MethodInvocation
+}
+
+func (c *Client_RemoveLabel_OngoingVerification) GetCapturedArguments() (models.Repo, models.PullRequest, string) {
+	repo, pull, label := c.GetAllCapturedArguments()
+	return repo[len(repo)-1], pull[len(pull)-1], label[len(label)-1]
+}
+
+func (c *Client_RemoveLabel_OngoingVerification) GetAllCapturedArguments() (_param0 []models.Repo, _param1 []models.PullRequest, _param2 []string) {
+	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
+	if len(params) > 0 {
+		_param0 = make([]models.Repo, len(params[0]))
+		for u, param := range params[0] {
+			_param0[u] = param.(models.Repo)
+		}
+		_param1 = make([]models.PullRequest, len(params[1]))
+		for u, param := range params[1] {
+			_param1[u] = param.(models.PullRequest)
+		}
+		_param2 = make([]string, len(params[2]))
+		for u, param := range params[2] {
+			_param2[u] = param.(string)
+		}
+	}
+	return
+}
+
+func (verifier *VerifierClient) IsCollaborator(repo models.Repo, user string) *Client_IsCollaborator_OngoingVerification {
+	params := []pegomock.Param{repo, user}
+	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "IsCollaborator", params)
+	return &Client_IsCollaborator_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
+}
+
+type Client_IsCollaborator_OngoingVerification struct {
+	mock              *MockClient
+	methodInvocations []pegomock.MethodInvocation
+}
+
+func (c *Client_IsCollaborator_OngoingVerification) GetCapturedArguments() (models.Repo, string) {
+	repo, user := c.GetAllCapturedArguments()
+	return repo[len(repo)-1], user[len(user)-1]
+}
+
+func (c *Client_IsCollaborator_OngoingVerification) GetAllCapturedArguments() (_param0 []models.Repo, _param1 []string) {
+	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
+	if len(params) > 0 {
+		_param0 = make([]models.Repo, len(params[0]))
+		for u, param := range params[0] {
+			_param0[u] = param.(models.Repo)
+		}
+		_param1 = make([]string, len(params[1]))
+		for u, param := range params[1] {
+			_param1[u] = param.(string)
+		}
+	}
+	return
+}
+
+func (verifier *VerifierClient) RepoIsArchived(repo models.Repo) *Client_RepoIsArchived_OngoingVerification {
+	params := []pegomock.Param{repo}
+	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "RepoIsArchived", params)
+	return &Client_RepoIsArchived_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
+}
+
+type Client_RepoIsArchived_OngoingVerification struct {
+	mock              *MockClient
+	methodInvocations []pegomock.MethodInvocation
+}
+
+func (c *Client_RepoIsArchived_OngoingVerification) GetCapturedArguments() models.Repo {
+	repo := c.GetAllCapturedArguments()
+	return repo[len(repo)-1]
+}
+
+func (c *Client_RepoIsArchived_OngoingVerification) GetAllCapturedArguments() (_param0 []models.Repo) {
+	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
+	if len(params) > 0 {
+		_param0 = make([]models.Repo, len(params[0]))
+		for u, param := range params[0] {
+			_param0[u] = param.(models.Repo)
+		}
+	}
+	return
+}
+
+func (verifier *VerifierClient) GetFileContents(repo models.Repo, path string, ref string) *Client_GetFileContents_OngoingVerification {
+	params := []pegomock.Param{repo, path, ref}
+	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "GetFileContents", params)
+	return &Client_GetFileContents_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
+}
+
+type Client_GetFileContents_OngoingVerification struct {
+	mock              *MockClient
+	methodInvocations []pegomock.MethodInvocation
+}
+
+func (c *Client_GetFileContents_OngoingVerification) GetCapturedArguments() (models.Repo, string, string) {
+	repo, path, ref := c.GetAllCapturedArguments()
+	return repo[len(repo)-1], path[len(path)-1], ref[len(ref)-1]
+}
+
+func (c *Client_GetFileContents_OngoingVerification) GetAllCapturedArguments() (_param0 []models.Repo, _param1 []string, _param2 []string) {
+	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
+	if len(params) > 0 {
+		_param0 = make([]models.Repo, len(params[0]))
+		for u, param := range params[0] {
+			_param0[u] = param.(models.Repo)
+		}
+		_param1 = make([]string, len(params[1]))
+		for u, param := range params[1] {
+			_param1[u] = param.(string)
+		}
+		_param2 = make([]string, len(params[2]))
+		for u, param := range params[2] {
+			_param2[u] = param.(string)
+		}
+	}
+	return
+}
+
+func (verifier *VerifierClient) CreateGist(description string, filename string, content string) *Client_CreateGist_OngoingVerification {
+	params := []pegomock.Param{description, filename, content}
+	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "CreateGist", params)
+	return &Client_CreateGist_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
+}
+
+type Client_CreateGist_OngoingVerification struct {
+	mock              *MockClient
+	methodInvocations []pegomock.MethodInvocation
+}
+
+func (c *Client_CreateGist_OngoingVerification) GetCapturedArguments() (string, string, string) {
+	description, filename, content := c.GetAllCapturedArguments()
+	return description[len(description)-1], filename[len(filename)-1], content[len(content)-1]
+}
+
+func (c *Client_CreateGist_OngoingVerification) GetAllCapturedArguments() (_param0 []string, _param1 []string, _param2 []string) {
+	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
+	if len(params) > 0 {
+		_param0 = make([]string, len(params[0]))
+		for u, param := range params[0] {
+			_param0[u] = param.(string)
+		}
+		_param1 = make([]string, len(params[1]))
+		for u, param := range params[1] {
+			_param1[u] = param.(string)
+		}
+		_param2 = make([]string, len(params[2]))
+		for u, param := range params[2] {
+			_param2[u] = param.(string)
+		}
+	}
+	return
+}
+
+func (verifier *VerifierClient) GetGists() *Client_GetGists_OngoingVerification {
+	params := []pegomock.Param{}
+	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "GetGists", params)
+	return &Client_GetGists_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
+}
+
+type Client_GetGists_OngoingVerification struct {
+	mock              *MockClient
+	methodInvocations []pegomock.MethodInvocation
+}
+
+func (c *Client_GetGists_OngoingVerification) GetCapturedArguments() {
+}
+
+func (c *Client_GetGists_OngoingVerification) GetAllCapturedArguments() {
+}
+
+func (verifier *VerifierClient) DeleteGist(id string) *Client_DeleteGist_OngoingVerification {
+	params := []pegomock.Param{id}
+	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "DeleteGist", params)
+	return &Client_DeleteGist_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
+}
+
+type Client_DeleteGist_OngoingVerification struct {
+	mock              *MockClient
+	methodInvocations []pegomock.MethodInvocation
+}
+
+func (c *Client_DeleteGist_OngoingVerification) GetCapturedArguments() string {
+	id := c.GetAllCapturedArguments()
+	return id[len(id)-1]
+}
+
+func (c *Client_DeleteGist_OngoingVerification) GetAllCapturedArguments() (_param0 []string) {
+	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
+	if len(params) > 0 {
+		_param0 = make([]string, len(params[0]))
+		for u, param := range params[0] {
+			_param0[u] = param.(string)
+		}
 	}
 	return
 }
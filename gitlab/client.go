@@ -0,0 +1,396 @@
+// Package gitlab provides a client for GitLab's API that implements the same
+// method set as github.Client so merge requests can be operated on like pull
+// requests.
+package gitlab
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/hootsuite/atlantis/models"
+	"github.com/pkg/errors"
+)
+
+// Client is used to perform GitLab actions. Merge requests are identified by
+// their iid, which is what GitLab shows as the merge request's number.
+type Client struct {
+	// baseURL is the URL of the v4 API, ex. https://gitlab.com/api/v4/
+	baseURL *url.URL
+	token   string
+	client  *http.Client
+}
+
+// NewClient returns a client for the GitLab at hostname that authenticates
+// with the personal access token token.
+func NewClient(hostname string, token string) (*Client, error) {
+	base, err := url.Parse(fmt.Sprintf("https://%s/api/v4/", hostname))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid gitlab hostname trying to parse %s", hostname)
+	}
+	return &Client{
+		baseURL: base,
+		token:   strings.TrimSpace(token),
+		client:  http.DefaultClient,
+	}, nil
+}
+
+type user struct {
+	Username string `json:"username"`
+}
+
+type note struct {
+	ID     int    `json:"id"`
+	Body   string `json:"body"`
+	Author user   `json:"author"`
+	System bool   `json:"system"`
+}
+
+type project struct {
+	PathWithNamespace string `json:"path_with_namespace"`
+	Path              string `json:"path"`
+	Namespace         struct {
+		FullPath string `json:"full_path"`
+	} `json:"namespace"`
+	HTTPURLToRepo string `json:"http_url_to_repo"`
+	Archived      bool   `json:"archived"`
+}
+
+type mergeRequest struct {
+	IID             int    `json:"iid"`
+	State           string `json:"state"`
+	WebURL          string `json:"web_url"`
+	SourceBranch    string `json:"source_branch"`
+	TargetBranch    string `json:"target_branch"`
+	SourceProjectID int    `json:"source_project_id"`
+	SHA             string `json:"sha"`
+	Author          user   `json:"author"`
+	DiffRefs        struct {
+		BaseSHA string `json:"base_sha"`
+	} `json:"diff_refs"`
+}
+
+// GetModifiedFiles returns the names of files that were modified in the
+// merge request. The names include the path to the file from the repo root,
+// ex. parent/child/file.txt.
+func (c *Client) GetModifiedFiles(repo models.Repo, pull models.PullRequest) ([]string, error) {
+	var changes struct {
+		Changes []struct {
+			NewPath string `json:"new_path"`
+		} `json:"changes"`
+	}
+	if _, err := c.do("GET", c.mergeRequestPath(repo, pull.Num, "changes"), nil, &changes); err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, change := range changes.Changes {
+		files = append(files, change.NewPath)
+	}
+	return files, nil
+}
+
+// CreateComment creates a comment on the merge request.
+func (c *Client) CreateComment(repo models.Repo, pull models.PullRequest, comment string) error {
+	_, err := c.CreateCommentWithID(repo, pull, comment)
+	return err
+}
+
+// CreateCommentWithID creates a comment on the merge request and returns
+// its id.
+func (c *Client) CreateCommentWithID(repo models.Repo, pull models.PullRequest, comment string) (int, error) {
+	var created note
+	if _, err := c.do("POST", c.mergeRequestPath(repo, pull.Num, "notes"), map[string]string{"body": comment}, &created); err != nil {
+		return 0, err
+	}
+	return created.ID, nil
+}
+
+// EditComment isn't supported since GitLab needs the merge request to edit
+// one of its comments.
+func (c *Client) EditComment(repo models.Repo, commentID int, comment string) error {
+	return errors.New("editing comments isn't supported on GitLab")
+}
+
+// PullIsApproved returns true if the merge request was approved.
+func (c *Client) PullIsApproved(repo models.Repo, pull models.PullRequest) (bool, error) {
+	approvers, err := c.GetApprovers(repo, pull)
+	if err != nil {
+		return false, err
+	}
+	return len(approvers) > 0, nil
+}
+
+// GetApprovers returns the usernames of the users that approved the merge
+// request.
+func (c *Client) GetApprovers(repo models.Repo, pull models.PullRequest) ([]string, error) {
+	var approvals struct {
+		ApprovedBy []struct {
+			User user `json:"user"`
+		} `json:"approved_by"`
+	}
+	if _, err := c.do("GET", c.mergeRequestPath(repo, pull.Num, "approvals"), nil, &approvals); err != nil {
+		return nil, err
+	}
+	var approvers []string
+	for _, approval := range approvals.ApprovedBy {
+		approvers = append(approvers, approval.User.Username)
+	}
+	return approvers, nil
+}
+
+// GetTeamMembers isn't supported since GitLab doesn't have teams.
+func (c *Client) GetTeamMembers(org string, teamSlug string) ([]string, error) {
+	return nil, errors.New("teams aren't supported on GitLab")
+}
+
+// GetPullRequest returns the merge request with iid num converted to a
+// GitHub pull request so it can be parsed like one.
+func (c *Client) GetPullRequest(repo models.Repo, num int) (*github.PullRequest, *github.Response, error) {
+	var mr mergeRequest
+	resp, err := c.do("GET", c.mergeRequestPath(repo, num, ""), nil, &mr)
+	if err != nil {
+		return nil, resp, err
+	}
+	var source project
+	if _, err := c.do("GET", fmt.Sprintf("projects/%d", mr.SourceProjectID), nil, &source); err != nil {
+		return nil, resp, errors.Wrap(err, "getting source project")
+	}
+	// GitLab's states are opened, closed, locked and merged
+	state := mr.State
+	if state == "opened" {
+		state = "open"
+	}
+	return &github.PullRequest{
+		Number:  github.Int(mr.IID),
+		State:   github.String(state),
+		HTMLURL: github.String(mr.WebURL),
+		User:    &github.User{Login: github.String(mr.Author.Username)},
+		Head: &github.PullRequestBranch{
+			SHA: github.String(mr.SHA),
+			Ref: github.String(mr.SourceBranch),
+			Repo: &github.Repository{
+				FullName: github.String(source.PathWithNamespace),
+				Owner:    &github.User{Login: github.String(source.Namespace.FullPath)},
+				Name:     github.String(source.Path),
+				CloneURL: github.String(source.HTTPURLToRepo),
+			},
+		},
+		Base: &github.PullRequestBranch{
+			SHA: github.String(mr.DiffRefs.BaseSHA),
+			Ref: github.String(mr.TargetBranch),
+		},
+	}, resp, nil
+}
+
+// UpdateStatus sets the commit status of the head commit of the merge
+// request. state is a GitHub status state which is converted to GitLab's.
+func (c *Client) UpdateStatus(repo models.Repo, pull models.PullRequest, state string, description string, targetURL string, context string) error {
+	switch state {
+	case "pending":
+		state = "running"
+	case "failure", "error":
+		state = "failed"
+	}
+	status := map[string]string{
+		"state":       state,
+		"name":        context,
+		"description": description,
+		"ref":         pull.Branch,
+	}
+	if targetURL != "" {
+		status["target_url"] = targetURL
+	}
+	_, err := c.do("POST", fmt.Sprintf("projects/%s/statuses/%s", projectID(repo), pull.HeadCommit), status, nil)
+	return err
+}
+
+// AddReaction isn't supported since GitLab can only award emoji to a comment
+// through its merge request.
+func (c *Client) AddReaction(repo models.Repo, commentID int, content string) (int, error) {
+	return 0, errors.New("reactions aren't supported on GitLab")
+}
+
+// DeleteReaction isn't supported, see AddReaction.
+func (c *Client) DeleteReaction(reactionID int) error {
+	return errors.New("reactions aren't supported on GitLab")
+}
+
+// GetComments returns all the comments on the merge request, oldest first,
+// converted to GitHub comments. Comments GitLab created itself, ex. when a
+// commit is pushed, aren't included.
+func (c *Client) GetComments(repo models.Repo, pull models.PullRequest) ([]*github.IssueComment, error) {
+	var comments []*github.IssueComment
+	for page := "1"; page != ""; {
+		var notes []note
+		resp, err := c.do("GET", c.mergeRequestPath(repo, pull.Num, "notes")+"?sort=asc&order_by=created_at&per_page=100&page="+page, nil, &notes)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range notes {
+			if n.System {
+				continue
+			}
+			comments = append(comments, &github.IssueComment{
+				ID:   github.Int(n.ID),
+				Body: github.String(n.Body),
+				User: &github.User{Login: github.String(n.Author.Username)},
+			})
+		}
+		page = resp.Header.Get("X-Next-Page")
+	}
+	return comments, nil
+}
+
+// DeleteComment isn't supported since GitLab needs the merge request to
+// delete one of its comments.
+func (c *Client) DeleteComment(repo models.Repo, commentID int) error {
+	return errors.New("deleting comments isn't supported on GitLab")
+}
+
+// MinimizeComment isn't supported since GitLab can't hide comments.
+func (c *Client) MinimizeComment(repo models.Repo, commentID int) error {
+	return errors.New("minimizing comments isn't supported on GitLab")
+}
+
+// AddLabel adds label to the merge request. The label is created if it
+// doesn't exist in the project yet.
+func (c *Client) AddLabel(repo models.Repo, pull models.PullRequest, label string) error {
+	_, err := c.do("PUT", c.mergeRequestPath(repo, pull.Num, ""), map[string]string{"add_labels": label}, nil)
+	return err
+}
+
+// RemoveLabel removes label from the merge request. It's not an error if the
+// merge request doesn't have the label.
+func (c *Client) RemoveLabel(repo models.Repo, pull models.PullRequest, label string) error {
+	_, err := c.do("PUT", c.mergeRequestPath(repo, pull.Num, ""), map[string]string{"remove_labels": label}, nil)
+	return err
+}
+
+// IsCollaborator returns true if user is a member of repo's project,
+// including through its groups.
+func (c *Client) IsCollaborator(repo models.Repo, user string) (bool, error) {
+	var members []struct {
+		Username string `json:"username"`
+	}
+	if _, err := c.do("GET", fmt.Sprintf("projects/%s/members/all?query=%s", projectID(repo), url.QueryEscape(user)), nil, &members); err != nil {
+		return false, err
+	}
+	for _, m := range members {
+		if m.Username == user {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// RepoIsArchived returns true if repo's project has been archived.
+func (c *Client) RepoIsArchived(repo models.Repo) (bool, error) {
+	var p project
+	if _, err := c.do("GET", fmt.Sprintf("projects/%s", projectID(repo)), nil, &p); err != nil {
+		return false, err
+	}
+	return p.Archived, nil
+}
+
+// GetFileContents returns the contents of the file at path in repo as of ref.
+// The bool returned is false if there's no file at path.
+func (c *Client) GetFileContents(repo models.Repo, path string, ref string) (string, bool, error) {
+	var file struct {
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+	}
+	resp, err := c.do("GET", fmt.Sprintf("projects/%s/repository/files/%s?ref=%s", projectID(repo), url.PathEscape(path), url.QueryEscape(ref)), nil, &file)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if file.Encoding != "base64" {
+		return file.Content, true, nil
+	}
+	contents, err := base64.StdEncoding.DecodeString(file.Content)
+	if err != nil {
+		return "", false, errors.Wrapf(err, "decoding %s", path)
+	}
+	return string(contents), true, nil
+}
+
+// CreateGist isn't supported since GitLab's snippets aren't gists.
+func (c *Client) CreateGist(description string, filename string, content string) (string, error) {
+	return "", errors.New("gists aren't supported on GitLab")
+}
+
+// GetGists isn't supported, see CreateGist.
+func (c *Client) GetGists() ([]*github.Gist, error) {
+	return nil, errors.New("gists aren't supported on GitLab")
+}
+
+// DeleteGist isn't supported, see CreateGist.
+func (c *Client) DeleteGist(id string) error {
+	return errors.New("gists aren't supported on GitLab")
+}
+
+// mergeRequestPath returns the API path of the merge request with iid num
+// in repo, followed by sub if it's set, ex. notes.
+func (c *Client) mergeRequestPath(repo models.Repo, num int, sub string) string {
+	path := fmt.Sprintf("projects/%s/merge_requests/%d", projectID(repo), num)
+	if sub != "" {
+		path += "/" + sub
+	}
+	return path
+}
+
+// projectID returns the id of repo's project in GitLab's API, which is its
+// URL encoded path.
+func projectID(repo models.Repo) string {
+	return url.PathEscape(repo.FullName)
+}
+
+// do sends a request for path, relative to the API's base URL, with body
+// encoded as JSON if it's set and decodes the response into v if it's set.
+// The response is returned so its headers can be read.
+func (c *Client) do(method string, path string, body interface{}, v interface{}) (*github.Response, error) {
+	u, err := c.baseURL.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequest(method, u.String(), &reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("PRIVATE-TOKEN", c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	ghResp := &github.Response{Response: resp}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// the error is a GitHub error so github.IsTransientError can tell
+		// which requests to retry
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return ghResp, &github.ErrorResponse{Response: resp, Message: strings.TrimSpace(string(msg))}
+	}
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			return ghResp, errors.Wrapf(err, "decoding response to %s %s", method, path)
+		}
+	}
+	return ghResp, nil
+}
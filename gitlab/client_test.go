@@ -0,0 +1,182 @@
+package gitlab
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hootsuite/atlantis/models"
+	. "github.com/hootsuite/atlantis/testing_util"
+)
+
+var repo = models.Repo{FullName: "group/sub/repo", Owner: "group/sub", Name: "repo"}
+
+// newTestClient returns a client whose requests are handled by handler and
+// a func to stop the server handling them.
+func newTestClient(t *testing.T, handler http.HandlerFunc) (*Client, func()) {
+	server := httptest.NewServer(handler)
+	base, err := url.Parse(server.URL + "/api/v4/")
+	Ok(t, err)
+	return &Client{baseURL: base, token: "token", client: server.Client()}, server.Close
+}
+
+func TestGetModifiedFiles(t *testing.T) {
+	c, closeServer := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		Equals(t, "/api/v4/projects/group%2Fsub%2Frepo/merge_requests/3/changes", r.URL.EscapedPath())
+		Equals(t, "token", r.Header.Get("PRIVATE-TOKEN"))
+		fmt.Fprint(w, `{"changes": [{"new_path": "staging/main.tf"}, {"new_path": "README.md"}]}`)
+	})
+	defer closeServer()
+
+	files, err := c.GetModifiedFiles(repo, models.PullRequest{Num: 3})
+	Ok(t, err)
+	Equals(t, []string{"staging/main.tf", "README.md"}, files)
+}
+
+func TestGetPullRequest(t *testing.T) {
+	c, closeServer := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/api/v4/projects/group%2Fsub%2Frepo/merge_requests/3":
+			fmt.Fprint(w, `{
+  "iid": 3,
+  "state": "opened",
+  "web_url": "https://gitlab.com/group/sub/repo/merge_requests/3",
+  "source_branch": "feature",
+  "target_branch": "master",
+  "source_project_id": 7,
+  "sha": "headsha",
+  "author": {"username": "author"},
+  "diff_refs": {"base_sha": "basesha"}
+}`)
+		case "/api/v4/projects/7":
+			fmt.Fprint(w, `{
+  "path_with_namespace": "fork/repo",
+  "path": "repo",
+  "namespace": {"full_path": "fork"},
+  "http_url_to_repo": "https://gitlab.com/fork/repo.git"
+}`)
+		default:
+			t.Errorf("unexpected request for %s", r.URL.EscapedPath())
+		}
+	})
+	defer closeServer()
+
+	pull, _, err := c.GetPullRequest(repo, 3)
+	Ok(t, err)
+	t.Log("opened merge requests should be open like GitHub's")
+	Equals(t, "open", pull.GetState())
+	Equals(t, 3, pull.GetNumber())
+	Equals(t, "https://gitlab.com/group/sub/repo/merge_requests/3", pull.GetHTMLURL())
+	Equals(t, "author", pull.User.GetLogin())
+	Equals(t, "headsha", pull.Head.GetSHA())
+	Equals(t, "feature", pull.Head.GetRef())
+	Equals(t, "basesha", pull.Base.GetSHA())
+	Equals(t, "master", pull.Base.GetRef())
+	t.Log("the head repo should be the merge request's source project")
+	Equals(t, "fork/repo", pull.Head.Repo.GetFullName())
+	Equals(t, "fork", pull.Head.Repo.Owner.GetLogin())
+	Equals(t, "repo", pull.Head.Repo.GetName())
+	Equals(t, "https://gitlab.com/fork/repo.git", pull.Head.Repo.GetCloneURL())
+}
+
+func TestUpdateStatus(t *testing.T) {
+	var status map[string]string
+	c, closeServer := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		Equals(t, "POST", r.Method)
+		Equals(t, "/api/v4/projects/group%2Fsub%2Frepo/statuses/headsha", r.URL.EscapedPath())
+		Ok(t, json.NewDecoder(r.Body).Decode(&status))
+		fmt.Fprint(w, "{}")
+	})
+	defer closeServer()
+	pull := models.PullRequest{Num: 3, HeadCommit: "headsha", Branch: "feature"}
+
+	for state, expected := range map[string]string{
+		"pending": "running",
+		"success": "success",
+		"failure": "failed",
+		"error":   "failed",
+	} {
+		t.Logf("the %s state should be %s on GitLab", state, expected)
+		Ok(t, c.UpdateStatus(repo, pull, state, "Plan succeeded", "", "Atlantis"))
+		Equals(t, map[string]string{
+			"state":       expected,
+			"name":        "Atlantis",
+			"description": "Plan succeeded",
+			"ref":         "feature",
+		}, status)
+	}
+
+	t.Log("the target URL should be set when there is one")
+	Ok(t, c.UpdateStatus(repo, pull, "success", "Plan succeeded", "https://atlantis", "Atlantis"))
+	Equals(t, "https://atlantis", status["target_url"])
+}
+
+func TestGetComments(t *testing.T) {
+	c, closeServer := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		Equals(t, "/api/v4/projects/group%2Fsub%2Frepo/merge_requests/3/notes", r.URL.EscapedPath())
+		Equals(t, "asc", r.URL.Query().Get("sort"))
+		switch r.URL.Query().Get("page") {
+		case "1":
+			w.Header().Set("X-Next-Page", "2")
+			fmt.Fprint(w, `[{"id": 1, "body": "atlantis plan", "author": {"username": "user"}}, {"id": 2, "body": "added 1 commit", "system": true}]`)
+		case "2":
+			fmt.Fprint(w, `[{"id": 3, "body": "atlantis apply", "author": {"username": "user"}}]`)
+		default:
+			t.Errorf("unexpected request for page %q", r.URL.Query().Get("page"))
+		}
+	})
+	defer closeServer()
+
+	t.Log("comments should be read from every page, oldest first, without GitLab's own notes")
+	comments, err := c.GetComments(repo, models.PullRequest{Num: 3})
+	Ok(t, err)
+	Equals(t, 2, len(comments))
+	Equals(t, 1, comments[0].GetID())
+	Equals(t, "atlantis plan", comments[0].GetBody())
+	Equals(t, "user", comments[0].User.GetLogin())
+	Equals(t, 3, comments[1].GetID())
+	Equals(t, "atlantis apply", comments[1].GetBody())
+}
+
+func TestGetFileContents(t *testing.T) {
+	c, closeServer := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		Equals(t, "master", r.URL.Query().Get("ref"))
+		switch r.URL.EscapedPath() {
+		case "/api/v4/projects/group%2Fsub%2Frepo/repository/files/staging%2Fatlantis.yaml":
+			// "apply_approvers: []" base64 encoded
+			fmt.Fprint(w, `{"content": "YXBwbHlfYXBwcm92ZXJzOiBbXQ==", "encoding": "base64"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "404 File Not Found"}`)
+		}
+	})
+	defer closeServer()
+
+	contents, found, err := c.GetFileContents(repo, "staging/atlantis.yaml", "master")
+	Ok(t, err)
+	Assert(t, found, "expected the file to be found")
+	Equals(t, "apply_approvers: []", contents)
+
+	t.Log("a file that doesn't exist shouldn't be an error")
+	_, found, err = c.GetFileContents(repo, "production/atlantis.yaml", "master")
+	Ok(t, err)
+	Assert(t, !found, "expected the file not to be found")
+}
+
+func TestDo_ErrorResponse(t *testing.T) {
+	c, closeServer := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "forbidden\n")
+	})
+	defer closeServer()
+
+	t.Log("responses that aren't 2xx should be errors with GitLab's message")
+	resp, err := c.do("GET", "projects/1", nil, nil)
+	Assert(t, err != nil, "expected an error")
+	Equals(t, http.StatusForbidden, resp.StatusCode)
+	Assert(t, strings.Contains(err.Error(), "forbidden"), "expected GitLab's message in %q", err.Error())
+}
@@ -204,3 +204,9 @@ func (b BoltLocker) GetLock(p models.Project, env string) (*models.ProjectLock,
 func (b BoltLocker) key(p models.Project, env string) string {
 	return fmt.Sprintf("%s/%s/%s", p.RepoFullName, p.Path, env)
 }
+
+// DB returns the underlying BoltDB so other data can be stored alongside
+// the locks in their own buckets.
+func (b *BoltLocker) DB() *bolt.DB {
+	return b.db
+}
@@ -3,14 +3,19 @@ package logging
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
+	"time"
 	"unicode"
 )
 
 // SimpleLogger wraps the standard logger with leveled logging
 // and the ability to store log history for later adding it
-// to a GitHub comment.
+// to a GitHub comment. It's safe to log from multiple goroutines but
+// History should only be read once they're done.
 type SimpleLogger struct {
 	// Source is added as a prefix to each log entry.
 	// It's useful if you want to trace a log entry back to a
@@ -23,6 +28,11 @@ type SimpleLogger struct {
 	Logger      *log.Logger
 	KeepHistory bool
 	Level       LogLevel
+	// Format is how entries are written to Logger. History is always
+	// written as text since it's added to comments.
+	Format LogFormat
+	// historyMutex serializes writes to History
+	historyMutex sync.Mutex
 }
 
 type LogLevel int
@@ -34,6 +44,25 @@ const (
 	Error
 )
 
+// LogFormat is how a SimpleLogger writes its entries.
+type LogFormat int
+
+const (
+	// Text writes each entry as a line like "[INFO] source: message".
+	Text LogFormat = iota
+	// JSON writes each entry as a JSON object with ts, level, src and msg
+	// keys so it can be parsed by log aggregators.
+	JSON
+)
+
+// jsonEntry is what each entry is written as when the format is JSON.
+type jsonEntry struct {
+	Timestamp string `json:"ts"`
+	Level     string `json:"level"`
+	Source    string `json:"src"`
+	Message   string `json:"msg"`
+}
+
 // NewSimpleLogger creates a new logger.
 // - source is added as a prefix to each log entry. It's useful if you want to trace a log entry back to a
 //   context, for example a pull request id.
@@ -43,12 +72,30 @@ const (
 //   If keepHistory is set to true, we'll store logs at all levels, regardless of what level
 //   is set to.
 func NewSimpleLogger(source string, logger *log.Logger, keepHistory bool, level LogLevel) *SimpleLogger {
+	return NewSimpleLoggerWithFormat(source, logger, keepHistory, level, Text)
+}
+
+// NewSimpleLoggerWithFormat creates a new logger like NewSimpleLogger that
+// writes its entries to logger in format. If format is JSON, logger
+// shouldn't have a prefix or flags since each entry has its own timestamp.
+func NewSimpleLoggerWithFormat(source string, logger *log.Logger, keepHistory bool, level LogLevel, format LogFormat) *SimpleLogger {
 	return &SimpleLogger{
 		Source:      source,
 		Logger:      logger,
 		Level:       level,
 		KeepHistory: keepHistory,
+		Format:      format,
+	}
+}
+
+// ToLogFormat converts a log format string to a valid
+// LogFormat. If the string doesn't match a format,
+// it will return Text.
+func ToLogFormat(formatStr string) LogFormat {
+	if formatStr == "json" {
+		return JSON
 	}
+	return Text
 }
 
 // ToLogLevel converts a log level string to a valid
@@ -90,7 +137,7 @@ func (l *SimpleLogger) Log(level LogLevel, format string, a ...interface{}) {
 
 	// only log this message if configured to log at this level
 	if l.Level <= level {
-		l.Logger.Printf("[%s] %s: %s\n", levelStr, l.Source, msg)
+		l.write(levelStr, msg)
 	}
 
 	// keep history at all log levels
@@ -99,7 +146,25 @@ func (l *SimpleLogger) Log(level LogLevel, format string, a ...interface{}) {
 	}
 }
 
+func (l *SimpleLogger) write(level string, msg string) {
+	if l.Format == JSON {
+		entry, err := json.Marshal(jsonEntry{
+			Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+			Level:     strings.ToLower(level),
+			Source:    l.Source,
+			Message:   msg,
+		})
+		if err == nil {
+			l.Logger.Println(string(entry))
+			return
+		}
+	}
+	l.Logger.Printf("[%s] %s: %s\n", level, l.Source, msg)
+}
+
 func (l *SimpleLogger) saveToHistory(level string, msg string) {
+	l.historyMutex.Lock()
+	defer l.historyMutex.Unlock()
 	l.History.WriteString(fmt.Sprintf("[%s] %s\n", level, msg))
 }
 
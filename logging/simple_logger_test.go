@@ -0,0 +1,52 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/hootsuite/atlantis/logging"
+	. "github.com/hootsuite/atlantis/testing_util"
+)
+
+func TestLog_Text(t *testing.T) {
+	var out bytes.Buffer
+	l := logging.NewSimpleLogger("src", log.New(&out, "", 0), true, logging.Info)
+	l.Debug("not written")
+	l.Info("written %d", 1)
+	Equals(t, "[INFO] src: Written 1\n", out.String())
+	Equals(t, "[DEBUG] Not written\n[INFO] Written 1\n", l.History.String())
+}
+
+func TestLog_JSON(t *testing.T) {
+	t.Log("each entry should be a JSON object but history should still be text")
+	var out bytes.Buffer
+	l := logging.NewSimpleLoggerWithFormat("owner/repo/pull/1", log.New(&out, "", 0), true, logging.Info, logging.JSON)
+	l.Debug("not written")
+	l.Info("first")
+	l.Err("second %q", "quoted")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	Equals(t, 2, len(lines))
+	var entries []map[string]string
+	for _, line := range lines {
+		var entry map[string]string
+		Ok(t, json.Unmarshal([]byte(line), &entry))
+		Assert(t, entry["ts"] != "", "expected a timestamp in %q", line)
+		delete(entry, "ts")
+		entries = append(entries, entry)
+	}
+	Equals(t, []map[string]string{
+		{"level": "info", "src": "owner/repo/pull/1", "msg": "First"},
+		{"level": "error", "src": "owner/repo/pull/1", "msg": `Second "quoted"`},
+	}, entries)
+	Equals(t, "[DEBUG] Not written\n[INFO] First\n[ERROR] Second \"quoted\"\n", l.History.String())
+}
+
+func TestToLogFormat(t *testing.T) {
+	Equals(t, logging.JSON, logging.ToLogFormat("json"))
+	Equals(t, logging.Text, logging.ToLogFormat("text"))
+	Equals(t, logging.Text, logging.ToLogFormat(""))
+}
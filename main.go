@@ -5,7 +5,17 @@ import (
 	"github.com/spf13/viper"
 )
 
+// version can be overridden and commit and date are set at build time, ex.
+// go build -ldflags "-X main.commit=$(git rev-parse --short HEAD) -X main.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version = "0.1.2"
+	commit  = ""
+	date    = ""
+)
+
 func main() {
-	viper.Set("version", "0.1.2")
+	viper.Set("version", version)
+	viper.Set("commit", commit)
+	viper.Set("build-date", date)
 	cmd.Execute()
 }
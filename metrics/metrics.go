@@ -0,0 +1,233 @@
+// Package metrics records metrics about Atlantis and exposes them in the
+// Prometheus text format.
+// See https://prometheus.io/docs/instrumenting/exposition_formats/.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the histogram buckets, in seconds, used for durations of
+// terraform commands which can range from seconds to tens of minutes.
+var DefaultBuckets = []float64{1, 5, 10, 30, 60, 120, 300, 600, 1200, 1800}
+
+// Registry holds all the metrics that will be exposed.
+type Registry struct {
+	mutex   sync.Mutex
+	metrics []metric
+	// excluded are the labels left off every metric
+	excluded map[string]bool
+}
+
+// metric is a histogram or counter that can be rendered in the Prometheus
+// text format.
+type metric interface {
+	render() []byte
+}
+
+// NewRegistry returns a Registry whose metrics don't have any of the
+// excludedLabels, ex. repo to bound how many series there are when Atlantis
+// runs for many repos. Values for excluded labels are ignored.
+func NewRegistry(excludedLabels ...string) *Registry {
+	r := &Registry{excluded: make(map[string]bool)}
+	for _, l := range excludedLabels {
+		r.excluded[l] = true
+	}
+	return r
+}
+
+// NewHistogramVec creates and registers a histogram that is partitioned by
+// the values of labels.
+func (r *Registry) NewHistogramVec(name string, help string, labels []string, buckets []float64) *HistogramVec {
+	h := &HistogramVec{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*histogram),
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	h.excluded = r.excluded
+	r.metrics = append(r.metrics, h)
+	return h
+}
+
+// NewCounterVec creates and registers a counter that is partitioned by the
+// values of labels.
+func (r *Registry) NewCounterVec(name string, help string, labels []string) *CounterVec {
+	c := &CounterVec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		series: make(map[string]uint64),
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	c.excluded = r.excluded
+	r.metrics = append(r.metrics, c)
+	return c
+}
+
+// Write writes all metrics to w in the Prometheus text format.
+func (r *Registry) Write(w io.Writer) error {
+	r.mutex.Lock()
+	metrics := r.metrics
+	r.mutex.Unlock()
+	for _, m := range metrics {
+		if _, err := w.Write(m.render()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServeHTTP serves the metrics so they can be scraped by Prometheus.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	r.Write(w)
+}
+
+// HistogramVec is a histogram partitioned by label values.
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	// excluded are the labels that are left off the histogram
+	excluded map[string]bool
+	mutex    sync.Mutex
+	// series maps the rendered label pairs to the histogram for those labels
+	series map[string]*histogram
+}
+
+type histogram struct {
+	// counts[i] is the number of observations <= buckets[i]
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Observe records v for the given label values which must be in the same
+// order as the labels the histogram was created with.
+func (h *HistogramVec) Observe(labelValues []string, v float64) {
+	key := labelPairs(h.labels, h.excluded, labelValues)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, b := range h.buckets {
+		if v <= b {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+// labelPairs renders labels, except the excluded ones, with labelValues, ex.
+// repo="owner/repo",command="plan".
+func labelPairs(labels []string, excluded map[string]bool, labelValues []string) string {
+	var pairs []string
+	for i, l := range labels {
+		if excluded[l] {
+			continue
+		}
+		value := ""
+		if i < len(labelValues) {
+			value = labelValues[i]
+		}
+		pairs = append(pairs, fmt.Sprintf("%s=%q", l, escapeLabelValue(value)))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (h *HistogramVec) render() []byte {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# HELP %s %s\n", h.name, h.help)
+	fmt.Fprintf(&buf, "# TYPE %s histogram\n", h.name)
+
+	// render in a consistent order
+	var keys []string
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := h.series[k]
+		prefix := k
+		if prefix != "" {
+			prefix += ","
+		}
+		for i, b := range h.buckets {
+			fmt.Fprintf(&buf, "%s_bucket{%sle=%q} %d\n", h.name, prefix, strconv.FormatFloat(b, 'g', -1, 64), s.counts[i])
+		}
+		fmt.Fprintf(&buf, "%s_bucket{%sle=\"+Inf\"} %d\n", h.name, prefix, s.count)
+		fmt.Fprintf(&buf, "%s_sum{%s} %s\n", h.name, k, strconv.FormatFloat(s.sum, 'g', -1, 64))
+		fmt.Fprintf(&buf, "%s_count{%s} %d\n", h.name, k, s.count)
+	}
+	return buf.Bytes()
+}
+
+// CounterVec is a counter partitioned by label values.
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+	// excluded are the labels that are left off the counter
+	excluded map[string]bool
+	mutex    sync.Mutex
+	// series maps the rendered label pairs to the count for those labels
+	series map[string]uint64
+}
+
+// Inc adds one to the count for the given label values which must be in the
+// same order as the labels the counter was created with.
+func (c *CounterVec) Inc(labelValues []string) {
+	key := labelPairs(c.labels, c.excluded, labelValues)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.series[key]++
+}
+
+func (c *CounterVec) render() []byte {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# HELP %s %s\n", c.name, c.help)
+	fmt.Fprintf(&buf, "# TYPE %s counter\n", c.name)
+
+	var keys []string
+	for k := range c.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "%s{%s} %d\n", c.name, k, c.series[k])
+	}
+	return buf.Bytes()
+}
+
+// escapeLabelValue strips characters that aren't printable from v. The value
+// is then quoted with %q which escapes backslashes and quotes the way Prometheus
+// expects but would escape other non-printable characters in ways it doesn't.
+func escapeLabelValue(v string) string {
+	return strings.Map(func(r rune) rune {
+		if strconv.IsPrint(r) {
+			return r
+		}
+		return -1
+	}, v)
+}
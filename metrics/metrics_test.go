@@ -0,0 +1,82 @@
+package metrics_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hootsuite/atlantis/metrics"
+	. "github.com/hootsuite/atlantis/testing_util"
+)
+
+func TestHistogramVec(t *testing.T) {
+	r := metrics.NewRegistry()
+	h := r.NewHistogramVec("test_seconds", "Test histogram.", []string{"repo", "project"}, []float64{1, 10})
+	h.Observe([]string{"owner/repo", "."}, 0.5)
+	h.Observe([]string{"owner/repo", "."}, 5)
+	h.Observe([]string{"owner/repo", "."}, 50)
+	h.Observe([]string{"owner/repo", "sub\"dir"}, 2)
+
+	var buf bytes.Buffer
+	Ok(t, r.Write(&buf))
+	Equals(t, `# HELP test_seconds Test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{repo="owner/repo",project=".",le="1"} 1
+test_seconds_bucket{repo="owner/repo",project=".",le="10"} 2
+test_seconds_bucket{repo="owner/repo",project=".",le="+Inf"} 3
+test_seconds_sum{repo="owner/repo",project="."} 55.5
+test_seconds_count{repo="owner/repo",project="."} 3
+test_seconds_bucket{repo="owner/repo",project="sub\"dir",le="1"} 0
+test_seconds_bucket{repo="owner/repo",project="sub\"dir",le="10"} 1
+test_seconds_bucket{repo="owner/repo",project="sub\"dir",le="+Inf"} 1
+test_seconds_sum{repo="owner/repo",project="sub\"dir"} 2
+test_seconds_count{repo="owner/repo",project="sub\"dir"} 1
+`, buf.String())
+}
+
+func TestHistogramVec_NoObservations(t *testing.T) {
+	r := metrics.NewRegistry()
+	r.NewHistogramVec("test_seconds", "Test histogram.", []string{"repo"}, metrics.DefaultBuckets)
+	var buf bytes.Buffer
+	Ok(t, r.Write(&buf))
+	Equals(t, "# HELP test_seconds Test histogram.\n# TYPE test_seconds histogram\n", buf.String())
+}
+
+func TestCounterVec(t *testing.T) {
+	r := metrics.NewRegistry()
+	c := r.NewCounterVec("test_total", "Test counter.", []string{"command", "status"})
+	c.Inc([]string{"plan", "success"})
+	c.Inc([]string{"plan", "success"})
+	c.Inc([]string{"apply", "failure"})
+
+	var buf bytes.Buffer
+	Ok(t, r.Write(&buf))
+	Equals(t, `# HELP test_total Test counter.
+# TYPE test_total counter
+test_total{command="apply",status="failure"} 1
+test_total{command="plan",status="success"} 2
+`, buf.String())
+}
+
+func TestRegistry_ExcludedLabels(t *testing.T) {
+	t.Log("excluded labels should be left off every metric and their values ignored")
+	r := metrics.NewRegistry("repo")
+	h := r.NewHistogramVec("test_seconds", "Test histogram.", []string{"repo", "command"}, []float64{1})
+	c := r.NewCounterVec("test_total", "Test counter.", []string{"repo", "command"})
+	for _, repo := range []string{"owner/a", "owner/b"} {
+		h.Observe([]string{repo, "plan"}, 0.5)
+		c.Inc([]string{repo, "plan"})
+	}
+
+	var buf bytes.Buffer
+	Ok(t, r.Write(&buf))
+	Equals(t, `# HELP test_seconds Test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{command="plan",le="1"} 2
+test_seconds_bucket{command="plan",le="+Inf"} 2
+test_seconds_sum{command="plan"} 1
+test_seconds_count{command="plan"} 2
+# HELP test_total Test counter.
+# TYPE test_total counter
+test_total{command="plan"} 2
+`, buf.String())
+}
@@ -23,6 +23,32 @@ type Repo struct {
 	// SanitizedCloneURL is the full HTTPS url for cloning without the username and password.
 	// ex. "https://github.com/atlantis/atlantis.git".
 	SanitizedCloneURL string
+	// VCSHost is where the repo is hosted.
+	VCSHost VCSHost
+}
+
+// VCSHost is a service that hosts repos, ex. GitHub.
+type VCSHost int
+
+const (
+	// Github is github.com or GitHub Enterprise.
+	Github VCSHost = iota
+	// Gitlab is gitlab.com or a self-hosted GitLab.
+	Gitlab
+	// Bitbucket is a self-hosted Bitbucket Server.
+	Bitbucket
+)
+
+func (h VCSHost) String() string {
+	switch h {
+	case Github:
+		return "GitHub"
+	case Gitlab:
+		return "GitLab"
+	case Bitbucket:
+		return "Bitbucket"
+	}
+	return ""
 }
 
 // PullRequest is a GitHub pull request.
@@ -40,6 +66,9 @@ type PullRequest struct {
 	URL string
 	// Branch is the name of the head branch (not the base).
 	Branch string
+	// BaseBranch is the name of the branch that this pull request will
+	// be merged into.
+	BaseBranch string
 	// Author is the GitHub username of the pull request author.
 	Author string
 }
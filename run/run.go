@@ -20,7 +20,8 @@ const inlineShebang = "#!/bin/sh -e"
 type Run struct{}
 
 // Execute runs the commands by writing them as a script to disk
-// and then executing the script.
+// and then executing the script in path. It returns the combined stdout and
+// stderr of the script, even if it fails.
 func (p *Run) Execute(
 	log *logging.SimpleLogger,
 	commands []string,
@@ -28,6 +29,20 @@ func (p *Run) Execute(
 	environment string,
 	terraformVersion *version.Version,
 	stage string) (string, error) {
+	return p.ExecuteWithEnvVars(log, commands, path, environment, terraformVersion, stage, nil)
+}
+
+// ExecuteWithEnvVars is the same as Execute but also sets extraEnvVars, which
+// are in the form "KEY=value", on the script. They take precedence over
+// Atlantis's own environment.
+func (p *Run) ExecuteWithEnvVars(
+	log *logging.SimpleLogger,
+	commands []string,
+	path string,
+	environment string,
+	terraformVersion *version.Version,
+	stage string,
+	extraEnvVars []string) (string, error) {
 	// we create a script from the commands provided
 	if len(commands) == 0 {
 		return "", errors.Errorf("%s commands cannot be empty", stage)
@@ -41,13 +56,18 @@ func (p *Run) Execute(
 
 	log.Info("running %s commands: %v", stage, commands)
 
-	// set environment variable for the run.
+	// set environment variables for the run.
 	// this is to support scripts to use the ENVIRONMENT, ATLANTIS_TERRAFORM_VERSION
-	// and WORKSPACE variables in their scripts
-	os.Setenv("ENVIRONMENT", environment)
-	os.Setenv("ATLANTIS_TERRAFORM_VERSION", terraformVersion.String())
-	os.Setenv("WORKSPACE", path)
-	return execute(s)
+	// and WORKSPACE variables in their scripts. They're set on the script
+	// rather than on our own process since projects can run at the same time
+	envVars := append(os.Environ(),
+		fmt.Sprintf("ENVIRONMENT=%s", environment),
+		fmt.Sprintf("ATLANTIS_TERRAFORM_VERSION=%s", terraformVersion.String()),
+		fmt.Sprintf("WORKSPACE=%s", path),
+	)
+	// when there are duplicate keys the last one is used
+	envVars = append(envVars, extraEnvVars...)
+	return execute(s, path, envVars)
 }
 
 func createScript(cmds []string, stage string) (string, error) {
@@ -78,8 +98,12 @@ func createScript(cmds []string, stage string) (string, error) {
 	return scriptName, nil
 }
 
-func execute(script string) (string, error) {
+// execute runs script in dir with env. If env is nil, the script gets our
+// own environment.
+func execute(script string, dir string, env []string) (string, error) {
 	localCmd := exec.Command("sh", "-c", script)
+	localCmd.Dir = dir
+	localCmd.Env = env
 	out, err := localCmd.CombinedOutput()
 	output := string(out)
 	if err != nil {
@@ -1,8 +1,10 @@
 package run
 
 import (
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"testing"
 
 	version "github.com/hashicorp/go-version"
@@ -23,14 +25,14 @@ func TestRunCreateScript_valid(t *testing.T) {
 func TestRunExecuteScript_invalid(t *testing.T) {
 	cmds := []string{"invalid", "command"}
 	scriptName, _ := createScript(cmds, "post_apply")
-	_, err := execute(scriptName)
+	_, err := execute(scriptName, "", nil)
 	Assert(t, err != nil, "there should be an error")
 }
 
 func TestRunExecuteScript_valid(t *testing.T) {
 	cmds := []string{"echo", "date"}
 	scriptName, _ := createScript(cmds, "post_apply")
-	output, err := execute(scriptName)
+	output, err := execute(scriptName, "", nil)
 	Assert(t, err == nil, "there should not be an error")
 	Assert(t, output != "", "there should be output")
 }
@@ -38,6 +40,32 @@ func TestRunExecuteScript_valid(t *testing.T) {
 func TestRun_valid(t *testing.T) {
 	cmds := []string{"echo", "date"}
 	version, _ := version.NewVersion("0.8.8")
-	_, err := run.Execute(logger, cmds, "/tmp/atlantis", "staging", version, "post_apply")
+	dir, err := ioutil.TempDir("", "atlantis-test")
 	Ok(t, err)
+	defer os.RemoveAll(dir)
+	_, err = run.Execute(logger, cmds, dir, "staging", version, "post_apply")
+	Ok(t, err)
+}
+
+func TestRun_EnvVars(t *testing.T) {
+	t.Log("the script should run in the project dir with the extra env vars set")
+	dir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(dir)
+	cmds := []string{"pwd", `echo "$ENVIRONMENT $ATLANTIS_REPO"`}
+	version, _ := version.NewVersion("0.8.8")
+	output, err := run.ExecuteWithEnvVars(logger, cmds, dir, "staging", version, "pre_plan", []string{"ATLANTIS_REPO=hootsuite/atlantis"})
+	Ok(t, err)
+	wd, err := filepath.EvalSymlinks(dir)
+	Ok(t, err)
+	Equals(t, wd+"\nstaging hootsuite/atlantis\n", output)
+}
+
+func TestRun_FailureOutput(t *testing.T) {
+	t.Log("the output of a failed script should still be returned")
+	cmds := []string{"echo before", "exit 3"}
+	version, _ := version.NewVersion("0.8.8")
+	output, err := run.Execute(logger, cmds, "", "staging", version, "pre_plan")
+	Assert(t, err != nil, "expected error")
+	Equals(t, "before\n", output)
 }
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// shuttingDownComment is commented on pull requests when a command is
+// rejected because Atlantis is waiting for the running commands to complete
+// so it can shut down
+const shuttingDownComment = "Atlantis is restarting so this command didn't run. Run it again once Atlantis is back."
+
+// ActiveCommands tracks the commands that are running or queued so that
+// Atlantis can wait for them to complete before it shuts down, rather than
+// stopping terraform part way through and leaving its state locked, or
+// dropping queued commands without saying so. A nil ActiveCommands tracks
+// nothing.
+type ActiveCommands struct {
+	mutex    sync.Mutex
+	wg       sync.WaitGroup
+	draining bool
+	nextID   int
+	// running describes each running or queued command by its id, ex.
+	// "apply hootsuite/atlantis#1 in staging"
+	running map[int]string
+}
+
+func NewActiveCommands() *ActiveCommands {
+	return &ActiveCommands{running: make(map[int]string)}
+}
+
+// Start records that the command in ctx started running. It returns the
+// function to call once it completes, or false if Atlantis is shutting down
+// and the command shouldn't run.
+func (a *ActiveCommands) Start(ctx *CommandContext) (done func(), ok bool) {
+	if a == nil {
+		return func() {}, true
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.draining {
+		return nil, false
+	}
+	_, done = a.track(fmt.Sprintf("%s %s#%d in %s", ctx.Command.Name, ctx.BaseRepo.FullName, ctx.Pull.Num, describeEnvs(ctx.Command)))
+	return done, true
+}
+
+// Queue records that the command in ctx was queued to run. It returns the
+// function to call when it's taken off the queue, after which Start tracks it
+// instead, and the function to call once it's been run. Queued commands are
+// waited for when draining too, since once they're run they either complete
+// or, if Atlantis is shutting down, comment that they didn't run.
+func (a *ActiveCommands) Queue(ctx *CommandContext) (dequeued func(), done func()) {
+	if a == nil {
+		return func() {}, func() {}
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	id, done := a.track(fmt.Sprintf("queued %s %s#%d in %s", ctx.Command.Name, ctx.BaseRepo.FullName, ctx.Pull.Num, describeEnvs(ctx.Command)))
+	return func() {
+		a.mutex.Lock()
+		delete(a.running, id)
+		a.mutex.Unlock()
+	}, done
+}
+
+// track records the command described by description until the returned
+// function is called. a.mutex must be held.
+func (a *ActiveCommands) track(description string) (id int, done func()) {
+	id = a.nextID
+	a.nextID++
+	a.running[id] = description
+	a.wg.Add(1)
+	return id, func() {
+		a.mutex.Lock()
+		delete(a.running, id)
+		a.mutex.Unlock()
+		a.wg.Done()
+	}
+}
+
+// Drain stops new commands from starting and waits up to timeout for the
+// running ones to complete. It returns the commands that were still running
+// when it timed out, or none if they all completed.
+func (a *ActiveCommands) Drain(timeout time.Duration) []string {
+	if a == nil {
+		return nil
+	}
+	a.mutex.Lock()
+	a.draining = true
+	a.mutex.Unlock()
+
+	completed := make(chan struct{})
+	go func() {
+		a.wg.Wait()
+		close(completed)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-completed:
+		return nil
+	case <-timer.C:
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	var running []string
+	for _, description := range a.running {
+		running = append(running, description)
+	}
+	sort.Strings(running)
+	return running
+}
@@ -0,0 +1,82 @@
+package server_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hootsuite/atlantis/server"
+	. "github.com/hootsuite/atlantis/testing_util"
+)
+
+func TestActiveCommands_Drain(t *testing.T) {
+	t.Log("draining should wait for running commands to complete")
+	a := server.NewActiveCommands()
+	ctx := reactionsCtx(1)
+	ctx.Command = &server.Command{Name: server.Apply, Environment: "staging"}
+	done, ok := a.Start(ctx)
+	Assert(t, ok, "expected the command to start")
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		done()
+	}()
+	Equals(t, 0, len(a.Drain(time.Minute)))
+
+	t.Log("once draining, new commands shouldn't start")
+	_, ok = a.Start(ctx)
+	Assert(t, !ok, "expected the command to be rejected")
+}
+
+func TestActiveCommands_DrainTimeout(t *testing.T) {
+	t.Log("the commands still running when draining times out should be returned")
+	a := server.NewActiveCommands()
+	for _, env := range []string{"staging", "production", "review"} {
+		ctx := reactionsCtx(1)
+		ctx.Command = &server.Command{Name: server.Apply, Environment: env}
+		done, ok := a.Start(ctx)
+		Assert(t, ok, "expected the command to start")
+		if env == "review" {
+			done()
+		}
+	}
+	Equals(t, []string{"apply hootsuite/atlantis#1 in production", "apply hootsuite/atlantis#1 in staging"}, a.Drain(time.Millisecond))
+}
+
+func TestActiveCommands_Nil(t *testing.T) {
+	t.Log("a nil ActiveCommands should let every command start")
+	var a *server.ActiveCommands
+	done, ok := a.Start(reactionsCtx(1))
+	Assert(t, ok, "expected the command to start")
+	done()
+	Equals(t, 0, len(a.Drain(time.Millisecond)))
+}
+
+func TestActiveCommands_DrainQueued(t *testing.T) {
+	t.Log("draining should wait for queued commands, which comment instead of running once draining")
+	a := server.NewActiveCommands()
+	started := make(chan bool)
+	release := make(chan bool)
+	results := make(chan string, 2)
+	q := server.NewCommandQueue(1, 10, a, func(ctx *server.CommandContext) {
+		done, ok := a.Start(ctx)
+		if !ok {
+			results <- "skipped " + ctx.Command.Environment
+			return
+		}
+		defer done()
+		started <- true
+		<-release
+		results <- "ran " + ctx.Command.Environment
+	})
+	for _, env := range []string{"staging", "production"} {
+		ctx := reactionsCtx(1)
+		ctx.Command = &server.Command{Name: server.Apply, Environment: env}
+		Assert(t, q.Enqueue(ctx), "expected %s to be queued", env)
+	}
+	<-started
+	Equals(t, []string{"apply hootsuite/atlantis#1 in staging", "queued apply hootsuite/atlantis#1 in production"}, a.Drain(time.Millisecond))
+
+	release <- true
+	Equals(t, 0, len(a.Drain(time.Minute)))
+	Equals(t, "ran staging", <-results)
+	Equals(t, "skipped production", <-results)
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hootsuite/atlantis/github"
+	"github.com/pkg/errors"
+)
+
+// AdminOverride decides whether a user can bypass the apply requirements with
+// the --override flag.
+type AdminOverride struct {
+	Github github.Client
+	// AdminTeam is the org/team whose members can override. If empty, no one can.
+	AdminTeam string
+}
+
+// Check returns a failure message if ctx.User isn't allowed to override.
+// If they are, it comments on the pull request that an override was used so
+// there's a record of who bypassed the requirements.
+func (o *AdminOverride) Check(ctx *CommandContext) (string, error) {
+	if o.AdminTeam == "" {
+		return "--override can't be used because no admin team is configured.", nil
+	}
+	split := strings.SplitN(strings.TrimPrefix(o.AdminTeam, "@"), "/", 2)
+	if len(split) != 2 {
+		return "", fmt.Errorf("admin team %q is not in the form org/team", o.AdminTeam)
+	}
+	members, err := o.Github.GetTeamMembers(split[0], split[1])
+	if err != nil {
+		return "", errors.Wrapf(err, "getting members of admin team %s", o.AdminTeam)
+	}
+	isAdmin := false
+	for _, m := range members {
+		if strings.EqualFold(m, ctx.User.Username) {
+			isAdmin = true
+			break
+		}
+	}
+	if !isAdmin {
+		ctx.Log.Warn("%s tried to use --override but is not a member of %s", ctx.User.Username, o.AdminTeam)
+		return fmt.Sprintf("Only members of %s can use --override.", o.AdminTeam), nil
+	}
+
+	ctx.Log.Warn("apply requirements overridden by %s", ctx.User.Username)
+	comment := fmt.Sprintf("**Warning**: @%s used `--override` to bypass the apply requirements for the %s environment.", ctx.User.Username, ctx.Command.Environment)
+	if err := o.Github.CreateComment(ctx.BaseRepo, ctx.Pull, comment); err != nil {
+		return "", errors.Wrap(err, "commenting that apply requirements were overridden")
+	}
+	return "", nil
+}
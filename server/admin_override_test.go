@@ -0,0 +1,57 @@
+package server_test
+
+import (
+	"log"
+	"os"
+	"testing"
+
+	"github.com/hootsuite/atlantis/github/mocks"
+	"github.com/hootsuite/atlantis/logging"
+	"github.com/hootsuite/atlantis/models"
+	"github.com/hootsuite/atlantis/models/fixtures"
+	"github.com/hootsuite/atlantis/server"
+	. "github.com/hootsuite/atlantis/testing_util"
+	. "github.com/petergtz/pegomock"
+)
+
+func overrideCtx(username string) *server.CommandContext {
+	return &server.CommandContext{
+		BaseRepo: fixtures.Repo,
+		Pull:     fixtures.Pull,
+		User:     models.User{Username: username},
+		Command:  &server.Command{Name: server.Apply, Environment: "production", Override: true},
+		Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+}
+
+func TestAdminOverride_NoTeam(t *testing.T) {
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	o := server.AdminOverride{Github: client}
+	failure, err := o.Check(overrideCtx("admin"))
+	Ok(t, err)
+	Equals(t, "--override can't be used because no admin team is configured.", failure)
+}
+
+func TestAdminOverride_NotAdmin(t *testing.T) {
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	When(client.GetTeamMembers("hootsuite", "admins")).ThenReturn([]string{"admin"}, nil)
+	o := server.AdminOverride{Github: client, AdminTeam: "hootsuite/admins"}
+	failure, err := o.Check(overrideCtx("someone"))
+	Ok(t, err)
+	Equals(t, "Only members of hootsuite/admins can use --override.", failure)
+	client.VerifyWasCalled(Never()).CreateComment(fixtures.Repo, fixtures.Pull, "**Warning**: @someone used `--override` to bypass the apply requirements for the production environment.")
+}
+
+func TestAdminOverride_Admin(t *testing.T) {
+	t.Log("an admin can override and we should comment that they did")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	When(client.GetTeamMembers("hootsuite", "admins")).ThenReturn([]string{"Admin"}, nil)
+	o := server.AdminOverride{Github: client, AdminTeam: "@hootsuite/admins"}
+	failure, err := o.Check(overrideCtx("admin"))
+	Ok(t, err)
+	Equals(t, "", failure)
+	client.VerifyWasCalledOnce().CreateComment(fixtures.Repo, fixtures.Pull, "**Warning**: @admin used `--override` to bypass the apply requirements for the production environment.")
+}
@@ -3,6 +3,8 @@ package server
 import (
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -11,48 +13,107 @@ import (
 	version "github.com/hashicorp/go-version"
 	"github.com/hootsuite/atlantis/github"
 	"github.com/hootsuite/atlantis/locking"
+	"github.com/hootsuite/atlantis/metrics"
 	"github.com/hootsuite/atlantis/models"
 	"github.com/hootsuite/atlantis/run"
 	"github.com/hootsuite/atlantis/terraform"
 )
 
+func init() {
+	registerCommandUsage(CommandUsage{
+		Name:        Apply,
+		Description: "Runs 'terraform apply' using the plans generated by 'atlantis plan'",
+		Flags:       []string{"[environment | -e env,env... | -w workspace]", "[-d dir]", "[-target=address]", "[-var-file=path]", "[--env KEY=value]", "[-parallelism=n]", "[-lock-timeout=duration]", "[--override]", "[--trust]"},
+	})
+}
+
 type ApplyExecutor struct {
 	github                github.Client
 	githubStatus          *GithubStatus
 	terraform             *terraform.Client
 	githubCommentRenderer *GithubCommentRenderer
 	locker                locking.Locker
-	requireApproval       bool
+	applyRequirements     *ApplyRequirements
 	run                   *run.Run
 	configReader          *ConfigReader
 	concurrentRunLocker   *ConcurrentRunLocker
 	workspace             Workspace
+	commentReactions      *CommentReactions
+	resultComments        *ResultComments
+	outputGists           *OutputGists
+	projectDurations      *metrics.HistogramVec
+	resultsStore          *ResultsStore
+	pullLabels            *PullLabels
+	terraformFlagPolicy   *TerraformFlagPolicy
+	projectFinder         *ProjectFinder
+	workspaceDiscovery    *WorkspaceDiscovery
+	// parallelApplies is how many projects that don't depend on each other
+	// can be applied at the same time
+	parallelApplies int
+	// stalePlanComment is the failure commented instead of applying if the
+	// pull request has new commits since it was planned. If empty,
+	// DefaultStalePlanComment is used
+	stalePlanComment string
+	// lockTimeout is the -lock-timeout to apply with if neither the comment
+	// nor the project's config set one
+	lockTimeout string
+	// queueTimeout is how long an apply waits for another command running in
+	// the same environment of the pull request to complete. If it's 0, the
+	// apply fails right away instead.
+	queueTimeout time.Duration
+	// applyTimeout is how long terraform apply can run before it's stopped.
+	// If it's 0, it can run for as long as it needs.
+	applyTimeout time.Duration
+	// commandMetrics records how many applies ran and how long they took
+	commandMetrics *CommandMetrics
 }
 
+// DefaultStalePlanComment is commented when an apply is blocked because new
+// commits were pushed to the pull request after it was planned.
+const DefaultStalePlanComment = "The plan is out of date (new commits pushed); please re-plan."
+
+// noPlanFailure is the failure for a project modified by the pull request
+// that wasn't planned so can't be applied.
+const noPlanFailure = "Atlantis: no plan found for this project, run plan first"
+
 func (a *ApplyExecutor) Execute(ctx *CommandContext) {
-	a.githubStatus.Update(ctx.BaseRepo, ctx.Pull, Pending, ApplyStep)
-	res := a.setupAndApply(ctx)
+	start := time.Now()
+	a.githubStatus.Update(ctx, Pending, ApplyStep)
+	a.resultComments.Acknowledge(ctx, Apply)
+	stopProgress := a.resultComments.TrackProgress(ctx, Apply)
+	res := runEnvs(ctx, a.setupAndApply)
+	stopProgress()
+	if res.Error == nil && res.Failure == "" {
+		a.githubStatus.UpdateProjectResult(ctx, res.ProjectResults)
+	}
 	res.Command = Apply
+	res.Environment = ctx.Command.Environment
+	res.Dir = ctx.Command.Dir
+	a.outputGists.Upload(ctx, &res)
 	comment := a.githubCommentRenderer.Render(res, ctx.Log.History.String(), ctx.Command.Verbose)
-	a.github.CreateComment(ctx.BaseRepo, ctx.Pull, comment)
+	a.resultComments.Create(ctx, Apply, comment)
+	if err := a.resultsStore.Save(ctx, Apply, res); err != nil {
+		ctx.Log.Err("saving results: %s", err)
+	}
+	a.commandMetrics.Record(ctx, Apply, res, time.Since(start))
+	a.commentReactions.Done(ctx, res)
+	a.pullLabels.Update(ctx, Apply, res)
 }
 
 func (a *ApplyExecutor) setupAndApply(ctx *CommandContext) CommandResponse {
-	if a.concurrentRunLocker.TryLock(ctx.BaseRepo.FullName, ctx.Command.Environment, ctx.Pull.Num) != true {
-		return a.failureResponse(ctx,
-			fmt.Sprintf("The %s environment is currently locked by another command that is running for this pull request. Wait until command is complete and try again.", ctx.Command.Environment))
+	unlock, failure := lockRun(ctx, a.concurrentRunLocker, a.resultComments, a.commandMetrics, Apply, ctx.Command.Environment, a.queueTimeout)
+	if failure != "" {
+		return a.failureResponse(ctx, failure)
 	}
-	defer a.concurrentRunLocker.Unlock(ctx.BaseRepo.FullName, ctx.Command.Environment, ctx.Pull.Num)
+	defer unlock()
+	a.commentReactions.Running(ctx)
 
-	if a.requireApproval {
-		approved, err := a.github.PullIsApproved(ctx.BaseRepo, ctx.Pull)
-		if err != nil {
-			return a.errorResponse(ctx, errors.Wrap(err, "checking if pull request was approved"))
-		}
-		if !approved {
-			return a.failureResponse(ctx, "Pull request must be approved before running apply.")
-		}
-		ctx.Log.Info("confirmed pull request was approved")
+	overridden, failure, err := a.applyRequirements.CheckPull(ctx)
+	if err != nil {
+		return a.errorResponse(ctx, err)
+	}
+	if failure != "" {
+		return a.failureResponse(ctx, failure)
 	}
 
 	repoDir, err := a.workspace.GetWorkspace(ctx)
@@ -61,6 +122,17 @@ func (a *ApplyExecutor) setupAndApply(ctx *CommandContext) CommandResponse {
 	}
 	ctx.Log.Info("found workspace in %q", repoDir)
 
+	// applying a plan for an older commit could undo or skip the changes
+	// that were pushed since
+	plannedCommit, err := a.workspace.PlannedCommit(repoDir)
+	if err != nil {
+		return a.errorResponse(ctx, errors.Wrap(err, "checking which commit was planned"))
+	}
+	if plannedCommit != "" && ctx.Pull.HeadCommit != "" && plannedCommit != ctx.Pull.HeadCommit {
+		ctx.Log.Info("plan was for commit %q but the pull request is now at %q", plannedCommit, ctx.Pull.HeadCommit)
+		return a.failureResponse(ctx, a.stalePlanFailure())
+	}
+
 	// plans are stored at project roots by their environment names. We just need to find them
 	var plans []models.Plan
 	filepath.Walk(repoDir, func(path string, info os.FileInfo, err error) error {
@@ -68,7 +140,7 @@ func (a *ApplyExecutor) setupAndApply(ctx *CommandContext) CommandResponse {
 			return err
 		}
 		// if the plan is for the right env,
-		if !info.IsDir() && info.Name() == ctx.Command.Environment+".tfplan" {
+		if !info.IsDir() && info.Name() == planFileName(ctx.Command.Environment) {
 			rel, _ := filepath.Rel(repoDir, filepath.Dir(path))
 			plans = append(plans, models.Plan{
 				Project:   models.NewProject(ctx.BaseRepo.FullName, rel),
@@ -77,26 +149,180 @@ func (a *ApplyExecutor) setupAndApply(ctx *CommandContext) CommandResponse {
 		}
 		return nil
 	})
-	if len(plans) == 0 {
+	var unplanned []models.Project
+	if ctx.Command.Dir != "" {
+		// only the project in the -d directory is applied and the other
+		// projects aren't mentioned
+		var planned []string
+		for _, plan := range plans {
+			planned = append(planned, plan.Project.Path)
+		}
+		project, failure := dirProject(ctx.BaseRepo.FullName, repoDir, ctx.Command.Dir)
+		if failure != "" {
+			res := a.failureResponse(ctx, failure)
+			res.AvailableProjects = planned
+			return res
+		}
+		plans = dirPlans(plans, project)
+		if len(plans) == 0 {
+			res := a.failureResponse(ctx, fmt.Sprintf("No plan found for the %s environment in the `%s` directory. Run plan for it first.", ctx.Command.Environment, project.Path))
+			res.AvailableProjects = planned
+			return res
+		}
+	} else {
+		unplanned, err = a.unplannedProjects(ctx, plans)
+		if err != nil {
+			return a.errorResponse(ctx, err)
+		}
+	}
+	if len(plans) == 0 && len(unplanned) == 0 {
 		return a.failureResponse(ctx, "No plans found for that environment.")
 	}
+	// projects the pull request modified that weren't planned can't be
+	// applied but the ones that were planned still are
+	var unplannedResults []ProjectResult
+	for _, project := range unplanned {
+		ctx.Log.Warn("no plan found for project at path %q", project.Path)
+		unplannedResults = append(unplannedResults, ProjectResult{Path: project.Path, Failure: noPlanFailure})
+	}
+	if len(plans) == 0 {
+		return CommandResponse{ProjectResults: unplannedResults}
+	}
 	var paths []string
 	for _, p := range plans {
 		paths = append(paths, p.LocalPath)
 	}
 	ctx.Log.Info("found %d plan(s) in our workspace: %v", len(plans), paths)
 
+	var projects []models.Project
+	for _, p := range plans {
+		projects = append(projects, p.Project)
+	}
+	ctx.projectConfigs, err = a.configReader.ReadAll(repoDir, projects)
+	if err != nil {
+		return a.errorResponse(ctx, errors.Wrap(err, "parsing atlantis config files"))
+	}
+
+	if !overridden {
+		failure, err := a.applyRequirements.CheckProjects(ctx, projects)
+		if err != nil {
+			return a.errorResponse(ctx, err)
+		}
+		if failure != "" {
+			return a.failureResponse(ctx, failure)
+		}
+	}
+
+	levels, err := applyLevels(plans, a.dependsOn(ctx, plans))
+	if err != nil {
+		return a.failureResponse(ctx, fmt.Sprintf("Unable to determine the order to apply in: %s.", err))
+	}
+	levelResults := a.applyLevels(ctx, repoDir, levels)
 	results := []ProjectResult{}
 	for _, plan := range plans {
-		ctx.Log.Info("running apply for project at path %q", plan.Project.Path)
-		result := a.apply(ctx, repoDir, plan)
-		result.Path = plan.LocalPath
-		results = append(results, result)
+		results = append(results, levelResults[plan.Project.Path])
 	}
-	a.githubStatus.UpdateProjectResult(ctx, results)
+	results = append(results, unplannedResults...)
 	return CommandResponse{ProjectResults: results}
 }
 
+// dirPlans returns the plans in plans for project, which was set with -d.
+func dirPlans(plans []models.Plan, project models.Project) []models.Plan {
+	var matching []models.Plan
+	for _, plan := range plans {
+		if filepath.Clean(plan.Project.Path) == filepath.Clean(project.Path) {
+			matching = append(matching, plan)
+		}
+	}
+	return matching
+}
+
+// unplannedProjects returns the projects modified by the pull request that
+// don't have a plan for the environment. plans are the plans that were found
+// in the workspace.
+func (a *ApplyExecutor) unplannedProjects(ctx *CommandContext, plans []models.Plan) ([]models.Project, error) {
+	files, err := a.github.GetModifiedFiles(ctx.BaseRepo, ctx.Pull)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting modified files")
+	}
+	planned := make(map[string]bool)
+	for _, plan := range plans {
+		planned[filepath.Clean(plan.Project.Path)] = true
+	}
+	var unplanned []models.Project
+	for _, project := range a.projectFinder.ModifiedProjects(ctx.BaseRepo.FullName, a.projectFinder.ProjectFiles(files)) {
+		if !planned[filepath.Clean(project.Path)] {
+			unplanned = append(unplanned, project)
+		}
+	}
+	return unplanned, nil
+}
+
+// dependsOn returns the paths of the projects each of plans depends on
+// according to its config.
+func (a *ApplyExecutor) dependsOn(ctx *CommandContext, plans []models.Plan) map[string][]string {
+	dependsOn := make(map[string][]string)
+	for _, plan := range plans {
+		// if the config can't be read, applying the project will fail
+		// with the error so we don't need to report it here
+		if config, ok, err := projectConfig(ctx, a.configReader, filepath.Dir(plan.LocalPath)); ok && err == nil {
+			dependsOn[plan.Project.Path] = dependsOnPaths(config)
+		}
+	}
+	return dependsOn
+}
+
+// applyLevels applies each of levels in turn, applying up to parallelApplies
+// of the plans in a level at the same time. If any apply in a level doesn't
+// succeed, the later levels, which may depend on it, aren't applied. It
+// returns the results by project path.
+func (a *ApplyExecutor) applyLevels(ctx *CommandContext, repoDir string, levels [][]models.Plan) map[string]ProjectResult {
+	results := make(map[string]ProjectResult)
+	var failed []string
+	for _, level := range levels {
+		if len(failed) > 0 {
+			for _, plan := range level {
+				results[plan.Project.Path] = ProjectResult{
+					Path:    plan.Project.Path,
+					Failure: fmt.Sprintf("Not applied because `%s` failed to apply and had to be applied first.", strings.Join(failed, "`, `")),
+				}
+			}
+			continue
+		}
+
+		var paths []string
+		for _, plan := range level {
+			paths = append(paths, plan.Project.Path)
+		}
+		levelResults := runProjects(ctx, Apply, a.parallelApplies, paths, func(i int) ProjectResult {
+			return a.applyProject(ctx, repoDir, level[i])
+		})
+
+		for i, result := range levelResults {
+			results[level[i].Project.Path] = result
+			if result.Status() != Success {
+				failed = append(failed, level[i].Project.Path)
+			}
+		}
+	}
+	return results
+}
+
+// applyProject applies plan and records how long it took and who applied it.
+func (a *ApplyExecutor) applyProject(ctx *CommandContext, repoDir string, plan models.Plan) ProjectResult {
+	ctx.Log.Info("running apply for project at path %q", plan.Project.Path)
+	start := time.Now()
+	result := a.apply(ctx, repoDir, plan)
+	result.Path = plan.Project.Path
+	result.Duration = time.Since(start)
+	if result.ApplySuccess != "" {
+		result.AppliedBy = ctx.User.Username
+		result.AppliedAt = time.Now()
+	}
+	a.projectDurations.Observe([]string{ctx.BaseRepo.FullName, plan.Project.Path, Apply.String()}, result.Duration.Seconds())
+	return result
+}
+
 func (a *ApplyExecutor) apply(ctx *CommandContext, repoDir string, plan models.Plan) ProjectResult {
 	tfEnv := ctx.Command.Environment
 	lockAttempt, err := a.locker.TryLock(plan.Project, tfEnv, ctx.Pull, ctx.User)
@@ -113,28 +339,57 @@ func (a *ApplyExecutor) apply(ctx *CommandContext, repoDir string, plan models.P
 	// check if config file is found, if not we continue the run
 	absolutePath := filepath.Dir(plan.LocalPath)
 	var applyExtraArgs []string
-	var config ProjectConfig
-	if a.configReader.Exists(absolutePath) {
-		config, err = a.configReader.Read(absolutePath)
-		if err != nil {
-			return ProjectResult{Error: err}
-		}
+	config, hasConfig, err := projectConfig(ctx, a.configReader, absolutePath)
+	if err != nil {
+		return ProjectResult{Error: err}
+	}
+	if hasConfig {
 		ctx.Log.Info("parsed atlantis config file in %q", absolutePath)
 		applyExtraArgs = config.GetExtraArguments(ctx.Command.Name.String())
 	}
+	envVars, failure := commentEnvVars(ctx, config)
+	if failure == "" {
+		failure = a.terraformFlagPolicy.Check(ctx, config, Apply, initArgs(ctx, absolutePath, config))
+	}
+	if failure == "" {
+		failure = varFilesFailure(repoDir, plan.Project.Path, ctx.Command.VarFiles)
+	}
+	if failure != "" {
+		return ProjectResult{Failure: failure}
+	}
+	roleEnvVars, cleanupRole, err := assumeRoleEnvVars(ctx, config)
+	if err != nil {
+		return ProjectResult{Error: err}
+	}
+	defer cleanupRole()
+	envVars = append(envVars, roleEnvVars...)
 
-	// check if terraform version is >= 0.9.0
-	terraformVersion := a.terraform.Version()
-	if config.TerraformVersion != nil {
-		terraformVersion = config.TerraformVersion
+	terraformVersion, err := projectTerraformVersion(ctx, a.terraform, absolutePath, config)
+	if err != nil {
+		return terraformErrResult(err)
 	}
+	// check if terraform version is >= 0.9.0
 	constraints, _ := version.NewConstraint(">= 0.9.0")
 	if constraints.Check(terraformVersion) {
 		ctx.Log.Info("determined that we are running terraform with version >= 0.9.0. Running version %s", terraformVersion)
-		_, err := a.terraform.RunInitAndEnv(ctx.Log, absolutePath, tfEnv, config.GetExtraArguments("init"), terraformVersion)
-		if err != nil {
-			return ProjectResult{Error: err}
+		if ctx.Command.WorkspaceFlag {
+			workspaces, err := a.workspaceDiscovery.List(ctx, absolutePath, initArgs(ctx, absolutePath, config), terraformVersion)
+			if err != nil {
+				return terraformErrResult(err)
+			}
+			if !stringInSlice(tfEnv, workspaces) {
+				return ProjectResult{Failure: workspaceNotFoundFailure(tfEnv, workspaces)}
+			}
 		}
+		if _, err := a.terraform.RunInitAndEnv(ctx.Log, absolutePath, tfEnv, initArgs(ctx, absolutePath, config), terraformVersion, envVars); err != nil {
+			return terraformErrResult(err)
+		}
+	}
+	// init doesn't print the providers here since the plan already
+	// installed them, so they're the ones the plan saved
+	providers, err := loadProviders(plan.LocalPath)
+	if err != nil {
+		ctx.Log.Warn("reading the providers the plan ran with: %s", err)
 	}
 
 	// if there are pre apply commands then run them
@@ -145,10 +400,21 @@ func (a *ApplyExecutor) apply(ctx *CommandContext, repoDir string, plan models.P
 		}
 	}
 
-	tfApplyCmd := append(append(append([]string{"apply", "-no-color"}, applyExtraArgs...), ctx.Command.Flags...), plan.LocalPath)
-	output, err := a.terraform.RunCommandWithVersion(ctx.Log, absolutePath, tfApplyCmd, terraformVersion, tfEnv)
+	tfParallelism := parallelism(ctx, config)
+	tfLockTimeout := lockTimeout(ctx, config, a.lockTimeout)
+	tfApplyCmd := append(append(append(append(append([]string{"apply", "-no-color"}, applyExtraArgs...), parallelismArgs(tfParallelism)...), lockTimeoutArgs(tfLockTimeout)...), ctx.Command.Flags...), targetArgs(ctx.Command.Targets)...)
+	tfApplyCmd = append(append(tfApplyCmd, varFileArgs(ctx.Command.VarFiles)...), plan.LocalPath)
+	output, err := a.terraform.RunCommandWithTimeout(ctx.Log, absolutePath, tfApplyCmd, terraformVersion, tfEnv, envVars, a.applyTimeout)
 	if err != nil {
-		return ProjectResult{Error: fmt.Errorf("%s\n%s", err.Error(), output)}
+		if _, ok := err.(terraform.NotInstalledError); ok {
+			return terraformErrResult(err)
+		}
+		if timedOut, ok := err.(terraform.TimeoutError); ok {
+			return ProjectResult{Failure: timeoutFailure(timedOut, output), Parallelism: tfParallelism, LockTimeout: tfLockTimeout, Targets: ctx.Command.Targets, VarFiles: ctx.Command.VarFiles}
+		}
+		// the error contains terraform's stderr but we also include its
+		// output since it shows what was changed before the apply failed
+		return ProjectResult{Error: fmt.Errorf("%s\n%s", err.Error(), output), Parallelism: tfParallelism, LockTimeout: tfLockTimeout, ExitCode: exitCode(err), Targets: ctx.Command.Targets, VarFiles: ctx.Command.VarFiles}
 	}
 	ctx.Log.Info("apply succeeded")
 
@@ -160,17 +426,24 @@ func (a *ApplyExecutor) apply(ctx *CommandContext, repoDir string, plan models.P
 		}
 	}
 
-	return ProjectResult{ApplySuccess: output}
+	return ProjectResult{ApplySuccess: output, Parallelism: tfParallelism, LockTimeout: tfLockTimeout, ExitCode: exitCode(nil), Providers: providers, Targets: ctx.Command.Targets, VarFiles: ctx.Command.VarFiles}
+}
+
+func (a *ApplyExecutor) stalePlanFailure() string {
+	if a.stalePlanComment == "" {
+		return DefaultStalePlanComment
+	}
+	return a.stalePlanComment
 }
 
 func (a *ApplyExecutor) failureResponse(ctx *CommandContext, msg string) CommandResponse {
 	ctx.Log.Warn(msg)
-	a.githubStatus.Update(ctx.BaseRepo, ctx.Pull, Failure, ApplyStep)
+	a.githubStatus.Update(ctx, Failure, ApplyStep)
 	return CommandResponse{Failure: msg}
 }
 
 func (a *ApplyExecutor) errorResponse(ctx *CommandContext, err error) CommandResponse {
 	ctx.Log.Err(err.Error())
-	a.githubStatus.Update(ctx.BaseRepo, ctx.Pull, Error, ApplyStep)
+	a.githubStatus.Update(ctx, Error, ApplyStep)
 	return CommandResponse{Error: err}
 }
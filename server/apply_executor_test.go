@@ -0,0 +1,63 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/hootsuite/atlantis/github/mocks"
+	"github.com/hootsuite/atlantis/logging"
+	"github.com/hootsuite/atlantis/models"
+	"github.com/hootsuite/atlantis/models/fixtures"
+	. "github.com/hootsuite/atlantis/testing_util"
+	. "github.com/petergtz/pegomock"
+)
+
+func TestApplyExecutor_unplannedProjects(t *testing.T) {
+	t.Log("modified projects without a plan should be returned and planned projects shouldn't")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	a := ApplyExecutor{github: client}
+	ctx := &CommandContext{
+		BaseRepo: fixtures.Repo,
+		Pull:     fixtures.Pull,
+		Command:  &Command{Name: Apply, Environment: "default"},
+		Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+	When(client.GetModifiedFiles(fixtures.Repo, fixtures.Pull)).ThenReturn([]string{"network/main.tf", "database/main.tf", "README.md"}, nil)
+
+	unplanned, err := a.unplannedProjects(ctx, plansAt("network", "app"))
+	Ok(t, err)
+	Equals(t, []models.Project{models.NewProject(fixtures.Repo.FullName, "database")}, unplanned)
+
+	t.Log("if every modified project was planned there should be none")
+	unplanned, err = a.unplannedProjects(ctx, plansAt("network", "database"))
+	Ok(t, err)
+	Equals(t, 0, len(unplanned))
+}
+
+func TestApplyExecutor_unplannedProjectsErr(t *testing.T) {
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	a := ApplyExecutor{github: client}
+	ctx := &CommandContext{BaseRepo: fixtures.Repo, Pull: fixtures.Pull, Command: &Command{Name: Apply}}
+	When(client.GetModifiedFiles(fixtures.Repo, fixtures.Pull)).ThenReturn(nil, errors.New("err"))
+
+	_, err := a.unplannedProjects(ctx, nil)
+	Equals(t, "getting modified files: err", err.Error())
+}
+
+func TestPlanFile(t *testing.T) {
+	t.Log("plan and apply should agree on where each project's plan is")
+	Equals(t, "/clone/path/to/project/staging.tfplan", planFile("/clone", "path/to/project", "staging"))
+	Equals(t, "/clone/default.tfplan", planFile("/clone", ".", "default"))
+}
+
+func TestDirPlans(t *testing.T) {
+	t.Log("only the plan of the -d project should be applied")
+	plans := plansAt("network", "database", ".")
+	Equals(t, plansAt("database"), dirPlans(plans, models.NewProject(fixtures.Repo.FullName, "database")))
+	Equals(t, plansAt("."), dirPlans(plans, models.NewProject(fixtures.Repo.FullName, ".")))
+	Equals(t, 0, len(dirPlans(plans, models.NewProject(fixtures.Repo.FullName, "app"))))
+}
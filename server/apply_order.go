@@ -0,0 +1,76 @@
+package server
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/hootsuite/atlantis/models"
+)
+
+// applyLevels groups plans into levels that are applied one after the other.
+// Each plan is in a later level than the plans of the projects it depends on,
+// so the plans in a level don't depend on each other and can be applied at
+// the same time. dependsOn maps a project's path to the paths of the projects
+// it depends on. Dependencies on projects that aren't being applied are
+// ignored since there's nothing to wait for. It returns an error if the
+// dependencies have a cycle.
+func applyLevels(plans []models.Plan, dependsOn map[string][]string) ([][]models.Plan, error) {
+	applying := make(map[string]bool)
+	for _, p := range plans {
+		applying[p.Project.Path] = true
+	}
+
+	levels := make(map[string]int)
+	var levelOf func(projectPath string, visiting []string) (int, error)
+	levelOf = func(projectPath string, visiting []string) (int, error) {
+		if l, ok := levels[projectPath]; ok {
+			return l, nil
+		}
+		for i, v := range visiting {
+			if v == projectPath {
+				return 0, fmt.Errorf("projects depend on each other: %s", strings.Join(append(visiting[i:], projectPath), " -> "))
+			}
+		}
+		level := 0
+		for _, dep := range dependsOn[projectPath] {
+			if !applying[dep] {
+				continue
+			}
+			depLevel, err := levelOf(dep, append(visiting, projectPath))
+			if err != nil {
+				return 0, err
+			}
+			if depLevel+1 > level {
+				level = depLevel + 1
+			}
+		}
+		levels[projectPath] = level
+		return level, nil
+	}
+
+	var grouped [][]models.Plan
+	for _, p := range plans {
+		level, err := levelOf(p.Project.Path, nil)
+		if err != nil {
+			return nil, err
+		}
+		for len(grouped) <= level {
+			grouped = append(grouped, nil)
+		}
+		grouped[level] = append(grouped[level], p)
+	}
+	return grouped, nil
+}
+
+// dependsOnPaths converts config's depends_on, which are relative to the repo
+// root, to project paths.
+func dependsOnPaths(config ProjectConfig) []string {
+	var paths []string
+	for _, dep := range config.DependsOn {
+		paths = append(paths, path.Clean(strings.TrimPrefix(dep, "/")))
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/hootsuite/atlantis/locking"
+	lockmocks "github.com/hootsuite/atlantis/locking/mocks"
+	"github.com/hootsuite/atlantis/logging"
+	"github.com/hootsuite/atlantis/metrics"
+	"github.com/hootsuite/atlantis/models"
+	"github.com/hootsuite/atlantis/models/fixtures"
+	. "github.com/hootsuite/atlantis/testing_util"
+	. "github.com/petergtz/pegomock"
+)
+
+func plansAt(paths ...string) []models.Plan {
+	var plans []models.Plan
+	for _, p := range paths {
+		plans = append(plans, models.Plan{Project: models.NewProject("owner/repo", p)})
+	}
+	return plans
+}
+
+func TestApplyLevels(t *testing.T) {
+	plans := plansAt("network", "database", "app", "monitoring")
+	levels, err := applyLevels(plans, map[string][]string{
+		"database": {"network"},
+		"app":      {"database", "network"},
+		// dependencies that aren't being applied don't need to be waited for
+		"monitoring": {"unchanged"},
+	})
+	Ok(t, err)
+	Equals(t, [][]models.Plan{
+		plansAt("network", "monitoring"),
+		plansAt("database"),
+		plansAt("app"),
+	}, levels)
+}
+
+func TestApplyLevels_NoDependencies(t *testing.T) {
+	t.Log("without dependencies everything should be applied together")
+	plans := plansAt("staging", "production")
+	levels, err := applyLevels(plans, nil)
+	Ok(t, err)
+	Equals(t, [][]models.Plan{plans}, levels)
+}
+
+func TestApplyLevels_Cycle(t *testing.T) {
+	_, err := applyLevels(plansAt("a", "b", "c"), map[string][]string{
+		"a": {"b"},
+		"b": {"c"},
+		"c": {"a"},
+	})
+	Assert(t, err != nil, "expected an error")
+	Equals(t, "projects depend on each other: a -> b -> c -> a", err.Error())
+}
+
+func TestDependsOnPaths(t *testing.T) {
+	Equals(t, []string{".", "database", "network"}, dependsOnPaths(ProjectConfig{DependsOn: []string{"network/", "/database", "./"}}))
+}
+
+func TestApplyExecutor_applyLevels(t *testing.T) {
+	t.Log("if a project fails to apply, the later levels shouldn't be applied")
+	RegisterMockTestingT(t)
+	locker := lockmocks.NewMockLocker()
+	ctx := &CommandContext{
+		BaseRepo: fixtures.Repo,
+		Pull:     fixtures.Pull,
+		User:     fixtures.User,
+		Command:  &Command{Name: Apply, Environment: "default"},
+		Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+	network := plansAt("network")[0]
+	When(locker.TryLock(network.Project, "default", fixtures.Pull, fixtures.User)).ThenReturn(locking.TryLockResponse{}, errors.New("err"))
+	a := ApplyExecutor{
+		locker:           locker,
+		parallelApplies:  2,
+		projectDurations: metrics.NewRegistry().NewHistogramVec("durations", "", nil, metrics.DefaultBuckets),
+	}
+
+	results := a.applyLevels(ctx, "/repo", [][]models.Plan{plansAt("network"), plansAt("database")})
+	Equals(t, "acquiring lock: err", results["network"].Error.Error())
+	Equals(t, ProjectResult{Path: "database", Failure: "Not applied because `network` failed to apply and had to be applied first."}, results["database"])
+	locker.VerifyWasCalled(Never()).TryLock(plansAt("database")[0].Project, "default", fixtures.Pull, fixtures.User)
+}
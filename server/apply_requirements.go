@@ -0,0 +1,75 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/hootsuite/atlantis/github"
+	"github.com/hootsuite/atlantis/models"
+	"github.com/pkg/errors"
+)
+
+// ApplyRequirements checks the requirements a pull request must meet before
+// running a command that changes infrastructure: apply, destroy and state rm.
+// Admins can bypass them in an emergency with --override.
+type ApplyRequirements struct {
+	Github github.Client
+	// RequireApproval is true if the pull request must be approved
+	RequireApproval bool
+	// RequireCodeOwnersApproval is true if each project must be approved by
+	// one of its code owners
+	RequireCodeOwnersApproval bool
+	CodeOwnersApproval        *CodeOwnersApproval
+	EnvironmentApproval       *EnvironmentApproval
+	AdminOverride             *AdminOverride
+}
+
+// CheckPull checks the requirements that don't depend on the projects the
+// command runs in. It returns a failure if they aren't met and true if they
+// were overridden, in which case CheckProjects should be skipped.
+func (r *ApplyRequirements) CheckPull(ctx *CommandContext) (overridden bool, failure string, err error) {
+	if ctx.Command.Override {
+		failure, err := r.AdminOverride.Check(ctx)
+		if err != nil {
+			return false, "", errors.Wrap(err, "checking if user can override")
+		}
+		if failure != "" {
+			return false, failure, nil
+		}
+		return true, "", nil
+	}
+	if r.RequireApproval {
+		approved, err := r.Github.PullIsApproved(ctx.BaseRepo, ctx.Pull)
+		if err != nil {
+			return false, "", errors.Wrap(err, "checking if pull request was approved")
+		}
+		if !approved {
+			return false, fmt.Sprintf("Pull request must be approved before running %s.", ctx.Command.Name), nil
+		}
+		ctx.Log.Info("confirmed pull request was approved")
+	}
+	return false, "", nil
+}
+
+// CheckProjects checks that each of projects has the approvals it needs from
+// its code owners and for ctx.Command.Environment. It returns a failure
+// listing the approvals that are still missing.
+func (r *ApplyRequirements) CheckProjects(ctx *CommandContext, projects []models.Project) (string, error) {
+	if r.RequireCodeOwnersApproval {
+		missing, err := r.CodeOwnersApproval.MissingApprovals(ctx, projects)
+		if err != nil {
+			return "", errors.Wrap(err, "checking for code owner approvals")
+		}
+		if len(missing) > 0 {
+			return formatMissingApprovals(ctx.Command.Name, missing), nil
+		}
+		ctx.Log.Info("confirmed each project was approved by a code owner")
+	}
+	outstanding, err := r.EnvironmentApproval.Outstanding(ctx, projects)
+	if err != nil {
+		return "", errors.Wrap(err, "checking for environment approvals")
+	}
+	if len(outstanding) > 0 {
+		return formatOutstandingApprovals(ctx.Command.Name, ctx.Command.Environment, outstanding), nil
+	}
+	return "", nil
+}
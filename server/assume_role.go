@@ -0,0 +1,118 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+)
+
+// assumeRoleProfile is the name of the profile in the AWS config file we
+// write for terraform.
+const assumeRoleProfile = "atlantis"
+
+// invalidSessionNameChars matches characters that aren't allowed in an
+// assume role session name.
+var invalidSessionNameChars = regexp.MustCompile(`[^\w+=,.@-]`)
+
+// assumeRoleEnvVars returns the environment variables that make terraform
+// assume the role configured for ctx.Command.Environment in config. Rather
+// than assuming the role ourselves, we write an AWS config file with a
+// profile for the role so no credentials are ever written or logged. The
+// file starts with the server's own AWS config so the profiles it sets up,
+// ex. the role's source_profile, still apply. The cleanup func removes the
+// file and must be called once terraform is done. If config doesn't set a
+// role, no environment variables are returned.
+func assumeRoleEnvVars(ctx *CommandContext, config ProjectConfig) ([]string, func(), error) {
+	role := config.GetAssumeRole(ctx.Command.Environment)
+	if role == nil {
+		return nil, func() {}, nil
+	}
+
+	profile := &bytes.Buffer{}
+	serverConfig, err := readServerAWSConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(serverConfig) > 0 {
+		profile.Write(serverConfig)
+		fmt.Fprint(profile, "\n")
+	}
+	fmt.Fprintf(profile, "[profile %s]\n", assumeRoleProfile)
+	fmt.Fprintf(profile, "role_arn = %s\n", role.RoleARN)
+	fmt.Fprintf(profile, "role_session_name = %s\n", assumeRoleSessionName(ctx.User.Username))
+	if role.CredentialSource != "" {
+		fmt.Fprintf(profile, "credential_source = %s\n", role.CredentialSource)
+	} else {
+		sourceProfile := role.SourceProfile
+		if sourceProfile == "" {
+			sourceProfile = "default"
+		}
+		fmt.Fprintf(profile, "source_profile = %s\n", sourceProfile)
+	}
+
+	f, err := ioutil.TempFile("", "atlantis-aws-config")
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "creating AWS config file")
+	}
+	cleanup := func() { os.Remove(f.Name()) }
+	if _, err := f.Write(profile.Bytes()); err != nil {
+		f.Close()
+		cleanup()
+		return nil, nil, errors.Wrap(err, "writing AWS config file")
+	}
+	if err := f.Close(); err != nil {
+		cleanup()
+		return nil, nil, errors.Wrap(err, "writing AWS config file")
+	}
+	ctx.Log.Info("running terraform with role %s", role.RoleARN)
+	envVars := []string{
+		"AWS_CONFIG_FILE=" + f.Name(),
+		"AWS_PROFILE=" + assumeRoleProfile,
+		"AWS_SDK_LOAD_CONFIG=1",
+	}
+	if role.CredentialSource == "Environment" {
+		return envVars, cleanup, nil
+	}
+	// credentials in the environment take precedence over the profile so
+	// they're cleared to make sure the role is assumed, unless they're the
+	// credentials that assume it
+	return append(envVars, "AWS_ACCESS_KEY_ID=", "AWS_SECRET_ACCESS_KEY=", "AWS_SESSION_TOKEN="), cleanup, nil
+}
+
+// readServerAWSConfig returns the contents of the AWS config file Atlantis
+// itself runs with, from AWS_CONFIG_FILE or ~/.aws/config, or nothing if it
+// doesn't have one.
+func readServerAWSConfig() ([]byte, error) {
+	path := os.Getenv("AWS_CONFIG_FILE")
+	if path == "" {
+		var err error
+		path, err = homedir.Expand("~/.aws/config")
+		if err != nil {
+			return nil, errors.Wrap(err, "finding the AWS config file")
+		}
+	}
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "reading the AWS config file")
+	}
+	return contents, nil
+}
+
+// assumeRoleSessionName returns the session name to assume a role as for
+// username, so AWS API actions can be correlated with who ran the command.
+func assumeRoleSessionName(username string) string {
+	name := "atlantis-" + invalidSessionNameChars.ReplaceAllString(username, "-")
+	// session names can be at most 64 characters
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hootsuite/atlantis/logging"
+	"github.com/hootsuite/atlantis/models"
+	. "github.com/hootsuite/atlantis/testing_util"
+)
+
+func TestAssumeRoleEnvVars(t *testing.T) {
+	ctx := &CommandContext{
+		User:    models.User{Username: "lkysow"},
+		Command: &Command{Environment: "staging"},
+		Log:     logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+	config := ProjectConfig{AssumeRoles: []AssumeRole{{Environment: "staging", RoleARN: "arn:aws:iam::111111111111:role/atlantis"}}}
+	defer os.Setenv("AWS_CONFIG_FILE", os.Getenv("AWS_CONFIG_FILE"))
+	os.Setenv("AWS_CONFIG_FILE", "/nonexistent/aws/config")
+
+	envVars, cleanup, err := assumeRoleEnvVars(ctx, config)
+	Ok(t, err)
+	Equals(t, 6, len(envVars))
+	configFile := strings.TrimPrefix(envVars[0], "AWS_CONFIG_FILE=")
+	Equals(t, []string{"AWS_PROFILE=atlantis", "AWS_SDK_LOAD_CONFIG=1", "AWS_ACCESS_KEY_ID=", "AWS_SECRET_ACCESS_KEY=", "AWS_SESSION_TOKEN="}, envVars[1:])
+	contents, err := ioutil.ReadFile(configFile)
+	Ok(t, err)
+	Equals(t, "[profile atlantis]\nrole_arn = arn:aws:iam::111111111111:role/atlantis\nrole_session_name = atlantis-lkysow\nsource_profile = default\n", string(contents))
+
+	cleanup()
+	_, err = os.Stat(configFile)
+	Assert(t, os.IsNotExist(err), "expected the config file to be removed but got %v", err)
+}
+
+func TestAssumeRoleEnvVars_ServerConfig(t *testing.T) {
+	t.Log("the server's AWS config should be kept so its profiles still apply")
+	serverConfig, err := ioutil.TempFile("", "atlantis-test")
+	Ok(t, err)
+	defer os.Remove(serverConfig.Name())
+	_, err = serverConfig.WriteString("[profile prod]\nregion = us-east-1\n")
+	Ok(t, err)
+	Ok(t, serverConfig.Close())
+	defer os.Setenv("AWS_CONFIG_FILE", os.Getenv("AWS_CONFIG_FILE"))
+	os.Setenv("AWS_CONFIG_FILE", serverConfig.Name())
+
+	ctx := &CommandContext{
+		User:    models.User{Username: "lkysow"},
+		Command: &Command{Environment: "staging"},
+		Log:     logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+	config := ProjectConfig{AssumeRoles: []AssumeRole{{RoleARN: "arn:aws:iam::111111111111:role/atlantis", CredentialSource: "Environment"}}}
+	envVars, cleanup, err := assumeRoleEnvVars(ctx, config)
+	Ok(t, err)
+	defer cleanup()
+	configFile := strings.TrimPrefix(envVars[0], "AWS_CONFIG_FILE=")
+	Assert(t, configFile != serverConfig.Name(), "expected a new config file")
+	contents, err := ioutil.ReadFile(configFile)
+	Ok(t, err)
+	Equals(t, "[profile prod]\nregion = us-east-1\n\n[profile atlantis]\nrole_arn = arn:aws:iam::111111111111:role/atlantis\nrole_session_name = atlantis-lkysow\ncredential_source = Environment\n", string(contents))
+
+	t.Log("credentials in the environment should be kept when they assume the role")
+	Equals(t, []string{"AWS_PROFILE=atlantis", "AWS_SDK_LOAD_CONFIG=1"}, envVars[1:])
+}
+
+func TestAssumeRoleEnvVars_NoRole(t *testing.T) {
+	ctx := &CommandContext{Command: &Command{Environment: "production"}}
+	config := ProjectConfig{AssumeRoles: []AssumeRole{{Environment: "staging", RoleARN: "arn:aws:iam::111111111111:role/atlantis"}}}
+	envVars, cleanup, err := assumeRoleEnvVars(ctx, config)
+	Ok(t, err)
+	Equals(t, 0, len(envVars))
+	cleanup()
+}
+
+func TestAssumeRoleSessionName(t *testing.T) {
+	Equals(t, "atlantis-lkysow", assumeRoleSessionName("lkysow"))
+	Equals(t, "atlantis-some-user", assumeRoleSessionName("some user"))
+	Equals(t, 64, len(assumeRoleSessionName(strings.Repeat("a", 100))))
+}
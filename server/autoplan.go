@@ -0,0 +1,53 @@
+package server
+
+import (
+	"github.com/hootsuite/atlantis/models"
+)
+
+// Autoplan decides which pull requests are planned automatically when
+// they're opened or new commits are pushed to them, without a comment.
+type Autoplan struct {
+	// Enabled is true if Atlantis runs with --autoplan. Otherwise pull
+	// requests are only planned when commented on.
+	Enabled bool
+	// Verbose is true if automatic plans include their log in their comment,
+	// ex. when Atlantis runs with --default-verbose
+	Verbose bool
+	// repos are the repos whose pull requests are planned
+	repos RepoPatterns
+}
+
+// autoplanActions are the actions of GitHub pull request events that are
+// planned automatically.
+var autoplanActions = map[string]bool{
+	"opened":      true,
+	"reopened":    true,
+	"synchronize": true,
+}
+
+// NewAutoplan returns an Autoplan for the repos in repos, a comma separated
+// list of patterns like --repo-allowlist, ex. hootsuite/*. If repos is empty
+// or includes AllowAllRepos, every repo is allowed.
+func NewAutoplan(enabled bool, repos string) (*Autoplan, error) {
+	patterns, err := NewRepoPatterns(repos)
+	if err != nil {
+		return nil, err
+	}
+	return &Autoplan{Enabled: enabled, repos: patterns}, nil
+}
+
+// ShouldPlan returns true if a pull request event with action in repo
+// should be planned automatically.
+func (a *Autoplan) ShouldPlan(action string, repo models.Repo) bool {
+	if a == nil || !a.Enabled || !autoplanActions[action] {
+		return false
+	}
+	return a.repos.Matches(repo)
+}
+
+// Command returns the command pull requests are planned automatically with.
+// Every environment of the modified projects is planned, like a comment
+// with --all-envs, since there's no comment to say which one.
+func (a *Autoplan) Command() *Command {
+	return &Command{Name: Plan, Environment: "default", AllEnvs: true, Autoplan: true, Verbose: a.Verbose}
+}
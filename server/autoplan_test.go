@@ -0,0 +1,60 @@
+package server_test
+
+import (
+	"testing"
+
+	"github.com/hootsuite/atlantis/models"
+	"github.com/hootsuite/atlantis/server"
+	. "github.com/hootsuite/atlantis/testing_util"
+)
+
+func TestAutoplan_ShouldPlan(t *testing.T) {
+	repo := models.Repo{FullName: "hootsuite/atlantis"}
+
+	t.Log("nothing should be planned unless autoplan is enabled")
+	a, err := server.NewAutoplan(false, "")
+	Ok(t, err)
+	Equals(t, false, a.ShouldPlan("opened", repo))
+
+	t.Log("opened, reopened and updated pull requests should be planned")
+	a, err = server.NewAutoplan(true, "")
+	Ok(t, err)
+	for _, action := range []string{"opened", "reopened", "synchronize"} {
+		Equals(t, true, a.ShouldPlan(action, repo))
+	}
+	for _, action := range []string{"closed", "edited", "labeled"} {
+		Equals(t, false, a.ShouldPlan(action, repo))
+	}
+
+	t.Log("only the repos in the allowlist should be planned")
+	a, err = server.NewAutoplan(true, "hootsuite/atlantis, Lkysow/*")
+	Ok(t, err)
+	Equals(t, true, a.ShouldPlan("opened", repo))
+	Equals(t, true, a.ShouldPlan("opened", models.Repo{FullName: "lkysow/terraform"}))
+	Equals(t, false, a.ShouldPlan("opened", models.Repo{FullName: "hootsuite/other"}))
+
+	t.Log("the repos should be matched like the repo allowlist's")
+	a, err = server.NewAutoplan(true, "GitHub.com/Hootsuite/*")
+	Ok(t, err)
+	Equals(t, true, a.ShouldPlan("opened", models.Repo{FullName: "hootsuite/atlantis", SanitizedCloneURL: "https://github.com/hootsuite/atlantis.git"}))
+	Equals(t, false, a.ShouldPlan("opened", models.Repo{FullName: "hootsuite/atlantis", SanitizedCloneURL: "https://github.example.com/hootsuite/atlantis.git"}))
+	a, err = server.NewAutoplan(true, "hootsuite/other,*")
+	Ok(t, err)
+	Equals(t, true, a.ShouldPlan("opened", repo))
+}
+
+func TestNewAutoplan_InvalidPattern(t *testing.T) {
+	_, err := server.NewAutoplan(true, "hootsuite/[")
+	Assert(t, err != nil, "expected error")
+}
+
+func TestAutoplan_Command(t *testing.T) {
+	t.Log("automatic plans should plan every environment of the modified projects")
+	a, err := server.NewAutoplan(true, "")
+	Ok(t, err)
+	Equals(t, &server.Command{Name: server.Plan, Environment: "default", AllEnvs: true, Autoplan: true}, a.Command())
+
+	t.Log("they should include their log if commands do by default")
+	a.Verbose = true
+	Equals(t, &server.Command{Name: server.Plan, Environment: "default", AllEnvs: true, Autoplan: true, Verbose: true}, a.Command())
+}
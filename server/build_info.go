@@ -0,0 +1,30 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BuildInfo identifies the build of Atlantis that's running. The commit and
+// date are only known if they were set with -ldflags when building.
+type BuildInfo struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+	Date    string `json:"date"`
+}
+
+// String returns the version followed by the commit and date it was built
+// from if they're known, ex. "0.1.2 (commit 9db70b5, built 2017-09-01T12:00:00Z)".
+func (b BuildInfo) String() string {
+	var details []string
+	if b.Commit != "" {
+		details = append(details, "commit "+b.Commit)
+	}
+	if b.Date != "" {
+		details = append(details, "built "+b.Date)
+	}
+	if len(details) == 0 {
+		return b.Version
+	}
+	return fmt.Sprintf("%s (%s)", b.Version, strings.Join(details, ", "))
+}
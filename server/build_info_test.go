@@ -0,0 +1,22 @@
+package server_test
+
+import (
+	"testing"
+
+	"github.com/hootsuite/atlantis/server"
+	. "github.com/hootsuite/atlantis/testing_util"
+)
+
+func TestBuildInfo_String(t *testing.T) {
+	cases := []struct {
+		Build    server.BuildInfo
+		Expected string
+	}{
+		{server.BuildInfo{Version: "0.1.2"}, "0.1.2"},
+		{server.BuildInfo{Version: "0.1.2", Commit: "9db70b5"}, "0.1.2 (commit 9db70b5)"},
+		{server.BuildInfo{Version: "0.1.2", Commit: "9db70b5", Date: "2017-09-01T12:00:00Z"}, "0.1.2 (commit 9db70b5, built 2017-09-01T12:00:00Z)"},
+	}
+	for _, c := range cases {
+		Equals(t, c.Expected, c.Build.String())
+	}
+}
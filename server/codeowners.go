@@ -0,0 +1,258 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hootsuite/atlantis/github"
+	"github.com/hootsuite/atlantis/models"
+	"github.com/pkg/errors"
+)
+
+// codeOwnersFiles are the paths, relative to the repo root, where GitHub looks
+// for a CODEOWNERS file. Like GitHub, we use the first one that exists.
+var codeOwnersFiles = []string{
+	"CODEOWNERS",
+	".github/CODEOWNERS",
+	"docs/CODEOWNERS",
+}
+
+// CodeOwners is a parsed CODEOWNERS file.
+// See https://help.github.com/articles/about-codeowners/.
+type CodeOwners struct {
+	rules []codeOwnersRule
+}
+
+type codeOwnersRule struct {
+	regex  *regexp.Regexp
+	owners []string
+}
+
+// FetchCodeOwners fetches the CODEOWNERS file of repo as of ref using the
+// GitHub API. If the repo doesn't have a CODEOWNERS file, the CodeOwners
+// returned has no rules.
+func FetchCodeOwners(gh github.Client, repo models.Repo, ref string) (CodeOwners, error) {
+	for _, f := range codeOwnersFiles {
+		contents, exists, err := gh.GetFileContents(repo, f, ref)
+		if err != nil {
+			return CodeOwners{}, errors.Wrapf(err, "fetching %s", f)
+		}
+		if exists {
+			return ParseCodeOwners(contents)
+		}
+	}
+	return CodeOwners{}, nil
+}
+
+// ParseCodeOwners parses the contents of a CODEOWNERS file.
+func ParseCodeOwners(contents string) (CodeOwners, error) {
+	var c CodeOwners
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		regex, err := codeOwnersPatternToRegex(fields[0])
+		if err != nil {
+			return c, errors.Wrapf(err, "parsing CODEOWNERS line %d", lineNum)
+		}
+		c.rules = append(c.rules, codeOwnersRule{
+			regex:  regex,
+			owners: fields[1:],
+		})
+	}
+	return c, scanner.Err()
+}
+
+// Owners returns the owners of file, which is relative to the repo root.
+// As with GitHub, the last rule that matches the file takes precedence.
+func (c CodeOwners) Owners(file string) []string {
+	for i := len(c.rules) - 1; i >= 0; i-- {
+		if c.rules[i].regex.MatchString(file) {
+			return c.rules[i].owners
+		}
+	}
+	return nil
+}
+
+// HasRules returns true if the CODEOWNERS file had at least one rule.
+func (c CodeOwners) HasRules() bool {
+	return len(c.rules) > 0
+}
+
+// codeOwnersPatternToRegex converts a CODEOWNERS pattern, which follows the
+// same rules as .gitignore, to a regular expression that matches file paths
+// relative to the repo root.
+func codeOwnersPatternToRegex(pattern string) (*regexp.Regexp, error) {
+	// a pattern with a slash anywhere but the end is relative to the repo root,
+	// otherwise it can match at any depth
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	dirOnly := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+
+	var re bytes.Buffer
+	re.WriteString("^")
+	if !anchored {
+		re.WriteString("(.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			re.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			re.WriteString("[^/]*")
+		case pattern[i] == '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		}
+	}
+	if dirOnly {
+		// a directory pattern matches everything underneath that directory
+		re.WriteString("/.*$")
+	} else {
+		// a pattern that matches a directory also matches everything under it
+		re.WriteString("(/.*)?$")
+	}
+	return regexp.Compile(re.String())
+}
+
+// CodeOwnersApproval checks that each project being applied has been approved
+// by at least one of the code owners of the files modified in that project.
+type CodeOwnersApproval struct {
+	Github github.Client
+}
+
+// MissingApprovals returns a map from project path to the code owners that
+// can approve that project, for each of projects that still needs an
+// approval from a code owner. The CODEOWNERS file is read from the base branch
+// so that a pull request can't change who needs to approve it.
+func (c *CodeOwnersApproval) MissingApprovals(ctx *CommandContext, projects []models.Project) (map[string][]string, error) {
+	codeOwners, err := FetchCodeOwners(c.Github, ctx.BaseRepo, ctx.Pull.BaseBranch)
+	if err != nil {
+		return nil, err
+	}
+	if !codeOwners.HasRules() {
+		ctx.Log.Info("no CODEOWNERS file found so not requiring code owner approval")
+		return nil, nil
+	}
+
+	modifiedFiles, err := c.Github.GetModifiedFiles(ctx.BaseRepo, ctx.Pull)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting modified files")
+	}
+	approvers, err := c.Github.GetApprovers(ctx.BaseRepo, ctx.Pull)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting approvers")
+	}
+	ctx.Log.Info("pull request is approved by: %v", approvers)
+
+	teamMembers := make(map[string][]string)
+	missing := make(map[string][]string)
+	for _, project := range projects {
+		owners := c.projectOwners(codeOwners, project, modifiedFiles)
+		if len(owners) == 0 {
+			continue
+		}
+		approved, err := c.approvedByAny(owners, approvers, teamMembers)
+		if err != nil {
+			return nil, err
+		}
+		if !approved {
+			missing[project.Path] = owners
+		}
+	}
+	return missing, nil
+}
+
+// projectOwners returns the deduplicated and sorted owners of the files in
+// modifiedFiles that are part of project.
+func (c *CodeOwnersApproval) projectOwners(codeOwners CodeOwners, project models.Project, modifiedFiles []string) []string {
+	seen := make(map[string]bool)
+	var owners []string
+	for _, f := range modifiedFiles {
+		if getProjectPath(f) != project.Path {
+			continue
+		}
+		for _, o := range codeOwners.Owners(f) {
+			if !seen[o] {
+				seen[o] = true
+				owners = append(owners, o)
+			}
+		}
+	}
+	sort.Strings(owners)
+	return owners
+}
+
+// approvedByAny returns true if any of approvers is one of owners or is a
+// member of one of the teams in owners. Team members are cached in teamMembers.
+// Owners specified by email can't be mapped to GitHub users so are ignored.
+func (c *CodeOwnersApproval) approvedByAny(owners []string, approvers []string, teamMembers map[string][]string) (bool, error) {
+	matching, err := matchingApprovers(c.Github, owners, approvers, teamMembers)
+	return len(matching) > 0, err
+}
+
+// matchingApprovers returns the users in approvers that are one of owners or
+// are members of one of the teams in owners. Owners are GitHub usernames or
+// org/team names and can be prefixed with an @. Team members are looked up
+// using gh and cached in teamMembers. Owners specified by email can't be mapped
+// to GitHub users so are ignored.
+func matchingApprovers(gh github.Client, owners []string, approvers []string, teamMembers map[string][]string) ([]string, error) {
+	matched := make(map[string]bool)
+	var matching []string
+	for _, owner := range owners {
+		name := strings.TrimPrefix(owner, "@")
+		if strings.Contains(name, "@") {
+			continue
+		}
+		candidates := []string{name}
+		if strings.Contains(name, "/") {
+			members, ok := teamMembers[name]
+			if !ok {
+				split := strings.SplitN(name, "/", 2)
+				var err error
+				members, err = gh.GetTeamMembers(split[0], split[1])
+				if err != nil {
+					return nil, errors.Wrapf(err, "getting members of %s", owner)
+				}
+				teamMembers[name] = members
+			}
+			candidates = members
+		}
+		for _, candidate := range candidates {
+			for _, approver := range approvers {
+				if strings.EqualFold(candidate, approver) && !matched[approver] {
+					matched[approver] = true
+					matching = append(matching, approver)
+				}
+			}
+		}
+	}
+	return matching, nil
+}
+
+// formatMissingApprovals renders the output of MissingApprovals for a comment.
+func formatMissingApprovals(command CommandName, missing map[string][]string) string {
+	var paths []string
+	for p := range missing {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	msg := fmt.Sprintf("Each project must be approved by one of its code owners before running %s. Still waiting on approval for:", command)
+	for _, p := range paths {
+		msg += fmt.Sprintf("\n* `%s`: %s", p, strings.Join(missing[p], ", "))
+	}
+	return msg
+}
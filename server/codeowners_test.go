@@ -0,0 +1,121 @@
+package server_test
+
+import (
+	"log"
+	"os"
+	"testing"
+
+	"github.com/hootsuite/atlantis/github/mocks"
+	"github.com/hootsuite/atlantis/logging"
+	"github.com/hootsuite/atlantis/models"
+	"github.com/hootsuite/atlantis/models/fixtures"
+	"github.com/hootsuite/atlantis/server"
+	. "github.com/hootsuite/atlantis/testing_util"
+	. "github.com/petergtz/pegomock"
+)
+
+var codeOwnersFile = `
+# comments and blank lines are ignored
+
+*                 @default-owner
+*.md              @docs-writer
+/infra/           @hootsuite/infra
+infra/db/**       @dba docs@example.com
+apps/             @app-owner
+/scripts/*.sh     @scripter
+`
+
+func TestCodeOwners_Owners(t *testing.T) {
+	c, err := server.ParseCodeOwners(codeOwnersFile)
+	Ok(t, err)
+	cases := []struct {
+		File     string
+		Expected []string
+	}{
+		{"main.tf", []string{"@default-owner"}},
+		{"README.md", []string{"@docs-writer"}},
+		{"sub/dir/README.md", []string{"@docs-writer"}},
+		{"infra/main.tf", []string{"@hootsuite/infra"}},
+		{"infra/network/main.tf", []string{"@hootsuite/infra"}},
+		{"other/infra/main.tf", []string{"@default-owner"}},
+		{"infra/db/main.tf", []string{"@dba", "docs@example.com"}},
+		{"infra/db/env/prod.tfvars", []string{"@dba", "docs@example.com"}},
+		{"apps/main.tf", []string{"@app-owner"}},
+		{"nested/apps/main.tf", []string{"@app-owner"}},
+		{"scripts/run.sh", []string{"@scripter"}},
+		{"scripts/nested/run.sh", []string{"@default-owner"}},
+	}
+	for _, c2 := range cases {
+		t.Log("testing " + c2.File)
+		Equals(t, c2.Expected, c.Owners(c2.File))
+	}
+}
+
+func TestCodeOwners_NoRules(t *testing.T) {
+	c, err := server.ParseCodeOwners("# only a comment\n")
+	Ok(t, err)
+	Equals(t, false, c.HasRules())
+	Equals(t, []string(nil), c.Owners("main.tf"))
+}
+
+func TestFetchCodeOwners_GithubDir(t *testing.T) {
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	When(client.GetFileContents(fixtures.Repo, ".github/CODEOWNERS", "master")).ThenReturn("* @owner\n", true, nil)
+
+	c, err := server.FetchCodeOwners(client, fixtures.Repo, "master")
+	Ok(t, err)
+	Equals(t, []string{"@owner"}, c.Owners("main.tf"))
+	client.VerifyWasCalledOnce().GetFileContents(fixtures.Repo, "CODEOWNERS", "master")
+	client.VerifyWasCalled(Never()).GetFileContents(fixtures.Repo, "docs/CODEOWNERS", "master")
+}
+
+func TestMissingApprovals(t *testing.T) {
+	t.Log("the CODEOWNERS file should be read from the base branch")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	When(client.GetFileContents(fixtures.Repo, "CODEOWNERS", fixtures.Pull.BaseBranch)).ThenReturn(codeOwnersFile, true, nil)
+	When(client.GetModifiedFiles(fixtures.Repo, fixtures.Pull)).ThenReturn([]string{
+		"main.tf",
+		"infra/main.tf",
+		"infra/db/env/prod.tfvars",
+		"apps/main.tf",
+	}, nil)
+	When(client.GetApprovers(fixtures.Repo, fixtures.Pull)).ThenReturn([]string{"Default-Owner", "infra-member"}, nil)
+	When(client.GetTeamMembers("hootsuite", "infra")).ThenReturn([]string{"infra-member"}, nil)
+
+	c := server.CodeOwnersApproval{Github: client}
+	ctx := &server.CommandContext{
+		BaseRepo: fixtures.Repo,
+		Pull:     fixtures.Pull,
+		Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+	missing, err := c.MissingApprovals(ctx, []models.Project{
+		models.NewProject(fixtures.Repo.FullName, "."),
+		models.NewProject(fixtures.Repo.FullName, "infra"),
+		models.NewProject(fixtures.Repo.FullName, "infra/db"),
+		models.NewProject(fixtures.Repo.FullName, "apps"),
+		models.NewProject(fixtures.Repo.FullName, "unmodified"),
+	})
+	Ok(t, err)
+	Equals(t, map[string][]string{
+		"infra/db": {"@dba", "docs@example.com"},
+		"apps":     {"@app-owner"},
+	}, missing)
+}
+
+func TestMissingApprovals_NoCodeOwners(t *testing.T) {
+	t.Log("if there is no CODEOWNERS file then nothing needs approval")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	c := server.CodeOwnersApproval{Github: client}
+	ctx := &server.CommandContext{
+		BaseRepo: fixtures.Repo,
+		Pull:     fixtures.Pull,
+		Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+	missing, err := c.MissingApprovals(ctx, []models.Project{models.NewProject(fixtures.Repo.FullName, ".")})
+	Ok(t, err)
+	Equals(t, 0, len(missing))
+	client.VerifyWasCalled(Never()).GetApprovers(fixtures.Repo, fixtures.Pull)
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"strings"
+	"time"
+)
+
+// runEnvs returns the result of run for ctx.Command.Environment or, if the
+// command set more than one environment, ex. with -e staging,prod, the
+// results of running it in each of ctx.Command.Environments in turn. Each
+// environment is locked on its own so if one fails, ex. because another
+// command is running in it, the others still run and its failure is one of
+// the results. Each result's Environment is the one it ran in so they're
+// commented grouped by environment. Each environment runs with ctx, with
+// ctx.Command set to the command for that environment until run returns, so
+// what it records on ctx, ex. the acknowledgement comment, is kept.
+func runEnvs(ctx *CommandContext, run func(ctx *CommandContext) CommandResponse) CommandResponse {
+	if len(ctx.Command.Environments) == 0 {
+		return run(ctx)
+	}
+	command := ctx.Command
+	defer func() { ctx.Command = command }()
+	res := CommandResponse{ProjectResults: []ProjectResult{}, envDurations: make(map[string]time.Duration)}
+	for _, env := range command.Environments {
+		envCommand := *command
+		envCommand.Environment = env
+		envCommand.Environments = nil
+		ctx.Command = &envCommand
+		ctx.Log.Info("running %s in environment %q", command.Name, env)
+
+		start := time.Now()
+		envRes := run(ctx)
+		res.envDurations[env] = time.Since(start)
+		switch {
+		case envRes.Error != nil:
+			res.ProjectResults = append(res.ProjectResults, ProjectResult{Environment: env, Error: envRes.Error})
+		case envRes.Failure != "":
+			res.ProjectResults = append(res.ProjectResults, ProjectResult{Environment: env, Failure: envRes.Failure})
+		case len(envRes.ProjectResults) == 0:
+			res.ProjectResults = append(res.ProjectResults, ProjectResult{Environment: env, Failure: noMatchingProjectsDescription + "."})
+		}
+		for _, result := range envRes.ProjectResults {
+			result.Environment = env
+			res.ProjectResults = append(res.ProjectResults, result)
+		}
+		// every environment skips the same projects
+		if envRes.SkippedProjects > res.SkippedProjects {
+			res.SkippedProjects = envRes.SkippedProjects
+		}
+		if len(envRes.AvailableProjects) > 0 {
+			res.AvailableProjects = envRes.AvailableProjects
+		}
+	}
+	return res
+}
+
+// commandEnvs returns the environments command runs in: each of its
+// Environments if it set more than one, otherwise its Environment.
+func commandEnvs(command *Command) []string {
+	if len(command.Environments) > 0 {
+		return command.Environments
+	}
+	return []string{command.Environment}
+}
+
+// describeEnvs describes the environments command runs in, ex. "staging, prod".
+func describeEnvs(command *Command) string {
+	return strings.Join(commandEnvs(command), ", ")
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hootsuite/atlantis/logging"
+	"github.com/hootsuite/atlantis/metrics"
+	"github.com/hootsuite/atlantis/models"
+	. "github.com/hootsuite/atlantis/testing_util"
+)
+
+func TestRunEnvs_OneEnvironment(t *testing.T) {
+	ctx := &CommandContext{Command: &Command{Name: Plan, Environment: "staging"}}
+	res := runEnvs(ctx, func(envCtx *CommandContext) CommandResponse {
+		Equals(t, ctx, envCtx)
+		return CommandResponse{Failure: "failure"}
+	})
+	t.Log("without a list of environments the result should be returned as it is")
+	Equals(t, CommandResponse{Failure: "failure"}, res)
+}
+
+func TestRunEnvs_Environments(t *testing.T) {
+	t.Log("each environment should run in turn and a failure in one shouldn't stop the others")
+	ctx := &CommandContext{
+		Command: &Command{Name: Plan, Environment: "staging,prod,qa,dev", Environments: []string{"staging", "prod", "qa", "dev"}},
+		Log:     logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+	var ran []string
+	res := runEnvs(ctx, func(envCtx *CommandContext) CommandResponse {
+		env := envCtx.Command.Environment
+		ran = append(ran, env)
+		Equals(t, []string(nil), envCtx.Command.Environments)
+		Assert(t, envCtx == ctx, "expected the environment to run with ctx")
+		ctx.ackCommentID++
+		switch env {
+		case "prod":
+			return CommandResponse{Failure: "locked"}
+		case "qa":
+			return CommandResponse{Error: errors.New("err")}
+		case "dev":
+			return CommandResponse{}
+		}
+		return CommandResponse{ProjectResults: []ProjectResult{{Path: "a"}, {Path: "b"}}, SkippedProjects: 2}
+	})
+
+	Equals(t, []string{"staging", "prod", "qa", "dev"}, ran)
+	Equals(t, "staging,prod,qa,dev", ctx.Command.Environment)
+	Equals(t, 4, len(res.envDurations))
+	res.envDurations = nil
+	Equals(t, CommandResponse{
+		ProjectResults: []ProjectResult{
+			{Path: "a", Environment: "staging"},
+			{Path: "b", Environment: "staging"},
+			{Environment: "prod", Failure: "locked"},
+			{Environment: "qa", Error: errors.New("err")},
+			{Environment: "dev", Failure: "No matching projects."},
+		},
+		SkippedProjects: 2,
+	}, res)
+	t.Log("what each environment records on the context should be kept")
+	Equals(t, 4, ctx.ackCommentID)
+}
+
+func TestRunEnvs_Metrics(t *testing.T) {
+	t.Log("a command run in more than one environment should be recorded for each of them")
+	registry := metrics.NewRegistry()
+	m := NewCommandMetrics(registry)
+	ctx := &CommandContext{
+		BaseRepo: models.Repo{FullName: "owner/repo"},
+		Command:  &Command{Name: Plan, Environment: "staging,prod", Environments: []string{"staging", "prod"}},
+		Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+	res := runEnvs(ctx, func(envCtx *CommandContext) CommandResponse {
+		if envCtx.Command.Environment == "prod" {
+			return CommandResponse{Failure: "locked"}
+		}
+		return CommandResponse{ProjectResults: []ProjectResult{{Path: "."}}}
+	})
+	m.Record(ctx, Plan, res, time.Second)
+
+	var buf bytes.Buffer
+	Ok(t, registry.Write(&buf))
+	for _, line := range []string{
+		`atlantis_commands_total{repo="owner/repo",environment="prod",command="plan",status="failure"} 1`,
+		`atlantis_commands_total{repo="owner/repo",environment="staging",command="plan",status="success"} 1`,
+		`atlantis_command_duration_seconds_count{repo="owner/repo",environment="prod",command="plan"} 1`,
+		`atlantis_command_duration_seconds_count{repo="owner/repo",environment="staging",command="plan"} 1`,
+	} {
+		Assert(t, strings.Contains(buf.String(), line+"\n"), "expected %q in %q", line, buf.String())
+	}
+	Assert(t, !strings.Contains(buf.String(), "staging,prod"), "expected no series for the list of environments in %q", buf.String())
+}
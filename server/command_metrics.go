@@ -0,0 +1,72 @@
+package server
+
+import (
+	"time"
+
+	"github.com/hootsuite/atlantis/metrics"
+)
+
+// CommandMetrics records how many commands ran and how long they took, and
+// how long they waited for the environment's lock, for the metrics API.
+// A nil CommandMetrics records nothing.
+type CommandMetrics struct {
+	commands  *metrics.CounterVec
+	durations *metrics.HistogramVec
+	lockWaits *metrics.HistogramVec
+}
+
+// NewCommandMetrics registers the command metrics with registry.
+func NewCommandMetrics(registry *metrics.Registry) *CommandMetrics {
+	return &CommandMetrics{
+		commands: registry.NewCounterVec(
+			"atlantis_commands_total",
+			"How many commands ran, by their final status.",
+			[]string{"repo", "environment", "command", "status"}),
+		durations: registry.NewHistogramVec(
+			"atlantis_command_duration_seconds",
+			"How long it took to run a command for all of its projects.",
+			[]string{"repo", "environment", "command"},
+			metrics.DefaultBuckets),
+		lockWaits: registry.NewHistogramVec(
+			"atlantis_lock_wait_seconds",
+			"How long a command was queued waiting for another command in the same environment.",
+			[]string{"repo", "environment", "command"},
+			metrics.DefaultBuckets),
+	}
+}
+
+// Record records that command finished with res after running for duration.
+// A command that ran in more than one environment is recorded for each of
+// them, with its status and how long it took in that environment.
+func (m *CommandMetrics) Record(ctx *CommandContext, command CommandName, res CommandResponse, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	if len(res.envDurations) == 0 {
+		m.record(ctx, ctx.Command.Environment, command, res.Status(), duration)
+		return
+	}
+	for _, env := range commandEnvs(ctx.Command) {
+		envRes := CommandResponse{}
+		for _, result := range res.ProjectResults {
+			if result.Environment == env {
+				envRes.ProjectResults = append(envRes.ProjectResults, result)
+			}
+		}
+		m.record(ctx, env, command, envRes.Status(), res.envDurations[env])
+	}
+}
+
+func (m *CommandMetrics) record(ctx *CommandContext, env string, command CommandName, status Status, duration time.Duration) {
+	labels := []string{ctx.BaseRepo.FullName, env, command.String()}
+	m.commands.Inc(append(labels, status.String()))
+	m.durations.Observe(labels, duration.Seconds())
+}
+
+// RecordLockWait records that command waited for wait to lock env.
+func (m *CommandMetrics) RecordLockWait(ctx *CommandContext, command CommandName, env string, wait time.Duration) {
+	if m == nil {
+		return
+	}
+	m.lockWaits.Observe([]string{ctx.BaseRepo.FullName, env, command.String()}, wait.Seconds())
+}
@@ -0,0 +1,42 @@
+package server_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hootsuite/atlantis/metrics"
+	"github.com/hootsuite/atlantis/server"
+	. "github.com/hootsuite/atlantis/testing_util"
+)
+
+func TestCommandMetrics_Record(t *testing.T) {
+	t.Log("each command should be counted by its final status and its duration recorded")
+	registry := metrics.NewRegistry()
+	m := server.NewCommandMetrics(registry)
+	ctx := reactionsCtx(1)
+	ctx.Command = &server.Command{Name: server.Plan, Environment: "staging"}
+	m.Record(ctx, server.Plan, server.CommandResponse{ProjectResults: []server.ProjectResult{{Path: "."}}}, 2*time.Second)
+	m.Record(ctx, server.Plan, server.CommandResponse{Failure: "failed"}, time.Second)
+
+	var buf bytes.Buffer
+	Ok(t, registry.Write(&buf))
+	for _, line := range []string{
+		`atlantis_commands_total{repo="hootsuite/atlantis",environment="staging",command="plan",status="failure"} 1`,
+		`atlantis_commands_total{repo="hootsuite/atlantis",environment="staging",command="plan",status="success"} 1`,
+		`atlantis_command_duration_seconds_sum{repo="hootsuite/atlantis",environment="staging",command="plan"} 3`,
+		`atlantis_command_duration_seconds_count{repo="hootsuite/atlantis",environment="staging",command="plan"} 2`,
+	} {
+		Assert(t, strings.Contains(buf.String(), line+"\n"), "expected %q in %q", line, buf.String())
+	}
+}
+
+func TestCommandMetrics_Nil(t *testing.T) {
+	t.Log("a nil CommandMetrics should record nothing")
+	var m *server.CommandMetrics
+	ctx := reactionsCtx(1)
+	ctx.Command = &server.Command{Name: server.Apply}
+	m.Record(ctx, server.Apply, server.CommandResponse{}, time.Second)
+	m.RecordLockWait(ctx, server.Apply, "default", time.Second)
+}
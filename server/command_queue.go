@@ -0,0 +1,84 @@
+package server
+
+import (
+	"sync"
+)
+
+// CommandQueue runs commands on a fixed number of workers so a burst of
+// comments can't start an unbounded number of commands at once. Commands
+// start in the order they were commented on whichever worker is free. They
+// aren't run one at a time per pull request: commands for different
+// environments of a pull request run at the same time and ConcurrentRunLocker
+// stops two commands running in the same environment. Up to a fixed number of
+// commands wait for a worker and more are rejected until the workers catch up.
+// Queued commands are tracked by activeCommands so they aren't dropped when
+// Atlantis shuts down.
+type CommandQueue struct {
+	mutex          sync.Mutex
+	cond           *sync.Cond
+	queueSize      int
+	activeCommands *ActiveCommands
+	// queued are the commands waiting for a worker, oldest first
+	queued []queuedCommand
+	// idle is how many workers are waiting for a command.
+	idle int
+}
+
+// queuedCommand is a command waiting for a worker, and the functions from
+// ActiveCommands.Queue to call when it's taken off the queue and once it's
+// been run.
+type queuedCommand struct {
+	ctx      *CommandContext
+	dequeued func()
+	done     func()
+}
+
+// NewCommandQueue starts workers that run commands with run, one at a time,
+// while up to queueSize more wait for them.
+func NewCommandQueue(workers int, queueSize int, activeCommands *ActiveCommands, run func(ctx *CommandContext)) *CommandQueue {
+	q := &CommandQueue{
+		queueSize:      queueSize,
+		activeCommands: activeCommands,
+	}
+	q.cond = sync.NewCond(&q.mutex)
+	for i := 0; i < workers; i++ {
+		go q.work(run)
+	}
+	return q
+}
+
+// Enqueue queues ctx to run after the commands already queued. It returns
+// false without queuing ctx if it can't start right away and the queue is
+// full.
+func (q *CommandQueue) Enqueue(ctx *CommandContext) bool {
+	dequeued, done := q.activeCommands.Queue(ctx)
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	startsNow := q.idle > len(q.queued)
+	if !startsNow && len(q.queued) >= q.queueSize {
+		done()
+		return false
+	}
+	q.queued = append(q.queued, queuedCommand{ctx: ctx, dequeued: dequeued, done: done})
+	q.cond.Signal()
+	return true
+}
+
+// work runs the oldest queued command with run until Atlantis exits.
+func (q *CommandQueue) work(run func(ctx *CommandContext)) {
+	for {
+		q.mutex.Lock()
+		q.idle++
+		for len(q.queued) == 0 {
+			q.cond.Wait()
+		}
+		q.idle--
+		c := q.queued[0]
+		q.queued = q.queued[1:]
+		q.mutex.Unlock()
+
+		c.dequeued()
+		run(c.ctx)
+		c.done()
+	}
+}
@@ -0,0 +1,143 @@
+package server_test
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/hootsuite/atlantis/models"
+	"github.com/hootsuite/atlantis/server"
+	. "github.com/hootsuite/atlantis/testing_util"
+)
+
+func queueCtx(pullNum int, env string) *server.CommandContext {
+	return &server.CommandContext{
+		BaseRepo: models.Repo{FullName: "owner/repo"},
+		Pull:     models.PullRequest{Num: pullNum},
+		Command:  &server.Command{Environment: env},
+	}
+}
+
+func TestCommandQueue_Ordered(t *testing.T) {
+	t.Log("commands should start in the order they were queued")
+	started := make(chan string)
+	release := make(chan bool)
+	q := server.NewCommandQueue(1, 10, nil, func(ctx *server.CommandContext) {
+		started <- ctx.Command.Environment
+		<-release
+	})
+	envs := []string{"a", "b", "c", "d", "e"}
+	for _, env := range envs {
+		Assert(t, q.Enqueue(queueCtx(1, env)), "expected %s to be queued", env)
+	}
+	for _, env := range envs {
+		Equals(t, env, <-started)
+		release <- true
+	}
+}
+
+func TestCommandQueue_StuckCommand(t *testing.T) {
+	t.Log("a stuck command should only hold up its own worker")
+	ran := make(chan string)
+	release := make(chan bool)
+	q := server.NewCommandQueue(2, 10, nil, func(ctx *server.CommandContext) {
+		if ctx.Command.Environment == "stuck" {
+			<-release
+		}
+		ran <- ctx.Command.Environment
+	})
+	Assert(t, q.Enqueue(queueCtx(1, "stuck")), "expected the stuck command to be queued")
+	Assert(t, q.Enqueue(queueCtx(1, "other")), "expected the pull request's next command to be queued")
+	for pullNum := 2; pullNum <= 5; pullNum++ {
+		Assert(t, q.Enqueue(queueCtx(pullNum, "other")), "expected pull %d's command to be queued", pullNum)
+	}
+	for i := 0; i < 5; i++ {
+		Equals(t, "other", <-ran)
+	}
+
+	release <- true
+	Equals(t, "stuck", <-ran)
+}
+
+func TestCommandQueue_Environments(t *testing.T) {
+	t.Log("commands for different environments of a pull request should run at the same time")
+	locker := server.NewConcurrentRunLocker()
+	locked := make(chan string)
+	release := make(chan bool)
+	q := server.NewCommandQueue(2, 10, nil, func(ctx *server.CommandContext) {
+		unlock, ok := locker.TryLock(ctx.BaseRepo.FullName, ctx.Command.Environment, ctx.Pull.Num)
+		if !ok {
+			locked <- "failed to lock " + ctx.Command.Environment
+			return
+		}
+		defer unlock()
+		locked <- ctx.Command.Environment
+		<-release
+	})
+	plan := queueCtx(1, "staging")
+	plan.Command.Name = server.Plan
+	apply := queueCtx(1, "production")
+	apply.Command.Name = server.Apply
+	Assert(t, q.Enqueue(plan), "expected the plan to be queued")
+	Assert(t, q.Enqueue(apply), "expected the apply to be queued")
+	// both hold their environment's lock before either is released
+	Equals(t, []string{"production", "staging"}, sortedStrings(<-locked, <-locked))
+	release <- true
+	release <- true
+}
+
+func TestCommandQueue_SameEnvironment(t *testing.T) {
+	t.Log("commands for the same environment of a pull request should wait for each other's lock in the order they were queued")
+	locker := server.NewConcurrentRunLocker()
+	queued := make(chan bool)
+	ran := make(chan string)
+	release := make(chan bool)
+	q := server.NewCommandQueue(2, 10, nil, func(ctx *server.CommandContext) {
+		unlock, ok, _ := locker.Lock(ctx.BaseRepo.FullName, ctx.Command.Environment, ctx.Pull.Num, time.Minute, func() { queued <- true })
+		if !ok {
+			ran <- "failed to lock " + ctx.Command.Name.String()
+			return
+		}
+		defer unlock()
+		ran <- ctx.Command.Name.String()
+		<-release
+	})
+	plan := queueCtx(1, "staging")
+	plan.Command.Name = server.Plan
+	apply := queueCtx(1, "staging")
+	apply.Command.Name = server.Apply
+	Assert(t, q.Enqueue(plan), "expected the plan to be queued")
+	Equals(t, "plan", <-ran)
+	Assert(t, q.Enqueue(apply), "expected the apply to be queued")
+	<-queued
+	release <- true
+	Equals(t, "apply", <-ran)
+	release <- true
+}
+
+// sortedStrings returns strs sorted.
+func sortedStrings(strs ...string) []string {
+	sort.Strings(strs)
+	return strs
+}
+
+func TestCommandQueue_Full(t *testing.T) {
+	t.Log("commands should be rejected while the queue is full")
+	started := make(chan bool)
+	release := make(chan bool)
+	q := server.NewCommandQueue(1, 1, nil, func(ctx *server.CommandContext) {
+		started <- true
+		<-release
+	})
+	Assert(t, q.Enqueue(queueCtx(1, "running")), "expected the first command to be queued")
+	<-started
+	Assert(t, q.Enqueue(queueCtx(2, "queued")), "expected the second command to be queued")
+	Assert(t, !q.Enqueue(queueCtx(3, "rejected")), "expected the third command to be rejected")
+
+	release <- true
+	<-started
+	Assert(t, q.Enqueue(queueCtx(3, "queued")), "expected a command to be queued once the queue has room")
+	release <- true
+	<-started
+	release <- true
+}
@@ -0,0 +1,87 @@
+package server
+
+import "github.com/hootsuite/atlantis/github"
+
+// ValidReactions are the reactions GitHub supports on comments.
+// See https://developer.github.com/v3/reactions/#reaction-types.
+var ValidReactions = []string{"+1", "-1", "laugh", "confused", "heart", "hooray", "rocket", "eyes"}
+
+// ReactionEmojis are the reactions used for each stage of a command's
+// lifecycle. An empty reaction means that stage isn't reacted to.
+type ReactionEmojis struct {
+	// Queued is used when the command has been received but isn't running yet.
+	Queued string
+	// Running is used while terraform is being run.
+	Running string
+	// Success is used once the command has completed successfully.
+	Success string
+	// Failure is used once the command has failed or errored.
+	Failure string
+}
+
+// CommentReactions manages the reaction on the comment that triggered a
+// command so that it reflects the state of the command. Only one reaction is
+// kept at a time: moving to a new state deletes the previous reaction.
+// A nil CommentReactions doesn't react.
+type CommentReactions struct {
+	Github github.Client
+	Emojis ReactionEmojis
+}
+
+// Queued reacts to the comment to indicate the command is waiting to run.
+func (c *CommentReactions) Queued(ctx *CommandContext) {
+	if c == nil {
+		return
+	}
+	c.set(ctx, c.Emojis.Queued)
+}
+
+// Running reacts to the comment to indicate the command is running.
+func (c *CommentReactions) Running(ctx *CommandContext) {
+	if c == nil {
+		return
+	}
+	c.set(ctx, c.Emojis.Running)
+}
+
+// Done reacts to the comment with the outcome of the command. Like the
+// command's status, it failed if it didn't match any projects.
+func (c *CommentReactions) Done(ctx *CommandContext, res CommandResponse) {
+	if c == nil {
+		return
+	}
+	if res.Status() != Success || len(res.ProjectResults) == 0 {
+		c.set(ctx, c.Emojis.Failure)
+		return
+	}
+	c.set(ctx, c.Emojis.Success)
+}
+
+// set replaces the current reaction on the triggering comment with content.
+// Reactions are best-effort so errors are only logged.
+func (c *CommentReactions) set(ctx *CommandContext, content string) {
+	// commands that weren't triggered by a comment don't get reactions
+	if ctx.CommentID == 0 {
+		return
+	}
+	if content == ctx.reaction {
+		return
+	}
+	if ctx.reactionID != 0 {
+		if err := c.Github.DeleteReaction(ctx.reactionID); err != nil {
+			ctx.Log.Warn("deleting %q reaction: %s", ctx.reaction, err)
+		}
+		ctx.reactionID = 0
+		ctx.reaction = ""
+	}
+	if content == "" {
+		return
+	}
+	id, err := c.Github.AddReaction(ctx.BaseRepo, ctx.CommentID, content)
+	if err != nil {
+		ctx.Log.Warn("adding %q reaction: %s", content, err)
+		return
+	}
+	ctx.reactionID = id
+	ctx.reaction = content
+}
@@ -0,0 +1,102 @@
+package server_test
+
+import (
+	"errors"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/hootsuite/atlantis/github/mocks"
+	"github.com/hootsuite/atlantis/logging"
+	"github.com/hootsuite/atlantis/models/fixtures"
+	"github.com/hootsuite/atlantis/server"
+	. "github.com/petergtz/pegomock"
+)
+
+var reactionEmojis = server.ReactionEmojis{
+	Queued:  "eyes",
+	Running: "rocket",
+	Success: "hooray",
+	Failure: "confused",
+}
+
+func reactionsCtx(commentID int) *server.CommandContext {
+	return &server.CommandContext{
+		BaseRepo:  fixtures.Repo,
+		Pull:      fixtures.Pull,
+		CommentID: commentID,
+		Log:       logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+}
+
+func TestCommentReactions_Lifecycle(t *testing.T) {
+	t.Log("each state should replace the reaction from the previous state")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	When(client.AddReaction(fixtures.Repo, 1, "eyes")).ThenReturn(10, nil)
+	When(client.AddReaction(fixtures.Repo, 1, "rocket")).ThenReturn(11, nil)
+	When(client.AddReaction(fixtures.Repo, 1, "hooray")).ThenReturn(12, nil)
+	r := server.CommentReactions{Github: client, Emojis: reactionEmojis}
+	ctx := reactionsCtx(1)
+
+	r.Queued(ctx)
+	r.Running(ctx)
+	r.Done(ctx, server.CommandResponse{ProjectResults: []server.ProjectResult{{ApplySuccess: "success"}}})
+
+	client.VerifyWasCalledOnce().AddReaction(fixtures.Repo, 1, "eyes")
+	client.VerifyWasCalledOnce().DeleteReaction(10)
+	client.VerifyWasCalledOnce().AddReaction(fixtures.Repo, 1, "rocket")
+	client.VerifyWasCalledOnce().DeleteReaction(11)
+	client.VerifyWasCalledOnce().AddReaction(fixtures.Repo, 1, "hooray")
+	client.VerifyWasCalled(Never()).DeleteReaction(12)
+}
+
+func TestCommentReactions_DoneFailure(t *testing.T) {
+	t.Log("a failed project should result in the failure reaction")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	r := server.CommentReactions{Github: client, Emojis: reactionEmojis}
+
+	r.Done(reactionsCtx(1), server.CommandResponse{ProjectResults: []server.ProjectResult{
+		{ApplySuccess: "success"},
+		{Error: errors.New("error")},
+	}})
+	client.VerifyWasCalledOnce().AddReaction(fixtures.Repo, 1, "confused")
+	client.VerifyWasCalled(Never()).AddReaction(fixtures.Repo, 1, "hooray")
+}
+
+func TestCommentReactions_DoneNoProjects(t *testing.T) {
+	t.Log("a command that didn't match any projects should result in the failure reaction like its status")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	r := server.CommentReactions{Github: client, Emojis: reactionEmojis}
+
+	r.Done(reactionsCtx(1), server.CommandResponse{})
+	client.VerifyWasCalledOnce().AddReaction(fixtures.Repo, 1, "confused")
+	client.VerifyWasCalled(Never()).AddReaction(fixtures.Repo, 1, "hooray")
+}
+
+func TestCommentReactions_Disabled(t *testing.T) {
+	t.Log("states without a reaction should remove the previous reaction and not add one")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	When(client.AddReaction(fixtures.Repo, 1, "eyes")).ThenReturn(10, nil)
+	r := server.CommentReactions{Github: client, Emojis: server.ReactionEmojis{Queued: "eyes"}}
+	ctx := reactionsCtx(1)
+
+	r.Queued(ctx)
+	r.Running(ctx)
+	r.Done(ctx, server.CommandResponse{Failure: "failure"})
+	client.VerifyWasCalledOnce().AddReaction(fixtures.Repo, 1, "eyes")
+	client.VerifyWasCalledOnce().DeleteReaction(10)
+}
+
+func TestCommentReactions_NoComment(t *testing.T) {
+	t.Log("commands without a triggering comment shouldn't be reacted to")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	r := server.CommentReactions{Github: client, Emojis: reactionEmojis}
+
+	r.Running(reactionsCtx(0))
+	client.VerifyWasCalled(Never()).AddReaction(fixtures.Repo, 0, "rocket")
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"io/ioutil"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultCommentTemplate is the comment template that's used without
+// --comment-template. The command's error or failure if it had one, followed
+// by its log, or else the summary of its projects and their results.
+const DefaultCommentTemplate = "{{ if .Error }}" + errTmplText + logTmpl +
+	"{{ else if .Failure }}" + failureTmplText + logTmpl +
+	"{{ else }}{{ .Summary }}{{ .Projects }}{{ end }}"
+
+// CommentTemplateData is what a comment template is executed with. The
+// output, failures, errors and log are redacted.
+type CommentTemplateData struct {
+	// Command is the name of the command, ex. Plan
+	Command string
+	// Response is the result of the command. Its projects' results are the
+	// same as Results.
+	Response CommandResponse
+	// Results are the result of each project. Each one's Status is its
+	// Success, Failure or Error.
+	Results []ProjectResult
+	Log     string
+	Verbose bool
+	// VerboseNote explains why the log was or wasn't included, if it isn't
+	// obvious from the comment
+	VerboseNote string
+	// Error is the command's redacted error, if it had one
+	Error string
+	// Failure is why the command failed, if it did, ex. because it didn't
+	// match any projects
+	Failure string
+	// Summary is rendered before the projects' results, ex. the total
+	// changes of all the plans
+	Summary string
+	// Projects are the rendered results of the projects, grouped by
+	// environment, ending with the comment to apply them and the log
+	Projects string
+	// Comment is the comment Atlantis would have commented without the
+	// template, ex. to add mentions before it
+	Comment string
+}
+
+// ParseCommentTemplate parses the comment template in the file at path. It's
+// also executed with an example plan so templates that use fields that don't
+// exist fail when Atlantis starts rather than when they're commented.
+func ParseCommentTemplate(path string) (*template.Template, error) {
+	text, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", path)
+	}
+	tmpl, err := template.New("comment").Parse(string(text))
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing %s", path)
+	}
+	example := CommentTemplateData{
+		Command: "Plan",
+		Response: CommandResponse{
+			Command:        Plan,
+			Environment:    "default",
+			ProjectResults: []ProjectResult{{Path: ".", PlanSuccess: &PlanSuccess{TerraformOutput: "No changes. Infrastructure is up-to-date."}}},
+		},
+		Comment: "comment",
+	}
+	example.Results = example.Response.ProjectResults
+	if err := tmpl.Execute(ioutil.Discard, example); err != nil {
+		return nil, errors.Wrapf(err, "executing %s", path)
+	}
+	return tmpl, nil
+}
@@ -0,0 +1,67 @@
+package server_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/hootsuite/atlantis/server"
+	. "github.com/hootsuite/atlantis/testing_util"
+)
+
+// writeCommentTemplate writes text to a comment template file in dir and
+// returns its path.
+func writeCommentTemplate(t *testing.T, dir string, text string) string {
+	path := filepath.Join(dir, "comment.tmpl")
+	Ok(t, ioutil.WriteFile(path, []byte(text), 0644))
+	return path
+}
+
+func TestParseCommentTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = server.ParseCommentTemplate(filepath.Join(dir, "missing.tmpl"))
+	Assert(t, err != nil && strings.HasPrefix(err.Error(), "reading "), "expected a reading error, got %v", err)
+
+	t.Log("templates that don't parse or use fields that don't exist should fail")
+	for _, text := range []string{"{{ .Command ", "{{ .Missing }}", "{{ range .Results }}{{ .Missing }}{{ end }}"} {
+		_, err = server.ParseCommentTemplate(writeCommentTemplate(t, dir, text))
+		Assert(t, err != nil, "expected %q to fail", text)
+	}
+
+	tmpl, err := server.ParseCommentTemplate(writeCommentTemplate(t, dir, "{{ range .Results }}{{ .Path }}: {{ .Status }}{{ end }}"))
+	Ok(t, err)
+	Assert(t, tmpl != nil, "expected a template")
+}
+
+func TestRenderCommentTemplate(t *testing.T) {
+	res := server.CommandResponse{Command: server.Plan, ProjectResults: []server.ProjectResult{
+		{Path: "staging", PlanSuccess: &server.PlanSuccess{`password: "hunter2"`, "lock-url"}},
+		{Path: "prod", Failure: "failed"},
+	}}
+	redactor, err := server.NewOutputRedactor("password")
+	Ok(t, err)
+
+	t.Log("the default template should render Atlantis's own comment")
+	r := server.GithubCommentRenderer{Redactor: redactor}
+	comment := r.Render(res, "log", false)
+	r.Template = template.Must(template.New("").Parse(server.DefaultCommentTemplate))
+	Equals(t, comment, r.Render(res, "log", false))
+
+	t.Log("a template should get each project's status and the redacted output")
+	r.Template = template.Must(template.New("").Parse("@hootsuite/infra {{ .Command }}:{{ range .Results }} {{ .Path }}={{ .Status }}{{ end }}\n{{ (index .Response.ProjectResults 0).PlanSuccess.TerraformOutput }}"))
+	Equals(t, "@hootsuite/infra Plan: staging=success prod=failure\npassword: \"<redacted>\"", r.Render(res, "log", false))
+
+	t.Log("if the template fails, the default comment should be used")
+	r.Template = template.Must(template.New("").Parse("{{ (index .Results 0).Path }}"))
+	failed := server.CommandResponse{Command: server.Plan, Error: errors.New("error")}
+	comment = r.Render(failed, "log", false)
+	Assert(t, strings.HasPrefix(comment, "**Plan Error**\n"), "expected the default comment in %q", comment)
+	Assert(t, strings.Contains(comment, "The --comment-template couldn't be rendered so this is the default comment: "), "expected why the template wasn't used in %q", comment)
+}
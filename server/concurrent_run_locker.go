@@ -2,42 +2,323 @@ package server
 
 import (
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 )
 
 // ConcurrentRunLocker is used to prevent multiple runs and commands from occurring at the same time for a single
-// repo, pull, and environment
+// repo, pull, and environment. Commands can also wait for a lock with Lock, in
+// which case it's handed to them in the order they started waiting. Each lock
+// is released with the unlock func returned when it was taken, so a command
+// whose lock was force unlocked can't release the lock of the next command
+// to take it.
 type ConcurrentRunLocker struct {
 	mutex sync.Mutex
-	locks map[string]interface{}
+	locks map[string]ConcurrentRunLock
+	// nextHolder is the id of the next command to take a lock
+	nextHolder int
+	// queues are the commands waiting for each lock, keyed by key, in the
+	// order they started waiting
+	queues map[string][]*concurrentRunLockWaiter
+	// waiting are the functions to run once no locks are held for a repo
+	// and pull, keyed by pullKey. See WhenPullUnlocked.
+	waiting map[string][]func(deferred bool)
+}
+
+// ConcurrentRunLock is a lock held by a running command.
+type ConcurrentRunLock struct {
+	RepoFullName string    `json:"repo"`
+	Env          string    `json:"env"`
+	PullNum      int       `json:"pull"`
+	AcquiredAt   time.Time `json:"acquired_at"`
+	// holder is the id of the command holding the lock
+	holder int
+}
+
+// concurrentRunLockWaiter is a command waiting for a lock in Lock.
+type concurrentRunLockWaiter struct {
+	repoFullName string
+	env          string
+	pullNum      int
+	// holder is the waiter's id once the lock is handed to it
+	holder int
+	// result is sent true once the lock is handed to the waiter or false if
+	// waiting was cancelled. It's buffered so sending never blocks.
+	result chan bool
 }
 
 func NewConcurrentRunLocker() *ConcurrentRunLocker {
 	return &ConcurrentRunLocker{
-		locks: make(map[string]interface{}),
+		locks:   make(map[string]ConcurrentRunLock),
+		queues:  make(map[string][]*concurrentRunLockWaiter),
+		waiting: make(map[string][]func(deferred bool)),
 	}
 }
 
-// TryLock returns true if you acquired the lock and false if someone else already has the lock
-func (c *ConcurrentRunLocker) TryLock(repoFullName string, env string, pullNum int) bool {
+// TryLock returns true if you acquired the lock and false if someone else
+// already has the lock. If it was acquired, unlock releases it.
+func (c *ConcurrentRunLocker) TryLock(repoFullName string, env string, pullNum int) (unlock func(), ok bool) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	holder, ok := c.acquire(repoFullName, env, pullNum)
+	if !ok {
+		return nil, false
+	}
+	return c.unlockFunc(repoFullName, env, pullNum, holder), true
+}
+
+// acquire takes the lock if it's free and returns the id of its holder.
+// c.mutex must be held.
+func (c *ConcurrentRunLocker) acquire(repoFullName string, env string, pullNum int) (holder int, ok bool) {
+	key := c.key(repoFullName, env, pullNum)
+	if _, ok := c.locks[key]; ok {
+		return 0, false
+	}
+	holder = c.hold(key, repoFullName, env, pullNum)
+	return holder, true
+}
+
+// hold records that the lock for key is held by a new holder and returns its
+// id. c.mutex must be held.
+func (c *ConcurrentRunLocker) hold(key string, repoFullName string, env string, pullNum int) int {
+	c.nextHolder++
+	c.locks[key] = ConcurrentRunLock{
+		RepoFullName: repoFullName,
+		Env:          env,
+		PullNum:      pullNum,
+		AcquiredAt:   time.Now(),
+		holder:       c.nextHolder,
+	}
+	return c.nextHolder
+}
 
+// Lock is like TryLock but if the lock is held it waits up to timeout for it
+// behind any commands that are already waiting. onQueued, if set, is called
+// once it starts waiting. It returns whether the lock was acquired and, if it
+// wasn't, whether that's because waiting was cancelled by CancelWaiting rather
+// than timing out. If it was acquired, unlock releases it.
+func (c *ConcurrentRunLocker) Lock(repoFullName string, env string, pullNum int, timeout time.Duration, onQueued func()) (unlock func(), acquired bool, cancelled bool) {
+	c.mutex.Lock()
+	if holder, ok := c.acquire(repoFullName, env, pullNum); ok {
+		c.mutex.Unlock()
+		return c.unlockFunc(repoFullName, env, pullNum, holder), true, false
+	}
+	if timeout <= 0 {
+		c.mutex.Unlock()
+		return nil, false, false
+	}
+	key := c.key(repoFullName, env, pullNum)
+	w := &concurrentRunLockWaiter{
+		repoFullName: repoFullName,
+		env:          env,
+		pullNum:      pullNum,
+		result:       make(chan bool, 1),
+	}
+	c.queues[key] = append(c.queues[key], w)
+	c.mutex.Unlock()
+
+	if onQueued != nil {
+		onQueued()
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case acquired = <-w.result:
+	case <-timer.C:
+		c.mutex.Lock()
+		removed := c.removeWaiter(key, w)
+		c.mutex.Unlock()
+		if removed {
+			return nil, false, false
+		}
+		// the lock was handed over or waiting was cancelled just as we
+		// timed out
+		acquired = <-w.result
+	}
+	if !acquired {
+		return nil, false, true
+	}
+	return c.unlockFunc(repoFullName, env, pullNum, w.holder), true, false
+}
+
+// CancelWaiting stops all commands waiting in Lock for any environment of
+// the repo and pull, ex. because the pull request was closed. A nil
+// ConcurrentRunLocker has nothing to cancel.
+func (c *ConcurrentRunLocker) CancelWaiting(repoFullName string, pullNum int) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for key, queue := range c.queues {
+		var remaining []*concurrentRunLockWaiter
+		for _, w := range queue {
+			if w.repoFullName == repoFullName && w.pullNum == pullNum {
+				w.result <- false
+				continue
+			}
+			remaining = append(remaining, w)
+		}
+		if len(remaining) == 0 {
+			delete(c.queues, key)
+		} else {
+			c.queues[key] = remaining
+		}
+	}
+}
+
+// removeWaiter removes w from the queue for key. It returns false if w
+// wasn't waiting anymore. c.mutex must be held.
+func (c *ConcurrentRunLocker) removeWaiter(key string, w *concurrentRunLockWaiter) bool {
+	queue := c.queues[key]
+	for i, queued := range queue {
+		if queued == w {
+			c.queues[key] = append(queue[:i:i], queue[i+1:]...)
+			if len(c.queues[key]) == 0 {
+				delete(c.queues, key)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// handOff gives the free lock for key to the first command waiting for it.
+// c.mutex must be held.
+func (c *ConcurrentRunLocker) handOff(key string) {
+	queue := c.queues[key]
+	if len(queue) == 0 {
+		return
+	}
+	first := queue[0]
+	first.holder = c.hold(key, first.repoFullName, first.env, first.pullNum)
+	first.result <- true
+	if len(queue) == 1 {
+		delete(c.queues, key)
+	} else {
+		c.queues[key] = queue[1:]
+	}
+}
+
+// unlockFunc returns the func that releases the lock on the repo and
+// environment if holder still holds it. It does nothing if the lock was force
+// unlocked since then, even if another command holds it now.
+func (c *ConcurrentRunLocker) unlockFunc(repoFullName, env string, pullNum int, holder int) func() {
+	return func() {
+		c.mutex.Lock()
+		key := c.key(repoFullName, env, pullNum)
+		if l, ok := c.locks[key]; !ok || l.holder != holder {
+			c.mutex.Unlock()
+			return
+		}
+		delete(c.locks, key)
+		c.handOff(key)
+		waiting := c.takeWaiting(repoFullName, pullNum)
+		c.mutex.Unlock()
+		runWaiting(waiting)
+	}
+}
+
+// ForceUnlock releases the lock on the repo and environment so a lock left
+// held by a stuck command can be cleared. The stuck command's own unlock then
+// does nothing so it can't release the lock of whoever takes it next. It
+// returns false if no lock was held.
+func (c *ConcurrentRunLocker) ForceUnlock(repoFullName, env string, pullNum int) bool {
+	c.mutex.Lock()
 	key := c.key(repoFullName, env, pullNum)
 	if _, ok := c.locks[key]; !ok {
-		c.locks[key] = true
+		c.mutex.Unlock()
+		return false
+	}
+	delete(c.locks, key)
+	c.handOff(key)
+	waiting := c.takeWaiting(repoFullName, pullNum)
+	c.mutex.Unlock()
+	runWaiting(waiting)
+	return true
+}
+
+// takeWaiting returns and forgets the functions waiting for the repo and
+// pull to be unlocked if no locks are held for it anymore. c.mutex must be
+// held, and released before they're run by runWaiting.
+func (c *ConcurrentRunLocker) takeWaiting(repoFullName string, pullNum int) []func(deferred bool) {
+	pullKey := c.pullKey(repoFullName, pullNum)
+	if len(c.waiting[pullKey]) == 0 || c.pullLocked(repoFullName, pullNum) {
+		return nil
+	}
+	waiting := c.waiting[pullKey]
+	delete(c.waiting, pullKey)
+	return waiting
+}
+
+// runWaiting runs the functions returned by takeWaiting. They're run without
+// c.mutex held so a slow one, ex. deleting a large workspace, doesn't stop
+// other commands from taking or releasing locks.
+func runWaiting(waiting []func(deferred bool)) {
+	for _, f := range waiting {
+		f(true)
+	}
+}
+
+// WhenPullUnlocked runs f once no locks are held for any environment of the
+// repo and pull. If none are held now, f is run before WhenPullUnlocked
+// returns and it returns true. Otherwise it returns false and f is run by the
+// last unlock once it has released the lock, in which case f is passed true.
+// No locks can be taken for any repo while f is run right away so it should
+// be quick. A nil ConcurrentRunLocker runs f right away.
+func (c *ConcurrentRunLocker) WhenPullUnlocked(repoFullName string, pullNum int, f func(deferred bool)) bool {
+	if c == nil {
+		f(false)
+		return true
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.pullLocked(repoFullName, pullNum) {
+		f(false)
 		return true
 	}
+	pullKey := c.pullKey(repoFullName, pullNum)
+	c.waiting[pullKey] = append(c.waiting[pullKey], f)
 	return false
 }
 
-// Unlock unlocks the repo and environment
-func (c *ConcurrentRunLocker) Unlock(repoFullName, env string, pullNum int) {
+// pullLocked returns true if a lock is held for any environment of the repo
+// and pull. c.mutex must be held.
+func (c *ConcurrentRunLocker) pullLocked(repoFullName string, pullNum int) bool {
+	for _, l := range c.locks {
+		if l.RepoFullName == repoFullName && l.PullNum == pullNum {
+			return true
+		}
+	}
+	return false
+}
+
+// List returns all the locks that are currently held, sorted by repo, then
+// environment, then pull request.
+func (c *ConcurrentRunLocker) List() []ConcurrentRunLock {
 	c.mutex.Lock()
-	defer c.mutex.Unlock()
-	delete(c.locks, c.key(repoFullName, env, pullNum))
+	var locks []ConcurrentRunLock
+	for _, l := range c.locks {
+		locks = append(locks, l)
+	}
+	c.mutex.Unlock()
+	sort.Slice(locks, func(i, j int) bool {
+		if locks[i].RepoFullName != locks[j].RepoFullName {
+			return locks[i].RepoFullName < locks[j].RepoFullName
+		}
+		if locks[i].Env != locks[j].Env {
+			return locks[i].Env < locks[j].Env
+		}
+		return locks[i].PullNum < locks[j].PullNum
+	})
+	return locks
 }
 
 func (c *ConcurrentRunLocker) key(repo string, env string, pull int) string {
 	return fmt.Sprintf("%s/%s/%d", repo, env, pull)
 }
+
+func (c *ConcurrentRunLocker) pullKey(repo string, pull int) string {
+	return fmt.Sprintf("%s/%d", repo, pull)
+}
@@ -1,7 +1,9 @@
 package server_test
 
 import (
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/hootsuite/atlantis/server"
 	. "github.com/hootsuite/atlantis/testing_util"
@@ -10,94 +12,335 @@ import (
 var repo = "repo/owner"
 var env = "default"
 
+// tryLock returns whether TryLock acquired the lock, for tests that don't
+// release it.
+func tryLock(locker *server.ConcurrentRunLocker, repo string, env string, pull int) bool {
+	_, ok := locker.TryLock(repo, env, pull)
+	return ok
+}
+
 func TestTryLock(t *testing.T) {
 	locker := server.NewConcurrentRunLocker()
 
 	t.Log("the first lock should succeed")
-	Equals(t, true, locker.TryLock(repo, env, 1))
+	Equals(t, true, tryLock(locker, repo, env, 1))
 
 	t.Log("now another lock for the same repo, env, and pull should fail")
-	Equals(t, false, locker.TryLock(repo, env, 1))
+	Equals(t, false, tryLock(locker, repo, env, 1))
 }
 
 func TestTryLockDifferentEnv(t *testing.T) {
 	locker := server.NewConcurrentRunLocker()
 
 	t.Log("a lock for the same repo and pull but different env should succeed")
-	Equals(t, true, locker.TryLock(repo, env, 1))
-	Equals(t, true, locker.TryLock(repo, "new-env", 1))
+	Equals(t, true, tryLock(locker, repo, env, 1))
+	Equals(t, true, tryLock(locker, repo, "new-env", 1))
 
 	t.Log("and both should now be locked")
-	Equals(t, false, locker.TryLock(repo, env, 1))
-	Equals(t, false, locker.TryLock(repo, "new-env", 1))
+	Equals(t, false, tryLock(locker, repo, env, 1))
+	Equals(t, false, tryLock(locker, repo, "new-env", 1))
 }
 
 func TestTryLockDifferentRepo(t *testing.T) {
 	locker := server.NewConcurrentRunLocker()
 
 	t.Log("a lock for a different repo but the same env and pull should succeed")
-	Equals(t, true, locker.TryLock(repo, env, 1))
+	Equals(t, true, tryLock(locker, repo, env, 1))
 	newRepo := "owner/newrepo"
-	Equals(t, true, locker.TryLock(newRepo, env, 1))
+	Equals(t, true, tryLock(locker, newRepo, env, 1))
 
 	t.Log("and both should now be locked")
-	Equals(t, false, locker.TryLock(repo, env, 1))
-	Equals(t, false, locker.TryLock(newRepo, env, 1))
+	Equals(t, false, tryLock(locker, repo, env, 1))
+	Equals(t, false, tryLock(locker, newRepo, env, 1))
 }
 
 func TestTryLockDifferent1(t *testing.T) {
 	locker := server.NewConcurrentRunLocker()
 
 	t.Log("a lock for a different pull but the same repo and env should succeed")
-	Equals(t, true, locker.TryLock(repo, env, 1))
+	Equals(t, true, tryLock(locker, repo, env, 1))
 	new1 := 2
-	Equals(t, true, locker.TryLock(repo, env, new1))
+	Equals(t, true, tryLock(locker, repo, env, new1))
 
 	t.Log("and both should now be locked")
-	Equals(t, false, locker.TryLock(repo, env, 1))
-	Equals(t, false, locker.TryLock(repo, env, new1))
+	Equals(t, false, tryLock(locker, repo, env, 1))
+	Equals(t, false, tryLock(locker, repo, env, new1))
 }
 
 func TestUnlock(t *testing.T) {
 	locker := server.NewConcurrentRunLocker()
 
 	t.Log("unlocking should work")
-	Equals(t, true, locker.TryLock(repo, env, 1))
-	locker.Unlock(repo, env, 1)
-	Equals(t, true, locker.TryLock(repo, env, 1))
+	unlock, ok := locker.TryLock(repo, env, 1)
+	Equals(t, true, ok)
+	unlock()
+	Equals(t, true, tryLock(locker, repo, env, 1))
 }
 
 func TestUnlockDifferentEnvs(t *testing.T) {
 	locker := server.NewConcurrentRunLocker()
 	t.Log("unlocking should work for different envs")
-	Equals(t, true, locker.TryLock(repo, env, 1))
-	Equals(t, true, locker.TryLock(repo, "new-env", 1))
-	locker.Unlock(repo, env, 1)
-	locker.Unlock(repo, "new-env", 1)
-	Equals(t, true, locker.TryLock(repo, env, 1))
-	Equals(t, true, locker.TryLock(repo, "new-env", 1))
+	unlock1, ok := locker.TryLock(repo, env, 1)
+	Equals(t, true, ok)
+	unlock2, ok := locker.TryLock(repo, "new-env", 1)
+	Equals(t, true, ok)
+	unlock1()
+	unlock2()
+	Equals(t, true, tryLock(locker, repo, env, 1))
+	Equals(t, true, tryLock(locker, repo, "new-env", 1))
 }
 
 func TestUnlockDifferentRepos(t *testing.T) {
 	locker := server.NewConcurrentRunLocker()
 	t.Log("unlocking should work for different repos")
-	Equals(t, true, locker.TryLock(repo, env, 1))
+	unlock1, ok := locker.TryLock(repo, env, 1)
+	Equals(t, true, ok)
 	newRepo := "owner/newrepo"
-	Equals(t, true, locker.TryLock(newRepo, env, 1))
-	locker.Unlock(repo, env, 1)
-	locker.Unlock(newRepo, env, 1)
-	Equals(t, true, locker.TryLock(repo, env, 1))
-	Equals(t, true, locker.TryLock(newRepo, env, 1))
+	unlock2, ok := locker.TryLock(newRepo, env, 1)
+	Equals(t, true, ok)
+	unlock1()
+	unlock2()
+	Equals(t, true, tryLock(locker, repo, env, 1))
+	Equals(t, true, tryLock(locker, newRepo, env, 1))
 }
 
 func TestUnlockDifferentPulls(t *testing.T) {
 	locker := server.NewConcurrentRunLocker()
 	t.Log("unlocking should work for different 1s")
-	Equals(t, true, locker.TryLock(repo, env, 1))
+	unlock1, ok := locker.TryLock(repo, env, 1)
+	Equals(t, true, ok)
 	new1 := 2
-	Equals(t, true, locker.TryLock(repo, env, new1))
-	locker.Unlock(repo, env, 1)
-	locker.Unlock(repo, env, new1)
-	Equals(t, true, locker.TryLock(repo, env, 1))
-	Equals(t, true, locker.TryLock(repo, env, new1))
+	unlock2, ok := locker.TryLock(repo, env, new1)
+	Equals(t, true, ok)
+	unlock1()
+	unlock2()
+	Equals(t, true, tryLock(locker, repo, env, 1))
+	Equals(t, true, tryLock(locker, repo, env, new1))
+}
+
+func TestList(t *testing.T) {
+	locker := server.NewConcurrentRunLocker()
+
+	t.Log("with no locks held the list should be empty")
+	Equals(t, 0, len(locker.List()))
+
+	t.Log("held locks should be listed")
+	unlock, _ := locker.TryLock(repo, env, 1)
+	locks := locker.List()
+	Equals(t, 1, len(locks))
+	Equals(t, repo, locks[0].RepoFullName)
+	Equals(t, env, locks[0].Env)
+	Equals(t, 1, locks[0].PullNum)
+	Assert(t, !locks[0].AcquiredAt.IsZero(), "expected acquired at to be set")
+
+	t.Log("and unlocked locks should not be")
+	unlock()
+	Equals(t, 0, len(locker.List()))
+}
+
+func TestList_Sorted(t *testing.T) {
+	t.Log("locks should be listed by repo, then env, then pull")
+	locker := server.NewConcurrentRunLocker()
+	tryLock(locker, "owner/b", "default", 1)
+	tryLock(locker, "owner/a", "staging", 2)
+	tryLock(locker, "owner/a", "production", 3)
+	tryLock(locker, "owner/a", "staging", 1)
+	var listed []string
+	for _, l := range locker.List() {
+		listed = append(listed, fmt.Sprintf("%s/%s/%d", l.RepoFullName, l.Env, l.PullNum))
+	}
+	Equals(t, []string{"owner/a/production/3", "owner/a/staging/1", "owner/a/staging/2", "owner/b/default/1"}, listed)
+}
+
+func TestTryLockDifferentEnvDifferentCommands(t *testing.T) {
+	locker := server.NewConcurrentRunLocker()
+
+	t.Log("an apply holding the lock for one env shouldn't block a plan for another env of the same pull")
+	Equals(t, true, tryLock(locker, repo, "production", 1))
+	Equals(t, true, tryLock(locker, repo, "staging", 1))
+	Equals(t, true, tryLock(locker, repo, env, 1))
+}
+
+func TestWhenPullUnlocked(t *testing.T) {
+	locker := server.NewConcurrentRunLocker()
+
+	t.Log("if no locks are held for the pull, f should run right away")
+	var calls []bool
+	f := func(deferred bool) { calls = append(calls, deferred) }
+	Equals(t, true, locker.WhenPullUnlocked(repo, 1, f))
+	Equals(t, []bool{false}, calls)
+
+	t.Log("locks for other pulls shouldn't matter")
+	tryLock(locker, repo, env, 2)
+	calls = nil
+	Equals(t, true, locker.WhenPullUnlocked(repo, 1, f))
+	Equals(t, []bool{false}, calls)
+
+	t.Log("if locks are held for the pull, f should run once they're all unlocked")
+	unlock1, _ := locker.TryLock(repo, env, 1)
+	unlock2, _ := locker.TryLock(repo, "staging", 1)
+	calls = nil
+	Equals(t, false, locker.WhenPullUnlocked(repo, 1, f))
+	unlock1()
+	Equals(t, 0, len(calls))
+	unlock2()
+	Equals(t, []bool{true}, calls)
+
+	t.Log("f should only run once")
+	unlock, _ := locker.TryLock(repo, env, 1)
+	unlock()
+	Equals(t, []bool{true}, calls)
+}
+
+func TestWhenPullUnlocked_Nil(t *testing.T) {
+	var locker *server.ConcurrentRunLocker
+	ran := false
+	Equals(t, true, locker.WhenPullUnlocked(repo, 1, func(bool) { ran = true }))
+	Equals(t, true, ran)
+}
+
+func TestForceUnlock(t *testing.T) {
+	locker := server.NewConcurrentRunLocker()
+
+	t.Log("force unlocking should return false if no lock is held")
+	Equals(t, false, locker.ForceUnlock(repo, env, 1))
+
+	t.Log("a held lock should be released")
+	Equals(t, true, tryLock(locker, repo, env, 1))
+	Equals(t, true, tryLock(locker, repo, env, 2))
+	Equals(t, true, locker.ForceUnlock(repo, env, 1))
+	Equals(t, true, tryLock(locker, repo, env, 1))
+
+	t.Log("only the pull's own lock should be released")
+	Equals(t, false, tryLock(locker, repo, env, 2))
+}
+
+func TestForceUnlock_StaleUnlock(t *testing.T) {
+	t.Log("once force unlocked, the stuck command's unlock shouldn't release the next holder's lock")
+	locker := server.NewConcurrentRunLocker()
+	stuckUnlock, _ := locker.TryLock(repo, env, 1)
+	Equals(t, true, locker.ForceUnlock(repo, env, 1))
+	unlock, ok := locker.TryLock(repo, env, 1)
+	Equals(t, true, ok)
+	stuckUnlock()
+	Equals(t, false, tryLock(locker, repo, env, 1))
+
+	t.Log("the new holder's unlock should still release it")
+	unlock()
+	Equals(t, true, tryLock(locker, repo, env, 1))
+}
+
+func TestForceUnlock_RunsWaiting(t *testing.T) {
+	t.Log("force unlocking the last lock of a pull should run the functions waiting for it")
+	locker := server.NewConcurrentRunLocker()
+	Equals(t, true, tryLock(locker, repo, env, 1))
+	ran := false
+	Equals(t, false, locker.WhenPullUnlocked(repo, 1, func(bool) { ran = true }))
+	locker.ForceUnlock(repo, env, 1)
+	Equals(t, true, ran)
+}
+
+// lockResult is what Lock returned.
+type lockResult struct {
+	unlock    func()
+	acquired  bool
+	cancelled bool
+}
+
+// lockAsync calls Lock in a goroutine and returns a channel that receives
+// what it returned. queued is closed once it starts waiting.
+func lockAsync(locker *server.ConcurrentRunLocker, timeout time.Duration) (result chan lockResult, queued chan struct{}) {
+	result = make(chan lockResult, 1)
+	queued = make(chan struct{})
+	go func() {
+		unlock, acquired, cancelled := locker.Lock(repo, env, 1, timeout, func() { close(queued) })
+		result <- lockResult{unlock, acquired, cancelled}
+	}()
+	return result, queued
+}
+
+func TestLock_Free(t *testing.T) {
+	t.Log("a free lock should be acquired right away without queueing")
+	locker := server.NewConcurrentRunLocker()
+	_, acquired, cancelled := locker.Lock(repo, env, 1, time.Minute, func() { t.Fatal("shouldn't have queued") })
+	Equals(t, true, acquired)
+	Equals(t, false, cancelled)
+	Equals(t, false, tryLock(locker, repo, env, 1))
+}
+
+func TestLock_NoTimeout(t *testing.T) {
+	t.Log("without a timeout, Lock should fail right away like TryLock")
+	locker := server.NewConcurrentRunLocker()
+	tryLock(locker, repo, env, 1)
+	_, acquired, cancelled := locker.Lock(repo, env, 1, 0, nil)
+	Equals(t, false, acquired)
+	Equals(t, false, cancelled)
+}
+
+func TestLock_FIFO(t *testing.T) {
+	t.Log("waiting commands should get the lock in the order they started waiting")
+	locker := server.NewConcurrentRunLocker()
+	unlock, _ := locker.TryLock(repo, env, 1)
+	first, firstQueued := lockAsync(locker, time.Minute)
+	<-firstQueued
+	second, secondQueued := lockAsync(locker, time.Minute)
+	<-secondQueued
+
+	t.Log("commands that don't wait shouldn't jump the queue")
+	unlock()
+	firstResult := <-first
+	Equals(t, true, firstResult.acquired)
+	Equals(t, false, firstResult.cancelled)
+	Equals(t, false, tryLock(locker, repo, env, 1))
+
+	firstResult.unlock()
+	secondResult := <-second
+	Equals(t, true, secondResult.acquired)
+	Equals(t, false, secondResult.cancelled)
+	secondResult.unlock()
+	Equals(t, true, tryLock(locker, repo, env, 1))
+}
+
+func TestLock_Timeout(t *testing.T) {
+	t.Log("if the lock isn't released in time, Lock should give up and leave the queue")
+	locker := server.NewConcurrentRunLocker()
+	unlock, _ := locker.TryLock(repo, env, 1)
+	_, acquired, cancelled := locker.Lock(repo, env, 1, time.Millisecond, nil)
+	Equals(t, false, acquired)
+	Equals(t, false, cancelled)
+
+	unlock()
+	Equals(t, true, tryLock(locker, repo, env, 1))
+}
+
+func TestLock_Cancel(t *testing.T) {
+	t.Log("cancelling should stop the pull's waiting commands but not other pulls'")
+	locker := server.NewConcurrentRunLocker()
+	unlock1, _ := locker.TryLock(repo, env, 1)
+	unlock2, _ := locker.TryLock(repo, env, 2)
+	waiting, queued := lockAsync(locker, time.Minute)
+	<-queued
+	other := make(chan bool, 1)
+	otherQueued := make(chan struct{})
+	go func() {
+		_, acquired, _ := locker.Lock(repo, env, 2, time.Minute, func() { close(otherQueued) })
+		other <- acquired
+	}()
+	<-otherQueued
+
+	locker.CancelWaiting(repo, 1)
+	waitingResult := <-waiting
+	Equals(t, false, waitingResult.acquired)
+	Equals(t, true, waitingResult.cancelled)
+	unlock2()
+	Equals(t, true, <-other)
+
+	t.Log("the cancelled command shouldn't get the lock once it's released")
+	unlock1()
+	Equals(t, true, tryLock(locker, repo, env, 1))
+}
+
+func TestCancelWaiting_Nil(t *testing.T) {
+	var locker *server.ConcurrentRunLocker
+	locker.CancelWaiting(repo, 1)
 }
@@ -0,0 +1,261 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	version "github.com/hashicorp/go-version"
+	"github.com/hootsuite/atlantis/github"
+	"github.com/hootsuite/atlantis/locking"
+	"github.com/hootsuite/atlantis/metrics"
+	"github.com/hootsuite/atlantis/models"
+	"github.com/hootsuite/atlantis/terraform"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerCommandUsage(CommandUsage{
+		Name:        Destroy,
+		Description: "Runs 'terraform destroy' on the projects changed in the pull request",
+		Flags:       []string{"[environment | -w workspace]", "[-target=address]", "[-var-file=path]", "[--env KEY=value]", "[-parallelism=n]", "[-lock-timeout=duration]", "[--trust]"},
+	})
+}
+
+// DestroyExecutor runs terraform destroy in the projects modified by a pull
+// request, ex. to tear down an environment that was created to review it.
+// Since destroying can't be undone, it has the same approval and locking
+// requirements as apply.
+type DestroyExecutor struct {
+	github                github.Client
+	githubStatus          *GithubStatus
+	terraform             *terraform.Client
+	githubCommentRenderer *GithubCommentRenderer
+	locker                locking.Locker
+	applyRequirements     *ApplyRequirements
+	configReader          *ConfigReader
+	concurrentRunLocker   *ConcurrentRunLocker
+	workspace             Workspace
+	commentReactions      *CommentReactions
+	resultComments        *ResultComments
+	outputGists           *OutputGists
+	projectDurations      *metrics.HistogramVec
+	resultsStore          *ResultsStore
+	projectFinder         *ProjectFinder
+	terraformFlagPolicy   *TerraformFlagPolicy
+	workspaceDiscovery    *WorkspaceDiscovery
+	// lockTimeout is the -lock-timeout to destroy with if neither the
+	// comment nor the project's config set one
+	lockTimeout string
+	// queueTimeout is how long a destroy waits for another command running
+	// in the same environment of the pull request to complete. If it's 0,
+	// the destroy fails right away instead.
+	queueTimeout time.Duration
+	// applyTimeout is how long terraform destroy can run before it's
+	// stopped. If it's 0, it can run for as long as it needs.
+	applyTimeout time.Duration
+	// commandMetrics records how many destroys ran and how long they took
+	commandMetrics *CommandMetrics
+}
+
+func (d *DestroyExecutor) Execute(ctx *CommandContext) {
+	start := time.Now()
+	d.githubStatus.Update(ctx, Pending, DestroyStep)
+	d.resultComments.Acknowledge(ctx, Destroy)
+	stopProgress := d.resultComments.TrackProgress(ctx, Destroy)
+	res := d.setupAndDestroy(ctx)
+	stopProgress()
+	res.Command = Destroy
+	res.Environment = ctx.Command.Environment
+	d.outputGists.Upload(ctx, &res)
+	comment := d.githubCommentRenderer.Render(res, ctx.Log.History.String(), ctx.Command.Verbose)
+	d.resultComments.Create(ctx, Destroy, comment)
+	if err := d.resultsStore.Save(ctx, Destroy, res); err != nil {
+		ctx.Log.Err("saving results: %s", err)
+	}
+	d.commandMetrics.Record(ctx, Destroy, res, time.Since(start))
+	d.commentReactions.Done(ctx, res)
+}
+
+func (d *DestroyExecutor) setupAndDestroy(ctx *CommandContext) CommandResponse {
+	unlock, failure := lockRun(ctx, d.concurrentRunLocker, d.resultComments, d.commandMetrics, Destroy, ctx.Command.Environment, d.queueTimeout)
+	if failure != "" {
+		return d.failureResponse(ctx, failure)
+	}
+	defer unlock()
+	d.commentReactions.Running(ctx)
+
+	// destroy has the same requirements as apply
+	overridden, failure, err := d.applyRequirements.CheckPull(ctx)
+	if err != nil {
+		return d.errorResponse(ctx, err)
+	}
+	if failure != "" {
+		return d.failureResponse(ctx, failure)
+	}
+
+	// we destroy from a fresh clone so any plans for this environment are
+	// removed and can't be applied afterwards
+	cloneDir, err := d.workspace.Clone(ctx)
+	if failure := cloneFailure(err); failure != "" {
+		return d.failureResponse(ctx, failure)
+	}
+	if err != nil {
+		return d.errorResponse(ctx, err)
+	}
+
+	files, err := d.github.GetModifiedFiles(ctx.BaseRepo, ctx.Pull)
+	if err != nil {
+		return d.errorResponse(ctx, errors.Wrap(err, "getting modified files"))
+	}
+	terraformFiles := d.projectFinder.ProjectFiles(files)
+	if len(terraformFiles) == 0 {
+		return d.failureResponse(ctx, "No Terraform files were modified.")
+	}
+	projects := d.projectFinder.ModifiedProjects(ctx.BaseRepo.FullName, terraformFiles)
+	var paths []string
+	for _, p := range projects {
+		paths = append(paths, p.Path)
+	}
+	ctx.Log.Info("determined we have %d project(s) to destroy at path(s): %v", len(projects), strings.Join(paths, ", "))
+	if !overridden {
+		failure, err := d.applyRequirements.CheckProjects(ctx, projects)
+		if err != nil {
+			return d.errorResponse(ctx, err)
+		}
+		if failure != "" {
+			return d.failureResponse(ctx, failure)
+		}
+	}
+	ctx.projectConfigs, err = d.configReader.ReadAll(cloneDir, projects)
+	if err != nil {
+		return d.errorResponse(ctx, errors.Wrap(err, "parsing atlantis config files"))
+	}
+
+	results := []ProjectResult{}
+	for _, project := range projects {
+		results = append(results, d.destroyProject(ctx, cloneDir, project))
+	}
+	d.githubStatus.UpdateProjectResult(ctx, results)
+	return CommandResponse{ProjectResults: results}
+}
+
+// destroyProject destroys project and records how long it took.
+func (d *DestroyExecutor) destroyProject(ctx *CommandContext, cloneDir string, project models.Project) ProjectResult {
+	ctx.Log.Info("running destroy for project at path %q", project.Path)
+	start := time.Now()
+	result := d.destroy(ctx, cloneDir, project)
+	result.Path = project.Path
+	result.Duration = time.Since(start)
+	d.projectDurations.Observe([]string{ctx.BaseRepo.FullName, project.Path, Destroy.String()}, result.Duration.Seconds())
+	return result
+}
+
+func (d *DestroyExecutor) destroy(ctx *CommandContext, cloneDir string, project models.Project) ProjectResult {
+	tfEnv := ctx.Command.Environment
+	lockAttempt, err := d.locker.TryLock(project, tfEnv, ctx.Pull, ctx.User)
+	if err != nil {
+		return ProjectResult{Error: errors.Wrap(err, "acquiring lock")}
+	}
+	if lockAttempt.LockAcquired != true && lockAttempt.CurrLock.Pull.Num != ctx.Pull.Num {
+		return ProjectResult{Failure: fmt.Sprintf(
+			"This project is currently locked by #%d. The locking plan must be applied or discarded before future plans can execute.",
+			lockAttempt.CurrLock.Pull.Num)}
+	}
+	ctx.Log.Info("acquired lock with id %q", lockAttempt.LockKey)
+
+	absolutePath := filepath.Join(cloneDir, project.Path)
+	var destroyExtraArgs []string
+	config, hasConfig, err := projectConfig(ctx, d.configReader, absolutePath)
+	if err != nil {
+		return ProjectResult{Error: err}
+	}
+	if hasConfig {
+		ctx.Log.Info("parsed atlantis config file in %q", absolutePath)
+		destroyExtraArgs = config.GetExtraArguments(ctx.Command.Name.String())
+	}
+	envVars, failure := commentEnvVars(ctx, config)
+	if failure == "" {
+		failure = d.terraformFlagPolicy.Check(ctx, config, Destroy, initArgs(ctx, absolutePath, config))
+	}
+	if failure == "" {
+		failure = varFilesFailure(cloneDir, project.Path, ctx.Command.VarFiles)
+	}
+	if failure != "" {
+		return ProjectResult{Failure: failure}
+	}
+	roleEnvVars, cleanupRole, err := assumeRoleEnvVars(ctx, config)
+	if err != nil {
+		return ProjectResult{Error: err}
+	}
+	defer cleanupRole()
+	envVars = append(envVars, roleEnvVars...)
+
+	terraformVersion, err := projectTerraformVersion(ctx, d.terraform, absolutePath, config)
+	if err != nil {
+		return terraformErrResult(err)
+	}
+	constraints, _ := version.NewConstraint(">= 0.9.0")
+	if constraints.Check(terraformVersion) {
+		ctx.Log.Info("determined that we are running terraform with version >= 0.9.0. Running version %s", terraformVersion)
+		if ctx.Command.WorkspaceFlag {
+			workspaces, err := d.workspaceDiscovery.List(ctx, absolutePath, initArgs(ctx, absolutePath, config), terraformVersion)
+			if err != nil {
+				return terraformErrResult(err)
+			}
+			if !stringInSlice(tfEnv, workspaces) {
+				return ProjectResult{Failure: workspaceNotFoundFailure(tfEnv, workspaces)}
+			}
+		}
+		if _, err := d.terraform.RunInitAndEnv(ctx.Log, absolutePath, tfEnv, initArgs(ctx, absolutePath, config), terraformVersion, envVars); err != nil {
+			return terraformErrResult(err)
+		}
+	} else {
+		ctx.Log.Info("determined that we are running terraform with version < 0.9.0. Running version %s", terraformVersion)
+		terraformGetCmd := append([]string{"get", "-no-color"}, config.GetExtraArguments("get")...)
+		if _, err := d.terraform.RunCommandWithEnvVars(ctx.Log, absolutePath, terraformGetCmd, terraformVersion, tfEnv, envVars); err != nil {
+			return terraformErrResult(err)
+		}
+	}
+
+	tfParallelism := parallelism(ctx, config)
+	tfLockTimeout := lockTimeout(ctx, config, d.lockTimeout)
+	userVar := fmt.Sprintf("%s=%s", atlantisUserTFVar, ctx.User.Username)
+	tfDestroyCmd := append(append(append(append(append([]string{"destroy", "-no-color", "-auto-approve", "-var", userVar}, destroyExtraArgs...), parallelismArgs(tfParallelism)...), lockTimeoutArgs(tfLockTimeout)...), ctx.Command.Flags...), targetArgs(ctx.Command.Targets)...)
+	// destroy needs the same variables the project was planned with
+	var varFiles []string
+	tfEnvFileName := filepath.Join("env", tfEnv+".tfvars")
+	if _, err := os.Stat(filepath.Join(absolutePath, tfEnvFileName)); err == nil {
+		tfDestroyCmd = append(tfDestroyCmd, "-var-file", tfEnvFileName)
+		varFiles = append(varFiles, tfEnvFileName)
+	}
+	tfDestroyCmd = append(tfDestroyCmd, varFileArgs(ctx.Command.VarFiles)...)
+	varFiles = append(varFiles, ctx.Command.VarFiles...)
+	output, err := d.terraform.RunCommandWithTimeout(ctx.Log, absolutePath, tfDestroyCmd, terraformVersion, tfEnv, envVars, d.applyTimeout)
+	if err != nil {
+		if _, ok := err.(terraform.NotInstalledError); ok {
+			return terraformErrResult(err)
+		}
+		if timedOut, ok := err.(terraform.TimeoutError); ok {
+			return ProjectResult{Failure: timeoutFailure(timedOut, output), Parallelism: tfParallelism, LockTimeout: tfLockTimeout, Targets: ctx.Command.Targets, VarFiles: varFiles}
+		}
+		// like apply, the output shows what was destroyed before it failed
+		return ProjectResult{Error: fmt.Errorf("%s\n%s", err.Error(), output), Parallelism: tfParallelism, LockTimeout: tfLockTimeout, ExitCode: exitCode(err), Targets: ctx.Command.Targets, VarFiles: varFiles}
+	}
+	ctx.Log.Info("destroy succeeded")
+	return ProjectResult{DestroySuccess: output, Parallelism: tfParallelism, LockTimeout: tfLockTimeout, ExitCode: exitCode(nil), Targets: ctx.Command.Targets, VarFiles: varFiles}
+}
+
+func (d *DestroyExecutor) failureResponse(ctx *CommandContext, msg string) CommandResponse {
+	ctx.Log.Warn("%s", msg)
+	d.githubStatus.Update(ctx, Failure, DestroyStep)
+	return CommandResponse{Failure: msg}
+}
+
+func (d *DestroyExecutor) errorResponse(ctx *CommandContext, err error) CommandResponse {
+	ctx.Log.Err("%s", err)
+	d.githubStatus.Update(ctx, Error, DestroyStep)
+	return CommandResponse{Error: err}
+}
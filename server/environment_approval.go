@@ -0,0 +1,91 @@
+package server
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/hootsuite/atlantis/github"
+	"github.com/hootsuite/atlantis/models"
+	"github.com/pkg/errors"
+)
+
+// EnvironmentApproval checks that each project being applied has been
+// approved by the approvers its atlantis.yaml requires for the environment.
+// The atlantis.yaml is read from the base branch so that a pull request can't
+// change who needs to approve it.
+type EnvironmentApproval struct {
+	Github       github.Client
+	ConfigReader *ConfigReader
+}
+
+// OutstandingApproval describes a project that doesn't have enough of the
+// approvals required for the environment it's being applied to.
+type OutstandingApproval struct {
+	Path     string
+	Required ApplyApprovers
+	// Approved are the required approvers that have approved
+	Approved []string
+}
+
+// Outstanding returns the projects that are still waiting on the approvals
+// required for ctx.Command.Environment.
+func (e *EnvironmentApproval) Outstanding(ctx *CommandContext, projects []models.Project) ([]OutstandingApproval, error) {
+	var approvers []string
+	approversFetched := false
+	teamMembers := make(map[string][]string)
+	var outstanding []OutstandingApproval
+	for _, project := range projects {
+		configPath := path.Join(project.Path, ProjectConfigFile)
+		contents, exists, err := e.Github.GetFileContents(ctx.BaseRepo, configPath, ctx.Pull.BaseBranch)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fetching %s from %s", configPath, ctx.Pull.BaseBranch)
+		}
+		if !exists {
+			continue
+		}
+		config, err := e.ConfigReader.Parse([]byte(contents))
+		if err != nil {
+			return nil, errors.Wrapf(err, "project at path %q on %s", project.Path, ctx.Pull.BaseBranch)
+		}
+		required := config.GetApplyApprovers(ctx.Command.Environment)
+		if required == nil {
+			continue
+		}
+
+		// only call the API if a project needs approvers
+		if !approversFetched {
+			approvers, err = e.Github.GetApprovers(ctx.BaseRepo, ctx.Pull)
+			if err != nil {
+				return nil, errors.Wrap(err, "getting approvers")
+			}
+			approversFetched = true
+			ctx.Log.Info("pull request is approved by: %v", approvers)
+		}
+		approved, err := matchingApprovers(e.Github, required.Approvers, approvers, teamMembers)
+		if err != nil {
+			return nil, err
+		}
+		if len(approved) < required.MinApprovals {
+			outstanding = append(outstanding, OutstandingApproval{
+				Path:     project.Path,
+				Required: *required,
+				Approved: approved,
+			})
+		}
+	}
+	return outstanding, nil
+}
+
+// formatOutstandingApprovals renders the output of Outstanding for a comment.
+func formatOutstandingApprovals(command CommandName, env string, outstanding []OutstandingApproval) string {
+	msg := fmt.Sprintf("Running %s in the %s environment requires more approvals. Still waiting on:", command, env)
+	for _, o := range outstanding {
+		approved := "none so far"
+		if len(o.Approved) > 0 {
+			approved = "approved by " + strings.Join(o.Approved, ", ")
+		}
+		msg += fmt.Sprintf("\n* `%s`: %d more approval(s) from %s (%s)", o.Path, o.Required.MinApprovals-len(o.Approved), strings.Join(o.Required.Approvers, ", "), approved)
+	}
+	return msg
+}
@@ -0,0 +1,72 @@
+package server_test
+
+import (
+	"log"
+	"os"
+	"testing"
+
+	"github.com/hootsuite/atlantis/github/mocks"
+	"github.com/hootsuite/atlantis/logging"
+	"github.com/hootsuite/atlantis/models"
+	"github.com/hootsuite/atlantis/models/fixtures"
+	"github.com/hootsuite/atlantis/server"
+	. "github.com/hootsuite/atlantis/testing_util"
+	. "github.com/petergtz/pegomock"
+)
+
+func TestOutstanding(t *testing.T) {
+	t.Log("the atlantis.yaml files should be read from the base branch")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	for dir, config := range map[string]string{
+		"prod-only": "apply_approvers:\n  - environment: production\n    approvers: [\"@alice\", \"hootsuite/sre\"]\n    min_approvals: 2\n",
+		"approved":  "apply_approvers:\n  - environment: production\n    approvers: [bob]\n",
+		"staging":   "apply_approvers:\n  - environment: staging\n    approvers: [nobody]\n",
+	} {
+		When(client.GetFileContents(fixtures.Repo, dir+"/"+server.ProjectConfigFile, fixtures.Pull.BaseBranch)).ThenReturn(config, true, nil)
+	}
+	When(client.GetApprovers(fixtures.Repo, fixtures.Pull)).ThenReturn([]string{"bob", "sre-member"}, nil)
+	When(client.GetTeamMembers("hootsuite", "sre")).ThenReturn([]string{"sre-member"}, nil)
+	e := server.EnvironmentApproval{Github: client, ConfigReader: &server.ConfigReader{}}
+	ctx := &server.CommandContext{
+		BaseRepo: fixtures.Repo,
+		Pull:     fixtures.Pull,
+		Command:  &server.Command{Name: server.Apply, Environment: "production"},
+		Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+	var projects []models.Project
+	for _, dir := range []string{"approved", "no-config", "prod-only", "staging"} {
+		projects = append(projects, models.NewProject(fixtures.Repo.FullName, dir))
+	}
+
+	outstanding, err := e.Outstanding(ctx, projects)
+	Ok(t, err)
+	Equals(t, []server.OutstandingApproval{
+		{
+			Path: "prod-only",
+			Required: server.ApplyApprovers{
+				Environment:  "production",
+				Approvers:    []string{"@alice", "hootsuite/sre"},
+				MinApprovals: 2,
+			},
+			Approved: []string{"sre-member"},
+		},
+	}, outstanding)
+}
+
+func TestOutstanding_NoApproversRequired(t *testing.T) {
+	t.Log("if no project requires approvers we shouldn't call GitHub")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	e := server.EnvironmentApproval{Github: client, ConfigReader: &server.ConfigReader{}}
+	ctx := &server.CommandContext{
+		BaseRepo: fixtures.Repo,
+		Pull:     fixtures.Pull,
+		Command:  &server.Command{Name: server.Apply, Environment: "production"},
+		Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+	outstanding, err := e.Outstanding(ctx, []models.Project{models.NewProject(fixtures.Repo.FullName, ".")})
+	Ok(t, err)
+	Equals(t, 0, len(outstanding))
+	client.VerifyWasCalled(Never()).GetApprovers(fixtures.Repo, fixtures.Pull)
+}
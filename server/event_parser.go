@@ -3,19 +3,83 @@ package server
 import (
 	"errors"
 	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/google/go-github/github"
+	"github.com/hootsuite/atlantis/bitbucket"
 	"github.com/hootsuite/atlantis/models"
 )
 
+// envVarKeyRegex matches valid environment variable names.
+var envVarKeyRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// resourceTypeRegex matches terraform resource types, ex. aws_security_group.
+var resourceTypeRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// resourceAddressRegex matches terraform resource addresses, ex.
+// module.vpc.aws_subnet.private[0] or aws_instance.web["blue"].
+var resourceAddressRegex = regexp.MustCompile(`^[A-Za-z0-9_.\-\[\]"]+$`)
+
 //go:generate pegomock generate --use-experimental-model-gen --package mocks -o mocks/mock_event_parsing.go EventParsing
 
 type Command struct {
 	Name        CommandName
 	Environment string
-	Verbose     bool
-	Flags       []string
+	// WorkspaceFlag is true if the environment was set with the -w flag. In
+	// that case it must be one of the workspaces discovered from terraform.
+	WorkspaceFlag bool
+	Verbose       bool
+	// Override is true if --override was set to bypass the apply requirements.
+	// Only admins can override.
+	Override bool
+	// Trust is true if --trust was set to run the command on a pull request
+	// from a fork by a non-collaborator. Only collaborators can trust.
+	Trust bool
+	// FmtCheck is true if --fmt-check was set to check that each project's
+	// files are formatted before planning it.
+	FmtCheck bool
+	// EnvVars are the environment variables set with --env KEY=value to
+	// run terraform with. They must be allowed by the project's config.
+	EnvVars map[string]string
+	// AllEnvs is true if --all-envs was set to plan every environment that
+	// each project is configured for rather than a single environment.
+	AllEnvs bool
+	// Environments are the environments to plan or apply in, in order, if
+	// more than one was set, ex. with -e staging,prod. Environment is then
+	// all of them joined with commas.
+	Environments []string
+	// Parallelism is the -parallelism to run terraform with or 0 if it
+	// wasn't set in the comment.
+	Parallelism int
+	// LockTimeout is the -lock-timeout to run terraform with or empty if it
+	// wasn't set in the comment.
+	LockTimeout string
+	// PlanScope is AllProjectsScope if --all was set, ChangedProjectsScope if
+	// --changed was set and otherwise empty to use the default scope.
+	PlanScope string
+	// Dir is the directory, relative to the root of the repo, set with -d to
+	// only plan the project in that directory, or empty if it wasn't set.
+	Dir string
+	// Autoplan is true if the plan was run automatically because the pull
+	// request was updated rather than because of a comment
+	Autoplan bool
+	// TargetTypes are the resource types set with --target-type. Only the
+	// resources of those types are planned, by passing them as -target.
+	TargetTypes []string
+	// Targets are the resource addresses set with -target, in the order
+	// they were set. They're passed to terraform as -target.
+	Targets []string
+	// VarFiles are the paths, relative to the project, set with -var-file in
+	// the order they were set. They're passed to terraform as -var-file
+	// after checking they're in the repo.
+	VarFiles []string
+	// Addresses are the resource addresses that state rm removes from the
+	// project's state, in the order they were set.
+	Addresses []string
+	Flags     []string
 }
 
 type EventParsing interface {
@@ -28,6 +92,77 @@ type EventParsing interface {
 type EventParser struct {
 	GithubUser  string
 	GithubToken string
+	// DefaultVerbose is whether commands include their log if the comment
+	// doesn't set --verbose
+	DefaultVerbose bool
+	// GitlabHostname and GitlabToken are empty if GitLab isn't configured.
+	// Repos cloned from GitlabHostname are GitLab repos.
+	GitlabHostname string
+	GitlabToken    string
+	// BitbucketURL, BitbucketUser and BitbucketToken are empty if Bitbucket
+	// isn't configured. Repos cloned from BitbucketURL's host are Bitbucket
+	// repos.
+	BitbucketURL   string
+	BitbucketUser  string
+	BitbucketToken string
+}
+
+// BitbucketEvent is the part of the webhooks Bitbucket Server sends for pull
+// requests that we use. Comment is only set for pr:comment:added events.
+type BitbucketEvent struct {
+	EventKey string `json:"eventKey"`
+	Actor    struct {
+		Name string `json:"name"`
+	} `json:"actor"`
+	PullRequest struct {
+		ID    int `json:"id"`
+		ToRef struct {
+			Repository struct {
+				Slug    string `json:"slug"`
+				Project struct {
+					Key string `json:"key"`
+				} `json:"project"`
+			} `json:"repository"`
+		} `json:"toRef"`
+	} `json:"pullRequest"`
+	Comment struct {
+		ID   int    `json:"id"`
+		Text string `json:"text"`
+	} `json:"comment"`
+}
+
+// GitlabNoteEvent is the part of the webhook GitLab sends when a comment,
+// which it calls a note, is made that we use.
+type GitlabNoteEvent struct {
+	User struct {
+		Username string `json:"username"`
+	} `json:"user"`
+	Project struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+		Path              string `json:"path"`
+		GitHTTPURL        string `json:"git_http_url"`
+	} `json:"project"`
+	ObjectAttributes struct {
+		ID           int    `json:"id"`
+		Note         string `json:"note"`
+		NoteableType string `json:"noteable_type"`
+	} `json:"object_attributes"`
+	MergeRequest struct {
+		IID int `json:"iid"`
+	} `json:"merge_request"`
+}
+
+// GitlabMergeRequestEvent is the part of the webhook GitLab sends when a
+// merge request is opened, updated, closed or merged that we use.
+type GitlabMergeRequestEvent struct {
+	Project struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+		GitHTTPURL        string `json:"git_http_url"`
+	} `json:"project"`
+	ObjectAttributes struct {
+		IID    int    `json:"iid"`
+		Action string `json:"action"`
+	} `json:"object_attributes"`
 }
 
 // DetermineCommand parses the comment as an atlantis command. If it succeeds,
@@ -35,15 +170,30 @@ type EventParser struct {
 func (e *EventParser) DetermineCommand(comment *github.IssueCommentEvent) (*Command, error) {
 	// valid commands contain:
 	// the initial "executable" name, 'run' or 'atlantis' or '@GithubUser' where GithubUser is the api user atlantis is running as
-	// then a command, either 'plan', 'apply', or 'help'
-	// then an optional environment argument, an optional --verbose flag and any other flags
+	// then a command, either 'plan', 'apply', 'destroy', 'state rm', 'unlock', 'workspaces' or 'help'
+	// then an optional environment argument or -w flag, an optional --verbose flag and any other flags
 	//
 	// examples:
 	// atlantis help
+	// atlantis workspaces
 	// run plan
 	// @GithubUser plan staging
+	// atlantis plan -w staging
 	// atlantis plan staging --verbose
 	// atlantis plan staging --verbose -key=value -key2 value2
+	// atlantis plan --verbose=false
+	// atlantis apply production --override
+	// atlantis plan --trust
+	// atlantis plan staging --env AWS_REGION=us-west-2
+	// atlantis plan staging -var-file=env/staging-us.tfvars
+	// atlantis plan --all-envs
+	// atlantis plan -e staging,prod
+	// atlantis plan -d path/to/project
+	// atlantis plan --fmt-check
+	// atlantis apply staging -parallelism=5
+	// atlantis destroy review
+	// atlantis unlock staging
+	// atlantis state rm -d path/to/project -w staging aws_instance.web
 	commentBody := comment.Comment.GetBody()
 	if commentBody == "" {
 		return nil, errors.New("comment.body is null")
@@ -55,18 +205,49 @@ func (e *EventParser) DetermineCommand(comment *github.IssueCommentEvent) (*Comm
 	}
 
 	env := "default"
-	verbose := false
+	verbose := e.DefaultVerbose
+	override := false
+	trust := false
+	fmtCheck := false
+	allEnvs := false
+	planScope := ""
+	dir := ""
+	parallelism := 0
+	lockTimeout := ""
+	workspaceFlag := false
+	envArg := false
+	var envVars map[string]string
+	var targetTypes []string
+	var targets []string
+	var varFiles []string
 	var flags []string
 
 	if !e.stringInSlice(args[0], []string{"run", "atlantis", "@" + e.GithubUser}) {
 		return nil, err
 	}
-	if !e.stringInSlice(args[1], []string{"plan", "apply", "help"}) {
+	if !e.stringInSlice(args[1], []string{"plan", "apply", "destroy", "state", "unlock", "workspaces", "help"}) {
 		return nil, err
 	}
 	if args[1] == "help" {
 		return &Command{Name: Help}, nil
 	}
+	if args[1] == "workspaces" {
+		verbose, _ = e.extractVerboseFlag(args[2:], verbose)
+		return &Command{Name: Workspaces, Environment: env, Verbose: verbose, Trust: e.stringInSlice("--trust", args[2:])}, nil
+	}
+	if args[1] == "unlock" {
+		// unlock only takes an optional environment
+		if len(args) > 3 || (len(args) == 3 && strings.HasPrefix(args[2], "-")) {
+			return nil, errors.New("unlock only accepts an environment, ex. atlantis unlock staging")
+		}
+		if len(args) == 3 {
+			env = args[2]
+		}
+		return &Command{Name: Unlock, Environment: env}, nil
+	}
+	if args[1] == "state" {
+		return e.determineStateRmCommand(args[2:], verbose)
+	}
 	command := args[1]
 
 	if len(args) > 2 {
@@ -76,29 +257,230 @@ func (e *EventParser) DetermineCommand(comment *github.IssueCommentEvent) (*Comm
 		// environment not a flag
 		if !strings.HasPrefix(args[2], "-") {
 			env = args[2]
+			envArg = true
 			flags = args[3:]
 		}
 
 		// check for --verbose specially and then remove any additional
-		// occurrences
-		if e.stringInSlice("--verbose", flags) {
-			verbose = true
-			flags = e.removeOccurrences("--verbose", flags)
+		// occurrences. It overrides the server's default
+		verbose, flags = e.extractVerboseFlag(flags, verbose)
+
+		// same for --override
+		if e.stringInSlice("--override", flags) {
+			override = true
+			flags = e.removeOccurrences("--override", flags)
+		}
+
+		// and --trust
+		if e.stringInSlice("--trust", flags) {
+			trust = true
+			flags = e.removeOccurrences("--trust", flags)
+		}
+
+		// and --fmt-check
+		if e.stringInSlice("--fmt-check", flags) {
+			if command != "plan" {
+				return nil, errors.New("the --fmt-check flag can only be used with plan")
+			}
+			fmtCheck = true
+			flags = e.removeOccurrences("--fmt-check", flags)
+		}
+
+		// and --all-envs
+		if e.stringInSlice("--all-envs", flags) {
+			if command != "plan" {
+				return nil, errors.New("the --all-envs flag can only be used with plan")
+			}
+			allEnvs = true
+			flags = e.removeOccurrences("--all-envs", flags)
+		}
+
+		// and --all and --changed
+		for _, scopeFlag := range []struct{ flag, scope string }{{"--all", AllProjectsScope}, {"--changed", ChangedProjectsScope}} {
+			flag := scopeFlag.flag
+			if !e.stringInSlice(flag, flags) {
+				continue
+			}
+			if command != "plan" {
+				return nil, fmt.Errorf("the %s flag can only be used with plan", flag)
+			}
+			if planScope != "" {
+				return nil, errors.New("the --all and --changed flags can't be used together")
+			}
+			planScope = scopeFlag.scope
+			flags = e.removeOccurrences(flag, flags)
+		}
+
+		// -d restricts the plan or apply to a single project so it replaces
+		// the scope
+		var dErr error
+		dir, flags, dErr = e.extractDirFlag(flags)
+		if dErr != nil {
+			return nil, dErr
+		}
+		if dir != "" && command != "plan" && command != "apply" {
+			return nil, errors.New("the -d flag can only be used with plan or apply")
+		}
+		if dir != "" && planScope != "" {
+			return nil, errors.New("the -d flag can't be used with --all or --changed")
+		}
+
+		// -e sets the environment like the environment argument does, ex.
+		// to a list of them
+		envFlag, remaining, eErr := e.extractEnvironmentFlag(flags)
+		if eErr != nil {
+			return nil, eErr
+		}
+		flags = remaining
+		if envFlag != "" {
+			if envArg {
+				return nil, errors.New("the -e flag can't be used with an environment argument")
+			}
+			env = envFlag
+		}
+
+		// -w selects a workspace discovered from terraform and takes
+		// precedence over the environment argument
+		workspace, remaining, wErr := e.extractWorkspaceFlag(flags)
+		if wErr != nil {
+			return nil, wErr
+		}
+		flags = remaining
+		if workspace != "" && envFlag != "" {
+			return nil, errors.New("the -e and -w flags can't be used together")
+		}
+		if workspace != "" {
+			env = workspace
+			workspaceFlag = true
+		}
+		if allEnvs && (env != "default" || workspaceFlag) {
+			return nil, errors.New("the --all-envs flag can't be used with an environment")
+		}
+
+		// -parallelism is validated here and added back by the executors since
+		// it can also be set in the project's config
+		var pErr error
+		parallelism, flags, pErr = e.extractParallelismFlag(flags)
+		if pErr != nil {
+			return nil, pErr
+		}
+		// same for -lock-timeout
+		var ltErr error
+		lockTimeout, flags, ltErr = e.extractLockTimeoutFlag(flags)
+		if ltErr != nil {
+			return nil, ltErr
+		}
+
+		// --env flags are set as environment variables rather than passed
+		// to terraform
+		var envErr error
+		envVars, flags, envErr = e.extractEnvFlags(flags)
+		if envErr != nil {
+			return nil, envErr
+		}
+
+		// --target-type is expanded into -target flags by the plan executor
+		// once it knows the project's resources
+		var tErr error
+		targetTypes, flags, tErr = e.extractTargetTypeFlags(flags)
+		if tErr != nil {
+			return nil, tErr
+		}
+		if len(targetTypes) > 0 && command != "plan" {
+			return nil, errors.New("the --target-type flag can only be used with plan")
+		}
+
+		// -target is added back by the executors so they can report which
+		// resources were targeted
+		var targetErr error
+		targets, flags, targetErr = e.extractTargetFlags(flags)
+		if targetErr != nil {
+			return nil, targetErr
+		}
+
+		// -var-file is added back by the executors once they've checked the
+		// files are in the repo
+		var varFileErr error
+		varFiles, flags, varFileErr = e.extractVarFileFlags(flags)
+		if varFileErr != nil {
+			return nil, varFileErr
+		}
+	}
+
+	// a comma separated list of environments runs the command in each of them
+	var environments []string
+	if !workspaceFlag && strings.Contains(env, ",") {
+		var envsErr error
+		environments, envsErr = e.splitEnvironments(env)
+		if envsErr != nil {
+			return nil, envsErr
+		}
+		if command != "plan" && command != "apply" {
+			return nil, errors.New("more than one environment can only be used with plan or apply")
 		}
 	}
 
-	c := &Command{Verbose: verbose, Environment: env, Flags: flags}
+	c := &Command{Verbose: verbose, Override: override, Trust: trust, FmtCheck: fmtCheck, Environment: env, WorkspaceFlag: workspaceFlag, EnvVars: envVars, AllEnvs: allEnvs, Environments: environments, Parallelism: parallelism, LockTimeout: lockTimeout, PlanScope: planScope, Dir: dir, TargetTypes: targetTypes, Targets: targets, VarFiles: varFiles, Flags: flags}
 	switch command {
 	case "plan":
 		c.Name = Plan
 	case "apply":
 		c.Name = Apply
+	case "destroy":
+		c.Name = Destroy
 	default:
-		return nil, fmt.Errorf("something went wrong parsing the command, the command we parsed %q was not apply or plan", command)
+		return nil, fmt.Errorf("something went wrong parsing the command, the command we parsed %q was not apply, plan or destroy", command)
 	}
 	return c, nil
 }
 
+// determineStateRmCommand parses the arguments after "atlantis state". Since
+// removing resources from the state can't be undone, the project must be set
+// with -d rather than found from the modified files, and only -w, --verbose,
+// --override and --trust are accepted besides the addresses.
+func (e *EventParser) determineStateRmCommand(args []string, verbose bool) (*Command, error) {
+	if len(args) == 0 || args[0] != "rm" {
+		return nil, errors.New("the state command only supports rm, ex. atlantis state rm -d path/to/project aws_instance.web")
+	}
+	flags := args[1:]
+	verbose, flags = e.extractVerboseFlag(flags, verbose)
+	override := e.stringInSlice("--override", flags)
+	flags = e.removeOccurrences("--override", flags)
+	trust := e.stringInSlice("--trust", flags)
+	flags = e.removeOccurrences("--trust", flags)
+	dir, flags, err := e.extractDirFlag(flags)
+	if err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		return nil, errors.New("state rm requires the project's directory, ex. atlantis state rm -d path/to/project aws_instance.web")
+	}
+	workspace, flags, err := e.extractWorkspaceFlag(flags)
+	if err != nil {
+		return nil, err
+	}
+	env := "default"
+	if workspace != "" {
+		env = workspace
+	}
+
+	var addresses []string
+	for _, flag := range flags {
+		if strings.HasPrefix(flag, "-") {
+			return nil, fmt.Errorf("state rm doesn't accept the %s flag", flag)
+		}
+		address := unquote(flag)
+		if !resourceAddressRegex.MatchString(address) {
+			return nil, fmt.Errorf("%q isn't a resource address, ex. aws_instance.web", flag)
+		}
+		addresses = append(addresses, address)
+	}
+	if len(addresses) == 0 {
+		return nil, errors.New("state rm requires the addresses of the resources to remove, ex. atlantis state rm -d path/to/project aws_instance.web")
+	}
+	return &Command{Name: StateRm, Environment: env, WorkspaceFlag: workspace != "", Verbose: verbose, Override: override, Trust: trust, Dir: dir, Addresses: addresses}, nil
+}
+
 func (e *EventParser) ExtractCommentData(comment *github.IssueCommentEvent, ctx *CommandContext) error {
 	repo, err := e.ExtractRepoData(comment.Repo)
 	if err != nil {
@@ -127,9 +509,152 @@ func (e *EventParser) ExtractCommentData(comment *github.IssueCommentEvent, ctx
 	ctx.Pull = models.PullRequest{
 		Num: pullNum,
 	}
+	ctx.CommentID = comment.Comment.GetID()
+	return nil
+}
+
+// ExtractGitlabCommentData is the GitLab version of ExtractCommentData. It
+// sets ctx's repo, user and merge request from event.
+func (e *EventParser) ExtractGitlabCommentData(event *GitlabNoteEvent, ctx *CommandContext) error {
+	fullName := event.Project.PathWithNamespace
+	if fullName == "" || !strings.Contains(fullName, "/") {
+		return errors.New("project.path_with_namespace is null")
+	}
+	sanitizedCloneURL := event.Project.GitHTTPURL
+	if sanitizedCloneURL == "" {
+		return errors.New("project.git_http_url is null")
+	}
+	if event.MergeRequest.IID == 0 {
+		return errors.New("merge_request.iid is null")
+	}
+	if event.User.Username == "" {
+		return errors.New("user.username is null")
+	}
+	// projects can be in nested groups so the owner is everything up to
+	// the project's name
+	slash := strings.LastIndex(fullName, "/")
+	ctx.BaseRepo = models.Repo{
+		FullName:          fullName,
+		Owner:             fullName[:slash],
+		Name:              fullName[slash+1:],
+		CloneURL:          e.gitlabCloneURL(sanitizedCloneURL),
+		SanitizedCloneURL: sanitizedCloneURL,
+		VCSHost:           models.Gitlab,
+	}
+	ctx.User = models.User{Username: event.User.Username}
+	ctx.Pull = models.PullRequest{Num: event.MergeRequest.IID}
+	ctx.CommentID = event.ObjectAttributes.ID
+	return nil
+}
+
+// ExtractGitlabMergeRequestData returns the repo the merge request of event
+// is into and the merge request, with only its number set.
+func (e *EventParser) ExtractGitlabMergeRequestData(event *GitlabMergeRequestEvent) (models.Repo, models.PullRequest, error) {
+	fullName := event.Project.PathWithNamespace
+	if fullName == "" || !strings.Contains(fullName, "/") {
+		return models.Repo{}, models.PullRequest{}, errors.New("project.path_with_namespace is null")
+	}
+	sanitizedCloneURL := event.Project.GitHTTPURL
+	if sanitizedCloneURL == "" {
+		return models.Repo{}, models.PullRequest{}, errors.New("project.git_http_url is null")
+	}
+	if event.ObjectAttributes.IID == 0 {
+		return models.Repo{}, models.PullRequest{}, errors.New("object_attributes.iid is null")
+	}
+	slash := strings.LastIndex(fullName, "/")
+	return models.Repo{
+		FullName:          fullName,
+		Owner:             fullName[:slash],
+		Name:              fullName[slash+1:],
+		CloneURL:          e.gitlabCloneURL(sanitizedCloneURL),
+		SanitizedCloneURL: sanitizedCloneURL,
+		VCSHost:           models.Gitlab,
+	}, models.PullRequest{Num: event.ObjectAttributes.IID}, nil
+}
+
+// ExtractBitbucketCommentData is the Bitbucket version of
+// ExtractCommentData. It sets ctx's repo, user and pull request from event.
+func (e *EventParser) ExtractBitbucketCommentData(event *BitbucketEvent, ctx *CommandContext) error {
+	repo, pull, err := e.ExtractBitbucketPullData(event)
+	if err != nil {
+		return err
+	}
+	if event.Actor.Name == "" {
+		return errors.New("actor.name is null")
+	}
+	if event.Comment.ID == 0 {
+		return errors.New("comment.id is null")
+	}
+	ctx.BaseRepo = repo
+	ctx.User = models.User{Username: event.Actor.Name}
+	ctx.Pull = pull
+	ctx.CommentID = event.Comment.ID
 	return nil
 }
 
+// ExtractBitbucketPullData returns the repo the pull request of event is
+// into and the pull request, with only its number set.
+func (e *EventParser) ExtractBitbucketPullData(event *BitbucketEvent) (models.Repo, models.PullRequest, error) {
+	repository := event.PullRequest.ToRef.Repository
+	if repository.Project.Key == "" {
+		return models.Repo{}, models.PullRequest{}, errors.New("pullRequest.toRef.repository.project.key is null")
+	}
+	if repository.Slug == "" {
+		return models.Repo{}, models.PullRequest{}, errors.New("pullRequest.toRef.repository.slug is null")
+	}
+	if event.PullRequest.ID == 0 {
+		return models.Repo{}, models.PullRequest{}, errors.New("pullRequest.id is null")
+	}
+	sanitizedCloneURL := bitbucket.CloneURL(e.BitbucketURL, repository.Project.Key, repository.Slug)
+	return models.Repo{
+		FullName:          repository.Project.Key + "/" + repository.Slug,
+		Owner:             repository.Project.Key,
+		Name:              repository.Slug,
+		CloneURL:          e.bitbucketCloneURL(sanitizedCloneURL),
+		SanitizedCloneURL: sanitizedCloneURL,
+		VCSHost:           models.Bitbucket,
+	}, models.PullRequest{Num: event.PullRequest.ID}, nil
+}
+
+// isBitbucketURL returns true if cloneURL is for a repo hosted on Bitbucket.
+func (e *EventParser) isBitbucketURL(cloneURL string) bool {
+	if e.BitbucketURL == "" {
+		return false
+	}
+	base, err := url.Parse(e.BitbucketURL)
+	if err != nil {
+		return false
+	}
+	u, err := url.Parse(cloneURL)
+	return err == nil && u.Host == base.Host
+}
+
+// bitbucketCloneURL returns cloneURL with the credentials to clone it from
+// Bitbucket with our user and token.
+func (e *EventParser) bitbucketCloneURL(cloneURL string) string {
+	u, err := url.Parse(cloneURL)
+	if err != nil {
+		return cloneURL
+	}
+	u.User = url.UserPassword(e.BitbucketUser, e.BitbucketToken)
+	return u.String()
+}
+
+// isGitlabURL returns true if cloneURL is for a repo hosted on GitLab.
+func (e *EventParser) isGitlabURL(cloneURL string) bool {
+	if e.GitlabHostname == "" {
+		return false
+	}
+	u, err := url.Parse(cloneURL)
+	return err == nil && u.Host == e.GitlabHostname
+}
+
+// gitlabCloneURL returns cloneURL with the credentials to clone it from
+// GitLab with our token.
+func (e *EventParser) gitlabCloneURL(cloneURL string) string {
+	return strings.Replace(cloneURL, "https://", fmt.Sprintf("https://oauth2:%s@", e.GitlabToken), -1)
+}
+
 func (e *EventParser) ExtractPullData(pull *github.PullRequest) (models.PullRequest, models.Repo, error) {
 	var pullModel models.PullRequest
 	var headRepoModel models.Repo
@@ -150,6 +675,10 @@ func (e *EventParser) ExtractPullData(pull *github.PullRequest) (models.PullRequ
 	if branch == "" {
 		return pullModel, headRepoModel, errors.New("head.ref is null")
 	}
+	baseBranch := pull.Base.GetRef()
+	if baseBranch == "" {
+		return pullModel, headRepoModel, errors.New("base.ref is null")
+	}
 	authorUsername := pull.User.GetLogin()
 	if authorUsername == "" {
 		return pullModel, headRepoModel, errors.New("user.login is null")
@@ -168,6 +697,7 @@ func (e *EventParser) ExtractPullData(pull *github.PullRequest) (models.PullRequ
 		BaseCommit: base,
 		Author:     authorUsername,
 		Branch:     branch,
+		BaseBranch: baseBranch,
 		HeadCommit: commit,
 		URL:        url,
 		Num:        num,
@@ -193,6 +723,31 @@ func (e *EventParser) ExtractRepoData(ghRepo *github.Repository) (models.Repo, e
 		return repo, errors.New("repository.clone_url is null")
 	}
 
+	// GitLab's merge requests are converted to GitHub's pull requests by
+	// the GitLab client so their repos are parsed here too
+	if e.isGitlabURL(repoSanitizedCloneURL) {
+		return models.Repo{
+			Owner:             repoOwner,
+			FullName:          repoFullName,
+			CloneURL:          e.gitlabCloneURL(repoSanitizedCloneURL),
+			SanitizedCloneURL: repoSanitizedCloneURL,
+			Name:              repoName,
+			VCSHost:           models.Gitlab,
+		}, nil
+	}
+
+	// and so are Bitbucket's pull requests
+	if e.isBitbucketURL(repoSanitizedCloneURL) {
+		return models.Repo{
+			Owner:             repoOwner,
+			FullName:          repoFullName,
+			CloneURL:          e.bitbucketCloneURL(repoSanitizedCloneURL),
+			SanitizedCloneURL: repoSanitizedCloneURL,
+			Name:              repoName,
+			VCSHost:           models.Bitbucket,
+		}, nil
+	}
+
 	// construct HTTPS repo clone url string with username and password
 	repoCloneURL := strings.Replace(repoSanitizedCloneURL, "https://", fmt.Sprintf("https://%s:%s@", e.GithubUser, e.GithubToken), -1)
 
@@ -205,6 +760,311 @@ func (e *EventParser) ExtractRepoData(ghRepo *github.Repository) (models.Repo, e
 	}, nil
 }
 
+// extractWorkspaceFlag looks for "-w name" or "-w=name" in flags. It returns
+// the workspace name, or "" if the flag wasn't set, and the remaining flags.
+func (e *EventParser) extractWorkspaceFlag(flags []string) (string, []string, error) {
+	var workspace string
+	var out []string
+	for i := 0; i < len(flags); i++ {
+		switch {
+		case flags[i] == "-w":
+			if i+1 >= len(flags) || strings.HasPrefix(flags[i+1], "-") {
+				return "", nil, errors.New("the -w flag requires a workspace name")
+			}
+			workspace = flags[i+1]
+			i++
+		case strings.HasPrefix(flags[i], "-w="):
+			workspace = strings.TrimPrefix(flags[i], "-w=")
+			if workspace == "" {
+				return "", nil, errors.New("the -w flag requires a workspace name")
+			}
+		default:
+			out = append(out, flags[i])
+		}
+	}
+	return workspace, out, nil
+}
+
+// extractEnvironmentFlag looks for "-e env" or "-e=env" in flags, where env
+// can be a comma separated list of environments. It returns the last one's
+// value, or an empty string if it wasn't set, and the remaining flags.
+func (e *EventParser) extractEnvironmentFlag(flags []string) (string, []string, error) {
+	var env string
+	var out []string
+	for i := 0; i < len(flags); i++ {
+		switch {
+		case flags[i] == "-e":
+			if i+1 >= len(flags) || strings.HasPrefix(flags[i+1], "-") {
+				return "", nil, errors.New("the -e flag requires an environment, ex. -e staging,prod")
+			}
+			env = flags[i+1]
+			i++
+		case strings.HasPrefix(flags[i], "-e="):
+			env = strings.TrimPrefix(flags[i], "-e=")
+			if env == "" {
+				return "", nil, errors.New("the -e flag requires an environment, ex. -e staging,prod")
+			}
+		default:
+			out = append(out, flags[i])
+		}
+	}
+	return env, out, nil
+}
+
+// splitEnvironments splits the comma separated list of environments in env.
+// Each one must be set once.
+func (e *EventParser) splitEnvironments(env string) ([]string, error) {
+	var envs []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(env, ",") {
+		if name == "" {
+			return nil, fmt.Errorf("the environment list %q has an empty environment", env)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("the environment list %q has %s more than once", env, name)
+		}
+		seen[name] = true
+		envs = append(envs, name)
+	}
+	return envs, nil
+}
+
+// extractVerboseFlag looks for "--verbose", "--verbose=true" or
+// "--verbose=false" in flags. It returns the last one's value, or verbose if
+// none were set, and the remaining flags.
+func (e *EventParser) extractVerboseFlag(flags []string, verbose bool) (bool, []string) {
+	var out []string
+	for _, flag := range flags {
+		switch flag {
+		case "--verbose", "--verbose=true":
+			verbose = true
+		case "--verbose=false":
+			verbose = false
+		default:
+			out = append(out, flag)
+		}
+	}
+	return verbose, out
+}
+
+// extractDirFlag looks for "-d dir", "-d=dir", "--dir dir" or "--dir=dir" in
+// flags. It returns dir, or "" if it wasn't set, and the remaining flags.
+func (e *EventParser) extractDirFlag(flags []string) (string, []string, error) {
+	dir := ""
+	var out []string
+	for i := 0; i < len(flags); i++ {
+		var value string
+		switch {
+		case flags[i] == "-d" || flags[i] == "--dir":
+			if i+1 < len(flags) && !strings.HasPrefix(flags[i+1], "-") {
+				value = flags[i+1]
+			}
+			i++
+		case strings.HasPrefix(flags[i], "-d="):
+			value = strings.TrimPrefix(flags[i], "-d=")
+		case strings.HasPrefix(flags[i], "--dir="):
+			value = strings.TrimPrefix(flags[i], "--dir=")
+		default:
+			out = append(out, flags[i])
+			continue
+		}
+		value = unquote(value)
+		if value == "" {
+			return "", nil, errors.New("the -d flag requires a directory, ex. -d=path/to/project")
+		}
+		dir = value
+	}
+	return dir, out, nil
+}
+
+// extractParallelismFlag looks for "-parallelism N" or "-parallelism=N" in
+// flags. It returns N, or 0 if it wasn't set, and the remaining flags.
+func (e *EventParser) extractParallelismFlag(flags []string) (int, []string, error) {
+	parallelism := 0
+	var out []string
+	for i := 0; i < len(flags); i++ {
+		var value string
+		switch {
+		case flags[i] == "-parallelism":
+			if i+1 < len(flags) {
+				value = flags[i+1]
+			}
+			i++
+		case strings.HasPrefix(flags[i], "-parallelism="):
+			value = strings.TrimPrefix(flags[i], "-parallelism=")
+		default:
+			out = append(out, flags[i])
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return 0, nil, errors.New("the -parallelism flag must be a positive integer")
+		}
+		parallelism = n
+	}
+	return parallelism, out, nil
+}
+
+// extractLockTimeoutFlag looks for "-lock-timeout D" or "-lock-timeout=D" in
+// flags. It returns D, or "" if it wasn't set, and the remaining flags.
+func (e *EventParser) extractLockTimeoutFlag(flags []string) (string, []string, error) {
+	lockTimeout := ""
+	var out []string
+	for i := 0; i < len(flags); i++ {
+		var value string
+		switch {
+		case flags[i] == "-lock-timeout":
+			if i+1 < len(flags) {
+				value = flags[i+1]
+			}
+			i++
+		case strings.HasPrefix(flags[i], "-lock-timeout="):
+			value = strings.TrimPrefix(flags[i], "-lock-timeout=")
+		default:
+			out = append(out, flags[i])
+			continue
+		}
+		if err := validateLockTimeout(value); err != nil {
+			return "", nil, errors.New("the -lock-timeout flag must be a duration, ex. -lock-timeout=5m")
+		}
+		lockTimeout = value
+	}
+	return lockTimeout, out, nil
+}
+
+// extractEnvFlags looks for "--env KEY=value" or "--env=KEY=value" in flags.
+// It returns the environment variables set, or nil if none were, and the
+// remaining flags.
+func (e *EventParser) extractEnvFlags(flags []string) (map[string]string, []string, error) {
+	var envVars map[string]string
+	var out []string
+	for i := 0; i < len(flags); i++ {
+		var pair string
+		switch {
+		case flags[i] == "--env":
+			if i+1 >= len(flags) {
+				return nil, nil, errors.New("the --env flag must be of the form --env KEY=value")
+			}
+			pair = flags[i+1]
+			i++
+		case strings.HasPrefix(flags[i], "--env="):
+			pair = strings.TrimPrefix(flags[i], "--env=")
+		default:
+			out = append(out, flags[i])
+			continue
+		}
+		split := strings.SplitN(pair, "=", 2)
+		if len(split) != 2 || !envVarKeyRegex.MatchString(split[0]) {
+			return nil, nil, errors.New("the --env flag must be of the form --env KEY=value")
+		}
+		if envVars == nil {
+			envVars = make(map[string]string)
+		}
+		envVars[split[0]] = split[1]
+	}
+	return envVars, out, nil
+}
+
+// extractTargetTypeFlags looks for "--target-type type" or
+// "--target-type=type" in flags. It returns the resource types, or nil if none
+// were set, and the remaining flags.
+func (e *EventParser) extractTargetTypeFlags(flags []string) ([]string, []string, error) {
+	var types []string
+	var out []string
+	for i := 0; i < len(flags); i++ {
+		var resourceType string
+		switch {
+		case flags[i] == "--target-type":
+			if i+1 < len(flags) {
+				resourceType = flags[i+1]
+			}
+			i++
+		case strings.HasPrefix(flags[i], "--target-type="):
+			resourceType = strings.TrimPrefix(flags[i], "--target-type=")
+		default:
+			out = append(out, flags[i])
+			continue
+		}
+		if !resourceTypeRegex.MatchString(resourceType) {
+			return nil, nil, errors.New("the --target-type flag must be a resource type, ex. --target-type aws_security_group")
+		}
+		types = append(types, resourceType)
+	}
+	return types, out, nil
+}
+
+// extractTargetFlags looks for "-target=address" or "-target address", with
+// one or two dashes, in flags. It returns the addresses in the order they were
+// set, or nil if none were, and the remaining flags. Since comments aren't run
+// by a shell, quotes around an address are removed rather than being passed
+// to terraform, ex. -target='aws_instance.web[0]'. Like state rm's addresses,
+// they must be resource addresses so they can be quoted for the shell.
+func (e *EventParser) extractTargetFlags(flags []string) ([]string, []string, error) {
+	var targets []string
+	var out []string
+	for i := 0; i < len(flags); i++ {
+		flag := normalizeFlag(flags[i])
+		var address string
+		switch {
+		case flag == "-target":
+			if i+1 < len(flags) {
+				address = flags[i+1]
+			}
+			i++
+		case strings.HasPrefix(flag, "-target="):
+			address = strings.TrimPrefix(flag, "-target=")
+		default:
+			out = append(out, flags[i])
+			continue
+		}
+		address = unquote(address)
+		if address == "" || strings.HasPrefix(address, "-") || !resourceAddressRegex.MatchString(address) {
+			return nil, nil, errors.New("the -target flag must be a resource address, ex. -target=aws_instance.web")
+		}
+		targets = append(targets, address)
+	}
+	return targets, out, nil
+}
+
+// extractVarFileFlags looks for "-var-file=path" or "-var-file path", with
+// one or two dashes, in flags. It returns the paths in the order they were
+// set, or nil if none were, and the remaining flags. Like -target, quotes
+// around a path are removed.
+func (e *EventParser) extractVarFileFlags(flags []string) ([]string, []string, error) {
+	var varFiles []string
+	var out []string
+	for i := 0; i < len(flags); i++ {
+		flag := normalizeFlag(flags[i])
+		var path string
+		switch {
+		case flag == "-var-file":
+			if i+1 < len(flags) {
+				path = flags[i+1]
+			}
+			i++
+		case strings.HasPrefix(flag, "-var-file="):
+			path = strings.TrimPrefix(flag, "-var-file=")
+		default:
+			out = append(out, flags[i])
+			continue
+		}
+		path = unquote(path)
+		if path == "" || strings.HasPrefix(path, "-") {
+			return nil, nil, errors.New("the -var-file flag must be a path, ex. -var-file=env/staging.tfvars")
+		}
+		varFiles = append(varFiles, path)
+	}
+	return varFiles, out, nil
+}
+
+// unquote removes matching single or double quotes around s.
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
 func (e *EventParser) stringInSlice(a string, list []string) bool {
 	for _, b := range list {
 		if b == a {
@@ -1,7 +1,441 @@
 package server
 
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-version"
+	"github.com/hootsuite/atlantis/terraform"
+	"github.com/pkg/errors"
+)
+
 //go:generate pegomock generate --use-experimental-model-gen --package mocks -o mocks/mock_executor.go Executor
 
 type Executor interface {
 	Execute(ctx *CommandContext)
 }
+
+// terraformErrResult returns the result for a project where running terraform
+// failed with err. If terraform isn't installed we return a failure explaining
+// that rather than the raw error.
+func terraformErrResult(err error) ProjectResult {
+	switch err.(type) {
+	case terraform.NotInstalledError, terraform.NoMatchingVersionError, terraform.TimeoutError:
+		return ProjectResult{Failure: err.Error()}
+	}
+	return ProjectResult{Error: err}
+}
+
+// hookEnvVars are the environment variables set on a project's pre_plan and
+// post_plan commands so they know what they're running for.
+func hookEnvVars(ctx *CommandContext) []string {
+	return []string{
+		fmt.Sprintf("ATLANTIS_REPO=%s", ctx.BaseRepo.FullName),
+		fmt.Sprintf("ATLANTIS_PULL_NUM=%d", ctx.Pull.Num),
+		fmt.Sprintf("ATLANTIS_PULL_AUTHOR=%s", ctx.Pull.Author),
+		fmt.Sprintf("ATLANTIS_HEAD_BRANCH=%s", ctx.Pull.Branch),
+		fmt.Sprintf("ATLANTIS_HEAD_COMMIT=%s", ctx.Pull.HeadCommit),
+		fmt.Sprintf("ATLANTIS_BASE_BRANCH=%s", ctx.Pull.BaseBranch),
+		fmt.Sprintf("ATLANTIS_USER=%s", ctx.User.Username),
+	}
+}
+
+// timeoutFailure is the failure for a command that was stopped because it
+// timed out. output is what terraform printed before it was stopped, ex. the
+// resources an apply had already changed.
+func timeoutFailure(err terraform.TimeoutError, output string) string {
+	if strings.TrimSpace(output) == "" {
+		return err.Error()
+	}
+	return fmt.Sprintf("%s:\n```\n%s\n```", err.Error(), strings.TrimSpace(output))
+}
+
+// projectTerraformVersion returns the version of terraform to run the project
+// in absolutePath with. That's the terraform_version in its config or, if
+// that's auto, the newest version that satisfies its required_version.
+// Otherwise it's the terraform in our $PATH.
+func projectTerraformVersion(ctx *CommandContext, tf *terraform.Client, absolutePath string, config ProjectConfig) (*version.Version, error) {
+	if config.TerraformVersion != nil {
+		return config.TerraformVersion, nil
+	}
+	if !config.DetectTerraformVersion {
+		return tf.Version(), nil
+	}
+	constraints, err := terraform.RequiredVersion(absolutePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "detecting terraform version")
+	}
+	if constraints == nil {
+		ctx.Log.Info("terraform_version is %s but required_version isn't set so using the default version", AutoTerraformVersion)
+		return tf.Version(), nil
+	}
+	v, err := tf.ResolveVersion(ctx.Log, constraints)
+	if err != nil {
+		return nil, err
+	}
+	ctx.Log.Info("using terraform %s to satisfy required_version %q", v, constraints)
+	return v, nil
+}
+
+// exitCode returns the exit code of the terraform command that returned err
+// or nil if terraform didn't run.
+func exitCode(err error) *int {
+	code := terraform.ExitCode(err)
+	if code < 0 {
+		return nil
+	}
+	return &code
+}
+
+// planFileName is the name of the file plan saves the plan for env to in
+// each project, and that apply applies.
+func planFileName(env string) string {
+	return env + ".tfplan"
+}
+
+// planFile returns where the plan for env of the project at projectPath is
+// saved in cloneDir.
+func planFile(cloneDir string, projectPath string, env string) string {
+	return filepath.Join(cloneDir, projectPath, planFileName(env))
+}
+
+// providersFile returns where plan saves the versions of the providers
+// terraform init installed next to planFile. apply's init finds them already
+// installed so it reads them from here to record what it applied with.
+func providersFile(planFile string) string {
+	return planFile + ".providers.json"
+}
+
+// saveProviders saves providers next to planFile. Nothing is saved if init
+// didn't install any, so the ones saved by an earlier plan are kept.
+func saveProviders(planFile string, providers map[string]string) error {
+	if len(providers) == 0 {
+		return nil
+	}
+	serialized, err := json.Marshal(providers)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(providersFile(planFile), serialized, 0644)
+}
+
+// loadProviders returns the providers saved next to planFile, or nil if none
+// were.
+func loadProviders(planFile string) (map[string]string, error) {
+	serialized, err := ioutil.ReadFile(providersFile(planFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var providers map[string]string
+	if err := json.Unmarshal(serialized, &providers); err != nil {
+		return nil, errors.Wrapf(err, "parsing %s", providersFile(planFile))
+	}
+	return providers, nil
+}
+
+// cloneFailure returns the failure message for err, returned by
+// Workspace.Clone, if it's something the user can act on rather than an
+// unexpected error. Otherwise it returns "".
+func cloneFailure(err error) string {
+	if conflictErr, ok := err.(*MergeConflictError); ok {
+		return conflictErr.Error()
+	}
+	if err == ErrMissingCloneURL {
+		return "Unable to determine the repository clone URL. The source branch may have been deleted."
+	}
+	return ""
+}
+
+// lockRun takes the lock for env of ctx's pull request so no other command
+// runs in it at the same time. If the lock
+// is held and queueTimeout is set, it waits up to queueTimeout for it and
+// comments that command is queued, and how long it waited is recorded in
+// commandMetrics. It returns the failure to respond with if the lock couldn't
+// be taken, or "" and the func to release it if it was.
+func lockRun(ctx *CommandContext, locker *ConcurrentRunLocker, comments *ResultComments, commandMetrics *CommandMetrics, command CommandName, env string, queueTimeout time.Duration) (unlock func(), failure string) {
+	start := time.Now()
+	unlock, acquired, cancelled := locker.Lock(ctx.BaseRepo.FullName, env, ctx.Pull.Num, queueTimeout, func() {
+		ctx.Log.Info("queued %s for environment %q behind another command for up to %s", command, env, queueTimeout)
+		comments.Queued(ctx, command, env, queueTimeout)
+	})
+	if acquired && queueTimeout > 0 {
+		commandMetrics.RecordLockWait(ctx, command, env, time.Since(start))
+	}
+	if cancelled {
+		return nil, "The pull request was closed while this command was queued so it didn't run."
+	}
+	if !acquired {
+		return nil, fmt.Sprintf("The %s environment is currently locked by another command that is running for this pull request. Wait until command is complete and try again.", env)
+	}
+	return unlock, ""
+}
+
+// parallelism returns the -parallelism to run plan or apply with in a project
+// with config. It's set in the comment or otherwise the config. If neither set
+// it, it's 0 and terraform's default is used.
+func parallelism(ctx *CommandContext, config ProjectConfig) int {
+	if ctx.Command.Parallelism > 0 {
+		return ctx.Command.Parallelism
+	}
+	return config.Parallelism
+}
+
+// lockTimeout returns the -lock-timeout to run terraform with. A -lock-timeout
+// in the comment takes precedence over the project's config, which takes
+// precedence over the server's default. It's empty to use terraform's default.
+func lockTimeout(ctx *CommandContext, config ProjectConfig, serverDefault string) string {
+	if ctx.Command.LockTimeout != "" {
+		return ctx.Command.LockTimeout
+	}
+	if config.LockTimeout != "" {
+		return config.LockTimeout
+	}
+	return serverDefault
+}
+
+// lockTimeoutArgs returns the arguments to run terraform with timeout as its
+// -lock-timeout.
+func lockTimeoutArgs(timeout string) []string {
+	if timeout == "" {
+		return nil
+	}
+	return []string{"-lock-timeout=" + timeout}
+}
+
+// validateLockTimeout returns an error if timeout isn't a duration terraform
+// accepts for -lock-timeout, ex. 5m or 30s.
+func validateLockTimeout(timeout string) error {
+	d, err := time.ParseDuration(timeout)
+	if err != nil {
+		return err
+	}
+	if d < 0 {
+		return errors.New("must not be negative")
+	}
+	return nil
+}
+
+// parallelismArgs returns the arguments to run terraform with n parallelism.
+func parallelismArgs(n int) []string {
+	if n == 0 {
+		return nil
+	}
+	return []string{fmt.Sprintf("-parallelism=%d", n)}
+}
+
+// localStateWarning returns a warning if the project at absolutePath keeps its
+// state locally, since the state is lost when the workspace is deleted, unless
+// its config allows that. Otherwise it returns "".
+func localStateWarning(ctx *CommandContext, absolutePath string, config ProjectConfig) string {
+	if config.AllowLocalState {
+		return ""
+	}
+	backend, err := terraform.DeclaredBackend(absolutePath)
+	if err != nil {
+		ctx.Log.Warn("could not determine if backend is declared so not checking for local state: %s", err)
+		return ""
+	}
+	if backend != nil && backend.Type != "local" {
+		return ""
+	}
+	ctx.Log.Warn("project at %q uses local state", absolutePath)
+	return fmt.Sprintf("This project has no remote backend so its state is stored locally and will be lost when the pull request is closed. Configure a backend or, if that's intended, set allow_local_state: true in %s.", ProjectConfigFile)
+}
+
+// providerUpgradeWarnings returns a warning for each of providers whose major
+// version is different to the one lastApplied ran with, since major versions
+// can have breaking changes, unless config allows provider upgrades.
+func providerUpgradeWarnings(config ProjectConfig, providers map[string]string, lastApplied *AppliedResult) []string {
+	if config.AllowProviderUpgrades || lastApplied == nil {
+		return nil
+	}
+	var names []string
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var warnings []string
+	for _, name := range names {
+		previous, ok := lastApplied.Providers[name]
+		if !ok {
+			continue
+		}
+		previousVersion, err := version.NewVersion(previous)
+		if err != nil {
+			continue
+		}
+		currentVersion, err := version.NewVersion(providers[name])
+		if err != nil {
+			continue
+		}
+		if previousVersion.Segments()[0] != currentVersion.Segments()[0] {
+			warnings = append(warnings, fmt.Sprintf("Provider `%s` changed from %s to %s since the last apply in #%d. Major versions can have breaking changes so review the upgrade before applying or constrain the provider's version.", name, previous, providers[name], lastApplied.Pull))
+		}
+	}
+	return warnings
+}
+
+// initArgs returns the extra arguments to use for terraform init in the
+// project at absolutePath. If the project fully declares its backend then any
+// -backend-config arguments are dropped, unless the project is configured to
+// inject them, so init doesn't fail because the backend configuration changed.
+func initArgs(ctx *CommandContext, absolutePath string, config ProjectConfig) []string {
+	args := config.GetExtraArguments("init")
+	if config.InjectBackendConfig {
+		return args
+	}
+	backend, err := terraform.DeclaredBackend(absolutePath)
+	if err != nil {
+		ctx.Log.Warn("could not determine if backend is declared so keeping -backend-config arguments: %s", err)
+		return args
+	}
+	if backend == nil || !backend.FullyDeclared {
+		return args
+	}
+
+	var filtered []string
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-backend-config" {
+			// skip its value too
+			i++
+			continue
+		}
+		if strings.HasPrefix(args[i], "-backend-config=") {
+			continue
+		}
+		filtered = append(filtered, args[i])
+	}
+	if len(filtered) != len(args) {
+		ctx.Log.Info("project fully declares its %q backend so not using -backend-config arguments", backend.Type)
+	}
+	return filtered
+}
+
+// commentEnvVars returns the environment variables set in the comment with
+// --env, in the form "KEY=value", to run terraform with in a project that has
+// config. If any of them aren't allowed by config, it instead returns a
+// failure explaining which. Only the keys are logged since the values could be secret.
+func commentEnvVars(ctx *CommandContext, config ProjectConfig) ([]string, string) {
+	if len(ctx.Command.EnvVars) == 0 {
+		return nil, ""
+	}
+	if disallowed := config.DisallowedEnvVars(ctx.Command.EnvVars); len(disallowed) > 0 {
+		allowed := "No environment variables are allowed."
+		if len(config.AllowedEnvVars) > 0 {
+			allowed = fmt.Sprintf("Allowed: `%s`.", strings.Join(config.AllowedEnvVars, "`, `"))
+		}
+		return nil, fmt.Sprintf("The environment variable(s) `%s` can't be set with --env for this project. %s Add them to allowed_env_vars in %s to allow them.",
+			strings.Join(disallowed, "`, `"), allowed, ProjectConfigFile)
+	}
+
+	var keys []string
+	for k := range ctx.Command.EnvVars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var envVars []string
+	for _, k := range keys {
+		envVars = append(envVars, fmt.Sprintf("%s=%s", k, ctx.Command.EnvVars[k]))
+	}
+	ctx.Log.Info("setting environment variable(s) %s from comment", strings.Join(keys, ", "))
+	return envVars, ""
+}
+
+// targetArgs returns the arguments to run terraform with to only operate on
+// targets. Like state rm's addresses, they're quoted since terraform runs
+// through a shell, to keep the brackets and quotes of indexed resources. The
+// parser only allows addresses without single quotes.
+func targetArgs(targets []string) []string {
+	var args []string
+	for _, target := range targets {
+		args = append(args, "-target='"+target+"'")
+	}
+	return args
+}
+
+// varFileArgs returns the arguments to run terraform with varFiles as its
+// -var-files, in order.
+func varFileArgs(varFiles []string) []string {
+	var args []string
+	for _, varFile := range varFiles {
+		args = append(args, "-var-file="+varFile)
+	}
+	return args
+}
+
+// varFilesFailure returns a failure message if any of varFiles, which are
+// relative to the project at projectPath in cloneDir, is absolute, isn't in
+// the clone, including by following a symlink, or doesn't exist. Otherwise
+// it returns "".
+func varFilesFailure(cloneDir string, projectPath string, varFiles []string) string {
+	realCloneDir, err := filepath.EvalSymlinks(cloneDir)
+	if err != nil {
+		realCloneDir = cloneDir
+	}
+	for _, varFile := range varFiles {
+		if filepath.IsAbs(varFile) {
+			return fmt.Sprintf("The var file `%s` must be a path relative to the project.", varFile)
+		}
+		path := filepath.Join(cloneDir, projectPath, varFile)
+		if !inDir(cloneDir, path) {
+			return fmt.Sprintf("The var file `%s` must be in the repo.", varFile)
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Sprintf("The var file `%s` doesn't exist in the project.", varFile)
+		}
+		if realPath, err := filepath.EvalSymlinks(path); err != nil || !inDir(realCloneDir, realPath) {
+			return fmt.Sprintf("The var file `%s` must be in the repo.", varFile)
+		}
+	}
+	return ""
+}
+
+// inDir returns true if path is dir or is under it.
+func inDir(dir string, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// runProjects runs command for the projects at paths with run, which is
+// passed the index of the project to run, running up to limit projects at the
+// same time. The results are returned in the same order as paths. A panic
+// running a project becomes that project's error rather than stopping the
+// other projects.
+func runProjects(ctx *CommandContext, command CommandName, limit int, paths []string, run func(i int) ProjectResult) []ProjectResult {
+	if limit < 1 {
+		limit = 1
+	}
+	results := make([]ProjectResult, len(paths))
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, path string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			defer func() {
+				// a panic here would otherwise crash Atlantis since it's
+				// not in the goroutine that handles panics for the command
+				if err := recover(); err != nil {
+					ctx.Log.Err("PANIC running %s for %q: %s", command, path, err)
+					results[i] = ProjectResult{Path: path, Error: fmt.Errorf("panic while running %s: %s. This is a bug", command, err)}
+				}
+			}()
+			results[i] = run(i)
+		}(i, path)
+	}
+	wg.Wait()
+	return results
+}
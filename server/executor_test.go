@@ -0,0 +1,341 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hootsuite/atlantis/github/mocks"
+	"github.com/hootsuite/atlantis/logging"
+	"github.com/hootsuite/atlantis/metrics"
+	"github.com/hootsuite/atlantis/models/fixtures"
+	"github.com/hootsuite/atlantis/terraform"
+	. "github.com/hootsuite/atlantis/testing_util"
+	. "github.com/petergtz/pegomock"
+)
+
+func TestInitArgs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(dir)
+	ctx := &CommandContext{Log: logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug)}
+	config := ProjectConfig{ExtraArguments: []CommandExtraArguments{
+		{Name: "init", Arguments: []string{"-backend-config=bucket=b", "-upgrade", "-backend-config", "key=k"}},
+	}}
+
+	t.Log("with no backend declared the arguments should be kept")
+	Equals(t, []string{"-backend-config=bucket=b", "-upgrade", "-backend-config", "key=k"}, initArgs(ctx, dir, config))
+
+	t.Log("with a partial backend the arguments should be kept")
+	Ok(t, ioutil.WriteFile(filepath.Join(dir, "main.tf"), []byte("terraform {\n  backend \"s3\" {}\n}\n"), 0644))
+	Equals(t, []string{"-backend-config=bucket=b", "-upgrade", "-backend-config", "key=k"}, initArgs(ctx, dir, config))
+
+	t.Log("with a fully declared backend the -backend-config arguments should be dropped")
+	Ok(t, ioutil.WriteFile(filepath.Join(dir, "main.tf"), []byte("terraform {\n  backend \"s3\" {\n    bucket = \"b\"\n  }\n}\n"), 0644))
+	Equals(t, []string{"-upgrade"}, initArgs(ctx, dir, config))
+
+	t.Log("unless we're configured to inject them")
+	config.InjectBackendConfig = true
+	Equals(t, []string{"-backend-config=bucket=b", "-upgrade", "-backend-config", "key=k"}, initArgs(ctx, dir, config))
+}
+
+func TestCommentEnvVars(t *testing.T) {
+	ctx := &CommandContext{
+		Command: &Command{EnvVars: map[string]string{"TF_LOG": "debug", "AWS_REGION": "us-west-2"}},
+		Log:     logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+
+	t.Log("allowed environment variables should be returned sorted by key")
+	envVars, failure := commentEnvVars(ctx, ProjectConfig{AllowedEnvVars: []string{"AWS_REGION", "TF_LOG"}})
+	Equals(t, "", failure)
+	Equals(t, []string{"AWS_REGION=us-west-2", "TF_LOG=debug"}, envVars)
+
+	t.Log("disallowed environment variables should cause a failure")
+	envVars, failure = commentEnvVars(ctx, ProjectConfig{AllowedEnvVars: []string{"AWS_REGION"}})
+	Equals(t, "The environment variable(s) `TF_LOG` can't be set with --env for this project. Allowed: `AWS_REGION`. Add them to allowed_env_vars in atlantis.yaml to allow them.", failure)
+	Equals(t, []string(nil), envVars)
+
+	t.Log("without an allowlist no environment variables are allowed")
+	_, failure = commentEnvVars(ctx, ProjectConfig{})
+	Equals(t, "The environment variable(s) `AWS_REGION`, `TF_LOG` can't be set with --env for this project. No environment variables are allowed. Add them to allowed_env_vars in atlantis.yaml to allow them.", failure)
+
+	t.Log("with no --env flags nothing should be set")
+	ctx.Command = &Command{}
+	envVars, failure = commentEnvVars(ctx, ProjectConfig{})
+	Equals(t, "", failure)
+	Equals(t, []string(nil), envVars)
+}
+
+func TestVarFileEnvironments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	t.Log("without env var files only the default environment is configured")
+	envs, err := varFileEnvironments(dir)
+	Ok(t, err)
+	Equals(t, []string{"default"}, envs)
+
+	Ok(t, os.MkdirAll(filepath.Join(dir, "env"), 0755))
+	for _, f := range []string{"staging.tfvars", "production.tfvars", "default.tfvars", "notes.txt"} {
+		Ok(t, ioutil.WriteFile(filepath.Join(dir, "env", f), nil, 0644))
+	}
+	envs, err = varFileEnvironments(dir)
+	Ok(t, err)
+	Equals(t, []string{"default", "production", "staging"}, envs)
+}
+
+func TestVarFilesFailure(t *testing.T) {
+	cloneDir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(cloneDir)
+	outside, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(outside)
+	Ok(t, os.MkdirAll(filepath.Join(cloneDir, "project", "env"), 0700))
+	Ok(t, ioutil.WriteFile(filepath.Join(cloneDir, "project", "env", "staging.tfvars"), nil, 0600))
+	Ok(t, ioutil.WriteFile(filepath.Join(cloneDir, "shared.tfvars"), nil, 0600))
+	Ok(t, ioutil.WriteFile(filepath.Join(outside, "secrets.tfvars"), nil, 0600))
+	Ok(t, os.Symlink(filepath.Join(outside, "secrets.tfvars"), filepath.Join(cloneDir, "project", "link.tfvars")))
+
+	cases := []struct {
+		VarFiles []string
+		Expected string
+	}{
+		{nil, ""},
+		{[]string{"env/staging.tfvars", "../shared.tfvars"}, ""},
+		{[]string{"env/prod.tfvars"}, "The var file `env/prod.tfvars` doesn't exist in the project."},
+		{[]string{filepath.Join(cloneDir, "shared.tfvars")}, fmt.Sprintf("The var file `%s` must be a path relative to the project.", filepath.Join(cloneDir, "shared.tfvars"))},
+		{[]string{"env/staging.tfvars", "../../secrets.tfvars"}, "The var file `../../secrets.tfvars` must be in the repo."},
+		{[]string{"link.tfvars"}, "The var file `link.tfvars` must be in the repo."},
+	}
+	for _, c := range cases {
+		t.Logf("testing %v", c.VarFiles)
+		Equals(t, c.Expected, varFilesFailure(cloneDir, "project", c.VarFiles))
+	}
+}
+
+func TestParallelism(t *testing.T) {
+	ctx := &CommandContext{Command: &Command{}}
+	t.Log("without parallelism set terraform's default should be used")
+	Equals(t, 0, parallelism(ctx, ProjectConfig{}))
+	Equals(t, []string(nil), parallelismArgs(0))
+
+	t.Log("the project's config should be used if the comment doesn't set it")
+	Equals(t, 10, parallelism(ctx, ProjectConfig{Parallelism: 10}))
+
+	t.Log("the comment should take precedence over the project's config")
+	ctx.Command.Parallelism = 2
+	Equals(t, 2, parallelism(ctx, ProjectConfig{Parallelism: 10}))
+	Equals(t, []string{"-parallelism=2"}, parallelismArgs(2))
+}
+
+// argsTerraform prints each of the arguments it was run with on its own line.
+var argsTerraform = `#!/bin/sh
+if [ "$1" = "version" ]; then
+  echo "Terraform v0.10.0"
+  exit 0
+fi
+printf '%s\n' "$@"
+`
+
+func TestTargetArgs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(dir)
+	Ok(t, ioutil.WriteFile(filepath.Join(dir, "terraform"), []byte(argsTerraform), 0755))
+	oldPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", oldPath)
+	os.Setenv("PATH", dir+":"+oldPath)
+	tf, err := terraform.NewClient("", "")
+	Ok(t, err)
+	// without quoting the shell would expand -target=module.x.aws_instance.y[0]
+	// to this file
+	Ok(t, ioutil.WriteFile(filepath.Join(dir, "-target=module.x.aws_instance.y0"), nil, 0644))
+	logger := logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug)
+
+	t.Log("the targets should reach terraform as they were written")
+	out, err := tf.RunCommandWithVersion(logger, dir, append([]string{"plan"}, targetArgs([]string{`aws_instance.web["blue"]`, "module.x.aws_instance.y[0]"})...), tf.Version(), "staging")
+	Ok(t, err)
+	Equals(t, "plan\n-target=aws_instance.web[\"blue\"]\n-target=module.x.aws_instance.y[0]\n", out)
+}
+
+func TestLocalStateWarning(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(dir)
+	ctx := &CommandContext{Log: logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug)}
+	expected := "This project has no remote backend so its state is stored locally and will be lost when the pull request is closed. Configure a backend or, if that's intended, set allow_local_state: true in atlantis.yaml."
+
+	t.Log("without a backend we should warn")
+	Ok(t, ioutil.WriteFile(filepath.Join(dir, "main.tf"), []byte("resource \"null_resource\" \"a\" {}\n"), 0644))
+	Equals(t, expected, localStateWarning(ctx, dir, ProjectConfig{}))
+
+	t.Log("unless local state is allowed")
+	Equals(t, "", localStateWarning(ctx, dir, ProjectConfig{AllowLocalState: true}))
+
+	t.Log("the local backend should also warn")
+	Ok(t, ioutil.WriteFile(filepath.Join(dir, "main.tf"), []byte("terraform {\n  backend \"local\" {\n    path = \"state\"\n  }\n}\n"), 0644))
+	Equals(t, expected, localStateWarning(ctx, dir, ProjectConfig{}))
+
+	t.Log("remote backends, even if partially declared, shouldn't warn")
+	Ok(t, ioutil.WriteFile(filepath.Join(dir, "main.tf"), []byte("terraform {\n  backend \"s3\" {}\n}\n"), 0644))
+	Equals(t, "", localStateWarning(ctx, dir, ProjectConfig{}))
+}
+
+func TestProviderUpgradeWarnings(t *testing.T) {
+	lastApplied := &AppliedResult{Pull: 2, Providers: map[string]string{"aws": "0.1.4", "null": "1.0.0", "template": "1.0.0"}}
+	providers := map[string]string{"aws": "1.2.0", "null": "1.1.0", "template": "2.0.0", "random": "2.0.0"}
+
+	Equals(t, []string{
+		"Provider `aws` changed from 0.1.4 to 1.2.0 since the last apply in #2. Major versions can have breaking changes so review the upgrade before applying or constrain the provider's version.",
+		"Provider `template` changed from 1.0.0 to 2.0.0 since the last apply in #2. Major versions can have breaking changes so review the upgrade before applying or constrain the provider's version.",
+	}, providerUpgradeWarnings(ProjectConfig{}, providers, lastApplied))
+
+	t.Log("upgrades can be allowed")
+	Equals(t, []string(nil), providerUpgradeWarnings(ProjectConfig{AllowProviderUpgrades: true}, providers, lastApplied))
+
+	t.Log("there's nothing to compare with if the project hasn't been applied")
+	Equals(t, []string(nil), providerUpgradeWarnings(ProjectConfig{}, providers, nil))
+}
+
+func TestRunProjects(t *testing.T) {
+	t.Log("projects should run up to the limit at a time and a panic should only fail its own project")
+	ctx := &CommandContext{Log: logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug)}
+	paths := []string{"a", "b", "c", "d", "e"}
+	var mutex sync.Mutex
+	running, maxRunning := 0, 0
+	results := runProjects(ctx, Plan, 2, paths, func(i int) ProjectResult {
+		mutex.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mutex.Unlock()
+		defer func() {
+			mutex.Lock()
+			running--
+			mutex.Unlock()
+		}()
+		time.Sleep(10 * time.Millisecond)
+		if paths[i] == "c" {
+			panic("oops")
+		}
+		return ProjectResult{Path: paths[i], PlanSuccess: &PlanSuccess{TerraformOutput: paths[i]}}
+	})
+
+	Equals(t, 2, maxRunning)
+	Equals(t, len(paths), len(results))
+	for i, result := range results {
+		Equals(t, paths[i], result.Path)
+		if result.Path == "c" {
+			Equals(t, "panic while running plan: oops. This is a bug", result.Error.Error())
+		} else {
+			Equals(t, Success, result.Status())
+		}
+	}
+}
+
+func TestLockRun(t *testing.T) {
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	comments := &ResultComments{Github: client}
+	locker := NewConcurrentRunLocker()
+	registry := metrics.NewRegistry()
+	commandMetrics := NewCommandMetrics(registry)
+	ctx := &CommandContext{
+		BaseRepo: fixtures.Repo,
+		Pull:     fixtures.Pull,
+		Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+
+	t.Log("a free environment should be locked and how long it waited recorded")
+	unlock, failure := lockRun(ctx, locker, comments, commandMetrics, Plan, "staging", time.Minute)
+	Equals(t, "", failure)
+	Assert(t, unlock != nil, "expected an unlock func")
+	var buf bytes.Buffer
+	Ok(t, registry.Write(&buf))
+	Assert(t, strings.Contains(buf.String(), `atlantis_lock_wait_seconds_count{repo="hootsuite/atlantis",environment="staging",command="plan"} 1`), "expected the lock wait in %q", buf.String())
+
+	t.Log("without a queue timeout a locked environment should fail right away")
+	_, failure = lockRun(ctx, locker, comments, commandMetrics, Apply, "staging", 0)
+	Equals(t, "The staging environment is currently locked by another command that is running for this pull request. Wait until command is complete and try again.", failure)
+
+	t.Log("with a queue timeout it should comment that it's queued and fail if it times out")
+	_, failure = lockRun(ctx, locker, comments, commandMetrics, Apply, "staging", time.Millisecond)
+	Equals(t, "The staging environment is currently locked by another command that is running for this pull request. Wait until command is complete and try again.", failure)
+	client.VerifyWasCalledOnce().CreateComment(fixtures.Repo, fixtures.Pull, "Queued apply for environment `staging` behind another command that is running for this pull request. It will run once that command completes, or give up after 1ms.")
+}
+
+func TestLockRun_QueuedEnvironments(t *testing.T) {
+	RegisterMockTestingT(t)
+	comments := &ResultComments{Github: mocks.NewMockClient()}
+	locker := NewConcurrentRunLocker()
+	type lockResult struct {
+		command string
+		failure string
+	}
+	locked := make(chan lockResult)
+	release := make(chan bool)
+	q := NewCommandQueue(3, 10, nil, func(ctx *CommandContext) {
+		unlock, failure := lockRun(ctx, locker, comments, nil, ctx.Command.Name, ctx.Command.Environment, 0)
+		locked <- lockResult{fmt.Sprintf("%s %s", ctx.Command.Name, ctx.Command.Environment), failure}
+		if failure != "" {
+			return
+		}
+		defer unlock()
+		<-release
+	})
+	newCtx := func(name CommandName, env string) *CommandContext {
+		return &CommandContext{
+			BaseRepo: fixtures.Repo,
+			Pull:     fixtures.Pull,
+			Command:  &Command{Name: name, Environment: env},
+			Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+		}
+	}
+
+	t.Log("a plan in staging should run while production is being applied in the same pull request")
+	Assert(t, q.Enqueue(newCtx(Apply, "production")), "expected the apply to be queued")
+	Equals(t, lockResult{"apply production", ""}, <-locked)
+	Assert(t, q.Enqueue(newCtx(Plan, "staging")), "expected the plan to be queued")
+	Equals(t, lockResult{"plan staging", ""}, <-locked)
+
+	t.Log("but not a plan in production, which is still being applied")
+	Assert(t, q.Enqueue(newCtx(Plan, "production")), "expected the plan to be queued")
+	Equals(t, lockResult{"plan production", "The production environment is currently locked by another command that is running for this pull request. Wait until command is complete and try again."}, <-locked)
+	release <- true
+	release <- true
+}
+
+func TestSaveProviders(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(dir)
+	plan := planFile(dir, "staging", "default")
+	Ok(t, os.Mkdir(filepath.Join(dir, "staging"), 0755))
+
+	t.Log("without a saved file there are no providers")
+	providers, err := loadProviders(plan)
+	Ok(t, err)
+	Assert(t, providers == nil, "expected no providers but got %v", providers)
+
+	t.Log("the providers the plan installed should be loaded by apply")
+	Ok(t, saveProviders(plan, map[string]string{"aws": "1.2.0"}))
+	providers, err = loadProviders(plan)
+	Ok(t, err)
+	Equals(t, map[string]string{"aws": "1.2.0"}, providers)
+
+	t.Log("a plan whose init installed nothing shouldn't replace them")
+	Ok(t, saveProviders(plan, nil))
+	providers, err = loadProviders(plan)
+	Ok(t, err)
+	Equals(t, map[string]string{"aws": "1.2.0"}, providers)
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/hootsuite/atlantis/github"
+	"github.com/pkg/errors"
+)
+
+const (
+	// AllowUntrustedForks runs commands on pull requests from forks the same
+	// as any other pull request.
+	AllowUntrustedForks = "allow"
+	// RequireTrustForUntrustedForks only runs commands on pull requests from
+	// forks by non-collaborators if a collaborator comments with --trust.
+	RequireTrustForUntrustedForks = "require-trust"
+	// DenyUntrustedForks never runs commands on pull requests from forks by
+	// non-collaborators.
+	DenyUntrustedForks = "deny"
+)
+
+// ForkTrust decides whether terraform can be run against the code of a pull
+// request from a fork. Anyone can open a pull request from a fork on a public
+// repo, so running terraform on its code, which can run arbitrary commands
+// through providers and external data sources, is a security risk unless the
+// author is a collaborator or a collaborator has reviewed the code.
+// A nil ForkTrust trusts every pull request.
+type ForkTrust struct {
+	Github github.Client
+	// Mode is one of AllowUntrustedForks, RequireTrustForUntrustedForks or DenyUntrustedForks.
+	Mode string
+}
+
+// Check returns a failure message explaining why the command in ctx can't be
+// run if the pull request is from a fork by a non-collaborator and it isn't
+// trusted by the commenter.
+func (f *ForkTrust) Check(ctx *CommandContext) (string, error) {
+	if f == nil || f.Mode == AllowUntrustedForks || ctx.HeadRepo.FullName == ctx.BaseRepo.FullName {
+		return "", nil
+	}
+	authorIsCollaborator, err := f.Github.IsCollaborator(ctx.BaseRepo, ctx.Pull.Author)
+	if err != nil {
+		return "", errors.Wrapf(err, "checking if %s is a collaborator", ctx.Pull.Author)
+	}
+	if authorIsCollaborator {
+		return "", nil
+	}
+
+	why := fmt.Sprintf("This pull request is from the fork %s by @%s, who isn't a collaborator on this repo. Running terraform can execute arbitrary code from the pull request so Atlantis doesn't run it on untrusted forks.",
+		ctx.HeadRepo.FullName, ctx.Pull.Author)
+	if f.Mode == DenyUntrustedForks {
+		return why, nil
+	}
+	// the author isn't a collaborator so can't trust their own code
+	commenterIsCollaborator := false
+	if ctx.User.Username != ctx.Pull.Author {
+		commenterIsCollaborator, err = f.Github.IsCollaborator(ctx.BaseRepo, ctx.User.Username)
+		if err != nil {
+			return "", errors.Wrapf(err, "checking if %s is a collaborator", ctx.User.Username)
+		}
+	}
+	if !commenterIsCollaborator {
+		return fmt.Sprintf("%s A collaborator must review the code and then comment `atlantis %s --trust` to run it.", why, ctx.Command.Name), nil
+	}
+	if !ctx.Command.Trust {
+		return fmt.Sprintf("%s If you've reviewed the code and trust it, comment `atlantis %s --trust` to run it.", why, ctx.Command.Name), nil
+	}
+	ctx.Log.Warn("%s trusted untrusted fork %s", ctx.User.Username, ctx.HeadRepo.FullName)
+	return "", nil
+}
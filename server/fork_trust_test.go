@@ -0,0 +1,105 @@
+package server_test
+
+import (
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hootsuite/atlantis/github/mocks"
+	"github.com/hootsuite/atlantis/logging"
+	"github.com/hootsuite/atlantis/models"
+	"github.com/hootsuite/atlantis/models/fixtures"
+	"github.com/hootsuite/atlantis/server"
+	. "github.com/hootsuite/atlantis/testing_util"
+	. "github.com/petergtz/pegomock"
+)
+
+var forkRepo = models.Repo{FullName: "attacker/atlantis", Owner: "attacker", Name: "atlantis"}
+
+func forkCtx(commenter string, trust bool) *server.CommandContext {
+	pull := fixtures.Pull
+	pull.Author = "attacker"
+	return &server.CommandContext{
+		BaseRepo: fixtures.Repo,
+		HeadRepo: forkRepo,
+		Pull:     pull,
+		User:     models.User{Username: commenter},
+		Command:  &server.Command{Name: server.Plan, Trust: trust},
+		Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+}
+
+func TestForkTrust_NotFork(t *testing.T) {
+	t.Log("pull requests that aren't from forks should always be trusted")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	f := server.ForkTrust{Github: client, Mode: server.DenyUntrustedForks}
+	ctx := forkCtx("attacker", false)
+	ctx.HeadRepo = fixtures.Repo
+
+	failure, err := f.Check(ctx)
+	Ok(t, err)
+	Equals(t, "", failure)
+	client.VerifyWasCalled(Never()).IsCollaborator(AnyRepo(), AnyString())
+}
+
+func TestForkTrust_Allow(t *testing.T) {
+	t.Log("when untrusted forks are allowed nothing should be checked")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	f := server.ForkTrust{Github: client, Mode: server.AllowUntrustedForks}
+
+	failure, err := f.Check(forkCtx("attacker", false))
+	Ok(t, err)
+	Equals(t, "", failure)
+	client.VerifyWasCalled(Never()).IsCollaborator(AnyRepo(), AnyString())
+}
+
+func TestForkTrust_AuthorIsCollaborator(t *testing.T) {
+	t.Log("forks by collaborators should be trusted")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	When(client.IsCollaborator(fixtures.Repo, "attacker")).ThenReturn(true, nil)
+	f := server.ForkTrust{Github: client, Mode: server.DenyUntrustedForks}
+
+	failure, err := f.Check(forkCtx("attacker", false))
+	Ok(t, err)
+	Equals(t, "", failure)
+}
+
+func TestForkTrust_RequireTrust(t *testing.T) {
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	When(client.IsCollaborator(fixtures.Repo, "attacker")).ThenReturn(false, nil)
+	When(client.IsCollaborator(fixtures.Repo, "reviewer")).ThenReturn(true, nil)
+	f := server.ForkTrust{Github: client, Mode: server.RequireTrustForUntrustedForks}
+
+	t.Log("the author can't trust their own fork")
+	failure, err := f.Check(forkCtx("attacker", true))
+	Ok(t, err)
+	Assert(t, strings.Contains(failure, "A collaborator must review the code and then comment `atlantis plan --trust`"), "got %q", failure)
+
+	t.Log("a collaborator must use --trust")
+	failure, err = f.Check(forkCtx("reviewer", false))
+	Ok(t, err)
+	Assert(t, strings.Contains(failure, "comment `atlantis plan --trust` to run it"), "got %q", failure)
+
+	t.Log("a collaborator using --trust should be allowed")
+	failure, err = f.Check(forkCtx("reviewer", true))
+	Ok(t, err)
+	Equals(t, "", failure)
+}
+
+func TestForkTrust_Deny(t *testing.T) {
+	t.Log("when untrusted forks are denied even collaborators can't trust them")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	When(client.IsCollaborator(fixtures.Repo, "attacker")).ThenReturn(false, nil)
+	When(client.IsCollaborator(fixtures.Repo, "reviewer")).ThenReturn(true, nil)
+	f := server.ForkTrust{Github: client, Mode: server.DenyUntrustedForks}
+
+	failure, err := f.Check(forkCtx("reviewer", true))
+	Ok(t, err)
+	Equals(t, "This pull request is from the fork attacker/atlantis by @attacker, who isn't a collaborator on this repo. Running terraform can execute arbitrary code from the pull request so Atlantis doesn't run it on untrusted forks.", failure)
+}
@@ -2,21 +2,31 @@ package server
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/hootsuite/atlantis/terraform"
 )
 
-var singleProjectTmpl = template.Must(template.New("").Parse("{{ range $result := .Results }}{{$result}}{{end}}\n" + logTmpl))
+var singleProjectTmpl = template.Must(template.New("").Parse("{{ range $result := .Results }}{{$result}}{{end}}\n" + applyHintTmpl + logTmpl))
+
+// multiProjectTmpl lists the status of each project and then collapses each
+// project's output so comments for many projects stay readable.
 var multiProjectTmpl = template.Must(template.New("").Parse(
 	"Ran {{.Command}} in {{ len .Results }} directories:\n" +
-		"{{ range $path, $result := .Results }}" +
-		" * `{{$path}}`\n" +
+		"{{ range $path, $status := .Statuses }}" +
+		" * `{{$path}}`: {{$status}}\n" +
 		"{{end}}\n" +
 		"{{ range $path, $result := .Results }}" +
-		"## {{$path}}/\n" +
+		"<details><summary><code>{{$path}}/</code>: {{index $.Statuses $path}}</summary>\n\n" +
 		"{{$result}}\n" +
-		"---\n{{end}}" +
+		"</details>\n\n{{end}}" +
+		applyHintTmpl +
 		logTmpl))
 var planSuccessTmpl = template.Must(template.New("").Parse(
 	"```diff\n" +
@@ -27,56 +37,384 @@ var applySuccessTmpl = template.Must(template.New("").Parse(
 	"```diff\n" +
 		"{{.Output}}\n" +
 		"```"))
-var errTmplText = "**{{.Command}} Error**\n" +
+var destroySuccessTmpl = template.Must(template.New("").Parse(
+	"```diff\n" +
+		"{{.Output}}\n" +
+		"```\n\n" +
+		"* Any plans for this environment were discarded. To recreate the resources, run `atlantis plan` and then `atlantis apply`."))
+var outputGistTmplText = "{{if .Summary}}```diff\n{{.Summary}}\n```\n\n{{end}}" +
+	"* The output was too long to comment, view it [here]({{.URL}})."
+var planGistTmpl = template.Must(template.New("").Parse(outputGistTmplText + "\n" +
+	"* To **discard** this plan click [here]({{.LockURL}})."))
+var outputGistTmpl = template.Must(template.New("").Parse(outputGistTmplText))
+var workspacesSuccessTmpl = template.Must(template.New("").Parse(
+	"Workspaces:\n" +
+		"{{ range $workspace := . }}" +
+		"* `{{$workspace}}`\n" +
+		"{{end}}\n" +
+		"* To plan a workspace comment `atlantis plan -w {workspace}`."))
+
+const errTmplText = "**{{.Command}} Error**\n" +
 	"```\n" +
 	"{{.Error}}\n" +
 	"```\n"
+
 var errTmpl = template.Must(template.New("").Parse(errTmplText))
-var errWithLogTmpl = template.Must(template.New("").Parse(errTmplText + logTmpl))
-var failureTmplText = "**{{.Command}} Failed**: {{.Failure}}\n"
+
+const failureTmplText = "**{{.Command}} Failed**: {{.Failure}}\n"
+
 var failureTmpl = template.Must(template.New("").Parse(failureTmplText))
-var failureWithLogTmpl = template.Must(template.New("").Parse(failureTmplText + logTmpl))
-var logTmpl = "{{if .Verbose}}\n<details><summary>Log</summary>\n  <p>\n\n```\n{{.Log}}```\n</p></details>{{end}}\n"
+var defaultCommentTmpl = template.Must(template.New("").Parse(DefaultCommentTemplate))
+var hookOutputTmpl = template.Must(template.New("").Parse("<details><summary>pre_plan and post_plan output</summary>\n\n```\n{{.}}\n```\n</details>"))
+var dirTmpl = template.Must(template.New("").Parse("Only the `{{.Dir}}` directory was {{.Action}} since it was set with `-d`.\n\n"))
+var envHeadingTmpl = template.Must(template.New("").Parse("# `{{.}}` environment\n"))
+var logOnlyTmpl = template.Must(template.New("").Parse(applyHintTmpl + logTmpl))
+var applyHintTmpl = "{{if .ApplyHint}}\n**To apply, comment:** {{.ApplyHint}}\n{{end}}"
+
+const logTmpl = "{{if .Verbose}}\n<details><summary>Log</summary>\n  <p>\n\n```\n{{.Log}}```\n</p></details>{{end}}" +
+	"{{if .VerboseNote}}\n<sub>{{.VerboseNote}}</sub>\n{{end}}\n"
 
 // GithubCommentRenderer renders responses as GitHub comments
-type GithubCommentRenderer struct{}
+type GithubCommentRenderer struct {
+	// ApplyHint is true if plans that succeeded in every project should
+	// end with the comment to apply them.
+	ApplyHint bool
+	// DefaultVerbose is true if Atlantis runs with --default-verbose so
+	// comments include their log unless they set --verbose=false.
+	DefaultVerbose bool
+	// Redactor redacts sensitive values from the output and log before
+	// they're commented. If it's nil, nothing is redacted.
+	Redactor *OutputRedactor
+	// Template renders the comment from CommentTemplateData, ex. the one
+	// parsed from --comment-template. If it's nil, Atlantis's own comment
+	// is commented.
+	Template *template.Template
+}
 
 type CommonData struct {
 	Command string
 	Verbose bool
 	Log     string
+	// ApplyHint is the comment(s) to apply a successful plan with, if any
+	ApplyHint string
+	// VerboseNote explains why the log was or wasn't included, if it isn't
+	// obvious from the comment
+	VerboseNote string
 }
 
-type ErrData struct {
-	Error string
-	CommonData
-}
-
-type FailureData struct {
-	Failure string
-	CommonData
+type outputGistData struct {
+	Summary string
+	URL     string
+	LockURL string
 }
 
 type ResultData struct {
 	Results map[string]string
+	// Statuses are the status of each path in Results, ex. Success
+	Statuses map[string]string
 	CommonData
 }
 
+// Render renders res, and its log if verbose is true, as a comment. If the
+// template can't be executed, Atlantis's own comment is used with the reason.
 func (g *GithubCommentRenderer) Render(res CommandResponse, log string, verbose bool) string {
-	commandStr := strings.Title(res.Command.String())
-	common := CommonData{commandStr, verbose, log}
+	data := g.templateData(res, log, verbose)
+	comment := g.renderTemplate(defaultCommentTmpl, data)
+	if g.Template == nil {
+		return comment
+	}
+	data.Comment = comment
+	buf := &bytes.Buffer{}
+	if err := g.Template.Execute(buf, data); err != nil {
+		return comment + fmt.Sprintf("\n<sub>The --comment-template couldn't be rendered so this is the default comment: %s</sub>\n", err)
+	}
+	return buf.String()
+}
+
+// templateData returns what the comment for res is rendered from. Like the
+// comment, it only has redacted output.
+func (g *GithubCommentRenderer) templateData(res CommandResponse, log string, verbose bool) CommentTemplateData {
+	redacted := res
+	redacted.ProjectResults = nil
+	for _, result := range res.ProjectResults {
+		redacted.ProjectResults = append(redacted.ProjectResults, g.Redactor.RedactResult(result))
+	}
+	redacted.Failure = g.Redactor.Redact(res.Failure)
 	if res.Error != nil {
-		return g.renderTemplate(errWithLogTmpl, ErrData{res.Error.Error(), common})
+		redacted.Error = errors.New(g.Redactor.Redact(res.Error.Error()))
+	}
+	common := CommonData{Command: strings.Title(res.Command.String()), Verbose: verbose, Log: g.Redactor.Redact(log), VerboseNote: g.verboseNote(verbose)}
+	data := CommentTemplateData{
+		Command:     common.Command,
+		Response:    redacted,
+		Results:     redacted.ProjectResults,
+		Log:         common.Log,
+		Verbose:     verbose,
+		VerboseNote: common.VerboseNote,
+	}
+	switch {
+	case redacted.Error != nil:
+		data.Error = redacted.Error.Error()
+		return data
+	case redacted.Failure != "":
+		data.Failure = redacted.Failure + g.renderAvailableProjects(res.Command, res.AvailableProjects)
+		return data
+	case len(redacted.ProjectResults) == 0:
+		// the command didn't match any projects so rather than rendering an
+		// empty success we render it as a failure, like its status
+		data.Failure = noMatchingProjectsDescription + "." + g.renderAvailableProjects(res.Command, res.AvailableProjects)
+		return data
+	}
+
+	if g.ApplyHint && res.Command == Plan && res.Status() == Success {
+		common.ApplyHint = g.renderApplyHint(res)
+	}
+	if res.Command == Plan {
+		data.Summary = g.renderPlanTotal(redacted.ProjectResults) + g.renderSkippedProjects(res.SkippedProjects)
+	}
+	if len(res.AvailableProjects) > 0 {
+		data.Summary += strings.TrimPrefix(g.renderAvailableProjects(res.Command, res.AvailableProjects), "\n\n") + "\n\n"
+	}
+	if res.Dir != "" {
+		action := "planned"
+		if res.Command == Apply {
+			action = "applied"
+		}
+		data.Summary += g.renderTemplate(dirTmpl, struct{ Dir, Action string }{res.Dir, action})
+	}
+	data.Projects = g.renderEnvResults(redacted.ProjectResults, common)
+	return data
+}
+
+// renderAvailableProjects renders the projects command could have run in if
+// it didn't match any of them, or "" if there are none to list.
+func (g *GithubCommentRenderer) renderAvailableProjects(command CommandName, paths []string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+	if command == Apply {
+		return fmt.Sprintf("\n\nThe projects with plans are: `%s`.", strings.Join(paths, "`, `"))
+	}
+	return fmt.Sprintf("\n\nThe projects in this repo are: `%s`.", strings.Join(paths, "`, `"))
+}
+
+// renderSkippedProjects renders how many projects weren't planned since the
+// pull request didn't modify them, or "" if none were skipped.
+func (g *GithubCommentRenderer) renderSkippedProjects(skipped int) string {
+	switch skipped {
+	case 0:
+		return ""
+	case 1:
+		return "Skipped 1 project that wasn't modified by this pull request.\n\n"
+	}
+	return fmt.Sprintf("Skipped %d projects that weren't modified by this pull request.\n\n", skipped)
+}
+
+// renderPlanSummary renders the line summarizing a plan's changes, ex.
+// "**Plan:** 1 to add, 0 to change, 0 to destroy."
+func (g *GithubCommentRenderer) renderPlanSummary(summary terraform.Summary) string {
+	if summary == (terraform.Summary{}) {
+		return "**Plan:** No changes."
+	}
+	return fmt.Sprintf("**Plan:** %d to add, %d to change, %d to destroy.", summary.Add, summary.Change, summary.Destroy)
+}
+
+// renderPlanTotal renders the changes of all of results' plans added up, if
+// more than one of them could be summarized, so reviewers can see them at a
+// glance at the top of the comment. Plans whose output couldn't be parsed
+// aren't counted.
+func (g *GithubCommentRenderer) renderPlanTotal(results []ProjectResult) string {
+	var total terraform.Summary
+	summarized := 0
+	for _, result := range results {
+		if result.PlanSuccess == nil {
+			continue
+		}
+		if summary := result.PlanSuccess.Summary(); summary != nil {
+			total.Add += summary.Add
+			total.Change += summary.Change
+			total.Destroy += summary.Destroy
+			summarized++
+		}
+	}
+	if summarized < 2 {
+		return ""
+	}
+	if total == (terraform.Summary{}) {
+		return fmt.Sprintf("**Total:** No changes in %d projects.\n\n", summarized)
+	}
+	return fmt.Sprintf("**Total:** %d to add, %d to change, %d to destroy in %d projects.\n\n", total.Add, total.Change, total.Destroy, summarized)
+}
+
+// verboseNote explains why the log was or wasn't included. A comment's
+// --verbose or --verbose=false overrides the server's default, so it's only
+// needed when the default is on since otherwise the log is only included if
+// the comment set --verbose.
+func (g *GithubCommentRenderer) verboseNote(verbose bool) string {
+	if !g.DefaultVerbose {
+		return ""
+	}
+	if verbose {
+		return "The log is included since Atlantis runs with `--default-verbose`. Comment with `--verbose=false` to leave it out."
+	}
+	return "The log was left out since the comment set `--verbose=false`, which overrides Atlantis's `--default-verbose`."
+}
+
+// renderApplyHint renders the comments to apply the plans in res, one for
+// each environment that was planned.
+func (g *GithubCommentRenderer) renderApplyHint(res CommandResponse) string {
+	var envs []string
+	planned := make(map[string]bool)
+	for _, result := range res.ProjectResults {
+		// results only have an environment if more than one was planned
+		env := result.Environment
+		if env == "" {
+			env = res.Environment
+		}
+		if !planned[env] {
+			envs = append(envs, env)
+			planned[env] = true
+		}
 	}
-	if res.Failure != "" {
-		return g.renderTemplate(failureWithLogTmpl, FailureData{res.Failure, common})
+	var comments []string
+	for _, env := range envs {
+		if env == "" || env == "default" {
+			comments = append(comments, "`atlantis apply`")
+		} else {
+			comments = append(comments, fmt.Sprintf("`atlantis apply %s`", env))
+		}
+	}
+	return strings.Join(comments, " and ")
+}
+
+// renderSummary renders the summary line of the output of command, ex. Plan,
+// or an empty string if output doesn't have one.
+func (g *GithubCommentRenderer) renderSummary(command string, output string) string {
+	summary := terraform.ParseSummary(output)
+	if summary == nil {
+		return ""
+	}
+	switch command {
+	case "Plan":
+		return fmt.Sprintf("Plan: %d to add, %d to change, %d to destroy.", summary.Add, summary.Change, summary.Destroy)
+	case "Destroy":
+		return fmt.Sprintf("Destroy complete! Resources: %d destroyed.", summary.Destroy)
+	}
+	return fmt.Sprintf("Apply complete! Resources: %d added, %d changed, %d destroyed.", summary.Add, summary.Change, summary.Destroy)
+}
+
+// renderEnvResults renders pathResults grouped by environment if they're
+// from more than one environment, ex. because of --all-envs.
+func (g *GithubCommentRenderer) renderEnvResults(pathResults []ProjectResult, common CommonData) string {
+	var envs []string
+	envResults := make(map[string][]ProjectResult)
+	for _, result := range pathResults {
+		if _, ok := envResults[result.Environment]; !ok {
+			envs = append(envs, result.Environment)
+		}
+		envResults[result.Environment] = append(envResults[result.Environment], result)
+	}
+	if len(envs) <= 1 {
+		return g.renderProjectResults(pathResults, common)
+	}
+
+	// the log is only rendered once at the end rather than for each environment
+	envCommon := CommonData{Command: common.Command}
+	buf := &bytes.Buffer{}
+	buf.WriteString(g.renderEnvTable(envs, envResults, common.Command))
+	for _, env := range envs {
+		buf.WriteString(g.renderTemplate(envHeadingTmpl, env))
+		buf.WriteString(g.renderProjectResults(envResults[env], envCommon))
+	}
+	buf.WriteString(g.renderTemplate(logOnlyTmpl, common))
+	return buf.String()
+}
+
+// renderEnvTable renders a table of the status of each project that ran in
+// more than one of envs, with a row for each environment linking to its
+// output. It returns "" if no project ran in more than one environment.
+func (g *GithubCommentRenderer) renderEnvTable(envs []string, envResults map[string][]ProjectResult, command string) string {
+	if command != "Plan" && command != "Apply" {
+		return ""
+	}
+	var paths []string
+	pathEnvs := make(map[string]int)
+	for _, env := range envs {
+		for _, result := range envResults[env] {
+			// environments that failed before their projects ran aren't
+			// in the table since they don't have a directory
+			if result.Path == "" {
+				continue
+			}
+			if pathEnvs[result.Path] == 0 {
+				paths = append(paths, result.Path)
+			}
+			pathEnvs[result.Path]++
+		}
+	}
+	sort.Strings(paths)
+
+	buf := &bytes.Buffer{}
+	for _, path := range paths {
+		if pathEnvs[path] < 2 {
+			continue
+		}
+		if buf.Len() == 0 {
+			buf.WriteString("| Directory | Environment | Plan | Apply |\n|---|---|---|---|\n")
+		}
+		for _, env := range envs {
+			for _, result := range envResults[env] {
+				if result.Path != path {
+					continue
+				}
+				planStatus, applyStatus := "-", "-"
+				if command == "Plan" {
+					planStatus = g.renderTableStatus(result)
+				} else {
+					applyStatus = g.renderTableStatus(result)
+				}
+				fmt.Fprintf(buf, "| `%s` | [`%s`](#%s) | %s | %s |\n", path, env, envAnchor(env), planStatus, applyStatus)
+			}
+		}
+	}
+	if buf.Len() > 0 {
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+// renderTableStatus renders result's status for the environment table.
+func (g *GithubCommentRenderer) renderTableStatus(result ProjectResult) string {
+	switch result.Status() {
+	case Error:
+		return "Error"
+	case Failure:
+		return "Failed"
+	}
+	return "Success"
+}
+
+// envAnchor returns the anchor GitHub generates for env's heading, which it
+// builds by lowercasing the heading, removing punctuation other than dashes
+// and underscores, and replacing spaces with dashes.
+func envAnchor(env string) string {
+	anchor := &bytes.Buffer{}
+	for _, r := range strings.ToLower(env + " environment") {
+		switch {
+		case r == ' ':
+			anchor.WriteRune('-')
+		case r == '-' || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+			anchor.WriteRune(r)
+		}
 	}
-	return g.renderProjectResults(res.ProjectResults, common)
+	return anchor.String()
 }
 
 func (g *GithubCommentRenderer) renderProjectResults(pathResults []ProjectResult, common CommonData) string {
 	results := make(map[string]string)
+	statuses := make(map[string]string)
 	for _, result := range pathResults {
+		statuses[result.Path] = g.renderTableStatus(result)
 		if result.Error != nil {
 			results[result.Path] = g.renderTemplate(errTmpl, struct {
 				Command string
@@ -93,13 +431,64 @@ func (g *GithubCommentRenderer) renderProjectResults(pathResults []ProjectResult
 				Command: common.Command,
 				Failure: result.Failure,
 			})
+		} else if result.OutputURL != "" {
+			// the output was uploaded as a gist so only its summary is commented
+			data := outputGistData{g.renderSummary(common.Command, result.Output()), result.OutputURL, ""}
+			if result.PlanSuccess != nil {
+				data.LockURL = result.PlanSuccess.LockURL
+				results[result.Path] = g.renderTemplate(planGistTmpl, data)
+			} else {
+				results[result.Path] = g.renderTemplate(outputGistTmpl, data)
+			}
 		} else if result.PlanSuccess != nil {
 			results[result.Path] = g.renderTemplate(planSuccessTmpl, *result.PlanSuccess)
+			// plans are long so their summary comes first. If it can't be
+			// parsed, there's only the output
+			if summary := result.PlanSuccess.Summary(); summary != nil {
+				results[result.Path] = g.renderPlanSummary(*summary) + "\n\n" + results[result.Path]
+			}
 		} else if result.ApplySuccess != "" {
 			results[result.Path] = g.renderTemplate(applySuccessTmpl, struct{ Output string }{result.ApplySuccess})
+		} else if result.DestroySuccess != "" {
+			results[result.Path] = g.renderTemplate(destroySuccessTmpl, struct{ Output string }{result.DestroySuccess})
+		} else if result.StateRmSuccess != "" {
+			results[result.Path] = g.renderTemplate(applySuccessTmpl, struct{ Output string }{result.StateRmSuccess})
+		} else if result.WorkspacesSuccess != nil {
+			results[result.Path] = g.renderTemplate(workspacesSuccessTmpl, result.WorkspacesSuccess)
 		} else {
 			results[result.Path] = "Found no template. This is a bug!"
 		}
+		for _, warning := range result.Warnings {
+			results[result.Path] = strings.TrimSuffix(results[result.Path], "\n") + "\n" + fmt.Sprintf("* **Warning**: %s", warning)
+		}
+		if len(result.Targets) > 0 {
+			results[result.Path] = strings.TrimSuffix(results[result.Path], "\n") + "\n" + fmt.Sprintf("* Targeted `%s`.", strings.Join(result.Targets, "`, `"))
+		}
+		if len(result.VarFiles) > 0 {
+			results[result.Path] = strings.TrimSuffix(results[result.Path], "\n") + "\n" + fmt.Sprintf("* Used var files `%s`.", strings.Join(result.VarFiles, "`, `"))
+		}
+		if result.ApplySuccess != "" && result.AppliedBy != "" {
+			results[result.Path] = strings.TrimSuffix(results[result.Path], "\n") + "\n" + fmt.Sprintf("* Applied by @%s at %s.", result.AppliedBy, result.AppliedAt.UTC().Format(appliedAtFormat))
+		}
+		if result.PlanSuccess != nil && result.LastApplied != nil {
+			if sinceApply := g.renderSinceLastApply(*result.PlanSuccess, *result.LastApplied); sinceApply != "" {
+				results[result.Path] = strings.TrimSuffix(results[result.Path], "\n") + "\n" + sinceApply
+			}
+		}
+		if result.Parallelism > 0 {
+			results[result.Path] = strings.TrimSuffix(results[result.Path], "\n") + "\n" + fmt.Sprintf("* Ran with `-parallelism=%d`.", result.Parallelism)
+		}
+		if result.LockTimeout != "" {
+			results[result.Path] = strings.TrimSuffix(results[result.Path], "\n") + "\n" + fmt.Sprintf("* Ran with `-lock-timeout=%s`.", result.LockTimeout)
+		}
+		if result.Duration > 0 {
+			results[result.Path] = strings.TrimSuffix(results[result.Path], "\n") + "\n" + g.renderDuration(common.Command, result)
+		}
+		// the hook output comes last since it's collapsed and can't be
+		// followed by a list
+		if result.HookOutput != "" {
+			results[result.Path] = strings.TrimSuffix(results[result.Path], "\n") + "\n\n" + g.renderTemplate(hookOutputTmpl, strings.TrimSpace(result.HookOutput))
+		}
 	}
 
 	var tmpl *template.Template
@@ -108,7 +497,58 @@ func (g *GithubCommentRenderer) renderProjectResults(pathResults []ProjectResult
 	} else {
 		tmpl = multiProjectTmpl
 	}
-	return g.renderTemplate(tmpl, ResultData{results, common})
+	return g.renderTemplate(tmpl, ResultData{results, statuses, common})
+}
+
+// appliedAtFormat is how the time a project was applied is rendered,
+// ex. 2017-09-01 10:00:00 UTC
+const appliedAtFormat = "2006-01-02 15:04:05 MST"
+
+// renderSinceLastApply renders whether plan would change anything since the
+// last successful apply, ex. "* No changes since the last apply in #12.", or
+// "" if that can't be determined from the plan's output. If the last apply's
+// summary was stored, it's compared with the plan's since a plan that makes
+// the same changes again means they were reverted or drifted.
+func (g *GithubCommentRenderer) renderSinceLastApply(plan PlanSuccess, lastApplied AppliedResult) string {
+	summary := terraform.ParseSummary(plan.TerraformOutput)
+	if summary == nil {
+		return ""
+	}
+	if *summary == (terraform.Summary{}) {
+		return fmt.Sprintf("* No changes since the last apply in #%d.", lastApplied.Pull)
+	}
+	changes := fmt.Sprintf("* Changes %d resource(s) since the last apply in #%d", summary.Add+summary.Change+summary.Destroy, lastApplied.Pull)
+	if lastApplied.Summary == nil {
+		return changes + "."
+	}
+	applied := lastApplied.Summary
+	if *applied == *summary {
+		return changes + fmt.Sprintf(", the same changes it applied (%d to add, %d to change, %d to destroy). They may have been reverted or drifted since.", applied.Add, applied.Change, applied.Destroy)
+	}
+	return changes + fmt.Sprintf(", which applied %d to add, %d to change, %d to destroy.", applied.Add, applied.Change, applied.Destroy)
+}
+
+// renderDuration renders how long the command took for the project,
+// ex. "* Planned in 42s."
+func (g *GithubCommentRenderer) renderDuration(command string, result ProjectResult) string {
+	d := result.Duration
+	if d < time.Second {
+		d = d / time.Millisecond * time.Millisecond
+	} else {
+		d = d / time.Second * time.Second
+	}
+	if result.Status() != Success {
+		return fmt.Sprintf("* Failed after %s.", d)
+	}
+	switch command {
+	case "Plan":
+		return fmt.Sprintf("* Planned in %s.", d)
+	case "Apply":
+		return fmt.Sprintf("* Applied in %s.", d)
+	case "Destroy":
+		return fmt.Sprintf("* Destroyed in %s.", d)
+	}
+	return fmt.Sprintf("* Ran in %s.", d)
 }
 
 func (g *GithubCommentRenderer) renderTemplate(tmpl *template.Template, data interface{}) string {
@@ -2,9 +2,12 @@ package server_test
 
 import (
 	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/hootsuite/atlantis/server"
+	"github.com/hootsuite/atlantis/terraform"
 	. "github.com/hootsuite/atlantis/testing_util"
 )
 
@@ -129,6 +132,208 @@ func TestRenderProjectResults(t *testing.T) {
 			},
 			"```diff\nsuccess\n```\n\n",
 		},
+		{
+			"single successful apply with who applied it",
+			server.Apply,
+			[]server.ProjectResult{
+				{
+					ApplySuccess: "success",
+					AppliedBy:    "lkysow",
+					AppliedAt:    time.Date(2017, 9, 1, 10, 0, 0, 0, time.UTC),
+				},
+			},
+			"```diff\nsuccess\n```\n* Applied by @lkysow at 2017-09-01 10:00:00 UTC.\n\n",
+		},
+		{
+			"single successful plan with duration",
+			server.Plan,
+			[]server.ProjectResult{
+				{
+					PlanSuccess: &server.PlanSuccess{
+						"terraform-output",
+						"lock-url",
+					},
+					Duration: 42*time.Second + 300*time.Millisecond,
+				},
+			},
+			"```diff\nterraform-output\n```\n\n* To **discard** this plan click [here](lock-url).\n* Planned in 42s.\n\n",
+		},
+		{
+			"single successful apply with duration",
+			server.Apply,
+			[]server.ProjectResult{
+				{
+					ApplySuccess: "success",
+					Duration:     350 * time.Millisecond,
+				},
+			},
+			"```diff\nsuccess\n```\n* Applied in 350ms.\n\n",
+		},
+		{
+			"single successful destroy with duration",
+			server.Destroy,
+			[]server.ProjectResult{
+				{
+					DestroySuccess: "Destroy complete! Resources: 2 destroyed.",
+					Duration:       3 * time.Second,
+				},
+			},
+			"```diff\nDestroy complete! Resources: 2 destroyed.\n```\n\n* Any plans for this environment were discarded. To recreate the resources, run `atlantis plan` and then `atlantis apply`.\n* Destroyed in 3s.\n\n",
+		},
+		{
+			"single successful state rm with duration",
+			server.StateRm,
+			[]server.ProjectResult{
+				{
+					StateRmSuccess: "Removed aws_instance.web\nSuccessfully removed 1 resource instance(s).",
+					Duration:       2 * time.Second,
+				},
+			},
+			"```diff\nRemoved aws_instance.web\nSuccessfully removed 1 resource instance(s).\n```\n* Ran in 2s.\n\n",
+		},
+		{
+			"single successful apply with parallelism and duration",
+			server.Apply,
+			[]server.ProjectResult{
+				{
+					ApplySuccess: "success",
+					Parallelism:  5,
+					Duration:     350 * time.Millisecond,
+				},
+			},
+			"```diff\nsuccess\n```\n* Ran with `-parallelism=5`.\n* Applied in 350ms.\n\n",
+		},
+		{
+			"single plan with no changes since the last apply",
+			server.Plan,
+			[]server.ProjectResult{
+				{
+					PlanSuccess: &server.PlanSuccess{
+						"No changes. Infrastructure is up-to-date.",
+						"lock-url",
+					},
+					LastApplied: &server.AppliedResult{Pull: 12},
+				},
+			},
+			"**Plan:** No changes.\n\n```diff\nNo changes. Infrastructure is up-to-date.\n```\n\n* To **discard** this plan click [here](lock-url).\n* No changes since the last apply in #12.\n\n",
+		},
+		{
+			"single plan with changes since the last apply",
+			server.Plan,
+			[]server.ProjectResult{
+				{
+					PlanSuccess: &server.PlanSuccess{
+						"Plan: 1 to add, 2 to change, 0 to destroy.",
+						"lock-url",
+					},
+					LastApplied: &server.AppliedResult{Pull: 12},
+				},
+			},
+			"**Plan:** 1 to add, 2 to change, 0 to destroy.\n\n```diff\nPlan: 1 to add, 2 to change, 0 to destroy.\n```\n\n* To **discard** this plan click [here](lock-url).\n* Changes 3 resource(s) since the last apply in #12.\n\n",
+		},
+		{
+			"single plan with other changes than the last apply",
+			server.Plan,
+			[]server.ProjectResult{
+				{
+					PlanSuccess: &server.PlanSuccess{
+						"Plan: 1 to add, 2 to change, 0 to destroy.",
+						"lock-url",
+					},
+					LastApplied: &server.AppliedResult{Pull: 12, Summary: &terraform.Summary{Add: 4}},
+				},
+			},
+			"**Plan:** 1 to add, 2 to change, 0 to destroy.\n\n```diff\nPlan: 1 to add, 2 to change, 0 to destroy.\n```\n\n* To **discard** this plan click [here](lock-url).\n* Changes 3 resource(s) since the last apply in #12, which applied 4 to add, 0 to change, 0 to destroy.\n\n",
+		},
+		{
+			"single plan with the same changes as the last apply",
+			server.Plan,
+			[]server.ProjectResult{
+				{
+					PlanSuccess: &server.PlanSuccess{
+						"Plan: 1 to add, 2 to change, 0 to destroy.",
+						"lock-url",
+					},
+					LastApplied: &server.AppliedResult{Pull: 12, Summary: &terraform.Summary{Add: 1, Change: 2}},
+				},
+			},
+			"**Plan:** 1 to add, 2 to change, 0 to destroy.\n\n```diff\nPlan: 1 to add, 2 to change, 0 to destroy.\n```\n\n* To **discard** this plan click [here](lock-url).\n* Changes 3 resource(s) since the last apply in #12, the same changes it applied (1 to add, 2 to change, 0 to destroy). They may have been reverted or drifted since.\n\n",
+		},
+		{
+			"single successful plan with a warning",
+			server.Plan,
+			[]server.ProjectResult{
+				{
+					PlanSuccess: &server.PlanSuccess{
+						"terraform-output",
+						"lock-url",
+					},
+					Warnings: []string{"warning"},
+				},
+			},
+			"```diff\nterraform-output\n```\n\n* To **discard** this plan click [here](lock-url).\n* **Warning**: warning\n\n",
+		},
+		{
+			"single successful plan with targets",
+			server.Plan,
+			[]server.ProjectResult{
+				{
+					PlanSuccess: &server.PlanSuccess{
+						"terraform-output",
+						"lock-url",
+					},
+					Targets: []string{"aws_security_group.web", "module.network.aws_security_group.db"},
+				},
+			},
+			"```diff\nterraform-output\n```\n\n* To **discard** this plan click [here](lock-url).\n* Targeted `aws_security_group.web`, `module.network.aws_security_group.db`.\n\n",
+		},
+		{
+			"single successful plan with var files",
+			server.Plan,
+			[]server.ProjectResult{
+				{
+					PlanSuccess: &server.PlanSuccess{
+						"terraform-output",
+						"lock-url",
+					},
+					VarFiles: []string{"env/staging.tfvars", "secrets.tfvars"},
+				},
+			},
+			"```diff\nterraform-output\n```\n\n* To **discard** this plan click [here](lock-url).\n* Used var files `env/staging.tfvars`, `secrets.tfvars`.\n\n",
+		},
+		{
+			"single successful apply with a lock timeout",
+			server.Apply,
+			[]server.ProjectResult{
+				{
+					ApplySuccess: "success",
+					Parallelism:  5,
+					LockTimeout:  "5m",
+				},
+			},
+			"```diff\nsuccess\n```\n* Ran with `-parallelism=5`.\n* Ran with `-lock-timeout=5m`.\n\n",
+		},
+		{
+			"single failed plan with duration",
+			server.Plan,
+			[]server.ProjectResult{
+				{
+					Failure:  "failure",
+					Duration: 65 * time.Second,
+				},
+			},
+			"**Plan Failed**: failure\n* Failed after 1m5s.\n\n",
+		},
+		{
+			"single successful workspaces",
+			server.Workspaces,
+			[]server.ProjectResult{
+				{
+					WorkspacesSuccess: []string{"default", "staging"},
+				},
+			},
+			"Workspaces:\n* `default`\n* `staging`\n\n* To plan a workspace comment `atlantis plan -w {workspace}`.\n\n",
+		},
 		{
 			"multiple successful plans",
 			server.Plan,
@@ -148,7 +353,7 @@ func TestRenderProjectResults(t *testing.T) {
 					},
 				},
 			},
-			"Ran Plan in 2 directories:\n * `path`\n * `path2`\n\n## path/\n```diff\nterraform-output\n```\n\n* To **discard** this plan click [here](lock-url).\n---\n## path2/\n```diff\nterraform-output2\n```\n\n* To **discard** this plan click [here](lock-url2).\n---\n\n",
+			"Ran Plan in 2 directories:\n * `path`: Success\n * `path2`: Success\n\n<details><summary><code>path/</code>: Success</summary>\n\n```diff\nterraform-output\n```\n\n* To **discard** this plan click [here](lock-url).\n</details>\n\n<details><summary><code>path2/</code>: Success</summary>\n\n```diff\nterraform-output2\n```\n\n* To **discard** this plan click [here](lock-url2).\n</details>\n\n\n",
 		},
 		{
 			"multiple successful applies",
@@ -163,7 +368,7 @@ func TestRenderProjectResults(t *testing.T) {
 					ApplySuccess: "success2",
 				},
 			},
-			"Ran Apply in 2 directories:\n * `path`\n * `path2`\n\n## path/\n```diff\nsuccess\n```\n---\n## path2/\n```diff\nsuccess2\n```\n---\n\n",
+			"Ran Apply in 2 directories:\n * `path`: Success\n * `path2`: Success\n\n<details><summary><code>path/</code>: Success</summary>\n\n```diff\nsuccess\n```\n</details>\n\n<details><summary><code>path2/</code>: Success</summary>\n\n```diff\nsuccess2\n```\n</details>\n\n\n",
 		},
 		{
 			"single errored plan",
@@ -205,7 +410,7 @@ func TestRenderProjectResults(t *testing.T) {
 					Error: errors.New("error"),
 				},
 			},
-			"Ran Plan in 3 directories:\n * `path`\n * `path2`\n * `path3`\n\n## path/\n```diff\nterraform-output\n```\n\n* To **discard** this plan click [here](lock-url).\n---\n## path2/\n**Plan Failed**: failure\n\n---\n## path3/\n**Plan Error**\n```\nerror\n```\n\n---\n\n",
+			"Ran Plan in 3 directories:\n * `path`: Success\n * `path2`: Failed\n * `path3`: Error\n\n<details><summary><code>path/</code>: Success</summary>\n\n```diff\nterraform-output\n```\n\n* To **discard** this plan click [here](lock-url).\n</details>\n\n<details><summary><code>path2/</code>: Failed</summary>\n\n**Plan Failed**: failure\n\n</details>\n\n<details><summary><code>path3/</code>: Error</summary>\n\n**Plan Error**\n```\nerror\n```\n\n</details>\n\n\n",
 		},
 		{
 			"successful, failed, and errored apply",
@@ -224,7 +429,90 @@ func TestRenderProjectResults(t *testing.T) {
 					Error: errors.New("error"),
 				},
 			},
-			"Ran Apply in 3 directories:\n * `path`\n * `path2`\n * `path3`\n\n## path/\n```diff\nsuccess\n```\n---\n## path2/\n**Apply Failed**: failure\n\n---\n## path3/\n**Apply Error**\n```\nerror\n```\n\n---\n\n",
+			"Ran Apply in 3 directories:\n * `path`: Success\n * `path2`: Failed\n * `path3`: Error\n\n<details><summary><code>path/</code>: Success</summary>\n\n```diff\nsuccess\n```\n</details>\n\n<details><summary><code>path2/</code>: Failed</summary>\n\n**Apply Failed**: failure\n\n</details>\n\n<details><summary><code>path3/</code>: Error</summary>\n\n**Apply Error**\n```\nerror\n```\n\n</details>\n\n\n",
+		},
+		{
+			"no results",
+			server.Plan,
+			nil,
+			"**Plan Failed**: No matching projects.\n\n",
+		},
+		{
+			"plans in multiple environments",
+			server.Plan,
+			[]server.ProjectResult{
+				{
+					Path:        "path",
+					Environment: "default",
+					PlanSuccess: &server.PlanSuccess{
+						"terraform-output",
+						"lock-url",
+					},
+				},
+				{
+					Path:        "path",
+					Environment: "staging",
+					PlanSuccess: &server.PlanSuccess{
+						"terraform-output2",
+						"lock-url2",
+					},
+				},
+			},
+			"| Directory | Environment | Plan | Apply |\n|---|---|---|---|\n| `path` | [`default`](#default-environment) | Success | - |\n| `path` | [`staging`](#staging-environment) | Success | - |\n\n" +
+				"# `default` environment\n```diff\nterraform-output\n```\n\n* To **discard** this plan click [here](lock-url).\n\n# `staging` environment\n```diff\nterraform-output2\n```\n\n* To **discard** this plan click [here](lock-url2).\n\n\n",
+		},
+		{
+			"applies in multiple environments",
+			server.Apply,
+			[]server.ProjectResult{
+				{
+					Path:         "path",
+					Environment:  "default",
+					ApplySuccess: "success",
+				},
+				{
+					Path:        "path",
+					Environment: "prod.us-east_1",
+					Failure:     "failure",
+				},
+				{
+					Path:        "path2",
+					Environment: "default",
+					Error:       errors.New("error"),
+				},
+			},
+			"| Directory | Environment | Plan | Apply |\n|---|---|---|---|\n| `path` | [`default`](#default-environment) | - | Success |\n| `path` | [`prod.us-east_1`](#produs-east_1-environment) | - | Failed |\n\n" +
+				"# `default` environment\nRan Apply in 2 directories:\n * `path`: Success\n * `path2`: Error\n\n<details><summary><code>path/</code>: Success</summary>\n\n```diff\nsuccess\n```\n</details>\n\n<details><summary><code>path2/</code>: Error</summary>\n\n**Apply Error**\n```\nerror\n```\n\n</details>\n\n\n" +
+				"# `prod.us-east_1` environment\n**Apply Failed**: failure\n\n\n\n",
+		},
+		{
+			"environment that failed before its projects ran",
+			server.Plan,
+			[]server.ProjectResult{
+				{
+					Path:        "path",
+					Environment: "staging",
+					PlanSuccess: &server.PlanSuccess{
+						"terraform-output",
+						"lock-url",
+					},
+				},
+				{
+					Path:        "path",
+					Environment: "prod",
+					PlanSuccess: &server.PlanSuccess{
+						"terraform-output2",
+						"lock-url2",
+					},
+				},
+				{
+					Environment: "qa",
+					Failure:     "locked",
+				},
+			},
+			"| Directory | Environment | Plan | Apply |\n|---|---|---|---|\n| `path` | [`staging`](#staging-environment) | Success | - |\n| `path` | [`prod`](#prod-environment) | Success | - |\n\n" +
+				"# `staging` environment\n```diff\nterraform-output\n```\n\n* To **discard** this plan click [here](lock-url).\n\n# `prod` environment\n```diff\nterraform-output2\n```\n\n* To **discard** this plan click [here](lock-url2).\n\n" +
+				"# `qa` environment\n**Plan Failed**: locked\n\n\n\n",
 		},
 	}
 
@@ -245,3 +533,217 @@ func TestRenderProjectResults(t *testing.T) {
 		}
 	}
 }
+
+func TestRenderApplyHint(t *testing.T) {
+	success := server.ProjectResult{Path: "path", PlanSuccess: &server.PlanSuccess{"success", "lock-url"}}
+	cases := []struct {
+		Description    string
+		Command        server.CommandName
+		Environment    string
+		ProjectResults []server.ProjectResult
+		Expected       string
+	}{
+		{
+			"successful plan",
+			server.Plan,
+			"staging",
+			[]server.ProjectResult{success},
+			"```diff\nsuccess\n```\n\n* To **discard** this plan click [here](lock-url).\n\n**To apply, comment:** `atlantis apply staging`\n\n",
+		},
+		{
+			"successful plan in the default environment",
+			server.Plan,
+			"default",
+			[]server.ProjectResult{success, {Path: "path2", PlanSuccess: &server.PlanSuccess{"success2", "lock-url2"}}},
+			"Ran Plan in 2 directories:\n * `path`: Success\n * `path2`: Success\n\n<details><summary><code>path/</code>: Success</summary>\n\n```diff\nsuccess\n```\n\n* To **discard** this plan click [here](lock-url).\n</details>\n\n" +
+				"<details><summary><code>path2/</code>: Success</summary>\n\n```diff\nsuccess2\n```\n\n* To **discard** this plan click [here](lock-url2).\n</details>\n\n\n**To apply, comment:** `atlantis apply`\n\n",
+		},
+		{
+			"successful plan in multiple environments",
+			server.Plan,
+			"default",
+			[]server.ProjectResult{
+				{Path: "path", Environment: "production", PlanSuccess: &server.PlanSuccess{"success", "lock-url"}},
+				{Path: "path2", Environment: "staging", PlanSuccess: &server.PlanSuccess{"success2", "lock-url2"}},
+			},
+			"# `production` environment\n```diff\nsuccess\n```\n\n* To **discard** this plan click [here](lock-url).\n\n" +
+				"# `staging` environment\n```diff\nsuccess2\n```\n\n* To **discard** this plan click [here](lock-url2).\n\n" +
+				"\n**To apply, comment:** `atlantis apply production` and `atlantis apply staging`\n\n",
+		},
+		{
+			"plan that failed in a project",
+			server.Plan,
+			"staging",
+			[]server.ProjectResult{success, {Path: "path2", Failure: "failure"}},
+			"Ran Plan in 2 directories:\n * `path`: Success\n * `path2`: Failed\n\n<details><summary><code>path/</code>: Success</summary>\n\n```diff\nsuccess\n```\n\n* To **discard** this plan click [here](lock-url).\n</details>\n\n" +
+				"<details><summary><code>path2/</code>: Failed</summary>\n\n**Plan Failed**: failure\n\n</details>\n\n\n",
+		},
+		{
+			"successful apply",
+			server.Apply,
+			"staging",
+			[]server.ProjectResult{{Path: "path", ApplySuccess: "success"}},
+			"```diff\nsuccess\n```\n\n",
+		},
+	}
+
+	r := server.GithubCommentRenderer{ApplyHint: true}
+	for _, c := range cases {
+		t.Log("testing " + c.Description)
+		res := server.CommandResponse{
+			Command:        c.Command,
+			Environment:    c.Environment,
+			ProjectResults: c.ProjectResults,
+		}
+		Equals(t, c.Expected, r.Render(res, "log", false))
+	}
+}
+
+func TestRenderVerboseNote(t *testing.T) {
+	t.Log("with --default-verbose the comment should say why the log was or wasn't included")
+	res := server.CommandResponse{Command: server.Apply, ProjectResults: []server.ProjectResult{{Path: "path", ApplySuccess: "success"}}}
+	r := server.GithubCommentRenderer{DefaultVerbose: true}
+	Equals(t, "```diff\nsuccess\n```\n\n<details><summary>Log</summary>\n  <p>\n\n```\nlog```\n</p></details>\n"+
+		"<sub>The log is included since Atlantis runs with `--default-verbose`. Comment with `--verbose=false` to leave it out.</sub>\n\n", r.Render(res, "log", true))
+	Equals(t, "```diff\nsuccess\n```\n\n<sub>The log was left out since the comment set `--verbose=false`, which overrides Atlantis's `--default-verbose`.</sub>\n\n", r.Render(res, "log", false))
+
+	t.Log("without it there's nothing to explain")
+	r = server.GithubCommentRenderer{}
+	Equals(t, "```diff\nsuccess\n```\n\n", r.Render(res, "log", false))
+}
+
+func TestRenderRedacts(t *testing.T) {
+	t.Log("sensitive values should be redacted from the output and the log")
+	redactor, err := server.NewOutputRedactor("password")
+	Ok(t, err)
+	r := server.GithubCommentRenderer{Redactor: redactor}
+	planSuccess := &server.PlanSuccess{"+ aws_db_instance.db\n    password: \"hunter2\"", "lock-url"}
+	res := server.CommandResponse{Command: server.Plan, ProjectResults: []server.ProjectResult{{Path: "path", PlanSuccess: planSuccess}}}
+	Equals(t, "```diff\n+ aws_db_instance.db\n    password: \"<redacted>\"\n```\n\n* To **discard** this plan click [here](lock-url).\n\n"+
+		"<details><summary>Log</summary>\n  <p>\n\n```\n[INFO] running plan -var password=<redacted>\n```\n</p></details>\n",
+		r.Render(res, "[INFO] running plan -var password=hunter2\n", true))
+	Equals(t, "+ aws_db_instance.db\n    password: \"hunter2\"", planSuccess.TerraformOutput)
+
+	t.Log("and from errors")
+	res = server.CommandResponse{Command: server.Plan, Error: errors.New("running plan -var password=hunter2")}
+	Equals(t, "**Plan Error**\n```\nrunning plan -var password=<redacted>\n```\n\n", r.Render(res, "", false))
+}
+
+func TestRenderHookOutput(t *testing.T) {
+	t.Log("the output of pre_plan and post_plan should be collapsed after the project's result")
+	redactor, err := server.NewOutputRedactor("token")
+	Ok(t, err)
+	r := server.GithubCommentRenderer{Redactor: redactor}
+	res := server.CommandResponse{Command: server.Plan, ProjectResults: []server.ProjectResult{{
+		Path:        "path",
+		PlanSuccess: &server.PlanSuccess{"success", "lock-url"},
+		Warnings:    []string{"warning"},
+		HookOutput:  "generated vars\ntoken=secret\n",
+	}}}
+	Equals(t, "```diff\nsuccess\n```\n\n* To **discard** this plan click [here](lock-url).\n* **Warning**: warning\n\n"+
+		"<details><summary>pre_plan and post_plan output</summary>\n\n```\ngenerated vars\ntoken=<redacted>\n```\n</details>\n\n",
+		r.Render(res, "", false))
+}
+
+func TestRenderPlanTotal(t *testing.T) {
+	t.Log("plans of more than one project should start with their changes added up")
+	r := server.GithubCommentRenderer{}
+	res := server.CommandResponse{Command: server.Plan, ProjectResults: []server.ProjectResult{
+		{Path: "a", PlanSuccess: &server.PlanSuccess{"Plan: 1 to add, 2 to change, 0 to destroy.", "lock-url"}},
+		{Path: "b", PlanSuccess: &server.PlanSuccess{"Plan: 1 to import, 1 to add, 0 to change, 3 to destroy.", "lock-url"}},
+		{Path: "c", PlanSuccess: &server.PlanSuccess{"unparseable", "lock-url"}},
+		{Path: "d", Failure: "failure"},
+	}}
+	comment := r.Render(res, "", false)
+	Assert(t, strings.HasPrefix(comment, "**Total:** 2 to add, 2 to change, 3 to destroy in 2 projects.\n\nRan Plan in 4 directories:\n"), "unexpected start of comment %q", comment)
+
+	t.Log("and say when none of them have changes")
+	res = server.CommandResponse{Command: server.Plan, ProjectResults: []server.ProjectResult{
+		{Path: "a", PlanSuccess: &server.PlanSuccess{"No changes. Infrastructure is up-to-date.", "lock-url"}},
+		{Path: "b", PlanSuccess: &server.PlanSuccess{"No changes. Your infrastructure matches the configuration.", "lock-url"}},
+	}}
+	comment = r.Render(res, "", false)
+	Assert(t, strings.HasPrefix(comment, "**Total:** No changes in 2 projects.\n\nRan Plan in 2 directories:\n"), "unexpected start of comment %q", comment)
+
+	t.Log("but not when only one project could be summarized")
+	res = server.CommandResponse{Command: server.Plan, ProjectResults: []server.ProjectResult{
+		{Path: "a", PlanSuccess: &server.PlanSuccess{"Plan: 1 to add, 2 to change, 0 to destroy.", "lock-url"}},
+		{Path: "c", PlanSuccess: &server.PlanSuccess{"unparseable", "lock-url"}},
+	}}
+	comment = r.Render(res, "", false)
+	Assert(t, strings.HasPrefix(comment, "Ran Plan in 2 directories:\n"), "unexpected start of comment %q", comment)
+}
+
+func TestRenderSkippedProjects(t *testing.T) {
+	t.Log("plans should say how many projects weren't planned since they weren't modified")
+	r := server.GithubCommentRenderer{}
+	res := server.CommandResponse{
+		Command:         server.Plan,
+		SkippedProjects: 3,
+		ProjectResults:  []server.ProjectResult{{Path: "path", PlanSuccess: &server.PlanSuccess{"success", "lock-url"}}},
+	}
+	Equals(t, "Skipped 3 projects that weren't modified by this pull request.\n\n```diff\nsuccess\n```\n\n* To **discard** this plan click [here](lock-url).\n\n", r.Render(res, "", false))
+	res.SkippedProjects = 1
+	comment := r.Render(res, "", false)
+	Assert(t, strings.HasPrefix(comment, "Skipped 1 project that wasn't modified by this pull request.\n\n"), "unexpected start of comment %q", comment)
+}
+
+func TestRenderDir(t *testing.T) {
+	t.Log("plans of a -d directory should say only that directory was planned")
+	r := server.GithubCommentRenderer{}
+	res := server.CommandResponse{
+		Command:        server.Plan,
+		Dir:            "staging",
+		ProjectResults: []server.ProjectResult{{Path: "staging", PlanSuccess: &server.PlanSuccess{"success", "lock-url"}}},
+	}
+	Equals(t, "Only the `staging` directory was planned since it was set with `-d`.\n\n```diff\nsuccess\n```\n\n* To **discard** this plan click [here](lock-url).\n\n", r.Render(res, "log", false))
+
+	t.Log("and applies should say only it was applied")
+	res = server.CommandResponse{
+		Command:        server.Apply,
+		Dir:            "staging",
+		ProjectResults: []server.ProjectResult{{Path: "staging", ApplySuccess: "success"}},
+	}
+	Equals(t, "Only the `staging` directory was applied since it was set with `-d`.\n\n```diff\nsuccess\n```\n\n", r.Render(res, "log", false))
+}
+
+func TestRenderAvailableProjects(t *testing.T) {
+	t.Log("commands that didn't match a project should list the ones they could have run in")
+	r := server.GithubCommentRenderer{}
+	res := server.CommandResponse{
+		Command:           server.Plan,
+		Failure:           `The -d directory "missing" doesn't exist in the repo.`,
+		AvailableProjects: []string{"production", "staging"},
+	}
+	Equals(t, "**Plan Failed**: The -d directory \"missing\" doesn't exist in the repo.\n\nThe projects in this repo are: `production`, `staging`.\n\n", r.Render(res, "log", false))
+
+	t.Log("applies should list the projects that were planned")
+	res = server.CommandResponse{Command: server.Apply, AvailableProjects: []string{"staging"}}
+	Equals(t, "**Apply Failed**: No matching projects.\n\nThe projects with plans are: `staging`.\n\n", r.Render(res, "log", false))
+
+	t.Log("environments that didn't match a project should list them before the results")
+	res = server.CommandResponse{
+		Command:           server.Plan,
+		ProjectResults:    []server.ProjectResult{{Environment: "staging", Failure: "failure"}},
+		AvailableProjects: []string{"staging"},
+	}
+	comment := r.Render(res, "log", false)
+	Assert(t, strings.HasPrefix(comment, "The projects in this repo are: `staging`.\n\n"), "unexpected start of comment %q", comment)
+}
+
+func TestRenderOutputGist(t *testing.T) {
+	t.Log("output uploaded as a gist should be rendered as its summary and a link")
+	r := server.GithubCommentRenderer{}
+	res := server.CommandResponse{Command: server.Plan, ProjectResults: []server.ProjectResult{{
+		Path:        "path",
+		PlanSuccess: &server.PlanSuccess{"...\nPlan: 1 to add, 2 to change, 3 to destroy.", "lock-url"},
+		OutputURL:   "gist-url",
+	}}}
+	Equals(t, "```diff\nPlan: 1 to add, 2 to change, 3 to destroy.\n```\n\n* The output was too long to comment, view it [here](gist-url).\n* To **discard** this plan click [here](lock-url).\n\n", r.Render(res, "log", false))
+
+	res = server.CommandResponse{Command: server.Apply, ProjectResults: []server.ProjectResult{{Path: "path", ApplySuccess: "no summary", OutputURL: "gist-url"}}}
+	Equals(t, "* The output was too long to comment, view it [here](gist-url).\n\n", r.Render(res, "log", false))
+
+	res = server.CommandResponse{Command: server.Destroy, ProjectResults: []server.ProjectResult{{Path: "path", DestroySuccess: "Destroy complete! Resources: 4 destroyed.", OutputURL: "gist-url"}}}
+	Equals(t, "```diff\nDestroy complete! Resources: 4 destroyed.\n```\n\n* The output was too long to comment, view it [here](gist-url).\n\n", r.Render(res, "log", false))
+}
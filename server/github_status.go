@@ -2,19 +2,38 @@ package server
 
 import (
 	"fmt"
+	"net/url"
 
 	"strings"
+	"time"
 
 	"github.com/hootsuite/atlantis/github"
-	"github.com/hootsuite/atlantis/models"
 )
 
 type Status int
 
 const (
-	statusContext = "Atlantis"
-	PlanStep      = "plan"
-	ApplyStep     = "apply"
+	// DefaultStatusContext is the context of the aggregate status, and the
+	// prefix of the per-project ones, if GithubStatus.Context isn't set
+	DefaultStatusContext = "Atlantis"
+	PlanStep             = "plan"
+	ApplyStep            = "apply"
+	DestroyStep          = "destroy"
+	StateRmStep          = "state rm"
+	// noMatchingProjectsDescription is the status description when a
+	// command didn't match any projects
+	noMatchingProjectsDescription = "No matching projects"
+)
+
+const (
+	// AggregateStatuses sets one Atlantis status with the worst result of
+	// all the projects.
+	AggregateStatuses = "aggregate"
+	// ProjectStatuses sets a status per project, ex. Atlantis/plan: path,
+	// and no aggregate status.
+	ProjectStatuses = "project"
+	// AllStatuses sets both the aggregate status and a status per project.
+	AllStatuses = "both"
 )
 
 const (
@@ -26,6 +45,27 @@ const (
 
 type GithubStatus struct {
 	Client github.Client
+	// AtlantisURL is where Atlantis can be reached. If set, statuses link to
+	// the results API for the run that set them.
+	AtlantisURL string
+	// Retries is how many times to retry updating the status if it fails
+	// with a transient error
+	Retries int
+	// RetryDelay is how long to wait before the first retry. It doubles
+	// after each retry.
+	RetryDelay time.Duration
+	// CommentOnFailure is true if a comment should be posted on the pull
+	// request when the status couldn't be updated so users know the status
+	// is stale
+	CommentOnFailure bool
+	// Statuses is one of AggregateStatuses, ProjectStatuses or AllStatuses.
+	// If it's empty, it's AggregateStatuses.
+	Statuses string
+	// Context is the context of the aggregate status and the prefix of the
+	// per-project ones, ex. Atlantis-staging/plan: path, so that several
+	// Atlantis servers can set statuses on the same repo. If it's empty,
+	// it's DefaultStatusContext.
+	Context string
 }
 
 func (s Status) String() string {
@@ -42,18 +82,117 @@ func (s Status) String() string {
 	return "error"
 }
 
-func (g *GithubStatus) Update(repo models.Repo, pull models.PullRequest, status Status, step string) error {
-	description := fmt.Sprintf("%s %s", strings.Title(step), strings.Title(status.String()))
-	return g.Client.UpdateStatus(repo, pull, status.String(), description, statusContext)
+// Update sets the aggregate status. If only project statuses are set it does
+// nothing since there's no project to attribute status to.
+func (g *GithubStatus) Update(ctx *CommandContext, status Status, step string) error {
+	if g.Statuses == ProjectStatuses {
+		return nil
+	}
+	return g.updateStatus(ctx, status.String(), g.description(step, status), g.context())
+}
+
+// DryRun sets the aggregate status to pending with a description saying step
+// didn't run because Atlantis is running with --dry-run.
+func (g *GithubStatus) DryRun(ctx *CommandContext, step string) error {
+	if g.Statuses == ProjectStatuses {
+		return nil
+	}
+	return g.updateStatus(ctx, Pending.String(), fmt.Sprintf("%s Dry Run", strings.Title(step)), g.context())
 }
 
+// UpdateProjectResult sets the aggregate status to the worst status of
+// projectResults and, if configured, a status per project. If there are no
+// results then the command didn't match any projects, which is a failure
+// rather than a success.
 func (g *GithubStatus) UpdateProjectResult(ctx *CommandContext, projectResults []ProjectResult) error {
+	if g.Statuses == ProjectStatuses || g.Statuses == AllStatuses {
+		if err := g.updateProjectStatuses(ctx, projectResults); err != nil {
+			return err
+		}
+	}
+	if g.Statuses == ProjectStatuses {
+		return nil
+	}
+	if len(projectResults) == 0 {
+		return g.updateStatus(ctx, Failure.String(), noMatchingProjectsDescription, g.context())
+	}
 	var statuses []Status
 	for _, p := range projectResults {
 		statuses = append(statuses, p.Status())
 	}
 	worst := g.worstStatus(statuses)
-	return g.Update(ctx.BaseRepo, ctx.Pull, worst, ctx.Command.Name.String())
+	return g.Update(ctx, worst, ctx.Command.Name.String())
+}
+
+// updateProjectStatuses sets a status for each of projectResults with its
+// own context so reviewers can see which project failed. It sets all of them
+// even if one fails and returns the first error.
+func (g *GithubStatus) updateProjectStatuses(ctx *CommandContext, projectResults []ProjectResult) error {
+	step := ctx.Command.Name.String()
+	var firstErr error
+	for _, p := range projectResults {
+		// an environment that failed before any of its projects ran, ex.
+		// because it was locked, only counts towards the aggregate status
+		if p.Path == "" {
+			continue
+		}
+		context := fmt.Sprintf("%s/%s: %s", g.context(), step, p.Path)
+		// projects planned in every environment have a result per environment
+		if p.Environment != "" {
+			context = fmt.Sprintf("%s (%s)", context, p.Environment)
+		}
+		status := p.Status()
+		if err := g.updateStatus(ctx, status.String(), g.description(step, status), context); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// context returns the context of the aggregate status.
+func (g *GithubStatus) context() string {
+	if g.Context == "" {
+		return DefaultStatusContext
+	}
+	return g.Context
+}
+
+func (g *GithubStatus) description(step string, status Status) string {
+	return fmt.Sprintf("%s %s", strings.Title(step), strings.Title(status.String()))
+}
+
+// updateStatus sets the status with context, retrying transient failures. If
+// it still fails, the error is logged and, if configured, commented on the
+// pull request since a stale status can block merging.
+func (g *GithubStatus) updateStatus(ctx *CommandContext, state string, description string, context string) error {
+	delay := g.RetryDelay
+	err := g.Client.UpdateStatus(ctx.BaseRepo, ctx.Pull, state, description, g.targetURL(ctx), context)
+	for attempt := 0; attempt < g.Retries && github.IsTransientError(err); attempt++ {
+		ctx.Log.Warn("updating status %s to %q failed, retrying in %s: %s", context, description, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+		err = g.Client.UpdateStatus(ctx.BaseRepo, ctx.Pull, state, description, g.targetURL(ctx), context)
+	}
+	if err == nil {
+		return nil
+	}
+	ctx.Log.Err("unable to update status %s to %q so it is stale: %s", context, description, err)
+	if g.CommentOnFailure {
+		comment := fmt.Sprintf("**Warning**: Atlantis couldn't update the status of this pull request to `%s` so it may be out of date. Run the command again to retry.", description)
+		if commentErr := g.Client.CreateComment(ctx.BaseRepo, ctx.Pull, comment); commentErr != nil {
+			ctx.Log.Err("commenting that the status couldn't be updated: %s", commentErr)
+		}
+	}
+	return err
+}
+
+// targetURL returns the link to the results of the run in ctx, or "" if
+// there's nothing to link to.
+func (g *GithubStatus) targetURL(ctx *CommandContext) string {
+	if g.AtlantisURL == "" || ctx.RunID == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/api/results?repo=%s&pull=%d&run=%s", g.AtlantisURL, url.QueryEscape(ctx.BaseRepo.FullName), ctx.Pull.Num, ctx.RunID)
 }
 
 func (g *GithubStatus) worstStatus(ss []Status) Status {
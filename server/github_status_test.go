@@ -1,12 +1,18 @@
 package server_test
 
 import (
+	"log"
+	"net/http"
+	"os"
 	"testing"
+	"time"
 
 	"errors"
 	"strings"
 
+	"github.com/google/go-github/github"
 	"github.com/hootsuite/atlantis/github/mocks"
+	"github.com/hootsuite/atlantis/logging"
 	"github.com/hootsuite/atlantis/models"
 	"github.com/hootsuite/atlantis/server"
 	. "github.com/hootsuite/atlantis/testing_util"
@@ -33,10 +39,10 @@ func TestStatus_String(t *testing.T) {
 func TestUpdate(t *testing.T) {
 	RegisterMockTestingT(t)
 	client := mocks.NewMockClient()
-	s := server.GithubStatus{client}
-	err := s.Update(repoModel, pullModel, status, step)
+	s := server.GithubStatus{Client: client}
+	err := s.Update(&server.CommandContext{BaseRepo: repoModel, Pull: pullModel}, status, step)
 	Ok(t, err)
-	client.VerifyWasCalledOnce().UpdateStatus(repoModel, pullModel, "success", "Step Success", "Atlantis")
+	client.VerifyWasCalledOnce().UpdateStatus(repoModel, pullModel, "success", "Step Success", "", "Atlantis")
 }
 
 func TestUpdateProjectResult(t *testing.T) {
@@ -91,8 +97,131 @@ func TestUpdateProjectResult(t *testing.T) {
 		}
 
 		client := mocks.NewMockClient()
-		s := server.GithubStatus{client}
+		s := server.GithubStatus{Client: client}
 		s.UpdateProjectResult(ctx, results)
-		client.VerifyWasCalledOnce().UpdateStatus(repoModel, pullModel, c.Expected, "Plan "+strings.Title(c.Expected), "Atlantis")
+		client.VerifyWasCalledOnce().UpdateStatus(repoModel, pullModel, c.Expected, "Plan "+strings.Title(c.Expected), "", "Atlantis")
 	}
 }
+
+func TestUpdateProjectResult_NoResults(t *testing.T) {
+	t.Log("if the command matched no projects the status should be a failure")
+	RegisterMockTestingT(t)
+	ctx := &server.CommandContext{
+		BaseRepo: repoModel,
+		Pull:     pullModel,
+		Command:  &server.Command{Name: server.Plan},
+	}
+	client := mocks.NewMockClient()
+	s := server.GithubStatus{Client: client}
+	s.UpdateProjectResult(ctx, nil)
+	client.VerifyWasCalledOnce().UpdateStatus(repoModel, pullModel, "failure", "No matching projects", "", "Atlantis")
+}
+
+func TestUpdateProjectResult_ProjectStatuses(t *testing.T) {
+	t.Log("each project should get its own status and there should be no aggregate status")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	s := server.GithubStatus{Client: client, Statuses: server.ProjectStatuses}
+	results := []server.ProjectResult{
+		{Path: "ok"},
+		{Path: "path/to/project", Failure: "failure"},
+		{Path: "envs", Environment: "staging", Error: errors.New("err")},
+		// environments that failed before running any projects don't get one
+		{Environment: "prod", Failure: "locked"},
+	}
+	Ok(t, s.UpdateProjectResult(statusCtx(), results))
+	Ok(t, s.Update(statusCtx(), server.Pending, server.PlanStep))
+	client.VerifyWasCalledOnce().UpdateStatus(repoModel, pullModel, "success", "Plan Success", "", "Atlantis/plan: ok")
+	client.VerifyWasCalledOnce().UpdateStatus(repoModel, pullModel, "failure", "Plan Failure", "", "Atlantis/plan: path/to/project")
+	client.VerifyWasCalledOnce().UpdateStatus(repoModel, pullModel, "error", "Plan Error", "", "Atlantis/plan: envs (staging)")
+	client.VerifyWasCalled(Times(3)).UpdateStatus(AnyRepo(), AnyPullRequest(), AnyString(), AnyString(), AnyString(), AnyString())
+}
+
+func TestUpdateProjectResult_AllStatuses(t *testing.T) {
+	t.Log("each project should get its own status as well as the aggregate status")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	s := server.GithubStatus{Client: client, Statuses: server.AllStatuses}
+	results := []server.ProjectResult{
+		{Path: "ok"},
+		{Path: "path/to/project", Failure: "failure"},
+	}
+	Ok(t, s.UpdateProjectResult(statusCtx(), results))
+	client.VerifyWasCalledOnce().UpdateStatus(repoModel, pullModel, "success", "Plan Success", "", "Atlantis/plan: ok")
+	client.VerifyWasCalledOnce().UpdateStatus(repoModel, pullModel, "failure", "Plan Failure", "", "Atlantis/plan: path/to/project")
+	client.VerifyWasCalledOnce().UpdateStatus(repoModel, pullModel, "failure", "Plan Failure", "", "Atlantis")
+}
+
+func TestUpdateProjectResult_Context(t *testing.T) {
+	t.Log("the configured context should be used for the aggregate status and prefix the per-project ones")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	s := server.GithubStatus{Client: client, Statuses: server.AllStatuses, Context: "Atlantis-staging"}
+	Ok(t, s.UpdateProjectResult(statusCtx(), []server.ProjectResult{{Path: "ok"}}))
+	Ok(t, s.UpdateProjectResult(statusCtx(), nil))
+	client.VerifyWasCalledOnce().UpdateStatus(repoModel, pullModel, "success", "Plan Success", "", "Atlantis-staging/plan: ok")
+	client.VerifyWasCalledOnce().UpdateStatus(repoModel, pullModel, "success", "Plan Success", "", "Atlantis-staging")
+	client.VerifyWasCalledOnce().UpdateStatus(repoModel, pullModel, "failure", "No matching projects", "", "Atlantis-staging")
+	client.VerifyWasCalled(Never()).UpdateStatus(AnyRepo(), AnyPullRequest(), AnyString(), AnyString(), AnyString(), EqString("Atlantis"))
+}
+
+func TestUpdate_TargetURL(t *testing.T) {
+	t.Log("the status should link to the results of the run that set it")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	s := server.GithubStatus{Client: client, AtlantisURL: "https://atlantis.example.com"}
+	ctx := &server.CommandContext{
+		BaseRepo: models.Repo{FullName: "owner/repo"},
+		Pull:     models.PullRequest{Num: 1},
+		RunID:    "abc123",
+	}
+	err := s.Update(ctx, server.Pending, server.PlanStep)
+	Ok(t, err)
+	client.VerifyWasCalledOnce().UpdateStatus(ctx.BaseRepo, ctx.Pull, "pending", "Plan Pending", "https://atlantis.example.com/api/results?repo=owner%2Frepo&pull=1&run=abc123", "Atlantis")
+}
+
+func statusCtx() *server.CommandContext {
+	return &server.CommandContext{
+		BaseRepo: repoModel,
+		Pull:     pullModel,
+		Command:  &server.Command{Name: server.Plan},
+		Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+}
+
+func TestUpdate_RetriesTransientErrors(t *testing.T) {
+	t.Log("transient errors should be retried until the status is updated")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	When(client.UpdateStatus(repoModel, pullModel, "pending", "Plan Pending", "", "Atlantis")).
+		ThenReturn(errors.New("timeout")).
+		ThenReturn(nil)
+	s := server.GithubStatus{Client: client, Retries: 3, RetryDelay: time.Millisecond, CommentOnFailure: true}
+	err := s.Update(statusCtx(), server.Pending, server.PlanStep)
+	Ok(t, err)
+	client.VerifyWasCalled(Times(2)).UpdateStatus(repoModel, pullModel, "pending", "Plan Pending", "", "Atlantis")
+	client.VerifyWasCalled(Never()).CreateComment(AnyRepo(), AnyPullRequest(), AnyString())
+}
+
+func TestUpdate_CommentsWhenRetriesRunOut(t *testing.T) {
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	When(client.UpdateStatus(repoModel, pullModel, "pending", "Plan Pending", "", "Atlantis")).ThenReturn(errors.New("timeout"))
+	s := server.GithubStatus{Client: client, Retries: 2, RetryDelay: time.Millisecond, CommentOnFailure: true}
+	err := s.Update(statusCtx(), server.Pending, server.PlanStep)
+	Equals(t, "timeout", err.Error())
+	client.VerifyWasCalled(Times(3)).UpdateStatus(repoModel, pullModel, "pending", "Plan Pending", "", "Atlantis")
+	client.VerifyWasCalledOnce().CreateComment(repoModel, pullModel, "**Warning**: Atlantis couldn't update the status of this pull request to `Plan Pending` so it may be out of date. Run the command again to retry.")
+}
+
+func TestUpdate_DoesNotRetryClientErrors(t *testing.T) {
+	t.Log("errors like a missing commit won't go away so shouldn't be retried")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	notFound := &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusNotFound}}
+	When(client.UpdateStatus(repoModel, pullModel, "pending", "Plan Pending", "", "Atlantis")).ThenReturn(notFound)
+	s := server.GithubStatus{Client: client, Retries: 3, RetryDelay: time.Millisecond}
+	err := s.Update(statusCtx(), server.Pending, server.PlanStep)
+	Assert(t, err != nil, "expected an error")
+	client.VerifyWasCalledOnce().UpdateStatus(repoModel, pullModel, "pending", "Plan Pending", "", "Atlantis")
+}
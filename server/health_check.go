@@ -0,0 +1,67 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// HealthCheck serves the liveness and readiness probes used by load balancers
+// and Kubernetes. Neither requires authentication.
+type HealthCheck struct {
+	// DataDir is where repos are cloned. Atlantis isn't ready unless it
+	// can write to it.
+	DataDir string
+}
+
+// healthStatus is the JSON body of the health check responses.
+type healthStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Healthz responds with 200 as long as the server is running. Since the
+// server only starts listening once it's initialized, ex. its GitHub client,
+// that's enough for a liveness probe.
+func (h *HealthCheck) Healthz(w http.ResponseWriter, r *http.Request) {
+	h.respond(w, http.StatusOK, healthStatus{Status: "ok"})
+}
+
+// Readyz responds with 200 if Atlantis can run commands, which requires that
+// the workspace under DataDir is writable, and 503 otherwise.
+func (h *HealthCheck) Readyz(w http.ResponseWriter, r *http.Request) {
+	if err := h.checkWritable(); err != nil {
+		h.respond(w, http.StatusServiceUnavailable, healthStatus{Status: "error", Error: err.Error()})
+		return
+	}
+	h.respond(w, http.StatusOK, healthStatus{Status: "ok"})
+}
+
+// checkWritable creates and removes a temp file in the directory repos are
+// cloned into.
+func (h *HealthCheck) checkWritable() error {
+	dir := filepath.Join(h.DataDir, workspacePrefix)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "creating %s", dir)
+	}
+	f, err := ioutil.TempFile(dir, ".readyz")
+	if err != nil {
+		return errors.Wrapf(err, "writing to %s", dir)
+	}
+	f.Close()
+	if err := os.Remove(f.Name()); err != nil {
+		return errors.Wrapf(err, "removing %s", f.Name())
+	}
+	return nil
+}
+
+func (h *HealthCheck) respond(w http.ResponseWriter, code int, status healthStatus) {
+	data, _ := json.Marshal(status)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(data)
+}
@@ -0,0 +1,46 @@
+package server_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hootsuite/atlantis/server"
+	. "github.com/hootsuite/atlantis/testing_util"
+)
+
+func TestHealthz(t *testing.T) {
+	h := server.HealthCheck{DataDir: "/does/not/exist"}
+	w := httptest.NewRecorder()
+	h.Healthz(w, httptest.NewRequest("GET", "/healthz", nil))
+	Equals(t, http.StatusOK, w.Code)
+	Equals(t, "application/json", w.Header().Get("Content-Type"))
+	Equals(t, `{"status":"ok"}`, w.Body.String())
+}
+
+func TestReadyz(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	t.Log("a writable data dir should be ready and the temp file removed")
+	h := server.HealthCheck{DataDir: dir}
+	w := httptest.NewRecorder()
+	h.Readyz(w, httptest.NewRequest("GET", "/readyz", nil))
+	Equals(t, http.StatusOK, w.Code)
+	Equals(t, `{"status":"ok"}`, w.Body.String())
+	files, err := ioutil.ReadDir(filepath.Join(dir, "repos"))
+	Ok(t, err)
+	Equals(t, 0, len(files))
+
+	t.Log("a data dir that can't be written to shouldn't be ready")
+	file := filepath.Join(dir, "file")
+	Ok(t, ioutil.WriteFile(file, []byte(""), 0644))
+	h = server.HealthCheck{DataDir: file}
+	w = httptest.NewRecorder()
+	h.Readyz(w, httptest.NewRequest("GET", "/readyz", nil))
+	Equals(t, http.StatusServiceUnavailable, w.Code)
+}
@@ -1,6 +1,10 @@
 package server
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+
 	"github.com/hootsuite/atlantis/github"
 	"github.com/spf13/viper"
 )
@@ -9,34 +13,114 @@ type HelpExecutor struct {
 	Github github.Client
 }
 
-var helpComment = "```cmake\n" +
-	`atlantis - Terraform collaboration tool that enables you to collaborate on infrastructure
+// CommandUsage describes how to use a command in the help comment.
+type CommandUsage struct {
+	Name CommandName
+	// Description is a one line summary of what the command does
+	Description string
+	// Flags are usage snippets of the arguments and flags the command
+	// takes, ex. [-target=address]
+	Flags []string
+}
+
+// commandUsages are the usages registered with registerCommandUsage by
+// command name.
+var commandUsages = make(map[CommandName]CommandUsage)
+
+// registerCommandUsage adds usage to the help comment. Each command registers
+// its own usage next to the code that runs it so help lists every command.
+func registerCommandUsage(usage CommandUsage) {
+	commandUsages[usage.Name] = usage
+}
+
+func init() {
+	registerCommandUsage(CommandUsage{Name: Help, Description: "Get help"})
+}
+
+// helpUsageIndent is how far the descriptions and flags of each command are
+// indented so they line up after the longest command name.
+const helpUsageIndent = 15
+
+// helpComment returns the help comment listing the registered commands in
+// alphabetical order.
+func helpComment() string {
+	var usages []CommandUsage
+	for _, usage := range commandUsages {
+		usages = append(usages, usage)
+	}
+	sort.Slice(usages, func(i, j int) bool { return usages[i].Name.String() < usages[j].Name.String() })
+	var commands []string
+	for _, usage := range usages {
+		commands = append(commands, fmt.Sprintf("%-*s%s", helpUsageIndent, usage.Name, usage.Description))
+		if len(usage.Flags) > 0 {
+			commands = append(commands, strings.Repeat(" ", helpUsageIndent)+strings.Join(usage.Flags, " "))
+		}
+	}
+	return "```cmake\n" +
+		`atlantis - Terraform collaboration tool that enables you to collaborate on infrastructure
 safely and securely. (v` + viper.GetString("version") + `)
 
-Usage: atlantis <command> [environment] [--verbose]
+Usage: atlantis <command> [environment] [flags] [--verbose]
 
 Commands:
-plan           Runs 'terraform plan' on the files changed in the pull request
-apply          Runs 'terraform apply' using the plans generated by 'atlantis plan'
-help           Get help
+` + strings.Join(commands, "\n") + `
 
 Examples:
+` + helpExamples
+}
 
+// helpExamples are the examples at the end of the help comment.
+const helpExamples = `
 # Generates a plan for staging environment
 atlantis plan staging
 
 # Generates a plan for a standalone terraform project
 atlantis plan
 
+# Generates a plan for the existing staging workspace
+atlantis plan -w staging
+
+# Generates a plan for every environment of each project
+atlantis plan --all-envs
+
+# Generates a plan for the staging and prod environments in one comment
+atlantis plan -e staging,prod
+
+# Generates a plan for every project in the repo, not just the changed ones
+atlantis plan staging --all
+
+# Generates a plan for only the security groups in the staging environment
+atlantis plan staging --target-type aws_security_group
+
+# Generates a plan for staging environment with another var file from the project
+atlantis plan staging -var-file=env/staging-us.tfvars
+
+# Generates a plan for staging environment in a different AWS region
+# (AWS_REGION must be in the project's allowed_env_vars)
+atlantis plan staging --env AWS_REGION=us-west-2
+
 # Applies a plan for staging environment
 atlantis apply staging
 
+# Applies a plan for staging environment with fewer concurrent operations
+# to stay under the provider's rate limits
+atlantis apply staging -parallelism=2
+
 # Applies a plan for a standalone terraform project
 atlantis apply
-`
+
+# Destroys everything in the review environment of the changed projects
+atlantis destroy review
+
+# Releases the lock on the staging environment left by a stuck command
+atlantis unlock staging
+
+# Generates a plan for a pull request from an untrusted fork once you've reviewed it
+atlantis plan --trust
+` + "```"
 
 func (h *HelpExecutor) Execute(ctx *CommandContext) {
 	ctx.Log.Info("generating help comment....")
-	h.Github.CreateComment(ctx.BaseRepo, ctx.Pull, helpComment)
+	h.Github.CreateComment(ctx.BaseRepo, ctx.Pull, helpComment())
 	return
 }
@@ -3,12 +3,14 @@ package server_test
 import (
 	"log"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/hootsuite/atlantis/github/mocks"
 	"github.com/hootsuite/atlantis/logging"
 	"github.com/hootsuite/atlantis/models"
 	"github.com/hootsuite/atlantis/server"
+	. "github.com/hootsuite/atlantis/testing_util"
 	. "github.com/petergtz/pegomock"
 )
 
@@ -26,6 +28,26 @@ func TestExecute(t *testing.T) {
 	client.VerifyWasCalledOnce().CreateComment(EqRepo(ctx.BaseRepo), EqPull(ctx.Pull), AnyString())
 }
 
+func TestExecute_ListsCommands(t *testing.T) {
+	t.Log("every command should be listed with its flags in alphabetical order")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	h := server.HelpExecutor{client}
+	h.Execute(&server.CommandContext{Log: logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug)})
+
+	_, _, comment := client.VerifyWasCalledOnce().CreateComment(AnyRepo(), AnyPullRequest(), AnyString()).GetCapturedArguments()
+	last := -1
+	for _, name := range []string{"apply", "destroy", "help", "plan", "state rm", "unlock", "workspaces"} {
+		i := strings.Index(comment, "\n"+name+" ")
+		Assert(t, i > last, "expected %s to be listed after the previous command in %q", name, comment)
+		last = i
+	}
+	Assert(t, strings.Contains(comment, "\nplan           Runs 'terraform plan' on the projects changed in the pull request, or on every project with --all\n"+
+		"               [environment | -e env,env... | -w workspace | --all-envs] [--all | --changed | -d dir] [--target-type type] [-target=address] [-var-file=path]"), "expected plan's usage in %q", comment)
+	Assert(t, strings.Contains(comment, "\nhelp           Get help\nplan "), "expected help without flags in %q", comment)
+	Assert(t, strings.HasSuffix(comment, "```"), "expected the code block to be closed in %q", comment)
+}
+
 func EqRepo(value models.Repo) models.Repo {
 	RegisterMatcher(&EqMatcher{Value: value})
 	return models.Repo{}
@@ -0,0 +1,39 @@
+package server
+
+import "sync"
+
+// maintenanceComment is commented on pull requests when a command is rejected
+// because Atlantis is in maintenance mode
+const maintenanceComment = "Atlantis is in maintenance, try again shortly."
+
+// MaintenanceMode rejects all commands while it's enabled so Atlantis can be
+// upgraded or otherwise maintained without users triggering runs that fail
+// part way through. It can be toggled while Atlantis is running.
+// A nil MaintenanceMode is never enabled.
+type MaintenanceMode struct {
+	mutex   sync.RWMutex
+	enabled bool
+}
+
+// NewMaintenanceMode returns a MaintenanceMode that starts out enabled if
+// enabled is true.
+func NewMaintenanceMode(enabled bool) *MaintenanceMode {
+	return &MaintenanceMode{enabled: enabled}
+}
+
+// Enabled returns true if commands should be rejected.
+func (m *MaintenanceMode) Enabled() bool {
+	if m == nil {
+		return false
+	}
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.enabled
+}
+
+// Set enables or disables maintenance mode.
+func (m *MaintenanceMode) Set(enabled bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.enabled = enabled
+}
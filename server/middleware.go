@@ -1,6 +1,7 @@
 package server
 
 import (
+	"crypto/subtle"
 	"net/http"
 
 	"strings"
@@ -25,3 +26,67 @@ func (l *RequestLogger) ServeHTTP(rw http.ResponseWriter, r *http.Request, next
 		l.logger.Info("%d | %s %s", res.Status(), r.Method, r.URL.RequestURI())
 	}
 }
+
+// unauthenticatedPaths are the paths that never require authentication. The
+// events endpoint is called by GitHub and is protected by the webhook secret
+// instead, the health checks are called by load balancers and static assets
+// don't contain anything sensitive.
+var unauthenticatedPaths = []string{"/events", "/healthz", "/readyz"}
+
+// Authenticator requires requests to authenticate with basic auth using
+// Username and Password, or with APIToken as a bearer token in the
+// Authorization header, ex. "Authorization: Bearer {token}". If neither are
+// configured, all requests are allowed.
+type Authenticator struct {
+	Username string
+	Password string
+	APIToken string
+}
+
+func (a *Authenticator) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if a.Password == "" && a.APIToken == "" || a.unauthenticated(r.URL.Path) || a.authenticated(r) {
+		next(rw, r)
+		return
+	}
+	if a.Password != "" {
+		rw.Header().Set("WWW-Authenticate", `Basic realm="Atlantis"`)
+	}
+	http.Error(rw, "Unauthorized", http.StatusUnauthorized)
+}
+
+func (a *Authenticator) unauthenticated(path string) bool {
+	if strings.HasPrefix(path, "/static/") {
+		return true
+	}
+	for _, p := range unauthenticatedPaths {
+		if path == p {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticated returns true if r has valid credentials. The credentials are
+// compared in constant time so they can't be guessed by timing requests.
+func (a *Authenticator) authenticated(r *http.Request) bool {
+	if a.APIToken != "" {
+		auth := r.Header.Get("Authorization")
+		if strings.HasPrefix(auth, "Bearer ") && secureCompare(strings.TrimPrefix(auth, "Bearer "), a.APIToken) {
+			return true
+		}
+	}
+	if a.Password != "" {
+		username, password, ok := r.BasicAuth()
+		// check both so the time taken doesn't reveal if the username was right
+		usernameOK := secureCompare(username, a.Username)
+		passwordOK := secureCompare(password, a.Password)
+		if ok && usernameOK && passwordOK {
+			return true
+		}
+	}
+	return false
+}
+
+func secureCompare(given string, expected string) bool {
+	return subtle.ConstantTimeCompare([]byte(given), []byte(expected)) == 1
+}
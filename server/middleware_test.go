@@ -0,0 +1,58 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hootsuite/atlantis/server"
+	. "github.com/hootsuite/atlantis/testing_util"
+)
+
+func TestAuthenticator(t *testing.T) {
+	a := &server.Authenticator{Username: "user", Password: "pass", APIToken: "token"}
+	cases := []struct {
+		Description string
+		Path        string
+		Username    string
+		Password    string
+		Bearer      string
+		ExpCode     int
+	}{
+		{"no credentials", "/", "", "", "", http.StatusUnauthorized},
+		{"basic auth", "/", "user", "pass", "", http.StatusOK},
+		{"wrong password", "/", "user", "wrong", "", http.StatusUnauthorized},
+		{"wrong username", "/", "wrong", "pass", "", http.StatusUnauthorized},
+		{"api token", "/api/locks", "", "", "token", http.StatusOK},
+		{"wrong api token", "/api/locks", "", "", "wrong", http.StatusUnauthorized},
+		{"events", "/events", "", "", "", http.StatusOK},
+		{"healthz", "/healthz", "", "", "", http.StatusOK},
+		{"readyz", "/readyz", "", "", "", http.StatusOK},
+		{"static", "/static/atlantis-icon.png", "", "", "", http.StatusOK},
+	}
+	for _, c := range cases {
+		t.Log("testing " + c.Description)
+		req, _ := http.NewRequest("GET", c.Path, nil)
+		if c.Username != "" {
+			req.SetBasicAuth(c.Username, c.Password)
+		}
+		if c.Bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+c.Bearer)
+		}
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, req, func(w http.ResponseWriter, r *http.Request) {})
+		Equals(t, c.ExpCode, w.Code)
+		if c.ExpCode == http.StatusUnauthorized {
+			Equals(t, `Basic realm="Atlantis"`, w.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestAuthenticator_NotConfigured(t *testing.T) {
+	t.Log("if no credentials are configured all requests are allowed")
+	a := &server.Authenticator{}
+	req, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, req, func(w http.ResponseWriter, r *http.Request) {})
+	Equals(t, http.StatusOK, w.Code)
+}
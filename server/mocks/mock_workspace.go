@@ -50,6 +50,22 @@ func (mock *MockWorkspace) GetWorkspace(ctx *server.CommandContext) (string, err
 	return ret0, ret1
 }
 
+func (mock *MockWorkspace) PlannedCommit(repoDir string) (string, error) {
+	params := []pegomock.Param{repoDir}
+	result := pegomock.GetGenericMockFrom(mock).Invoke("PlannedCommit", params, []reflect.Type{reflect.TypeOf((*string)(nil)).Elem(), reflect.TypeOf((*error)(nil)).Elem()})
+	var ret0 string
+	var ret1 error
+	if len(result) != 0 {
+		if result[0] != nil {
+			ret0 = result[0].(string)
+		}
+		if result[1] != nil {
+			ret1 = result[1].(error)
+		}
+	}
+	return ret0, ret1
+}
+
 func (mock *MockWorkspace) Delete(repo models.Repo, pull models.PullRequest) error {
 	params := []pegomock.Param{repo, pull}
 	result := pegomock.GetGenericMockFrom(mock).Invoke("Delete", params, []reflect.Type{reflect.TypeOf((*error)(nil)).Elem()})
@@ -134,6 +150,33 @@ func (c *Workspace_GetWorkspace_OngoingVerification) GetAllCapturedArguments() (
 	return
 }
 
+func (verifier *VerifierWorkspace) PlannedCommit(repoDir string) *Workspace_PlannedCommit_OngoingVerification {
+	params := []pegomock.Param{repoDir}
+	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "PlannedCommit", params)
+	return &Workspace_PlannedCommit_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
+}
+
+type Workspace_PlannedCommit_OngoingVerification struct {
+	mock              *MockWorkspace
+	methodInvocations []pegomock.MethodInvocation
+}
+
+func (c *Workspace_PlannedCommit_OngoingVerification) GetCapturedArguments() string {
+	repoDir := c.GetAllCapturedArguments()
+	return repoDir[len(repoDir)-1]
+}
+
+func (c *Workspace_PlannedCommit_OngoingVerification) GetAllCapturedArguments() (_param0 []string) {
+	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
+	if len(params) > 0 {
+		_param0 = make([]string, len(params[0]))
+		for u, param := range params[0] {
+			_param0[u] = param.(string)
+		}
+	}
+	return
+}
+
 func (verifier *VerifierWorkspace) Delete(repo models.Repo, pull models.PullRequest) *Workspace_Delete_OngoingVerification {
 	params := []pegomock.Param{repo, pull}
 	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "Delete", params)
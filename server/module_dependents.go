@@ -0,0 +1,75 @@
+package server
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/hootsuite/atlantis/logging"
+	"github.com/hootsuite/atlantis/models"
+	"github.com/hootsuite/atlantis/terraform"
+)
+
+// ModuleDependents finds the projects that call local modules modified by a
+// pull request, ex. ../modules/vpc, so they're planned even if none of their
+// own files were modified. A nil ModuleDependents finds none.
+type ModuleDependents struct{}
+
+// Projects returns the projects in candidates that call a module, directly or
+// through other local modules, that has one of modifiedFiles. The paths of
+// candidates and modifiedFiles are relative to the repo cloned into cloneDir.
+// Projects whose .tf files can't be parsed are logged and left out.
+func (m *ModuleDependents) Projects(log *logging.SimpleLogger, cloneDir string, candidates []models.Project, modifiedFiles []string) []models.Project {
+	if m == nil || len(modifiedFiles) == 0 {
+		return nil
+	}
+	// the local modules of each directory are cached since projects often
+	// share them
+	dirModules := make(map[string][]string)
+	var dependents []models.Project
+	for _, project := range candidates {
+		module := m.modifiedModule(log, cloneDir, project.Path, modifiedFiles, dirModules, make(map[string]bool))
+		if module != "" {
+			log.Info("planning %s since it uses the modified module in %s", project.Path, module)
+			dependents = append(dependents, project)
+		}
+	}
+	return dependents
+}
+
+// modifiedModule returns the directory of the first module called from dir,
+// directly or through other local modules, that has one of modifiedFiles, or
+// "" if there isn't one. visited are the directories already checked.
+func (m *ModuleDependents) modifiedModule(log *logging.SimpleLogger, cloneDir string, dir string, modifiedFiles []string, dirModules map[string][]string, visited map[string]bool) string {
+	visited[dir] = true
+	modules, ok := dirModules[dir]
+	if !ok {
+		sources, err := terraform.LocalModules(filepath.Join(cloneDir, filepath.FromSlash(dir)))
+		if err != nil {
+			log.Warn("finding the modules %s uses so not planning it for them: %s", dir, err)
+		}
+		for _, source := range sources {
+			module := path.Join(dir, filepath.ToSlash(source))
+			// modules outside the repo can't be modified by the pull request
+			if module == ".." || strings.HasPrefix(module, "../") {
+				continue
+			}
+			modules = append(modules, module)
+		}
+		dirModules[dir] = modules
+	}
+	for _, module := range modules {
+		if visited[module] {
+			continue
+		}
+		for _, file := range modifiedFiles {
+			if module == "." || strings.HasPrefix(file, module+"/") {
+				return module
+			}
+		}
+		if nested := m.modifiedModule(log, cloneDir, module, modifiedFiles, dirModules, visited); nested != "" {
+			return nested
+		}
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hootsuite/atlantis/github"
+	"github.com/hootsuite/atlantis/models"
+	"github.com/pkg/errors"
+)
+
+// OutputGists uploads the output of projects that's too large to comment as
+// secret gists so the comment can link to it with just the summary inline.
+// The gists are deleted when the pull request is closed.
+type OutputGists struct {
+	Github github.Client
+	// Threshold is how long a project's output can be before it's
+	// uploaded. If it's 0, output is never uploaded.
+	Threshold int
+	// Redactor redacts sensitive values from the output before it's
+	// uploaded. If it's nil, nothing is redacted.
+	Redactor *OutputRedactor
+}
+
+// Upload uploads the output of each of res's projects that's longer than
+// Threshold and sets its OutputURL. If an upload fails the output is
+// commented as usual.
+func (o *OutputGists) Upload(ctx *CommandContext, res *CommandResponse) {
+	// gists are on GitHub so output on other hosts is always commented
+	if o == nil || o.Threshold <= 0 || ctx.BaseRepo.VCSHost != models.Github {
+		return
+	}
+	for i, result := range res.ProjectResults {
+		output := o.Redactor.Redact(result.Output())
+		if len(output) <= o.Threshold {
+			continue
+		}
+		env := ctx.Command.Environment
+		if result.Environment != "" {
+			env = result.Environment
+		}
+		description := fmt.Sprintf("%s%s in the %s environment of %s/", o.descriptionPrefix(ctx.BaseRepo, ctx.Pull), res.Command, env, result.Path)
+		url, err := o.Github.CreateGist(description, res.Command.String()+".diff", output)
+		if err != nil {
+			ctx.Log.Warn("uploading output of %s as a gist: %s", result.Path, err)
+			continue
+		}
+		ctx.Log.Info("uploaded %d characters of output of %s to %s", len(output), result.Path, url)
+		res.ProjectResults[i].OutputURL = url
+	}
+}
+
+// Delete deletes the gists of pull's output.
+func (o *OutputGists) Delete(repo models.Repo, pull models.PullRequest) error {
+	if o == nil || o.Threshold <= 0 {
+		return nil
+	}
+	gists, err := o.Github.GetGists()
+	if err != nil {
+		return errors.Wrap(err, "getting gists")
+	}
+	prefix := o.descriptionPrefix(repo, pull)
+	for _, gist := range gists {
+		if !strings.HasPrefix(gist.GetDescription(), prefix) {
+			continue
+		}
+		if err := o.Github.DeleteGist(gist.GetID()); err != nil {
+			return errors.Wrapf(err, "deleting gist %s", gist.GetID())
+		}
+	}
+	return nil
+}
+
+// descriptionPrefix returns how the descriptions of pull's gists start, so
+// they can be found again once the pull request is closed.
+func (o *OutputGists) descriptionPrefix(repo models.Repo, pull models.PullRequest) string {
+	return fmt.Sprintf("Atlantis output for %s#%d: ", repo.FullName, pull.Num)
+}
@@ -0,0 +1,97 @@
+package server_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/hootsuite/atlantis/github/mocks"
+	"github.com/hootsuite/atlantis/models/fixtures"
+	"github.com/hootsuite/atlantis/server"
+	. "github.com/hootsuite/atlantis/testing_util"
+	. "github.com/petergtz/pegomock"
+)
+
+func TestOutputGists_Upload(t *testing.T) {
+	t.Log("only output longer than the threshold should be uploaded")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	g := server.OutputGists{Github: client, Threshold: 5}
+	ctx := reactionsCtx(1)
+	ctx.Command = &server.Command{Name: server.Plan, Environment: "staging"}
+	res := server.CommandResponse{Command: server.Plan, ProjectResults: []server.ProjectResult{
+		{Path: "short", PlanSuccess: &server.PlanSuccess{TerraformOutput: "short"}},
+		{Path: "long", PlanSuccess: &server.PlanSuccess{TerraformOutput: "long output"}},
+		{Path: "failed", Failure: "a long failure"},
+	}}
+	When(client.CreateGist("Atlantis output for hootsuite/atlantis#1: plan in the staging environment of long/", "plan.diff", "long output")).
+		ThenReturn("https://gist.github.com/1", nil)
+
+	g.Upload(ctx, &res)
+	Equals(t, "", res.ProjectResults[0].OutputURL)
+	Equals(t, "https://gist.github.com/1", res.ProjectResults[1].OutputURL)
+	Equals(t, "", res.ProjectResults[2].OutputURL)
+	client.VerifyWasCalledOnce().CreateGist(AnyString(), AnyString(), AnyString())
+}
+
+func TestOutputGists_UploadError(t *testing.T) {
+	t.Log("output that can't be uploaded should be commented as usual")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	g := server.OutputGists{Github: client, Threshold: 1}
+	ctx := reactionsCtx(1)
+	ctx.Command = &server.Command{Name: server.Apply, Environment: "default"}
+	res := server.CommandResponse{Command: server.Apply, ProjectResults: []server.ProjectResult{{Path: "path", ApplySuccess: "output"}}}
+	When(client.CreateGist(AnyString(), AnyString(), AnyString())).ThenReturn("", errors.New("err"))
+
+	g.Upload(ctx, &res)
+	Equals(t, "", res.ProjectResults[0].OutputURL)
+}
+
+func TestOutputGists_UploadRedacts(t *testing.T) {
+	t.Log("sensitive values should be redacted before the output is uploaded")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	redactor, err := server.NewOutputRedactor("password")
+	Ok(t, err)
+	g := server.OutputGists{Github: client, Threshold: 1, Redactor: redactor}
+	ctx := reactionsCtx(1)
+	ctx.Command = &server.Command{Name: server.Plan, Environment: "default"}
+	res := server.CommandResponse{Command: server.Plan, ProjectResults: []server.ProjectResult{
+		{Path: "path", PlanSuccess: &server.PlanSuccess{TerraformOutput: `password: "hunter2"`}},
+	}}
+
+	g.Upload(ctx, &res)
+	client.VerifyWasCalledOnce().CreateGist(AnyString(), AnyString(), EqString(`password: "<redacted>"`))
+}
+
+func TestOutputGists_Disabled(t *testing.T) {
+	t.Log("nothing should be uploaded or deleted without a threshold")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	g := server.OutputGists{Github: client}
+	ctx := reactionsCtx(1)
+	ctx.Command = &server.Command{Name: server.Plan}
+	res := server.CommandResponse{Command: server.Plan, ProjectResults: []server.ProjectResult{{Path: "path", ApplySuccess: "output"}}}
+
+	g.Upload(ctx, &res)
+	Ok(t, g.Delete(fixtures.Repo, fixtures.Pull))
+	client.VerifyWasCalled(Never()).CreateGist(AnyString(), AnyString(), AnyString())
+	client.VerifyWasCalled(Never()).GetGists()
+}
+
+func TestOutputGists_Delete(t *testing.T) {
+	t.Log("only the gists of the pull request should be deleted")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	g := server.OutputGists{Github: client, Threshold: 1}
+	When(client.GetGists()).ThenReturn([]*github.Gist{
+		{ID: github.String("1"), Description: github.String("Atlantis output for hootsuite/atlantis#1: plan in the default environment of path/")},
+		{ID: github.String("2"), Description: github.String("Atlantis output for hootsuite/atlantis#12: plan in the default environment of path/")},
+		{ID: github.String("3"), Description: github.String("notes")},
+	}, nil)
+
+	Ok(t, g.Delete(fixtures.Repo, fixtures.Pull))
+	client.VerifyWasCalledOnce().DeleteGist("1")
+	client.VerifyWasCalledOnce().DeleteGist(AnyString())
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// attributeLineRegex matches a line of plan or apply output that sets an
+// attribute, ex. `  + password = "hunter2"` or `  password: "" => "hunter2"`.
+// The groups are everything before the value, the attribute's name and the
+// value.
+var attributeLineRegex = regexp.MustCompile(`^(\s*(?:[-+~]|-/\+|\+/-)?\s*"?([A-Za-z0-9_.\-\[\]%#]+)"?\s*[:=]\s*)(.+)$`)
+
+// keyValueRegex matches the key=value pairs in commands and logs, ex.
+// -var 'db_password=hunter2'. The groups are everything before the value, the
+// key and the value.
+var keyValueRegex = regexp.MustCompile(`((?:^|[\s'"])([A-Za-z0-9_.\-]+)=)("[^"]*"|'[^']*'|[^\s'"]+)`)
+
+// quotedRegex matches the quoted strings in a value.
+var quotedRegex = regexp.MustCompile(`"(?:[^"\\]|\\.)*"`)
+
+// OutputRedactor replaces the values of sensitive attributes and variables
+// in terraform output and logs with <redacted> before they're commented.
+type OutputRedactor struct {
+	// keys match the names of the attributes and variables to redact
+	keys []*regexp.Regexp
+}
+
+// NewOutputRedactor returns an OutputRedactor that redacts the attributes and
+// variables whose names match one of keys, a comma separated list of regular
+// expressions, ex. "password,.*_token". They must match the whole name, or
+// the last part of a name like tags.password, and are case insensitive.
+func NewOutputRedactor(keys string) (*OutputRedactor, error) {
+	r := &OutputRedactor{}
+	for _, key := range strings.Split(keys, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		re, err := regexp.Compile(fmt.Sprintf("(?i)^(?:%s)$", key))
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing %q", key)
+		}
+		r.keys = append(r.keys, re)
+	}
+	return r, nil
+}
+
+// Redact returns s with the values of sensitive attributes and variables
+// replaced. A nil OutputRedactor or one without keys returns s as is.
+func (r *OutputRedactor) Redact(s string) string {
+	if r == nil || len(r.keys) == 0 || s == "" {
+		return s
+	}
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if match := attributeLineRegex.FindStringSubmatch(line); match != nil && r.sensitive(match[2]) {
+			lines[i] = match[1] + r.redactValue(match[3])
+			continue
+		}
+		lines[i] = keyValueRegex.ReplaceAllStringFunc(line, func(pair string) string {
+			match := keyValueRegex.FindStringSubmatch(pair)
+			if !r.sensitive(match[2]) {
+				return pair
+			}
+			return match[1] + redactedSecret
+		})
+	}
+	return strings.Join(lines, "\n")
+}
+
+// RedactResult returns result with the values of sensitive attributes and
+// variables replaced in its output, failure and error.
+func (r *OutputRedactor) RedactResult(result ProjectResult) ProjectResult {
+	if r == nil || len(r.keys) == 0 {
+		return result
+	}
+	if result.PlanSuccess != nil {
+		planSuccess := *result.PlanSuccess
+		planSuccess.TerraformOutput = r.Redact(planSuccess.TerraformOutput)
+		result.PlanSuccess = &planSuccess
+	}
+	result.ApplySuccess = r.Redact(result.ApplySuccess)
+	result.DestroySuccess = r.Redact(result.DestroySuccess)
+	result.StateRmSuccess = r.Redact(result.StateRmSuccess)
+	result.Failure = r.Redact(result.Failure)
+	result.HookOutput = r.Redact(result.HookOutput)
+	if result.Error != nil {
+		result.Error = errors.New(r.Redact(result.Error.Error()))
+	}
+	return result
+}
+
+// sensitive returns true if the attribute or variable called name should be
+// redacted.
+func (r *OutputRedactor) sensitive(name string) bool {
+	name = strings.Trim(name, `"`)
+	last := name
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		last = name[i+1:]
+	}
+	for _, key := range r.keys {
+		if key.MatchString(name) || key.MatchString(last) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactValue redacts the quoted strings in value, ex. both sides of
+// "old" => "new", or all of it if nothing's quoted. Values that open a block
+// are left so the output's structure is kept.
+func (r *OutputRedactor) redactValue(value string) string {
+	trimmed := strings.TrimSpace(value)
+	if trimmed == "{" || trimmed == "[" || trimmed == "(" {
+		return value
+	}
+	if quotedRegex.MatchString(value) {
+		return quotedRegex.ReplaceAllString(value, `"`+redactedSecret+`"`)
+	}
+	return redactedSecret
+}
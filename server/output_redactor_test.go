@@ -0,0 +1,95 @@
+package server_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hootsuite/atlantis/server"
+	. "github.com/hootsuite/atlantis/testing_util"
+)
+
+func TestNewOutputRedactor_InvalidKey(t *testing.T) {
+	_, err := server.NewOutputRedactor("password,(")
+	Assert(t, err != nil, "expected an error")
+}
+
+func TestRedact_PlanOutput(t *testing.T) {
+	r, err := server.NewOutputRedactor("password, .*_token")
+	Ok(t, err)
+
+	t.Log("the values of sensitive attributes should be redacted in terraform 0.11 plans")
+	plan := `+ aws_db_instance.db
+      id:                <computed>
+      master_password:   "hunter2"
+      name:              "db"
+      password:          "" => "hunter2"
+      tags.%:            "1"
+      tags.api_token:    "abc123"
+Plan: 1 to add, 0 to change, 0 to destroy.`
+	Equals(t, `+ aws_db_instance.db
+      id:                <computed>
+      master_password:   "hunter2"
+      name:              "db"
+      password:          "<redacted>" => "<redacted>"
+      tags.%:            "1"
+      tags.api_token:    "<redacted>"
+Plan: 1 to add, 0 to change, 0 to destroy.`, r.Redact(plan))
+
+	t.Log("and in terraform 0.12 plans")
+	plan = `  # aws_db_instance.db will be updated in-place
+  ~ resource "aws_db_instance" "db" {
+      ~ password   = "old" -> "new"
+      + "password" = (known after apply)
+        name       = "db"
+      ~ github_token = {
+        }
+    }`
+	Equals(t, `  # aws_db_instance.db will be updated in-place
+  ~ resource "aws_db_instance" "db" {
+      ~ password   = "<redacted>" -> "<redacted>"
+      + "password" = <redacted>
+        name       = "db"
+      ~ github_token = {
+        }
+    }`, r.Redact(plan))
+}
+
+func TestRedact_Log(t *testing.T) {
+	t.Log("key=value pairs like variables in commands should be redacted")
+	r, err := server.NewOutputRedactor("db_password")
+	Ok(t, err)
+	Equals(t,
+		`[INFO] successfully ran "sh -c terraform plan -var DB_PASSWORD=<redacted> -var user=me" in "/repo"`,
+		r.Redact(`[INFO] successfully ran "sh -c terraform plan -var DB_PASSWORD=hunter2 -var user=me" in "/repo"`))
+	Equals(t,
+		`[INFO] Running "terraform plan -var 'db_password=<redacted>' -var user=me"`,
+		r.Redact(`[INFO] Running "terraform plan -var 'db_password=hunter2' -var user=me"`))
+}
+
+func TestRedact_NoKeys(t *testing.T) {
+	t.Log("without keys nothing should be redacted")
+	var nilRedactor *server.OutputRedactor
+	Equals(t, `password = "hunter2"`, nilRedactor.Redact(`password = "hunter2"`))
+	r, err := server.NewOutputRedactor("")
+	Ok(t, err)
+	Equals(t, `password = "hunter2"`, r.Redact(`password = "hunter2"`))
+}
+
+func TestRedactResult(t *testing.T) {
+	r, err := server.NewOutputRedactor("password")
+	Ok(t, err)
+	planSuccess := &server.PlanSuccess{TerraformOutput: `password: "hunter2"`, LockURL: "lock-url"}
+	result := r.RedactResult(server.ProjectResult{
+		Path:        "path",
+		PlanSuccess: planSuccess,
+		Failure:     "password=hunter2",
+		Error:       errors.New(`password = "hunter2"`),
+	})
+	Equals(t, &server.PlanSuccess{TerraformOutput: `password: "<redacted>"`, LockURL: "lock-url"}, result.PlanSuccess)
+	Equals(t, "password=<redacted>", result.Failure)
+	Equals(t, `password = "<redacted>"`, result.Error.Error())
+	Equals(t, "path", result.Path)
+
+	t.Log("the original result shouldn't be changed")
+	Equals(t, `password: "hunter2"`, planSuccess.TerraformOutput)
+}
@@ -5,11 +5,15 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	version "github.com/hashicorp/go-version"
 	"github.com/hootsuite/atlantis/github"
 	"github.com/hootsuite/atlantis/locking"
+	"github.com/hootsuite/atlantis/metrics"
 	"github.com/hootsuite/atlantis/models"
 	"github.com/hootsuite/atlantis/run"
 	"github.com/hootsuite/atlantis/terraform"
@@ -18,6 +22,13 @@ import (
 
 //go:generate pegomock generate --use-experimental-model-gen --package mocks -o mocks/mock_planner.go Planner
 
+const (
+	// AllProjectsScope plans every project in the repo
+	AllProjectsScope = "all"
+	// ChangedProjectsScope only plans the projects modified by the pull request
+	ChangedProjectsScope = "changed"
+)
+
 // todo: would like to use the Executor interface but need to find a way
 // to deal with the SetLockURL function
 type Planner interface {
@@ -27,6 +38,14 @@ type Planner interface {
 	SetLockURL(func(id string) (url string))
 }
 
+func init() {
+	registerCommandUsage(CommandUsage{
+		Name:        Plan,
+		Description: "Runs 'terraform plan' on the projects changed in the pull request, or on every project with --all",
+		Flags:       []string{"[environment | -e env,env... | -w workspace | --all-envs]", "[--all | --changed | -d dir]", "[--target-type type]", "[-target=address]", "[-var-file=path]", "[--env KEY=value]", "[-parallelism=n]", "[-lock-timeout=duration]", "[--fmt-check]", "[--trust]"},
+	})
+}
+
 // PlanExecutor handles everything related to running terraform plan
 // including integration with S3, Terraform, and GitHub
 type PlanExecutor struct {
@@ -41,6 +60,46 @@ type PlanExecutor struct {
 	configReader          *ConfigReader
 	concurrentRunLocker   *ConcurrentRunLocker
 	workspace             Workspace
+	workspaceDiscovery    *WorkspaceDiscovery
+	commentReactions      *CommentReactions
+	resultComments        *ResultComments
+	outputGists           *OutputGists
+	projectDurations      *metrics.HistogramVec
+	resultsStore          *ResultsStore
+	pullLabels            *PullLabels
+	projectFinder         *ProjectFinder
+	terraformFlagPolicy   *TerraformFlagPolicy
+	// requireConfiguredEnvs is true if plan should fail for environments
+	// that have neither an env/{env}.tfvars file nor an existing workspace
+	requireConfiguredEnvs bool
+	// defaultPlanScope is AllProjectsScope or ChangedProjectsScope and is
+	// used if neither the comment nor the repo's config set the scope
+	defaultPlanScope string
+	// commentOnAutoplanSkip is true if automatic plans of pull requests that
+	// don't modify any Terraform files should comment like manual plans do.
+	// Otherwise they're skipped silently to keep the pull request quiet.
+	commentOnAutoplanSkip bool
+	// lockTimeout is the -lock-timeout to plan with if neither the comment
+	// nor the project's config set one
+	lockTimeout string
+	// parallelPlans is how many projects can be planned at the same time
+	parallelPlans int
+	// fmtCheck is true if every plan should check that the project's files
+	// are formatted, even if --fmt-check wasn't commented
+	fmtCheck bool
+	// queueTimeout is how long a plan waits for another command running in
+	// the same environment of the pull request to complete. If it's 0, the
+	// plan fails right away instead.
+	queueTimeout time.Duration
+	// planTimeout is how long terraform plan can run before it's stopped. If
+	// it's 0, it can run for as long as it needs.
+	planTimeout time.Duration
+	// moduleDependents finds the projects to plan because they use modules
+	// modified by the pull request. If it's nil, only modified projects are
+	// planned.
+	moduleDependents *ModuleDependents
+	// commandMetrics records how many plans ran and how long they took
+	commandMetrics *CommandMetrics
 }
 
 type PlanSuccess struct {
@@ -48,12 +107,38 @@ type PlanSuccess struct {
 	LockURL         string
 }
 
+// Summary returns how many resources the plan adds, changes and destroys, or
+// nil if they can't be parsed from its output.
+func (p PlanSuccess) Summary() *terraform.Summary {
+	return terraform.ParseSummary(p.TerraformOutput)
+}
+
 func (p *PlanExecutor) Execute(ctx *CommandContext) {
-	p.githubStatus.Update(ctx.BaseRepo, ctx.Pull, Pending, PlanStep)
-	res := p.setupAndPlan(ctx)
+	if ctx.Command.Autoplan && !p.commentOnAutoplanSkip && p.noTerraformModified(ctx) {
+		ctx.Log.Debug("skipping automatic plan since no Terraform files were modified")
+		return
+	}
+	start := time.Now()
+	p.githubStatus.Update(ctx, Pending, PlanStep)
+	p.resultComments.Acknowledge(ctx, Plan)
+	stopProgress := p.resultComments.TrackProgress(ctx, Plan)
+	res := runEnvs(ctx, p.setupAndPlan)
+	stopProgress()
+	if res.Error == nil && res.Failure == "" {
+		p.githubStatus.UpdateProjectResult(ctx, res.ProjectResults)
+	}
 	res.Command = Plan
+	res.Environment = ctx.Command.Environment
+	res.Dir = ctx.Command.Dir
+	p.outputGists.Upload(ctx, &res)
 	comment := p.githubCommentRenderer.Render(res, ctx.Log.History.String(), ctx.Command.Verbose)
-	p.github.CreateComment(ctx.BaseRepo, ctx.Pull, comment)
+	p.resultComments.Create(ctx, Plan, comment)
+	if err := p.resultsStore.Save(ctx, Plan, res); err != nil {
+		ctx.Log.Err("saving results: %s", err)
+	}
+	p.commandMetrics.Record(ctx, Plan, res, time.Since(start))
+	p.commentReactions.Done(ctx, res)
+	p.pullLabels.Update(ctx, Plan, res)
 }
 
 func (p *PlanExecutor) SetLockURL(f func(id string) (url string)) {
@@ -61,46 +146,428 @@ func (p *PlanExecutor) SetLockURL(f func(id string) (url string)) {
 }
 
 func (p *PlanExecutor) setupAndPlan(ctx *CommandContext) CommandResponse {
-	if p.concurrentRunLocker.TryLock(ctx.BaseRepo.FullName, ctx.Command.Environment, ctx.Pull.Num) != true {
-		return p.failureResponse(ctx,
-			fmt.Sprintf("The %s environment is currently locked by another command that is running for this pull request. Wait until command is complete and try again.", ctx.Command.Environment))
+	unlock, failure := lockRun(ctx, p.concurrentRunLocker, p.resultComments, p.commandMetrics, Plan, ctx.Command.Environment, p.queueTimeout)
+	if failure != "" {
+		return p.failureResponse(ctx, failure)
+	}
+	defer unlock()
+	p.commentReactions.Running(ctx)
+
+	// the repo is cloned before finding the projects to plan since its
+	// config can change which projects are planned
+	cloneDir, err := p.workspace.Clone(ctx)
+	if failure := cloneFailure(err); failure != "" {
+		return p.failureResponse(ctx, failure)
+	}
+	if err != nil {
+		return p.errorResponse(ctx, err)
+	}
+
+	var projects []models.Project
+	skipped := 0
+	if ctx.Command.Dir != "" {
+		project, failure := dirProject(ctx.BaseRepo.FullName, cloneDir, ctx.Command.Dir)
+		if failure != "" {
+			res := p.failureResponse(ctx, failure)
+			res.AvailableProjects = p.availableProjects(ctx, cloneDir)
+			return res
+		}
+		projects = []models.Project{project}
+	} else {
+		var failure string
+		projects, skipped, failure, err = p.scopeProjects(ctx, cloneDir)
+		if err != nil {
+			return p.errorResponse(ctx, err)
+		}
+		if failure != "" {
+			return p.failureResponse(ctx, failure)
+		}
+	}
+	var paths []string
+	for _, p := range projects {
+		paths = append(paths, p.Path)
+	}
+	ctx.Log.Info("determined we have %d project(s) to plan at path(s): %v", len(projects), strings.Join(paths, ", "))
+
+	// a config that can't be parsed fails the whole command rather than
+	// just its project since it may be a mistake in a config that's shared
+	ctx.projectConfigs, err = p.configReader.ReadAll(cloneDir, projects)
+	if err != nil {
+		return p.errorResponse(ctx, errors.Wrap(err, "parsing atlantis config files"))
+	}
+
+	results := []ProjectResult{}
+	if ctx.Command.AllEnvs {
+		results = p.planAllEnvs(ctx, cloneDir, projects)
+	} else {
+		results = p.planEnv(ctx, ctx.Command.Environment, cloneDir, projects)
+	}
+	return CommandResponse{ProjectResults: results, SkippedProjects: skipped}
+}
+
+// scopeProjects returns the projects to plan in the repo cloned into cloneDir
+// given the scope to plan and how many of the repo's other projects were
+// skipped because they weren't modified. If there aren't any to plan, it
+// returns why as a failure.
+func (p *PlanExecutor) scopeProjects(ctx *CommandContext, cloneDir string) ([]models.Project, int, string, error) {
+	scope, err := p.planScope(ctx, cloneDir)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	// figure out what projects have been modified, or exist if we're planning
+	// all of them, so we know where to run plan
+	allProjects, err := p.repoProjects(ctx, cloneDir)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	if scope == AllProjectsScope {
+		ctx.Log.Info("planning all %d projects in the repo", len(allProjects))
+		if len(allProjects) == 0 {
+			return nil, 0, "No Terraform files were found.", nil
+		}
+		return allProjects, 0, "", nil
 	}
-	defer p.concurrentRunLocker.Unlock(ctx.BaseRepo.FullName, ctx.Command.Environment, ctx.Pull.Num)
 
-	// figure out what projects have been modified so we know where to run plan
 	modifiedFiles, err := p.github.GetModifiedFiles(ctx.BaseRepo, ctx.Pull)
 	if err != nil {
-		return p.errorResponse(ctx, errors.Wrap(err, "getting modified files"))
+		return nil, 0, "", errors.Wrap(err, "getting modified files")
 	}
 	ctx.Log.Info("found %d files modified in this pull request", len(modifiedFiles))
+	var projects []models.Project
+	if terraformFiles := p.projectFinder.ProjectFiles(modifiedFiles); len(terraformFiles) > 0 {
+		ctx.Log.Info("filtered files to %d files in projects: %v", len(terraformFiles), terraformFiles)
+		projects = p.ModifiedProjects(ctx.BaseRepo.FullName, terraformFiles)
+	}
+
+	// projects that weren't modified themselves are still planned if they
+	// use a modified module
+	planned := make(map[string]bool)
+	for _, project := range projects {
+		planned[project.Path] = true
+	}
+	var unmodified []models.Project
+	for _, project := range allProjects {
+		if !planned[project.Path] {
+			unmodified = append(unmodified, project)
+		}
+	}
+	dependents := p.moduleDependents.Projects(ctx.Log, cloneDir, unmodified, modifiedFiles)
+	projects = append(projects, dependents...)
+	if len(projects) == 0 {
+		return nil, 0, "No Terraform files were modified.", nil
+	}
+	return projects, len(unmodified) - len(dependents), "", nil
+}
 
-	modifiedTerraformFiles := p.filterToTerraform(modifiedFiles)
-	if len(modifiedTerraformFiles) == 0 {
-		return p.failureResponse(ctx, "No Terraform files were modified.")
+// repoProjects returns every project in the repo cloned into cloneDir.
+func (p *PlanExecutor) repoProjects(ctx *CommandContext, cloneDir string) ([]models.Project, error) {
+	files, err := repoFiles(cloneDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "listing files in repo")
 	}
-	ctx.Log.Info("filtered modified files to %d non-module .tf files: %v", len(modifiedTerraformFiles), modifiedTerraformFiles)
+	return p.ModifiedProjects(ctx.BaseRepo.FullName, p.projectFinder.ProjectFiles(files)), nil
+}
 
-	projects := p.ModifiedProjects(ctx.BaseRepo.FullName, modifiedTerraformFiles)
+// availableProjects returns the paths of every project in the repo cloned
+// into cloneDir so a command that didn't match any of them can list them.
+// If they can't be found, there are none to list.
+func (p *PlanExecutor) availableProjects(ctx *CommandContext, cloneDir string) []string {
+	projects, err := p.repoProjects(ctx, cloneDir)
+	if err != nil {
+		ctx.Log.Warn("finding the projects in the repo to list: %s", err)
+		return nil
+	}
 	var paths []string
-	for _, p := range projects {
-		paths = append(paths, p.Path)
+	for _, project := range projects {
+		paths = append(paths, project.Path)
+	}
+	return paths
+}
+
+// dirProject returns the project in dir, the directory set with -d, of the
+// repo cloned into cloneDir. If dir isn't a directory inside the repo, it
+// returns why as a failure.
+func dirProject(repoFullName string, cloneDir string, dir string) (models.Project, string) {
+	outside := fmt.Sprintf("The -d directory %q must be inside the repo.", dir)
+	clean := filepath.Clean(filepath.FromSlash(dir))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return models.Project{}, outside
 	}
-	ctx.Log.Info("based on files modified, determined we have %d modified project(s) at path(s): %v", len(projects), strings.Join(paths, ", "))
 
-	cloneDir, err := p.workspace.Clone(ctx)
+	// symlinks are resolved so they can't point outside the repo either
+	resolved, err := filepath.EvalSymlinks(filepath.Join(cloneDir, clean))
 	if err != nil {
-		return p.errorResponse(ctx, err)
+		return models.Project{}, fmt.Sprintf("The -d directory %q doesn't exist in the repo.", dir)
+	}
+	resolvedCloneDir, err := filepath.EvalSymlinks(cloneDir)
+	if err != nil {
+		return models.Project{}, outside
+	}
+	rel, err := filepath.Rel(resolvedCloneDir, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return models.Project{}, outside
+	}
+	if info, err := os.Stat(resolved); err != nil || !info.IsDir() {
+		return models.Project{}, fmt.Sprintf("The -d directory %q isn't a directory.", dir)
+	}
+	return models.NewProject(repoFullName, filepath.ToSlash(clean)), ""
+}
+
+// noTerraformModified returns true if it's certain that the pull request in
+// ctx doesn't modify any files in projects or any .tf files, which may be in
+// modules that projects use. It's checked before anything is commented or
+// cloned so it doesn't consider the repo's plan_scope.
+func (p *PlanExecutor) noTerraformModified(ctx *CommandContext) bool {
+	modifiedFiles, err := p.github.GetModifiedFiles(ctx.BaseRepo, ctx.Pull)
+	if err != nil {
+		// the plan will fail to get the modified files too and report why
+		return false
+	}
+	for _, file := range modifiedFiles {
+		if strings.HasSuffix(file, ".tf") {
+			return false
+		}
 	}
+	return len(p.projectFinder.ProjectFiles(modifiedFiles)) == 0
+}
 
+// planScope returns the scope of projects to plan: the one set in the comment,
+// otherwise the plan_scope in the atlantis.yaml at the root of the repo cloned
+// into cloneDir, otherwise the server's default.
+func (p *PlanExecutor) planScope(ctx *CommandContext, cloneDir string) (string, error) {
+	if ctx.Command.PlanScope != "" {
+		return ctx.Command.PlanScope, nil
+	}
+	if p.configReader.Exists(cloneDir) {
+		config, err := p.configReader.Read(cloneDir)
+		if err != nil {
+			return "", err
+		}
+		if config.PlanScope != "" {
+			ctx.Log.Info("using plan_scope %q from the repo's config", config.PlanScope)
+			return config.PlanScope, nil
+		}
+	}
+	if p.defaultPlanScope == "" {
+		return ChangedProjectsScope, nil
+	}
+	return p.defaultPlanScope, nil
+}
+
+// repoFiles returns the paths of all the files in the repo cloned into
+// repoDir, relative to repoDir, so they can be used like modified files to
+// find every project.
+func repoFiles(repoDir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(repoDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(repoDir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	return files, err
+}
+
+// planAllEnvs plans each of projects in every environment it's configured
+// for. cloneDir is where the repo was cloned for ctx.Command.Environment.
+// Since apply looks for plans in the clone for its environment, each
+// environment is planned in its own clone.
+func (p *PlanExecutor) planAllEnvs(ctx *CommandContext, cloneDir string, projects []models.Project) []ProjectResult {
 	results := []ProjectResult{}
+	var envs []string
+	envProjects := make(map[string][]models.Project)
+	for _, project := range projects {
+		projectEnvs, err := p.projectEnvironments(ctx, filepath.Join(cloneDir, project.Path))
+		if err != nil {
+			results = append(results, ProjectResult{Path: project.Path, Error: err})
+			continue
+		}
+		for _, env := range projectEnvs {
+			if _, ok := envProjects[env]; !ok {
+				envs = append(envs, env)
+			}
+			envProjects[env] = append(envProjects[env], project)
+		}
+	}
+	sort.Strings(envs)
+	ctx.Log.Info("planning %d environment(s): %s", len(envs), strings.Join(envs, ", "))
+
+	// each environment is planned with ctx, like runEnvs, so what it
+	// records on ctx is kept
+	command := ctx.Command
+	defer func() { ctx.Command = command }()
+	for _, env := range envs {
+		envCommand := *command
+		envCommand.Environment = env
+		ctx.Command = &envCommand
+		for _, result := range p.planEnv(ctx, command.Environment, cloneDir, envProjects[env]) {
+			result.Environment = env
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// planEnv plans projects in ctx.Command.Environment. lockedEnv is the
+// environment that's already locked and cloned into lockedCloneDir.
+func (p *PlanExecutor) planEnv(ctx *CommandContext, lockedEnv string, lockedCloneDir string, projects []models.Project) []ProjectResult {
+	var results []ProjectResult
+	failAll := func(res ProjectResult) []ProjectResult {
+		for _, project := range projects {
+			res.Path = project.Path
+			results = append(results, res)
+		}
+		return results
+	}
+
+	env := ctx.Command.Environment
+	cloneDir := lockedCloneDir
+	if env != lockedEnv {
+		unlock, failure := lockRun(ctx, p.concurrentRunLocker, p.resultComments, p.commandMetrics, Plan, env, p.queueTimeout)
+		if failure != "" {
+			return failAll(ProjectResult{Failure: failure})
+		}
+		defer unlock()
+
+		var err error
+		cloneDir, err = p.workspace.Clone(ctx)
+		if failure := cloneFailure(err); failure != "" {
+			return failAll(ProjectResult{Failure: failure})
+		}
+		if err != nil {
+			return failAll(ProjectResult{Error: err})
+		}
+	}
+	var paths []string
 	for _, project := range projects {
-		ctx.Log.Info("running plan for project at path %q", project.Path)
-		result := p.plan(ctx, cloneDir, project)
-		result.Path = project.Path
-		results = append(results, result)
+		paths = append(paths, project.Path)
+	}
+	results = runProjects(ctx, Plan, p.parallelPlans, paths, func(i int) ProjectResult {
+		return p.planProject(ctx, cloneDir, projects[i])
+	})
+	return results
+}
+
+// planProject plans project in ctx.Command.Environment and records how long it took.
+func (p *PlanExecutor) planProject(ctx *CommandContext, cloneDir string, project models.Project) ProjectResult {
+	ctx.Log.Info("running plan for project at path %q in environment %q", project.Path, ctx.Command.Environment)
+	start := time.Now()
+	result := p.plan(ctx, cloneDir, project)
+	result.Path = project.Path
+	result.Duration = time.Since(start)
+	p.projectDurations.Observe([]string{ctx.BaseRepo.FullName, project.Path, Plan.String()}, result.Duration.Seconds())
+	return result
+}
+
+// fmtUnformattedExitCode is the exit code of terraform fmt -check when files
+// aren't formatted, as opposed to when it failed to run.
+const fmtUnformattedExitCode = 3
+
+// fmtCheckFailure runs terraform fmt -check in the project at absolutePath. If
+// any of its files aren't formatted, it returns a failure with the diff that
+// would format them.
+func fmtCheckFailure(ctx *CommandContext, tf *terraform.Client, absolutePath string, v *version.Version, envVars []string) (string, error) {
+	output, err := tf.RunCommandWithEnvVars(ctx.Log, absolutePath, []string{"fmt", "-check", "-diff"}, v, ctx.Command.Environment, envVars)
+	if err == nil {
+		return "", nil
+	}
+	if terraform.ExitCode(err) != fmtUnformattedExitCode {
+		return "", err
+	}
+	ctx.Log.Info("terraform files in %q aren't formatted", absolutePath)
+	return fmt.Sprintf("Terraform files aren't formatted so the plan didn't run. Run `terraform fmt` and push the changes.\n```diff\n%s\n```", strings.TrimSpace(output)), nil
+}
+
+// projectEnvironments returns the environments to plan with --all-envs for
+// the project at absolutePath. These are the environments in its config file
+// or if it doesn't set any, the default environment and any environment with
+// an env/{env}.tfvars file.
+func (p *PlanExecutor) projectEnvironments(ctx *CommandContext, absolutePath string) ([]string, error) {
+	config, _, err := projectConfig(ctx, p.configReader, absolutePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.Environments) > 0 {
+		return config.Environments, nil
+	}
+	return varFileEnvironments(absolutePath)
+}
+
+// initAttempts is how many times terraform init is run before its failure is
+// reported, if it keeps failing like the network did.
+const initAttempts = 2
+
+// failureOutputLines is how many of the last lines of what terraform init or
+// a project's pre_plan or post_plan commands printed are commented when they
+// fail.
+const failureOutputLines = 20
+
+// initRetryDelay is how long to wait before retrying terraform init. It
+// doubles after each attempt. It's a var so tests don't have to wait.
+var initRetryDelay = 5 * time.Second
+
+// networkFailureRegex matches what terraform init prints when downloading
+// modules or providers fails transiently, ex. because the registry timed out.
+var networkFailureRegex = regexp.MustCompile(`(?i)timeout|timed out|connection (reset|refused)|no such host|tls handshake|temporary failure|unexpected eof|bad gateway|service unavailable`)
+
+// runInit runs terraform init in the project at absolutePath and returns its
+// output. Failures that look like the network's are retried with backoff
+// before they're returned. The output of a failed init goes to the log so
+// it's in the comment with --verbose.
+func (p *PlanExecutor) runInit(ctx *CommandContext, absolutePath string, tfEnv string, args []string, v *version.Version, envVars []string) (string, error) {
+	delay := initRetryDelay
+	for attempt := 1; ; attempt++ {
+		output, err := p.terraform.RunInit(ctx.Log, absolutePath, tfEnv, args, v, envVars)
+		if err == nil {
+			return output, nil
+		}
+		ctx.Log.Info("terraform init in %q printed:\n%s", absolutePath, output)
+		exitErr, ok := err.(*terraform.ExitError)
+		if !ok || attempt == initAttempts || !networkFailureRegex.MatchString(exitErr.Stderr) {
+			return output, err
+		}
+		ctx.Log.Warn("terraform init in %q failed like the network did so retrying in %s", absolutePath, delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// initErrResult returns the result of a project whose terraform init failed
+// with err. If terraform ran, the failure names the init step and has the
+// end of what it printed to stderr instead of the whole error.
+func initErrResult(err error) ProjectResult {
+	exitErr, ok := err.(*terraform.ExitError)
+	if !ok {
+		return terraformErrResult(err)
 	}
-	p.githubStatus.UpdateProjectResult(ctx, results)
-	return CommandResponse{ProjectResults: results}
+	return ProjectResult{Failure: fmt.Sprintf("`terraform init` failed so the plan didn't run:\n```\n%s\n```", lastLines(exitErr.Stderr, failureOutputLines))}
+}
+
+// hookFailure is the failure for a project whose stage commands, ex.
+// pre_plan, failed with err after printing output.
+func hookFailure(stage string, output string, err error, consequence string) string {
+	return fmt.Sprintf("`%s` commands failed (%s) %s:\n```\n%s\n```", stage, errors.Cause(err), consequence, lastLines(output, failureOutputLines))
+}
+
+// lastLines returns the last n lines of s.
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
 }
 
 // plan runs the steps necessary to run `terraform plan`. If there is an error, the error message will be encapsulated in error
@@ -119,104 +586,286 @@ func (p *PlanExecutor) plan(ctx *CommandContext, repoDir string, project models.
 	ctx.Log.Info("acquired lock with id %q", lockAttempt.LockKey)
 
 	// check if config file is found, if not we continue the run
-	var config ProjectConfig
 	absolutePath := filepath.Join(repoDir, project.Path)
 	var planExtraArgs []string
-	if p.configReader.Exists(absolutePath) {
-		config, err = p.configReader.Read(absolutePath)
-		if err != nil {
-			return ProjectResult{Error: err}
-		}
+	config, hasConfig, err := projectConfig(ctx, p.configReader, absolutePath)
+	if err != nil {
+		return ProjectResult{Error: err}
+	}
+	if hasConfig {
 		ctx.Log.Info("parsed atlantis config file in %q", absolutePath)
 		planExtraArgs = config.GetExtraArguments(ctx.Command.Name.String())
 	}
+	var warnings []string
+	var providers map[string]string
+	envVars, failure := commentEnvVars(ctx, config)
+	if failure == "" {
+		failure = p.terraformFlagPolicy.Check(ctx, config, Plan, initArgs(ctx, absolutePath, config))
+	}
+	if failure == "" {
+		failure = varFilesFailure(repoDir, project.Path, ctx.Command.VarFiles)
+	}
+	if failure != "" {
+		if _, err := p.locker.Unlock(lockAttempt.LockKey); err != nil {
+			ctx.Log.Err("error unlocking state: %v", err)
+		}
+		return ProjectResult{Failure: failure}
+	}
+	roleEnvVars, cleanupRole, err := assumeRoleEnvVars(ctx, config)
+	if err != nil {
+		if _, err := p.locker.Unlock(lockAttempt.LockKey); err != nil {
+			ctx.Log.Err("error unlocking state: %v", err)
+		}
+		return ProjectResult{Error: err}
+	}
+	defer cleanupRole()
+	envVars = append(envVars, roleEnvVars...)
 
-	// check if terraform version is >= 0.9.0
-	terraformVersion := p.terraform.Version()
-	if config.TerraformVersion != nil {
-		terraformVersion = config.TerraformVersion
+	terraformVersion, err := projectTerraformVersion(ctx, p.terraform, absolutePath, config)
+	if err != nil {
+		if _, err := p.locker.Unlock(lockAttempt.LockKey); err != nil {
+			ctx.Log.Err("error unlocking state: %v", err)
+		}
+		return terraformErrResult(err)
 	}
+	// formatting is checked first since it doesn't need the project to be
+	// initialized
+	if p.fmtCheck || ctx.Command.FmtCheck {
+		failure, err := fmtCheckFailure(ctx, p.terraform, absolutePath, terraformVersion, envVars)
+		if err != nil || failure != "" {
+			if _, err := p.locker.Unlock(lockAttempt.LockKey); err != nil {
+				ctx.Log.Err("error unlocking state: %v", err)
+			}
+		}
+		if err != nil {
+			return terraformErrResult(err)
+		}
+		if failure != "" {
+			return ProjectResult{Failure: failure}
+		}
+	}
+	// check if terraform version is >= 0.9.0
 	constraints, _ := version.NewConstraint(">= 0.9.0")
 	if constraints.Check(terraformVersion) {
 		ctx.Log.Info("determined that we are running terraform with version >= 0.9.0. Running version %s", terraformVersion)
-		_, err := p.terraform.RunInitAndEnv(ctx.Log, absolutePath, tfEnv, config.GetExtraArguments("init"), terraformVersion)
+		// backends were introduced in 0.9.0 so we can only check for them from then on
+		if warning := localStateWarning(ctx, absolutePath, config); warning != "" {
+			warnings = append(warnings, warning)
+		}
+		if p.requireConfiguredEnvs && !ctx.Command.WorkspaceFlag {
+			envs, err := p.configuredEnvironments(ctx, absolutePath, config, terraformVersion)
+			if err != nil {
+				if _, err := p.locker.Unlock(lockAttempt.LockKey); err != nil {
+					ctx.Log.Err("error unlocking state: %v", err)
+				}
+				return terraformErrResult(err)
+			}
+			if !stringInSlice(tfEnv, envs) {
+				if _, err := p.locker.Unlock(lockAttempt.LockKey); err != nil {
+					ctx.Log.Err("error unlocking state: %v", err)
+				}
+				return ProjectResult{Failure: envNotConfiguredFailure(tfEnv, project.Path, envs)}
+			}
+		}
+		if ctx.Command.WorkspaceFlag {
+			workspaces, err := p.workspaceDiscovery.List(ctx, absolutePath, initArgs(ctx, absolutePath, config), terraformVersion)
+			if err != nil {
+				if _, err := p.locker.Unlock(lockAttempt.LockKey); err != nil {
+					ctx.Log.Err("error unlocking state: %v", err)
+				}
+				return terraformErrResult(err)
+			}
+			if !stringInSlice(tfEnv, workspaces) {
+				if _, err := p.locker.Unlock(lockAttempt.LockKey); err != nil {
+					ctx.Log.Err("error unlocking state: %v", err)
+				}
+				return ProjectResult{Failure: workspaceNotFoundFailure(tfEnv, workspaces)}
+			}
+		}
+		initOutput, err := p.runInit(ctx, absolutePath, tfEnv, initArgs(ctx, absolutePath, config), terraformVersion, envVars)
 		if err != nil {
-			return ProjectResult{Error: err}
+			if _, err := p.locker.Unlock(lockAttempt.LockKey); err != nil {
+				ctx.Log.Err("error unlocking state: %v", err)
+			}
+			return initErrResult(err)
+		}
+		if _, err := p.terraform.RunSelectEnv(ctx.Log, absolutePath, tfEnv, terraformVersion, envVars); err != nil {
+			if _, err := p.locker.Unlock(lockAttempt.LockKey); err != nil {
+				ctx.Log.Err("error unlocking state: %v", err)
+			}
+			return terraformErrResult(err)
 		}
+		providers = terraform.ParseProviders(initOutput)
 	} else {
 		ctx.Log.Info("determined that we are running terraform with version < 0.9.0. Running version %s", terraformVersion)
 		terraformGetCmd := append([]string{"get", "-no-color"}, config.GetExtraArguments("get")...)
-		_, err := p.terraform.RunCommandWithVersion(ctx.Log, absolutePath, terraformGetCmd, terraformVersion, tfEnv)
+		_, err := p.terraform.RunCommandWithEnvVars(ctx.Log, absolutePath, terraformGetCmd, terraformVersion, tfEnv, envVars)
 		if err != nil {
-			return ProjectResult{Error: err}
+			return terraformErrResult(err)
 		}
 	}
 
-	// if there are pre plan commands then run them
+	// if there are pre plan commands then run them. Their output is kept
+	// for the comment and the log
+	var hookOutput string
 	if len(config.PrePlan.Commands) > 0 {
-		_, err := p.run.Execute(ctx.Log, config.PrePlan.Commands, absolutePath, tfEnv, terraformVersion, "pre_plan")
+		output, err := p.run.ExecuteWithEnvVars(ctx.Log, config.PrePlan.Commands, absolutePath, tfEnv, terraformVersion, "pre_plan", hookEnvVars(ctx))
+		ctx.Log.Info("pre_plan output:\n%s", output)
+		if err != nil {
+			if _, err := p.locker.Unlock(lockAttempt.LockKey); err != nil {
+				ctx.Log.Err("error unlocking state: %v", err)
+			}
+			return ProjectResult{Failure: hookFailure("pre_plan", output, err, "so the plan didn't run")}
+		}
+		hookOutput = output
+	}
+
+	// expand --target-type into the addresses of the resources of those types
+	// and add them to the addresses set with -target
+	targets := append([]string{}, ctx.Command.Targets...)
+	if len(ctx.Command.TargetTypes) > 0 {
+		graph, err := p.terraform.RunCommandWithEnvVars(ctx.Log, absolutePath, []string{"graph"}, terraformVersion, tfEnv, envVars)
 		if err != nil {
-			return ProjectResult{Error: errors.Wrap(err, "running pre plan commands")}
+			if _, err := p.locker.Unlock(lockAttempt.LockKey); err != nil {
+				ctx.Log.Err("error unlocking state: %v", err)
+			}
+			return terraformErrResult(err)
 		}
+		var typeTargets []string
+		for _, resourceType := range ctx.Command.TargetTypes {
+			for _, address := range terraform.ResourceAddresses(graph, resourceType) {
+				// the addresses are quoted for the shell like the comment's
+				// targets so they're held to the same rules
+				if resourceAddressRegex.MatchString(address) {
+					typeTargets = append(typeTargets, address)
+				}
+			}
+		}
+		if len(typeTargets) == 0 {
+			if _, err := p.locker.Unlock(lockAttempt.LockKey); err != nil {
+				ctx.Log.Err("error unlocking state: %v", err)
+			}
+			return ProjectResult{Failure: fmt.Sprintf("This project has no resources of type `%s` to target.", strings.Join(ctx.Command.TargetTypes, "`, `"))}
+		}
+		targets = append(targets, typeTargets...)
+	}
+	if len(targets) > 0 {
+		ctx.Log.Info("targeting %v", targets)
 	}
 
 	// Run terraform plan
-	planFile := filepath.Join(repoDir, project.Path, fmt.Sprintf("%s.tfplan", tfEnv))
+	planFile := planFile(repoDir, project.Path, tfEnv)
 	userVar := fmt.Sprintf("%s=%s", atlantisUserTFVar, ctx.User.Username)
-	tfPlanCmd := append(append([]string{"plan", "-refresh", "-no-color", "-out", planFile, "-var", userVar}, planExtraArgs...), ctx.Command.Flags...)
+	tfParallelism := parallelism(ctx, config)
+	tfLockTimeout := lockTimeout(ctx, config, p.lockTimeout)
+	tfPlanCmd := append(append(append(append([]string{"plan", "-refresh", "-no-color", "-out", planFile, "-var", userVar}, planExtraArgs...), parallelismArgs(tfParallelism)...), lockTimeoutArgs(tfLockTimeout)...), ctx.Command.Flags...)
+	tfPlanCmd = append(tfPlanCmd, targetArgs(targets)...)
 
-	// check if env/{environment}.tfvars exist
+	// check if env/{environment}.tfvars exist. The var files from the
+	// comment come after it so they take precedence
+	var varFiles []string
 	tfEnvFileName := filepath.Join("env", tfEnv+".tfvars")
 	if _, err := os.Stat(filepath.Join(repoDir, project.Path, tfEnvFileName)); err == nil {
 		tfPlanCmd = append(tfPlanCmd, "-var-file", tfEnvFileName)
+		varFiles = append(varFiles, tfEnvFileName)
+	}
+	tfPlanCmd = append(tfPlanCmd, varFileArgs(ctx.Command.VarFiles)...)
+	varFiles = append(varFiles, ctx.Command.VarFiles...)
+	output, err := p.terraform.RunCommandWithTimeout(ctx.Log, filepath.Join(repoDir, project.Path), tfPlanCmd, terraformVersion, tfEnv, envVars, p.planTimeout)
+	tfExitCode := exitCode(err)
+	if terraform.ExitCode(err) == 2 && stringInSlice("-detailed-exitcode", tfPlanCmd) {
+		// with -detailed-exitcode, 2 means the plan succeeded and has changes
+		err = nil
 	}
-	output, err := p.terraform.RunCommandWithVersion(ctx.Log, filepath.Join(repoDir, project.Path), tfPlanCmd, terraformVersion, tfEnv)
 	if err != nil {
 		// plan failed so unlock the state
 		if _, err := p.locker.Unlock(lockAttempt.LockKey); err != nil {
 			ctx.Log.Err("error unlocking state: %v", err)
 		}
-		return ProjectResult{Error: fmt.Errorf("%s\n%s", err.Error(), output)}
+		// the error contains terraform's stderr which explains why the plan
+		// failed so we don't need the output from refreshing
+		result := terraformErrResult(err)
+		result.Parallelism = tfParallelism
+		result.LockTimeout = tfLockTimeout
+		result.ExitCode = tfExitCode
+		result.Warnings = warnings
+		result.Targets = targets
+		result.VarFiles = varFiles
+		result.HookOutput = hookOutput
+		return result
 	}
 	ctx.Log.Info("plan succeeded")
 
 	// if there are post plan commands then run them
 	if len(config.PostPlan.Commands) > 0 {
-		_, err := p.run.Execute(ctx.Log, config.PostPlan.Commands, absolutePath, tfEnv, terraformVersion, "post_plan")
+		output, err := p.run.ExecuteWithEnvVars(ctx.Log, config.PostPlan.Commands, absolutePath, tfEnv, terraformVersion, "post_plan", hookEnvVars(ctx))
+		ctx.Log.Info("post_plan output:\n%s", output)
 		if err != nil {
-			return ProjectResult{Error: errors.Wrap(err, "running post plan commands")}
+			// the plan can't be applied so it's deleted and the project
+			// unlocked like if the plan had failed
+			for _, f := range []string{planFile, providersFile(planFile)} {
+				if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+					ctx.Log.Err("error deleting plan after post_plan failed: %v", err)
+				}
+			}
+			if _, err := p.locker.Unlock(lockAttempt.LockKey); err != nil {
+				ctx.Log.Err("error unlocking state: %v", err)
+			}
+			return ProjectResult{Failure: hookFailure("post_plan", output, err, "after the plan succeeded")}
 		}
+		hookOutput += output
+	}
+	if err := saveProviders(planFile, providers); err != nil {
+		ctx.Log.Warn("saving the providers the plan ran with so apply can record them: %s", err)
 	}
 
+	lastApplied, err := p.resultsStore.LastApplied(ctx.BaseRepo.FullName, project.Path, tfEnv)
+	if err != nil {
+		ctx.Log.Warn("getting last apply so not comparing plan with it: %s", err)
+	}
+	warnings = append(warnings, providerUpgradeWarnings(config, providers, lastApplied)...)
 	return ProjectResult{
 		PlanSuccess: &PlanSuccess{
 			TerraformOutput: output,
 			LockURL:         p.lockURL(lockAttempt.LockKey),
 		},
+		Parallelism: tfParallelism,
+		LockTimeout: tfLockTimeout,
+		ExitCode:    tfExitCode,
+		Warnings:    warnings,
+		Providers:   providers,
+		LastApplied: lastApplied,
+		Targets:     targets,
+		VarFiles:    varFiles,
+		HookOutput:  hookOutput,
 	}
 }
 
-func (p *PlanExecutor) filterToTerraform(files []string) []string {
+func filterToTerraform(files []string) []string {
 	var out []string
 	for _, fileName := range files {
-		if !p.isInExcludeList(fileName) && strings.Contains(fileName, ".tf") {
+		if !isInExcludeList(fileName) && strings.Contains(fileName, ".tf") {
 			out = append(out, fileName)
 		}
 	}
 	return out
 }
 
-func (p *PlanExecutor) isInExcludeList(fileName string) bool {
+func isInExcludeList(fileName string) bool {
 	return strings.Contains(fileName, "terraform.tfstate") || strings.Contains(fileName, "terraform.tfstate.backup") || strings.Contains(fileName, "_modules") || strings.Contains(fileName, "modules")
 }
 
 // ModifiedProjects returns the list of Terraform projects that have been changed due to the
 // modified files
 func (p *PlanExecutor) ModifiedProjects(repoFullName string, modifiedFiles []string) []models.Project {
+	return p.projectFinder.ModifiedProjects(repoFullName, modifiedFiles)
+}
+
+func modifiedProjects(repoFullName string, modifiedFiles []string) []models.Project {
 	var projects []models.Project
 	seenPaths := make(map[string]bool)
 	for _, modifiedFile := range modifiedFiles {
-		path := p.getProjectPath(modifiedFile)
+		path := getProjectPath(modifiedFile)
 		if _, ok := seenPaths[path]; !ok {
 			projects = append(projects, models.NewProject(repoFullName, path))
 			seenPaths[path] = true
@@ -227,7 +876,7 @@ func (p *PlanExecutor) ModifiedProjects(repoFullName string, modifiedFiles []str
 
 // getProjectPath returns the path to the project relative to the repo root
 // if the project is at the root returns "."
-func (p *PlanExecutor) getProjectPath(modifiedFilePath string) string {
+func getProjectPath(modifiedFilePath string) string {
 	dir := path.Dir(modifiedFilePath)
 	if path.Base(dir) == "env" {
 		// if the modified file was inside an env/ directory, we treat this specially and
@@ -237,14 +886,59 @@ func (p *PlanExecutor) getProjectPath(modifiedFilePath string) string {
 	return dir
 }
 
+// configuredEnvironments returns the sorted environments that the project at
+// absolutePath is configured for. These are the default environment, any
+// environment with an env/{env}.tfvars file and any workspace that already exists.
+func (p *PlanExecutor) configuredEnvironments(ctx *CommandContext, absolutePath string, config ProjectConfig, terraformVersion *version.Version) ([]string, error) {
+	envs, err := varFileEnvironments(absolutePath)
+	if err != nil {
+		return nil, err
+	}
+	workspaces, err := p.workspaceDiscovery.List(ctx, absolutePath, initArgs(ctx, absolutePath, config), terraformVersion)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range workspaces {
+		if !stringInSlice(w, envs) {
+			envs = append(envs, w)
+		}
+	}
+	sort.Strings(envs)
+	return envs, nil
+}
+
+// varFileEnvironments returns the default environment and the environments
+// that have an env/{env}.tfvars file in the project at absolutePath.
+func varFileEnvironments(absolutePath string) ([]string, error) {
+	envs := []string{"default"}
+	varFiles, err := filepath.Glob(filepath.Join(absolutePath, "env", "*.tfvars"))
+	if err != nil {
+		return nil, errors.Wrap(err, "listing env var files")
+	}
+	for _, f := range varFiles {
+		env := strings.TrimSuffix(filepath.Base(f), ".tfvars")
+		if !stringInSlice(env, envs) {
+			envs = append(envs, env)
+		}
+	}
+	return envs, nil
+}
+
+// envNotConfiguredFailure is the failure message when the environment being
+// planned isn't one of the environments envs that the project at path is configured for.
+func envNotConfiguredFailure(env string, path string, envs []string) string {
+	return fmt.Sprintf("Environment %q is not configured for project %q. Valid environments are: %s. Add an env/%s.tfvars file or create the %s workspace to configure it.",
+		env, path, strings.Join(envs, ", "), env, env)
+}
+
 func (p *PlanExecutor) failureResponse(ctx *CommandContext, msg string) CommandResponse {
 	ctx.Log.Warn(msg)
-	p.githubStatus.Update(ctx.BaseRepo, ctx.Pull, Failure, PlanStep)
+	p.githubStatus.Update(ctx, Failure, PlanStep)
 	return CommandResponse{Failure: msg}
 }
 
 func (p *PlanExecutor) errorResponse(ctx *CommandContext, err error) CommandResponse {
 	ctx.Log.Err(err.Error())
-	p.githubStatus.Update(ctx.BaseRepo, ctx.Pull, Error, PlanStep)
+	p.githubStatus.Update(ctx, Error, PlanStep)
 	return CommandResponse{Error: err}
 }
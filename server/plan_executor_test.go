@@ -1,9 +1,26 @@
 package server
 
 import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/hootsuite/atlantis/github/mocks"
+	"github.com/hootsuite/atlantis/locking"
+	lockmocks "github.com/hootsuite/atlantis/locking/mocks"
+	"github.com/hootsuite/atlantis/logging"
+	"github.com/hootsuite/atlantis/models"
+	"github.com/hootsuite/atlantis/models/fixtures"
+	"github.com/hootsuite/atlantis/run"
+	"github.com/hootsuite/atlantis/terraform"
 
 	. "github.com/hootsuite/atlantis/testing_util"
+	. "github.com/petergtz/pegomock"
 )
 
 var p PlanExecutor
@@ -26,3 +43,405 @@ func runTest(t *testing.T, testDescrip string, filesChanged []string, expectedPa
 		Equals(t, expectedPaths[i], p.Path)
 	}
 }
+
+func TestRepoFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(dir)
+	for _, f := range []string{"main.tf", "staging/main.tf", "staging/env/prod.tfvars", ".git/config"} {
+		Ok(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, f)), 0755))
+		Ok(t, ioutil.WriteFile(filepath.Join(dir, f), []byte(""), 0644))
+	}
+	files, err := repoFiles(dir)
+	Ok(t, err)
+	Equals(t, []string{"main.tf", "staging/env/prod.tfvars", "staging/main.tf"}, files)
+}
+
+func TestDirProject(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(dir)
+	cloneDir := filepath.Join(dir, "repo")
+	Ok(t, os.MkdirAll(filepath.Join(cloneDir, "sub", "dir"), 0755))
+	Ok(t, ioutil.WriteFile(filepath.Join(cloneDir, "main.tf"), []byte(""), 0644))
+	Ok(t, os.Symlink(dir, filepath.Join(cloneDir, "outside")))
+
+	t.Log("directories inside the repo should be projects")
+	for d, path := range map[string]string{"sub/dir": "sub/dir", "sub/dir/": "sub/dir", "./sub/../sub": "sub", ".": "."} {
+		project, failure := dirProject("owner/repo", cloneDir, d)
+		Equals(t, "", failure)
+		Equals(t, path, project.Path)
+		Equals(t, "owner/repo", project.RepoFullName)
+	}
+
+	t.Log("directories outside the repo should fail")
+	for _, d := range []string{"..", "../repo", "sub/../../..", "/etc", "outside"} {
+		_, failure := dirProject("owner/repo", cloneDir, d)
+		Equals(t, fmt.Sprintf("The -d directory %q must be inside the repo.", d), failure)
+	}
+
+	_, failure := dirProject("owner/repo", cloneDir, "missing")
+	Equals(t, `The -d directory "missing" doesn't exist in the repo.`, failure)
+	_, failure = dirProject("owner/repo", cloneDir, "main.tf")
+	Equals(t, `The -d directory "main.tf" isn't a directory.`, failure)
+}
+
+// fmtTerraform is a terraform executable whose fmt -check fails with a diff
+// if the directory it's run in has an unformatted.tf file.
+var fmtTerraform = `#!/bin/sh
+if [ "$1" = "version" ]; then
+  echo "Terraform v0.10.0"
+  exit 0
+fi
+if [ "$1" = "fmt" ] && [ -f unformatted.tf ]; then
+  echo "unformatted.tf"
+  echo "-a=1"
+  echo "+a = 1"
+  exit 3
+fi
+if [ "$1" = "fmt" ] && [ -f broken.tf ]; then
+  echo "Error parsing broken.tf" 1>&2
+  exit 2
+fi
+`
+
+func TestFmtCheckFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(dir)
+	Ok(t, ioutil.WriteFile(filepath.Join(dir, "terraform"), []byte(fmtTerraform), 0755))
+	oldPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", oldPath)
+	os.Setenv("PATH", dir+":"+oldPath)
+	tf, err := terraform.NewClient("", "")
+	Ok(t, err)
+	ctx := &CommandContext{
+		Command: &Command{Name: Plan, Environment: "default"},
+		Log:     logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+	for _, project := range []string{"formatted", "unformatted", "broken"} {
+		Ok(t, os.Mkdir(filepath.Join(dir, project), 0755))
+		Ok(t, ioutil.WriteFile(filepath.Join(dir, project, project+".tf"), []byte(""), 0644))
+	}
+
+	t.Log("formatted projects should pass")
+	failure, err := fmtCheckFailure(ctx, tf, filepath.Join(dir, "formatted"), tf.Version(), nil)
+	Ok(t, err)
+	Equals(t, "", failure)
+
+	t.Log("unformatted projects should fail with the diff")
+	failure, err = fmtCheckFailure(ctx, tf, filepath.Join(dir, "unformatted"), tf.Version(), nil)
+	Ok(t, err)
+	Equals(t, "Terraform files aren't formatted so the plan didn't run. Run `terraform fmt` and push the changes.\n```diff\nunformatted.tf\n-a=1\n+a = 1\n```", failure)
+
+	t.Log("other errors from fmt should be errors")
+	_, err = fmtCheckFailure(ctx, tf, filepath.Join(dir, "broken"), tf.Version(), nil)
+	Assert(t, err != nil, "expected an error")
+}
+
+func TestPlanScope(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(dir)
+	ctx := &CommandContext{
+		Command: &Command{},
+		Log:     logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+	e := PlanExecutor{configReader: &ConfigReader{}}
+
+	t.Log("without any config only changed projects should be planned")
+	scope, err := e.planScope(ctx, dir)
+	Ok(t, err)
+	Equals(t, ChangedProjectsScope, scope)
+
+	t.Log("the server's default should be used if the repo doesn't set one")
+	e.defaultPlanScope = AllProjectsScope
+	scope, err = e.planScope(ctx, dir)
+	Ok(t, err)
+	Equals(t, AllProjectsScope, scope)
+
+	t.Log("the repo's config should override the server's default")
+	Ok(t, ioutil.WriteFile(filepath.Join(dir, ProjectConfigFile), []byte("plan_scope: changed\n"), 0644))
+	scope, err = e.planScope(ctx, dir)
+	Ok(t, err)
+	Equals(t, ChangedProjectsScope, scope)
+
+	t.Log("and the comment should override everything")
+	ctx.Command.PlanScope = AllProjectsScope
+	scope, err = e.planScope(ctx, dir)
+	Ok(t, err)
+	Equals(t, AllProjectsScope, scope)
+}
+
+func TestExecute_AutoplanSkip(t *testing.T) {
+	t.Log("automatic plans of pull requests without Terraform changes should be skipped without commenting")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	When(client.GetModifiedFiles(fixtures.Repo, fixtures.Pull)).ThenReturn([]string{"README.md"}, nil)
+	e := PlanExecutor{github: client}
+	e.Execute(&CommandContext{
+		BaseRepo: fixtures.Repo,
+		Pull:     fixtures.Pull,
+		Command:  &Command{Name: Plan, Autoplan: true},
+		Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	})
+	// the executor has no status, comments or workspace so it would panic
+	// if it got any further
+	client.VerifyWasCalled(Never()).CreateComment(fixtures.Repo, fixtures.Pull, "No Terraform files were modified.")
+
+	t.Log("but not if they modify Terraform files")
+	When(client.GetModifiedFiles(fixtures.Repo, fixtures.Pull)).ThenReturn([]string{"README.md", "main.tf"}, nil)
+	Equals(t, false, e.noTerraformModified(&CommandContext{BaseRepo: fixtures.Repo, Pull: fixtures.Pull}))
+}
+
+func TestScopeProjects_ModuleDependents(t *testing.T) {
+	RegisterMockTestingT(t)
+	cloneDir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(cloneDir)
+	files := map[string]string{
+		"vpc/main.tf":         "module \"vpc\" {\n  source = \"../modules/vpc\"\n}\n",
+		"nested/main.tf":      "module \"app\" {\n  source = \"../modules/app\"\n}\n",
+		"db/main.tf":          "resource \"null_resource\" \"db\" {}\n",
+		"other/main.tf":       "module \"consul\" {\n  source = \"hashicorp/consul/aws\"\n}\n",
+		"modules/app/main.tf": "module \"vpc\" {\n  source = \"../vpc\"\n}\n",
+		"modules/vpc/main.tf": "resource \"null_resource\" \"vpc\" {}\n",
+	}
+	for file, contents := range files {
+		Ok(t, os.MkdirAll(filepath.Join(cloneDir, filepath.Dir(file)), 0755))
+		Ok(t, ioutil.WriteFile(filepath.Join(cloneDir, file), []byte(contents), 0644))
+	}
+	client := mocks.NewMockClient()
+	e := PlanExecutor{github: client, configReader: &ConfigReader{}, moduleDependents: &ModuleDependents{}}
+	ctx := &CommandContext{
+		BaseRepo: fixtures.Repo,
+		Pull:     fixtures.Pull,
+		Command:  &Command{Name: Plan},
+		Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+
+	t.Log("projects that use a modified module, directly or through another module, should be planned")
+	When(client.GetModifiedFiles(fixtures.Repo, fixtures.Pull)).ThenReturn([]string{"modules/vpc/main.tf", "db/main.tf"}, nil)
+	projects, skipped, failure, err := e.scopeProjects(ctx, cloneDir)
+	Ok(t, err)
+	Equals(t, "", failure)
+	var paths []string
+	for _, project := range projects {
+		paths = append(paths, project.Path)
+	}
+	Equals(t, []string{"db", "nested", "vpc"}, paths)
+	Equals(t, 1, skipped)
+
+	t.Log("and only modified projects without module dependents")
+	e.moduleDependents = nil
+	projects, skipped, failure, err = e.scopeProjects(ctx, cloneDir)
+	Ok(t, err)
+	Equals(t, []models.Project{models.NewProject(fixtures.Repo.FullName, "db")}, projects)
+	Equals(t, 3, skipped)
+
+	t.Log("modules that no project uses shouldn't plan anything")
+	When(client.GetModifiedFiles(fixtures.Repo, fixtures.Pull)).ThenReturn([]string{"modules/unused/main.tf"}, nil)
+	e.moduleDependents = &ModuleDependents{}
+	_, _, failure, err = e.scopeProjects(ctx, cloneDir)
+	Ok(t, err)
+	Equals(t, "No Terraform files were modified.", failure)
+}
+
+// initTerraform is a terraform executable that records the commands it runs
+// in the file "calls" in the directory it's run in. Its init fails like the
+// network did once if there's a flaky file, and for good if there's a broken
+// file. Its workspaces can't be selected or created if there's a noworkspace
+// file. Its plan fails if there's an invalid file.
+var initTerraform = `#!/bin/sh
+if [ "$1" = "version" ]; then
+  echo "Terraform v0.10.0"
+  exit 0
+fi
+echo "$1" >> calls
+if [ "$1" = "init" ] && [ -f flaky ] && [ ! -f retried ]; then
+  touch retried
+  echo "Error: Failed to query available provider packages: net/http: TLS handshake timeout" 1>&2
+  exit 1
+fi
+if [ "$1" = "init" ] && [ -f broken ]; then
+  echo "Initializing the backend..."
+  echo "Error: Unsupported argument" 1>&2
+  exit 1
+fi
+if [ "$1" = "workspace" ] && [ -f noworkspace ]; then
+  echo "Error: workspace unavailable" 1>&2
+  exit 1
+fi
+if [ "$1" = "plan" ] && [ -f invalid ]; then
+  echo "Error: Invalid resource type" 1>&2
+  exit 1
+fi
+if [ "$1" = "plan" ] && [ "$4" = "-out" ]; then
+  touch "$5"
+fi
+`
+
+func TestRunInit_Retry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(dir)
+	Ok(t, ioutil.WriteFile(filepath.Join(dir, "terraform"), []byte(initTerraform), 0755))
+	oldPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", oldPath)
+	os.Setenv("PATH", dir+":"+oldPath)
+	oldDelay := initRetryDelay
+	defer func() { initRetryDelay = oldDelay }()
+	initRetryDelay = time.Millisecond
+	tf, err := terraform.NewClient("", "")
+	Ok(t, err)
+	ctx := &CommandContext{
+		Command: &Command{Name: Plan, Environment: "default"},
+		Log:     logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+	e := PlanExecutor{terraform: tf}
+	for _, project := range []string{"flaky", "broken"} {
+		Ok(t, os.Mkdir(filepath.Join(dir, project), 0755))
+		Ok(t, ioutil.WriteFile(filepath.Join(dir, project, project), []byte(""), 0644))
+	}
+
+	t.Log("init failures that look like the network's should be retried")
+	_, err = e.runInit(ctx, filepath.Join(dir, "flaky"), "default", nil, tf.Version(), nil)
+	Ok(t, err)
+	calls, err := ioutil.ReadFile(filepath.Join(dir, "flaky", "calls"))
+	Ok(t, err)
+	Equals(t, "init\ninit\n", string(calls))
+
+	t.Log("other init failures shouldn't be")
+	_, err = e.runInit(ctx, filepath.Join(dir, "broken"), "default", nil, tf.Version(), nil)
+	Assert(t, err != nil, "expected an error")
+	calls, err = ioutil.ReadFile(filepath.Join(dir, "broken", "calls"))
+	Ok(t, err)
+	Equals(t, "init\n", string(calls))
+}
+
+func TestPlan_InitFailure(t *testing.T) {
+	RegisterMockTestingT(t)
+	dir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(dir)
+	Ok(t, ioutil.WriteFile(filepath.Join(dir, "terraform"), []byte(initTerraform), 0755))
+	oldPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", oldPath)
+	os.Setenv("PATH", dir+":"+oldPath)
+	tf, err := terraform.NewClient("", "")
+	Ok(t, err)
+	locker := lockmocks.NewMockLocker()
+	for _, project := range []string{"broken", "noworkspace", "invalid"} {
+		When(locker.TryLock(models.NewProject("owner/repo", project), "default", fixtures.Pull, fixtures.User)).ThenReturn(locking.TryLockResponse{LockAcquired: true, LockKey: "key"}, nil)
+	}
+	e := PlanExecutor{terraform: tf, locker: locker, configReader: &ConfigReader{}}
+	ctx := &CommandContext{
+		BaseRepo: fixtures.Repo,
+		Pull:     fixtures.Pull,
+		User:     fixtures.User,
+		Command:  &Command{Name: Plan, Environment: "default"},
+		Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+	for _, project := range []string{"broken", "noworkspace", "invalid"} {
+		Ok(t, os.Mkdir(filepath.Join(dir, project), 0755))
+		Ok(t, ioutil.WriteFile(filepath.Join(dir, project, project), []byte(""), 0644))
+	}
+
+	t.Log("init failures should name the init step and have the end of its output")
+	result := e.plan(ctx, dir, models.NewProject("owner/repo", "broken"))
+	Equals(t, "`terraform init` failed so the plan didn't run:\n```\nError: Unsupported argument\n```", result.Failure)
+	Assert(t, result.Error == nil, "expected no error but got %v", result.Error)
+
+	t.Log("workspaces that can't be selected should error")
+	result = e.plan(ctx, dir, models.NewProject("owner/repo", "noworkspace"))
+	Assert(t, result.Error != nil, "expected an error")
+
+	t.Log("plan failures should still be errors")
+	result = e.plan(ctx, dir, models.NewProject("owner/repo", "invalid"))
+	Equals(t, "", result.Failure)
+	Assert(t, result.Error != nil && strings.Contains(result.Error.Error(), "Error: Invalid resource type"), "expected the plan's error but got %v", result.Error)
+	t.Log("each failed project should be unlocked")
+	locker.VerifyWasCalled(Times(3)).Unlock("key")
+}
+
+func TestPlan_WorkspaceDiscoveryFailure(t *testing.T) {
+	RegisterMockTestingT(t)
+	dir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(dir)
+	Ok(t, ioutil.WriteFile(filepath.Join(dir, "terraform"), []byte(initTerraform), 0755))
+	oldPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", oldPath)
+	os.Setenv("PATH", dir+":"+oldPath)
+	tf, err := terraform.NewClient("", "")
+	Ok(t, err)
+	locker := lockmocks.NewMockLocker()
+	project := models.NewProject("owner/repo", "noworkspace")
+	When(locker.TryLock(project, "default", fixtures.Pull, fixtures.User)).ThenReturn(locking.TryLockResponse{LockAcquired: true, LockKey: "key"}, nil)
+	e := PlanExecutor{terraform: tf, locker: locker, configReader: &ConfigReader{}, workspaceDiscovery: NewWorkspaceDiscovery(tf), requireConfiguredEnvs: true}
+	ctx := &CommandContext{
+		BaseRepo: fixtures.Repo,
+		Pull:     fixtures.Pull,
+		User:     fixtures.User,
+		Command:  &Command{Name: Plan, Environment: "default"},
+		Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+	Ok(t, os.Mkdir(filepath.Join(dir, "noworkspace"), 0755))
+	Ok(t, ioutil.WriteFile(filepath.Join(dir, "noworkspace", "noworkspace"), []byte(""), 0644))
+
+	t.Log("if the configured environments can't be listed the project should be unlocked")
+	result := e.plan(ctx, dir, project)
+	Assert(t, result.Error != nil, "expected an error")
+	locker.VerifyWasCalledOnce().Unlock("key")
+
+	t.Log("and so should it if the workspaces can't be listed for -w")
+	ctx.Command.WorkspaceFlag = true
+	result = e.plan(ctx, dir, project)
+	Assert(t, result.Error != nil, "expected an error")
+	locker.VerifyWasCalled(Times(2)).Unlock("key")
+}
+
+func TestPlan_HookFailure(t *testing.T) {
+	RegisterMockTestingT(t)
+	dir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(dir)
+	Ok(t, ioutil.WriteFile(filepath.Join(dir, "terraform"), []byte(initTerraform), 0755))
+	oldPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", oldPath)
+	os.Setenv("PATH", dir+":"+oldPath)
+	tf, err := terraform.NewClient("", "")
+	Ok(t, err)
+	locker := lockmocks.NewMockLocker()
+	configs := map[string]string{
+		"pre":  "pre_plan:\n  commands:\n  - echo generating $ATLANTIS_REPO#$ATLANTIS_PULL_NUM\n  - exit 3\n",
+		"post": "post_plan:\n  commands:\n  - echo notifying $ATLANTIS_USER about $ATLANTIS_HEAD_BRANCH in $(basename $(pwd))\n  - exit 1\n",
+	}
+	for project, config := range configs {
+		When(locker.TryLock(models.NewProject("owner/repo", project), "default", fixtures.Pull, fixtures.User)).ThenReturn(locking.TryLockResponse{LockAcquired: true, LockKey: project}, nil)
+		Ok(t, os.Mkdir(filepath.Join(dir, project), 0755))
+		Ok(t, ioutil.WriteFile(filepath.Join(dir, project, ProjectConfigFile), []byte(config), 0644))
+	}
+	e := PlanExecutor{terraform: tf, locker: locker, configReader: &ConfigReader{}, run: &run.Run{}}
+	ctx := &CommandContext{
+		BaseRepo: fixtures.Repo,
+		Pull:     fixtures.Pull,
+		User:     fixtures.User,
+		Command:  &Command{Name: Plan, Environment: "default"},
+		Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+
+	t.Log("a failed pre_plan should stop the plan and unlock the project")
+	result := e.plan(ctx, dir, models.NewProject("owner/repo", "pre"))
+	Equals(t, "`pre_plan` commands failed (exit status 3) so the plan didn't run:\n```\ngenerating "+fixtures.Repo.FullName+"#1\n```", result.Failure)
+	locker.VerifyWasCalledOnce().Unlock("pre")
+	calls, _ := ioutil.ReadFile(filepath.Join(dir, "pre", "calls"))
+	Assert(t, !strings.Contains(string(calls), "plan"), "expected plan not to run but got calls %q", calls)
+
+	t.Log("a failed post_plan should fail the project with its output, delete the plan and unlock the project")
+	result = e.plan(ctx, dir, models.NewProject("owner/repo", "post"))
+	Equals(t, "`post_plan` commands failed (exit status 1) after the plan succeeded:\n```\nnotifying "+fixtures.User.Username+" about branch in post\n```", result.Failure)
+	locker.VerifyWasCalledOnce().Unlock("post")
+	_, err = os.Stat(planFile(dir, "post", "default"))
+	Assert(t, os.IsNotExist(err), "expected the plan to be deleted but got %v", err)
+}
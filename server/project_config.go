@@ -1,17 +1,33 @@
 package server
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	version "github.com/hashicorp/go-version"
+	"github.com/hootsuite/atlantis/models"
 	"github.com/pkg/errors"
 	yaml "gopkg.in/yaml.v2"
 )
 
 const ProjectConfigFile = "atlantis.yaml"
 
+// AutoTerraformVersion is the terraform_version that picks the version of
+// terraform from the project's required_version.
+const AutoTerraformVersion = "auto"
+
+const (
+	// RespectBackendConfig means -backend-config init arguments are dropped
+	// if the project fully declares its backend.
+	RespectBackendConfig = "respect"
+	// InjectBackendConfig means -backend-config init arguments are always used.
+	InjectBackendConfig = "inject"
+)
+
 type PrePlan struct {
 	Commands []string `yaml:"commands"`
 }
@@ -28,15 +44,53 @@ type PostApply struct {
 	Commands []string `yaml:"commands"`
 }
 
+// ApplyApprovers are the users and teams that must approve a pull request
+// before it can be applied to an environment.
+type ApplyApprovers struct {
+	Environment string `yaml:"environment"`
+	// Approvers are GitHub usernames or org/team names, ex. lkysow or hootsuite/sre
+	Approvers []string `yaml:"approvers"`
+	// MinApprovals is how many of Approvers must approve. Defaults to 1.
+	MinApprovals int `yaml:"min_approvals"`
+}
+
+// AssumeRole is the AWS IAM role terraform assumes when it's run for a
+// project in an environment.
+type AssumeRole struct {
+	// Environment is the environment the role is for. If empty, the role is
+	// used for every environment that doesn't have its own.
+	Environment string `yaml:"environment"`
+	RoleARN     string `yaml:"role_arn"`
+	// SourceProfile is the profile in the server's AWS credentials file
+	// whose credentials assume the role. Defaults to "default".
+	SourceProfile string `yaml:"source_profile"`
+	// CredentialSource is where to get the credentials that assume the role
+	// instead of a profile: Ec2InstanceMetadata, EcsContainer or Environment.
+	CredentialSource string `yaml:"credential_source"`
+}
+
 type ConfigReader struct{}
 
 type ProjectConfigYaml struct {
-	PrePlan          PrePlan                 `yaml:"pre_plan"`
-	PostPlan         PostPlan                `yaml:"post_plan"`
-	PreApply         PreApply                `yaml:"pre_apply"`
-	PostApply        PostApply               `yaml:"post_apply"`
-	TerraformVersion string                  `yaml:"terraform_version"`
-	ExtraArguments   []CommandExtraArguments `yaml:"extra_arguments"`
+	PrePlan               PrePlan                 `yaml:"pre_plan"`
+	PostPlan              PostPlan                `yaml:"post_plan"`
+	PreApply              PreApply                `yaml:"pre_apply"`
+	PostApply             PostApply               `yaml:"post_apply"`
+	TerraformVersion      string                  `yaml:"terraform_version"`
+	ExtraArguments        []CommandExtraArguments `yaml:"extra_arguments"`
+	ApplyApprovers        []ApplyApprovers        `yaml:"apply_approvers"`
+	BackendConfig         string                  `yaml:"backend_config"`
+	AllowedEnvVars        []string                `yaml:"allowed_env_vars"`
+	Environments          []string                `yaml:"environments"`
+	Parallelism           int                     `yaml:"parallelism"`
+	LockTimeout           string                  `yaml:"lock_timeout"`
+	AllowedFlags          []string                `yaml:"allowed_flags"`
+	DeniedFlags           []string                `yaml:"denied_flags"`
+	AllowLocalState       bool                    `yaml:"allow_local_state"`
+	AllowProviderUpgrades bool                    `yaml:"allow_provider_upgrades"`
+	PlanScope             string                  `yaml:"plan_scope"`
+	DependsOn             []string                `yaml:"depends_on"`
+	AssumeRoles           []AssumeRole            `yaml:"assume_roles"`
 }
 
 type ProjectConfig struct {
@@ -46,7 +100,45 @@ type ProjectConfig struct {
 	PostApply PostApply
 	// TerraformVersion is the version specified in the config file or nil if version wasn't specified
 	TerraformVersion *version.Version
-	ExtraArguments   []CommandExtraArguments
+	// DetectTerraformVersion is true if terraform_version is auto so the
+	// version is chosen to satisfy the project's required_version
+	DetectTerraformVersion bool
+	ExtraArguments         []CommandExtraArguments
+	ApplyApprovers         []ApplyApprovers
+	// InjectBackendConfig is true if -backend-config init arguments should be
+	// used even if the project fully declares its backend
+	InjectBackendConfig bool
+	// AllowedEnvVars are the environment variables that can be set from a
+	// comment with --env KEY=value
+	AllowedEnvVars []string
+	// Environments are the environments planned with --all-envs. If not set,
+	// the default environment and those with an env/{env}.tfvars file are planned.
+	Environments []string
+	// Parallelism is the -parallelism to run plan and apply with or 0 to use
+	// terraform's default. It's overridden by -parallelism in a comment.
+	Parallelism int
+	// LockTimeout is the -lock-timeout to run plan and apply with or empty to
+	// use the server's default. It's overridden by -lock-timeout in a comment.
+	LockTimeout string
+	// AllowedFlags, if set, are the only terraform flags that can be used in
+	// a comment. See TerraformFlagPolicy.
+	AllowedFlags []string
+	// DeniedFlags are terraform flags that can't be used in a comment.
+	DeniedFlags []string
+	// AllowLocalState is true if the project is meant to keep its state
+	// locally so we shouldn't warn that it has no backend
+	AllowLocalState bool
+	// AllowProviderUpgrades is true if we shouldn't warn when a provider's
+	// major version changed since the last apply
+	AllowProviderUpgrades bool
+	// PlanScope is the scope of projects planned when the comment doesn't
+	// set one. It's only read from the atlantis.yaml at the root of the repo.
+	PlanScope string
+	// DependsOn are the paths, relative to the repo root, of the projects
+	// that must be applied before this one when they're applied together
+	DependsOn []string
+	// AssumeRoles are the AWS roles terraform assumes in each environment
+	AssumeRoles []AssumeRole
 }
 
 type CommandExtraArguments struct {
@@ -61,34 +153,143 @@ func (c *ConfigReader) Exists(execPath string) bool {
 }
 
 func (c *ConfigReader) Read(execPath string) (ProjectConfig, error) {
-	var pc ProjectConfig
 	filename := filepath.Join(execPath, ProjectConfigFile)
 	raw, err := ioutil.ReadFile(filename)
 	if err != nil {
-		return pc, errors.Wrapf(err, "reading %s", ProjectConfigFile)
+		return ProjectConfig{}, errors.Wrapf(err, "reading %s", ProjectConfigFile)
 	}
+	return c.Parse(raw)
+}
+
+// Parse parses the contents of a project's config file.
+func (c *ConfigReader) Parse(raw []byte) (ProjectConfig, error) {
+	var pc ProjectConfig
 	var pcYaml ProjectConfigYaml
 	if err := yaml.Unmarshal(raw, &pcYaml); err != nil {
 		return pc, errors.Wrapf(err, "parsing %s", ProjectConfigFile)
 	}
 
 	var v *version.Version
-	if pcYaml.TerraformVersion != "" {
+	var err error
+	if pcYaml.TerraformVersion != "" && pcYaml.TerraformVersion != AutoTerraformVersion {
 		v, err = version.NewVersion(pcYaml.TerraformVersion)
 		if err != nil {
 			return pc, errors.Wrap(err, "parsing terraform_version")
 		}
 	}
+	for i, a := range pcYaml.ApplyApprovers {
+		if a.Environment == "" {
+			return pc, errors.New("parsing apply_approvers: environment must be set")
+		}
+		if len(a.Approvers) == 0 {
+			return pc, fmt.Errorf("parsing apply_approvers: no approvers set for environment %s", a.Environment)
+		}
+		if a.MinApprovals < 0 {
+			return pc, fmt.Errorf("parsing apply_approvers: min_approvals for environment %s can't be negative", a.Environment)
+		}
+		if a.MinApprovals == 0 {
+			pcYaml.ApplyApprovers[i].MinApprovals = 1
+		}
+	}
+	if pcYaml.Parallelism < 0 {
+		return pc, errors.New("parsing parallelism: must be a positive integer")
+	}
+	if pcYaml.LockTimeout != "" {
+		if err := validateLockTimeout(pcYaml.LockTimeout); err != nil {
+			return pc, fmt.Errorf("parsing lock_timeout: %q is not a duration, ex. 5m", pcYaml.LockTimeout)
+		}
+	}
+	environmentRoles := make(map[string]bool)
+	for _, r := range pcYaml.AssumeRoles {
+		if !strings.HasPrefix(r.RoleARN, "arn:") {
+			return pc, fmt.Errorf("parsing assume_roles: role_arn %q is not an ARN, ex. arn:aws:iam::123456789012:role/atlantis", r.RoleARN)
+		}
+		if environmentRoles[r.Environment] {
+			if r.Environment == "" {
+				return pc, errors.New("parsing assume_roles: only one role can be set without an environment")
+			}
+			return pc, fmt.Errorf("parsing assume_roles: more than one role set for environment %s", r.Environment)
+		}
+		environmentRoles[r.Environment] = true
+		if r.SourceProfile != "" && r.CredentialSource != "" {
+			return pc, errors.New("parsing assume_roles: only one of source_profile and credential_source can be set")
+		}
+		switch r.CredentialSource {
+		case "", "Ec2InstanceMetadata", "EcsContainer", "Environment":
+		default:
+			return pc, fmt.Errorf("parsing assume_roles: credential_source %q is not one of Ec2InstanceMetadata, EcsContainer or Environment", r.CredentialSource)
+		}
+	}
+	switch pcYaml.PlanScope {
+	case "", AllProjectsScope, ChangedProjectsScope:
+	default:
+		return pc, fmt.Errorf("parsing plan_scope: %q is not one of %s or %s", pcYaml.PlanScope, AllProjectsScope, ChangedProjectsScope)
+	}
+	switch pcYaml.BackendConfig {
+	case "", RespectBackendConfig, InjectBackendConfig:
+	default:
+		return pc, fmt.Errorf("parsing backend_config: %q is not one of %s or %s", pcYaml.BackendConfig, RespectBackendConfig, InjectBackendConfig)
+	}
 	return ProjectConfig{
-		TerraformVersion: v,
-		ExtraArguments:   pcYaml.ExtraArguments,
-		PostApply:        pcYaml.PostApply,
-		PreApply:         pcYaml.PreApply,
-		PrePlan:          pcYaml.PrePlan,
-		PostPlan:         pcYaml.PostPlan,
+		InjectBackendConfig:    pcYaml.BackendConfig == InjectBackendConfig,
+		TerraformVersion:       v,
+		DetectTerraformVersion: pcYaml.TerraformVersion == AutoTerraformVersion,
+		ExtraArguments:         pcYaml.ExtraArguments,
+		ApplyApprovers:         pcYaml.ApplyApprovers,
+		AllowedEnvVars:         pcYaml.AllowedEnvVars,
+		Environments:           pcYaml.Environments,
+		Parallelism:            pcYaml.Parallelism,
+		LockTimeout:            pcYaml.LockTimeout,
+		AllowedFlags:           pcYaml.AllowedFlags,
+		DeniedFlags:            pcYaml.DeniedFlags,
+		AllowLocalState:        pcYaml.AllowLocalState,
+		AllowProviderUpgrades:  pcYaml.AllowProviderUpgrades,
+		PlanScope:              pcYaml.PlanScope,
+		DependsOn:              pcYaml.DependsOn,
+		AssumeRoles:            pcYaml.AssumeRoles,
+		PostApply:              pcYaml.PostApply,
+		PreApply:               pcYaml.PreApply,
+		PrePlan:                pcYaml.PrePlan,
+		PostPlan:               pcYaml.PostPlan,
 	}, nil
 }
 
+// ReadAll parses the config of each of projects in the repo cloned into
+// cloneDir that has one. It returns them keyed by the absolute path of each
+// project.
+func (c *ConfigReader) ReadAll(cloneDir string, projects []models.Project) (map[string]ProjectConfig, error) {
+	configs := make(map[string]ProjectConfig)
+	for _, project := range projects {
+		absolutePath := filepath.Join(cloneDir, project.Path)
+		if _, ok := configs[absolutePath]; ok || !c.Exists(absolutePath) {
+			continue
+		}
+		config, err := c.Read(absolutePath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "project at path %q", project.Path)
+		}
+		configs[absolutePath] = config
+	}
+	return configs, nil
+}
+
+// projectConfig returns the config of the project at absolutePath and whether
+// it has one. Configs that were already read for ctx with ReadAll aren't
+// parsed again.
+func projectConfig(ctx *CommandContext, reader *ConfigReader, absolutePath string) (ProjectConfig, bool, error) {
+	if config, ok := ctx.projectConfigs[absolutePath]; ok {
+		return config, true, nil
+	}
+	if !reader.Exists(absolutePath) {
+		return ProjectConfig{}, false, nil
+	}
+	config, err := reader.Read(absolutePath)
+	if err != nil {
+		return ProjectConfig{}, false, err
+	}
+	return config, true, nil
+}
+
 func (c *ProjectConfig) GetExtraArguments(command string) []string {
 	for _, value := range c.ExtraArguments {
 		if value.Name == command {
@@ -97,3 +298,49 @@ func (c *ProjectConfig) GetExtraArguments(command string) []string {
 	}
 	return nil
 }
+
+// DisallowedEnvVars returns the sorted keys of envVars that aren't allowed to
+// be set from a comment.
+func (c *ProjectConfig) DisallowedEnvVars(envVars map[string]string) []string {
+	var disallowed []string
+	for k := range envVars {
+		allowed := false
+		for _, a := range c.AllowedEnvVars {
+			if k == a {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			disallowed = append(disallowed, k)
+		}
+	}
+	sort.Strings(disallowed)
+	return disallowed
+}
+
+// GetApplyApprovers returns the approvers required to apply to env or nil if
+// env doesn't require specific approvers.
+func (c *ProjectConfig) GetApplyApprovers(env string) *ApplyApprovers {
+	for i := range c.ApplyApprovers {
+		if c.ApplyApprovers[i].Environment == env {
+			return &c.ApplyApprovers[i]
+		}
+	}
+	return nil
+}
+
+// GetAssumeRole returns the role to assume in env or nil if terraform should
+// run with the server's credentials.
+func (c *ProjectConfig) GetAssumeRole(env string) *AssumeRole {
+	var fallback *AssumeRole
+	for i := range c.AssumeRoles {
+		switch c.AssumeRoles[i].Environment {
+		case env:
+			return &c.AssumeRoles[i]
+		case "":
+			fallback = &c.AssumeRoles[i]
+		}
+	}
+	return fallback
+}
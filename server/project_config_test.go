@@ -3,8 +3,11 @@ package server
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/hootsuite/atlantis/models"
 	. "github.com/hootsuite/atlantis/testing_util"
 )
 
@@ -61,3 +64,234 @@ func TestConfigFileRead_valid_config(t *testing.T) {
 func writeAtlantisConfigFile(s []byte) error {
 	return ioutil.WriteFile(tempConfigFile, s, 0644)
 }
+
+func TestConfigFileRead_apply_approvers(t *testing.T) {
+	var c ConfigReader
+	writeAtlantisConfigFile([]byte(`
+---
+apply_approvers:
+  - environment: production
+    approvers: ["alice", "hootsuite/sre"]
+    min_approvals: 2
+  - environment: staging
+    approvers: ["bob"]
+`))
+	defer os.Remove(tempConfigFile)
+	config, err := c.Read("/tmp")
+	Ok(t, err)
+	Equals(t, &ApplyApprovers{"production", []string{"alice", "hootsuite/sre"}, 2}, config.GetApplyApprovers("production"))
+	t.Log("min_approvals should default to 1")
+	Equals(t, &ApplyApprovers{"staging", []string{"bob"}, 1}, config.GetApplyApprovers("staging"))
+	Assert(t, config.GetApplyApprovers("default") == nil, "expected no approvers for default")
+}
+
+func TestConfigFileRead_apply_approvers_invalid(t *testing.T) {
+	var c ConfigReader
+	for _, str := range []string{
+		"apply_approvers:\n  - approvers: [alice]\n",
+		"apply_approvers:\n  - environment: production\n",
+		"apply_approvers:\n  - environment: production\n    approvers: [alice]\n    min_approvals: -1\n",
+	} {
+		writeAtlantisConfigFile([]byte(str))
+		_, err := c.Read("/tmp")
+		Assert(t, err != nil, "expected an error for %q", str)
+	}
+	os.Remove(tempConfigFile)
+}
+
+func TestConfigFileRead_backend_config(t *testing.T) {
+	var c ConfigReader
+	defer os.Remove(tempConfigFile)
+	for str, inject := range map[string]bool{
+		"---\n":                     false,
+		"backend_config: respect\n": false,
+		"backend_config: inject\n":  true,
+	} {
+		writeAtlantisConfigFile([]byte(str))
+		config, err := c.Read("/tmp")
+		Ok(t, err)
+		Equals(t, inject, config.InjectBackendConfig)
+	}
+
+	writeAtlantisConfigFile([]byte("backend_config: invalid\n"))
+	_, err := c.Read("/tmp")
+	Assert(t, err != nil, "expected an error")
+}
+
+func TestConfigFileRead_allowed_env_vars(t *testing.T) {
+	var c ConfigReader
+	defer os.Remove(tempConfigFile)
+	writeAtlantisConfigFile([]byte("allowed_env_vars: [AWS_REGION, TF_LOG]\n"))
+	config, err := c.Read("/tmp")
+	Ok(t, err)
+	Equals(t, []string{"AWS_REGION", "TF_LOG"}, config.AllowedEnvVars)
+	Equals(t, []string(nil), config.DisallowedEnvVars(map[string]string{"AWS_REGION": "us-west-2"}))
+	Equals(t, []string{"A", "B"}, config.DisallowedEnvVars(map[string]string{"B": "", "TF_LOG": "", "A": ""}))
+}
+
+func TestConfigFileRead_environments(t *testing.T) {
+	var c ConfigReader
+	defer os.Remove(tempConfigFile)
+	writeAtlantisConfigFile([]byte("environments: [staging, production]\n"))
+	config, err := c.Read("/tmp")
+	Ok(t, err)
+	Equals(t, []string{"staging", "production"}, config.Environments)
+}
+
+func TestConfigFileRead_parallelism(t *testing.T) {
+	var c ConfigReader
+	defer os.Remove(tempConfigFile)
+	writeAtlantisConfigFile([]byte("parallelism: 5\n"))
+	config, err := c.Read("/tmp")
+	Ok(t, err)
+	Equals(t, 5, config.Parallelism)
+
+	writeAtlantisConfigFile([]byte("parallelism: -1\n"))
+	_, err = c.Read("/tmp")
+	Equals(t, "parsing parallelism: must be a positive integer", err.Error())
+}
+
+func TestConfigFileRead_flags(t *testing.T) {
+	var c ConfigReader
+	defer os.Remove(tempConfigFile)
+	writeAtlantisConfigFile([]byte("allowed_flags: [-target]\ndenied_flags: [-lock=false]\n"))
+	config, err := c.Read("/tmp")
+	Ok(t, err)
+	Equals(t, []string{"-target"}, config.AllowedFlags)
+	Equals(t, []string{"-lock=false"}, config.DeniedFlags)
+}
+
+func TestConfigFileRead_allow_local_state(t *testing.T) {
+	var c ConfigReader
+	defer os.Remove(tempConfigFile)
+	writeAtlantisConfigFile([]byte("allow_local_state: true\n"))
+	config, err := c.Read("/tmp")
+	Ok(t, err)
+	Equals(t, true, config.AllowLocalState)
+}
+
+func TestConfigFileRead_allow_provider_upgrades(t *testing.T) {
+	var c ConfigReader
+	defer os.Remove(tempConfigFile)
+	writeAtlantisConfigFile([]byte("allow_provider_upgrades: true\n"))
+	config, err := c.Read("/tmp")
+	Ok(t, err)
+	Equals(t, true, config.AllowProviderUpgrades)
+}
+
+func TestConfigFileRead_plan_scope(t *testing.T) {
+	var c ConfigReader
+	defer os.Remove(tempConfigFile)
+	writeAtlantisConfigFile([]byte("plan_scope: all\n"))
+	config, err := c.Read("/tmp")
+	Ok(t, err)
+	Equals(t, AllProjectsScope, config.PlanScope)
+
+	writeAtlantisConfigFile([]byte("plan_scope: everything\n"))
+	_, err = c.Read("/tmp")
+	Assert(t, err != nil, "expected an error")
+	Equals(t, `parsing plan_scope: "everything" is not one of all or changed`, err.Error())
+}
+
+func TestConfigFileRead_depends_on(t *testing.T) {
+	var c ConfigReader
+	defer os.Remove(tempConfigFile)
+	writeAtlantisConfigFile([]byte("depends_on:\n- network\n- database\n"))
+	config, err := c.Read("/tmp")
+	Ok(t, err)
+	Equals(t, []string{"network", "database"}, config.DependsOn)
+}
+
+func TestConfigFileRead_terraform_version_auto(t *testing.T) {
+	var c ConfigReader
+	defer os.Remove(tempConfigFile)
+	writeAtlantisConfigFile([]byte("terraform_version: auto\n"))
+	config, err := c.Read("/tmp")
+	Ok(t, err)
+	Equals(t, true, config.DetectTerraformVersion)
+	Assert(t, config.TerraformVersion == nil, "expected no terraform version but got %s", config.TerraformVersion)
+}
+
+func TestConfigFileRead_lock_timeout(t *testing.T) {
+	var c ConfigReader
+	defer os.Remove(tempConfigFile)
+	writeAtlantisConfigFile([]byte("lock_timeout: 5m\n"))
+	config, err := c.Read("/tmp")
+	Ok(t, err)
+	Equals(t, "5m", config.LockTimeout)
+
+	writeAtlantisConfigFile([]byte("lock_timeout: 5\n"))
+	_, err = c.Read("/tmp")
+	Assert(t, err != nil, "expected an error")
+	Equals(t, `parsing lock_timeout: "5" is not a duration, ex. 5m`, err.Error())
+}
+
+func TestConfigFileRead_assume_roles(t *testing.T) {
+	var c ConfigReader
+	defer os.Remove(tempConfigFile)
+	writeAtlantisConfigFile([]byte(`
+assume_roles:
+  - role_arn: arn:aws:iam::111111111111:role/atlantis
+  - environment: production
+    role_arn: arn:aws:iam::222222222222:role/atlantis
+    credential_source: Ec2InstanceMetadata
+`))
+	config, err := c.Read("/tmp")
+	Ok(t, err)
+	Equals(t, "arn:aws:iam::222222222222:role/atlantis", config.GetAssumeRole("production").RoleARN)
+	Equals(t, "arn:aws:iam::111111111111:role/atlantis", config.GetAssumeRole("staging").RoleARN)
+	Assert(t, (&ProjectConfig{}).GetAssumeRole("staging") == nil, "expected no role")
+
+	cases := []struct {
+		config string
+		err    string
+	}{
+		{"assume_roles:\n  - role_arn: atlantis\n", `parsing assume_roles: role_arn "atlantis" is not an ARN, ex. arn:aws:iam::123456789012:role/atlantis`},
+		{"assume_roles:\n  - role_arn: arn:a\n  - role_arn: arn:b\n", "parsing assume_roles: only one role can be set without an environment"},
+		{"assume_roles:\n  - {environment: prod, role_arn: 'arn:a'}\n  - {environment: prod, role_arn: 'arn:b'}\n", "parsing assume_roles: more than one role set for environment prod"},
+		{"assume_roles:\n  - {role_arn: 'arn:a', source_profile: default, credential_source: EcsContainer}\n", "parsing assume_roles: only one of source_profile and credential_source can be set"},
+		{"assume_roles:\n  - {role_arn: 'arn:a', credential_source: Metadata}\n", `parsing assume_roles: credential_source "Metadata" is not one of Ec2InstanceMetadata, EcsContainer or Environment`},
+	}
+	for _, tc := range cases {
+		writeAtlantisConfigFile([]byte(tc.config))
+		_, err = c.Read("/tmp")
+		Assert(t, err != nil, "expected an error for %q", tc.config)
+		Equals(t, tc.err, err.Error())
+	}
+}
+
+func TestConfigReader_ReadAll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(dir)
+	Ok(t, os.MkdirAll(filepath.Join(dir, "network"), 0755))
+	Ok(t, os.MkdirAll(filepath.Join(dir, "database"), 0755))
+	Ok(t, ioutil.WriteFile(filepath.Join(dir, "network", ProjectConfigFile), []byte("terraform_version: 0.11.14\n"), 0644))
+	reader := &ConfigReader{}
+
+	t.Log("only the projects with a config should be returned")
+	configs, err := reader.ReadAll(dir, []models.Project{models.NewProject("owner/repo", "network"), models.NewProject("owner/repo", "database")})
+	Ok(t, err)
+	Equals(t, 1, len(configs))
+	Equals(t, "0.11.14", configs[filepath.Join(dir, "network")].TerraformVersion.String())
+
+	t.Log("projectConfig should use the configs that were read rather than parsing them again")
+	ctx := &CommandContext{projectConfigs: map[string]ProjectConfig{filepath.Join(dir, "database"): {Parallelism: 3}}}
+	config, ok, err := projectConfig(ctx, reader, filepath.Join(dir, "database"))
+	Ok(t, err)
+	Equals(t, true, ok)
+	Equals(t, 3, config.Parallelism)
+	config, ok, err = projectConfig(ctx, reader, filepath.Join(dir, "network"))
+	Ok(t, err)
+	Equals(t, true, ok)
+	Equals(t, "0.11.14", config.TerraformVersion.String())
+	_, ok, err = projectConfig(ctx, reader, dir)
+	Ok(t, err)
+	Equals(t, false, ok)
+
+	t.Log("a config that can't be parsed should say which project it's for")
+	Ok(t, ioutil.WriteFile(filepath.Join(dir, "database", ProjectConfigFile), []byte("terraform_version: not-a-version\n"), 0644))
+	_, err = reader.ReadAll(dir, []models.Project{models.NewProject("owner/repo", "network"), models.NewProject("owner/repo", "database")})
+	Assert(t, err != nil, "expected an error")
+	Assert(t, strings.HasPrefix(err.Error(), `project at path "database": parsing terraform_version`), "unexpected error %q", err.Error())
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"bytes"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/hootsuite/atlantis/models"
+)
+
+// DefaultProjectExcludes are the comma-separated excludes used if none are
+// configured. They're the directories terraform and terragrunt vendor modules
+// into, which would otherwise be discovered as projects.
+const DefaultProjectExcludes = "**/.terraform/,**/.external_modules/"
+
+// ProjectFinder determines which projects were modified by a pull request.
+// A nil ProjectFinder or one without a Pattern uses the default heuristic:
+// every directory with a modified .tf file is a project, except that files in
+// env/ directories belong to the parent directory and modules are ignored.
+type ProjectFinder struct {
+	// Pattern is a glob, relative to the repo root, that is used instead of the
+	// default heuristic. If it ends with a /, ex. environments/*/, it matches
+	// project directories and every file under a matching directory is part of
+	// the deepest matching project. Otherwise, ex. **/*.tf, it matches files and
+	// the directory of each matching file is a project.
+	Pattern string
+	// Excludes are globs of files, or of directories if they end with a /,
+	// that are never part of a project.
+	Excludes []string
+}
+
+// ProjectFiles returns the files in modifiedFiles that are part of a project.
+func (f *ProjectFinder) ProjectFiles(modifiedFiles []string) []string {
+	if f == nil {
+		return filterToTerraform(modifiedFiles)
+	}
+	files := modifiedFiles
+	if f.Pattern == "" {
+		files = filterToTerraform(modifiedFiles)
+	}
+	var out []string
+	for _, file := range files {
+		if f.excluded(file) {
+			continue
+		}
+		if f.Pattern != "" && f.projectPath(file) == "" {
+			continue
+		}
+		out = append(out, file)
+	}
+	return out
+}
+
+// ModifiedProjects returns the projects that files, which must have been
+// returned by ProjectFiles, are part of.
+func (f *ProjectFinder) ModifiedProjects(repoFullName string, files []string) []models.Project {
+	if f == nil || f.Pattern == "" {
+		return modifiedProjects(repoFullName, files)
+	}
+	var projects []models.Project
+	seenPaths := make(map[string]bool)
+	for _, file := range files {
+		p := f.projectPath(file)
+		if p != "" && !seenPaths[p] {
+			projects = append(projects, models.NewProject(repoFullName, p))
+			seenPaths[p] = true
+		}
+	}
+	return projects
+}
+
+// projectPath returns the path of the project that file is part of according
+// to f.Pattern or "" if it isn't part of any project.
+func (f *ProjectFinder) projectPath(file string) string {
+	if !strings.HasSuffix(f.Pattern, "/") {
+		if matchGlob(f.Pattern, file) {
+			return getProjectPath(file)
+		}
+		return ""
+	}
+	dirPattern := strings.TrimSuffix(f.Pattern, "/")
+	for _, dir := range ancestorDirs(file) {
+		if matchGlob(dirPattern, dir) {
+			return dir
+		}
+	}
+	return ""
+}
+
+// excluded returns true if file matches one of f.Excludes or is in a
+// directory that does.
+func (f *ProjectFinder) excluded(file string) bool {
+	for _, exclude := range f.Excludes {
+		if !strings.HasSuffix(exclude, "/") {
+			if matchGlob(exclude, file) {
+				return true
+			}
+			continue
+		}
+		for _, dir := range ancestorDirs(file) {
+			if matchGlob(strings.TrimSuffix(exclude, "/"), dir) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ancestorDirs returns the directories that contain file, deepest first,
+// ending with "." for the repo root.
+func ancestorDirs(file string) []string {
+	var dirs []string
+	for dir := path.Dir(file); ; dir = path.Dir(dir) {
+		dirs = append(dirs, dir)
+		if dir == "." || dir == "/" {
+			return dirs
+		}
+	}
+}
+
+// matchGlob returns true if name matches the glob pattern in full. As well as
+// * and ?, which don't match /, the pattern can contain ** which matches any
+// number of directories.
+func matchGlob(pattern string, name string) bool {
+	var re bytes.Buffer
+	re.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			re.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			re.WriteString("[^/]*")
+		case pattern[i] == '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		}
+	}
+	re.WriteString("$")
+	return regexp.MustCompile(re.String()).MatchString(name)
+}
@@ -0,0 +1,76 @@
+package server_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hootsuite/atlantis/server"
+	. "github.com/hootsuite/atlantis/testing_util"
+)
+
+func projectFinderPaths(f *server.ProjectFinder, modifiedFiles []string) []string {
+	var paths []string
+	for _, p := range f.ModifiedProjects("owner/repo", f.ProjectFiles(modifiedFiles)) {
+		paths = append(paths, p.Path)
+	}
+	return paths
+}
+
+func TestProjectFinder_Default(t *testing.T) {
+	t.Log("without a pattern the default heuristic should be used")
+	var f *server.ProjectFinder
+	Equals(t, []string{".", "sub"}, projectFinderPaths(f, []string{"main.tf", "README.md", "sub/env/staging.tfvars", "modules/vpc/main.tf"}))
+
+	t.Log("and excludes should still apply")
+	f = &server.ProjectFinder{Excludes: []string{"legacy/"}}
+	Equals(t, []string{"."}, projectFinderPaths(f, []string{"main.tf", "legacy/old/main.tf"}))
+}
+
+func TestProjectFinder_FilePattern(t *testing.T) {
+	f := &server.ProjectFinder{Pattern: "infra/**/*.tf"}
+	Equals(t, []string{"infra", "infra/network/vpc"}, projectFinderPaths(f, []string{
+		"infra/main.tf",
+		"infra/network/vpc/main.tf",
+		"infra/network/vpc/README.md",
+		"apps/main.tf",
+	}))
+}
+
+func TestProjectFinder_DirPattern(t *testing.T) {
+	t.Log("every file under a matching directory should be part of that project")
+	f := &server.ProjectFinder{Pattern: "environments/*/"}
+	Equals(t, []string{"environments/staging", "environments/prod"}, projectFinderPaths(f, []string{
+		"environments/staging/main.tf",
+		"environments/staging/config/values.yaml",
+		"environments/prod/main.tf",
+		"environments/README.md",
+		"main.tf",
+	}))
+}
+
+func TestProjectFinder_Excludes(t *testing.T) {
+	f := &server.ProjectFinder{Pattern: "**/*.tf", Excludes: []string{"**/modules/", "scratch.tf"}}
+	Equals(t, []string{"app"}, projectFinderPaths(f, []string{
+		"app/main.tf",
+		"app/modules/db/main.tf",
+		"modules/vpc/main.tf",
+		"scratch.tf",
+	}))
+}
+
+func TestProjectFinder_NoProjects(t *testing.T) {
+	f := &server.ProjectFinder{Pattern: "environments/*/"}
+	Equals(t, []string(nil), f.ProjectFiles([]string{"main.tf", "README.md"}))
+}
+
+func TestProjectFinder_DefaultExcludes(t *testing.T) {
+	t.Log("vendored modules shouldn't be discovered as projects")
+	f := &server.ProjectFinder{Pattern: "**/*.tf", Excludes: strings.Split(server.DefaultProjectExcludes, ",")}
+	Equals(t, []string{".", "sub"}, projectFinderPaths(f, []string{
+		"main.tf",
+		".terraform/modules/0123/main.tf",
+		"sub/main.tf",
+		"sub/.terraform/modules/vpc/main.tf",
+		"sub/.external_modules/github.com/org/repo/main.tf",
+	}))
+}
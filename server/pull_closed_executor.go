@@ -3,11 +3,14 @@ package server
 import (
 	"bytes"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 	"text/template"
 
 	"github.com/hootsuite/atlantis/github"
 	"github.com/hootsuite/atlantis/locking"
+	"github.com/hootsuite/atlantis/logging"
 	"github.com/hootsuite/atlantis/models"
 	"github.com/pkg/errors"
 )
@@ -16,6 +19,25 @@ type PullClosedExecutor struct {
 	Locker    locking.Locker
 	Github    github.Client
 	Workspace Workspace
+	// ConcurrentRunLocker is used to wait for commands that are still running
+	// for the pull request to finish before deleting their workspace
+	ConcurrentRunLocker *ConcurrentRunLocker
+	// OutputGists deletes the gists the pull request's output was uploaded to
+	OutputGists *OutputGists
+	// Logger logs errors deleting workspaces after the commands using them
+	// finish, since they can't be returned by then
+	Logger *logging.SimpleLogger
+
+	// mutex makes sure a pull request is only cleaned up once at a time so if
+	// GitHub delivers the closed event more than once, only one comment is
+	// made about the deleted locks
+	mutex sync.Mutex
+	// deferredMutex guards deferredDeletes. It's separate from mutex since
+	// it's also locked when a command finishes and deletes its workspace.
+	deferredMutex sync.Mutex
+	// deferredDeletes are the pull requests, keyed by repo and number, whose
+	// workspaces will be deleted once the commands running for them finish
+	deferredDeletes map[string]bool
 }
 
 type templatedProject struct {
@@ -28,12 +50,29 @@ var pullClosedTemplate = template.Must(template.New("").Parse(
 		"{{ range . }}\n" +
 		"- path: `{{ .Path }}` {{ .Envs }}{{ end }}"))
 
+// CleanUpPull deletes the workspace, output gists and locks of pull and
+// comments on it with the locks that were deleted. It's safe to call more
+// than once for the same pull request, ex. if the closed event is delivered
+// again, in which case there's nothing left to delete so it doesn't comment.
 func (p *PullClosedExecutor) CleanUpPull(repo models.Repo, pull models.PullRequest) error {
-	// delete the workspace
-	if err := p.Workspace.Delete(repo, pull); err != nil {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// commands queued behind a running one shouldn't start once it's done
+	p.ConcurrentRunLocker.CancelWaiting(repo.FullName, pull.Num)
+
+	// delete the workspace, but not out from under a command that's still
+	// running in it. In that case it's deleted once the command finishes
+	if err := p.deleteWorkspace(repo, pull); err != nil {
 		return errors.Wrap(err, "cleaning workspace")
 	}
 
+	// a gist that can't be deleted shouldn't stop the locks from being
+	// released so it's only logged
+	if err := p.OutputGists.Delete(repo, pull); err != nil && p.Logger != nil {
+		p.Logger.Warn("deleting output gists for %s#%d: %s", repo.FullName, pull.Num, err)
+	}
+
 	// finally, delete locks. We do this last because when someone
 	// unlocks a project, right now we don't actually delete the plan
 	// so we might have plans laying around but no locks
@@ -55,9 +94,49 @@ func (p *PullClosedExecutor) CleanUpPull(repo models.Repo, pull models.PullReque
 	return p.Github.CreateComment(repo, pull, buf.String())
 }
 
+// deleteWorkspace deletes pull's workspace now if no commands are running
+// for it, or else once they've all finished. If it's already waiting for them
+// from an earlier call, it isn't deleted twice.
+func (p *PullClosedExecutor) deleteWorkspace(repo models.Repo, pull models.PullRequest) error {
+	key := fmt.Sprintf("%s#%d", repo.FullName, pull.Num)
+	p.deferredMutex.Lock()
+	alreadyDeferred := p.deferredDeletes[key]
+	if !alreadyDeferred {
+		if p.deferredDeletes == nil {
+			p.deferredDeletes = make(map[string]bool)
+		}
+		p.deferredDeletes[key] = true
+	}
+	p.deferredMutex.Unlock()
+	if alreadyDeferred {
+		if p.Logger != nil {
+			p.Logger.Info("the workspace for %s#%d will already be deleted when the command running for it finishes", repo.FullName, pull.Num)
+		}
+		return nil
+	}
+
+	var deleteErr error
+	deletedNow := p.ConcurrentRunLocker.WhenPullUnlocked(repo.FullName, pull.Num, func(deferred bool) {
+		err := p.Workspace.Delete(repo, pull)
+		p.deferredMutex.Lock()
+		delete(p.deferredDeletes, key)
+		p.deferredMutex.Unlock()
+		if !deferred {
+			deleteErr = err
+		} else if err != nil && p.Logger != nil {
+			p.Logger.Err("cleaning workspace for %s#%d: %s", repo.FullName, pull.Num, err)
+		}
+	})
+	if !deletedNow && p.Logger != nil {
+		p.Logger.Info("a command is still running for %s#%d so its workspace will be deleted when it finishes", repo.FullName, pull.Num)
+	}
+	return deleteErr
+}
+
 // buildTemplateData formats the lock data into a slice that can easily be templated
 // for the GitHub comment. We organize all the environments by their respective project paths
 // so the comment can look like: path: {path}, environments: {all-envs}
+// The paths and environments are sorted so the comment is always the same.
 func (p *PullClosedExecutor) buildTemplateData(locks []models.ProjectLock) []templatedProject {
 	envsByPath := make(map[string][]string)
 	for _, l := range locks {
@@ -66,7 +145,14 @@ func (p *PullClosedExecutor) buildTemplateData(locks []models.ProjectLock) []tem
 	}
 
 	var projects []templatedProject
-	for p, e := range envsByPath {
+	var paths []string
+	for p := range envsByPath {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		e := envsByPath[p]
+		sort.Strings(e)
 		envsStr := fmt.Sprintf("`%s`", strings.Join(e, "`, `"))
 		if len(e) == 1 {
 			projects = append(projects, templatedProject{
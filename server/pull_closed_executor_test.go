@@ -28,6 +28,87 @@ func TestCleanUpPullWorkspaceErr(t *testing.T) {
 	Equals(t, "cleaning workspace: err", actualErr.Error())
 }
 
+func TestCleanUpPullWhileCommandRunning(t *testing.T) {
+	t.Log("if a command is running when the pull request is closed, its workspace should be deleted once it finishes")
+	RegisterMockTestingT(t)
+	w := mocks.NewMockWorkspace()
+	l := lockmocks.NewMockLocker()
+	runLocker := server.NewConcurrentRunLocker()
+	pce := server.PullClosedExecutor{
+		Locker:              l,
+		Workspace:           w,
+		ConcurrentRunLocker: runLocker,
+	}
+
+	// the command takes the lock like the executors do and holds it until
+	// the pull request has been cleaned up
+	locked := make(chan struct{})
+	cleanedUp := make(chan struct{})
+	commandDone := make(chan struct{})
+	go func() {
+		unlock, ok := runLocker.TryLock(fixtures.Repo.FullName, "default", fixtures.Pull.Num)
+		Assert(t, ok, "expected to get the lock")
+		close(locked)
+		<-cleanedUp
+		unlock()
+		close(commandDone)
+	}()
+
+	<-locked
+	Ok(t, pce.CleanUpPull(fixtures.Repo, fixtures.Pull))
+	w.VerifyWasCalled(Never()).Delete(fixtures.Repo, fixtures.Pull)
+	close(cleanedUp)
+	<-commandDone
+	w.VerifyWasCalledOnce().Delete(fixtures.Repo, fixtures.Pull)
+
+	t.Log("new commands should be able to run after the workspace is deleted")
+	_, ok := runLocker.TryLock(fixtures.Repo.FullName, "default", fixtures.Pull.Num)
+	Equals(t, true, ok)
+}
+
+func TestCleanUpPullTwiceWhileCommandRunning(t *testing.T) {
+	t.Log("if the closed event is delivered again while a command is running, the workspace should only be deleted once")
+	RegisterMockTestingT(t)
+	w := mocks.NewMockWorkspace()
+	l := lockmocks.NewMockLocker()
+	runLocker := server.NewConcurrentRunLocker()
+	pce := server.PullClosedExecutor{
+		Locker:              l,
+		Workspace:           w,
+		ConcurrentRunLocker: runLocker,
+	}
+
+	unlock, ok := runLocker.TryLock(fixtures.Repo.FullName, "default", fixtures.Pull.Num)
+	Assert(t, ok, "expected to get the lock")
+	Ok(t, pce.CleanUpPull(fixtures.Repo, fixtures.Pull))
+	Ok(t, pce.CleanUpPull(fixtures.Repo, fixtures.Pull))
+	unlock()
+	w.VerifyWasCalledOnce().Delete(fixtures.Repo, fixtures.Pull)
+
+	t.Log("once it's been deleted, closing the pull request again should delete it again")
+	Ok(t, pce.CleanUpPull(fixtures.Repo, fixtures.Pull))
+	w.VerifyWasCalled(Times(2)).Delete(fixtures.Repo, fixtures.Pull)
+}
+
+func TestCleanUpPullTwice(t *testing.T) {
+	t.Log("if the closed event is delivered again, we don't comment again")
+	RegisterMockTestingT(t)
+	w := mocks.NewMockWorkspace()
+	l := lockmocks.NewMockLocker()
+	gh := ghmocks.NewMockClient()
+	pce := server.PullClosedExecutor{
+		Locker:    l,
+		Github:    gh,
+		Workspace: w,
+	}
+	locks := []models.ProjectLock{{Project: models.NewProject("owner/repo", "path"), Env: "default"}}
+	When(l.UnlockByPull(fixtures.Repo.FullName, fixtures.Pull.Num)).ThenReturn(locks, nil).ThenReturn(nil, nil)
+	Ok(t, pce.CleanUpPull(fixtures.Repo, fixtures.Pull))
+	Ok(t, pce.CleanUpPull(fixtures.Repo, fixtures.Pull))
+	gh.VerifyWasCalledOnce().CreateComment(AnyRepo(), AnyPullRequest(), AnyString())
+	w.VerifyWasCalled(Times(2)).Delete(fixtures.Repo, fixtures.Pull)
+}
+
 func TestCleanUpPullUnlockErr(t *testing.T) {
 	t.Log("when locker.UnlockByPull returns an error, we return it")
 	RegisterMockTestingT(t)
@@ -0,0 +1,55 @@
+package server
+
+import "github.com/hootsuite/atlantis/github"
+
+// PullLabelNames are the labels added to a pull request for the outcome of
+// each command. An empty name means that outcome isn't labelled.
+type PullLabelNames struct {
+	PlanSuccess  string
+	PlanFailure  string
+	ApplySuccess string
+	ApplyFailure string
+}
+
+// PullLabels labels pull requests with the outcome of the last plan or apply
+// so that automation can key off the labels. Only one of the labels is kept
+// at a time: labelling a new outcome removes the previous label.
+// A nil PullLabels doesn't label.
+type PullLabels struct {
+	Github github.Client
+	Names  PullLabelNames
+}
+
+// Update labels the pull request with the outcome res of command.
+func (p *PullLabels) Update(ctx *CommandContext, command CommandName, res CommandResponse) {
+	if p == nil {
+		return
+	}
+	succeeded := res.Status() == Success
+	var label string
+	switch {
+	case command == Plan && succeeded:
+		label = p.Names.PlanSuccess
+	case command == Plan:
+		label = p.Names.PlanFailure
+	case command == Apply && succeeded:
+		label = p.Names.ApplySuccess
+	case command == Apply:
+		label = p.Names.ApplyFailure
+	}
+
+	for _, old := range []string{p.Names.PlanSuccess, p.Names.PlanFailure, p.Names.ApplySuccess, p.Names.ApplyFailure} {
+		if old == "" || old == label {
+			continue
+		}
+		if err := p.Github.RemoveLabel(ctx.BaseRepo, ctx.Pull, old); err != nil {
+			ctx.Log.Warn("removing label %q: %s", old, err)
+		}
+	}
+	if label == "" {
+		return
+	}
+	if err := p.Github.AddLabel(ctx.BaseRepo, ctx.Pull, label); err != nil {
+		ctx.Log.Warn("adding label %q: %s", label, err)
+	}
+}
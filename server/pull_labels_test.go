@@ -0,0 +1,66 @@
+package server_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hootsuite/atlantis/github/mocks"
+	"github.com/hootsuite/atlantis/models/fixtures"
+	"github.com/hootsuite/atlantis/server"
+	. "github.com/petergtz/pegomock"
+)
+
+var labelNames = server.PullLabelNames{
+	PlanSuccess:  "atlantis/plan-ok",
+	PlanFailure:  "atlantis/plan-failed",
+	ApplySuccess: "atlantis/apply-ok",
+	ApplyFailure: "atlantis/apply-failed",
+}
+
+func TestPullLabels_PlanSuccess(t *testing.T) {
+	t.Log("a successful plan should add its label and remove the others")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	l := server.PullLabels{Github: client, Names: labelNames}
+
+	l.Update(reactionsCtx(1), server.Plan, server.CommandResponse{ProjectResults: []server.ProjectResult{{PlanSuccess: &server.PlanSuccess{}}}})
+
+	client.VerifyWasCalledOnce().AddLabel(fixtures.Repo, fixtures.Pull, "atlantis/plan-ok")
+	client.VerifyWasCalled(Never()).RemoveLabel(fixtures.Repo, fixtures.Pull, "atlantis/plan-ok")
+	client.VerifyWasCalledOnce().RemoveLabel(fixtures.Repo, fixtures.Pull, "atlantis/plan-failed")
+	client.VerifyWasCalledOnce().RemoveLabel(fixtures.Repo, fixtures.Pull, "atlantis/apply-ok")
+	client.VerifyWasCalledOnce().RemoveLabel(fixtures.Repo, fixtures.Pull, "atlantis/apply-failed")
+}
+
+func TestPullLabels_ApplyFailure(t *testing.T) {
+	t.Log("an apply where any project failed should be labelled as failed")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	l := server.PullLabels{Github: client, Names: labelNames}
+
+	l.Update(reactionsCtx(1), server.Apply, server.CommandResponse{ProjectResults: []server.ProjectResult{
+		{ApplySuccess: "success"},
+		{Error: errors.New("err")},
+	}})
+
+	client.VerifyWasCalledOnce().AddLabel(fixtures.Repo, fixtures.Pull, "atlantis/apply-failed")
+	client.VerifyWasCalledOnce().RemoveLabel(fixtures.Repo, fixtures.Pull, "atlantis/apply-ok")
+}
+
+func TestPullLabels_Unset(t *testing.T) {
+	t.Log("outcomes without a label shouldn't be labelled but should still remove the other labels")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	l := server.PullLabels{Github: client, Names: server.PullLabelNames{PlanSuccess: "atlantis/plan-ok"}}
+
+	l.Update(reactionsCtx(1), server.Plan, server.CommandResponse{Failure: "failure"})
+
+	client.VerifyWasCalled(Never()).AddLabel(AnyRepo(), AnyPullRequest(), AnyString())
+	client.VerifyWasCalledOnce().RemoveLabel(fixtures.Repo, fixtures.Pull, "atlantis/plan-ok")
+}
+
+func TestPullLabels_Nil(t *testing.T) {
+	t.Log("a nil PullLabels shouldn't panic")
+	var l *server.PullLabels
+	l.Update(reactionsCtx(1), server.Plan, server.CommandResponse{})
+}
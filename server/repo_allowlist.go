@@ -0,0 +1,41 @@
+package server
+
+import (
+	"github.com/hootsuite/atlantis/models"
+)
+
+// RepoAllowlist decides which repos Atlantis runs commands for, so that a
+// webhook installed on a whole organization, or on the wrong repo, can't run
+// terraform in repos it wasn't meant for. A nil RepoAllowlist allows every
+// repo.
+type RepoAllowlist struct {
+	repos RepoPatterns
+}
+
+// NewRepoAllowlist returns the RepoAllowlist for repos, a comma separated
+// list of patterns like --autoplan-repos, ex. hootsuite/*,github.com/org/repo.
+// If it's empty or includes AllowAllRepos, every repo is allowed.
+func NewRepoAllowlist(repos string) (*RepoAllowlist, error) {
+	patterns, err := NewRepoPatterns(repos)
+	if err != nil {
+		return nil, err
+	}
+	return &RepoAllowlist{patterns}, nil
+}
+
+// IsAllowed returns true if Atlantis should run commands for repo.
+func (r *RepoAllowlist) IsAllowed(repo models.Repo) bool {
+	if r == nil {
+		return true
+	}
+	return r.repos.Matches(repo)
+}
+
+// Lists returns true if one of the patterns matches repo. Unlike IsAllowed,
+// AllowAllRepos doesn't match every repo.
+func (r *RepoAllowlist) Lists(repo models.Repo) bool {
+	if r == nil {
+		return false
+	}
+	return r.repos.Lists(repo)
+}
@@ -0,0 +1,41 @@
+package server_test
+
+import (
+	"testing"
+
+	"github.com/hootsuite/atlantis/models"
+	"github.com/hootsuite/atlantis/server"
+	. "github.com/hootsuite/atlantis/testing_util"
+)
+
+func TestRepoAllowlist_IsAllowed(t *testing.T) {
+	repo := models.Repo{FullName: "hootsuite/atlantis", SanitizedCloneURL: "https://github.com/hootsuite/atlantis.git"}
+
+	t.Log("every repo should be allowed with * or without any repos")
+	for _, repos := range []string{"*", "", "hootsuite/other,*"} {
+		r, err := server.NewRepoAllowlist(repos)
+		Ok(t, err)
+		Equals(t, true, r.IsAllowed(repo))
+	}
+	var nilAllowlist *server.RepoAllowlist
+	Equals(t, true, nilAllowlist.IsAllowed(repo))
+
+	t.Log("only the repos matching a pattern should be allowed, ignoring case")
+	r, err := server.NewRepoAllowlist("Hootsuite/Atlantis, lkysow/*")
+	Ok(t, err)
+	Equals(t, true, r.IsAllowed(repo))
+	Equals(t, true, r.IsAllowed(models.Repo{FullName: "lkysow/terraform"}))
+	Equals(t, false, r.IsAllowed(models.Repo{FullName: "hootsuite/other"}))
+	Equals(t, false, r.IsAllowed(models.Repo{FullName: "other/atlantis"}))
+
+	t.Log("patterns with a host should also match the repo's host")
+	r, err = server.NewRepoAllowlist("GitHub.com/hootsuite/*")
+	Ok(t, err)
+	Equals(t, true, r.IsAllowed(repo))
+	Equals(t, false, r.IsAllowed(models.Repo{FullName: "hootsuite/atlantis", SanitizedCloneURL: "https://github.example.com/hootsuite/atlantis.git"}))
+}
+
+func TestNewRepoAllowlist_InvalidPattern(t *testing.T) {
+	_, err := server.NewRepoAllowlist("hootsuite/[")
+	Assert(t, err != nil, "expected error")
+}
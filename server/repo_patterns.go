@@ -0,0 +1,72 @@
+package server
+
+import (
+	"path"
+	"strings"
+
+	"github.com/hootsuite/atlantis/models"
+	"github.com/pkg/errors"
+)
+
+// AllowAllRepos is the repo pattern that matches every repo.
+const AllowAllRepos = "*"
+
+// RepoPatterns are the repos listed by --repo-allowlist or --autoplan-repos.
+// They're path.Match patterns of the repos' full names, ex. hootsuite/*, or
+// of their host and full name, ex. github.com/hootsuite/atlantis.
+type RepoPatterns struct {
+	// all is true if the patterns include AllowAllRepos or there are none
+	all bool
+	// patterns are lower case since GitHub's hosts and names are case
+	// insensitive
+	patterns []string
+}
+
+// NewRepoPatterns returns the RepoPatterns for repos, a comma separated list
+// of patterns, ex. hootsuite/*,github.com/org/repo. If it's empty or includes
+// AllowAllRepos, every repo matches.
+func NewRepoPatterns(repos string) (RepoPatterns, error) {
+	var r RepoPatterns
+	for _, pattern := range strings.Split(repos, ",") {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if pattern == AllowAllRepos {
+			r.all = true
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return RepoPatterns{}, errors.Wrapf(err, "parsing %q", pattern)
+		}
+		r.patterns = append(r.patterns, pattern)
+	}
+	if len(r.patterns) == 0 {
+		r.all = true
+	}
+	return r, nil
+}
+
+// Matches returns true if every repo matches or one of the patterns matches
+// repo.
+func (r RepoPatterns) Matches(repo models.Repo) bool {
+	return r.all || r.Lists(repo)
+}
+
+// Lists returns true if one of the patterns matches repo. Unlike Matches,
+// AllowAllRepos doesn't match every repo.
+func (r RepoPatterns) Lists(repo models.Repo) bool {
+	fullName := strings.ToLower(repo.FullName)
+	hostName := strings.ToLower(cloneURLHost(repo.SanitizedCloneURL)) + "/" + fullName
+	for _, pattern := range r.patterns {
+		// owner/repo has one slash so patterns with more include the host
+		name := fullName
+		if strings.Count(pattern, "/") > 1 {
+			name = hostName
+		}
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
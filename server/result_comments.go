@@ -0,0 +1,252 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hootsuite/atlantis/github"
+)
+
+const (
+	// KeepSupersededComments leaves previous result comments as they are.
+	KeepSupersededComments = "keep"
+	// DeleteSupersededComments deletes previous result comments.
+	DeleteSupersededComments = "delete"
+	// MinimizeSupersededComments hides previous result comments as outdated.
+	MinimizeSupersededComments = "minimize"
+	// EditSupersededComments edits the latest previous result comment to be
+	// the new result so there's one comment per command and environment.
+	EditSupersededComments = "edit"
+)
+
+// ResultComments posts the results of commands as comments on the pull request.
+// Each result comment is tagged with a hidden marker so that when a newer
+// result for the same command and environment is posted, the comments it
+// supersedes can be deleted or minimized.
+type ResultComments struct {
+	Github github.Client
+	// GithubUser is the user Atlantis comments as. Only comments by this
+	// user are cleaned up.
+	GithubUser string
+	// Superseded is what to do with superseded comments, one of
+	// KeepSupersededComments, DeleteSupersededComments,
+	// MinimizeSupersededComments or EditSupersededComments.
+	Superseded string
+	// AcknowledgeCommands is true if a comment should be posted as soon as a
+	// command starts. The comment is then edited to be the result.
+	AcknowledgeCommands bool
+	// SlowCommandThreshold is how long a command can run before a comment is
+	// posted saying it's still running. The comment is updated every
+	// SlowCommandThreshold until the result replaces it. If it's 0, no
+	// progress comments are posted.
+	SlowCommandThreshold time.Duration
+	// Version is the version of Atlantis that's running. It's included in
+	// the footer of each result so behaviour can be traced back to a build.
+	Version string
+}
+
+// footer returns the line identifying the Atlantis version and run that
+// produced a result, or an empty string if neither is known.
+func (r *ResultComments) footer(ctx *CommandContext) string {
+	var parts []string
+	if r.Version != "" {
+		parts = append(parts, r.Version)
+	}
+	if ctx.RunID != "" {
+		parts = append(parts, fmt.Sprintf("run `%s`", ctx.RunID))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\n<sub>Atlantis %s</sub>\n", strings.Join(parts, " "))
+}
+
+// Acknowledge comments that command is running so users know Atlantis
+// received it. The result of the command then replaces this comment.
+func (r *ResultComments) Acknowledge(ctx *CommandContext, command CommandName) {
+	if !r.AcknowledgeCommands {
+		return
+	}
+	// the acknowledgement doesn't have the result marker so it isn't
+	// cleaned up as a superseded result before it's replaced
+	comment := fmt.Sprintf("Running %s for environment `%s`...", command, ctx.Command.Environment)
+	id, err := r.Github.CreateCommentWithID(ctx.BaseRepo, ctx.Pull, comment)
+	if err != nil {
+		ctx.Log.Warn("acknowledging command: %s", err)
+		return
+	}
+	setAckCommentID(ctx, id)
+}
+
+// Queued comments that command is waiting for another command that's running
+// in env to complete before it runs, for up to timeout.
+func (r *ResultComments) Queued(ctx *CommandContext, command CommandName, env string, timeout time.Duration) {
+	comment := fmt.Sprintf("Queued %s for environment `%s` behind another command that is running for this pull request. It will run once that command completes, or give up after %s.", command, env, timeout)
+	if err := r.Github.CreateComment(ctx.BaseRepo, ctx.Pull, comment); err != nil {
+		ctx.Log.Warn("commenting that command is queued: %s", err)
+	}
+}
+
+// TrackProgress comments that command is still running, with how long it's
+// been running, each time another SlowCommandThreshold passes. If the command
+// was acknowledged, the acknowledgement is edited instead. The returned
+// function must be called when the command completes, before its result is
+// posted, so that the result replaces the progress comment.
+func (r *ResultComments) TrackProgress(ctx *CommandContext, command CommandName) func() {
+	if r.SlowCommandThreshold <= 0 {
+		return func() {}
+	}
+	start := time.Now()
+	// the environment is read now since ctx.Command is set to each
+	// environment's command in turn while they run
+	env := ctx.Command.Environment
+	ticker := time.NewTicker(r.SlowCommandThreshold)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	// errors are logged once we've stopped since the log isn't safe to use
+	// while the command is also logging
+	var errs []string
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := r.progress(ctx, command, env, time.Since(start)); err != nil {
+					errs = append(errs, err.Error())
+				}
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(stop)
+		<-done
+		for _, err := range errs {
+			ctx.Log.Warn("commenting on progress: %s", err)
+		}
+	}
+}
+
+// progress posts or edits the progress comment for command which has been
+// running in env for elapsed.
+func (r *ResultComments) progress(ctx *CommandContext, command CommandName, env string, elapsed time.Duration) error {
+	comment := fmt.Sprintf("Still running %s for environment `%s` after %s...", command, env, elapsed/time.Second*time.Second)
+	if id := ackCommentID(ctx); id != 0 {
+		return r.Github.EditComment(ctx.BaseRepo, id, comment)
+	}
+	id, err := r.Github.CreateCommentWithID(ctx.BaseRepo, ctx.Pull, comment)
+	if err != nil {
+		return err
+	}
+	setAckCommentID(ctx, id)
+	return nil
+}
+
+// Create posts comment as the result of command and cleans up any results
+// that it supersedes. If the command was acknowledged, the acknowledgement
+// is edited to be the result instead. When editing superseded comments, the
+// latest previous result is edited instead, unless that fails, ex. because
+// it was deleted.
+func (r *ResultComments) Create(ctx *CommandContext, command CommandName, comment string) {
+	marker := r.marker(command, ctx.Command.Environment)
+
+	// find the old comments before we post the new one so we don't clean
+	// up the comment we just posted
+	var superseded []int
+	if r.Superseded == DeleteSupersededComments || r.Superseded == MinimizeSupersededComments || r.Superseded == EditSupersededComments {
+		comments, err := r.Github.GetComments(ctx.BaseRepo, ctx.Pull)
+		if err != nil {
+			ctx.Log.Warn("getting comments to clean up: %s", err)
+		}
+		for _, c := range comments {
+			if strings.EqualFold(c.User.GetLogin(), r.GithubUser) && strings.Contains(c.GetBody(), marker) {
+				superseded = append(superseded, c.GetID())
+			}
+		}
+	}
+
+	comment += r.footer(ctx)
+	if r.Superseded == EditSupersededComments && len(superseded) > 0 {
+		// comments are listed oldest first
+		if r.edit(ctx, superseded[len(superseded)-1], comment+"\n"+marker) {
+			return
+		}
+		// the other superseded comments are left since there's still one
+		// comment per command and environment from before
+		superseded = nil
+	}
+	if err := r.post(ctx, comment+"\n"+marker); err != nil {
+		ctx.Log.Err("creating comment: %s", err)
+		// keep the old results since the new one didn't make it
+		return
+	}
+
+	for _, id := range superseded {
+		var err error
+		if r.Superseded == DeleteSupersededComments {
+			err = r.Github.DeleteComment(ctx.BaseRepo, id)
+		} else {
+			err = r.Github.MinimizeComment(ctx.BaseRepo, id)
+		}
+		if err != nil {
+			ctx.Log.Warn("cleaning up superseded comment %d: %s", id, err)
+			continue
+		}
+		ctx.Log.Info("cleaned up superseded comment %d", id)
+	}
+}
+
+// edit edits the previous result comment with id to be comment, returning
+// false if it couldn't be. The acknowledgement, if there is one, is deleted
+// since the result isn't replacing it.
+func (r *ResultComments) edit(ctx *CommandContext, id int, comment string) bool {
+	if err := r.Github.EditComment(ctx.BaseRepo, id, comment); err != nil {
+		ctx.Log.Warn("editing previous result comment %d so posting a new one instead: %s", id, err)
+		return false
+	}
+	ctx.Log.Info("edited previous result comment %d", id)
+	if ackID := ackCommentID(ctx); ackID != 0 {
+		if err := r.Github.DeleteComment(ctx.BaseRepo, ackID); err != nil {
+			ctx.Log.Warn("deleting acknowledgement comment %d: %s", ackID, err)
+		}
+	}
+	return true
+}
+
+// post edits the acknowledgement to be comment if there is one, otherwise it
+// creates a new comment.
+func (r *ResultComments) post(ctx *CommandContext, comment string) error {
+	if id := ackCommentID(ctx); id != 0 {
+		err := r.Github.EditComment(ctx.BaseRepo, id, comment)
+		if err == nil {
+			return nil
+		}
+		ctx.Log.Warn("editing acknowledgement comment %d so creating a new comment instead: %s", id, err)
+	}
+	return r.Github.CreateComment(ctx.BaseRepo, ctx.Pull, comment)
+}
+
+// ackCommentID returns the id of the comment acknowledging ctx's command, or
+// 0 if there isn't one.
+func ackCommentID(ctx *CommandContext) int {
+	ctx.ackMutex.Lock()
+	defer ctx.ackMutex.Unlock()
+	return ctx.ackCommentID
+}
+
+// setAckCommentID records that the comment with id acknowledges ctx's
+// command.
+func setAckCommentID(ctx *CommandContext, id int) {
+	ctx.ackMutex.Lock()
+	defer ctx.ackMutex.Unlock()
+	ctx.ackCommentID = id
+}
+
+// marker returns the hidden marker that identifies result comments for
+// command in env.
+func (r *ResultComments) marker(command CommandName, env string) string {
+	return fmt.Sprintf("<!-- atlantis-result: %s %s -->", command, env)
+}
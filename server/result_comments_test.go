@@ -0,0 +1,235 @@
+package server_test
+
+import (
+	"errors"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/hootsuite/atlantis/github/mocks"
+	"github.com/hootsuite/atlantis/logging"
+	"github.com/hootsuite/atlantis/models/fixtures"
+	"github.com/hootsuite/atlantis/server"
+	. "github.com/petergtz/pegomock"
+)
+
+func resultCommentsCtx() *server.CommandContext {
+	return &server.CommandContext{
+		BaseRepo: fixtures.Repo,
+		Pull:     fixtures.Pull,
+		Command:  &server.Command{Name: server.Plan, Environment: "staging"},
+		Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+}
+
+func existingComments() []*github.IssueComment {
+	comment := func(id int, user string, body string) *github.IssueComment {
+		return &github.IssueComment{ID: github.Int(id), User: &github.User{Login: github.String(user)}, Body: github.String(body)}
+	}
+	return []*github.IssueComment{
+		comment(1, "atlantis", "old plan\n<!-- atlantis-result: plan staging -->"),
+		comment(2, "atlantis", "old plan\n<!-- atlantis-result: plan production -->"),
+		comment(3, "atlantis", "old apply\n<!-- atlantis-result: apply staging -->"),
+		comment(4, "someone", "quoting\n<!-- atlantis-result: plan staging -->"),
+		comment(5, "Atlantis", "older plan\n<!-- atlantis-result: plan staging -->"),
+	}
+}
+
+func TestResultComments_Keep(t *testing.T) {
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	r := server.ResultComments{Github: client, GithubUser: "atlantis", Superseded: server.KeepSupersededComments}
+
+	r.Create(resultCommentsCtx(), server.Plan, "new plan")
+	client.VerifyWasCalledOnce().CreateComment(fixtures.Repo, fixtures.Pull, "new plan\n<!-- atlantis-result: plan staging -->")
+	client.VerifyWasCalled(Never()).GetComments(fixtures.Repo, fixtures.Pull)
+}
+
+func TestResultComments_RunID(t *testing.T) {
+	t.Log("the comment should mention the run so it can be found in the logs")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	r := server.ResultComments{Github: client, GithubUser: "atlantis", Superseded: server.KeepSupersededComments}
+	ctx := resultCommentsCtx()
+	ctx.RunID = "abc123"
+
+	r.Create(ctx, server.Plan, "new plan\n")
+	client.VerifyWasCalledOnce().CreateComment(fixtures.Repo, fixtures.Pull, "new plan\n\n<sub>Atlantis run `abc123`</sub>\n\n<!-- atlantis-result: plan staging -->")
+}
+
+func TestResultComments_Version(t *testing.T) {
+	t.Log("the comment should mention the version of Atlantis that produced it")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	r := server.ResultComments{Github: client, GithubUser: "atlantis", Superseded: server.KeepSupersededComments, Version: "0.1.2 (commit 9db70b5)"}
+	ctx := resultCommentsCtx()
+	ctx.RunID = "abc123"
+
+	r.Create(ctx, server.Plan, "new plan\n")
+	client.VerifyWasCalledOnce().CreateComment(fixtures.Repo, fixtures.Pull, "new plan\n\n<sub>Atlantis 0.1.2 (commit 9db70b5) run `abc123`</sub>\n\n<!-- atlantis-result: plan staging -->")
+}
+
+func TestResultComments_Delete(t *testing.T) {
+	t.Log("should only delete comments by atlantis for the same command and environment")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	When(client.GetComments(fixtures.Repo, fixtures.Pull)).ThenReturn(existingComments(), nil)
+	r := server.ResultComments{Github: client, GithubUser: "atlantis", Superseded: server.DeleteSupersededComments}
+
+	r.Create(resultCommentsCtx(), server.Plan, "new plan")
+	client.VerifyWasCalledOnce().CreateComment(fixtures.Repo, fixtures.Pull, "new plan\n<!-- atlantis-result: plan staging -->")
+	client.VerifyWasCalledOnce().DeleteComment(fixtures.Repo, 1)
+	client.VerifyWasCalledOnce().DeleteComment(fixtures.Repo, 5)
+	client.VerifyWasCalled(Never()).DeleteComment(fixtures.Repo, 2)
+	client.VerifyWasCalled(Never()).DeleteComment(fixtures.Repo, 3)
+	client.VerifyWasCalled(Never()).DeleteComment(fixtures.Repo, 4)
+}
+
+func TestResultComments_Minimize(t *testing.T) {
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	When(client.GetComments(fixtures.Repo, fixtures.Pull)).ThenReturn(existingComments(), nil)
+	r := server.ResultComments{Github: client, GithubUser: "atlantis", Superseded: server.MinimizeSupersededComments}
+
+	r.Create(resultCommentsCtx(), server.Plan, "new plan")
+	client.VerifyWasCalledOnce().MinimizeComment(fixtures.Repo, 1)
+	client.VerifyWasCalledOnce().MinimizeComment(fixtures.Repo, 5)
+	client.VerifyWasCalled(Never()).DeleteComment(fixtures.Repo, 1)
+}
+
+func TestResultComments_Edit(t *testing.T) {
+	t.Log("should edit the latest comment by atlantis for the same command and environment")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	When(client.GetComments(fixtures.Repo, fixtures.Pull)).ThenReturn(existingComments(), nil)
+	r := server.ResultComments{Github: client, GithubUser: "atlantis", Superseded: server.EditSupersededComments}
+
+	r.Create(resultCommentsCtx(), server.Plan, "new plan")
+	client.VerifyWasCalledOnce().EditComment(fixtures.Repo, 5, "new plan\n<!-- atlantis-result: plan staging -->")
+	client.VerifyWasCalled(Never()).EditComment(fixtures.Repo, 1, "new plan\n<!-- atlantis-result: plan staging -->")
+	client.VerifyWasCalled(Never()).CreateComment(AnyRepo(), AnyPullRequest(), AnyString())
+	client.VerifyWasCalled(Never()).DeleteComment(AnyRepo(), AnyInt())
+}
+
+func TestResultComments_EditFails(t *testing.T) {
+	t.Log("if the previous result can't be edited, ex. because it was deleted, a new comment should be posted")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	When(client.GetComments(fixtures.Repo, fixtures.Pull)).ThenReturn(existingComments(), nil)
+	When(client.EditComment(fixtures.Repo, 5, "new plan\n<!-- atlantis-result: plan staging -->")).ThenReturn(errors.New("err"))
+	r := server.ResultComments{Github: client, GithubUser: "atlantis", Superseded: server.EditSupersededComments}
+
+	r.Create(resultCommentsCtx(), server.Plan, "new plan")
+	client.VerifyWasCalledOnce().CreateComment(fixtures.Repo, fixtures.Pull, "new plan\n<!-- atlantis-result: plan staging -->")
+	client.VerifyWasCalled(Never()).DeleteComment(AnyRepo(), AnyInt())
+
+	t.Log("and if there's no previous result at all")
+	client = mocks.NewMockClient()
+	r.Github = client
+	r.Create(resultCommentsCtx(), server.Plan, "new plan")
+	client.VerifyWasCalledOnce().CreateComment(fixtures.Repo, fixtures.Pull, "new plan\n<!-- atlantis-result: plan staging -->")
+}
+
+func TestResultComments_EditAcknowledged(t *testing.T) {
+	t.Log("the acknowledgement should be deleted once the previous result is edited")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	When(client.GetComments(fixtures.Repo, fixtures.Pull)).ThenReturn(existingComments(), nil)
+	When(client.CreateCommentWithID(fixtures.Repo, fixtures.Pull, "Running plan for environment `staging`...")).ThenReturn(7, nil)
+	r := server.ResultComments{Github: client, GithubUser: "atlantis", Superseded: server.EditSupersededComments, AcknowledgeCommands: true}
+	ctx := resultCommentsCtx()
+
+	r.Acknowledge(ctx, server.Plan)
+	r.Create(ctx, server.Plan, "new plan")
+	client.VerifyWasCalledOnce().EditComment(fixtures.Repo, 5, "new plan\n<!-- atlantis-result: plan staging -->")
+	client.VerifyWasCalledOnce().DeleteComment(fixtures.Repo, 7)
+	client.VerifyWasCalled(Never()).EditComment(fixtures.Repo, 7, "new plan\n<!-- atlantis-result: plan staging -->")
+}
+
+func TestResultComments_CreateFails(t *testing.T) {
+	t.Log("if the new comment can't be posted the old ones should be kept")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	When(client.GetComments(fixtures.Repo, fixtures.Pull)).ThenReturn(existingComments(), nil)
+	When(client.CreateComment(fixtures.Repo, fixtures.Pull, "new plan\n<!-- atlantis-result: plan staging -->")).ThenReturn(errors.New("err"))
+	r := server.ResultComments{Github: client, GithubUser: "atlantis", Superseded: server.DeleteSupersededComments}
+
+	r.Create(resultCommentsCtx(), server.Plan, "new plan")
+	client.VerifyWasCalled(Never()).DeleteComment(fixtures.Repo, 1)
+}
+
+func TestResultComments_Acknowledge(t *testing.T) {
+	t.Log("the acknowledgement should be edited to be the result")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	When(client.CreateCommentWithID(fixtures.Repo, fixtures.Pull, "Running plan for environment `staging`...")).ThenReturn(7, nil)
+	r := server.ResultComments{Github: client, GithubUser: "atlantis", Superseded: server.KeepSupersededComments, AcknowledgeCommands: true}
+	ctx := resultCommentsCtx()
+
+	r.Acknowledge(ctx, server.Plan)
+	r.Create(ctx, server.Plan, "new plan")
+
+	client.VerifyWasCalledOnce().EditComment(fixtures.Repo, 7, "new plan\n<!-- atlantis-result: plan staging -->")
+	client.VerifyWasCalled(Never()).CreateComment(AnyRepo(), AnyPullRequest(), AnyString())
+}
+
+func TestResultComments_AcknowledgeEditFails(t *testing.T) {
+	t.Log("if editing the acknowledgement fails the result should be posted as a new comment")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	When(client.CreateCommentWithID(fixtures.Repo, fixtures.Pull, "Running plan for environment `staging`...")).ThenReturn(7, nil)
+	When(client.EditComment(fixtures.Repo, 7, "new plan\n<!-- atlantis-result: plan staging -->")).ThenReturn(errors.New("err"))
+	r := server.ResultComments{Github: client, GithubUser: "atlantis", Superseded: server.KeepSupersededComments, AcknowledgeCommands: true}
+	ctx := resultCommentsCtx()
+
+	r.Acknowledge(ctx, server.Plan)
+	r.Create(ctx, server.Plan, "new plan")
+
+	client.VerifyWasCalledOnce().CreateComment(fixtures.Repo, fixtures.Pull, "new plan\n<!-- atlantis-result: plan staging -->")
+}
+
+func TestResultComments_AcknowledgeDisabled(t *testing.T) {
+	t.Log("if acknowledging is disabled nothing should be commented")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	r := server.ResultComments{Github: client, GithubUser: "atlantis", Superseded: server.KeepSupersededComments}
+
+	r.Acknowledge(resultCommentsCtx(), server.Plan)
+
+	client.VerifyWasCalled(Never()).CreateCommentWithID(AnyRepo(), AnyPullRequest(), AnyString())
+}
+
+func TestResultComments_TrackProgress(t *testing.T) {
+	t.Log("slow commands should get a progress comment that's replaced by the result")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	commented := make(chan bool, 1)
+	When(client.CreateCommentWithID(fixtures.Repo, fixtures.Pull, "Still running plan for environment `staging` after 0s...")).Then(func([]Param) ReturnValues {
+		commented <- true
+		return ReturnValues{7, nil}
+	})
+	r := server.ResultComments{Github: client, GithubUser: "atlantis", Superseded: server.KeepSupersededComments, SlowCommandThreshold: time.Millisecond}
+	ctx := resultCommentsCtx()
+
+	stop := r.TrackProgress(ctx, server.Plan)
+	<-commented
+	stop()
+	r.Create(ctx, server.Plan, "new plan")
+
+	client.VerifyWasCalledOnce().CreateCommentWithID(fixtures.Repo, fixtures.Pull, "Still running plan for environment `staging` after 0s...")
+	client.VerifyWasCalledOnce().EditComment(fixtures.Repo, 7, "new plan\n<!-- atlantis-result: plan staging -->")
+	client.VerifyWasCalled(Never()).CreateComment(AnyRepo(), AnyPullRequest(), AnyString())
+}
+
+func TestResultComments_TrackProgressFastCommand(t *testing.T) {
+	t.Log("commands that finish before the threshold shouldn't get a progress comment")
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	r := server.ResultComments{Github: client, GithubUser: "atlantis", Superseded: server.KeepSupersededComments, SlowCommandThreshold: time.Hour}
+
+	r.TrackProgress(resultCommentsCtx(), server.Plan)()
+
+	client.VerifyWasCalled(Never()).CreateCommentWithID(AnyRepo(), AnyPullRequest(), AnyString())
+}
@@ -0,0 +1,290 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/hootsuite/atlantis/terraform"
+	"github.com/pkg/errors"
+)
+
+const resultsBucketName = "pullResults"
+const appliedBucketName = "appliedResults"
+const auditBucketName = "auditLog"
+
+// PullResults are the results of the last plan or apply run on a pull request.
+type PullResults struct {
+	Repo    string          `json:"repo"`
+	Pull    int             `json:"pull"`
+	Command string          `json:"command"`
+	Env     string          `json:"env"`
+	User    string          `json:"user"`
+	RunID   string          `json:"run_id"`
+	Time    time.Time       `json:"time"`
+	Results []ProjectOutput `json:"results"`
+}
+
+// ProjectOutput is the JSON representation of a ProjectResult.
+type ProjectOutput struct {
+	Dir string `json:"dir"`
+	// Env is only set if the command ran in more than one environment
+	Env    string `json:"env,omitempty"`
+	Status string `json:"status"`
+	// Summary is nil if the output had no summary, ex. because it errored
+	Summary         *terraform.Summary `json:"summary,omitempty"`
+	Failure         string             `json:"failure,omitempty"`
+	Error           string             `json:"error,omitempty"`
+	ExitCode        *int               `json:"exit_code,omitempty"`
+	DurationSeconds float64            `json:"duration_seconds"`
+}
+
+// AppliedResult is the last successful apply of a project in an environment.
+type AppliedResult struct {
+	Pull int       `json:"pull"`
+	User string    `json:"user"`
+	Time time.Time `json:"time"`
+	// Summary is nil if the apply output had no summary
+	Summary *terraform.Summary `json:"summary,omitempty"`
+	// Providers are the versions of the providers the apply ran with
+	Providers map[string]string `json:"providers,omitempty"`
+}
+
+// AuditRecord records a successful apply of a project: who applied it and
+// when.
+type AuditRecord struct {
+	Repo  string    `json:"repo"`
+	Pull  int       `json:"pull"`
+	Dir   string    `json:"dir"`
+	Env   string    `json:"env"`
+	User  string    `json:"user"`
+	RunID string    `json:"run_id"`
+	Time  time.Time `json:"time"`
+	// Summary is nil if the apply output had no summary
+	Summary *terraform.Summary `json:"summary,omitempty"`
+}
+
+// ResultsStore stores the latest results of each pull request in BoltDB so
+// they can be served by the results API. It also stores the last successful
+// apply of each project and environment so plans can be compared with it,
+// and an audit log of every successful apply.
+type ResultsStore struct {
+	// Redactor redacts sensitive values from failures and errors before
+	// they're stored. If it's nil, nothing is redacted.
+	Redactor      *OutputRedactor
+	db            *bolt.DB
+	bucket        []byte
+	appliedBucket []byte
+	auditBucket   []byte
+}
+
+func NewResultsStore(db *bolt.DB) (*ResultsStore, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{resultsBucketName, appliedBucketName, auditBucketName} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return errors.Wrapf(err, "creating %q bucket", name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ResultsStore{
+		db:            db,
+		bucket:        []byte(resultsBucketName),
+		appliedBucket: []byte(appliedBucketName),
+		auditBucket:   []byte(auditBucketName),
+	}, nil
+}
+
+// Save replaces the stored results for the pull request in ctx with res.
+// If command is Apply, the successful applies in res also replace the last
+// applies of their projects in ctx.Command.Environment and are added to the
+// audit log.
+func (r *ResultsStore) Save(ctx *CommandContext, command CommandName, res CommandResponse) error {
+	results := PullResults{
+		Repo:    ctx.BaseRepo.FullName,
+		Pull:    ctx.Pull.Num,
+		Command: command.String(),
+		Env:     ctx.Command.Environment,
+		User:    ctx.User.Username,
+		RunID:   ctx.RunID,
+		Time:    time.Now(),
+		Results: []ProjectOutput{},
+	}
+	for _, p := range res.ProjectResults {
+		output := ProjectOutput{
+			Dir:             p.Path,
+			Env:             p.Environment,
+			Status:          p.Status().String(),
+			Failure:         r.Redactor.Redact(p.Failure),
+			DurationSeconds: p.Duration.Seconds(),
+			ExitCode:        p.ExitCode,
+		}
+		if p.Error != nil {
+			output.Error = r.Redactor.Redact(p.Error.Error())
+		}
+		if p.PlanSuccess != nil {
+			output.Summary = terraform.ParseSummary(p.PlanSuccess.TerraformOutput)
+		}
+		if p.ApplySuccess != "" {
+			output.Summary = terraform.ParseSummary(p.ApplySuccess)
+		}
+		if p.DestroySuccess != "" {
+			output.Summary = terraform.ParseSummary(p.DestroySuccess)
+		}
+		results.Results = append(results.Results, output)
+	}
+	// a failure or error for the whole command, ex. the pull wasn't approved,
+	// is stored as a result without a directory
+	if res.Error != nil || res.Failure != "" {
+		output := ProjectOutput{Failure: r.Redactor.Redact(res.Failure), Status: Failure.String()}
+		if res.Error != nil {
+			output.Error = r.Redactor.Redact(res.Error.Error())
+			output.Status = Error.String()
+		}
+		results.Results = append(results.Results, output)
+	}
+
+	serialized, err := json.Marshal(results)
+	if err != nil {
+		return errors.Wrap(err, "serializing results")
+	}
+	applied := make(map[string][]byte)
+	var audited [][]byte
+	for i, p := range res.ProjectResults {
+		if command != Apply || p.Status() != Success {
+			continue
+		}
+		appliedAt := results.Time
+		if !p.AppliedAt.IsZero() {
+			appliedAt = p.AppliedAt
+		}
+		serializedApplied, err := json.Marshal(AppliedResult{
+			Pull:      results.Pull,
+			User:      results.User,
+			Time:      appliedAt,
+			Summary:   results.Results[i].Summary,
+			Providers: p.Providers,
+		})
+		if err != nil {
+			return errors.Wrap(err, "serializing applied result")
+		}
+		// projects applied in more than one environment have their own
+		env := results.Env
+		if p.Environment != "" {
+			env = p.Environment
+		}
+		applied[r.appliedKey(results.Repo, p.Path, env)] = serializedApplied
+
+		serializedAudit, err := json.Marshal(AuditRecord{
+			Repo:    results.Repo,
+			Pull:    results.Pull,
+			Dir:     p.Path,
+			Env:     env,
+			User:    results.User,
+			RunID:   results.RunID,
+			Time:    appliedAt,
+			Summary: results.Results[i].Summary,
+		})
+		if err != nil {
+			return errors.Wrap(err, "serializing audit record")
+		}
+		audited = append(audited, serializedAudit)
+	}
+	return r.db.Update(func(tx *bolt.Tx) error {
+		for k, v := range applied {
+			if err := tx.Bucket(r.appliedBucket).Put([]byte(k), v); err != nil {
+				return err
+			}
+		}
+		audit := tx.Bucket(r.auditBucket)
+		for _, v := range audited {
+			seq, err := audit.NextSequence()
+			if err != nil {
+				return err
+			}
+			if err := audit.Put([]byte(r.auditKey(results.Repo, seq)), v); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(r.bucket).Put([]byte(r.key(results.Repo, results.Pull)), serialized)
+	})
+}
+
+// LastApplied returns the last successful apply of the project at path in env
+// or nil if it's never been applied.
+func (r *ResultsStore) LastApplied(repoFullName string, path string, env string) (*AppliedResult, error) {
+	var serialized []byte
+	err := r.db.View(func(tx *bolt.Tx) error {
+		// copy because the value is only valid for the transaction
+		if v := tx.Bucket(r.appliedBucket).Get([]byte(r.appliedKey(repoFullName, path, env))); v != nil {
+			serialized = append([]byte{}, v...)
+		}
+		return nil
+	})
+	if err != nil || serialized == nil {
+		return nil, err
+	}
+	var applied AppliedResult
+	if err := json.Unmarshal(serialized, &applied); err != nil {
+		return nil, errors.Wrap(err, "deserializing applied result")
+	}
+	return &applied, nil
+}
+
+// AuditLog returns the audit records of the successful applies in the repo,
+// oldest first.
+func (r *ResultsStore) AuditLog(repoFullName string) ([]AuditRecord, error) {
+	records := []AuditRecord{}
+	err := r.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(r.auditBucket).Cursor()
+		prefix := []byte(repoFullName + "#")
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var record AuditRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				return errors.Wrap(err, "deserializing audit record")
+			}
+			records = append(records, record)
+		}
+		return nil
+	})
+	return records, err
+}
+
+// Get returns the stored results for the pull request or nil if there are none.
+func (r *ResultsStore) Get(repoFullName string, pullNum int) (*PullResults, error) {
+	var serialized []byte
+	err := r.db.View(func(tx *bolt.Tx) error {
+		// copy because the value is only valid for the transaction
+		if v := tx.Bucket(r.bucket).Get([]byte(r.key(repoFullName, pullNum))); v != nil {
+			serialized = append([]byte{}, v...)
+		}
+		return nil
+	})
+	if err != nil || serialized == nil {
+		return nil, err
+	}
+	var results PullResults
+	if err := json.Unmarshal(serialized, &results); err != nil {
+		return nil, errors.Wrap(err, "deserializing results")
+	}
+	return &results, nil
+}
+
+func (r *ResultsStore) key(repoFullName string, pullNum int) string {
+	return fmt.Sprintf("%s#%d", repoFullName, pullNum)
+}
+
+// auditKey is zero padded so the records of a repo are sorted in the order
+// they were saved.
+func (r *ResultsStore) auditKey(repoFullName string, seq uint64) string {
+	return fmt.Sprintf("%s#%020d", repoFullName, seq)
+}
+
+func (r *ResultsStore) appliedKey(repoFullName string, path string, env string) string {
+	return fmt.Sprintf("%s#%s#%s", repoFullName, path, env)
+}
@@ -0,0 +1,210 @@
+package server_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/hootsuite/atlantis/logging"
+	"github.com/hootsuite/atlantis/models"
+	"github.com/hootsuite/atlantis/models/fixtures"
+	"github.com/hootsuite/atlantis/server"
+	"github.com/hootsuite/atlantis/terraform"
+	. "github.com/hootsuite/atlantis/testing_util"
+)
+
+func newResultsStore(t *testing.T) (*server.ResultsStore, func()) {
+	f, err := ioutil.TempFile("", "")
+	Ok(t, err)
+	db, err := bolt.Open(f.Name(), 0600, &bolt.Options{Timeout: 1 * time.Second})
+	Ok(t, err)
+	store, err := server.NewResultsStore(db)
+	Ok(t, err)
+	return store, func() {
+		db.Close()
+		os.Remove(f.Name())
+	}
+}
+
+func TestResultsStore_GetNone(t *testing.T) {
+	store, cleanup := newResultsStore(t)
+	defer cleanup()
+	results, err := store.Get(fixtures.Repo.FullName, fixtures.Pull.Num)
+	Ok(t, err)
+	Assert(t, results == nil, "expected no results")
+}
+
+func TestResultsStore_SaveAndGet(t *testing.T) {
+	store, cleanup := newResultsStore(t)
+	defer cleanup()
+	ctx := &server.CommandContext{
+		BaseRepo: fixtures.Repo,
+		Pull:     fixtures.Pull,
+		User:     models.User{Username: "user"},
+		RunID:    "abc123",
+		Command:  &server.Command{Name: server.Plan, Environment: "staging"},
+		Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+	exitCode := 2
+	Ok(t, store.Save(ctx, server.Plan, server.CommandResponse{ProjectResults: []server.ProjectResult{
+		{
+			Path:        ".",
+			PlanSuccess: &server.PlanSuccess{TerraformOutput: "Plan: 1 to add, 0 to change, 2 to destroy."},
+			Duration:    2 * time.Second,
+			ExitCode:    &exitCode,
+		},
+		{
+			Path:  "sub",
+			Error: errors.New("error"),
+		},
+	}}))
+
+	results, err := store.Get(fixtures.Repo.FullName, fixtures.Pull.Num)
+	Ok(t, err)
+	Equals(t, fixtures.Repo.FullName, results.Repo)
+	Equals(t, fixtures.Pull.Num, results.Pull)
+	Equals(t, "plan", results.Command)
+	Equals(t, "staging", results.Env)
+	Equals(t, "user", results.User)
+	Equals(t, "abc123", results.RunID)
+	Equals(t, []server.ProjectOutput{
+		{
+			Dir:             ".",
+			Status:          "success",
+			Summary:         &terraform.Summary{Add: 1, Change: 0, Destroy: 2},
+			DurationSeconds: 2,
+			ExitCode:        &exitCode,
+		},
+		{
+			Dir:    "sub",
+			Status: "error",
+			Error:  "error",
+		},
+	}, results.Results)
+
+	t.Log("saving again should replace the results")
+	Ok(t, store.Save(ctx, server.Apply, server.CommandResponse{Failure: "failure"}))
+	results, err = store.Get(fixtures.Repo.FullName, fixtures.Pull.Num)
+	Ok(t, err)
+	Equals(t, "apply", results.Command)
+	Equals(t, []server.ProjectOutput{{Status: "failure", Failure: "failure"}}, results.Results)
+}
+
+func TestResultsStore_LastApplied(t *testing.T) {
+	store, cleanup := newResultsStore(t)
+	defer cleanup()
+	ctx := &server.CommandContext{
+		BaseRepo: fixtures.Repo,
+		Pull:     fixtures.Pull,
+		User:     models.User{Username: "user"},
+		Command:  &server.Command{Name: server.Apply, Environment: "staging"},
+		Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+	applied, err := store.LastApplied(fixtures.Repo.FullName, ".", "staging")
+	Ok(t, err)
+	Assert(t, applied == nil, "expected no applied result")
+
+	t.Log("plans shouldn't be stored as applied")
+	Ok(t, store.Save(ctx, server.Plan, server.CommandResponse{ProjectResults: []server.ProjectResult{
+		{Path: ".", PlanSuccess: &server.PlanSuccess{TerraformOutput: "Plan: 1 to add, 0 to change, 0 to destroy."}},
+	}}))
+	applied, err = store.LastApplied(fixtures.Repo.FullName, ".", "staging")
+	Ok(t, err)
+	Assert(t, applied == nil, "expected no applied result")
+
+	t.Log("only successful applies should be stored")
+	Ok(t, store.Save(ctx, server.Apply, server.CommandResponse{ProjectResults: []server.ProjectResult{
+		{Path: ".", ApplySuccess: "Apply complete! Resources: 1 added, 0 changed, 0 destroyed.", Providers: map[string]string{"aws": "1.2.0"}, AppliedBy: "user", AppliedAt: time.Date(2017, 9, 1, 10, 0, 0, 0, time.UTC)},
+		{Path: "sub", Error: errors.New("error")},
+	}}))
+	applied, err = store.LastApplied(fixtures.Repo.FullName, ".", "staging")
+	Ok(t, err)
+	Equals(t, fixtures.Pull.Num, applied.Pull)
+	Equals(t, "user", applied.User)
+	Equals(t, time.Date(2017, 9, 1, 10, 0, 0, 0, time.UTC), applied.Time)
+	Equals(t, &terraform.Summary{Add: 1}, applied.Summary)
+	Equals(t, map[string]string{"aws": "1.2.0"}, applied.Providers)
+	applied, err = store.LastApplied(fixtures.Repo.FullName, "sub", "staging")
+	Ok(t, err)
+	Assert(t, applied == nil, "expected no applied result for the failed apply")
+	applied, err = store.LastApplied(fixtures.Repo.FullName, ".", "production")
+	Ok(t, err)
+	Assert(t, applied == nil, "expected no applied result in another environment")
+}
+
+func TestResultsStore_AuditLog(t *testing.T) {
+	store, cleanup := newResultsStore(t)
+	defer cleanup()
+	ctx := &server.CommandContext{
+		BaseRepo: fixtures.Repo,
+		Pull:     fixtures.Pull,
+		User:     models.User{Username: "user"},
+		RunID:    "abc123",
+		Command:  &server.Command{Name: server.Apply, Environment: "staging"},
+		Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+	records, err := store.AuditLog(fixtures.Repo.FullName)
+	Ok(t, err)
+	Equals(t, []server.AuditRecord{}, records)
+
+	t.Log("only successful applies should be audited")
+	Ok(t, store.Save(ctx, server.Plan, server.CommandResponse{ProjectResults: []server.ProjectResult{
+		{Path: ".", PlanSuccess: &server.PlanSuccess{TerraformOutput: "Plan: 1 to add, 0 to change, 0 to destroy."}},
+	}}))
+	Ok(t, store.Save(ctx, server.Apply, server.CommandResponse{ProjectResults: []server.ProjectResult{
+		{Path: ".", ApplySuccess: "Apply complete! Resources: 1 added, 0 changed, 0 destroyed.", AppliedBy: "user", AppliedAt: time.Date(2017, 9, 1, 10, 0, 0, 0, time.UTC)},
+		{Path: "sub", Error: errors.New("error")},
+	}}))
+
+	t.Log("every apply should be kept, oldest first, rather than replacing the last")
+	ctx.RunID = "def456"
+	Ok(t, store.Save(ctx, server.Apply, server.CommandResponse{ProjectResults: []server.ProjectResult{
+		{Path: ".", Environment: "production", ApplySuccess: "Apply complete! Resources: 0 added, 1 changed, 0 destroyed.", AppliedBy: "user", AppliedAt: time.Date(2017, 9, 2, 10, 0, 0, 0, time.UTC)},
+	}}))
+	records, err = store.AuditLog(fixtures.Repo.FullName)
+	Ok(t, err)
+	Equals(t, []server.AuditRecord{
+		{Repo: fixtures.Repo.FullName, Pull: fixtures.Pull.Num, Dir: ".", Env: "staging", User: "user", RunID: "abc123", Time: time.Date(2017, 9, 1, 10, 0, 0, 0, time.UTC), Summary: &terraform.Summary{Add: 1}},
+		{Repo: fixtures.Repo.FullName, Pull: fixtures.Pull.Num, Dir: ".", Env: "production", User: "user", RunID: "def456", Time: time.Date(2017, 9, 2, 10, 0, 0, 0, time.UTC), Summary: &terraform.Summary{Change: 1}},
+	}, records)
+
+	t.Log("other repos' applies shouldn't be included")
+	records, err = store.AuditLog(fixtures.Repo.FullName + "-other")
+	Ok(t, err)
+	Equals(t, []server.AuditRecord{}, records)
+}
+
+func TestResultsStore_SaveRedacted(t *testing.T) {
+	store, cleanup := newResultsStore(t)
+	defer cleanup()
+	redactor, err := server.NewOutputRedactor("password")
+	Ok(t, err)
+	store.Redactor = redactor
+	ctx := &server.CommandContext{
+		BaseRepo: fixtures.Repo,
+		Pull:     fixtures.Pull,
+		User:     models.User{Username: "user"},
+		Command:  &server.Command{Name: server.Plan, Environment: "staging"},
+		Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+
+	t.Log("failures and errors shouldn't be stored with sensitive values")
+	Ok(t, store.Save(ctx, server.Plan, server.CommandResponse{ProjectResults: []server.ProjectResult{
+		{Path: ".", Failure: "invalid -var password=hunter2"},
+		{Path: "sub", Error: errors.New("exit status 1\n  password: \"hunter2\"")},
+	}}))
+	results, err := store.Get(fixtures.Repo.FullName, fixtures.Pull.Num)
+	Ok(t, err)
+	Equals(t, "invalid -var password=<redacted>", results.Results[0].Failure)
+	Equals(t, "exit status 1\n  password: \"<redacted>\"", results.Results[1].Error)
+
+	Ok(t, store.Save(ctx, server.Plan, server.CommandResponse{Failure: "invalid -var password=hunter2", Error: errors.New("-var password=hunter2")}))
+	results, err = store.Get(fixtures.Repo.FullName, fixtures.Pull.Num)
+	Ok(t, err)
+	Equals(t, "invalid -var password=<redacted>", results.Results[0].Failure)
+	Equals(t, "-var password=<redacted>", results.Results[0].Error)
+}
@@ -1,24 +1,34 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
-	"bytes"
+	"crypto/subtle"
 	"io/ioutil"
 
 	"github.com/elazarl/go-bindata-assetfs"
 	gh "github.com/google/go-github/github"
 	"github.com/gorilla/mux"
+	"github.com/hootsuite/atlantis/bitbucket"
 	"github.com/hootsuite/atlantis/github"
+	"github.com/hootsuite/atlantis/gitlab"
 	"github.com/hootsuite/atlantis/locking"
 	"github.com/hootsuite/atlantis/locking/boltdb"
 	"github.com/hootsuite/atlantis/logging"
+	"github.com/hootsuite/atlantis/metrics"
 	"github.com/hootsuite/atlantis/models"
 	"github.com/hootsuite/atlantis/run"
 	"github.com/hootsuite/atlantis/static"
@@ -41,25 +51,114 @@ type Server struct {
 	router              *mux.Router
 	port                int
 	commandHandler      *CommandHandler
+	commandQueue        *CommandQueue
 	pullClosedExecutor  *PullClosedExecutor
 	logger              *logging.SimpleLogger
 	eventParser         *EventParser
 	locker              locking.Locker
+	concurrentRunLocker *ConcurrentRunLocker
+	metrics             *metrics.Registry
+	resultsStore        *ResultsStore
 	atlantisURL         string
 	githubWebHookSecret []byte
+	// gitlabWebHookSecret is the token GitLab webhooks must send in their
+	// X-Gitlab-Token header or empty if they aren't validated
+	gitlabWebHookSecret string
+	// bitbucketSecret is the secret Bitbucket webhooks are signed
+	// with in their X-Hub-Signature header or empty if they aren't validated
+	bitbucketSecret string
+	authenticator   *Authenticator
+	maintenanceMode *MaintenanceMode
+	healthCheck     *HealthCheck
+	autoplan        *Autoplan
+	build           BuildInfo
+	// activeCommands are the running commands that are waited for, for up
+	// to drainTimeout, when Atlantis shuts down
+	activeCommands *ActiveCommands
+	drainTimeout   time.Duration
 }
 
 // the mapstructure tags correspond to flags in cmd/server.go
 type ServerConfig struct {
-	AtlantisURL         string `mapstructure:"atlantis-url"`
-	DataDir             string `mapstructure:"data-dir"`
-	GithubHostname      string `mapstructure:"gh-hostname"`
-	GithubToken         string `mapstructure:"gh-token"`
-	GithubUser          string `mapstructure:"gh-user"`
-	GithubWebHookSecret string `mapstructure:"gh-webhook-secret"`
-	LogLevel            string `mapstructure:"log-level"`
-	Port                int    `mapstructure:"port"`
-	RequireApproval     bool   `mapstructure:"require-approval"`
+	AcknowledgeCommands       bool   `mapstructure:"acknowledge-commands"`
+	AdminTeam                 string `mapstructure:"admin-team"`
+	AllowStateRm              bool   `mapstructure:"allow-state-rm"`
+	APIToken                  string `mapstructure:"api-token"`
+	ApplyHint                 bool   `mapstructure:"apply-hint"`
+	ApplyTimeout              string `mapstructure:"apply-timeout"`
+	ArchivedRepoComment       string `mapstructure:"archived-repo-comment"`
+	AtlantisURL               string `mapstructure:"atlantis-url"`
+	Autoplan                  bool   `mapstructure:"autoplan"`
+	AutoplanCommentOnSkip     bool   `mapstructure:"autoplan-comment-on-skip"`
+	AutoplanRepos             string `mapstructure:"autoplan-repos"`
+	BitbucketToken            string `mapstructure:"bitbucket-token"`
+	BitbucketURL              string `mapstructure:"bitbucket-url"`
+	BitbucketUser             string `mapstructure:"bitbucket-user"`
+	BitbucketWebHookSecret    string `mapstructure:"bitbucket-webhook-secret"`
+	CloneDepth                int    `mapstructure:"clone-depth"`
+	CloneSubmodules           bool   `mapstructure:"clone-submodules"`
+	CommandQueueSize          int    `mapstructure:"command-queue-size"`
+	CommandWorkers            int    `mapstructure:"command-workers"`
+	CommentTemplate           string `mapstructure:"comment-template"`
+	DataDir                   string `mapstructure:"data-dir"`
+	DefaultPlanScope          string `mapstructure:"default-plan-scope"`
+	DefaultVerbose            bool   `mapstructure:"default-verbose"`
+	DeniedTerraformFlags      string `mapstructure:"denied-terraform-flags"`
+	DisableMetricsEnvLabel    bool   `mapstructure:"disable-metrics-environment-label"`
+	DisableMetricsRepoLabel   bool   `mapstructure:"disable-metrics-repo-label"`
+	DisableReactions          bool   `mapstructure:"disable-reactions"`
+	DrainTimeout              string `mapstructure:"drain-timeout"`
+	DryRun                    bool   `mapstructure:"dry-run"`
+	FmtCheck                  bool   `mapstructure:"fmt-check"`
+	GithubHostname            string `mapstructure:"gh-hostname"`
+	GithubRetries             int    `mapstructure:"gh-retries"`
+	GithubToken               string `mapstructure:"gh-token"`
+	GithubUser                string `mapstructure:"gh-user"`
+	GithubWebHookSecret       string `mapstructure:"gh-webhook-secret"`
+	GistOutputThreshold       int    `mapstructure:"gist-output-threshold"`
+	GitlabHostname            string `mapstructure:"gitlab-hostname"`
+	GitlabToken               string `mapstructure:"gitlab-token"`
+	GitlabWebHookSecret       string `mapstructure:"gitlab-webhook-secret"`
+	LabelApplyFailure         string `mapstructure:"label-apply-failure"`
+	LabelApplySuccess         string `mapstructure:"label-apply-success"`
+	LabelPlanFailure          string `mapstructure:"label-plan-failure"`
+	LabelPlanSuccess          string `mapstructure:"label-plan-success"`
+	LockTimeout               string `mapstructure:"lock-timeout"`
+	LogFormat                 string `mapstructure:"log-format"`
+	LogLevel                  string `mapstructure:"log-level"`
+	Maintenance               bool   `mapstructure:"maintenance"`
+	MergeConflicts            string `mapstructure:"merge-conflicts"`
+	ParallelApplies           int    `mapstructure:"parallel-applies"`
+	ParallelPlans             int    `mapstructure:"parallel-plans"`
+	PlanTimeout               string `mapstructure:"plan-timeout"`
+	Port                      int    `mapstructure:"port"`
+	ProjectExcludes           string `mapstructure:"project-excludes"`
+	ProjectPattern            string `mapstructure:"project-pattern"`
+	PullDataErrorComment      string `mapstructure:"pull-data-error-comment"`
+	QueueTimeout              string `mapstructure:"queue-timeout"`
+	ReactionFailure           string `mapstructure:"reaction-failure"`
+	ReactionQueued            string `mapstructure:"reaction-queued"`
+	ReactionRunning           string `mapstructure:"reaction-running"`
+	ReactionSuccess           string `mapstructure:"reaction-success"`
+	RedactKeys                string `mapstructure:"redact-keys"`
+	RepoAllowlist             string `mapstructure:"repo-allowlist"`
+	RepoSSHKeys               string `mapstructure:"repo-ssh-keys"`
+	RequireApproval           bool   `mapstructure:"require-approval"`
+	RequireCodeOwnersApproval bool   `mapstructure:"require-codeowners-approval"`
+	RequireConfiguredEnvs     bool   `mapstructure:"require-configured-envs"`
+	SlowCommandThreshold      string `mapstructure:"slow-command-threshold"`
+	SSHKey                    string `mapstructure:"ssh-key"`
+	StalePlanComment          string `mapstructure:"stale-plan-comment"`
+	StatusContext             string `mapstructure:"status-context"`
+	StatusFailureComment      bool   `mapstructure:"status-failure-comment"`
+	StatusRetries             int    `mapstructure:"status-retries"`
+	Statuses                  string `mapstructure:"statuses"`
+	SupersededComments        string `mapstructure:"superseded-comments"`
+	TFBinaries                string `mapstructure:"tf-binaries"`
+	TFDownloadURL             string `mapstructure:"tf-download-url"`
+	UntrustedForks            string `mapstructure:"untrusted-forks"`
+	WebPassword               string `mapstructure:"web-password"`
+	WebUsername               string `mapstructure:"web-username"`
 }
 
 type CommandContext struct {
@@ -69,9 +168,29 @@ type CommandContext struct {
 	User     models.User
 	Command  *Command
 	Log      *logging.SimpleLogger
+	// CommentID is the id of the comment that triggered the command
+	CommentID int
+	// reaction and reactionID are the current reaction on the triggering
+	// comment, see CommentReactions
+	reaction   string
+	reactionID int
+	// RunID uniquely identifies this run of the command so its logs, comment,
+	// status and results can be correlated
+	RunID string
+	// ackCommentID is the id of the comment acknowledging the command,
+	// see ResultComments.Acknowledge. It's guarded by ackMutex since the
+	// progress comment can set it while the command runs.
+	ackCommentID int
+	ackMutex     sync.Mutex
+	// projectConfigs are the configs of the projects in the clone the
+	// command runs in, keyed by the project's absolute path, so they're only
+	// parsed once. See projectConfig.
+	projectConfigs map[string]ProjectConfig
 }
 
-func NewServer(config ServerConfig) (*Server, error) {
+// NewServer returns a Server configured with config. build is the build of
+// Atlantis that's running.
+func NewServer(config ServerConfig, build BuildInfo) (*Server, error) {
 	// if ~ was used in data-dir convert that to actual home directory otherwise we'll
 	// create a directory call "~" instead of actually using home
 	if strings.HasPrefix(config.DataDir, "~/") {
@@ -82,27 +201,193 @@ func NewServer(config ServerConfig) (*Server, error) {
 		config.DataDir = expanded
 	}
 
-	githubClient, err := github.NewClient(config.GithubHostname, config.GithubUser, config.GithubToken)
+	ghClient, err := github.NewClient(config.GithubHostname, config.GithubUser, config.GithubToken)
 	if err != nil {
 		return nil, err
 	}
-	githubStatus := &GithubStatus{Client: githubClient}
-	terraformClient, err := terraform.NewClient()
+	// everything uses the same client which sends each request to GitHub,
+	// GitLab or Bitbucket depending on where the repo is hosted
+	githubClient := &VCSClient{Github: ghClient}
+	if config.GitlabToken != "" {
+		gitlabClient, err := gitlab.NewClient(config.GitlabHostname, config.GitlabToken)
+		if err != nil {
+			return nil, err
+		}
+		githubClient.Gitlab = gitlabClient
+	}
+	if config.BitbucketToken != "" {
+		bitbucketClient, err := bitbucket.NewClient(config.BitbucketURL, config.BitbucketUser, config.BitbucketToken)
+		if err != nil {
+			return nil, err
+		}
+		githubClient.Bitbucket = bitbucketClient
+	}
+	githubStatus := &GithubStatus{
+		Client:           githubClient,
+		AtlantisURL:      config.AtlantisURL,
+		Retries:          config.StatusRetries,
+		RetryDelay:       time.Second,
+		CommentOnFailure: config.StatusFailureComment,
+		Statuses:         config.Statuses,
+		Context:          config.StatusContext,
+	}
+	terraformBinaries, err := terraform.ParseBinaries(config.TFBinaries)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing terraform binaries")
+	}
+	terraformClient, err := terraform.NewClientWithBinaries(filepath.Join(config.DataDir, "bin"), config.TFDownloadURL, terraformBinaries)
 	if err != nil {
 		return nil, errors.Wrap(err, "initializing terraform")
 	}
-	githubComments := &GithubCommentRenderer{}
+	redactor, err := NewOutputRedactor(config.RedactKeys)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing redact keys")
+	}
+	autoplan, err := NewAutoplan(config.Autoplan, config.AutoplanRepos)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing autoplan repos")
+	}
+	autoplan.Verbose = config.DefaultVerbose
+	repoAllowlist, err := NewRepoAllowlist(config.RepoAllowlist)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing repo allowlist")
+	}
+	githubComments := &GithubCommentRenderer{ApplyHint: config.ApplyHint, DefaultVerbose: config.DefaultVerbose, Redactor: redactor}
+	if config.CommentTemplate != "" {
+		githubComments.Template, err = ParseCommentTemplate(config.CommentTemplate)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing comment template")
+		}
+	}
 
 	boltdb, err := boltdb.New(config.DataDir)
 	if err != nil {
 		return nil, err
 	}
 	lockingClient := locking.NewClient(boltdb)
+	resultsStore, err := NewResultsStore(boltdb.DB())
+	if err != nil {
+		return nil, err
+	}
+	resultsStore.Redactor = redactor
 	run := &run.Run{}
 	configReader := &ConfigReader{}
 	concurrentRunLocker := NewConcurrentRunLocker()
+	repoSSHKeys, err := ParseRepoSSHKeys(config.RepoSSHKeys)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing repo ssh keys")
+	}
 	workspace := &FileWorkspace{
-		dataDir: config.DataDir,
+		dataDir:        config.DataDir,
+		sshKey:         config.SSHKey,
+		repoSSHKeys:    repoSSHKeys,
+		mergeConflicts: config.MergeConflicts,
+		depth:          config.CloneDepth,
+		submodules:     config.CloneSubmodules,
+		repoAllowlist:  repoAllowlist,
+	}
+	workspaceDiscovery := NewWorkspaceDiscovery(terraformClient)
+	var slowCommandThreshold time.Duration
+	if config.SlowCommandThreshold != "" {
+		slowCommandThreshold, err = time.ParseDuration(config.SlowCommandThreshold)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing slow command threshold")
+		}
+	}
+	drainTimeout, err := time.ParseDuration(config.DrainTimeout)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing drain timeout")
+	}
+	var queueTimeout time.Duration
+	if config.QueueTimeout != "" {
+		queueTimeout, err = time.ParseDuration(config.QueueTimeout)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing queue timeout")
+		}
+	}
+	var planTimeout time.Duration
+	if config.PlanTimeout != "" {
+		planTimeout, err = time.ParseDuration(config.PlanTimeout)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing plan timeout")
+		}
+	}
+	var applyTimeout time.Duration
+	if config.ApplyTimeout != "" {
+		applyTimeout, err = time.ParseDuration(config.ApplyTimeout)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing apply timeout")
+		}
+	}
+	resultComments := &ResultComments{
+		Github:               githubClient,
+		GithubUser:           config.GithubUser,
+		Superseded:           config.SupersededComments,
+		AcknowledgeCommands:  config.AcknowledgeCommands,
+		SlowCommandThreshold: slowCommandThreshold,
+		Version:              build.String(),
+	}
+	outputGists := &OutputGists{
+		Github:    githubClient,
+		Threshold: config.GistOutputThreshold,
+		Redactor:  redactor,
+	}
+	var excludedMetricsLabels []string
+	if config.DisableMetricsRepoLabel {
+		excludedMetricsLabels = append(excludedMetricsLabels, "repo")
+	}
+	if config.DisableMetricsEnvLabel {
+		excludedMetricsLabels = append(excludedMetricsLabels, "environment")
+	}
+	metricsRegistry := metrics.NewRegistry(excludedMetricsLabels...)
+	projectDurations := metricsRegistry.NewHistogramVec(
+		"atlantis_project_duration_seconds",
+		"How long it took to run a command for a project.",
+		[]string{"repo", "project", "command"},
+		metrics.DefaultBuckets)
+	commandMetrics := NewCommandMetrics(metricsRegistry)
+	var commentReactions *CommentReactions
+	if !config.DisableReactions {
+		commentReactions = &CommentReactions{
+			Github: githubClient,
+			Emojis: ReactionEmojis{
+				Queued:  config.ReactionQueued,
+				Running: config.ReactionRunning,
+				Success: config.ReactionSuccess,
+				Failure: config.ReactionFailure,
+			},
+		}
+	}
+	projectFinder := &ProjectFinder{
+		Pattern: config.ProjectPattern,
+	}
+	for _, exclude := range strings.Split(config.ProjectExcludes, ",") {
+		if exclude = strings.TrimSpace(exclude); exclude != "" {
+			projectFinder.Excludes = append(projectFinder.Excludes, exclude)
+		}
+	}
+	terraformFlagPolicy := &TerraformFlagPolicy{}
+	for _, flag := range strings.Split(config.DeniedTerraformFlags, ",") {
+		if flag = strings.TrimSpace(flag); flag != "" {
+			terraformFlagPolicy.Denied = append(terraformFlagPolicy.Denied, flag)
+		}
+	}
+	pullLabels := &PullLabels{
+		Github: githubClient,
+		Names: PullLabelNames{
+			PlanSuccess:  config.LabelPlanSuccess,
+			PlanFailure:  config.LabelPlanFailure,
+			ApplySuccess: config.LabelApplySuccess,
+			ApplyFailure: config.LabelApplyFailure,
+		},
+	}
+	applyRequirements := &ApplyRequirements{
+		Github:                    githubClient,
+		RequireApproval:           config.RequireApproval,
+		RequireCodeOwnersApproval: config.RequireCodeOwnersApproval,
+		CodeOwnersApproval:        &CodeOwnersApproval{Github: githubClient},
+		EnvironmentApproval:       &EnvironmentApproval{Github: githubClient, ConfigReader: configReader},
+		AdminOverride:             &AdminOverride{Github: githubClient, AdminTeam: config.AdminTeam},
 	}
 	applyExecutor := &ApplyExecutor{
 		github:                githubClient,
@@ -110,11 +395,26 @@ func NewServer(config ServerConfig) (*Server, error) {
 		terraform:             terraformClient,
 		githubCommentRenderer: githubComments,
 		locker:                lockingClient,
-		requireApproval:       config.RequireApproval,
+		applyRequirements:     applyRequirements,
 		run:                   run,
 		configReader:          configReader,
 		concurrentRunLocker:   concurrentRunLocker,
 		workspace:             workspace,
+		commentReactions:      commentReactions,
+		projectDurations:      projectDurations,
+		resultComments:        resultComments,
+		outputGists:           outputGists,
+		resultsStore:          resultsStore,
+		pullLabels:            pullLabels,
+		terraformFlagPolicy:   terraformFlagPolicy,
+		parallelApplies:       config.ParallelApplies,
+		stalePlanComment:      config.StalePlanComment,
+		projectFinder:         projectFinder,
+		workspaceDiscovery:    workspaceDiscovery,
+		lockTimeout:           config.LockTimeout,
+		queueTimeout:          queueTimeout,
+		applyTimeout:          applyTimeout,
+		commandMetrics:        commandMetrics,
 	}
 	planExecutor := &PlanExecutor{
 		github:                githubClient,
@@ -126,50 +426,196 @@ func NewServer(config ServerConfig) (*Server, error) {
 		configReader:          configReader,
 		concurrentRunLocker:   concurrentRunLocker,
 		workspace:             workspace,
+		workspaceDiscovery:    workspaceDiscovery,
+		commentReactions:      commentReactions,
+		projectDurations:      projectDurations,
+		resultComments:        resultComments,
+		outputGists:           outputGists,
+		resultsStore:          resultsStore,
+		requireConfiguredEnvs: config.RequireConfiguredEnvs,
+		pullLabels:            pullLabels,
+		terraformFlagPolicy:   terraformFlagPolicy,
+		projectFinder:         projectFinder,
+		defaultPlanScope:      config.DefaultPlanScope,
+		commentOnAutoplanSkip: config.AutoplanCommentOnSkip,
+		lockTimeout:           config.LockTimeout,
+		parallelPlans:         config.ParallelPlans,
+		fmtCheck:              config.FmtCheck,
+		queueTimeout:          queueTimeout,
+		planTimeout:           planTimeout,
+		moduleDependents:      &ModuleDependents{},
+		commandMetrics:        commandMetrics,
+	}
+	destroyExecutor := &DestroyExecutor{
+		github:                githubClient,
+		githubStatus:          githubStatus,
+		terraform:             terraformClient,
+		githubCommentRenderer: githubComments,
+		locker:                lockingClient,
+		applyRequirements:     applyRequirements,
+		configReader:          configReader,
+		concurrentRunLocker:   concurrentRunLocker,
+		workspace:             workspace,
+		commentReactions:      commentReactions,
+		projectDurations:      projectDurations,
+		resultComments:        resultComments,
+		outputGists:           outputGists,
+		resultsStore:          resultsStore,
+		projectFinder:         projectFinder,
+		terraformFlagPolicy:   terraformFlagPolicy,
+		workspaceDiscovery:    workspaceDiscovery,
+		lockTimeout:           config.LockTimeout,
+		queueTimeout:          queueTimeout,
+		applyTimeout:          applyTimeout,
+		commandMetrics:        commandMetrics,
+	}
+	stateRmExecutor := &StateRmExecutor{
+		github:                githubClient,
+		githubStatus:          githubStatus,
+		terraform:             terraformClient,
+		githubCommentRenderer: githubComments,
+		locker:                lockingClient,
+		applyRequirements:     applyRequirements,
+		configReader:          configReader,
+		concurrentRunLocker:   concurrentRunLocker,
+		workspace:             workspace,
+		commentReactions:      commentReactions,
+		projectDurations:      projectDurations,
+		resultComments:        resultComments,
+		outputGists:           outputGists,
+		resultsStore:          resultsStore,
+		allowed:               config.AllowStateRm,
+		queueTimeout:          queueTimeout,
+		commandMetrics:        commandMetrics,
+	}
+	workspacesExecutor := &WorkspacesExecutor{
+		github:                githubClient,
+		githubCommentRenderer: githubComments,
+		configReader:          configReader,
+		concurrentRunLocker:   concurrentRunLocker,
+		workspace:             workspace,
+		terraform:             terraformClient,
+		workspaceDiscovery:    workspaceDiscovery,
+		resultComments:        resultComments,
+		projectFinder:         projectFinder,
 	}
 	helpExecutor := &HelpExecutor{
 		Github: githubClient,
 	}
+	logFormat := logging.ToLogFormat(config.LogFormat)
+	logFlags := log.LstdFlags
+	if logFormat == logging.JSON {
+		// JSON entries have their own timestamp
+		logFlags = 0
+	}
+	logger := logging.NewSimpleLoggerWithFormat("server", log.New(os.Stderr, "", logFlags), false, logging.ToLogLevel(config.LogLevel), logFormat)
 	pullClosedExecutor := &PullClosedExecutor{
-		Github:    githubClient,
-		Locker:    lockingClient,
-		Workspace: workspace,
+		Github:              githubClient,
+		Locker:              lockingClient,
+		Workspace:           workspace,
+		ConcurrentRunLocker: concurrentRunLocker,
+		OutputGists:         outputGists,
+		Logger:              logger,
 	}
-	logger := logging.NewSimpleLogger("server", log.New(os.Stderr, "", log.LstdFlags), false, logging.ToLogLevel(config.LogLevel))
 	eventParser := &EventParser{
-		GithubUser:  config.GithubUser,
-		GithubToken: config.GithubToken,
+		GithubUser:     config.GithubUser,
+		GithubToken:    config.GithubToken,
+		DefaultVerbose: config.DefaultVerbose,
 	}
+	if config.GitlabToken != "" {
+		eventParser.GitlabHostname = config.GitlabHostname
+		eventParser.GitlabToken = config.GitlabToken
+	}
+	if config.BitbucketToken != "" {
+		eventParser.BitbucketURL = config.BitbucketURL
+		eventParser.BitbucketUser = config.BitbucketUser
+		eventParser.BitbucketToken = config.BitbucketToken
+	}
+	forkTrust := &ForkTrust{
+		Github: githubClient,
+		Mode:   config.UntrustedForks,
+	}
+	maintenanceMode := NewMaintenanceMode(config.Maintenance)
+	activeCommands := NewActiveCommands()
 	commandHandler := &CommandHandler{
-		ApplyExecutor: applyExecutor,
-		PlanExecutor:  planExecutor,
-		HelpExecutor:  helpExecutor,
-		EventParser:   eventParser,
-		GithubClient:  githubClient,
-		Logger:        logger,
+		ApplyExecutor:        applyExecutor,
+		PlanExecutor:         planExecutor,
+		HelpExecutor:         helpExecutor,
+		WorkspacesExecutor:   workspacesExecutor,
+		DestroyExecutor:      destroyExecutor,
+		StateRmExecutor:      stateRmExecutor,
+		UnlockExecutor:       &UnlockExecutor{Github: githubClient, ConcurrentRunLocker: concurrentRunLocker},
+		ArchivedRepoComment:  config.ArchivedRepoComment,
+		CommentReactions:     commentReactions,
+		DryRun:               config.DryRun,
+		ForkTrust:            forkTrust,
+		EventParser:          eventParser,
+		GithubClient:         githubClient,
+		GithubStatus:         githubStatus,
+		Logger:               logger,
+		RepoAllowlist:        repoAllowlist,
+		MaintenanceMode:      maintenanceMode,
+		ActiveCommands:       activeCommands,
+		PullDataErrorComment: config.PullDataErrorComment,
+		Retries:              config.GithubRetries,
+		RetryDelay:           time.Second,
+		Secrets:              []string{config.GithubToken, config.GithubWebHookSecret, config.WebPassword, config.APIToken, config.GitlabToken, config.GitlabWebHookSecret, config.BitbucketToken, config.BitbucketWebHookSecret},
 	}
 	router := mux.NewRouter()
 	return &Server{
 		router:              router,
 		port:                config.Port,
 		commandHandler:      commandHandler,
+		commandQueue:        NewCommandQueue(config.CommandWorkers, config.CommandQueueSize, activeCommands, commandHandler.ExecuteCommand),
 		pullClosedExecutor:  pullClosedExecutor,
 		eventParser:         eventParser,
 		logger:              logger,
 		locker:              lockingClient,
+		concurrentRunLocker: concurrentRunLocker,
+		metrics:             metricsRegistry,
+		resultsStore:        resultsStore,
 		atlantisURL:         config.AtlantisURL,
 		githubWebHookSecret: []byte(config.GithubWebHookSecret),
+		gitlabWebHookSecret: config.GitlabWebHookSecret,
+		bitbucketSecret:     config.BitbucketWebHookSecret,
+		maintenanceMode:     maintenanceMode,
+		healthCheck:         &HealthCheck{DataDir: config.DataDir},
+		autoplan:            autoplan,
+		build:               build,
+		activeCommands:      activeCommands,
+		drainTimeout:        drainTimeout,
+		authenticator: &Authenticator{
+			Username: config.WebUsername,
+			Password: config.WebPassword,
+			APIToken: config.APIToken,
+		},
 	}, nil
 }
 
-func (s *Server) Start() error {
+// registerRoutes adds the server's routes to its router. It returns the
+// route of the lock detail page, which command comments link to.
+func (s *Server) registerRoutes() *mux.Route {
 	s.router.HandleFunc("/", s.index).Methods("GET").MatcherFunc(func(r *http.Request, rm *mux.RouteMatch) bool {
 		return r.URL.Path == "/" || r.URL.Path == "/index.html"
 	})
 	s.router.PathPrefix("/static/").Handler(http.FileServer(&assetfs.AssetFS{Asset: static.Asset, AssetDir: static.AssetDir, AssetInfo: static.AssetInfo}))
 	s.router.HandleFunc("/events", s.postEvents).Methods("POST")
 	s.router.HandleFunc("/locks", s.deleteLock).Methods("DELETE").Queries("id", "{id:.*}")
-	lockRoute := s.router.HandleFunc("/lock", s.getLock).Methods("GET").Queries("id", "{id}").Name(lockRoute)
+	s.router.HandleFunc("/api/locks", s.listRunLocks).Methods("GET")
+	s.router.HandleFunc("/locks", s.listRunLocks).Methods("GET")
+	s.router.HandleFunc("/api/results", s.getResults).Methods("GET").Queries("repo", "{repo}", "pull", "{pull}")
+	s.router.HandleFunc("/api/audit", s.getAuditLog).Methods("GET").Queries("repo", "{repo}")
+	s.router.HandleFunc("/api/maintenance", s.getMaintenance).Methods("GET")
+	s.router.HandleFunc("/api/maintenance", s.putMaintenance).Methods("PUT")
+	s.router.Handle("/metrics", s.metrics).Methods("GET")
+	s.router.HandleFunc("/version", s.getVersion).Methods("GET")
+	s.router.HandleFunc("/healthz", s.healthCheck.Healthz).Methods("GET")
+	s.router.HandleFunc("/readyz", s.healthCheck.Readyz).Methods("GET")
+	return s.router.HandleFunc("/lock", s.getLock).Methods("GET").Queries("id", "{id}").Name(lockRoute)
+}
+
+func (s *Server) Start() error {
+	lockRoute := s.registerRoutes()
 	// function that planExecutor can use to construct detail view url
 	// injecting this here because this is the earliest routes are created
 	s.commandHandler.SetLockURL(func(lockID string) string {
@@ -182,10 +628,50 @@ func (s *Server) Start() error {
 		PrintStack: false,
 		StackAll:   false,
 		StackSize:  1024 * 8,
-	}, NewRequestLogger(s.logger))
+	}, NewRequestLogger(s.logger), s.authenticator)
 	n.UseHandler(s.router)
-	s.logger.Warn("Atlantis started - listening on port %v", s.port)
-	return cli.NewExitError(http.ListenAndServe(fmt.Sprintf(":%d", s.port), n), 1)
+	httpServer := &http.Server{Addr: fmt.Sprintf(":%d", s.port), Handler: n}
+	stopped := make(chan struct{})
+	go s.shutdownOnSignal(httpServer, stopped)
+	if len(s.githubWebHookSecret) == 0 {
+		s.logger.Warn("no --gh-webhook-secret is set so GitHub webhooks aren't validated. Anyone who can reach Atlantis can send it webhooks that run terraform. Set --gh-webhook-secret to the webhook's secret")
+	}
+	if s.eventParser.GitlabToken != "" && s.gitlabWebHookSecret == "" {
+		s.logger.Warn("no --gitlab-webhook-secret is set so GitLab webhooks aren't validated. Anyone who can reach Atlantis can send it webhooks that run terraform. Set --gitlab-webhook-secret to the webhook's secret token")
+	}
+	if s.eventParser.BitbucketToken != "" && s.bitbucketSecret == "" {
+		s.logger.Warn("no --bitbucket-webhook-secret is set so Bitbucket webhooks aren't validated. Anyone who can reach Atlantis can send it webhooks that run terraform. Set --bitbucket-webhook-secret to the webhook's secret")
+	}
+	s.logger.Warn("Atlantis %s started - listening on port %v", s.build, s.port)
+	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		return cli.NewExitError(err, 1)
+	}
+	<-stopped
+	return nil
+}
+
+// shutdownOnSignal waits for SIGTERM or SIGINT and then stops accepting
+// webhooks and waits up to drainTimeout for the running commands to complete
+// so that terraform isn't stopped part way through. It closes stopped once
+// Atlantis can exit.
+func (s *Server) shutdownOnSignal(httpServer *http.Server, stopped chan<- struct{}) {
+	defer close(stopped)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	sig := <-signals
+	s.logger.Warn("received %s, waiting up to %s for running commands to complete before shutting down", sig, s.drainTimeout)
+	// the HTTP requests and the commands share the timeout
+	deadline := time.Now().Add(s.drainTimeout)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		s.logger.Warn("stopping the HTTP server: %s", err)
+	}
+	if running := s.activeCommands.Drain(time.Until(deadline)); len(running) > 0 {
+		s.logger.Err("shutting down after %s with %d command(s) still running: %s", s.drainTimeout, len(running), strings.Join(running, ", "))
+		return
+	}
+	s.logger.Warn("all commands completed, shutting down")
 }
 
 func (s *Server) index(w http.ResponseWriter, r *http.Request) {
@@ -290,14 +776,136 @@ func (s *Server) deleteLock(w http.ResponseWriter, r *http.Request) {
 	s.respond(w, logging.Info, http.StatusOK, "Deleted lock id %s", idUnencoded)
 }
 
+// listRunLocks responds with a JSON list of the locks held by commands that
+// are currently running. If the repo query parameter is set, only locks for
+// that repo are listed.
+func (s *Server) listRunLocks(w http.ResponseWriter, r *http.Request) {
+	repo := r.URL.Query().Get("repo")
+	locks := []ConcurrentRunLock{}
+	for _, l := range s.concurrentRunLocker.List() {
+		if repo == "" || l.RepoFullName == repo {
+			locks = append(locks, l)
+		}
+	}
+	data, err := json.Marshal(locks)
+	if err != nil {
+		s.respond(w, logging.Error, http.StatusInternalServerError, "Failed to marshal locks: %s", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// getVersion returns the BuildInfo of the running Atlantis as JSON.
+func (s *Server) getVersion(w http.ResponseWriter, r *http.Request) {
+	data, err := json.Marshal(s.build)
+	if err != nil {
+		s.respond(w, logging.Error, http.StatusInternalServerError, "Failed to marshal version: %s", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// maintenanceStatus is the JSON representation of whether Atlantis is in
+// maintenance mode.
+type maintenanceStatus struct {
+	Enabled bool `json:"enabled"`
+}
+
+func (s *Server) getMaintenance(w http.ResponseWriter, r *http.Request) {
+	data, err := json.Marshal(maintenanceStatus{s.maintenanceMode.Enabled()})
+	if err != nil {
+		s.respond(w, logging.Error, http.StatusInternalServerError, "Failed to marshal maintenance status: %s", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// putMaintenance enables or disables maintenance mode. Since that stops
+// everyone from running commands, it's only allowed if requests must be
+// authenticated with an API token.
+func (s *Server) putMaintenance(w http.ResponseWriter, r *http.Request) {
+	if s.authenticator.APIToken == "" {
+		s.respond(w, logging.Warn, http.StatusForbidden, "Maintenance mode can only be changed if Atlantis is run with --api-token")
+		return
+	}
+	var status maintenanceStatus
+	if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+		s.respond(w, logging.Warn, http.StatusBadRequest, "Invalid maintenance status: %s", err)
+		return
+	}
+	s.maintenanceMode.Set(status.Enabled)
+	s.respond(w, logging.Warn, http.StatusOK, "Maintenance mode enabled: %t", status.Enabled)
+}
+
+// getResults returns the results of the last plan or apply run on a pull request as JSON
+func (s *Server) getResults(w http.ResponseWriter, r *http.Request) {
+	repo := r.URL.Query().Get("repo")
+	pull, err := strconv.Atoi(r.URL.Query().Get("pull"))
+	if err != nil {
+		s.respond(w, logging.Warn, http.StatusBadRequest, "Invalid pull number: %s", r.URL.Query().Get("pull"))
+		return
+	}
+	results, err := s.resultsStore.Get(repo, pull)
+	if err != nil {
+		s.respond(w, logging.Error, http.StatusInternalServerError, "Failed to get results: %s", err)
+		return
+	}
+	if results == nil {
+		s.respond(w, logging.Info, http.StatusNotFound, "No results found for %s#%d", repo, pull)
+		return
+	}
+	// statuses link to the results of the run that set them, which may have
+	// been replaced since
+	if run := r.URL.Query().Get("run"); run != "" && run != results.RunID {
+		s.respond(w, logging.Info, http.StatusNotFound, "The results of run %s for %s#%d have been replaced by run %s", run, repo, pull, results.RunID)
+		return
+	}
+	data, err := json.Marshal(results)
+	if err != nil {
+		s.respond(w, logging.Error, http.StatusInternalServerError, "Failed to marshal results: %s", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// getAuditLog returns who applied each project in the repo and when as JSON.
+func (s *Server) getAuditLog(w http.ResponseWriter, r *http.Request) {
+	repo := r.URL.Query().Get("repo")
+	records, err := s.resultsStore.AuditLog(repo)
+	if err != nil {
+		s.respond(w, logging.Error, http.StatusInternalServerError, "Failed to get audit log: %s", err)
+		return
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		s.respond(w, logging.Error, http.StatusInternalServerError, "Failed to marshal audit log: %s", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
 // postEvents handles comment and pull request events from GitHub
 func (s *Server) postEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get(gitlabEventHeader) != "" {
+		s.postGitlabEvents(w, r)
+		return
+	}
+	if r.Header.Get(bitbucketEventHeader) != "" {
+		s.postBitbucketEvents(w, r)
+		return
+	}
 	githubReqID := "X-Github-Delivery=" + r.Header.Get("X-Github-Delivery")
 	var payload []byte
+	// body is what GitHub signed
+	var body []byte
 
 	// webhook requests can either be application/json or application/x-www-form-urlencoded.
 	// We accept both to make it easier on users that may choose x-www-form-urlencoded by mistake
-	// todo: use go-github's ValidatePayload method if https://github.com/google/go-github/pull/693 is merged
 	if r.Header.Get("Content-Type") == "application/x-www-form-urlencoded" {
 		// GitHub stores the json payload as a form value
 		payloadForm := r.FormValue("payload")
@@ -305,41 +913,28 @@ func (s *Server) postEvents(w http.ResponseWriter, r *http.Request) {
 			s.respond(w, logging.Warn, http.StatusBadRequest, "request did not contain expected 'payload' form value")
 			return
 		}
-		if len(s.githubWebHookSecret) != 0 {
-			// github calculates the signature based on the query escaped
-			// post body. In order to use go-github's ValidatePayload method
-			// that only accepts an http request we need to override r.Body
-			// with a value that was the original raw body before it was
-			// parsed.
-			rawPayload := fmt.Sprintf("payload=%s", url.QueryEscape(payloadForm))
-			r.Body = ioutil.NopCloser(bytes.NewBuffer([]byte(rawPayload)))
-			_, err := gh.ValidatePayload(r, s.githubWebHookSecret)
-			if err != nil {
-				s.respond(w, logging.Warn, http.StatusBadRequest, "webhook failed secret key validation")
-				return
-			}
-		}
+		// github calculates the signature based on the query escaped post
+		// body which has already been parsed so we escape it again
+		body = []byte(fmt.Sprintf("payload=%s", url.QueryEscape(payloadForm)))
 		payload = []byte(payloadForm)
 	} else {
 		// else read it as json
-		if len(s.githubWebHookSecret) != 0 {
-			var err error
-			payload, err = gh.ValidatePayload(r, s.githubWebHookSecret)
-			if err != nil {
-				s.respond(w, logging.Warn, http.StatusBadRequest, "webhook failed secret key validation")
-				return
-			}
-		} else {
-			// if we're not validating against the webhook secret then
-			// we can't use the ValidatePayload method and need to read
-			// the request body ourselves.
-			defer r.Body.Close()
-			var err error
-			payload, err = ioutil.ReadAll(r.Body)
-			if err != nil {
-				s.respond(w, logging.Warn, http.StatusBadRequest, "could not read body: %s", err)
-				return
-			}
+		defer r.Body.Close()
+		var err error
+		payload, err = ioutil.ReadAll(r.Body)
+		if err != nil {
+			s.respond(w, logging.Warn, http.StatusBadRequest, "could not read body: %s", err)
+			return
+		}
+		body = payload
+	}
+	// the signature is checked before the payload is parsed so requests
+	// that didn't come from GitHub can't run anything
+	if len(s.githubWebHookSecret) != 0 {
+		if err := validateGithubSignature(r.Header, body, s.githubWebHookSecret); err != nil {
+			s.logger.Warn("rejecting webhook from %s %s: %s", requestSource(r), githubReqID, err)
+			s.respond(w, logging.Warn, http.StatusUnauthorized, "webhook failed secret key validation")
+			return
 		}
 	}
 
@@ -354,8 +949,175 @@ func (s *Server) postEvents(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handlePullRequestEvent will delete any locks associated with the pull request
+// gitlabEventHeader is the header GitLab sends the type of webhook event in.
+const gitlabEventHeader = "X-Gitlab-Event"
+
+// postGitlabEvents handles GitLab webhooks. Comments on merge requests run
+// commands and merge requests that are closed or merged are cleaned up.
+func (s *Server) postGitlabEvents(w http.ResponseWriter, r *http.Request) {
+	if s.eventParser.GitlabToken == "" {
+		s.respond(w, logging.Warn, http.StatusBadRequest, "Ignoring GitLab event since GitLab isn't configured")
+		return
+	}
+	if s.gitlabWebHookSecret != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Gitlab-Token")), []byte(s.gitlabWebHookSecret)) != 1 {
+		s.logger.Warn("rejecting GitLab webhook from %s: X-Gitlab-Token doesn't match", requestSource(r))
+		s.respond(w, logging.Warn, http.StatusUnauthorized, "webhook failed secret token validation")
+		return
+	}
+	defer r.Body.Close()
+	switch r.Header.Get(gitlabEventHeader) {
+	case "Note Hook":
+	case "Merge Request Hook":
+		s.handleGitlabMergeRequest(w, r)
+		return
+	default:
+		s.respond(w, logging.Debug, http.StatusOK, "Ignoring unsupported GitLab event %s", r.Header.Get(gitlabEventHeader))
+		return
+	}
+	var event GitlabNoteEvent
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		s.respond(w, logging.Warn, http.StatusBadRequest, "could not parse body: %s", err)
+		return
+	}
+	if event.ObjectAttributes.NoteableType != "MergeRequest" {
+		s.respond(w, logging.Debug, http.StatusOK, "Ignoring comment on %s since it isn't on a merge request", event.ObjectAttributes.NoteableType)
+		return
+	}
+
+	// the command is parsed the same way as a GitHub comment
+	command, err := s.eventParser.DetermineCommand(&gh.IssueCommentEvent{Comment: &gh.IssueComment{Body: gh.String(event.ObjectAttributes.Note)}})
+	if err != nil {
+		s.respond(w, logging.Debug, http.StatusOK, "Ignoring: %s", err)
+		return
+	}
+	ctx := &CommandContext{Command: command}
+	if err := s.eventParser.ExtractGitlabCommentData(&event, ctx); err != nil {
+		s.respond(w, logging.Error, http.StatusInternalServerError, "Failed parsing event: %v", err)
+		return
+	}
+	if command.Name == Unlock {
+		fmt.Fprintln(w, "Processing...")
+		go s.commandHandler.ExecuteCommand(ctx)
+		return
+	}
+	if !s.commandQueue.Enqueue(ctx) {
+		s.respond(w, logging.Warn, http.StatusServiceUnavailable, "Too many commands are queued, try again shortly")
+		return
+	}
+	fmt.Fprintln(w, "Processing...")
+}
+
+// handleGitlabMergeRequest cleans up merge requests that are closed or
+// merged. Other merge request events are ignored.
+func (s *Server) handleGitlabMergeRequest(w http.ResponseWriter, r *http.Request) {
+	var event GitlabMergeRequestEvent
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		s.respond(w, logging.Warn, http.StatusBadRequest, "could not parse body: %s", err)
+		return
+	}
+	if event.ObjectAttributes.Action != "close" && event.ObjectAttributes.Action != "merge" {
+		s.respond(w, logging.Debug, http.StatusOK, "Ignoring merge request event since action was %s", event.ObjectAttributes.Action)
+		return
+	}
+	repo, pull, err := s.eventParser.ExtractGitlabMergeRequestData(&event)
+	if err != nil {
+		s.respond(w, logging.Error, http.StatusBadRequest, "Error parsing merge request data: %s", err)
+		return
+	}
+	if err := s.pullClosedExecutor.CleanUpPull(repo, pull); err != nil {
+		s.respond(w, logging.Error, http.StatusInternalServerError, "Error cleaning merge request: %s", err)
+		return
+	}
+	s.logger.Info("deleted locks and workspace for repo %s, merge request %d", repo.FullName, pull.Num)
+	fmt.Fprint(w, "Merge request cleaned successfully")
+}
+
+// bitbucketEventHeader is the header Bitbucket sends the type of webhook
+// event in.
+const bitbucketEventHeader = "X-Event-Key"
+
+// postBitbucketEvents handles Bitbucket Server webhooks. Comments on pull
+// requests run commands and pull requests that are merged, declined or
+// deleted are cleaned up.
+func (s *Server) postBitbucketEvents(w http.ResponseWriter, r *http.Request) {
+	if s.eventParser.BitbucketToken == "" {
+		s.respond(w, logging.Warn, http.StatusBadRequest, "Ignoring Bitbucket event since Bitbucket isn't configured")
+		return
+	}
+	defer r.Body.Close()
+	payload, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		s.respond(w, logging.Warn, http.StatusBadRequest, "could not read body: %s", err)
+		return
+	}
+	if s.bitbucketSecret != "" {
+		if err := validateBitbucketSignature(r.Header, payload, []byte(s.bitbucketSecret)); err != nil {
+			s.logger.Warn("rejecting Bitbucket webhook from %s: %s", requestSource(r), err)
+			s.respond(w, logging.Warn, http.StatusUnauthorized, "webhook failed secret key validation")
+			return
+		}
+	}
+	eventKey := r.Header.Get(bitbucketEventHeader)
+	if eventKey == "diagnostics:ping" {
+		fmt.Fprintln(w, "Bitbucket webhook received")
+		return
+	}
+	if eventKey != "pr:comment:added" && eventKey != "pr:merged" && eventKey != "pr:declined" && eventKey != "pr:deleted" {
+		s.respond(w, logging.Debug, http.StatusOK, "Ignoring unsupported Bitbucket event %s", eventKey)
+		return
+	}
+	var event BitbucketEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		s.respond(w, logging.Warn, http.StatusBadRequest, "could not parse body: %s", err)
+		return
+	}
+
+	if eventKey != "pr:comment:added" {
+		repo, pull, err := s.eventParser.ExtractBitbucketPullData(&event)
+		if err != nil {
+			s.respond(w, logging.Error, http.StatusBadRequest, "Error parsing pull data: %s", err)
+			return
+		}
+		if err := s.pullClosedExecutor.CleanUpPull(repo, pull); err != nil {
+			s.respond(w, logging.Error, http.StatusInternalServerError, "Error cleaning pull request: %s", err)
+			return
+		}
+		s.logger.Info("deleted locks and workspace for repo %s, pull %d", repo.FullName, pull.Num)
+		fmt.Fprint(w, "Pull request cleaned successfully")
+		return
+	}
+
+	// the command is parsed the same way as a GitHub comment
+	command, err := s.eventParser.DetermineCommand(&gh.IssueCommentEvent{Comment: &gh.IssueComment{Body: gh.String(event.Comment.Text)}})
+	if err != nil {
+		s.respond(w, logging.Debug, http.StatusOK, "Ignoring: %s", err)
+		return
+	}
+	ctx := &CommandContext{Command: command}
+	if err := s.eventParser.ExtractBitbucketCommentData(&event, ctx); err != nil {
+		s.respond(w, logging.Error, http.StatusInternalServerError, "Failed parsing event: %v", err)
+		return
+	}
+	if command.Name == Unlock {
+		fmt.Fprintln(w, "Processing...")
+		go s.commandHandler.ExecuteCommand(ctx)
+		return
+	}
+	if !s.commandQueue.Enqueue(ctx) {
+		s.respond(w, logging.Warn, http.StatusServiceUnavailable, "Too many commands are queued, try again shortly")
+		return
+	}
+	fmt.Fprintln(w, "Processing...")
+}
+
+// handlePullRequestEvent plans pull requests that are opened or updated if
+// they're planned automatically, and will delete any locks associated with
+// the pull request when it's closed
 func (s *Server) handlePullRequestEvent(w http.ResponseWriter, pullEvent *gh.PullRequestEvent, githubReqID string) {
+	if autoplanActions[pullEvent.GetAction()] {
+		s.handleAutoplan(w, pullEvent, githubReqID)
+		return
+	}
 	if pullEvent.GetAction() != "closed" {
 		s.respond(w, logging.Debug, http.StatusOK, "Ignoring pull request event since action was not closed %s", githubReqID)
 		return
@@ -379,6 +1141,43 @@ func (s *Server) handlePullRequestEvent(w http.ResponseWriter, pullEvent *gh.Pul
 	fmt.Fprint(w, "Pull request cleaned successfully")
 }
 
+// handleAutoplan queues a plan of the pull request that was opened or
+// updated in pullEvent, as if it had been commented, if its repo is planned
+// automatically.
+func (s *Server) handleAutoplan(w http.ResponseWriter, pullEvent *gh.PullRequestEvent, githubReqID string) {
+	repo, err := s.eventParser.ExtractRepoData(pullEvent.Repo)
+	if err != nil {
+		s.respond(w, logging.Error, http.StatusBadRequest, "Error parsing repo data: %s", err)
+		return
+	}
+	if !s.autoplan.ShouldPlan(pullEvent.GetAction(), repo) {
+		s.respond(w, logging.Debug, http.StatusOK, "Ignoring pull request event since %s isn't planned automatically %s", repo.FullName, githubReqID)
+		return
+	}
+	pull, headRepo, err := s.eventParser.ExtractPullData(pullEvent.PullRequest)
+	if err != nil {
+		s.respond(w, logging.Error, http.StatusBadRequest, "Error parsing pull data: %s", err)
+		return
+	}
+	// the plan runs as whoever opened the pull request or pushed to it
+	sender := pullEvent.Sender.GetLogin()
+	if sender == "" {
+		sender = pull.Author
+	}
+	ctx := &CommandContext{
+		BaseRepo: repo,
+		HeadRepo: headRepo,
+		Pull:     pull,
+		User:     models.User{Username: sender},
+		Command:  s.autoplan.Command(),
+	}
+	if !s.commandQueue.Enqueue(ctx) {
+		s.respond(w, logging.Warn, http.StatusServiceUnavailable, "Too many commands are queued, try again shortly %s", githubReqID)
+		return
+	}
+	fmt.Fprintln(w, "Processing...")
+}
+
 func (s *Server) handleCommentEvent(w http.ResponseWriter, event *gh.IssueCommentEvent, githubReqID string) {
 	if event.GetAction() != "created" {
 		s.respond(w, logging.Debug, http.StatusOK, "Ignoring comment event since action was not created %s", githubReqID)
@@ -397,9 +1196,20 @@ func (s *Server) handleCommentEvent(w http.ResponseWriter, event *gh.IssueCommen
 		s.respond(w, logging.Error, http.StatusInternalServerError, "Failed parsing event: %v %s", err, githubReqID)
 		return
 	}
+	// Unlocking skips the queue since it needs to work while a command for
+	// the pull request is stuck.
+	if command.Name == Unlock {
+		fmt.Fprintln(w, "Processing...")
+		go s.commandHandler.ExecuteCommand(ctx)
+		return
+	}
 	// respond with success and then actually execute the command asynchronously
+	// once a worker is free
+	if !s.commandQueue.Enqueue(ctx) {
+		s.respond(w, logging.Warn, http.StatusServiceUnavailable, "Too many commands are queued, try again shortly %s", githubReqID)
+		return
+	}
 	fmt.Fprintln(w, "Processing...")
-	go s.commandHandler.ExecuteCommand(ctx)
 }
 
 func (s *Server) respond(w http.ResponseWriter, lvl logging.LogLevel, code int, format string, args ...interface{}) {
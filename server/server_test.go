@@ -0,0 +1,215 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	gh "github.com/google/go-github/github"
+	"github.com/gorilla/mux"
+	lockmocks "github.com/hootsuite/atlantis/locking/mocks"
+	"github.com/hootsuite/atlantis/logging"
+	"github.com/hootsuite/atlantis/models"
+	. "github.com/hootsuite/atlantis/testing_util"
+	. "github.com/petergtz/pegomock"
+)
+
+// deletingWorkspace is a Workspace that records the pull requests it deletes.
+type deletingWorkspace struct {
+	Workspace
+	deleted []models.PullRequest
+}
+
+func (w *deletingWorkspace) Delete(repo models.Repo, pull models.PullRequest) error {
+	w.deleted = append(w.deleted, pull)
+	return nil
+}
+
+var gitlabMergeRequestEvent = `{
+  "object_kind": "merge_request",
+  "project": {
+    "path_with_namespace": "group/sub/repo",
+    "git_http_url": "https://gitlab.com/group/sub/repo.git"
+  },
+  "object_attributes": {
+    "iid": 3,
+    "action": "%s"
+  }
+}`
+
+func TestPostGitlabEvents_MergeRequest(t *testing.T) {
+	RegisterMockTestingT(t)
+	locker := lockmocks.NewMockLocker()
+	workspace := &deletingWorkspace{}
+	s := &Server{
+		logger:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+		eventParser: &EventParser{GitlabHostname: "gitlab.com", GitlabToken: "token"},
+		pullClosedExecutor: &PullClosedExecutor{
+			Locker:              locker,
+			Workspace:           workspace,
+			ConcurrentRunLocker: NewConcurrentRunLocker(),
+		},
+		gitlabWebHookSecret: "secret",
+	}
+	post := func(action string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/events", strings.NewReader(strings.Replace(gitlabMergeRequestEvent, "%s", action, 1)))
+		req.Header.Set(gitlabEventHeader, "Merge Request Hook")
+		req.Header.Set("X-Gitlab-Token", "secret")
+		w := httptest.NewRecorder()
+		s.postEvents(w, req)
+		return w
+	}
+
+	t.Log("merge requests that are updated shouldn't be cleaned up")
+	w := post("update")
+	Equals(t, http.StatusOK, w.Code)
+	Equals(t, 0, len(workspace.deleted))
+
+	for i, action := range []string{"close", "merge"} {
+		t.Logf("merge requests that %s should be cleaned up", action)
+		w = post(action)
+		Equals(t, http.StatusOK, w.Code)
+		Equals(t, "Merge request cleaned successfully", w.Body.String())
+		Equals(t, i+1, len(workspace.deleted))
+		Equals(t, 3, workspace.deleted[i].Num)
+	}
+	locker.VerifyWasCalled(Times(2)).UnlockByPull("group/sub/repo", 3)
+}
+
+func TestHandleAutoplan(t *testing.T) {
+	queued := make(chan *CommandContext, 1)
+	autoplan, err := NewAutoplan(true, "hootsuite/*")
+	Ok(t, err)
+	autoplan.Verbose = true
+	s := &Server{
+		logger:       logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+		eventParser:  &EventParser{GithubUser: "atlantis", GithubToken: "token"},
+		autoplan:     autoplan,
+		commandQueue: NewCommandQueue(1, 1, nil, func(ctx *CommandContext) { queued <- ctx }),
+	}
+	event := func(action string, repoFullName string) *gh.PullRequestEvent {
+		owner, name := path.Split(repoFullName)
+		repo := &gh.Repository{
+			FullName: gh.String(repoFullName),
+			Owner:    &gh.User{Login: gh.String(strings.TrimSuffix(owner, "/"))},
+			Name:     gh.String(name),
+			CloneURL: gh.String("https://github.com/" + repoFullName + ".git"),
+		}
+		return &gh.PullRequestEvent{
+			Action: gh.String(action),
+			Repo:   repo,
+			Sender: &gh.User{Login: gh.String("pusher")},
+			PullRequest: &gh.PullRequest{
+				Number:  gh.Int(1),
+				HTMLURL: gh.String("https://github.com/" + repoFullName + "/pull/1"),
+				User:    &gh.User{Login: gh.String("author")},
+				Head:    &gh.PullRequestBranch{SHA: gh.String("head"), Ref: gh.String("branch"), Repo: repo},
+				Base:    &gh.PullRequestBranch{SHA: gh.String("base"), Ref: gh.String("master")},
+			},
+		}
+	}
+
+	for _, action := range []string{"opened", "synchronize"} {
+		t.Logf("pull requests that are %s should be planned as whoever pushed", action)
+		w := httptest.NewRecorder()
+		s.handlePullRequestEvent(w, event(action, "hootsuite/atlantis"), "")
+		Equals(t, http.StatusOK, w.Code)
+		ctx := <-queued
+		Equals(t, "hootsuite/atlantis", ctx.BaseRepo.FullName)
+		Equals(t, 1, ctx.Pull.Num)
+		Equals(t, "pusher", ctx.User.Username)
+		Equals(t, &Command{Name: Plan, Environment: "default", AllEnvs: true, Autoplan: true, Verbose: true}, ctx.Command)
+	}
+
+	t.Log("other actions and repos that aren't planned automatically should be ignored")
+	for _, e := range []*gh.PullRequestEvent{event("labeled", "hootsuite/atlantis"), event("opened", "other/atlantis")} {
+		w := httptest.NewRecorder()
+		s.handlePullRequestEvent(w, e, "")
+		Equals(t, http.StatusOK, w.Code)
+		Assert(t, strings.HasPrefix(w.Body.String(), "Ignoring pull request event"), "expected the event to be ignored but got %q", w.Body.String())
+	}
+	select {
+	case ctx := <-queued:
+		t.Fatalf("expected nothing to be planned but %s#%d was", ctx.BaseRepo.FullName, ctx.Pull.Num)
+	default:
+	}
+}
+
+func TestPostBitbucketEvents_InvalidSignature(t *testing.T) {
+	s := &Server{
+		logger:          logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+		eventParser:     &EventParser{BitbucketURL: "https://bitbucket.example.com", BitbucketUser: "user", BitbucketToken: "token"},
+		bitbucketSecret: "secret",
+	}
+	req := httptest.NewRequest("POST", "/events", strings.NewReader(`{}`))
+	req.Header.Set(bitbucketEventHeader, "pr:comment:added")
+	req.Header.Set("X-Hub-Signature", "sha256=0000")
+	w := httptest.NewRecorder()
+	s.postEvents(w, req)
+	Equals(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestPostEvents_Unsigned(t *testing.T) {
+	t.Log("webhooks without a valid secret should be rejected before they're parsed")
+	s := &Server{
+		logger:              logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+		eventParser:         &EventParser{GitlabHostname: "gitlab.com", GitlabToken: "token"},
+		githubWebHookSecret: []byte("secret"),
+		gitlabWebHookSecret: "secret",
+	}
+
+	req := httptest.NewRequest("POST", "/events", strings.NewReader(`{"action": "created"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Github-Event", "issue_comment")
+	w := httptest.NewRecorder()
+	s.postEvents(w, req)
+	Equals(t, http.StatusUnauthorized, w.Code)
+
+	req = httptest.NewRequest("POST", "/events", strings.NewReader(`{}`))
+	req.Header.Set(gitlabEventHeader, "Note Hook")
+	req.Header.Set("X-Gitlab-Token", "wrong")
+	w = httptest.NewRecorder()
+	s.postEvents(w, req)
+	Equals(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestListRunLocks(t *testing.T) {
+	locker := NewConcurrentRunLocker()
+	s := &Server{
+		router:              mux.NewRouter(),
+		logger:              logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+		concurrentRunLocker: locker,
+	}
+	s.registerRoutes()
+	for _, l := range []ConcurrentRunLock{{RepoFullName: "hootsuite/atlantis", Env: "staging", PullNum: 1}, {RepoFullName: "lkysow/other", Env: "default", PullNum: 2}} {
+		_, ok := locker.TryLock(l.RepoFullName, l.Env, l.PullNum)
+		Assert(t, ok, "expected to lock %s", l.RepoFullName)
+	}
+	list := func(url string) []ConcurrentRunLock {
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		Equals(t, http.StatusOK, w.Code)
+		Equals(t, "application/json", w.Header().Get("Content-Type"))
+		var locks []ConcurrentRunLock
+		Ok(t, json.Unmarshal(w.Body.Bytes(), &locks))
+		for i := range locks {
+			Assert(t, !locks[i].AcquiredAt.IsZero(), "expected the time the lock was acquired")
+			locks[i].AcquiredAt = time.Time{}
+		}
+		return locks
+	}
+
+	for _, url := range []string{"/api/locks", "/locks"} {
+		t.Logf("%s should list every lock held by a running command", url)
+		Equals(t, []ConcurrentRunLock{{RepoFullName: "hootsuite/atlantis", Env: "staging", PullNum: 1}, {RepoFullName: "lkysow/other", Env: "default", PullNum: 2}}, list(url))
+
+		t.Logf("%s should only list the repo's locks with the repo query parameter", url)
+		Equals(t, []ConcurrentRunLock{{RepoFullName: "lkysow/other", Env: "default", PullNum: 2}}, list(url+"?repo=lkysow/other"))
+	}
+}
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	version "github.com/hashicorp/go-version"
+	"github.com/hootsuite/atlantis/github"
+	"github.com/hootsuite/atlantis/locking"
+	"github.com/hootsuite/atlantis/metrics"
+	"github.com/hootsuite/atlantis/models"
+	"github.com/hootsuite/atlantis/terraform"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerCommandUsage(CommandUsage{
+		Name:        StateRm,
+		Description: "Runs 'terraform state rm' in the project in dir, if Atlantis runs with --allow-state-rm",
+		Flags:       []string{"-d dir", "[-w workspace]", "address...", "[--trust]"},
+	})
+}
+
+// StateRmExecutor runs terraform state rm in a single project to remove
+// resources from its state, ex. ones that were deleted outside of terraform.
+// Since that can't be undone, it only runs if the server allows it and the
+// project is set with -d.
+type StateRmExecutor struct {
+	github                github.Client
+	githubStatus          *GithubStatus
+	terraform             *terraform.Client
+	githubCommentRenderer *GithubCommentRenderer
+	locker                locking.Locker
+	applyRequirements     *ApplyRequirements
+	configReader          *ConfigReader
+	concurrentRunLocker   *ConcurrentRunLocker
+	workspace             Workspace
+	commentReactions      *CommentReactions
+	resultComments        *ResultComments
+	outputGists           *OutputGists
+	projectDurations      *metrics.HistogramVec
+	resultsStore          *ResultsStore
+	// allowed is true if Atlantis runs with --allow-state-rm. Otherwise the
+	// command fails without running.
+	allowed bool
+	// queueTimeout is how long a state rm waits for another command running
+	// in the same environment of the pull request to complete. If it's 0,
+	// it fails right away instead.
+	queueTimeout time.Duration
+	// commandMetrics records how many state rms ran and how long they took
+	commandMetrics *CommandMetrics
+}
+
+func (s *StateRmExecutor) Execute(ctx *CommandContext) {
+	start := time.Now()
+	s.githubStatus.Update(ctx, Pending, StateRmStep)
+	s.resultComments.Acknowledge(ctx, StateRm)
+	res := s.setupAndRemove(ctx)
+	res.Command = StateRm
+	res.Environment = ctx.Command.Environment
+	s.outputGists.Upload(ctx, &res)
+	comment := s.githubCommentRenderer.Render(res, ctx.Log.History.String(), ctx.Command.Verbose)
+	s.resultComments.Create(ctx, StateRm, comment)
+	if err := s.resultsStore.Save(ctx, StateRm, res); err != nil {
+		ctx.Log.Err("saving results: %s", err)
+	}
+	s.commandMetrics.Record(ctx, StateRm, res, time.Since(start))
+	s.commentReactions.Done(ctx, res)
+}
+
+func (s *StateRmExecutor) setupAndRemove(ctx *CommandContext) CommandResponse {
+	if !s.allowed {
+		return s.failureResponse(ctx, "state rm is disabled on this Atlantis server. It must be run with --allow-state-rm to remove resources from the state.")
+	}
+	unlock, failure := lockRun(ctx, s.concurrentRunLocker, s.resultComments, s.commandMetrics, StateRm, ctx.Command.Environment, s.queueTimeout)
+	if failure != "" {
+		return s.failureResponse(ctx, failure)
+	}
+	defer unlock()
+	s.commentReactions.Running(ctx)
+
+	// state rm has the same requirements as apply
+	overridden, failure, err := s.applyRequirements.CheckPull(ctx)
+	if err != nil {
+		return s.errorResponse(ctx, err)
+	}
+	if failure != "" {
+		return s.failureResponse(ctx, failure)
+	}
+
+	cloneDir, err := s.workspace.Clone(ctx)
+	if failure := cloneFailure(err); failure != "" {
+		return s.failureResponse(ctx, failure)
+	}
+	if err != nil {
+		return s.errorResponse(ctx, err)
+	}
+	project, failure := dirProject(ctx.BaseRepo.FullName, cloneDir, ctx.Command.Dir)
+	if failure != "" {
+		return s.failureResponse(ctx, failure)
+	}
+	if !overridden {
+		failure, err := s.applyRequirements.CheckProjects(ctx, []models.Project{project})
+		if err != nil {
+			return s.errorResponse(ctx, err)
+		}
+		if failure != "" {
+			return s.failureResponse(ctx, failure)
+		}
+	}
+	ctx.projectConfigs, err = s.configReader.ReadAll(cloneDir, []models.Project{project})
+	if err != nil {
+		return s.errorResponse(ctx, errors.Wrap(err, "parsing atlantis config files"))
+	}
+
+	ctx.Log.Info("running state rm for project at path %q", project.Path)
+	start := time.Now()
+	result := s.remove(ctx, cloneDir, project)
+	result.Path = project.Path
+	result.Duration = time.Since(start)
+	s.projectDurations.Observe([]string{ctx.BaseRepo.FullName, project.Path, StateRm.String()}, result.Duration.Seconds())
+	results := []ProjectResult{result}
+	s.githubStatus.UpdateProjectResult(ctx, results)
+	return CommandResponse{ProjectResults: results}
+}
+
+func (s *StateRmExecutor) remove(ctx *CommandContext, cloneDir string, project models.Project) ProjectResult {
+	tfEnv := ctx.Command.Environment
+	lockAttempt, err := s.locker.TryLock(project, tfEnv, ctx.Pull, ctx.User)
+	if err != nil {
+		return ProjectResult{Error: errors.Wrap(err, "acquiring lock")}
+	}
+	if lockAttempt.LockAcquired != true && lockAttempt.CurrLock.Pull.Num != ctx.Pull.Num {
+		return ProjectResult{Failure: fmt.Sprintf(
+			"This project is currently locked by #%d. The locking plan must be applied or discarded before future plans can execute.",
+			lockAttempt.CurrLock.Pull.Num)}
+	}
+	ctx.Log.Info("acquired lock with id %q", lockAttempt.LockKey)
+	// the lock is only held while the state is changed. If this pull
+	// request already held it, ex. for a plan, it keeps it
+	if lockAttempt.LockAcquired {
+		defer func() {
+			if _, err := s.locker.Unlock(lockAttempt.LockKey); err != nil {
+				ctx.Log.Err("unlocking %q: %s", lockAttempt.LockKey, err)
+			}
+		}()
+	}
+
+	absolutePath := filepath.Join(cloneDir, project.Path)
+	config, hasConfig, err := projectConfig(ctx, s.configReader, absolutePath)
+	if err != nil {
+		return ProjectResult{Error: err}
+	}
+	if hasConfig {
+		ctx.Log.Info("parsed atlantis config file in %q", absolutePath)
+	}
+	envVars, failure := commentEnvVars(ctx, config)
+	if failure != "" {
+		return ProjectResult{Failure: failure}
+	}
+	roleEnvVars, cleanupRole, err := assumeRoleEnvVars(ctx, config)
+	if err != nil {
+		return ProjectResult{Error: err}
+	}
+	defer cleanupRole()
+	envVars = append(envVars, roleEnvVars...)
+
+	terraformVersion, err := projectTerraformVersion(ctx, s.terraform, absolutePath, config)
+	if err != nil {
+		return terraformErrResult(err)
+	}
+	constraints, _ := version.NewConstraint(">= 0.9.0")
+	if constraints.Check(terraformVersion) {
+		if _, err := s.terraform.RunInitAndEnv(ctx.Log, absolutePath, tfEnv, initArgs(ctx, absolutePath, config), terraformVersion, envVars); err != nil {
+			return terraformErrResult(err)
+		}
+	} else {
+		terraformGetCmd := append([]string{"get", "-no-color"}, config.GetExtraArguments("get")...)
+		if _, err := s.terraform.RunCommandWithEnvVars(ctx.Log, absolutePath, terraformGetCmd, terraformVersion, tfEnv, envVars); err != nil {
+			return terraformErrResult(err)
+		}
+	}
+
+	// terraform runs through a shell so the addresses are quoted to keep the
+	// brackets and quotes of indexed resources. The parser only allows
+	// addresses without single quotes
+	tfStateRmCmd := []string{"state", "rm"}
+	for _, address := range ctx.Command.Addresses {
+		tfStateRmCmd = append(tfStateRmCmd, "'"+address+"'")
+	}
+	output, err := s.terraform.RunCommandWithEnvVars(ctx.Log, absolutePath, tfStateRmCmd, terraformVersion, tfEnv, envVars)
+	if err != nil {
+		if _, ok := err.(terraform.NotInstalledError); ok {
+			return terraformErrResult(err)
+		}
+		return ProjectResult{Error: fmt.Errorf("%s\n%s", err.Error(), output), ExitCode: exitCode(err)}
+	}
+	ctx.Log.Info("state rm succeeded")
+	return ProjectResult{StateRmSuccess: output, ExitCode: exitCode(nil)}
+}
+
+func (s *StateRmExecutor) failureResponse(ctx *CommandContext, msg string) CommandResponse {
+	ctx.Log.Warn("%s", msg)
+	s.githubStatus.Update(ctx, Failure, StateRmStep)
+	return CommandResponse{Failure: msg}
+}
+
+func (s *StateRmExecutor) errorResponse(ctx *CommandContext, err error) CommandResponse {
+	ctx.Log.Err("%s", err)
+	s.githubStatus.Update(ctx, Error, StateRmStep)
+	return CommandResponse{Error: err}
+}
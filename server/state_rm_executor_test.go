@@ -0,0 +1,115 @@
+package server
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hootsuite/atlantis/github/mocks"
+	"github.com/hootsuite/atlantis/locking"
+	lockmocks "github.com/hootsuite/atlantis/locking/mocks"
+	"github.com/hootsuite/atlantis/logging"
+	"github.com/hootsuite/atlantis/metrics"
+	"github.com/hootsuite/atlantis/models"
+	"github.com/hootsuite/atlantis/models/fixtures"
+	"github.com/hootsuite/atlantis/terraform"
+	. "github.com/hootsuite/atlantis/testing_util"
+	. "github.com/petergtz/pegomock"
+)
+
+var stateRmTerraform = `#!/bin/sh
+if [ "$1" = "version" ]; then
+  echo "Terraform v0.10.0"
+  exit 0
+fi
+if [ "$1" = "state" ]; then
+  echo "Removed $3"
+fi
+`
+
+// clonedWorkspace is a Workspace whose pull request is already cloned into
+// dir.
+type clonedWorkspace struct {
+	Workspace
+	dir string
+}
+
+func (w clonedWorkspace) Clone(ctx *CommandContext) (string, error) {
+	return w.dir, nil
+}
+
+func TestStateRmExecutor_setupAndRemove(t *testing.T) {
+	RegisterMockTestingT(t)
+	dir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(dir)
+	Ok(t, ioutil.WriteFile(filepath.Join(dir, "terraform"), []byte(stateRmTerraform), 0755))
+	oldPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", oldPath)
+	os.Setenv("PATH", dir+":"+oldPath)
+	tf, err := terraform.NewClient("", "")
+	Ok(t, err)
+	cloneDir := filepath.Join(dir, "clone")
+	Ok(t, os.MkdirAll(filepath.Join(cloneDir, "staging"), 0755))
+
+	client := mocks.NewMockClient()
+	locker := lockmocks.NewMockLocker()
+	project := models.NewProject(fixtures.Repo.FullName, "staging")
+	When(locker.TryLock(project, "default", fixtures.Pull, fixtures.User)).ThenReturn(locking.TryLockResponse{LockAcquired: true, LockKey: "key"}, nil)
+	requirements := &ApplyRequirements{
+		Github:              client,
+		EnvironmentApproval: &EnvironmentApproval{Github: client, ConfigReader: &ConfigReader{}},
+		AdminOverride:       &AdminOverride{Github: client},
+	}
+	s := StateRmExecutor{
+		github:              client,
+		githubStatus:        &GithubStatus{Client: client},
+		terraform:           tf,
+		locker:              locker,
+		applyRequirements:   requirements,
+		configReader:        &ConfigReader{},
+		concurrentRunLocker: NewConcurrentRunLocker(),
+		workspace:           clonedWorkspace{dir: cloneDir},
+		resultComments:      &ResultComments{Github: client},
+		projectDurations:    metrics.NewRegistry().NewHistogramVec("durations", "", []string{"repo", "project", "command"}, nil),
+	}
+	newCtx := func() *CommandContext {
+		return &CommandContext{
+			BaseRepo: fixtures.Repo,
+			HeadRepo: fixtures.Repo,
+			Pull:     fixtures.Pull,
+			User:     fixtures.User,
+			Command:  &Command{Name: StateRm, Environment: "default", Dir: "staging", Addresses: []string{"aws_instance.web"}},
+			Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+		}
+	}
+
+	t.Log("state rm shouldn't run unless the server allows it")
+	res := s.setupAndRemove(newCtx())
+	Equals(t, "state rm is disabled on this Atlantis server. It must be run with --allow-state-rm to remove resources from the state.", res.Failure)
+	s.allowed = true
+
+	t.Log("state rm should need the pull request to be approved like apply")
+	requirements.RequireApproval = true
+	res = s.setupAndRemove(newCtx())
+	Equals(t, "Pull request must be approved before running state rm.", res.Failure)
+	When(client.PullIsApproved(fixtures.Repo, fixtures.Pull)).ThenReturn(true, nil)
+
+	t.Log("state rm should need the environment's apply_approvers like apply")
+	When(client.GetFileContents(fixtures.Repo, "staging/"+ProjectConfigFile, fixtures.Pull.BaseBranch)).ThenReturn("apply_approvers:\n  - environment: default\n    approvers: [bob]\n", true, nil)
+	res = s.setupAndRemove(newCtx())
+	Equals(t, "Running state rm in the default environment requires more approvals. Still waiting on:\n* `staging`: 1 more approval(s) from bob (none so far)", res.Failure)
+	When(client.GetApprovers(fixtures.Repo, fixtures.Pull)).ThenReturn([]string{"bob"}, nil)
+
+	t.Log("once approved the resources should be removed and the project unlocked")
+	res = s.setupAndRemove(newCtx())
+	Equals(t, "", res.Failure)
+	Assert(t, res.Error == nil, "expected no error but got %v", res.Error)
+	Equals(t, 1, len(res.ProjectResults))
+	Equals(t, "staging", res.ProjectResults[0].Path)
+	Assert(t, strings.Contains(res.ProjectResults[0].StateRmSuccess, "Removed aws_instance.web"), "expected the state rm output but got %q", res.ProjectResults[0].StateRmSuccess)
+	locker.VerifyWasCalledOnce().Unlock("key")
+}
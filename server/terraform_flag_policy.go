@@ -0,0 +1,112 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TerraformFlagPolicy restricts which flags terraform can be run with, either
+// from a comment or from a project's extra_arguments. Since anyone who can
+// open a pull request can change a project's config, projects can only
+// restrict their flags further and can't allow flags that are denied here.
+// A nil TerraformFlagPolicy only applies the projects' restrictions.
+type TerraformFlagPolicy struct {
+	// Denied are the flags that can never be used, ex. -backend=false. A flag
+	// without a value, ex. -lock, denies the flag with any value.
+	Denied []string
+}
+
+// Check returns a failure message if any of the flags terraform would be run
+// with for command in the project with config aren't allowed. initArgs are the
+// extra arguments that init will be run with.
+func (t *TerraformFlagPolicy) Check(ctx *CommandContext, config ProjectConfig, command CommandName, initArgs []string) string {
+	var denied []string
+	if t != nil {
+		denied = t.Denied
+	}
+	configFlags := append(append(append(append([]string{}, initArgs...), config.GetExtraArguments(command.String())...), parallelismArgs(config.Parallelism)...), lockTimeoutArgs(config.LockTimeout)...)
+
+	var disallowed []string
+	for _, f := range configFlags {
+		if isFlag(f) && matchesFlag(f, denied) {
+			disallowed = append(disallowed, f)
+		}
+	}
+	// -target, -var-file, -parallelism and -lock-timeout are parsed out of
+	// the comment's flags but are still restricted. The targets aren't
+	// quoted like targetArgs quotes them for the shell
+	commentFlags := append([]string{}, ctx.Command.Flags...)
+	for _, target := range ctx.Command.Targets {
+		commentFlags = append(commentFlags, "-target="+target)
+	}
+	commentFlags = append(append(append(commentFlags, varFileArgs(ctx.Command.VarFiles)...), parallelismArgs(ctx.Command.Parallelism)...), lockTimeoutArgs(ctx.Command.LockTimeout)...)
+	for _, f := range commentFlags {
+		if !isFlag(f) {
+			continue
+		}
+		if matchesFlag(f, denied) || matchesFlag(f, config.DeniedFlags) || (len(config.AllowedFlags) > 0 && !matchesFlag(f, config.AllowedFlags)) {
+			disallowed = append(disallowed, f)
+		}
+	}
+	if len(disallowed) == 0 {
+		return ""
+	}
+	ctx.Log.Warn("terraform flags %s are not allowed", strings.Join(disallowed, ", "))
+	return fmt.Sprintf("The terraform flag(s) `%s` aren't allowed for this project.", strings.Join(disallowed, "`, `"))
+}
+
+// matchesFlag returns true if arg is one of flags. Flags with a value, ex.
+// -backend=false, only match arg with that value. Boolean values match however
+// terraform accepts them, ex. -backend=0 or -lock=FALSE, and a boolean flag
+// without a value is true. Flags can be written with one or two dashes, like
+// terraform accepts.
+func matchesFlag(arg string, flags []string) bool {
+	name, value, hasValue := splitFlag(normalizeFlag(arg))
+	for _, f := range flags {
+		fName, fValue, fHasValue := splitFlag(normalizeFlag(f))
+		if name != fName {
+			continue
+		}
+		if !fHasValue {
+			return true
+		}
+		fBool, err := strconv.ParseBool(fValue)
+		if err != nil {
+			if hasValue && value == fValue {
+				return true
+			}
+			continue
+		}
+		if !hasValue {
+			value = "true"
+		}
+		if b, err := strconv.ParseBool(value); err == nil && b == fBool {
+			return true
+		}
+	}
+	return false
+}
+
+// splitFlag splits flag into its name and value, and returns whether it had a
+// value.
+func splitFlag(flag string) (name string, value string, hasValue bool) {
+	parts := strings.SplitN(flag, "=", 2)
+	if len(parts) == 1 {
+		return parts[0], "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// isFlag returns false if arg is a flag's value, ex. the resource in
+// -target resource.
+func isFlag(arg string) bool {
+	return strings.HasPrefix(arg, "-")
+}
+
+func normalizeFlag(flag string) string {
+	if strings.HasPrefix(flag, "--") {
+		return flag[1:]
+	}
+	return flag
+}
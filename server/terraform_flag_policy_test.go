@@ -0,0 +1,86 @@
+package server_test
+
+import (
+	"log"
+	"os"
+	"testing"
+
+	"github.com/hootsuite/atlantis/logging"
+	"github.com/hootsuite/atlantis/server"
+	. "github.com/hootsuite/atlantis/testing_util"
+)
+
+func flagPolicyCtx(flags ...string) *server.CommandContext {
+	return &server.CommandContext{
+		Command: &server.Command{Name: server.Plan, Flags: flags},
+		Log:     logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+}
+
+func TestTerraformFlagPolicy_Denied(t *testing.T) {
+	p := &server.TerraformFlagPolicy{Denied: []string{"-backend=false", "-lock"}}
+	cases := []struct {
+		Flags    []string
+		Expected string
+	}{
+		{[]string{"-target", "aws_instance.web", "-var", "a=b"}, ""},
+		{[]string{"-backend=true"}, ""},
+		{[]string{"-backend=false"}, "The terraform flag(s) `-backend=false` aren't allowed for this project."},
+		{[]string{"-lock=false", "--lock"}, "The terraform flag(s) `-lock=false`, `--lock` aren't allowed for this project."},
+		{[]string{"-backend=0"}, "The terraform flag(s) `-backend=0` aren't allowed for this project."},
+		{[]string{"-backend=FALSE"}, "The terraform flag(s) `-backend=FALSE` aren't allowed for this project."},
+		{[]string{"-backend", "-backend=1"}, ""},
+	}
+	for _, c := range cases {
+		t.Logf("testing %v", c.Flags)
+		Equals(t, c.Expected, p.Check(flagPolicyCtx(c.Flags...), server.ProjectConfig{}, server.Plan, nil))
+	}
+
+	t.Log("denied flags in the project's extra arguments should also fail")
+	config := server.ProjectConfig{ExtraArguments: []server.CommandExtraArguments{{Name: "plan", Arguments: []string{"-lock=false"}}}}
+	Equals(t, "The terraform flag(s) `-lock=false` aren't allowed for this project.", p.Check(flagPolicyCtx(), config, server.Plan, nil))
+	Equals(t, "", p.Check(flagPolicyCtx(), config, server.Apply, nil))
+	Equals(t, "The terraform flag(s) `-backend=false` aren't allowed for this project.", p.Check(flagPolicyCtx(), server.ProjectConfig{}, server.Apply, []string{"-backend=false"}))
+
+	t.Log("the -parallelism set in a comment or the project's config should also be checked")
+	p = &server.TerraformFlagPolicy{Denied: []string{"-parallelism"}}
+	ctx := flagPolicyCtx()
+	ctx.Command.Parallelism = 50
+	Equals(t, "The terraform flag(s) `-parallelism=50` aren't allowed for this project.", p.Check(ctx, server.ProjectConfig{}, server.Apply, nil))
+	Equals(t, "The terraform flag(s) `-parallelism=50` aren't allowed for this project.", p.Check(flagPolicyCtx(), server.ProjectConfig{Parallelism: 50}, server.Apply, nil))
+
+	t.Log("so should the -lock-timeout")
+	p = &server.TerraformFlagPolicy{Denied: []string{"-lock-timeout"}}
+	ctx = flagPolicyCtx()
+	ctx.Command.LockTimeout = "1h"
+	Equals(t, "The terraform flag(s) `-lock-timeout=1h` aren't allowed for this project.", p.Check(ctx, server.ProjectConfig{}, server.Apply, nil))
+	Equals(t, "The terraform flag(s) `-lock-timeout=1h` aren't allowed for this project.", p.Check(flagPolicyCtx(), server.ProjectConfig{LockTimeout: "1h"}, server.Apply, nil))
+}
+
+func TestTerraformFlagPolicy_Project(t *testing.T) {
+	t.Log("projects should be able to restrict comment flags further")
+	var p *server.TerraformFlagPolicy
+	config := server.ProjectConfig{AllowedFlags: []string{"-target", "-var"}, DeniedFlags: []string{"-var"}}
+	Equals(t, "", p.Check(flagPolicyCtx("-target", "aws_instance.web"), config, server.Plan, nil))
+	Equals(t, "The terraform flag(s) `-var`, `-refresh=false` aren't allowed for this project.", p.Check(flagPolicyCtx("-var", "a=b", "-refresh=false"), config, server.Plan, nil))
+
+	t.Log("-target should be restricted even though it's parsed out of the flags")
+	ctx := flagPolicyCtx()
+	ctx.Command.Targets = []string{"aws_instance.web"}
+	Equals(t, "", p.Check(ctx, config, server.Plan, nil))
+	Equals(t, "The terraform flag(s) `-target=aws_instance.web` aren't allowed for this project.", p.Check(ctx, server.ProjectConfig{DeniedFlags: []string{"-target"}}, server.Plan, nil))
+
+	t.Log("so should -var-file")
+	ctx = flagPolicyCtx()
+	ctx.Command.VarFiles = []string{"secrets.tfvars"}
+	Equals(t, "The terraform flag(s) `-var-file=secrets.tfvars` aren't allowed for this project.", p.Check(ctx, server.ProjectConfig{DeniedFlags: []string{"-var-file"}}, server.Plan, nil))
+
+	t.Log("and -parallelism")
+	ctx = flagPolicyCtx()
+	ctx.Command.Parallelism = 50
+	Equals(t, "The terraform flag(s) `-parallelism=50` aren't allowed for this project.", p.Check(ctx, server.ProjectConfig{DeniedFlags: []string{"-parallelism"}}, server.Plan, nil))
+
+	t.Log("but their own extra arguments aren't restricted")
+	config.ExtraArguments = []server.CommandExtraArguments{{Name: "plan", Arguments: []string{"-refresh=false"}}}
+	Equals(t, "", p.Check(flagPolicyCtx(), config, server.Plan, nil))
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/hootsuite/atlantis/github"
+)
+
+func init() {
+	registerCommandUsage(CommandUsage{
+		Name:        Unlock,
+		Description: "Releases this pull request's lock on an environment if a command left it held",
+		Flags:       []string{"[environment]"},
+	})
+}
+
+// UnlockExecutor handles the unlock command which releases a lock on an
+// environment of the pull request that was left held, ex. by a command that's
+// stuck. Only the pull request's own locks can be released.
+type UnlockExecutor struct {
+	Github              github.Client
+	ConcurrentRunLocker *ConcurrentRunLocker
+}
+
+func (u *UnlockExecutor) Execute(ctx *CommandContext) {
+	env := ctx.Command.Environment
+	var comment string
+	if u.ConcurrentRunLocker.ForceUnlock(ctx.BaseRepo.FullName, env, ctx.Pull.Num) {
+		ctx.Log.Warn("released the lock on the %s environment", env)
+		comment = fmt.Sprintf("Released the lock on the `%s` environment for this pull request. If the command that held it is stuck, it's still running on its worker so the commands queued behind it won't start until it exits or Atlantis is restarted.", env)
+	} else {
+		ctx.Log.Info("no lock was held on the %s environment", env)
+		comment = fmt.Sprintf("No lock was held on the `%s` environment for this pull request.", env)
+	}
+	u.Github.CreateComment(ctx.BaseRepo, ctx.Pull, comment)
+}
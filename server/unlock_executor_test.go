@@ -0,0 +1,44 @@
+package server_test
+
+import (
+	"log"
+	"os"
+	"testing"
+
+	"github.com/hootsuite/atlantis/github/mocks"
+	"github.com/hootsuite/atlantis/logging"
+	"github.com/hootsuite/atlantis/models"
+	"github.com/hootsuite/atlantis/server"
+	. "github.com/hootsuite/atlantis/testing_util"
+	. "github.com/petergtz/pegomock"
+)
+
+func TestUnlockExecutor(t *testing.T) {
+	RegisterMockTestingT(t)
+	client := mocks.NewMockClient()
+	locker := server.NewConcurrentRunLocker()
+	u := server.UnlockExecutor{Github: client, ConcurrentRunLocker: locker}
+	ctx := server.CommandContext{
+		BaseRepo: models.Repo{FullName: "owner/repo"},
+		Pull:     models.PullRequest{Num: 1},
+		Command:  &server.Command{Name: server.Unlock, Environment: "staging"},
+		Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+
+	t.Log("the lock of the pull request should be released")
+	_, ok := locker.TryLock("owner/repo", "staging", 1)
+	Equals(t, true, ok)
+	_, ok = locker.TryLock("owner/repo", "staging", 2)
+	Equals(t, true, ok)
+	u.Execute(&ctx)
+	client.VerifyWasCalledOnce().CreateComment(ctx.BaseRepo, ctx.Pull, "Released the lock on the `staging` environment for this pull request. If the command that held it is stuck, it's still running on its worker so the commands queued behind it won't start until it exits or Atlantis is restarted.")
+	unlock, ok := locker.TryLock("owner/repo", "staging", 1)
+	Equals(t, true, ok)
+	_, ok = locker.TryLock("owner/repo", "staging", 2)
+	Equals(t, false, ok)
+
+	t.Log("if no lock is held we should say so")
+	unlock()
+	u.Execute(&ctx)
+	client.VerifyWasCalledOnce().CreateComment(ctx.BaseRepo, ctx.Pull, "No lock was held on the `staging` environment for this pull request.")
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	gh "github.com/google/go-github/github"
+	"github.com/hootsuite/atlantis/github"
+	"github.com/hootsuite/atlantis/models"
+	"github.com/pkg/errors"
+)
+
+// VCSClient sends each request to the client for the host of the repo it's
+// for so the rest of Atlantis can use one client for GitHub, GitLab and
+// Bitbucket. Requests that aren't for a repo, ex. for teams or gists, go to
+// GitHub.
+type VCSClient struct {
+	Github github.Client
+	// Gitlab is nil if GitLab isn't configured
+	Gitlab github.Client
+	// Bitbucket is nil if Bitbucket isn't configured
+	Bitbucket github.Client
+}
+
+// client returns the client for repo's host.
+func (v *VCSClient) client(repo models.Repo) (github.Client, error) {
+	switch repo.VCSHost {
+	case models.Gitlab:
+		if v.Gitlab == nil {
+			return nil, errors.New("GitLab isn't configured")
+		}
+		return v.Gitlab, nil
+	case models.Bitbucket:
+		if v.Bitbucket == nil {
+			return nil, errors.New("Bitbucket isn't configured")
+		}
+		return v.Bitbucket, nil
+	}
+	return v.Github, nil
+}
+
+func (v *VCSClient) GetModifiedFiles(repo models.Repo, pull models.PullRequest) ([]string, error) {
+	c, err := v.client(repo)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetModifiedFiles(repo, pull)
+}
+
+func (v *VCSClient) CreateComment(repo models.Repo, pull models.PullRequest, comment string) error {
+	c, err := v.client(repo)
+	if err != nil {
+		return err
+	}
+	return c.CreateComment(repo, pull, comment)
+}
+
+func (v *VCSClient) CreateCommentWithID(repo models.Repo, pull models.PullRequest, comment string) (int, error) {
+	c, err := v.client(repo)
+	if err != nil {
+		return 0, err
+	}
+	return c.CreateCommentWithID(repo, pull, comment)
+}
+
+func (v *VCSClient) EditComment(repo models.Repo, commentID int, comment string) error {
+	c, err := v.client(repo)
+	if err != nil {
+		return err
+	}
+	return c.EditComment(repo, commentID, comment)
+}
+
+func (v *VCSClient) PullIsApproved(repo models.Repo, pull models.PullRequest) (bool, error) {
+	c, err := v.client(repo)
+	if err != nil {
+		return false, err
+	}
+	return c.PullIsApproved(repo, pull)
+}
+
+func (v *VCSClient) GetApprovers(repo models.Repo, pull models.PullRequest) ([]string, error) {
+	c, err := v.client(repo)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetApprovers(repo, pull)
+}
+
+func (v *VCSClient) GetTeamMembers(org string, teamSlug string) ([]string, error) {
+	return v.Github.GetTeamMembers(org, teamSlug)
+}
+
+func (v *VCSClient) GetPullRequest(repo models.Repo, num int) (*gh.PullRequest, *gh.Response, error) {
+	c, err := v.client(repo)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.GetPullRequest(repo, num)
+}
+
+func (v *VCSClient) UpdateStatus(repo models.Repo, pull models.PullRequest, state string, description string, targetURL string, context string) error {
+	c, err := v.client(repo)
+	if err != nil {
+		return err
+	}
+	return c.UpdateStatus(repo, pull, state, description, targetURL, context)
+}
+
+func (v *VCSClient) AddReaction(repo models.Repo, commentID int, content string) (int, error) {
+	c, err := v.client(repo)
+	if err != nil {
+		return 0, err
+	}
+	return c.AddReaction(repo, commentID, content)
+}
+
+// DeleteReaction always goes to GitHub. Only the GitHub client adds
+// reactions so reactionID is always one of GitHub's, and there's no repo to
+// pick a client by.
+func (v *VCSClient) DeleteReaction(reactionID int) error {
+	return v.Github.DeleteReaction(reactionID)
+}
+
+func (v *VCSClient) GetComments(repo models.Repo, pull models.PullRequest) ([]*gh.IssueComment, error) {
+	c, err := v.client(repo)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetComments(repo, pull)
+}
+
+func (v *VCSClient) DeleteComment(repo models.Repo, commentID int) error {
+	c, err := v.client(repo)
+	if err != nil {
+		return err
+	}
+	return c.DeleteComment(repo, commentID)
+}
+
+func (v *VCSClient) MinimizeComment(repo models.Repo, commentID int) error {
+	c, err := v.client(repo)
+	if err != nil {
+		return err
+	}
+	return c.MinimizeComment(repo, commentID)
+}
+
+func (v *VCSClient) AddLabel(repo models.Repo, pull models.PullRequest, label string) error {
+	c, err := v.client(repo)
+	if err != nil {
+		return err
+	}
+	return c.AddLabel(repo, pull, label)
+}
+
+func (v *VCSClient) RemoveLabel(repo models.Repo, pull models.PullRequest, label string) error {
+	c, err := v.client(repo)
+	if err != nil {
+		return err
+	}
+	return c.RemoveLabel(repo, pull, label)
+}
+
+func (v *VCSClient) IsCollaborator(repo models.Repo, user string) (bool, error) {
+	c, err := v.client(repo)
+	if err != nil {
+		return false, err
+	}
+	return c.IsCollaborator(repo, user)
+}
+
+func (v *VCSClient) RepoIsArchived(repo models.Repo) (bool, error) {
+	c, err := v.client(repo)
+	if err != nil {
+		return false, err
+	}
+	return c.RepoIsArchived(repo)
+}
+
+func (v *VCSClient) GetFileContents(repo models.Repo, path string, ref string) (string, bool, error) {
+	c, err := v.client(repo)
+	if err != nil {
+		return "", false, err
+	}
+	return c.GetFileContents(repo, path, ref)
+}
+
+func (v *VCSClient) CreateGist(description string, filename string, content string) (string, error) {
+	return v.Github.CreateGist(description, filename, content)
+}
+
+func (v *VCSClient) GetGists() ([]*gh.Gist, error) {
+	return v.Github.GetGists()
+}
+
+func (v *VCSClient) DeleteGist(id string) error {
+	return v.Github.DeleteGist(id)
+}
@@ -0,0 +1,54 @@
+package server_test
+
+import (
+	"testing"
+
+	"github.com/hootsuite/atlantis/github/mocks"
+	"github.com/hootsuite/atlantis/models"
+	"github.com/hootsuite/atlantis/models/fixtures"
+	"github.com/hootsuite/atlantis/server"
+	. "github.com/hootsuite/atlantis/testing_util"
+	. "github.com/petergtz/pegomock"
+)
+
+func TestVCSClient_Routing(t *testing.T) {
+	t.Log("requests should go to the client for the repo's host")
+	RegisterMockTestingT(t)
+	github := mocks.NewMockClient()
+	gitlab := mocks.NewMockClient()
+	c := server.VCSClient{Github: github, Gitlab: gitlab}
+	gitlabRepo := fixtures.Repo
+	gitlabRepo.VCSHost = models.Gitlab
+
+	Ok(t, c.CreateComment(fixtures.Repo, fixtures.Pull, "github"))
+	Ok(t, c.CreateComment(gitlabRepo, fixtures.Pull, "gitlab"))
+	github.VerifyWasCalledOnce().CreateComment(fixtures.Repo, fixtures.Pull, "github")
+	gitlab.VerifyWasCalledOnce().CreateComment(gitlabRepo, fixtures.Pull, "gitlab")
+
+	t.Log("and Bitbucket repos to the Bitbucket client")
+	bitbucket := mocks.NewMockClient()
+	c.Bitbucket = bitbucket
+	bitbucketRepo := fixtures.Repo
+	bitbucketRepo.VCSHost = models.Bitbucket
+	Ok(t, c.CreateComment(bitbucketRepo, fixtures.Pull, "bitbucket"))
+	bitbucket.VerifyWasCalledOnce().CreateComment(bitbucketRepo, fixtures.Pull, "bitbucket")
+	github.VerifyWasCalled(Never()).CreateComment(bitbucketRepo, fixtures.Pull, "bitbucket")
+
+	t.Log("requests that aren't for a repo should go to GitHub")
+	Ok(t, c.DeleteGist("1"))
+	github.VerifyWasCalledOnce().DeleteGist("1")
+	gitlab.VerifyWasCalled(Never()).DeleteGist(AnyString())
+}
+
+func TestVCSClient_GitlabNotConfigured(t *testing.T) {
+	RegisterMockTestingT(t)
+	github := mocks.NewMockClient()
+	c := server.VCSClient{Github: github}
+	gitlabRepo := fixtures.Repo
+	gitlabRepo.VCSHost = models.Gitlab
+
+	err := c.CreateComment(gitlabRepo, fixtures.Pull, "comment")
+	Assert(t, err != nil, "expected an error")
+	Equals(t, "GitLab isn't configured", err.Error())
+	github.VerifyWasCalled(Never()).CreateComment(AnyRepo(), AnyPullRequest(), AnyString())
+}
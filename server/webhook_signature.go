@@ -0,0 +1,84 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// githubSignatureHeader is the header GitHub sends the HMAC-SHA256 of a
+// webhook's body in, ex. sha256={hex digest}.
+const githubSignatureHeader = "X-Hub-Signature-256"
+
+// legacyGithubSignatureHeader is the header with the HMAC-SHA1 of a webhook's
+// body, ex. sha1={hex digest}. It's only used if GitHub didn't send
+// githubSignatureHeader, like older GitHub Enterprise versions.
+const legacyGithubSignatureHeader = "X-Hub-Signature"
+
+// validateGithubSignature returns why the webhook with header and body isn't
+// signed with secret, or nil if it is.
+func validateGithubSignature(header http.Header, body []byte, secret []byte) error {
+	signature := header.Get(githubSignatureHeader)
+	prefix, hashFunc := "sha256=", sha256.New
+	if signature == "" {
+		signature = header.Get(legacyGithubSignatureHeader)
+		prefix, hashFunc = "sha1=", sha1.New
+	}
+	if signature == "" {
+		return fmt.Errorf("missing %s header", githubSignatureHeader)
+	}
+	return validateSignature(signature, prefix, hashFunc, body, secret)
+}
+
+// bitbucketSignatureHeader is the header Bitbucket Server sends the
+// HMAC-SHA256 of a webhook's body in, ex. sha256={hex digest}.
+const bitbucketSignatureHeader = "X-Hub-Signature"
+
+// validateBitbucketSignature returns why the webhook with header and body
+// isn't signed with secret, or nil if it is.
+func validateBitbucketSignature(header http.Header, body []byte, secret []byte) error {
+	signature := header.Get(bitbucketSignatureHeader)
+	if signature == "" {
+		return fmt.Errorf("missing %s header", bitbucketSignatureHeader)
+	}
+	return validateSignature(signature, "sha256=", sha256.New, body, secret)
+}
+
+// validateSignature returns why signature, which is prefix followed by the
+// hex digest, isn't the HMAC of body with secret using hashFunc, or nil if
+// it is.
+func validateSignature(signature string, prefix string, hashFunc func() hash.Hash, body []byte, secret []byte) error {
+	if !strings.HasPrefix(signature, prefix) {
+		return fmt.Errorf("signature %q doesn't start with %s", signature, prefix)
+	}
+	given, err := hex.DecodeString(strings.TrimPrefix(signature, prefix))
+	if err != nil {
+		return fmt.Errorf("signature %q isn't hex", signature)
+	}
+	mac := hmac.New(hashFunc, secret)
+	mac.Write(body)
+	if !hmac.Equal(given, mac.Sum(nil)) {
+		return errors.New("signature doesn't match the body")
+	}
+	return nil
+}
+
+// requestSource returns the IP address r came from for logs, and the
+// addresses it was forwarded for if it came through a proxy.
+func requestSource(r *http.Request) string {
+	source := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		source = host
+	}
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		source = fmt.Sprintf("%s (X-Forwarded-For: %s)", source, forwarded)
+	}
+	return source
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"testing"
+
+	. "github.com/hootsuite/atlantis/testing_util"
+)
+
+var signatureSecret = []byte("secret")
+var signatureBody = []byte(`{"action":"created"}`)
+
+func sign(hashFunc func() hash.Hash, body []byte) string {
+	mac := hmac.New(hashFunc, signatureSecret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestValidateGithubSignature_SHA256(t *testing.T) {
+	header := http.Header{}
+	header.Set("X-Hub-Signature-256", "sha256="+sign(sha256.New, signatureBody))
+	Ok(t, validateGithubSignature(header, signatureBody, signatureSecret))
+}
+
+func TestValidateGithubSignature_LegacySHA1(t *testing.T) {
+	t.Log("if GitHub only sent X-Hub-Signature its sha1 should be checked")
+	header := http.Header{}
+	header.Set("X-Hub-Signature", "sha1="+sign(sha1.New, signatureBody))
+	Ok(t, validateGithubSignature(header, signatureBody, signatureSecret))
+}
+
+func TestValidateGithubSignature_Missing(t *testing.T) {
+	err := validateGithubSignature(http.Header{}, signatureBody, signatureSecret)
+	Assert(t, err != nil, "expected an error")
+	Equals(t, "missing X-Hub-Signature-256 header", err.Error())
+}
+
+func TestValidateGithubSignature_Mismatched(t *testing.T) {
+	t.Log("signatures of a different body or secret shouldn't validate")
+	cases := []struct {
+		signature string
+		expErr    string
+	}{
+		{"sha256=" + sign(sha256.New, []byte("other")), "signature doesn't match the body"},
+		{"sha1=" + sign(sha1.New, signatureBody), `signature "sha1=` + sign(sha1.New, signatureBody) + `" doesn't start with sha256=`},
+		{"sha256=nothex", `signature "sha256=nothex" isn't hex`},
+	}
+	for _, c := range cases {
+		header := http.Header{}
+		header.Set("X-Hub-Signature-256", c.signature)
+		err := validateGithubSignature(header, signatureBody, signatureSecret)
+		Assert(t, err != nil, "expected an error for %s", c.signature)
+		Equals(t, c.expErr, err.Error())
+	}
+	header := http.Header{}
+	header.Set("X-Hub-Signature-256", "sha256="+sign(sha256.New, signatureBody))
+	Assert(t, validateGithubSignature(header, signatureBody, []byte("wrong")) != nil, "expected an error for the wrong secret")
+}
+
+func TestValidateBitbucketSignature(t *testing.T) {
+	header := http.Header{}
+	Equals(t, "missing X-Hub-Signature header", validateBitbucketSignature(header, signatureBody, signatureSecret).Error())
+	header.Set("X-Hub-Signature", "sha256="+sign(sha256.New, signatureBody))
+	Ok(t, validateBitbucketSignature(header, signatureBody, signatureSecret))
+	Equals(t, "signature doesn't match the body", validateBitbucketSignature(header, signatureBody, []byte("wrong")).Error())
+}
+
+func TestRequestSource(t *testing.T) {
+	r, _ := http.NewRequest("POST", "/events", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	Equals(t, "10.0.0.1", requestSource(r))
+	r.Header.Set("X-Forwarded-For", "1.2.3.4")
+	Equals(t, "10.0.0.1 (X-Forwarded-For: 1.2.3.4)", requestSource(r))
+}
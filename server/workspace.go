@@ -1,10 +1,14 @@
 package server
 
 import (
+	"fmt"
+	"net/url"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/hootsuite/atlantis/models"
 	"github.com/pkg/errors"
@@ -12,48 +16,514 @@ import (
 
 const workspacePrefix = "repos"
 
+const (
+	// IgnoreMergeConflicts plans the pull request branch as is, without
+	// checking whether it conflicts with the base branch.
+	IgnoreMergeConflicts = "ignore"
+	// FailOnMergeConflicts checks that the pull request branch merges cleanly
+	// into the base branch but still plans the pull request branch as is.
+	FailOnMergeConflicts = "fail"
+	// MergeBaseBranch merges the base branch into the pull request branch
+	// before planning so the plan reflects the merged state.
+	MergeBaseBranch = "merge"
+	// UseMergeRef checks out the merge commit GitHub, GitLab or Bitbucket
+	// keeps for the pull request so the plan reflects the merged state. If
+	// there isn't an up to date one, ex. because of conflicts, the pull
+	// request branch is planned as is.
+	UseMergeRef = "merge-ref"
+)
+
+// MergeConflictError is returned when cloning if the pull request branch
+// can't be merged cleanly into the base branch.
+type MergeConflictError struct {
+	BaseBranch string
+	Files      []string
+}
+
+func (m *MergeConflictError) Error() string {
+	return fmt.Sprintf("cannot plan due to merge conflicts with base branch %q in: %s", m.BaseBranch, strings.Join(m.Files, ", "))
+}
+
+// ErrMissingCloneURL is returned when cloning if the pull request's head
+// repo has no clone URL, ex. because the fork it came from was deleted.
+var ErrMissingCloneURL = errors.New("unable to determine repository clone URL; the source branch may have been deleted")
+
 //go:generate pegomock generate --use-experimental-model-gen --package mocks -o mocks/mock_workspace.go Workspace
 
 type Workspace interface {
 	Clone(ctx *CommandContext) (string, error)
 	GetWorkspace(ctx *CommandContext) (string, error)
+	// PlannedCommit returns the commit of the pull request that was checked
+	// out when repoDir was cloned, which is the commit its plans were made
+	// from. It returns an empty string if repoDir was cloned before we
+	// started recording the commit.
+	PlannedCommit(repoDir string) (string, error)
 	Delete(repo models.Repo, pull models.PullRequest) error
 }
 
+// plannedCommitKey is the git config key in each clone that we store the
+// commit we checked out under. We can't get it from HEAD because merging the
+// base branch moves HEAD to the merge commit.
+const plannedCommitKey = "atlantis.plannedCommit"
+
 type FileWorkspace struct {
 	dataDir string
-	sshKey  string
+	// sshKey is the path of the private key to clone and fetch over SSH
+	// with if none of repoSSHKeys match the repo, or empty to use the SSH
+	// config of the user Atlantis runs as
+	sshKey string
+	// repoSSHKeys are the paths of the private keys for specific repos, by
+	// the repo's host, ex. github.com, its full name, ex. owner/repo, or
+	// both, ex. github.com/owner/repo. The most specific match is used.
+	repoSSHKeys map[string]string
+	// mergeConflicts is one of IgnoreMergeConflicts, FailOnMergeConflicts,
+	// MergeBaseBranch or UseMergeRef.
+	mergeConflicts string
+	// depth is how many commits of the pull request branch's history to
+	// clone, or 0 to clone the full history
+	depth int
+	// submodules is true if the submodules of the checked out commit should
+	// be checked out too
+	submodules bool
+	// repoAllowlist is --repo-allowlist. Submodules listed in it can be
+	// fetched with their own SSH keys.
+	repoAllowlist *RepoAllowlist
 }
 
 func (w *FileWorkspace) Clone(ctx *CommandContext) (string, error) {
+	// without this check git would fail with a confusing error about the
+	// destination path
+	if ctx.HeadRepo.CloneURL == "" {
+		return "", ErrMissingCloneURL
+	}
 	cloneDir := w.cloneDir(ctx)
 
 	// this is safe to do because we lock runs on repo/pull/env so no one else is using this workspace
-	ctx.Log.Info("cleaning clone directory %q", cloneDir)
-	if err := os.RemoveAll(cloneDir); err != nil {
-		return "", errors.Wrap(err, "deleting old workspace")
+	shallow, fetched := w.fetch(ctx, cloneDir)
+	if !fetched {
+		ctx.Log.Info("cleaning clone directory %q", cloneDir)
+		if err := os.RemoveAll(cloneDir); err != nil {
+			return "", errors.Wrap(err, "deleting old workspace")
+		}
+
+		// create the directory and parents if necessary
+		ctx.Log.Info("creating dir %q", cloneDir)
+		if err := os.MkdirAll(cloneDir, 0755); err != nil {
+			return "", errors.Wrap(err, "creating new workspace")
+		}
+
+		var err error
+		shallow, err = w.clone(ctx, cloneDir)
+		if err != nil {
+			return "", err
+		}
+	}
+	if shallow && !w.hasCommit(cloneDir, ctx.Pull.HeadCommit) {
+		// the branch has moved on by more than depth commits since the
+		// commit we're running for
+		if err := w.unshallow(ctx, cloneDir); err != nil {
+			return "", err
+		}
+		shallow = false
 	}
 
-	// create the directory and parents if necessary
-	ctx.Log.Info("creating dir %q", cloneDir)
-	if err := os.MkdirAll(cloneDir, 0755); err != nil {
-		return "", errors.Wrap(err, "creating new workspace")
+	// check out the head commit of this PR on a local branch with the same
+	// name as the PR's branch. Checking out the commit by itself would leave
+	// us with a detached HEAD which breaks tools that read the branch name,
+	// ex. with git symbolic-ref
+	checkoutArgs := []string{"checkout", ctx.Pull.Branch}
+	if ctx.Pull.HeadCommit != "" {
+		checkoutArgs = []string{"checkout", "-B", ctx.Pull.Branch, ctx.Pull.HeadCommit}
+	} else if fetched {
+		// the local branch is where the previous command left it
+		checkoutArgs = []string{"checkout", "-B", ctx.Pull.Branch, "refs/remotes/origin/" + ctx.Pull.Branch}
+	}
+	ctx.Log.Info("checking out branch %q at %q", ctx.Pull.Branch, ctx.Pull.HeadCommit)
+	if output, err := w.git(cloneDir, checkoutArgs...); err != nil {
+		return "", errors.Wrapf(err, "checking out branch %s: %s", ctx.Pull.Branch, output)
+	}
+	headCommit, err := w.git(cloneDir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", errors.Wrapf(err, "getting checked out commit: %s", headCommit)
+	}
+	if output, err := w.git(cloneDir, "config", plannedCommitKey, strings.TrimSpace(headCommit)); err != nil {
+		return "", errors.Wrapf(err, "recording checked out commit: %s", output)
+	}
+
+	if w.mergeConflicts == FailOnMergeConflicts || w.mergeConflicts == MergeBaseBranch {
+		// merging needs the history back to where the branches diverged
+		if shallow {
+			if err := w.unshallow(ctx, cloneDir); err != nil {
+				return "", err
+			}
+		}
+		if err := w.mergeBase(ctx, cloneDir); err != nil {
+			return "", err
+		}
+	}
+	if w.mergeConflicts == UseMergeRef {
+		if err := w.checkoutMergeRef(ctx, cloneDir); err != nil {
+			return "", err
+		}
+	}
+	// the submodules are updated last since merging can change their commits
+	if w.submodules {
+		if err := w.updateSubmodules(ctx, cloneDir); err != nil {
+			return "", err
+		}
+	}
+	return cloneDir, nil
+}
+
+// fetch updates the clone left in cloneDir by a previous command instead of
+// cloning the repo again. The changes and untracked files left in it, ex.
+// plans and .terraform directories, are removed so it's as if it was just
+// cloned. It returns whether the clone is shallow and whether it was updated.
+// If it wasn't, ex. because there's no clone of the head repo in cloneDir or
+// it's corrupt, the repo needs to be cloned.
+func (w *FileWorkspace) fetch(ctx *CommandContext, cloneDir string) (bool, bool) {
+	// git would otherwise use the repo of a parent directory
+	if info, err := os.Stat(filepath.Join(cloneDir, ".git")); err != nil || !info.IsDir() {
+		return false, false
+	}
+	// the clone URL isn't logged since it can contain a token
+	if remote, err := w.git(cloneDir, "config", "--get", "remote.origin.url"); err != nil || strings.TrimSpace(remote) != ctx.HeadRepo.CloneURL {
+		ctx.Log.Info("existing clone in %q isn't of %q so cloning again", cloneDir, ctx.HeadRepo.SanitizedCloneURL)
+		return false, false
+	}
+	_, err := os.Stat(filepath.Join(cloneDir, ".git", "shallow"))
+	shallow := err == nil
+	if shallow && w.depth == 0 {
+		return false, false
+	}
+
+	ctx.Log.Info("fetching branch %q of %q into existing clone %q", ctx.Pull.Branch, ctx.HeadRepo.SanitizedCloneURL, cloneDir)
+	for _, args := range [][]string{{"reset", "--hard"}, {"clean", "-ffdx"}} {
+		if output, err := w.git(cloneDir, args...); err != nil {
+			ctx.Log.Warn("running git %s in existing clone failed so cloning again: %s: %s", strings.Join(args, " "), err, strings.TrimSpace(output))
+			return false, false
+		}
+	}
+	fetchArgs := []string{"fetch"}
+	if shallow {
+		fetchArgs = append(fetchArgs, "--depth", strconv.Itoa(w.depth))
+	}
+	fetchArgs = append(fetchArgs, "origin", fmt.Sprintf("+refs/heads/%s:refs/remotes/origin/%s", ctx.Pull.Branch, ctx.Pull.Branch))
+	if output, err := w.gitWithEnv(cloneDir, w.sshEnv(ctx, ctx.HeadRepo), fetchArgs...); err != nil {
+		ctx.Log.Warn("fetching into existing clone failed so cloning again: %s: %s", err, strings.TrimSpace(output))
+		return false, false
+	}
+	return shallow, true
+}
+
+// clone clones the head repo into cloneDir. If depth is set, only that many
+// commits of the pull request branch are cloned. If that fails, ex. because
+// the server doesn't support shallow clones, we fall back to a full clone.
+// It returns true if the clone is shallow.
+func (w *FileWorkspace) clone(ctx *CommandContext, cloneDir string) (bool, error) {
+	if w.depth > 0 {
+		ctx.Log.Info("shallow cloning branch %q of %q with depth %d into %q", ctx.Pull.Branch, ctx.HeadRepo.SanitizedCloneURL, w.depth, cloneDir)
+		cloneCmd := exec.Command("git", "clone", "--depth", strconv.Itoa(w.depth), "--branch", ctx.Pull.Branch, ctx.HeadRepo.CloneURL, cloneDir)
+		cloneCmd.Env = w.sshEnv(ctx, ctx.HeadRepo)
+		output, err := cloneCmd.CombinedOutput()
+		if err == nil {
+			return true, nil
+		}
+		ctx.Log.Warn("shallow clone failed so falling back to a full clone: %s: %s", err, strings.TrimSpace(string(output)))
+		// a failed clone can leave files behind that would fail the next one
+		if err := os.RemoveAll(cloneDir); err != nil {
+			return false, errors.Wrap(err, "deleting failed shallow clone")
+		}
+		if err := os.MkdirAll(cloneDir, 0755); err != nil {
+			return false, errors.Wrap(err, "creating new workspace")
+		}
 	}
 
 	ctx.Log.Info("git cloning %q into %q", ctx.HeadRepo.SanitizedCloneURL, cloneDir)
 	cloneCmd := exec.Command("git", "clone", ctx.HeadRepo.CloneURL, cloneDir)
+	cloneCmd.Env = w.sshEnv(ctx, ctx.HeadRepo)
 	if output, err := cloneCmd.CombinedOutput(); err != nil {
-		return "", errors.Wrapf(err, "cloning %s: %s", ctx.HeadRepo.SanitizedCloneURL, string(output))
+		return false, errors.Wrapf(err, "cloning %s: %s", ctx.HeadRepo.SanitizedCloneURL, string(output))
 	}
+	return false, nil
+}
 
-	// check out the branch for this PR
-	ctx.Log.Info("checking out branch %q", ctx.Pull.Branch)
-	checkoutCmd := exec.Command("git", "checkout", ctx.Pull.Branch)
-	checkoutCmd.Dir = cloneDir
-	if err := checkoutCmd.Run(); err != nil {
-		return "", errors.Wrapf(err, "checking out branch %s", ctx.Pull.Branch)
+// hasCommit returns true if commit is in the clone at cloneDir or if commit
+// is empty.
+func (w *FileWorkspace) hasCommit(cloneDir string, commit string) bool {
+	if commit == "" {
+		return true
 	}
-	return cloneDir, nil
+	_, err := w.git(cloneDir, "cat-file", "-e", commit+"^{commit}")
+	return err == nil
+}
+
+// unshallow fetches the rest of the history of the shallow clone at cloneDir.
+func (w *FileWorkspace) unshallow(ctx *CommandContext, cloneDir string) error {
+	ctx.Log.Info("fetching the full history of the shallow clone in %q", cloneDir)
+	if output, err := w.gitWithEnv(cloneDir, w.sshEnv(ctx, ctx.HeadRepo), "fetch", "--unshallow"); err != nil {
+		return errors.Wrapf(err, "fetching full history: %s", output)
+	}
+	return nil
+}
+
+// mergeBase merges the base branch of the pull request into the checked out
+// pull request branch in cloneDir. If there are conflicts, the merge is aborted
+// and a *MergeConflictError is returned. If we're only checking for conflicts,
+// the branch is reset to the head commit afterwards.
+func (w *FileWorkspace) mergeBase(ctx *CommandContext, cloneDir string) error {
+	// the base branch might be in a different repo if the pull request is from a fork
+	ctx.Log.Info("fetching base branch %q", ctx.Pull.BaseBranch)
+	if output, err := w.gitWithEnv(cloneDir, w.sshEnv(ctx, ctx.BaseRepo), "fetch", ctx.BaseRepo.CloneURL, ctx.Pull.BaseBranch); err != nil {
+		return errors.Wrapf(err, "fetching base branch %s from %s: %s", ctx.Pull.BaseBranch, ctx.BaseRepo.SanitizedCloneURL, output)
+	}
+
+	ctx.Log.Info("merging base branch %q into %q", ctx.Pull.BaseBranch, ctx.Pull.Branch)
+	if _, mergeErr := w.git(cloneDir, "-c", "user.name=atlantis", "-c", "user.email=atlantis@localhost", "merge", "--no-edit", "FETCH_HEAD"); mergeErr != nil {
+		conflicts, err := w.git(cloneDir, "diff", "--name-only", "--diff-filter=U")
+		if err != nil {
+			return errors.Wrapf(err, "listing conflicting files: %s", conflicts)
+		}
+		files := strings.Fields(conflicts)
+		if len(files) == 0 {
+			return errors.Wrapf(mergeErr, "merging base branch %s", ctx.Pull.BaseBranch)
+		}
+		if output, err := w.git(cloneDir, "merge", "--abort"); err != nil {
+			return errors.Wrapf(err, "aborting merge: %s", output)
+		}
+		return &MergeConflictError{BaseBranch: ctx.Pull.BaseBranch, Files: files}
+	}
+
+	if w.mergeConflicts == FailOnMergeConflicts {
+		if output, err := w.git(cloneDir, "reset", "--hard", ctx.Pull.HeadCommit); err != nil {
+			return errors.Wrapf(err, "resetting to %s after checking for merge conflicts: %s", ctx.Pull.HeadCommit, output)
+		}
+	}
+	return nil
+}
+
+// checkoutMergeRef moves the checked out pull request branch in cloneDir to
+// the pull request's merge commit. If the merge ref can't be fetched, ex.
+// because the pull request has conflicts, or it's for an older head commit
+// because it hasn't been updated yet, the branch is left at the head commit.
+func (w *FileWorkspace) checkoutMergeRef(ctx *CommandContext, cloneDir string) error {
+	ref := mergeRef(ctx.BaseRepo, ctx.Pull)
+	// the merge ref is in the base repo even if the pull request is from a fork
+	ctx.Log.Info("fetching merge ref %q", ref)
+	if output, err := w.gitWithEnv(cloneDir, w.sshEnv(ctx, ctx.BaseRepo), "fetch", ctx.BaseRepo.CloneURL, ref); err != nil {
+		ctx.Log.Warn("merge ref %q is unavailable so using branch %q at %q: %s", ref, ctx.Pull.Branch, ctx.Pull.HeadCommit, strings.TrimSpace(output))
+		return nil
+	}
+	// the merge commit's parents are the base branch and the head commit
+	parents, err := w.git(cloneDir, "rev-list", "--parents", "-n", "1", "FETCH_HEAD")
+	if err != nil {
+		return errors.Wrapf(err, "getting parents of merge ref %s: %s", ref, parents)
+	}
+	if ctx.Pull.HeadCommit != "" && !stringInSlice(ctx.Pull.HeadCommit, strings.Fields(parents)[1:]) {
+		ctx.Log.Warn("merge ref %q isn't for %q yet so using branch %q", ref, ctx.Pull.HeadCommit, ctx.Pull.Branch)
+		return nil
+	}
+	if output, err := w.git(cloneDir, "reset", "--hard", "FETCH_HEAD"); err != nil {
+		return errors.Wrapf(err, "checking out merge ref %s: %s", ref, output)
+	}
+	ctx.Log.Info("using merge ref %q at %q", ref, strings.Fields(parents)[0])
+	return nil
+}
+
+// updateSubmodules checks out the submodules of the commit checked out in
+// cloneDir, and their submodules, at the commits it records. Submodules are
+// fetched with the SSH key of the pull request's repo unless they're trusted
+// to use their own, see submoduleKey. Their submodules are fetched with the
+// same key.
+func (w *FileWorkspace) updateSubmodules(ctx *CommandContext, cloneDir string) error {
+	if _, err := os.Stat(filepath.Join(cloneDir, ".gitmodules")); os.IsNotExist(err) {
+		return nil
+	}
+	// a reused clone has the URLs of the submodules when they were first
+	// checked out
+	if output, err := w.git(cloneDir, "submodule", "sync", "--recursive"); err != nil {
+		return errors.Wrapf(err, "syncing submodule URLs: %s", output)
+	}
+	paths, err := w.git(cloneDir, "config", "-f", ".gitmodules", "--get-regexp", `^submodule\..*\.path$`)
+	if err != nil {
+		// git config exits with 1 if there aren't any
+		if _, ok := err.(*exec.ExitError); ok && strings.TrimSpace(paths) == "" {
+			return nil
+		}
+		return errors.Wrapf(err, "listing submodules: %s", paths)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(paths), "\n") {
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(fields[0], "submodule."), ".path")
+		submodulePath := fields[1]
+		submoduleURL, err := w.git(cloneDir, "config", "-f", ".gitmodules", "--get", "submodule."+name+".url")
+		if err != nil {
+			return errors.Wrapf(err, "getting the URL of submodule %s: %s", submodulePath, submoduleURL)
+		}
+		repo := submoduleRepo(ctx.HeadRepo, strings.TrimSpace(submoduleURL))
+		key, err := w.submoduleKey(ctx.HeadRepo, repo)
+		if err != nil {
+			return errors.Wrapf(err, "updating submodule %s", submodulePath)
+		}
+		ctx.Log.Info("updating submodule %q from %s", submodulePath, repo.FullName)
+		output, err := w.gitWithEnv(cloneDir, w.sshKeyEnv(ctx, key, repo), "submodule", "update", "--init", "--recursive", "--force", "--", submodulePath)
+		if err != nil {
+			return errors.Wrapf(err, "updating submodule %s: %s", submodulePath, output)
+		}
+		if output = strings.TrimSpace(output); output != "" {
+			ctx.Log.Info("updated submodule %q: %s", submodulePath, output)
+		}
+	}
+	return nil
+}
+
+// submoduleKey returns the path of the SSH key to fetch submodule, a
+// submodule of parent, with. That's parent's key unless submodule has a
+// different key of its own, which it can only use if it has the same owner as
+// parent or is listed in --repo-allowlist. Otherwise a pull request could add
+// a submodule to read any repo that one of our keys can.
+func (w *FileWorkspace) submoduleKey(parent models.Repo, submodule models.Repo) (string, error) {
+	parentKey := w.keyFor(parent)
+	key := w.keyFor(submodule)
+	if key == "" || key == parentKey {
+		return parentKey, nil
+	}
+	if strings.EqualFold(repoOwner(parent), repoOwner(submodule)) || w.repoAllowlist.Lists(submodule) {
+		return key, nil
+	}
+	return "", fmt.Errorf("%s isn't owned by %s or listed in --repo-allowlist so it can't be fetched with its own SSH key", submodule.FullName, repoOwner(parent))
+}
+
+// repoOwner returns the owner part of repo's full name, ex. hootsuite.
+func repoOwner(repo models.Repo) string {
+	return strings.SplitN(repo.FullName, "/", 2)[0]
+}
+
+// submoduleRepo returns the repo of the submodule of repo at submoduleURL,
+// with enough of it set to find its SSH key. submoduleURL can be a URL, an
+// scp-like SSH address or relative to repo, ex. ../modules.git.
+func submoduleRepo(repo models.Repo, submoduleURL string) models.Repo {
+	if strings.HasPrefix(submoduleURL, "./") || strings.HasPrefix(submoduleURL, "../") {
+		return models.Repo{
+			FullName:          strings.TrimSuffix(path.Join(repo.FullName, submoduleURL), ".git"),
+			SanitizedCloneURL: repo.SanitizedCloneURL,
+		}
+	}
+	fullName := submoduleURL
+	if i := strings.Index(submoduleURL, "://"); i >= 0 {
+		fullName = submoduleURL[i+len("://"):]
+		fullName = fullName[strings.Index(fullName, "/")+1:]
+	} else if colon := strings.Index(submoduleURL, ":"); colon >= 0 {
+		fullName = submoduleURL[colon+1:]
+	}
+	return models.Repo{
+		FullName:          strings.TrimSuffix(strings.Trim(fullName, "/"), ".git"),
+		SanitizedCloneURL: submoduleURL,
+	}
+}
+
+// mergeRef returns the ref that GitHub, GitLab or Bitbucket keeps the merge
+// commit of pull at.
+func mergeRef(repo models.Repo, pull models.PullRequest) string {
+	switch repo.VCSHost {
+	case models.Gitlab:
+		return fmt.Sprintf("refs/merge-requests/%d/merge", pull.Num)
+	case models.Bitbucket:
+		return fmt.Sprintf("refs/pull-requests/%d/merge", pull.Num)
+	}
+	return fmt.Sprintf("refs/pull/%d/merge", pull.Num)
+}
+
+func (w *FileWorkspace) git(dir string, args ...string) (string, error) {
+	return w.gitWithEnv(dir, nil, args...)
+}
+
+// gitWithEnv runs git in dir with env as its environment, or our environment
+// if env is nil.
+func (w *FileWorkspace) gitWithEnv(dir string, env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = env
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+// keyFor returns the path of the SSH key to clone repo with, or "" if there
+// isn't one.
+func (w *FileWorkspace) keyFor(repo models.Repo) string {
+	host := cloneURLHost(repo.SanitizedCloneURL)
+	if host != "" {
+		if key, ok := w.repoSSHKeys[host+"/"+repo.FullName]; ok {
+			return key
+		}
+	}
+	if key, ok := w.repoSSHKeys[repo.FullName]; ok {
+		return key
+	}
+	if key, ok := w.repoSSHKeys[host]; ok && host != "" {
+		return key
+	}
+	return w.sshKey
+}
+
+// sshEnv returns the environment to run git commands that talk to repo's
+// remote with so they use repo's SSH key rather than the global SSH config.
+// It returns nil, which runs git with our environment, if there's no key.
+func (w *FileWorkspace) sshEnv(ctx *CommandContext, repo models.Repo) []string {
+	return w.sshKeyEnv(ctx, w.keyFor(repo), repo)
+}
+
+// sshKeyEnv returns the environment to run git commands that talk to repo's
+// remote with so they use key, or nil if key is empty.
+func (w *FileWorkspace) sshKeyEnv(ctx *CommandContext, key string, repo models.Repo) []string {
+	if key == "" {
+		return nil
+	}
+	// only the path is logged since the key itself is a secret
+	ctx.Log.Info("using SSH key %q for %s", key, repo.FullName)
+	quoted := "'" + strings.Replace(key, "'", `'\''`, -1) + "'"
+	return append(os.Environ(), fmt.Sprintf("GIT_SSH_COMMAND=ssh -i %s -o IdentitiesOnly=yes", quoted))
+}
+
+// cloneURLHost returns the host of cloneURL, which can be a URL, ex.
+// https://github.com/owner/repo.git, or an scp-like SSH address, ex.
+// git@github.com:owner/repo.git. It returns "" if there's no host.
+func cloneURLHost(cloneURL string) string {
+	if strings.Contains(cloneURL, "://") {
+		u, err := url.Parse(cloneURL)
+		if err != nil {
+			return ""
+		}
+		return u.Hostname()
+	}
+	colon := strings.Index(cloneURL, ":")
+	if colon < 0 || strings.Contains(cloneURL[:colon], "/") {
+		return ""
+	}
+	return cloneURL[strings.Index(cloneURL, "@")+1 : colon]
+}
+
+// ParseRepoSSHKeys parses keys, a comma separated list of {match}={key path}
+// where match is a host, repo full name or both, ex.
+// "github.com=/keys/github,gitlab.com/owner/repo=/keys/repo", into a map of
+// each match to its path.
+func ParseRepoSSHKeys(keys string) (map[string]string, error) {
+	parsed := make(map[string]string)
+	for _, entry := range strings.Split(keys, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		eq := strings.Index(entry, "=")
+		if eq <= 0 || eq == len(entry)-1 {
+			return nil, fmt.Errorf("%q isn't in the form {host or repo}={key path}", entry)
+		}
+		parsed[entry[:eq]] = entry[eq+1:]
+	}
+	return parsed, nil
 }
 
 func (w *FileWorkspace) GetWorkspace(ctx *CommandContext) (string, error) {
@@ -64,6 +534,18 @@ func (w *FileWorkspace) GetWorkspace(ctx *CommandContext) (string, error) {
 	return repoDir, nil
 }
 
+func (w *FileWorkspace) PlannedCommit(repoDir string) (string, error) {
+	output, err := w.git(repoDir, "config", "--get", plannedCommitKey)
+	if err != nil {
+		// git config exits with 1 if the key isn't set
+		if _, ok := err.(*exec.ExitError); ok && strings.TrimSpace(output) == "" {
+			return "", nil
+		}
+		return "", errors.Wrapf(err, "getting planned commit: %s", output)
+	}
+	return strings.TrimSpace(output), nil
+}
+
 // Delete deletes the workspace for this repo and pull
 func (w *FileWorkspace) Delete(repo models.Repo, pull models.PullRequest) error {
 	return os.RemoveAll(w.repoPullDir(repo, pull))
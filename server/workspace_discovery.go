@@ -0,0 +1,59 @@
+package server
+
+import (
+	"sync"
+
+	version "github.com/hashicorp/go-version"
+	"github.com/hootsuite/atlantis/terraform"
+)
+
+// WorkspaceDiscovery lists the terraform workspaces that exist for a project.
+// Results are cached per clone so terraform only needs to be run once for each
+// project in a clone of the pull request.
+type WorkspaceDiscovery struct {
+	terraform *terraform.Client
+	mutex     sync.Mutex
+	// cache maps the absolute path to a project inside a clone to the
+	// workspaces we discovered for it
+	cache map[string]cachedWorkspaces
+}
+
+type cachedWorkspaces struct {
+	// commit is the head commit of the pull request when the clone was made.
+	// If the pull request has new commits then the repo will have been re-cloned.
+	commit     string
+	workspaces []string
+}
+
+func NewWorkspaceDiscovery(terraform *terraform.Client) *WorkspaceDiscovery {
+	return &WorkspaceDiscovery{
+		terraform: terraform,
+		cache:     make(map[string]cachedWorkspaces),
+	}
+}
+
+// List returns the workspaces for the project at absolutePath. If they
+// aren't cached, "terraform init" is run with extraInitArgs so that terraform
+// can read the workspaces from the project's backend.
+func (w *WorkspaceDiscovery) List(ctx *CommandContext, absolutePath string, extraInitArgs []string, version *version.Version) ([]string, error) {
+	w.mutex.Lock()
+	cached, ok := w.cache[absolutePath]
+	w.mutex.Unlock()
+	if ok && cached.commit == ctx.Pull.HeadCommit {
+		ctx.Log.Info("using cached workspaces for %q", absolutePath)
+		return cached.workspaces, nil
+	}
+
+	if _, err := w.terraform.RunCommandWithVersion(ctx.Log, absolutePath, append([]string{"init", "-no-color"}, extraInitArgs...), version, "default"); err != nil {
+		return nil, err
+	}
+	workspaces, err := w.terraform.ListWorkspaces(ctx.Log, absolutePath, version)
+	if err != nil {
+		return nil, err
+	}
+
+	w.mutex.Lock()
+	w.cache[absolutePath] = cachedWorkspaces{commit: ctx.Pull.HeadCommit, workspaces: workspaces}
+	w.mutex.Unlock()
+	return workspaces, nil
+}
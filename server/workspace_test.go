@@ -0,0 +1,550 @@
+package server
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hootsuite/atlantis/logging"
+	"github.com/hootsuite/atlantis/models"
+	. "github.com/hootsuite/atlantis/testing_util"
+)
+
+func TestClone_MergeConflicts(t *testing.T) {
+	cases := []struct {
+		mode        string
+		conflicting bool
+		expMerged   bool
+		expConflict bool
+	}{
+		{IgnoreMergeConflicts, true, false, false},
+		{FailOnMergeConflicts, false, false, false},
+		{FailOnMergeConflicts, true, false, true},
+		{MergeBaseBranch, false, true, false},
+		{MergeBaseBranch, true, false, true},
+	}
+	for _, c := range cases {
+		t.Logf("mode %s with conflicting: %t", c.mode, c.conflicting)
+		repoDir, headCommit := initTestRepo(t, c.conflicting)
+		dataDir, err := ioutil.TempDir("", "atlantis-test")
+		Ok(t, err)
+
+		w := &FileWorkspace{dataDir: dataDir, mergeConflicts: c.mode}
+		repo := models.Repo{FullName: "owner/repo", CloneURL: repoDir, SanitizedCloneURL: repoDir}
+		ctx := &CommandContext{
+			BaseRepo: repo,
+			HeadRepo: repo,
+			Pull:     models.PullRequest{Num: 1, Branch: "branch", BaseBranch: "master", HeadCommit: headCommit},
+			Command:  &Command{Environment: "default"},
+			Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+		}
+		cloneDir, err := w.Clone(ctx)
+		if c.expConflict {
+			conflictErr, ok := err.(*MergeConflictError)
+			Assert(t, ok, "expected a merge conflict error but got %v", err)
+			Equals(t, []string{"file.txt"}, conflictErr.Files)
+		} else {
+			Ok(t, err)
+			contents, err := ioutil.ReadFile(filepath.Join(cloneDir, "file.txt"))
+			Ok(t, err)
+			Equals(t, "branch\n", string(contents))
+			_, err = os.Stat(filepath.Join(cloneDir, "other.txt"))
+			Equals(t, c.expMerged, err == nil)
+		}
+		os.RemoveAll(repoDir)
+		os.RemoveAll(dataDir)
+	}
+}
+
+// initTestRepo creates a git repo with a master branch and a branch called
+// "branch" that each add a line to file.txt. If conflicting is false, the line
+// on master is added to a different file so the branches merge cleanly.
+// It returns the repo's directory and the commit at the head of branch.
+func initTestRepo(t *testing.T, conflicting bool) (string, string) {
+	dir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	run := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		output, err := cmd.CombinedOutput()
+		Assert(t, err == nil, "running git %v: %s", args, output)
+		return strings.TrimSpace(string(output))
+	}
+	run("init", "-q")
+	run("checkout", "-q", "-b", "master")
+	Ok(t, ioutil.WriteFile(filepath.Join(dir, "file.txt"), []byte(""), 0644))
+	run("add", ".")
+	run("commit", "-q", "-m", "initial")
+
+	run("checkout", "-q", "-b", "branch")
+	Ok(t, ioutil.WriteFile(filepath.Join(dir, "file.txt"), []byte("branch\n"), 0644))
+	run("commit", "-q", "-am", "branch")
+	headCommit := run("rev-parse", "HEAD")
+
+	run("checkout", "-q", "master")
+	if conflicting {
+		Ok(t, ioutil.WriteFile(filepath.Join(dir, "file.txt"), []byte("base\n"), 0644))
+	} else {
+		Ok(t, ioutil.WriteFile(filepath.Join(dir, "other.txt"), []byte("base\n"), 0644))
+	}
+	run("add", ".")
+	run("commit", "-q", "-m", "base")
+	return dir, headCommit
+}
+
+func TestClone_MergeRef(t *testing.T) {
+	cases := []struct {
+		description string
+		conflicting bool
+		staleRef    bool
+		expMerged   bool
+	}{
+		{"should check out the merge ref", false, false, true},
+		{"should use the branch if there's no merge ref because of conflicts", true, false, false},
+		{"should use the branch if the merge ref is for an older commit", false, true, false},
+	}
+	for _, c := range cases {
+		t.Log(c.description)
+		repoDir, headCommit := initTestRepo(t, c.conflicting)
+		dataDir, err := ioutil.TempDir("", "atlantis-test")
+		Ok(t, err)
+		git := func(args ...string) string {
+			cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+			cmd.Dir = repoDir
+			output, err := cmd.CombinedOutput()
+			Assert(t, err == nil, "running git %v: %s", args, output)
+			return strings.TrimSpace(string(output))
+		}
+		// GitHub keeps the merge commit of branch into master at the
+		// merge ref unless they conflict
+		if !c.conflicting {
+			git("checkout", "-q", "-b", "merge", "master")
+			mergeOf := "branch"
+			if c.staleRef {
+				mergeOf = "branch~1"
+			}
+			git("merge", "-q", "--no-edit", mergeOf)
+			git("update-ref", "refs/pull/1/merge", "HEAD")
+			git("checkout", "-q", "master")
+		}
+
+		w := &FileWorkspace{dataDir: dataDir, mergeConflicts: UseMergeRef}
+		repo := models.Repo{FullName: "owner/repo", CloneURL: repoDir, SanitizedCloneURL: repoDir}
+		ctx := &CommandContext{
+			BaseRepo: repo,
+			HeadRepo: repo,
+			Pull:     models.PullRequest{Num: 1, Branch: "branch", BaseBranch: "master", HeadCommit: headCommit},
+			Command:  &Command{Environment: "default"},
+			Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+		}
+		cloneDir, err := w.Clone(ctx)
+		Ok(t, err)
+		_, err = os.Stat(filepath.Join(cloneDir, "other.txt"))
+		Equals(t, c.expMerged, err == nil)
+		plannedCommit, err := w.PlannedCommit(cloneDir)
+		Ok(t, err)
+		Equals(t, headCommit, plannedCommit)
+		os.RemoveAll(repoDir)
+		os.RemoveAll(dataDir)
+	}
+}
+
+func TestClone_NoDetachedHead(t *testing.T) {
+	t.Log("the head commit should be checked out on a local branch rather than a detached HEAD")
+	repoDir, headCommit := initTestRepo(t, false)
+	defer os.RemoveAll(repoDir)
+	dataDir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(dataDir)
+
+	// push another commit to the branch so its tip is no longer the commit we plan
+	git := func(dir string, args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		output, err := cmd.CombinedOutput()
+		Assert(t, err == nil, "running git %v: %s", args, output)
+		return strings.TrimSpace(string(output))
+	}
+	git(repoDir, "checkout", "-q", "branch")
+	Ok(t, ioutil.WriteFile(filepath.Join(repoDir, "file.txt"), []byte("newer\n"), 0644))
+	git(repoDir, "commit", "-q", "-am", "newer")
+
+	w := &FileWorkspace{dataDir: dataDir, mergeConflicts: IgnoreMergeConflicts}
+	repo := models.Repo{FullName: "owner/repo", CloneURL: repoDir, SanitizedCloneURL: repoDir}
+	cloneDir, err := w.Clone(&CommandContext{
+		BaseRepo: repo,
+		HeadRepo: repo,
+		Pull:     models.PullRequest{Num: 1, Branch: "branch", BaseBranch: "master", HeadCommit: headCommit},
+		Command:  &Command{Environment: "default"},
+		Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	})
+	Ok(t, err)
+	Equals(t, "branch", git(cloneDir, "symbolic-ref", "--short", "HEAD"))
+	Equals(t, headCommit, git(cloneDir, "rev-parse", "HEAD"))
+}
+
+func TestClone_Depth(t *testing.T) {
+	cases := []struct {
+		description string
+		branch      string
+		moved       bool
+		mode        string
+		expShallow  bool
+	}{
+		{"should clone only the branch's recent history", "branch", false, IgnoreMergeConflicts, true},
+		{"should fall back to a full clone if the branch can't be shallow cloned", "missing", false, IgnoreMergeConflicts, false},
+		{"should fetch the full history if the head commit isn't in the shallow clone", "branch", true, IgnoreMergeConflicts, false},
+		{"should fetch the full history to merge the base branch", "branch", false, MergeBaseBranch, false},
+	}
+	for _, c := range cases {
+		t.Log(c.description)
+		repoDir, headCommit := initTestRepo(t, false)
+		dataDir, err := ioutil.TempDir("", "atlantis-test")
+		Ok(t, err)
+		git := func(dir string, args ...string) string {
+			cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+			cmd.Dir = dir
+			output, err := cmd.CombinedOutput()
+			Assert(t, err == nil, "running git %v: %s", args, output)
+			return strings.TrimSpace(string(output))
+		}
+		if c.moved {
+			git(repoDir, "checkout", "-q", "branch")
+			Ok(t, ioutil.WriteFile(filepath.Join(repoDir, "file.txt"), []byte("newer\n"), 0644))
+			git(repoDir, "commit", "-q", "-am", "newer")
+		}
+
+		// git ignores --depth when cloning a local path
+		w := &FileWorkspace{dataDir: dataDir, mergeConflicts: c.mode, depth: 1}
+		repo := models.Repo{FullName: "owner/repo", CloneURL: "file://" + repoDir, SanitizedCloneURL: repoDir}
+		cloneDir, err := w.Clone(&CommandContext{
+			BaseRepo: repo,
+			HeadRepo: repo,
+			Pull:     models.PullRequest{Num: 1, Branch: c.branch, BaseBranch: "master", HeadCommit: headCommit},
+			Command:  &Command{Environment: "default"},
+			Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+		})
+		Ok(t, err)
+		_, err = os.Stat(filepath.Join(cloneDir, ".git", "shallow"))
+		Equals(t, c.expShallow, err == nil)
+		Equals(t, c.branch, git(cloneDir, "symbolic-ref", "--short", "HEAD"))
+		if c.mode == IgnoreMergeConflicts {
+			Equals(t, headCommit, git(cloneDir, "rev-parse", "HEAD"))
+		}
+		os.RemoveAll(repoDir)
+		os.RemoveAll(dataDir)
+	}
+}
+
+func TestClone_Fetch(t *testing.T) {
+	repoDir, headCommit := initTestRepo(t, false)
+	defer os.RemoveAll(repoDir)
+	otherRepoDir, _ := initTestRepo(t, false)
+	defer os.RemoveAll(otherRepoDir)
+	dataDir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(dataDir)
+	git := func(dir string, args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		output, err := cmd.CombinedOutput()
+		Assert(t, err == nil, "running git %v: %s", args, output)
+		return strings.TrimSpace(string(output))
+	}
+	w := &FileWorkspace{dataDir: dataDir, mergeConflicts: IgnoreMergeConflicts}
+	repo := models.Repo{FullName: "owner/repo", CloneURL: repoDir, SanitizedCloneURL: repoDir}
+	ctx := &CommandContext{
+		BaseRepo: repo,
+		HeadRepo: repo,
+		Pull:     models.PullRequest{Num: 1, Branch: "branch", BaseBranch: "master", HeadCommit: headCommit},
+		Command:  &Command{Environment: "default"},
+		Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+	cloneDir, err := w.Clone(ctx)
+	Ok(t, err)
+	// the marker is only kept if the clone is reused
+	marker := filepath.Join(cloneDir, ".git", "marker")
+	Ok(t, ioutil.WriteFile(marker, []byte(""), 0644))
+
+	t.Log("an existing clone should be fetched into and cleaned")
+	Ok(t, ioutil.WriteFile(filepath.Join(cloneDir, "file.txt"), []byte("changed\n"), 0644))
+	Ok(t, ioutil.WriteFile(filepath.Join(cloneDir, "default.tfplan"), []byte(""), 0644))
+	git(repoDir, "checkout", "-q", "branch")
+	Ok(t, ioutil.WriteFile(filepath.Join(repoDir, "file.txt"), []byte("newer\n"), 0644))
+	git(repoDir, "commit", "-q", "-am", "newer")
+	ctx.Pull.HeadCommit = git(repoDir, "rev-parse", "HEAD")
+	_, err = w.Clone(ctx)
+	Ok(t, err)
+	_, err = os.Stat(marker)
+	Ok(t, err)
+	Equals(t, ctx.Pull.HeadCommit, git(cloneDir, "rev-parse", "HEAD"))
+	Equals(t, "branch", git(cloneDir, "symbolic-ref", "--short", "HEAD"))
+	contents, err := ioutil.ReadFile(filepath.Join(cloneDir, "file.txt"))
+	Ok(t, err)
+	Equals(t, "newer\n", string(contents))
+	_, err = os.Stat(filepath.Join(cloneDir, "default.tfplan"))
+	Assert(t, os.IsNotExist(err), "expected untracked files to be removed")
+
+	t.Log("a clone of a different remote should be cloned again")
+	otherRepo := models.Repo{FullName: "owner/repo", CloneURL: otherRepoDir, SanitizedCloneURL: otherRepoDir}
+	ctx.HeadRepo = otherRepo
+	ctx.BaseRepo = otherRepo
+	ctx.Pull.HeadCommit = git(otherRepoDir, "rev-parse", "branch")
+	_, err = w.Clone(ctx)
+	Ok(t, err)
+	_, err = os.Stat(marker)
+	Assert(t, os.IsNotExist(err), "expected the repo to be cloned again")
+	Equals(t, ctx.Pull.HeadCommit, git(cloneDir, "rev-parse", "HEAD"))
+
+	t.Log("a corrupt clone should be cloned again")
+	Ok(t, ioutil.WriteFile(marker, []byte(""), 0644))
+	Ok(t, ioutil.WriteFile(filepath.Join(cloneDir, ".git", "HEAD"), []byte("corrupt"), 0644))
+	_, err = w.Clone(ctx)
+	Ok(t, err)
+	_, err = os.Stat(marker)
+	Assert(t, os.IsNotExist(err), "expected the repo to be cloned again")
+	Equals(t, ctx.Pull.HeadCommit, git(cloneDir, "rev-parse", "HEAD"))
+}
+
+func TestClone_Submodules(t *testing.T) {
+	repoDir, _ := initTestRepo(t, false)
+	defer os.RemoveAll(repoDir)
+	submoduleDir, _ := initTestRepo(t, false)
+	defer os.RemoveAll(submoduleDir)
+	dataDir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(dataDir)
+	// git only allows submodules from local paths, like the test repos, if
+	// it's configured to
+	os.Setenv("GIT_CONFIG_COUNT", "1")
+	os.Setenv("GIT_CONFIG_KEY_0", "protocol.file.allow")
+	os.Setenv("GIT_CONFIG_VALUE_0", "always")
+	defer func() {
+		for _, key := range []string{"GIT_CONFIG_COUNT", "GIT_CONFIG_KEY_0", "GIT_CONFIG_VALUE_0"} {
+			os.Unsetenv(key)
+		}
+	}()
+	git := func(dir string, args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		output, err := cmd.CombinedOutput()
+		Assert(t, err == nil, "running git %v: %s", args, output)
+		return strings.TrimSpace(string(output))
+	}
+	git(repoDir, "checkout", "-q", "branch")
+	git(repoDir, "submodule", "-q", "add", submoduleDir, "modules/sub")
+	git(repoDir, "commit", "-q", "-m", "submodule")
+	headCommit := git(repoDir, "rev-parse", "HEAD")
+
+	repo := models.Repo{FullName: "owner/repo", CloneURL: repoDir, SanitizedCloneURL: repoDir}
+	ctx := &CommandContext{
+		BaseRepo: repo,
+		HeadRepo: repo,
+		Pull:     models.PullRequest{Num: 1, Branch: "branch", BaseBranch: "master", HeadCommit: headCommit},
+		Command:  &Command{Environment: "default"},
+		Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	}
+
+	t.Log("submodules should only be checked out if they're enabled")
+	w := &FileWorkspace{dataDir: dataDir, mergeConflicts: IgnoreMergeConflicts}
+	cloneDir, err := w.Clone(ctx)
+	Ok(t, err)
+	_, err = os.Stat(filepath.Join(cloneDir, "modules", "sub", "file.txt"))
+	Assert(t, os.IsNotExist(err), "expected the submodule not to be checked out")
+
+	w.submodules = true
+	for _, description := range []string{"cloned", "fetched"} {
+		t.Logf("submodules should be checked out when the repo is %s", description)
+		Ok(t, os.RemoveAll(filepath.Join(cloneDir, "modules", "sub", "file.txt")))
+		cloneDir, err = w.Clone(ctx)
+		Ok(t, err)
+		_, err = os.Stat(filepath.Join(cloneDir, "modules", "sub", "file.txt"))
+		Ok(t, err)
+		Equals(t, git(submoduleDir, "rev-parse", "HEAD"), git(filepath.Join(cloneDir, "modules", "sub"), "rev-parse", "HEAD"))
+	}
+}
+
+func TestSubmoduleRepo(t *testing.T) {
+	w := &FileWorkspace{
+		sshKey: "/keys/default",
+		repoSSHKeys: map[string]string{
+			"owner/modules":                    "/keys/modules",
+			"mirror.example.com/owner/modules": "/keys/mirror",
+		},
+	}
+	repo := models.Repo{FullName: "owner/repo", SanitizedCloneURL: "https://github.com/owner/repo.git"}
+	cases := []struct {
+		url         string
+		expFullName string
+		expKey      string
+	}{
+		{"https://github.com/owner/modules.git", "owner/modules", "/keys/modules"},
+		{"git@github.com:owner/modules.git", "owner/modules", "/keys/modules"},
+		{"ssh://git@mirror.example.com:2222/owner/modules.git", "owner/modules", "/keys/mirror"},
+		{"../modules.git", "owner/modules", "/keys/modules"},
+		{"https://github.com/other/modules", "other/modules", "/keys/default"},
+	}
+	for _, c := range cases {
+		t.Logf("testing %s", c.url)
+		submodule := submoduleRepo(repo, c.url)
+		Equals(t, c.expFullName, submodule.FullName)
+		Equals(t, c.expKey, w.keyFor(submodule))
+	}
+}
+
+func TestSubmoduleKey(t *testing.T) {
+	allowlist, err := NewRepoAllowlist("*,partner/listed")
+	Ok(t, err)
+	w := &FileWorkspace{
+		sshKey: "/keys/default",
+		repoSSHKeys: map[string]string{
+			"owner/repo":      "/keys/repo",
+			"owner/modules":   "/keys/modules",
+			"partner/listed":  "/keys/listed",
+			"partner/private": "/keys/private",
+		},
+		repoAllowlist: allowlist,
+	}
+	parent := models.Repo{FullName: "owner/repo", SanitizedCloneURL: "https://github.com/owner/repo.git"}
+	cases := []struct {
+		description string
+		url         string
+		expKey      string
+		expErr      string
+	}{
+		{"a repo with the same owner can use its own key", "git@github.com:owner/modules.git", "/keys/modules", ""},
+		{"a listed repo can use its own key", "git@github.com:partner/listed.git", "/keys/listed", ""},
+		{"other repos can't use their own key", "git@github.com:partner/private.git", "", "partner/private isn't owned by owner or listed in --repo-allowlist so it can't be fetched with its own SSH key"},
+		{"other repos can't use the default key either", "git@github.com:other/modules.git", "", "other/modules isn't owned by owner or listed in --repo-allowlist so it can't be fetched with its own SSH key"},
+		{"the parent's key is used for the parent's repo", "../repo.git", "/keys/repo", ""},
+	}
+	for _, c := range cases {
+		t.Log(c.description)
+		key, err := w.submoduleKey(parent, submoduleRepo(parent, c.url))
+		if c.expErr != "" {
+			Assert(t, err != nil, "expected an error")
+			Equals(t, c.expErr, err.Error())
+			continue
+		}
+		Ok(t, err)
+		Equals(t, c.expKey, key)
+	}
+
+	t.Log("a submodule without its own key uses the parent's key")
+	w.sshKey = ""
+	key, err := w.submoduleKey(parent, submoduleRepo(parent, "git@github.com:other/modules.git"))
+	Ok(t, err)
+	Equals(t, "/keys/repo", key)
+}
+
+func TestClone_MissingCloneURL(t *testing.T) {
+	t.Log("if the head repo has no clone URL we should return an error explaining why rather than running git")
+	dataDir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(dataDir)
+
+	w := &FileWorkspace{dataDir: dataDir, mergeConflicts: IgnoreMergeConflicts}
+	_, err = w.Clone(&CommandContext{
+		BaseRepo: models.Repo{FullName: "owner/repo"},
+		HeadRepo: models.Repo{FullName: "owner/repo"},
+		Pull:     models.PullRequest{Num: 1, Branch: "branch"},
+		Command:  &Command{Environment: "default"},
+		Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+	})
+	Equals(t, ErrMissingCloneURL, err)
+	Equals(t, "Unable to determine the repository clone URL. The source branch may have been deleted.", cloneFailure(err))
+}
+
+func TestPlannedCommit(t *testing.T) {
+	t.Log("the planned commit should be the pull request's head commit even if the base branch was merged in")
+	for _, mode := range []string{IgnoreMergeConflicts, MergeBaseBranch} {
+		repoDir, headCommit := initTestRepo(t, false)
+		dataDir, err := ioutil.TempDir("", "atlantis-test")
+		Ok(t, err)
+
+		w := &FileWorkspace{dataDir: dataDir, mergeConflicts: mode}
+		repo := models.Repo{FullName: "owner/repo", CloneURL: repoDir, SanitizedCloneURL: repoDir}
+		cloneDir, err := w.Clone(&CommandContext{
+			BaseRepo: repo,
+			HeadRepo: repo,
+			Pull:     models.PullRequest{Num: 1, Branch: "branch", BaseBranch: "master", HeadCommit: headCommit},
+			Command:  &Command{Environment: "default"},
+			Log:      logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug),
+		})
+		Ok(t, err)
+		planned, err := w.PlannedCommit(cloneDir)
+		Ok(t, err)
+		Equals(t, headCommit, planned)
+		os.RemoveAll(repoDir)
+		os.RemoveAll(dataDir)
+	}
+}
+
+func TestPlannedCommit_NotRecorded(t *testing.T) {
+	t.Log("clones that didn't record the planned commit should return an empty commit")
+	repoDir, _ := initTestRepo(t, false)
+	defer os.RemoveAll(repoDir)
+
+	w := &FileWorkspace{}
+	planned, err := w.PlannedCommit(repoDir)
+	Ok(t, err)
+	Equals(t, "", planned)
+}
+
+func TestKeyFor(t *testing.T) {
+	w := &FileWorkspace{
+		sshKey: "/keys/default",
+		repoSSHKeys: map[string]string{
+			"github.com":                    "/keys/github",
+			"owner/repo":                    "/keys/repo",
+			"mirror.example.com/owner/repo": "/keys/mirror",
+		},
+	}
+	cases := []struct {
+		cloneURL string
+		fullName string
+		expKey   string
+	}{
+		{"https://github.com/other/repo.git", "other/repo", "/keys/github"},
+		{"git@github.com:other/repo.git", "other/repo", "/keys/github"},
+		{"https://github.com/owner/repo.git", "owner/repo", "/keys/repo"},
+		{"ssh://git@mirror.example.com:2222/owner/repo.git", "owner/repo", "/keys/mirror"},
+		{"git@mirror.example.com:owner/repo.git", "owner/repo", "/keys/mirror"},
+		{"https://gitlab.com/other/repo.git", "other/repo", "/keys/default"},
+		{"/local/repo", "other/repo", "/keys/default"},
+	}
+	for _, c := range cases {
+		t.Logf("testing %s", c.cloneURL)
+		Equals(t, c.expKey, w.keyFor(models.Repo{FullName: c.fullName, SanitizedCloneURL: c.cloneURL}))
+	}
+
+	t.Log("without any keys git should use our environment")
+	w = &FileWorkspace{}
+	Assert(t, w.sshEnv(nil, models.Repo{FullName: "owner/repo"}) == nil, "expected no environment")
+}
+
+func TestSSHEnv(t *testing.T) {
+	w := &FileWorkspace{sshKey: "/keys/it's"}
+	ctx := &CommandContext{Log: logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug)}
+	env := w.sshEnv(ctx, models.Repo{FullName: "owner/repo"})
+	Equals(t, `GIT_SSH_COMMAND=ssh -i '/keys/it'\''s' -o IdentitiesOnly=yes`, env[len(env)-1])
+}
+
+func TestParseRepoSSHKeys(t *testing.T) {
+	keys, err := ParseRepoSSHKeys("github.com=/keys/github, owner/repo=/keys/repo,")
+	Ok(t, err)
+	Equals(t, map[string]string{"github.com": "/keys/github", "owner/repo": "/keys/repo"}, keys)
+
+	keys, err = ParseRepoSSHKeys("")
+	Ok(t, err)
+	Equals(t, map[string]string{}, keys)
+
+	for _, invalid := range []string{"github.com", "=/keys/github", "github.com="} {
+		_, err := ParseRepoSSHKeys(invalid)
+		Assert(t, err != nil, "expected an error for %q", invalid)
+	}
+}
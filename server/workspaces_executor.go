@@ -0,0 +1,134 @@
+package server
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	version "github.com/hashicorp/go-version"
+	"github.com/hootsuite/atlantis/github"
+	"github.com/hootsuite/atlantis/models"
+	"github.com/hootsuite/atlantis/terraform"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerCommandUsage(CommandUsage{
+		Name:        Workspaces,
+		Description: "Lists the terraform workspaces of the projects changed in the pull request",
+		Flags:       []string{"[--trust]"},
+	})
+}
+
+// WorkspacesExecutor handles the workspaces command which comments with the
+// terraform workspaces that exist for each project modified in the pull request.
+type WorkspacesExecutor struct {
+	github                github.Client
+	githubCommentRenderer *GithubCommentRenderer
+	configReader          *ConfigReader
+	concurrentRunLocker   *ConcurrentRunLocker
+	workspace             Workspace
+	terraform             *terraform.Client
+	workspaceDiscovery    *WorkspaceDiscovery
+	resultComments        *ResultComments
+	projectFinder         *ProjectFinder
+}
+
+func (w *WorkspacesExecutor) Execute(ctx *CommandContext) {
+	res := w.setupAndList(ctx)
+	res.Command = Workspaces
+	comment := w.githubCommentRenderer.Render(res, ctx.Log.History.String(), ctx.Command.Verbose)
+	w.resultComments.Create(ctx, Workspaces, comment)
+}
+
+func (w *WorkspacesExecutor) setupAndList(ctx *CommandContext) CommandResponse {
+	unlock, ok := w.concurrentRunLocker.TryLock(ctx.BaseRepo.FullName, ctx.Command.Environment, ctx.Pull.Num)
+	if !ok {
+		return w.failureResponse(ctx,
+			fmt.Sprintf("The %s environment is currently locked by another command that is running for this pull request. Wait until command is complete and try again.", ctx.Command.Environment))
+	}
+	defer unlock()
+
+	modifiedFiles, err := w.github.GetModifiedFiles(ctx.BaseRepo, ctx.Pull)
+	if err != nil {
+		return w.errorResponse(ctx, errors.Wrap(err, "getting modified files"))
+	}
+	modifiedTerraformFiles := w.projectFinder.ProjectFiles(modifiedFiles)
+	if len(modifiedTerraformFiles) == 0 {
+		return w.failureResponse(ctx, "No Terraform files were modified.")
+	}
+	projects := w.projectFinder.ModifiedProjects(ctx.BaseRepo.FullName, modifiedTerraformFiles)
+
+	// reuse an existing clone if there is one so we don't delete a plan
+	// that's waiting to be applied
+	cloneDir, err := w.workspace.GetWorkspace(ctx)
+	if err != nil {
+		cloneDir, err = w.workspace.Clone(ctx)
+		if failure := cloneFailure(err); failure != "" {
+			return w.failureResponse(ctx, failure)
+		}
+		if err != nil {
+			return w.errorResponse(ctx, err)
+		}
+	}
+
+	results := []ProjectResult{}
+	for _, project := range projects {
+		ctx.Log.Info("listing workspaces for project at path %q", project.Path)
+		result := w.list(ctx, cloneDir, project)
+		result.Path = project.Path
+		results = append(results, result)
+	}
+	return CommandResponse{ProjectResults: results}
+}
+
+func (w *WorkspacesExecutor) list(ctx *CommandContext, repoDir string, project models.Project) ProjectResult {
+	var config ProjectConfig
+	var err error
+	absolutePath := filepath.Join(repoDir, project.Path)
+	if w.configReader.Exists(absolutePath) {
+		config, err = w.configReader.Read(absolutePath)
+		if err != nil {
+			return ProjectResult{Error: err}
+		}
+	}
+	terraformVersion, err := projectTerraformVersion(ctx, w.terraform, absolutePath, config)
+	if err != nil {
+		return terraformErrResult(err)
+	}
+	constraints, _ := version.NewConstraint(">= 0.9.0")
+	if !constraints.Check(terraformVersion) {
+		return ProjectResult{Failure: fmt.Sprintf("Workspaces are only supported by terraform >= 0.9.0 but this project uses %s.", terraformVersion)}
+	}
+
+	workspaces, err := w.workspaceDiscovery.List(ctx, absolutePath, initArgs(ctx, absolutePath, config), terraformVersion)
+	if err != nil {
+		return terraformErrResult(err)
+	}
+	return ProjectResult{WorkspacesSuccess: workspaces}
+}
+
+func (w *WorkspacesExecutor) failureResponse(ctx *CommandContext, msg string) CommandResponse {
+	ctx.Log.Warn("%s", msg)
+	return CommandResponse{Failure: msg}
+}
+
+func (w *WorkspacesExecutor) errorResponse(ctx *CommandContext, err error) CommandResponse {
+	ctx.Log.Err("%s", err)
+	return CommandResponse{Error: err}
+}
+
+// workspaceNotFoundFailure is the failure message when a workspace selected
+// with -w isn't one of the workspaces discovered for the project.
+func workspaceNotFoundFailure(workspace string, workspaces []string) string {
+	return fmt.Sprintf("Workspace %q does not exist in this project. Available workspaces: %s. To create a new workspace, specify it without -w.", workspace, strings.Join(workspaces, ", "))
+}
+
+func stringInSlice(a string, list []string) bool {
+	for _, b := range list {
+		if b == a {
+			return true
+		}
+	}
+	return false
+}
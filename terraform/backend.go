@@ -0,0 +1,84 @@
+package terraform
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/parser"
+	"github.com/pkg/errors"
+)
+
+// Backend is a backend declared in a terraform block, ex.
+//
+//	terraform {
+//	  backend "s3" {
+//	    bucket = "mybucket"
+//	  }
+//	}
+type Backend struct {
+	// Type is the type of backend, ex. s3
+	Type string
+	// FullyDeclared is true if the backend block has its own settings rather
+	// than being empty and relying on -backend-config for partial configuration.
+	FullyDeclared bool
+}
+
+// DeclaredBackend returns the backend declared in the .tf files in dir or nil
+// if no backend is declared.
+func DeclaredBackend(dir string) (*Backend, error) {
+	tfBlocks, err := terraformBlocks(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, tfObj := range tfBlocks {
+		for _, b := range tfObj.List.Filter("backend").Items {
+			if len(b.Keys) != 1 {
+				continue
+			}
+			backendType, _ := b.Keys[0].Token.Value().(string)
+			settings, ok := b.Val.(*ast.ObjectType)
+			return &Backend{
+				Type:          backendType,
+				FullyDeclared: ok && len(settings.List.Items) > 0,
+			}, nil
+		}
+	}
+	return nil, nil
+}
+
+// terraformBlocks returns the contents of the terraform blocks in the .tf
+// files in dir.
+func terraformBlocks(dir string) ([]*ast.ObjectType, error) {
+	return topLevelBlocks(dir, "terraform")
+}
+
+// topLevelBlocks returns the contents of the top level blocks of type
+// blockType, ex. module, in the .tf files in dir.
+func topLevelBlocks(dir string, blockType string) ([]*ast.ObjectType, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+	var blocks []*ast.ObjectType
+	for _, f := range files {
+		raw, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading %s", f)
+		}
+		file, err := parser.Parse(raw)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing %s", f)
+		}
+		root, ok := file.Node.(*ast.ObjectList)
+		if !ok {
+			continue
+		}
+		for _, block := range root.Filter(blockType).Items {
+			if obj, ok := block.Val.(*ast.ObjectType); ok {
+				blocks = append(blocks, obj)
+			}
+		}
+	}
+	return blocks, nil
+}
@@ -0,0 +1,34 @@
+package terraform
+
+import (
+	"regexp"
+	"strings"
+)
+
+// graphNodeRegex matches the names of the nodes in the output of terraform
+// graph, ex. "[root] module.network.aws_security_group.web (destroy)".
+var graphNodeRegex = regexp.MustCompile(`"\[root\] ([^"]+)"`)
+
+// ResourceAddresses returns the addresses of the resources of resourceType,
+// ex. aws_security_group, in the output of terraform graph, in the order
+// they're first listed. The addresses can be planned with -target.
+func ResourceAddresses(graphOutput string, resourceType string) []string {
+	seen := make(map[string]bool)
+	var addresses []string
+	for _, match := range graphNodeRegex.FindAllStringSubmatch(graphOutput, -1) {
+		// strip suffixes like " (destroy)" and " (close)"
+		address := strings.SplitN(match[1], " ", 2)[0]
+		parts := strings.Split(address, ".")
+		// skip past the modules the resource is in
+		i := 0
+		for i+1 < len(parts) && parts[i] == "module" {
+			i += 2
+		}
+		if len(parts)-i != 2 || parts[i] != resourceType || seen[address] {
+			continue
+		}
+		seen[address] = true
+		addresses = append(addresses, address)
+	}
+	return addresses
+}
@@ -0,0 +1,44 @@
+package terraform
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/hcl/ast"
+)
+
+// LocalModules returns the directories, relative to dir, of the modules that
+// the .tf files in dir call from the local filesystem, ex. ../modules/vpc for
+//
+//	module "vpc" {
+//	  source = "../modules/vpc"
+//	}
+//
+// Modules from registries, git or other remote sources aren't included.
+func LocalModules(dir string) ([]string, error) {
+	moduleBlocks, err := topLevelBlocks(dir, "module")
+	if err != nil {
+		return nil, err
+	}
+	var modules []string
+	seen := make(map[string]bool)
+	for _, moduleObj := range moduleBlocks {
+		for _, item := range moduleObj.List.Filter("source").Items {
+			lit, ok := item.Val.(*ast.LiteralType)
+			if !ok {
+				continue
+			}
+			source, _ := lit.Token.Value().(string)
+			// like terraform, only paths starting with ./ or ../ are local
+			if !strings.HasPrefix(source, "./") && !strings.HasPrefix(source, "../") {
+				continue
+			}
+			source = filepath.Clean(source)
+			if !seen[source] {
+				modules = append(modules, source)
+				seen[source] = true
+			}
+		}
+	}
+	return modules, nil
+}
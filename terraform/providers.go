@@ -0,0 +1,24 @@
+package terraform
+
+import (
+	"regexp"
+)
+
+// providerDownloadRegex matches the line terraform init prints for each
+// provider plugin it installs, ex. - Downloading plugin for provider "aws" (1.2.0)...
+var providerDownloadRegex = regexp.MustCompile(`Downloading plugin for provider "([^"]+)" \(([^)]+)\)`)
+
+// ParseProviders parses the versions of the providers that terraform init
+// installed from its output. It returns a map from provider name to version
+// or nil if init didn't install any providers, ex. because it's < 0.10.0.
+func ParseProviders(initOutput string) map[string]string {
+	matches := providerDownloadRegex.FindAllStringSubmatch(initOutput, -1)
+	if len(matches) == 0 {
+		return nil
+	}
+	providers := make(map[string]string)
+	for _, match := range matches {
+		providers[match[1]] = match[2]
+	}
+	return providers
+}
@@ -0,0 +1,46 @@
+package terraform
+
+import (
+	"strings"
+
+	version "github.com/hashicorp/go-version"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/pkg/errors"
+)
+
+// RequiredVersion returns the versions of terraform allowed by the
+// required_version settings in the terraform blocks of the .tf files in dir,
+// ex. for
+//
+//	terraform {
+//	  required_version = ">= 0.10.0, < 0.11.0"
+//	}
+//
+// Like terraform, if there are multiple settings a version must satisfy all
+// of them. It returns nil if required_version isn't set.
+func RequiredVersion(dir string) (version.Constraints, error) {
+	tfBlocks, err := terraformBlocks(dir)
+	if err != nil {
+		return nil, err
+	}
+	var required []string
+	for _, tfObj := range tfBlocks {
+		for _, item := range tfObj.List.Filter("required_version").Items {
+			lit, ok := item.Val.(*ast.LiteralType)
+			if !ok {
+				continue
+			}
+			if s, ok := lit.Token.Value().(string); ok && s != "" {
+				required = append(required, s)
+			}
+		}
+	}
+	if len(required) == 0 {
+		return nil, nil
+	}
+	constraints, err := version.NewConstraint(strings.Join(required, ","))
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing required_version")
+	}
+	return constraints, nil
+}
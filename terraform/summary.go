@@ -0,0 +1,53 @@
+package terraform
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Summary is the number of resources a plan, apply or destroy adds, changes and destroys.
+type Summary struct {
+	Add     int `json:"add"`
+	Change  int `json:"change"`
+	Destroy int `json:"destroy"`
+}
+
+// terraform 1.5 and later also count the resources they import first, ex.
+// "Plan: 1 to import, 2 to add, 0 to change, 0 to destroy."
+var planSummaryRegex = regexp.MustCompile(`Plan: (?:\d+ to import, )?(\d+) to add, (\d+) to change, (\d+) to destroy`)
+var applySummaryRegex = regexp.MustCompile(`Resources: (?:\d+ imported, )?(\d+) added, (\d+) changed, (\d+) destroyed`)
+var destroySummaryRegex = regexp.MustCompile(`Destroy complete! Resources: (\d+) destroyed`)
+
+// noChangesLines are how versions of terraform say a plan has no changes.
+var noChangesLines = []string{
+	"No changes. Infrastructure is up-to-date",
+	// terraform 0.15 and later
+	"No changes. Your infrastructure matches the configuration.",
+}
+
+// ParseSummary parses the summary line from the output of terraform plan,
+// apply or destroy. It returns nil if the output doesn't have a summary.
+func ParseSummary(output string) *Summary {
+	for _, line := range noChangesLines {
+		if strings.Contains(output, line) {
+			return &Summary{}
+		}
+	}
+	if match := destroySummaryRegex.FindStringSubmatch(output); match != nil {
+		destroy, _ := strconv.Atoi(match[1])
+		return &Summary{Destroy: destroy}
+	}
+	match := planSummaryRegex.FindStringSubmatch(output)
+	if match == nil {
+		match = applySummaryRegex.FindStringSubmatch(output)
+	}
+	if match == nil {
+		return nil
+	}
+	// the regex guarantees these are numbers
+	add, _ := strconv.Atoi(match[1])
+	change, _ := strconv.Atoi(match[2])
+	destroy, _ := strconv.Atoi(match[3])
+	return &Summary{Add: add, Change: change, Destroy: destroy}
+}
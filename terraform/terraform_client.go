@@ -2,12 +2,17 @@
 package terraform
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"syscall"
+	"time"
 
 	"strings"
+	"sync"
 
 	version "github.com/hashicorp/go-version"
 	"github.com/hootsuite/atlantis/logging"
@@ -16,20 +21,98 @@ import (
 
 type Client struct {
 	defaultVersion *version.Version
+	// binDir is where versions of terraform needed by a project's
+	// required_version are downloaded to
+	binDir string
+	// downloadURL is where terraform releases are downloaded from. If it's
+	// empty, versions that aren't installed aren't downloaded.
+	downloadURL   string
+	downloadMutex sync.Mutex
+	// binaries are the paths of the executables to run for versions of
+	// terraform, keyed by version. They're used instead of looking for the
+	// version in $PATH or binDir.
+	binaries map[string]string
 }
 
 var versionRegex = regexp.MustCompile("Terraform v(.*)\n")
 
-func NewClient() (*Client, error) {
-	// may be use exec.LookPath?
+// NotInstalledError is returned when the terraform executable needed to run a
+// command can't be found in $PATH.
+type NotInstalledError struct {
+	// Executable is the name of the executable we looked for, ex. terraform0.8.8.
+	Executable string
+}
+
+func (n NotInstalledError) Error() string {
+	if filepath.IsAbs(n.Executable) {
+		return fmt.Sprintf("%s is not installed: it isn't an executable file", n.Executable)
+	}
+	return fmt.Sprintf("%s is not installed: could not find it in $PATH. Download terraform from https://www.terraform.io/downloads.html", n.Executable)
+}
+
+// ExitError is returned when terraform runs but exits with a non-zero exit code.
+type ExitError struct {
+	// ExitCode is terraform's exit code, ex. 2 when plan is run with
+	// -detailed-exitcode and there are changes.
+	ExitCode int
+	// Stderr is what terraform printed to stderr, which explains why it
+	// failed.
+	Stderr string
+	msg    string
+}
+
+func (e *ExitError) Error() string {
+	return e.msg
+}
+
+// TimeoutError is returned when terraform is stopped because it ran for
+// longer than its timeout.
+type TimeoutError struct {
+	// Command is the terraform command that was stopped, ex. plan.
+	Command string
+	Timeout time.Duration
+}
+
+func (t TimeoutError) Error() string {
+	return fmt.Sprintf("terraform %s timed out after %s so it was stopped", t.Command, t.Timeout)
+}
+
+// StopGracePeriod is how long terraform has to exit after it's interrupted
+// for running longer than its timeout before it's killed. Interrupting gives
+// it a chance to release its state lock.
+var StopGracePeriod = 30 * time.Second
+
+// ExitCode returns the exit code of the terraform command that returned err.
+// It's 0 if err is nil and -1 if terraform didn't run, ex. because it isn't installed.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(*ExitError); ok {
+		return exitErr.ExitCode
+	}
+	return -1
+}
+
+// NewClient returns a Client that runs the terraform executable in our $PATH
+// by default. Versions needed to satisfy a project's required_version are
+// downloaded from downloadURL into binDir, or not at all if downloadURL is empty.
+func NewClient(binDir string, downloadURL string) (*Client, error) {
+	return NewClientWithBinaries(binDir, downloadURL, nil)
+}
+
+// NewClientWithBinaries returns a Client like NewClient that also runs the
+// executables in binaries, which are keyed by version, for those versions.
+// See ParseBinaries.
+func NewClientWithBinaries(binDir string, downloadURL string, binaries map[string]string) (*Client, error) {
+	// check for the executable first so we can give a clear error rather
+	// than failing later in a plan
+	if _, err := exec.LookPath("terraform"); err != nil {
+		return nil, NotInstalledError{Executable: "terraform"}
+	}
 	versionCmdOutput, err := exec.Command("terraform", "version").CombinedOutput()
 	output := string(versionCmdOutput)
 	if err != nil {
-		// exec.go line 35, Error() returns
-		// "exec: " + strconv.Quote(e.Name) + ": " + e.Err.Error()
-		if err.Error() == fmt.Sprintf("exec: \"terraform\": %s", exec.ErrNotFound.Error()) {
-			return nil, errors.New("terraform not found in $PATH. \n\nDownload terraform from https://www.terraform.io/downloads.html")
-		}
 		return nil, errors.Wrapf(err, "running terraform version: %s", output)
 	}
 	match := versionRegex.FindStringSubmatch(output)
@@ -43,6 +126,9 @@ func NewClient() (*Client, error) {
 
 	return &Client{
 		defaultVersion: version,
+		binDir:         binDir,
+		downloadURL:    downloadURL,
+		binaries:       binaries,
 	}, nil
 }
 
@@ -52,14 +138,42 @@ func (c *Client) Version() *version.Version {
 }
 
 // RunCommandWithVersion executes the provided version of terraform with
-// the provided args in path. The variable "v" is the version of terraform executable to use and the variable "env" is the
+// the provided args in path and returns its stdout. If the command fails,
+// the error contains its stderr. The variable "v" is the version of terraform executable to use and the variable "env" is the
 // environment specified by the user commenting "atlantis plan/apply {env}" which is set to "default" by default.
 func (c *Client) RunCommandWithVersion(log *logging.SimpleLogger, path string, args []string, v *version.Version, env string) (string, error) {
+	return c.RunCommandWithEnvVars(log, path, args, v, env, nil)
+}
+
+// RunCommandWithEnvVars is the same as RunCommandWithVersion but also sets
+// extraEnvVars, which are in the form "KEY=value", on the terraform command.
+// They take precedence over Atlantis's own environment. Their values are never logged.
+func (c *Client) RunCommandWithEnvVars(log *logging.SimpleLogger, path string, args []string, v *version.Version, env string, extraEnvVars []string) (string, error) {
+	return c.RunCommandWithTimeout(log, path, args, v, env, extraEnvVars, 0)
+}
+
+// RunCommandWithTimeout is the same as RunCommandWithEnvVars but stops
+// terraform, and any process it started, if it's still running after timeout
+// and returns a TimeoutError. If timeout is 0, terraform can run for as long
+// as it needs.
+func (c *Client) RunCommandWithTimeout(log *logging.SimpleLogger, path string, args []string, v *version.Version, env string, extraEnvVars []string, timeout time.Duration) (string, error) {
 	tfExecutable := "terraform"
 	// if version is the same as the default, don't need to prepend the version name to the executable
 	if !v.Equal(c.defaultVersion) {
 		tfExecutable = fmt.Sprintf("%s%s", tfExecutable, v.String())
 	}
+	// the executable may have been removed since we started so we check
+	// before each run. Versions we downloaded aren't in our $PATH
+	if binary, ok := c.binaries[v.String()]; ok {
+		if !isExecutable(binary) {
+			return "", NotInstalledError{Executable: binary}
+		}
+		tfExecutable = binary
+	} else if downloaded := filepath.Join(c.binDir, tfExecutable); c.binDir != "" && isExecutable(downloaded) {
+		tfExecutable = downloaded
+	} else if _, err := exec.LookPath(tfExecutable); err != nil {
+		return "", NotInstalledError{Executable: tfExecutable}
+	}
 
 	// set environment variables
 	// this is to support scripts to use the ENVIRONMENT, ATLANTIS_TERRAFORM_VERSION
@@ -72,6 +186,8 @@ func (c *Client) RunCommandWithVersion(log *logging.SimpleLogger, path string, a
 		fmt.Sprintf("WORKSPACE=%s", path),
 	}
 	envVars = append(envVars, os.Environ()...)
+	// when there are duplicate keys the last one is used
+	envVars = append(envVars, extraEnvVars...)
 
 	// append terraform executable name with args
 	tfCmd := fmt.Sprintf("%s %s", tfExecutable, strings.Join(args, " "))
@@ -79,39 +195,146 @@ func (c *Client) RunCommandWithVersion(log *logging.SimpleLogger, path string, a
 	terraformCmd := exec.Command("sh", "-c", tfCmd)
 	terraformCmd.Dir = path
 	terraformCmd.Env = envVars
-	out, err := terraformCmd.CombinedOutput()
+	// stdout and stderr are captured separately so the output isn't
+	// interleaved with errors and warnings
+	var stdout, stderr bytes.Buffer
+	terraformCmd.Stdout = &stdout
+	terraformCmd.Stderr = &stderr
 	commandStr := strings.Join(terraformCmd.Args, " ")
+	err := runWithTimeout(log, terraformCmd, timeout)
+	if timedOut, ok := err.(TimeoutError); ok {
+		if len(args) > 0 {
+			timedOut.Command = args[0]
+		}
+		log.Warn("stopped %q in %q after %s: \n%s", commandStr, path, timeout, stderr.String())
+		return stdout.String(), timedOut
+	}
 	if err != nil {
-		err := fmt.Errorf("%s: running %q in %q: \n%s", err, commandStr, path, out)
-		log.Debug("error: %s", err)
-		return string(out), err
+		msg := fmt.Sprintf("%s: running %q in %q: \n%s", err, commandStr, path, stderr.String())
+		log.Debug("error: %s", msg)
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+				return stdout.String(), &ExitError{ExitCode: status.ExitStatus(), Stderr: stderr.String(), msg: msg}
+			}
+		}
+		return stdout.String(), errors.New(msg)
+	}
+	if stderr.Len() > 0 {
+		log.Warn("running %q in %q printed to stderr: %s", commandStr, path, stderr.String())
 	}
 	log.Info("successfully ran %q in %q", commandStr, path)
-	return string(out), nil
+	return stdout.String(), nil
+}
+
+// runWithTimeout runs cmd and waits for it to exit. If it's still running after timeout,
+// it's interrupted, then killed after StopGracePeriod, and a TimeoutError is
+// returned. terraform runs in its own process group so the providers and
+// scripts it starts are stopped with it.
+func runWithTimeout(log *logging.SimpleLogger, cmd *exec.Cmd, timeout time.Duration) error {
+	if timeout <= 0 {
+		return cmd.Run()
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	exited := make(chan struct{})
+	// read before the timer fires since it can still be running after we return
+	gracePeriod := StopGracePeriod
+	timer := time.AfterFunc(timeout, func() {
+		pgid := -cmd.Process.Pid
+		syscall.Kill(pgid, syscall.SIGINT)
+		select {
+		case <-exited:
+		case <-time.After(gracePeriod):
+			log.Warn("killing %q since it didn't exit %s after being interrupted", strings.Join(cmd.Args, " "), gracePeriod)
+			syscall.Kill(pgid, syscall.SIGKILL)
+		}
+	})
+	err := cmd.Wait()
+	close(exited)
+	// if the timer already fired, terraform was stopped because it timed out
+	if !timer.Stop() {
+		return TimeoutError{Timeout: timeout}
+	}
+	return err
+}
+
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir() && info.Mode()&0111 != 0
+}
+
+// workspaceConstraint matches the versions that have the "terraform workspace"
+// command. Earlier versions only have "terraform env" which was deprecated in
+// 0.10.0 in favour of it.
+var workspaceConstraint, _ = version.NewConstraint(">= 0.10.0")
+
+// workspaceCommand returns the subcommand that manages workspaces in version.
+func workspaceCommand(v *version.Version) string {
+	if workspaceConstraint.Check(v) {
+		return "workspace"
+	}
+	return "env"
 }
 
-// RunInitAndEnv executes "terraform init" and "terraform env select" in path.
+// RunInitAndEnv executes "terraform init" and selects env with "terraform
+// workspace select", or "terraform env select" before 0.10.0, in path.
 // env is the environment to select and extraInitArgs are additional arguments
-// applied to the init command.
-func (c *Client) RunInitAndEnv(log *logging.SimpleLogger, path string, env string, extraInitArgs []string, version *version.Version) ([]string, error) {
+// applied to the init command. extraEnvVars are set on each command as in
+// RunCommandWithEnvVars.
+func (c *Client) RunInitAndEnv(log *logging.SimpleLogger, path string, env string, extraInitArgs []string, version *version.Version, extraEnvVars []string) ([]string, error) {
 	var outputs []string
-	// run terraform init
-	output, err := c.RunCommandWithVersion(log, path, append([]string{"init", "-no-color"}, extraInitArgs...), version, env)
+	output, err := c.RunInit(log, path, env, extraInitArgs, version, extraEnvVars)
 	outputs = append(outputs, output)
 	if err != nil {
 		return outputs, err
 	}
-
-	// run terraform env new and select
-	output, err = c.RunCommandWithVersion(log, path, []string{"env", "select", "-no-color", env}, version, env)
+	output, err = c.RunSelectEnv(log, path, env, version, extraEnvVars)
 	outputs = append(outputs, output)
+	return outputs, err
+}
+
+// RunInit executes "terraform init" in path with extraInitArgs and returns its
+// output.
+func (c *Client) RunInit(log *logging.SimpleLogger, path string, env string, extraInitArgs []string, version *version.Version, extraEnvVars []string) (string, error) {
+	return c.RunCommandWithEnvVars(log, path, append([]string{"init", "-no-color"}, extraInitArgs...), version, env, extraEnvVars)
+}
+
+// RunSelectEnv selects env with "terraform workspace select", or "terraform
+// env select" before 0.10.0, in path. If env doesn't exist yet it's created.
+func (c *Client) RunSelectEnv(log *logging.SimpleLogger, path string, env string, version *version.Version, extraEnvVars []string) (string, error) {
+	workspaceCmd := workspaceCommand(version)
+	output, err := c.RunCommandWithEnvVars(log, path, []string{workspaceCmd, "select", "-no-color", env}, version, env, extraEnvVars)
+	if err != nil {
+		// if terraform workspace select fails we will run terraform
+		// workspace new to create a new environment
+		if _, err := c.RunCommandWithEnvVars(log, path, []string{workspaceCmd, "new", "-no-color", env}, version, env, extraEnvVars); err != nil {
+			return output, err
+		}
+	}
+	return output, nil
+}
+
+// ListWorkspaces returns the workspaces (environments) that exist for the
+// terraform project in path. "terraform init" must have already been run in path.
+func (c *Client) ListWorkspaces(log *logging.SimpleLogger, path string, version *version.Version) ([]string, error) {
+	output, err := c.RunCommandWithVersion(log, path, []string{workspaceCommand(version), "list", "-no-color"}, version, "default")
 	if err != nil {
-		// if terraform env select fails we will run terraform env new
-		// to create a new environment
-		output, err = c.RunCommandWithVersion(log, path, []string{"env", "new", "-no-color", env}, version, env)
-		if err != nil {
-			return outputs, err
+		return nil, err
+	}
+	return ParseWorkspaces(output), nil
+}
+
+// ParseWorkspaces parses the output of "terraform env list" into the list of
+// workspace names. The current workspace is marked with a "*" which is stripped.
+func ParseWorkspaces(output string) []string {
+	var workspaces []string
+	for _, line := range strings.Split(output, "\n") {
+		name := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "*"))
+		if name != "" {
+			workspaces = append(workspaces, name)
 		}
 	}
-	return outputs, nil
+	return workspaces
 }
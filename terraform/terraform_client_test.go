@@ -0,0 +1,483 @@
+package terraform_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-version"
+	"github.com/hootsuite/atlantis/logging"
+	"github.com/hootsuite/atlantis/terraform"
+	. "github.com/hootsuite/atlantis/testing_util"
+)
+
+func TestNewClient_NotInstalled(t *testing.T) {
+	t.Log("if terraform isn't in the path we should get a NotInstalledError")
+	oldPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", oldPath)
+	os.Setenv("PATH", "")
+
+	_, err := terraform.NewClient("", "")
+	Assert(t, err != nil, "expected error")
+	Equals(t, terraform.NotInstalledError{Executable: "terraform"}, err)
+	Equals(t, "terraform is not installed: could not find it in $PATH. Download terraform from https://www.terraform.io/downloads.html", err.Error())
+}
+
+// fakeTerraform is a terraform executable that prints its version and
+// otherwise writes to stdout and stderr, failing if its first argument is "fail".
+// "hang" runs for longer than any test should take and "stubborn" also ignores
+// being interrupted.
+var fakeTerraform = `#!/bin/sh
+if [ "$1" = "version" ]; then
+  echo "Terraform v0.10.0"
+  exit 0
+fi
+echo "stdout output"
+echo "stderr output" 1>&2
+if [ "$1" = "fail" ]; then
+  exit 1
+fi
+if [ "$1" = "changes" ]; then
+  exit 2
+fi
+if [ "$1" = "stubborn" ]; then
+  trap '' INT
+  sleep 10
+fi
+if [ "$1" = "hang" ]; then
+  sleep 10
+fi
+`
+
+func TestRunCommandWithVersion_SeparatesStderr(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(dir)
+	Ok(t, ioutil.WriteFile(filepath.Join(dir, "terraform"), []byte(fakeTerraform), 0755))
+	oldPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", oldPath)
+	os.Setenv("PATH", dir+":"+oldPath)
+
+	client, err := terraform.NewClient("", "")
+	Ok(t, err)
+	logger := logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug)
+
+	t.Log("on success only stdout should be returned")
+	output, err := client.RunCommandWithVersion(logger, dir, []string{"plan"}, client.Version(), "default")
+	Ok(t, err)
+	Equals(t, "stdout output\n", output)
+
+	t.Log("on failure stdout should be returned and the error should contain stderr")
+	output, err = client.RunCommandWithVersion(logger, dir, []string{"fail"}, client.Version(), "default")
+	Assert(t, err != nil, "expected error")
+	Equals(t, "stdout output\n", output)
+	Assert(t, strings.HasSuffix(err.Error(), "\nstderr output\n"), "expected stderr in error but got %q", err.Error())
+	Assert(t, !strings.Contains(err.Error(), "stdout output"), "expected no stdout in error but got %q", err.Error())
+}
+
+func TestRunCommandWithVersion_ExitCode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(dir)
+	Ok(t, ioutil.WriteFile(filepath.Join(dir, "terraform"), []byte(fakeTerraform), 0755))
+	oldPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", oldPath)
+	os.Setenv("PATH", dir+":"+oldPath)
+
+	client, err := terraform.NewClient("", "")
+	Ok(t, err)
+	logger := logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug)
+
+	_, err = client.RunCommandWithVersion(logger, dir, []string{"plan"}, client.Version(), "default")
+	Equals(t, 0, terraform.ExitCode(err))
+	_, err = client.RunCommandWithVersion(logger, dir, []string{"fail"}, client.Version(), "default")
+	Equals(t, 1, terraform.ExitCode(err))
+	_, err = client.RunCommandWithVersion(logger, dir, []string{"changes"}, client.Version(), "default")
+	Equals(t, 2, terraform.ExitCode(err))
+	Equals(t, -1, terraform.ExitCode(terraform.NotInstalledError{Executable: "terraform"}))
+}
+
+func TestRunCommandWithTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(dir)
+	Ok(t, ioutil.WriteFile(filepath.Join(dir, "terraform"), []byte(fakeTerraform), 0755))
+	oldPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", oldPath)
+	os.Setenv("PATH", dir+":"+oldPath)
+	oldGracePeriod := terraform.StopGracePeriod
+	defer func() { terraform.StopGracePeriod = oldGracePeriod }()
+	terraform.StopGracePeriod = 100 * time.Millisecond
+
+	client, err := terraform.NewClient("", "")
+	Ok(t, err)
+	logger := logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug)
+
+	t.Log("a command that finishes in time should run as usual")
+	output, err := client.RunCommandWithTimeout(logger, dir, []string{"plan"}, client.Version(), "default", nil, 5*time.Second)
+	Ok(t, err)
+	Equals(t, "stdout output\n", output)
+	_, err = client.RunCommandWithTimeout(logger, dir, []string{"changes"}, client.Version(), "default", nil, 5*time.Second)
+	Equals(t, 2, terraform.ExitCode(err))
+
+	for _, cmd := range []string{"hang", "stubborn"} {
+		t.Logf("%s should be stopped once it times out", cmd)
+		start := time.Now()
+		output, err = client.RunCommandWithTimeout(logger, dir, []string{cmd}, client.Version(), "default", nil, 200*time.Millisecond)
+		Equals(t, terraform.TimeoutError{Command: cmd, Timeout: 200 * time.Millisecond}, err)
+		Equals(t, "stdout output\n", output)
+		Assert(t, time.Since(start) < 5*time.Second, "expected %s to be stopped but it ran for %s", cmd, time.Since(start))
+	}
+	Equals(t, "terraform plan timed out after 1m0s so it was stopped", terraform.TimeoutError{Command: "plan", Timeout: time.Minute}.Error())
+}
+
+// recordingTerraform is a terraform executable that appends its arguments to
+// the file "args" in the directory it's run in. "select" fails so that the
+// workspace is created with "new".
+var recordingTerraform = `#!/bin/sh
+if [ "$1" = "version" ]; then
+  echo "Terraform v0.10.0"
+  exit 0
+fi
+echo "$@" >> args
+if [ "$2" = "select" ]; then
+  exit 1
+fi
+`
+
+func TestRunInitAndEnv_WorkspaceCommand(t *testing.T) {
+	t.Log("terraform workspace should be used from 0.10.0 and terraform env before that")
+	dir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(dir)
+	Ok(t, ioutil.WriteFile(filepath.Join(dir, "terraform"), []byte(recordingTerraform), 0755))
+	Ok(t, ioutil.WriteFile(filepath.Join(dir, "terraform0.9.11"), []byte(recordingTerraform), 0755))
+	oldPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", oldPath)
+	os.Setenv("PATH", dir+":"+oldPath)
+
+	client, err := terraform.NewClient("", "")
+	Ok(t, err)
+	logger := logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug)
+	cases := []struct {
+		Version  string
+		Expected string
+	}{
+		{"0.10.0", "init -no-color\nworkspace select -no-color staging\nworkspace new -no-color staging\nworkspace list -no-color\n"},
+		{"0.9.11", "init -no-color\nenv select -no-color staging\nenv new -no-color staging\nenv list -no-color\n"},
+	}
+	for _, c := range cases {
+		t.Log("version " + c.Version)
+		projectDir, err := ioutil.TempDir(dir, "project")
+		Ok(t, err)
+		v, err := version.NewVersion(c.Version)
+		Ok(t, err)
+		_, err = client.RunInitAndEnv(logger, projectDir, "staging", nil, v, nil)
+		Ok(t, err)
+		_, err = client.ListWorkspaces(logger, projectDir, v)
+		Ok(t, err)
+		args, err := ioutil.ReadFile(filepath.Join(projectDir, "args"))
+		Ok(t, err)
+		Equals(t, c.Expected, string(args))
+	}
+}
+
+func TestLocalModules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(dir)
+	contents := `module "vpc" {
+  source = "../modules/vpc"
+}
+module "vpc_copy" {
+  source = "../modules/vpc/"
+}
+module "local" {
+  source = "./nested"
+}
+module "consul" {
+  source = "hashicorp/consul/aws"
+}
+module "git" {
+  source = "git::https://example.com/vpc.git"
+}
+resource "null_resource" "a" {}
+`
+	Ok(t, ioutil.WriteFile(filepath.Join(dir, "main.tf"), []byte(contents), 0644))
+	modules, err := terraform.LocalModules(dir)
+	Ok(t, err)
+	Equals(t, []string{"../modules/vpc", "nested"}, modules)
+}
+
+func TestParseWorkspaces(t *testing.T) {
+	output := "  default\n* staging\n  production\n\n"
+	Equals(t, []string{"default", "staging", "production"}, terraform.ParseWorkspaces(output))
+}
+
+func TestParseWorkspaces_Empty(t *testing.T) {
+	Equals(t, []string(nil), terraform.ParseWorkspaces(""))
+}
+
+func TestDeclaredBackend(t *testing.T) {
+	cases := []struct {
+		Description string
+		Contents    string
+		Expected    *terraform.Backend
+	}{
+		{
+			"no backend",
+			`resource "null_resource" "a" {}`,
+			nil,
+		},
+		{
+			"fully declared backend",
+			"terraform {\n  backend \"s3\" {\n    bucket = \"mybucket\"\n  }\n}\n",
+			&terraform.Backend{Type: "s3", FullyDeclared: true},
+		},
+		{
+			"partial backend",
+			"terraform {\n  required_version = \">= 0.9\"\n  backend \"s3\" {}\n}\n",
+			&terraform.Backend{Type: "s3", FullyDeclared: false},
+		},
+	}
+	for _, c := range cases {
+		t.Log(c.Description)
+		dir, err := ioutil.TempDir("", "atlantis-test")
+		Ok(t, err)
+		Ok(t, ioutil.WriteFile(filepath.Join(dir, "main.tf"), []byte(c.Contents), 0644))
+		backend, err := terraform.DeclaredBackend(dir)
+		os.RemoveAll(dir)
+		Ok(t, err)
+		Equals(t, c.Expected, backend)
+	}
+}
+
+func TestRequiredVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	t.Log("no required_version should return nil")
+	Ok(t, ioutil.WriteFile(filepath.Join(dir, "main.tf"), []byte(`resource "null_resource" "a" {}`), 0644))
+	constraints, err := terraform.RequiredVersion(dir)
+	Ok(t, err)
+	Assert(t, constraints == nil, "expected no constraints but got %s", constraints)
+
+	t.Log("required_version in multiple files should all apply")
+	Ok(t, ioutil.WriteFile(filepath.Join(dir, "versions.tf"), []byte("terraform {\n  required_version = \">= 0.9.0\"\n}\n"), 0644))
+	Ok(t, ioutil.WriteFile(filepath.Join(dir, "backend.tf"), []byte("terraform {\n  required_version = \"< 0.11.0\"\n  backend \"s3\" {}\n}\n"), 0644))
+	constraints, err = terraform.RequiredVersion(dir)
+	Ok(t, err)
+	Equals(t, true, constraints.Check(version.Must(version.NewVersion("0.10.7"))))
+	Equals(t, false, constraints.Check(version.Must(version.NewVersion("0.8.8"))))
+	Equals(t, false, constraints.Check(version.Must(version.NewVersion("0.11.0"))))
+}
+
+func TestResolveVersion(t *testing.T) {
+	pathDir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(pathDir)
+	binDir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(binDir)
+	Ok(t, ioutil.WriteFile(filepath.Join(pathDir, "terraform"), []byte(fakeTerraform), 0755))
+	Ok(t, ioutil.WriteFile(filepath.Join(pathDir, "terraform0.9.11"), []byte(fakeTerraform), 0755))
+	oldPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", oldPath)
+	os.Setenv("PATH", pathDir+":"+oldPath)
+	logger := logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug)
+
+	// serve a list of releases and a zip of the fake terraform for each,
+	// with their checksums
+	var zipped bytes.Buffer
+	z := zip.NewWriter(&zipped)
+	f, err := z.Create("terraform")
+	Ok(t, err)
+	f.Write([]byte(fakeTerraform))
+	Ok(t, z.Close())
+	sum := sha256.Sum256(zipped.Bytes())
+	shasums := fmt.Sprintf("%x  terraform.zip\n", sum)
+	build := fmt.Sprintf(`{"os": %q, "arch": %q, "filename": "terraform.zip", "url": "%%s/terraform.zip"}`, runtime.GOOS, runtime.GOARCH)
+	downloads := 0
+	var releases *httptest.Server
+	releases = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/terraform/index.json":
+			b := fmt.Sprintf(build, releases.URL)
+			fmt.Fprintf(w, `{"versions": {"0.11.0": {"shasums": "SHA256SUMS", "builds": [%s]}, "0.11.1": {"shasums": "SHA256SUMS", "builds": [%s]}, "0.12.0-beta1": {"shasums": "SHA256SUMS", "builds": [%s]}, "0.13.0": {"builds": []}, "0.14.0": {"shasums": "BADSUMS", "builds": [%s]}, "0.15.0": {"builds": [%s]}}}`, b, b, b, b, b)
+		case "/terraform/0.11.0/SHA256SUMS", "/terraform/0.11.1/SHA256SUMS", "/terraform/0.12.0-beta1/SHA256SUMS":
+			fmt.Fprint(w, shasums)
+		case "/terraform/0.14.0/BADSUMS":
+			fmt.Fprintf(w, "%x  terraform.zip\n", sha256.Sum256([]byte("other")))
+		case "/terraform.zip":
+			downloads++
+			w.Write(zipped.Bytes())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer releases.Close()
+
+	client, err := terraform.NewClient(binDir, releases.URL)
+	Ok(t, err)
+	resolve := func(constraint string) (string, error) {
+		constraints, err := version.NewConstraint(constraint)
+		Ok(t, err)
+		v, err := client.ResolveVersion(logger, constraints)
+		if err != nil {
+			return "", err
+		}
+		return v.String(), nil
+	}
+
+	t.Log("the newest installed version that satisfies the constraint should be used")
+	v, err := resolve(">= 0.9.0")
+	Ok(t, err)
+	Equals(t, "0.10.0", v)
+	v, err = resolve("< 0.10.0")
+	Ok(t, err)
+	Equals(t, "0.9.11", v)
+	Equals(t, 0, downloads)
+
+	t.Log("if no installed version satisfies the constraint the newest release that does should be downloaded")
+	v, err = resolve(">= 0.11.0, < 0.13.0")
+	Ok(t, err)
+	Equals(t, "0.11.1", v)
+	Equals(t, 1, downloads)
+	output, err := client.RunCommandWithVersion(logger, pathDir, []string{"plan"}, version.Must(version.NewVersion("0.11.1")), "default")
+	Ok(t, err)
+	Equals(t, "stdout output\n", output)
+
+	t.Log("versions that were downloaded should count as installed")
+	v, err = resolve("~> 0.11.0")
+	Ok(t, err)
+	Equals(t, "0.11.1", v)
+	Equals(t, 1, downloads)
+
+	t.Log("if no release satisfies the constraint we should get a NoMatchingVersionError")
+	_, err = resolve("~> 0.13.0")
+	_, ok := err.(terraform.NoMatchingVersionError)
+	Assert(t, ok, "expected NoMatchingVersionError but got %v", err)
+
+	t.Log("releases that don't match their checksum shouldn't be installed")
+	_, err = resolve("~> 0.14.0")
+	Equals(t, terraform.NoMatchingVersionError{Constraints: "~> 0.14.0", Reason: fmt.Sprintf("checksum of %s/terraform.zip doesn't match the one in %s/terraform/0.14.0/BADSUMS", releases.URL, releases.URL)}, err)
+	_, err = os.Stat(filepath.Join(binDir, "terraform0.14.0"))
+	Assert(t, os.IsNotExist(err), "expected terraform0.14.0 not to be installed")
+
+	t.Log("releases without checksums shouldn't be installed")
+	_, err = resolve(">= 0.15.0")
+	Equals(t, terraform.NoMatchingVersionError{Constraints: ">= 0.15.0", Reason: fmt.Sprintf("%s/terraform.zip has no SHA256SUMS to verify it against", releases.URL)}, err)
+
+	t.Log("if downloads are disabled we should get a NoMatchingVersionError")
+	client, err = terraform.NewClient("", "")
+	Ok(t, err)
+	_, err = resolve(">= 0.11.0")
+	Equals(t, terraform.NoMatchingVersionError{Constraints: ">= 0.11.0", Reason: "downloading terraform is disabled"}, err)
+}
+
+func TestResourceAddresses(t *testing.T) {
+	graph := `digraph {
+	compound = "true"
+	newrank = "true"
+	subgraph "root" {
+		"[root] aws_security_group.web" [label = "aws_security_group.web", shape = "box"]
+		"[root] aws_security_group_rule.web" [label = "aws_security_group_rule.web", shape = "box"]
+		"[root] data.aws_security_group.default" [label = "data.aws_security_group.default", shape = "box"]
+		"[root] module.network.aws_security_group.db" [label = "module.network.aws_security_group.db", shape = "box"]
+		"[root] provider.aws" [label = "provider.aws", shape = "diamond"]
+		"[root] aws_security_group_rule.web" -> "[root] aws_security_group.web"
+		"[root] module.network.aws_security_group.db (destroy)" -> "[root] provider.aws"
+		"[root] provider.aws (close)" -> "[root] aws_security_group.web"
+	}
+}
+`
+	Equals(t, []string{"aws_security_group.web", "module.network.aws_security_group.db"}, terraform.ResourceAddresses(graph, "aws_security_group"))
+	Equals(t, []string{"aws_security_group_rule.web"}, terraform.ResourceAddresses(graph, "aws_security_group_rule"))
+	Equals(t, []string(nil), terraform.ResourceAddresses(graph, "aws_instance"))
+}
+
+func TestParseSummary(t *testing.T) {
+	Equals(t, &terraform.Summary{Add: 1, Change: 2, Destroy: 3}, terraform.ParseSummary("+ null_resource.a\n\nPlan: 1 to add, 2 to change, 3 to destroy.\n"))
+	Equals(t, &terraform.Summary{Add: 4, Change: 0, Destroy: 1}, terraform.ParseSummary("Apply complete! Resources: 4 added, 0 changed, 1 destroyed.\n"))
+	Equals(t, &terraform.Summary{Destroy: 2}, terraform.ParseSummary("Destroy complete! Resources: 2 destroyed.\n"))
+	Equals(t, &terraform.Summary{}, terraform.ParseSummary("No changes. Infrastructure is up-to-date.\n"))
+
+	t.Log("newer versions of terraform should be parsed too")
+	Equals(t, &terraform.Summary{}, terraform.ParseSummary("No changes. Your infrastructure matches the configuration.\n"))
+	Equals(t, &terraform.Summary{Add: 2}, terraform.ParseSummary("Plan: 1 to import, 2 to add, 0 to change, 0 to destroy.\n"))
+	Equals(t, &terraform.Summary{Add: 2, Destroy: 1}, terraform.ParseSummary("Apply complete! Resources: 1 imported, 2 added, 0 changed, 1 destroyed.\n"))
+	Assert(t, terraform.ParseSummary("Error: something went wrong") == nil, "expected no summary")
+}
+
+func TestParseProviders(t *testing.T) {
+	output := `Initializing provider plugins...
+- Checking for available provider plugins on https://releases.hashicorp.com...
+- Downloading plugin for provider "aws" (1.2.0)...
+- Downloading plugin for provider "null" (0.1.0)...
+
+Terraform has been successfully initialized!`
+	Equals(t, map[string]string{"aws": "1.2.0", "null": "0.1.0"}, terraform.ParseProviders(output))
+	Equals(t, map[string]string(nil), terraform.ParseProviders("Terraform has been successfully initialized!"))
+}
+
+func TestParseBinaries(t *testing.T) {
+	binaries, err := terraform.ParseBinaries(" 0.11.14=/opt/tf/0.11/terraform, v0.12.0=/opt/tf/0.12/terraform,")
+	Ok(t, err)
+	Equals(t, map[string]string{"0.11.14": "/opt/tf/0.11/terraform", "0.12.0": "/opt/tf/0.12/terraform"}, binaries)
+
+	binaries, err = terraform.ParseBinaries("")
+	Ok(t, err)
+	Equals(t, 0, len(binaries))
+
+	for _, invalid := range []string{"0.11.14", "=/opt/terraform", "0.11.14=", "latest=/opt/terraform", "0.11.14=terraform"} {
+		_, err := terraform.ParseBinaries(invalid)
+		Assert(t, err != nil, "expected an error for %q", invalid)
+	}
+}
+
+func TestRunCommandWithVersion_Binaries(t *testing.T) {
+	t.Log("the configured binary for a version should be run instead of looking in $PATH")
+	pathDir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(pathDir)
+	binaryDir, err := ioutil.TempDir("", "atlantis-test")
+	Ok(t, err)
+	defer os.RemoveAll(binaryDir)
+	Ok(t, ioutil.WriteFile(filepath.Join(pathDir, "terraform"), []byte(fakeTerraform), 0755))
+	Ok(t, ioutil.WriteFile(filepath.Join(binaryDir, "terraform"), []byte("#!/bin/sh\necho configured\n"), 0755))
+	oldPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", oldPath)
+	os.Setenv("PATH", pathDir+":"+oldPath)
+	logger := logging.NewSimpleLogger("", log.New(os.Stderr, "", log.LstdFlags), false, logging.Debug)
+	missing := filepath.Join(binaryDir, "missing")
+
+	client, err := terraform.NewClientWithBinaries("", "", map[string]string{"0.11.14": filepath.Join(binaryDir, "terraform"), "0.12.0": missing})
+	Ok(t, err)
+	output, err := client.RunCommandWithVersion(logger, pathDir, []string{"plan"}, version.Must(version.NewVersion("0.11.14")), "default")
+	Ok(t, err)
+	Equals(t, "configured\n", output)
+
+	t.Log("the configured binaries that exist should be installed versions")
+	var installed []string
+	for _, v := range client.InstalledVersions() {
+		installed = append(installed, v.String())
+	}
+	Equals(t, []string{"0.11.14", "0.10.0"}, installed)
+
+	t.Log("if the configured binary doesn't exist we should get a NotInstalledError")
+	_, err = client.RunCommandWithVersion(logger, pathDir, []string{"plan"}, version.Must(version.NewVersion("0.12.0")), "default")
+	Equals(t, terraform.NotInstalledError{Executable: missing}, err)
+	Equals(t, missing+" is not installed: it isn't an executable file", err.Error())
+}
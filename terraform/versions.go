@@ -0,0 +1,320 @@
+package terraform
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	version "github.com/hashicorp/go-version"
+	"github.com/hootsuite/atlantis/logging"
+	"github.com/pkg/errors"
+)
+
+// DefaultDownloadURL is where terraform releases are downloaded from.
+const DefaultDownloadURL = "https://releases.hashicorp.com"
+
+// downloadClient is used to download releases. Its timeout stops a release
+// server that stops responding from holding the download lock forever.
+var downloadClient = &http.Client{Timeout: 5 * time.Minute}
+
+// versionedExecutableRegex matches executables for specific versions of
+// terraform, ex. terraform0.8.8.
+var versionedExecutableRegex = regexp.MustCompile(`^terraform(\d+\.\d+\.\d+\S*)$`)
+
+// NoMatchingVersionError is returned when no version of terraform that
+// satisfies a project's required_version is installed or can be downloaded.
+type NoMatchingVersionError struct {
+	// Constraints is the project's required_version.
+	Constraints string
+	// Reason explains why a version couldn't be downloaded.
+	Reason string
+}
+
+func (n NoMatchingVersionError) Error() string {
+	return fmt.Sprintf("no installed version of terraform satisfies required_version %q and one couldn't be downloaded: %s", n.Constraints, n.Reason)
+}
+
+// ParseBinaries parses binaries, a comma separated list of {version}={path},
+// ex. "0.11.14=/opt/terraform/0.11.14/terraform", into a map of each version
+// to the absolute path of its executable.
+func ParseBinaries(binaries string) (map[string]string, error) {
+	parsed := make(map[string]string)
+	for _, entry := range strings.Split(binaries, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		eq := strings.Index(entry, "=")
+		if eq <= 0 || eq == len(entry)-1 {
+			return nil, fmt.Errorf("%q isn't in the form {version}={path}", entry)
+		}
+		v, err := version.NewVersion(entry[:eq])
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing version of %q", entry)
+		}
+		path := entry[eq+1:]
+		if !filepath.IsAbs(path) {
+			return nil, fmt.Errorf("path of %q must be absolute", entry)
+		}
+		parsed[v.String()] = path
+	}
+	return parsed, nil
+}
+
+// InstalledVersions returns the versions of terraform that can be run, newest
+// first. That's the terraform executable in our $PATH, the configured
+// binaries, executables named terraform{version} in our $PATH and the
+// versions we've downloaded.
+func (c *Client) InstalledVersions() []*version.Version {
+	seen := map[string]bool{c.defaultVersion.String(): true}
+	versions := []*version.Version{c.defaultVersion}
+	for s, binary := range c.binaries {
+		v, err := version.NewVersion(s)
+		if err != nil || seen[v.String()] || !isExecutable(binary) {
+			continue
+		}
+		seen[v.String()] = true
+		versions = append(versions, v)
+	}
+	dirs := append(filepath.SplitList(os.Getenv("PATH")), c.binDir)
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, f := range files {
+			match := versionedExecutableRegex.FindStringSubmatch(f.Name())
+			if match == nil || f.IsDir() || f.Mode()&0111 == 0 {
+				continue
+			}
+			v, err := version.NewVersion(match[1])
+			if err != nil || seen[v.String()] {
+				continue
+			}
+			seen[v.String()] = true
+			versions = append(versions, v)
+		}
+	}
+	sort.Sort(sort.Reverse(version.Collection(versions)))
+	return versions
+}
+
+// ResolveVersion returns the newest installed version of terraform that
+// satisfies constraints. If none do, the newest release that satisfies them
+// is downloaded, unless downloads are disabled. Prereleases are only
+// downloaded if constraints explicitly ask for one.
+func (c *Client) ResolveVersion(log *logging.SimpleLogger, constraints version.Constraints) (*version.Version, error) {
+	for _, v := range c.InstalledVersions() {
+		if constraints.Check(v) {
+			return v, nil
+		}
+	}
+	if c.downloadURL == "" {
+		return nil, NoMatchingVersionError{Constraints: constraints.String(), Reason: "downloading terraform is disabled"}
+	}
+
+	// only one download at a time so two projects that need the same
+	// version don't both download it
+	c.downloadMutex.Lock()
+	defer c.downloadMutex.Unlock()
+	// it may have been downloaded while we were waiting
+	for _, v := range c.InstalledVersions() {
+		if constraints.Check(v) {
+			return v, nil
+		}
+	}
+	v, build, err := c.newestRelease(constraints)
+	if err != nil {
+		return nil, NoMatchingVersionError{Constraints: constraints.String(), Reason: err.Error()}
+	}
+	log.Info("downloading terraform %s from %s", v, build.URL)
+	if err := c.download(v, build); err != nil {
+		return nil, NoMatchingVersionError{Constraints: constraints.String(), Reason: err.Error()}
+	}
+	return v, nil
+}
+
+// releaseIndex is the index of releases at {downloadURL}/terraform/index.json.
+type releaseIndex struct {
+	Versions map[string]struct {
+		// Shasums is the name of the release's SHA256SUMS file, ex.
+		// terraform_0.11.1_SHA256SUMS
+		Shasums string         `json:"shasums"`
+		Builds  []releaseBuild `json:"builds"`
+	} `json:"versions"`
+}
+
+type releaseBuild struct {
+	OS       string `json:"os"`
+	Arch     string `json:"arch"`
+	Filename string `json:"filename"`
+	URL      string `json:"url"`
+	// shasumsURL is the URL of the SHA256SUMS file of the build's release
+	shasumsURL string
+}
+
+// newestRelease returns the newest release of terraform that satisfies
+// constraints and its build for this OS and architecture.
+func (c *Client) newestRelease(constraints version.Constraints) (*version.Version, releaseBuild, error) {
+	indexURL := strings.TrimSuffix(c.downloadURL, "/") + "/terraform/index.json"
+	resp, err := downloadClient.Get(indexURL)
+	if err != nil {
+		return nil, releaseBuild{}, errors.Wrap(err, "getting list of releases")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, releaseBuild{}, fmt.Errorf("getting list of releases from %s: %s", indexURL, resp.Status)
+	}
+	var index releaseIndex
+	if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+		return nil, releaseBuild{}, errors.Wrap(err, "parsing list of releases")
+	}
+
+	// prereleases satisfy constraints like >= 0.11.0 so we skip them unless
+	// a constraint names one
+	allowPrereleases := strings.Contains(constraints.String(), "-")
+	var newest *version.Version
+	var newestBuild releaseBuild
+	for raw, release := range index.Versions {
+		v, err := version.NewVersion(raw)
+		if err != nil || !constraints.Check(v) || (newest != nil && !v.GreaterThan(newest)) {
+			continue
+		}
+		if v.Prerelease() != "" && !allowPrereleases {
+			continue
+		}
+		var shasumsURL string
+		if release.Shasums != "" {
+			shasumsURL = fmt.Sprintf("%s/terraform/%s/%s", strings.TrimSuffix(c.downloadURL, "/"), raw, release.Shasums)
+		}
+		for _, b := range release.Builds {
+			if b.OS == runtime.GOOS && b.Arch == runtime.GOARCH {
+				newest = v
+				newestBuild = b
+				newestBuild.shasumsURL = shasumsURL
+			}
+		}
+	}
+	if newest == nil {
+		return nil, releaseBuild{}, fmt.Errorf("no release for %s_%s satisfies it", runtime.GOOS, runtime.GOARCH)
+	}
+	return newest, newestBuild, nil
+}
+
+// download downloads the zipped terraform executable of build, checks it
+// against its release's SHA256SUMS and installs it into our bin dir as
+// terraform{v}.
+func (c *Client) download(v *version.Version, build releaseBuild) error {
+	url := build.URL
+	raw, err := get(url)
+	if err != nil {
+		return err
+	}
+	if err := verifySHA256(build, raw); err != nil {
+		return err
+	}
+	archive, err := zip.NewReader(bytes.NewReader(raw), int64(len(raw)))
+	if err != nil {
+		return errors.Wrapf(err, "unzipping %s", url)
+	}
+	var executable *zip.File
+	for _, f := range archive.File {
+		if f.Name == "terraform" && f.FileInfo().Mode().IsRegular() {
+			executable = f
+			break
+		}
+	}
+	if executable == nil {
+		return fmt.Errorf("%s doesn't contain a terraform executable", url)
+	}
+
+	if err := os.MkdirAll(c.binDir, 0755); err != nil {
+		return errors.Wrap(err, "creating bin dir")
+	}
+	src, err := executable.Open()
+	if err != nil {
+		return errors.Wrapf(err, "unzipping %s", url)
+	}
+	defer src.Close()
+	// write to a temporary file first so a partial download is never run
+	dest := filepath.Join(c.binDir, "terraform"+v.String())
+	tmp := dest + ".download"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return errors.Wrap(err, "creating terraform executable")
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return errors.Wrap(err, "writing terraform executable")
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return errors.Wrap(err, "writing terraform executable")
+	}
+	return errors.Wrap(os.Rename(tmp, dest), "installing terraform executable")
+}
+
+// verifySHA256 returns an error unless raw, the downloaded zip of build, has
+// the checksum listed for it in its release's SHA256SUMS.
+func verifySHA256(build releaseBuild, raw []byte) error {
+	if build.shasumsURL == "" || build.Filename == "" {
+		return fmt.Errorf("%s has no SHA256SUMS to verify it against", build.URL)
+	}
+	sums, err := get(build.shasumsURL)
+	if err != nil {
+		return err
+	}
+	// each line is {hex digest}  {filename}
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || fields[1] != build.Filename {
+			continue
+		}
+		expected, err := hex.DecodeString(fields[0])
+		if err != nil {
+			return fmt.Errorf("checksum of %s in %s isn't hex", build.Filename, build.shasumsURL)
+		}
+		actual := sha256.Sum256(raw)
+		if !bytes.Equal(expected, actual[:]) {
+			return fmt.Errorf("checksum of %s doesn't match the one in %s", build.URL, build.shasumsURL)
+		}
+		return nil
+	}
+	return fmt.Errorf("%s doesn't list a checksum for %s", build.shasumsURL, build.Filename)
+}
+
+// get returns the body of url.
+func get(url string) ([]byte, error) {
+	resp, err := downloadClient.Get(url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "downloading %s", url)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading %s: %s", url, resp.Status)
+	}
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "downloading %s", url)
+	}
+	return raw, nil
+}